@@ -22,6 +22,13 @@ type Config struct {
 	MinIOSecretKey  string
 	MinIOBucketName string
 
+	// StorageBackend picks the backend of the server seeded on first boot:
+	// "minio" (default) or "fs". With "fs" blobs live under StorageFSRoot and
+	// the MinIO variables are optional. Servers added later choose their own
+	// backend in the admin panel.
+	StorageBackend string
+	StorageFSRoot  string
+
 	CookieDomain string
 	CookieSecure bool
 
@@ -83,11 +90,59 @@ type Config struct {
 	// PremiumTierPriceCents is the one-time charge for the premium tier.
 	PremiumTierPriceCents int
 	PremiumTierCurrency   string // ISO 4217, e.g. "USD"
+
+	// ReplicationFactor / ReplicationFactorPremium are the number of copies
+	// (1 or 2) kept of each blob for regular and premium users. A per-user
+	// override can be set from the admin panel.
+	ReplicationFactor        int
+	ReplicationFactorPremium int
+
+	// AllocationPolicy chooses the drive new users are placed on:
+	// "best-fit" (default), "least-loaded", "round-robin" or "tier-aware".
+	// An invitation can pin a drive or pick another policy.
+	AllocationPolicy string
+
+	// JobWorkers is the number of background jobs (transcodes, thumbnails,
+	// capture-date probes) run at once.
+	JobWorkers int
+
+	// WebhookAllowPrivate lets webhooks target private, loopback and
+	// link-local addresses. Off by default so user webhooks cannot reach
+	// services inside the deployment; turn on to test against a local
+	// receiver.
+	WebhookAllowPrivate bool
+
+	// BackupTarget enables scheduled off-site backups: "fs" (BackupPath on
+	// a local disk), "s3" (a bucket on a second S3 endpoint) or "sftp"
+	// (BackupPath is the mount point of a remote share). Empty disables
+	// backups. Restore with the cmd/restore binary.
+	BackupTarget        string
+	BackupPath          string
+	BackupS3Endpoint    string
+	BackupS3Region      string
+	BackupS3Bucket      string
+	BackupS3AccessKey   string
+	BackupS3SecretKey   string
+	BackupS3UseSSL      bool
+	BackupIntervalHours int
 }
 
 func loadConfig() Config {
 	quotaPct, _ := strconv.Atoi(getEnv("QUOTA_WARNING_THRESHOLD_PERCENT", "80"))
 	premiumPrice, _ := strconv.Atoi(getEnv("PREMIUM_TIER_PRICE_CENTS", "999"))
+	replicationFactor, _ := strconv.Atoi(getEnv("REPLICATION_FACTOR", "1"))
+	replicationFactorPremium, _ := strconv.Atoi(getEnv("REPLICATION_FACTOR_PREMIUM", "1"))
+	jobWorkers, _ := strconv.Atoi(getEnv("JOB_WORKERS", "2"))
+	backupIntervalHours, _ := strconv.Atoi(getEnv("BACKUP_INTERVAL_HOURS", "24"))
+	if backupIntervalHours <= 0 {
+		backupIntervalHours = 24
+	}
+
+	storageBackend := getEnv("STORAGE_BACKEND", "minio")
+	minioEnv := requireEnv
+	if storageBackend == "fs" {
+		minioEnv = func(key string) string { return getEnv(key, "") }
+	}
 
 	return Config{
 		Port: getEnv("PORT", "8080"),
@@ -105,10 +160,12 @@ func loadConfig() Config {
 		KeycloakClientID:     requireEnv("KEYCLOAK_CLIENT_ID"),
 		KeycloakClientSecret: requireEnv("KEYCLOAK_CLIENT_SECRET"),
 
-		MinIOEndpoint:   requireEnv("MINIO_ENDPOINT"),
-		MinIOAccessKey:  requireEnv("MINIO_ROOT_USER"),
-		MinIOSecretKey:  requireEnv("MINIO_ROOT_PASSWORD"),
-		MinIOBucketName: requireEnv("MINIO_BUCKET_NAME"),
+		MinIOEndpoint:   minioEnv("MINIO_ENDPOINT"),
+		MinIOAccessKey:  minioEnv("MINIO_ROOT_USER"),
+		MinIOSecretKey:  minioEnv("MINIO_ROOT_PASSWORD"),
+		MinIOBucketName: minioEnv("MINIO_BUCKET_NAME"),
+		StorageBackend:  storageBackend,
+		StorageFSRoot:   getEnv("STORAGE_FS_ROOT", "/data/blobs"),
 
 		CookieDomain: requireEnv("COOKIE_DOMAIN"),
 		CookieSecure: os.Getenv("COOKIE_SECURE") == "true",
@@ -142,6 +199,25 @@ func loadConfig() Config {
 		PayPalEnvironment:     getEnv("PAYPAL_ENV", "sandbox"),
 		PremiumTierPriceCents: premiumPrice,
 		PremiumTierCurrency:   getEnv("PREMIUM_TIER_CURRENCY", "USD"),
+
+		ReplicationFactor:        replicationFactor,
+		ReplicationFactorPremium: replicationFactorPremium,
+
+		AllocationPolicy: getEnv("ALLOCATION_POLICY", "best-fit"),
+
+		JobWorkers: jobWorkers,
+
+		WebhookAllowPrivate: getEnv("WEBHOOK_ALLOW_PRIVATE", "false") == "true",
+
+		BackupTarget:        getEnv("BACKUP_TARGET", ""),
+		BackupPath:          getEnv("BACKUP_PATH", ""),
+		BackupS3Endpoint:    getEnv("BACKUP_S3_ENDPOINT", ""),
+		BackupS3Region:      getEnv("BACKUP_S3_REGION", ""),
+		BackupS3Bucket:      getEnv("BACKUP_S3_BUCKET", ""),
+		BackupS3AccessKey:   getEnv("BACKUP_S3_ACCESS_KEY", ""),
+		BackupS3SecretKey:   getEnv("BACKUP_S3_SECRET_KEY", ""),
+		BackupS3UseSSL:      getEnv("BACKUP_S3_USE_SSL", "true") == "true",
+		BackupIntervalHours: backupIntervalHours,
 	}
 }
 
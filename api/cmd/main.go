@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -16,9 +19,11 @@ import (
 	psdisk "github.com/shirou/gopsutil/v4/disk"
 
 	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
 	"apollo-sfs.com/api/routes"
 	"apollo-sfs.com/api/routes/admin"
 	"apollo-sfs.com/api/routes/auth"
+	"apollo-sfs.com/api/routes/dav"
 	"apollo-sfs.com/api/routes/middleware"
 	"apollo-sfs.com/api/routes/payments"
 	"apollo-sfs.com/api/routes/services"
@@ -98,6 +103,13 @@ func main() {
 	}
 	log.Printf("minio: registry initialised")
 
+	allocator, err := services.NewDriveAllocator(queries, registry, cfg.AllocationPolicy)
+	if err != nil {
+		log.Fatalf("drive allocator: %v", err)
+	}
+	authSvc.SelectDrive = allocator.SelectDrive
+	log.Printf("drive allocator: %s policy", allocator.Policy())
+
 	emailSvc, err := services.NewEmailService(queries, services.EmailConfig{
 		SMTPAddr:     cfg.PostfixInternalHost,
 		MailFrom:     cfg.MailFrom,
@@ -118,7 +130,13 @@ func main() {
 
 	metadataSvc := services.NewMetadataService()
 
-	fileSvc := services.NewFileService(queries, registry, encSvc, emailSvc, transcodeSvc, metadataSvc, services.FileServiceConfig{
+	thumbnailSvc := services.NewThumbnailService()
+	log.Printf("thumbnails: enabled for %s", strings.Join(thumbnailSvc.Sources(), ", "))
+
+	textSvc := services.NewTextExtractService()
+	log.Printf("content search: indexing %s", strings.Join(textSvc.Sources(), ", "))
+
+	fileSvc := services.NewFileService(queries, registry, encSvc, emailSvc, transcodeSvc, metadataSvc, thumbnailSvc, textSvc, services.FileServiceConfig{
 		QuotaWarnPct: cfg.QuotaWarningThresholdPct,
 	})
 	folderSvc := services.NewFolderService(queries)
@@ -221,9 +239,25 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 
 	h := routes.NewHandler(queries, fileSvc, folderSvc, inviteSvc, favSvc, authSvc, uploadStore, emailSvc, presignSvc, cfg.TurnstileSecretKey)
 	routes.SetAPIKeyService(h, apiKeySvc)
+	routes.SetArchiveService(h, services.NewArchiveService(queries, fileSvc))
+	routes.SetImportService(h, services.NewImportService(queries, fileSvc, folderSvc))
+	routes.SetBulkService(h, services.NewBulkService(queries, fileSvc, folderSvc))
+	routes.SetFolderCopyService(h, services.NewFolderCopyService(queries, fileSvc, folderSvc))
+	changeSvc := services.NewChangeService(queries)
+	go changeSvc.Start(context.Background())
+	routes.SetChangeService(h, changeSvc)
+	eventSvc := services.NewEventService(cfg.DatabaseDSN)
+	webhookSvc := services.NewWebhookService(queries, registry.KEK(), cfg.WebhookAllowPrivate)
+	eventSvc.AddSink(webhookSvc.Wake)
+	go eventSvc.Start(context.Background())
+	go webhookSvc.Start(context.Background())
+	routes.SetEventService(h, eventSvc, cfg.AppBaseURL)
+	routes.SetWebhookService(h, webhookSvc)
 	authHandler := auth.NewHandler(authSvc)
 	adminHandler := admin.NewHandler(queries, inviteSvc, metricsSvc, authSvc, fileSvc, registry, geoReader, cfg.BackendTestURL, cfg.AppDir, cfg.FrontendTestURL, cfg.FrontendE2EURL, shutdownCh)
+	admin.SetEventPublisher(adminHandler, queries)
 	sfsHandler := sfs.NewHandler(queries, fileSvc, presignSvc, apiKeySvc)
+	davHandler := dav.NewHandler(queries, fileSvc, folderSvc, uploadStore, apiKeySvc, "/api/v1/dav", authSvc.GetUserKcID)
 
 	paypalClient := services.NewPayPalClient(services.PayPalConfig{
 		Environment:  cfg.PayPalEnvironment,
@@ -243,6 +277,60 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 	alarmSvc, apiCounter := services.NewAlarmService(queries, emailSvc, adminHandler)
 	go alarmSvc.Start(context.Background())
 
+	registry.SetAlarmService(alarmSvc)
+	go registry.Start(context.Background())
+
+	scrubSvc := services.NewScrubService(queries, fileSvc, alarmSvc, authSvc.GetUserKcID)
+	// Cancelled by the kill switch so a running pass stops reading blobs
+	// while connections drain.
+	scrubCtx, scrubCancel := context.WithCancel(context.Background())
+	go func() {
+		<-shutdownCh
+		scrubCancel()
+	}()
+	go scrubSvc.Start(scrubCtx)
+	admin.SetIntegrityScrubber(adminHandler, scrubSvc)
+	admin.SetStorageReconciler(adminHandler, services.NewReconcileService(queries, registry, authSvc.GetUserKcID))
+
+	jobSvc := services.NewJobService(queries, cfg.JobWorkers, authSvc.GetUserKcID)
+	fileSvc.RegisterJobs(jobSvc)
+	go jobSvc.Start(context.Background())
+	admin.SetJobQueue(adminHandler, jobSvc)
+
+	migrationSvc := services.NewUserMigrationService(queries, fileSvc, registry, authSvc.GetUserKcID)
+	go migrationSvc.Start(context.Background())
+	admin.SetUserMigrator(adminHandler, migrationSvc)
+
+	drainSvc := services.NewDrainService(queries, migrationSvc, authSvc.SelectDrive)
+	go drainSvc.Start(context.Background())
+	admin.SetDriveDrainer(adminHandler, drainSvc)
+
+	replicationSvc := services.NewReplicationService(queries, fileSvc, registry, services.ReplicationConfig{
+		DefaultFactor: cfg.ReplicationFactor,
+		PremiumFactor: cfg.ReplicationFactorPremium,
+	}, authSvc.GetUserKcID)
+	go replicationSvc.Start(context.Background())
+	admin.SetReplicationManager(adminHandler, replicationSvc)
+
+	if cfg.BackupTarget != "" {
+		target, err := services.OpenBackupTarget(services.BackupTargetConfig{
+			Kind:        cfg.BackupTarget,
+			Path:        cfg.BackupPath,
+			S3Endpoint:  cfg.BackupS3Endpoint,
+			S3Region:    cfg.BackupS3Region,
+			S3Bucket:    cfg.BackupS3Bucket,
+			S3AccessKey: cfg.BackupS3AccessKey,
+			S3SecretKey: cfg.BackupS3SecretKey,
+			S3UseSSL:    cfg.BackupS3UseSSL,
+		})
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		backupSvc := services.NewBackupService(queries, registry, target, registry.KEK(), time.Duration(cfg.BackupIntervalHours)*time.Hour)
+		go backupSvc.Start(context.Background())
+		admin.SetBackupManager(adminHandler, backupSvc)
+	}
+
 	v1 := r.Group("/api/v1")
 
 	// ── Unauthenticated ──────────────────────────────────────────────────────
@@ -262,6 +350,8 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 	v1.POST("/files/upload/p", h.UploadFilePresigned)
 	v1.POST("/files/upload/:upload_id/chunk/p", h.UploadChunkPresigned)
 	v1.POST("/files/upload/:upload_id/complete/p", h.CompleteUploadPresigned)
+	v1.GET("/files/:file_id/hls/:rendition/:name", h.GetHLSAsset)
+	v1.GET("/archives/:archive_id/download/p", h.DownloadArchivePresigned)
 
 	// ── SFS S3-like API (API-key auth, premium only) ─────────────────────────
 	// Authenticated via Authorization: Bearer <sfs_..._...> (NOT cookie).
@@ -278,6 +368,17 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 		sfsGroup.POST("/buckets/:bucket_id/move", sfsHandler.Move)
 	}
 
+	// ── WebDAV (API key as the Basic auth password, premium only) ────────────
+	// Mountable from Finder, Windows Explorer, davfs2 and rclone. Uses the
+	// API rate limit rather than the auth one: file managers issue a burst
+	// of PROPFINDs on every folder they open.
+	davGroup := v1.Group("/dav")
+	davGroup.Use(mw.APIRateLimit(), apiKeyMW.RequireBasicAPIKey("Apollo SFS"), apiKeyMW.RequirePremiumAPI())
+	for _, method := range dav.Methods {
+		davGroup.Handle(method, "", davHandler.Serve)
+		davGroup.Handle(method, "/*path", davHandler.Serve)
+	}
+
 	// ── Auth — rate-limited, no JWT required ─────────────────────────────────
 	// Logout is the exception: it requires a valid session to invalidate.
 	authGroup := v1.Group("/auth")
@@ -304,6 +405,8 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 		protected.POST("/me/password", h.ChangePassword)
 		protected.GET("/me/preferences", h.GetPreferences)
 		protected.PUT("/me/preferences", h.UpdatePreferences)
+		protected.GET("/me/media/duplicates", h.GetMediaDuplicates)
+		protected.POST("/me/media/duplicates/resolve", h.ResolveMediaDuplicates)
 
 		// Files — single upload (small files ≤ 5 MB)
 		protected.POST("/files/upload", h.UploadFile)
@@ -315,16 +418,24 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 		protected.POST("/files/upload/:upload_id/complete", h.CompleteUpload)
 		// Presigned chunked upload — issues a session token for token-authenticated chunk uploads
 		protected.POST("/files/upload/presign/init", h.PresignChunkedUpload)
+		// Archive import — extracts a zip or tar(.gz) into a folder tree in the background
+		protected.POST("/files/import-archive", h.ImportArchive)
+		protected.GET("/files/import-archive/:import_id", h.GetArchiveImport)
 		protected.GET("/files/:file_id", h.GetFile)
 		protected.GET("/files/:file_id/download", h.DownloadFile)
 		protected.GET("/files/:file_id/preview", h.PreviewFile)
 		protected.GET("/files/:file_id/stream", h.StreamFile)
+		protected.GET("/files/:file_id/thumbnail", h.GetThumbnail)
+		// HLS master playlist; its playlist and segment URLs are presigned
+		protected.GET("/files/:file_id/hls/master.m3u8", h.GetHLSMaster)
 		// Presign — issue time-limited download/preview URLs for a file
 		protected.POST("/files/:file_id/presign", h.PresignFile)
 		protected.PATCH("/files/:file_id", h.UpdateFile)
 		protected.PATCH("/files/:file_id/move", h.MoveFile)
 		protected.PATCH("/files/:file_id/hide", h.HideFile)
 		protected.PATCH("/files/:file_id/unhide", h.UnhideFile)
+		protected.POST("/files/:file_id/strip-location", h.StripFileLocation)
+		protected.PUT("/files/:file_id/tags", h.SetFileTags)
 		protected.DELETE("/files/:file_id", h.DeleteFile)
 
 		// Search
@@ -342,11 +453,38 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 		protected.GET("/folders/:folder_id", h.GetFolder)
 		protected.GET("/folders/:folder_id/ancestors", h.GetFolderAncestors)
 		protected.GET("/folders/:folder_id/media", h.GetMediaFolder)
+		protected.GET("/folders/:folder_id/media/timeline", h.GetMediaTimeline)
+		protected.GET("/folders/:folder_id/media/geo", h.GetMediaGeo)
 		protected.POST("/folders", h.CreateFolder)
 		protected.PATCH("/folders/:folder_id", h.UpdateFolder)
 		protected.PATCH("/folders/:folder_id/move", h.MoveFolder)
 		protected.DELETE("/folders/:folder_id", h.DeleteFolder)
 
+		// Recursive folder copy — the tree is cloned at once, file contents in the background
+		protected.POST("/folders/:folder_id/copy", h.CopyFolder)
+		protected.GET("/folders/copies/:copy_id", h.GetFolderCopy)
+
+		// Change feed for delta sync clients
+		protected.GET("/changes", h.ListChanges)
+
+		// Live file, upload, variant and quota events over WebSocket
+		protected.GET("/events", h.StreamEvents)
+
+		// Outbound webhooks — signed POSTs of the same events, with retries and a delivery log
+		protected.POST("/webhooks", h.CreateWebhook)
+		protected.GET("/webhooks", h.ListWebhooks)
+		protected.GET("/webhooks/:webhook_id", h.GetWebhook)
+		protected.PATCH("/webhooks/:webhook_id", h.UpdateWebhook)
+		protected.DELETE("/webhooks/:webhook_id", h.DeleteWebhook)
+		protected.GET("/webhooks/:webhook_id/deliveries", h.ListWebhookDeliveries)
+		protected.POST("/webhooks/:webhook_id/test", h.TestWebhook)
+
+		// Bulk move/delete/hide/favorite over many files and folders in one request
+		protected.POST("/bulk", h.Bulk)
+
+		// Zip archives of files and folders; the download itself is presigned
+		protected.POST("/archives", h.CreateArchive)
+
 		// API key management for the SFS S3-like API. Premium users only;
 		// non-premium callers receive 402 from the handler.
 		protected.GET("/me/api-keys", h.ListAPIKeys)
@@ -370,6 +508,9 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 			adminGroup.GET("/users/:user_id", adminHandler.GetUser)
 			adminGroup.PATCH("/users/:user_id/quota", adminHandler.UpdateUserQuota)
 			adminGroup.PATCH("/users/:user_id/username", adminHandler.UpdateUsername)
+			adminGroup.GET("/users/:user_id/migrate", adminHandler.GetUserMigration)
+			adminGroup.POST("/users/:user_id/migrate", adminHandler.MigrateUser)
+			adminGroup.PUT("/users/:user_id/replication", adminHandler.SetUserReplication)
 			adminGroup.GET("/users/:user_id/folders", h.AdminListUserFolders)
 			adminGroup.GET("/users/:user_id/folders/:folder_id", h.AdminGetUserFolder)
 			adminGroup.GET("/users/:user_id/favorites", h.AdminGetUserFavorites)
@@ -392,6 +533,9 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 			adminGroup.PATCH("/system/servers/:server_id", adminHandler.UpdateServer)
 			adminGroup.POST("/system/servers/:server_id/drives", adminHandler.AddDrive)
 			adminGroup.PATCH("/system/servers/:server_id/drives/:drive_id", adminHandler.UpdateDrive)
+			adminGroup.GET("/system/servers/:server_id/drives/:drive_id/drain", adminHandler.GetDriveDrain)
+			adminGroup.POST("/system/servers/:server_id/drives/:drive_id/drain", adminHandler.DrainDrive)
+			adminGroup.POST("/system/servers/:server_id/drives/:drive_id/replaced", adminHandler.MarkDriveReplaced)
 
 			adminGroup.GET("/banned-ips", adminHandler.ListBannedIPs)
 			adminGroup.POST("/banned-ips/:id/unban", adminHandler.UnbanIP)
@@ -417,6 +561,25 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 
 			adminGroup.GET("/system/alarm/settings", adminHandler.GetAlarmSettings)
 			adminGroup.POST("/system/alarm/subscribe", adminHandler.ToggleAlarmSubscription)
+
+			adminGroup.GET("/system/integrity", adminHandler.GetIntegrityReport)
+			adminGroup.GET("/system/integrity/results", adminHandler.ListIntegrityResults)
+			adminGroup.POST("/system/integrity/scrub", adminHandler.TriggerIntegrityScrub)
+
+			adminGroup.GET("/system/reconcile", adminHandler.GetReconcileStatus)
+			adminGroup.POST("/system/reconcile", adminHandler.TriggerReconcile)
+
+			adminGroup.GET("/system/replication", adminHandler.GetReplicationStatus)
+			adminGroup.POST("/system/replication/repair", adminHandler.TriggerReplicationRepair)
+
+			adminGroup.GET("/system/backups", adminHandler.ListBackups)
+			adminGroup.POST("/system/backups", adminHandler.TriggerBackup)
+			adminGroup.POST("/system/backups/:backup_id/verify", adminHandler.VerifyBackup)
+
+			adminGroup.GET("/system/jobs", adminHandler.ListJobs)
+			adminGroup.POST("/system/jobs/:job_id/retry", adminHandler.RetryJob)
+			adminGroup.POST("/system/jobs/:job_id/cancel", adminHandler.CancelJob)
+			adminGroup.POST("/system/jobs/backfill", adminHandler.BackfillJobs)
 		}
 	}
 
@@ -424,9 +587,10 @@ func setupRouter(cfg Config, queries *db.Queries, oidcVerifier *oidc.IDTokenVeri
 }
 
 // seedDefaultServer runs once on first boot (when the servers table is empty).
-// It creates a server + drive record from the existing env-var MinIO credentials,
-// auto-detects drive capacity from the disk stats path, backfills files.drive_id,
-// and allocates all existing users to the new drive.
+// It creates a server + drive record from the existing env-var MinIO credentials
+// (or, with STORAGE_BACKEND=fs, a local directory), auto-detects drive capacity
+// from the disk stats path, backfills files.drive_id, and allocates all
+// existing users to the new drive.
 func seedDefaultServer(ctx context.Context, queries *db.Queries, cfg Config, kek []byte) error {
 	servers, err := queries.ListServers(ctx)
 	if err != nil {
@@ -436,9 +600,20 @@ func seedDefaultServer(ctx context.Context, queries *db.Queries, cfg Config, kek
 		return nil // already seeded
 	}
 
+	backend, endpoint, bucket, statsPath := models.ServerBackendMinIO, cfg.MinIOEndpoint, cfg.MinIOBucketName, cfg.DiskStatsPath
+	if cfg.StorageBackend == models.ServerBackendFS {
+		backend, endpoint, statsPath = models.ServerBackendFS, cfg.StorageFSRoot, cfg.StorageFSRoot
+		if bucket == "" {
+			bucket = "default"
+		}
+		if err := os.MkdirAll(filepath.Join(endpoint, bucket), 0o750); err != nil {
+			return fmt.Errorf("create storage directory: %w", err)
+		}
+	}
+
 	// Detect physical capacity from the data mount.
 	var capacityBytes int64
-	if usage, err := psdisk.Usage(cfg.DiskStatsPath); err == nil {
+	if usage, err := psdisk.Usage(statsPath); err == nil {
 		capacityBytes = int64(usage.Total)
 	} else {
 		log.Printf("seed: could not detect disk capacity (%v); defaulting to 1 TiB", err)
@@ -458,7 +633,8 @@ func seedDefaultServer(ctx context.Context, queries *db.Queries, cfg Config, kek
 	server, err := queries.CreateServer(ctx, db.CreateServerParams{
 		Name:                "LOCAL-0001",
 		State:               "LOCAL",
-		MinioEndpoint:       cfg.MinIOEndpoint,
+		Backend:             backend,
+		MinioEndpoint:       endpoint,
 		MinioUseSSL:         false,
 		MinioAccessKeyEnc:   accessEnc,
 		MinioAccessKeyNonce: accessNonce,
@@ -473,7 +649,7 @@ func seedDefaultServer(ctx context.Context, queries *db.Queries, cfg Config, kek
 		ServerID:      server.ID,
 		Label:         "nvme-01",
 		CapacityBytes: capacityBytes,
-		MinioBucket:   cfg.MinIOBucketName,
+		MinioBucket:   bucket,
 	})
 	if err != nil {
 		return fmt.Errorf("create drive: %w", err)
@@ -0,0 +1,201 @@
+// restore rebuilds an instance from an off-site backup written by the API's
+// BackupService.
+//
+// It reads the same environment as the API (POSTGRES_APP_*, KEY_ENCRYPTION_KEY
+// and the BACKUP_* target variables), so inside the Docker stack it runs as
+//
+//	docker compose run --rm --entrypoint /app/restore api [flags]
+//
+// with the api service otherwise stopped. Steps:
+//
+//  1. fetch the backup's manifest and catalogue, check the checksum and
+//     decrypt it (which fails unless KEY_ENCRYPTION_KEY matches the instance
+//     that took the backup);
+//  2. replace every catalogue table, master_keys included, in one transaction;
+//  3. copy every blob back onto the drive it was backed up from, using the
+//     servers and drives rows just restored.
+//
+// Flags:
+//
+//	-list         list the backups on the target and exit
+//	-backup <id>  backup to restore (default: the newest)
+//	-skip-blobs   restore the catalogue only
+//	-blobs-only   copy blobs only, e.g. after fixing a server endpoint
+//	-force        overwrite an instance that already has users
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func main() {
+	list := flag.Bool("list", false, "list the backups on the target and exit")
+	backupID := flag.String("backup", "", "backup ID to restore (default: the newest)")
+	skipBlobs := flag.Bool("skip-blobs", false, "restore the catalogue only")
+	blobsOnly := flag.Bool("blobs-only", false, "copy blobs only; the catalogue must already be restored")
+	force := flag.Bool("force", false, "overwrite an instance that already has users")
+	flag.Parse()
+	if *skipBlobs && *blobsOnly {
+		log.Fatal("-skip-blobs and -blobs-only are mutually exclusive")
+	}
+
+	ctx := context.Background()
+	target, err := services.OpenBackupTarget(services.BackupTargetConfig{
+		Kind:        requireEnv("BACKUP_TARGET"),
+		Path:        os.Getenv("BACKUP_PATH"),
+		S3Endpoint:  os.Getenv("BACKUP_S3_ENDPOINT"),
+		S3Region:    os.Getenv("BACKUP_S3_REGION"),
+		S3Bucket:    os.Getenv("BACKUP_S3_BUCKET"),
+		S3AccessKey: os.Getenv("BACKUP_S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("BACKUP_S3_SECRET_KEY"),
+		S3UseSSL:    os.Getenv("BACKUP_S3_USE_SSL") != "false",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifests, err := services.ListBackupManifests(ctx, target.Store)
+	if err != nil {
+		log.Fatalf("%s: %v", target.Name, err)
+	}
+	if *list {
+		for _, m := range manifests {
+			fmt.Printf("%s  %s  %d rows  %d blobs (%d bytes)\n",
+				m.ID, m.StartedAt.Format("2006-01-02 15:04:05Z07:00"), sumRows(m.Tables), m.BlobCount, m.BlobBytes)
+		}
+		return
+	}
+	if len(manifests) == 0 {
+		log.Fatalf("%s: no complete backups found", target.Name)
+	}
+	id := manifests[0].ID
+	if *backupID != "" {
+		if id, err = uuid.Parse(*backupID); err != nil {
+			log.Fatalf("invalid -backup: %v", err)
+		}
+	}
+
+	pool, err := db.Connect(fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		requireEnv("POSTGRES_APP_HOST"),
+		getEnv("POSTGRES_APP_PORT", "5432"),
+		requireEnv("POSTGRES_APP_USER"),
+		requireEnv("POSTGRES_APP_PASSWORD"),
+		requireEnv("POSTGRES_APP_DB"),
+	))
+	if err != nil {
+		log.Fatalf("database: %v", err)
+	}
+	defer pool.Close()
+	queries := db.New(pool)
+
+	encSvc, err := services.NewEncryptionService(queries, requireEnv("KEY_ENCRYPTION_KEY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	archive, err := services.ReadBackup(ctx, target.Store, encSvc.KEK(), id)
+	if err != nil {
+		log.Fatalf("backup %s: %v", id, err)
+	}
+	log.Printf("backup %s from %s: %d rows, %d blobs", id,
+		archive.Manifest.StartedAt.Format("2006-01-02 15:04:05Z07:00"), len(archive.Rows), len(archive.Blobs))
+
+	if !*blobsOnly {
+		users, err := queries.CountUsers(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if users > 0 && !*force {
+			log.Fatalf("the database already has %d user(s); restore into a fresh instance or pass -force", users)
+		}
+		counts, err := queries.RestoreCatalogue(ctx, archive.Rows)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tables := make([]string, 0, len(counts))
+		for t := range counts {
+			tables = append(tables, t)
+		}
+		sort.Strings(tables)
+		for _, t := range tables {
+			log.Printf("  %-26s %d", t, counts[t])
+		}
+
+		// The master keys were just restored; make sure this KEK unwraps them
+		// before the API is started against them.
+		if err := encSvc.LoadMasterKeys(ctx); err != nil {
+			log.Fatalf("restored master keys do not load: %v", err)
+		}
+		log.Printf("catalogue restored (active master key: %s)", encSvc.ActiveMasterKeyVersion())
+	}
+
+	if *skipBlobs {
+		return
+	}
+	registry, err := services.NewMinIORegistry(ctx, queries, encSvc.KEK())
+	if err != nil {
+		log.Fatalf("minio registry: %v", err)
+	}
+	stores := make(map[uuid.UUID]services.BlobStore)
+	storeFor := func(ctx context.Context, driveID uuid.UUID) (services.BlobStore, error) {
+		if s, ok := stores[driveID]; ok {
+			return s, nil
+		}
+		d, err := queries.GetDrive(ctx, driveID)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			return nil, services.ErrDriveNotFound
+		}
+		if err := registry.EnsureBucket(ctx, d.ServerID, d.MinioBucket); err != nil {
+			return nil, err
+		}
+		s, ok := registry.Store(d.ServerID, d.MinioBucket)
+		if !ok {
+			return nil, services.ErrStorageUnavailable
+		}
+		stores[driveID] = s
+		return s, nil
+	}
+	copied, err := services.RestoreBlobs(ctx, target.Store, archive.Blobs, storeFor)
+	if err != nil {
+		log.Fatalf("blobs: %v (copied %d so far; re-run with -blobs-only to resume)", err, copied)
+	}
+	log.Printf("blobs restored: %d copied, %d already present", copied, int64(len(archive.Blobs))-copied)
+}
+
+func sumRows(tables map[string]int64) int64 {
+	var n int64
+	for _, c := range tables {
+		n += c
+	}
+	return n
+}
+
+func requireEnv(key string) string {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		log.Fatalf("required environment variable %q is not set", key)
+	}
+	return v
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
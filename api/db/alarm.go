@@ -17,6 +17,8 @@ const alarmSelectCols = `
 	drive_load_emails, drive_load_last_fired_at,
 	network_traffic_emails, network_traffic_last_fired_at,
 	api_error_rate_emails, api_error_rate_last_fired_at,
+	integrity_emails, integrity_last_fired_at,
+	server_down_emails, server_down_last_fired_at,
 	updated_at`
 
 // scanAlarmSettings scans a single alarm_settings row (must match alarmSelectCols order).
@@ -25,7 +27,7 @@ func scanAlarmSettings(row interface {
 }) (*models.AlarmSettings, error) {
 	var s models.AlarmSettings
 	var (
-		cpuUsage, cpuTemp, driveTemp, driveLoad, network, apiErr pq.StringArray
+		cpuUsage, cpuTemp, driveTemp, driveLoad, network, apiErr, integrity, serverDown pq.StringArray
 	)
 	if err := row.Scan(
 		&cpuUsage, &s.CPUUsageLastFiredAt,
@@ -34,6 +36,8 @@ func scanAlarmSettings(row interface {
 		&driveLoad, &s.DriveLoadLastFiredAt,
 		&network, &s.NetworkTrafficLastFiredAt,
 		&apiErr, &s.APIErrorRateLastFiredAt,
+		&integrity, &s.IntegrityLastFiredAt,
+		&serverDown, &s.ServerDownLastFiredAt,
 		&s.UpdatedAt,
 	); err != nil {
 		return nil, err
@@ -44,6 +48,8 @@ func scanAlarmSettings(row interface {
 	s.DriveLoadEmails = []string(driveLoad)
 	s.NetworkTrafficEmails = []string(network)
 	s.APIErrorRateEmails = []string(apiErr)
+	s.IntegrityEmails = []string(integrity)
+	s.ServerDownEmails = []string(serverDown)
 	return &s, nil
 }
 
@@ -125,6 +131,10 @@ func alarmTypeColumn(alarmType string) (string, error) {
 		return "network_traffic_emails", nil
 	case "api_error_rate":
 		return "api_error_rate_emails", nil
+	case "integrity":
+		return "integrity_emails", nil
+	case "server_down":
+		return "server_down_emails", nil
 	default:
 		return "", fmt.Errorf("unknown alarm type: %q", alarmType)
 	}
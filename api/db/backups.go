@@ -0,0 +1,434 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"apollo-sfs.com/api/models"
+)
+
+// ── Catalogue export / restore ────────────────────────────────────────────────
+
+// CatalogueTables lists the tables captured by a backup, in an order that
+// satisfies their foreign keys. Volatile tables (email_queue, jobs,
+// server_metrics_snapshots, scrub_results) and the backup bookkeeping itself
+// are left out. New tables holding durable state must be added here.
+var CatalogueTables = []string{
+	"master_keys",
+	"key_rotation_log",
+	"users",
+	"servers",
+	"drives",
+	"user_drive_allocations",
+	"user_replica_allocations",
+	"folders",
+	"files",
+	"video_variants",
+	"media_metadata",
+	"search_documents",
+	"search_terms",
+	// change_seqs before changes, so restored journals keep counting from
+	// where they were and sync cursors stay valid.
+	"change_seqs",
+	"changes",
+	"file_replicas",
+	"favorites",
+	"collection_items",
+	"user_preferences",
+	"invitations",
+	"interest_form_settings",
+	"interest_submissions",
+	"api_keys",
+	"api_key_scopes",
+	"webhooks",
+	"payments",
+	"user_bans",
+	"user_migrations",
+	"banned_ips",
+	"alarm_settings",
+	"audit_logs",
+}
+
+// catalogueRLSTables are read once per user with app.current_user_id set,
+// because their row-level security policies hide every row otherwise.
+var catalogueRLSTables = map[string]bool{
+	"folders":        true,
+	"files":          true,
+	"api_keys":       true,
+	"api_key_scopes": true,
+}
+
+// catalogueSerialTables have a BIGSERIAL id whose sequence must be moved past
+// the restored rows.
+var catalogueSerialTables = []string{"banned_ips", "user_bans"}
+
+// CatalogueRow is one exported table row as produced by row_to_json. User is
+// set for RLS-protected tables and names the user whose policy admits the row.
+type CatalogueRow struct {
+	Table string          `json:"t"`
+	User  string          `json:"u,omitempty"`
+	Row   json.RawMessage `json:"r"`
+}
+
+// ExportCatalogue calls fn for every row of CatalogueTables, all read from a
+// single REPEATABLE READ snapshot so the export is consistent even while
+// users keep uploading. Returns the number of rows exported.
+func (q *Queries) ExportCatalogue(ctx context.Context, fn func(CatalogueRow) error) (int64, error) {
+	tx, err := q.pool.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("ExportCatalogue: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var users []string
+	rows, err := tx.QueryContext(ctx, `SELECT username FROM users ORDER BY username`)
+	if err != nil {
+		return 0, fmt.Errorf("ExportCatalogue: list users: %w", err)
+	}
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ExportCatalogue: list users: %w", err)
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ExportCatalogue: list users: %w", err)
+	}
+
+	var n int64
+	for _, table := range CatalogueTables {
+		owners := []string{""}
+		if catalogueRLSTables[table] {
+			owners = users
+		}
+		for _, owner := range owners {
+			if owner != "" {
+				if _, err := tx.ExecContext(ctx, `SELECT set_config('app.current_user_id', $1, true)`, owner); err != nil {
+					return n, fmt.Errorf("ExportCatalogue: set user: %w", err)
+				}
+			}
+			count, err := exportTable(ctx, tx, table, owner, fn)
+			n += count
+			if err != nil {
+				return n, fmt.Errorf("ExportCatalogue: %s: %w", table, err)
+			}
+		}
+	}
+	return n, nil
+}
+
+func exportTable(ctx context.Context, tx *sql.Tx, table, owner string, fn func(CatalogueRow) error) (int64, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT row_to_json(t) FROM `+pq.QuoteIdentifier(table)+` t`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var n int64
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return n, err
+		}
+		if err := fn(CatalogueRow{Table: table, User: owner, Row: raw}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// RestoreCatalogue replaces the contents of every CatalogueTables table with
+// rows inside one transaction and returns the number of rows loaded per
+// table. It is meant for a freshly initialised instance: foreign key triggers
+// are suspended (session_replication_role = replica, which needs a superuser)
+// so self-referencing folders load in any order. Columns missing from a row
+// (a backup taken before a column was added) get their default.
+func (q *Queries) RestoreCatalogue(ctx context.Context, rows []CatalogueRow) (map[string]int64, error) {
+	known := make(map[string]bool, len(CatalogueTables))
+	for _, t := range CatalogueTables {
+		known[t] = true
+	}
+
+	tx, err := q.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("RestoreCatalogue: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SET LOCAL session_replication_role = replica`); err != nil {
+		return nil, fmt.Errorf("RestoreCatalogue: suspend foreign keys: %w", err)
+	}
+	// CASCADE also empties derived tables that point at restored ones
+	// (scrub_results → files).
+	if _, err := tx.ExecContext(ctx, `TRUNCATE `+strings.Join(CatalogueTables, ", ")+` CASCADE`); err != nil {
+		return nil, fmt.Errorf("RestoreCatalogue: truncate: %w", err)
+	}
+
+	counts := make(map[string]int64)
+	user := ""
+	for i, r := range rows {
+		if !known[r.Table] {
+			return nil, fmt.Errorf("RestoreCatalogue: row %d: unknown table %q", i, r.Table)
+		}
+		if r.User != "" && r.User != user {
+			if _, err := tx.ExecContext(ctx, `SELECT set_config('app.current_user_id', $1, true)`, r.User); err != nil {
+				return nil, fmt.Errorf("RestoreCatalogue: set user: %w", err)
+			}
+			user = r.User
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(r.Row, &fields); err != nil {
+			return nil, fmt.Errorf("RestoreCatalogue: row %d (%s): %w", i, r.Table, err)
+		}
+		cols := make([]string, 0, len(fields))
+		for c := range fields {
+			cols = append(cols, pq.QuoteIdentifier(c))
+		}
+		sort.Strings(cols)
+		list := strings.Join(cols, ", ")
+		table := pq.QuoteIdentifier(r.Table)
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO `+table+` (`+list+`) SELECT `+list+` FROM json_populate_record(NULL::`+table+`, $1::json)`,
+			string(r.Row),
+		); err != nil {
+			return nil, fmt.Errorf("RestoreCatalogue: row %d (%s): %w", i, r.Table, err)
+		}
+		counts[r.Table]++
+	}
+
+	for _, t := range catalogueSerialTables {
+		if _, err := tx.ExecContext(ctx,
+			`SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE((SELECT MAX(id) FROM `+pq.QuoteIdentifier(t)+`), 0) + 1, false)`, t,
+		); err != nil {
+			return nil, fmt.Errorf("RestoreCatalogue: reset %s sequence: %w", t, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("RestoreCatalogue: commit: %w", err)
+	}
+	return counts, nil
+}
+
+// CountUsers returns the number of rows in users. The restore command refuses
+// to overwrite an instance that already has users.
+func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
+	var n int64
+	if err := q.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("CountUsers: %w", err)
+	}
+	return n, nil
+}
+
+// ── Backup runs ───────────────────────────────────────────────────────────────
+
+const backupRunColumns = `
+	id, target, status, catalogue_rows, catalogue_bytes, catalogue_sha256,
+	blob_count, blob_bytes, new_blob_count, new_blob_bytes, error,
+	started_at, finished_at, verify_status, verify_error, verified_at`
+
+func scanBackupRun(row interface {
+	Scan(...any) error
+}) (*models.BackupRun, error) {
+	var b models.BackupRun
+	err := row.Scan(&b.ID, &b.Target, &b.Status, &b.CatalogueRows, &b.CatalogueBytes, &b.CatalogueSHA256,
+		&b.BlobCount, &b.BlobBytes, &b.NewBlobCount, &b.NewBlobBytes, &b.Error,
+		&b.StartedAt, &b.FinishedAt, &b.VerifyStatus, &b.VerifyError, &b.VerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// CreateBackupRun inserts a running backup_runs row.
+func (q *Queries) CreateBackupRun(ctx context.Context, id uuid.UUID, target string) (*models.BackupRun, error) {
+	row := q.db.QueryRowContext(ctx, `
+		INSERT INTO backup_runs (id, target)
+		VALUES ($1, $2)
+		RETURNING`+backupRunColumns,
+		id, target,
+	)
+	b, err := scanBackupRun(row)
+	if err != nil {
+		return nil, fmt.Errorf("CreateBackupRun: %w", err)
+	}
+	return b, nil
+}
+
+// FinishBackupRunParams holds the totals recorded when a backup completes.
+type FinishBackupRunParams struct {
+	CatalogueRows   int64
+	CatalogueBytes  int64
+	CatalogueSHA256 string
+	BlobCount       int64
+	BlobBytes       int64
+	NewBlobCount    int64
+	NewBlobBytes    int64
+}
+
+// FinishBackupRun marks a backup done and records its totals.
+func (q *Queries) FinishBackupRun(ctx context.Context, id uuid.UUID, p FinishBackupRunParams) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE backup_runs
+		SET status           = 'done',
+		    catalogue_rows   = $2,
+		    catalogue_bytes  = $3,
+		    catalogue_sha256 = $4,
+		    blob_count       = $5,
+		    blob_bytes       = $6,
+		    new_blob_count   = $7,
+		    new_blob_bytes   = $8,
+		    finished_at      = NOW()
+		WHERE id = $1
+	`, id, p.CatalogueRows, p.CatalogueBytes, p.CatalogueSHA256,
+		p.BlobCount, p.BlobBytes, p.NewBlobCount, p.NewBlobBytes)
+	if err != nil {
+		return fmt.Errorf("FinishBackupRun: %w", err)
+	}
+	return nil
+}
+
+// FailBackupRun marks a backup failed with errMsg.
+func (q *Queries) FailBackupRun(ctx context.Context, id uuid.UUID, errMsg string) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE backup_runs
+		SET status = 'failed', error = $2, finished_at = NOW()
+		WHERE id = $1
+	`, id, errMsg)
+	if err != nil {
+		return fmt.Errorf("FailBackupRun: %w", err)
+	}
+	return nil
+}
+
+// FailInterruptedBackupRuns marks backups and verifications left running by a
+// restart as failed. Returns the number of rows touched.
+func (q *Queries) FailInterruptedBackupRuns(ctx context.Context) (int64, error) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE backup_runs
+		SET status        = CASE WHEN status = 'running' THEN 'failed' ELSE status END,
+		    error         = CASE WHEN status = 'running' THEN 'interrupted by a restart' ELSE error END,
+		    finished_at   = CASE WHEN status = 'running' THEN NOW() ELSE finished_at END,
+		    verify_status = CASE WHEN verify_status = 'running' THEN 'failed' ELSE verify_status END,
+		    verify_error  = CASE WHEN verify_status = 'running' THEN 'interrupted by a restart' ELSE verify_error END
+		WHERE status = 'running' OR verify_status = 'running'
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("FailInterruptedBackupRuns: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// GetBackupRun returns a backup run by ID, or nil if it does not exist.
+func (q *Queries) GetBackupRun(ctx context.Context, id uuid.UUID) (*models.BackupRun, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT`+backupRunColumns+` FROM backup_runs WHERE id = $1`, id)
+	b, err := scanBackupRun(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetBackupRun: %w", err)
+	}
+	return b, nil
+}
+
+// ListBackupRuns returns backup runs newest first.
+func (q *Queries) ListBackupRuns(ctx context.Context, in PageInput) (*PageResult[models.BackupRun], error) {
+	limit := clampLimit(in.Limit)
+	offset, err := decodeOffsetCursor(in.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("ListBackupRuns: %w", err)
+	}
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+backupRunColumns+`
+		FROM backup_runs
+		ORDER BY started_at DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ListBackupRuns: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]models.BackupRun, 0)
+	for rows.Next() {
+		b, err := scanBackupRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListBackupRuns scan: %w", err)
+		}
+		runs = append(runs, *b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListBackupRuns: %w", err)
+	}
+	return &PageResult[models.BackupRun]{
+		Items:     runs,
+		NextToken: offsetNextToken(len(runs), limit, offset),
+	}, nil
+}
+
+// SetBackupVerifyStatus records the state of a verification. verified_at is
+// stamped once it finishes ('ok' or 'failed'); errMsg nil clears the error.
+func (q *Queries) SetBackupVerifyStatus(ctx context.Context, id uuid.UUID, status string, errMsg *string) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE backup_runs
+		SET verify_status = $2,
+		    verify_error  = $3,
+		    verified_at   = CASE WHEN $2 IN ('ok', 'failed') THEN NOW() ELSE verified_at END
+		WHERE id = $1
+	`, id, status, errMsg)
+	if err != nil {
+		return fmt.Errorf("SetBackupVerifyStatus: %w", err)
+	}
+	return nil
+}
+
+// ── Backed-up blobs ───────────────────────────────────────────────────────────
+
+// ListBackedUpBlobs returns the size of every blob already on the backup
+// target, keyed by object key.
+func (q *Queries) ListBackedUpBlobs(ctx context.Context) (map[string]int64, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT object_key, size_bytes FROM backup_blobs`)
+	if err != nil {
+		return nil, fmt.Errorf("ListBackedUpBlobs: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]int64)
+	for rows.Next() {
+		var key string
+		var size int64
+		if err := rows.Scan(&key, &size); err != nil {
+			return nil, fmt.Errorf("ListBackedUpBlobs scan: %w", err)
+		}
+		out[key] = size
+	}
+	return out, rows.Err()
+}
+
+// RecordBackedUpBlob upserts the blob at key as present on the target with
+// the given size, first written (or re-discovered) by backupID.
+func (q *Queries) RecordBackedUpBlob(ctx context.Context, key string, size int64, backupID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, `
+		INSERT INTO backup_blobs (object_key, size_bytes, backup_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (object_key) DO UPDATE
+		SET size_bytes = EXCLUDED.size_bytes, backup_id = EXCLUDED.backup_id, backed_up_at = NOW()
+	`, key, size, backupID)
+	if err != nil {
+		return fmt.Errorf("RecordBackedUpBlob: %w", err)
+	}
+	return nil
+}
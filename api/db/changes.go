@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+// The change journal is written by the file and folder query methods that
+// create, rename, move, hide, delete or replace the content of an item, in
+// the same transaction as the change. Every path that changes a user's tree
+// (the REST API, WebDAV, the SFS API, bulk operations, imports and copies)
+// goes through those methods, so none of them can forget to record it.
+
+// recordFileChange appends op on f to its owner's change journal.
+func (q *Queries) recordFileChange(ctx context.Context, f *models.File, op string) error {
+	return q.recordChange(ctx, f.UserID, models.ChangeItemFile, f.ID, op, f.Name, f.FolderID)
+}
+
+// recordFolderChange appends op on f to its owner's change journal.
+func (q *Queries) recordFolderChange(ctx context.Context, f *models.Folder, op string) error {
+	return q.recordChange(ctx, f.UserID, models.ChangeItemFolder, f.ID, op, f.Name, f.ParentID)
+}
+
+// recordChange takes the user's next seq, inserts the entry, publishes it
+// on EventChannel and queues the webhook deliveries it triggers, all in one
+// statement. The change_seqs row stays locked until the caller's transaction
+// commits, which is what keeps commits in seq order; the notification and
+// the deliveries go out with the commit.
+func (q *Queries) recordChange(ctx context.Context, userID uuid.UUID, itemType string, itemID uuid.UUID, op, name string, parentID *uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, `
+		WITH next AS (
+			INSERT INTO change_seqs (user_id, seq) VALUES ($1, 1)
+			ON CONFLICT (user_id) DO UPDATE SET seq = change_seqs.seq + 1
+			RETURNING seq
+		), entry AS (
+			INSERT INTO changes (user_id, seq, item_type, item_id, op, name, parent_id)
+			SELECT $1, seq, $2, $3, $4, $5, $6 FROM next
+			RETURNING seq, created_at
+		), ev AS (
+			SELECT gen_random_uuid() AS id, created_at, $1::uuid AS user_id,
+			       json_build_object('seq', seq, 'type', $2::text, 'id', $3::uuid, 'op', $4::text,
+			                         'name', $5::text, 'parent_id', $6::uuid, 'created_at', created_at) AS data,
+			       NULLIF($9::text, '') AS webhook_type, TRUE AS file_event, $6::uuid AS folder_id
+			FROM entry
+		), `+queueWebhookDeliveries+`
+		SELECT pg_notify($7, json_build_object(
+			'id', id, 'user_id', user_id, 'type', $8::text, 'data', data, 'created_at', created_at
+		)::text)
+		FROM ev
+	`, userID, itemType, itemID, op, name, parentID, EventChannel, models.EventChange, changeWebhookEvent(itemType, op))
+	if err != nil {
+		return fmt.Errorf("record %s %s change: %w", itemType, op, err)
+	}
+	return nil
+}
+
+// ListChanges returns up to limit journal entries of userID with seq
+// greater than after, oldest first.
+func (q *Queries) ListChanges(ctx context.Context, userID uuid.UUID, after int64, limit int) ([]models.Change, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT seq, user_id, item_type, item_id, op, name, parent_id, created_at
+		FROM changes
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3
+	`, userID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ListChanges: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.Change, 0)
+	for rows.Next() {
+		var c models.Change
+		var parentID uuid.NullUUID
+		if err := rows.Scan(&c.Seq, &c.UserID, &c.ItemType, &c.ItemID, &c.Op, &c.Name, &parentID, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ListChanges scan: %w", err)
+		}
+		if parentID.Valid {
+			c.ParentID = &parentID.UUID
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListChanges: %w", err)
+	}
+	return out, nil
+}
+
+// GetChangeBounds returns the oldest seq still in userID's journal and the
+// latest seq handed out. Both are 0 for a user with no changes; when every
+// entry has been pruned oldest is latest+1.
+func (q *Queries) GetChangeBounds(ctx context.Context, userID uuid.UUID) (oldest, latest int64, err error) {
+	err = q.db.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT MIN(seq) FROM changes WHERE user_id = $1),
+		                (SELECT seq FROM change_seqs WHERE user_id = $1) + 1, 0),
+		       COALESCE((SELECT seq FROM change_seqs WHERE user_id = $1), 0)
+	`, userID).Scan(&oldest, &latest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("GetChangeBounds: %w", err)
+	}
+	return oldest, latest, nil
+}
+
+// PruneChanges deletes journal entries recorded before cutoff and returns
+// how many were removed. change_seqs is kept, so seqs never restart.
+func (q *Queries) PruneChanges(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := q.db.ExecContext(ctx, `DELETE FROM changes WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("PruneChanges: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
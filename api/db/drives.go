@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -18,12 +19,13 @@ var ErrNoCapacity = errors.New("no drive has sufficient capacity for the request
 // ── Drives ────────────────────────────────────────────────────────────────────
 
 const driveColumns = `
-	id, server_id, label, capacity_bytes, minio_bucket, is_active, created_at`
+	id, server_id, label, capacity_bytes, minio_bucket, is_active,
+	tier, state, drain_started_at, retired_at, created_at`
 
 func scanDrive(row *sql.Row) (*models.Drive, error) {
 	var d models.Drive
 	err := row.Scan(&d.ID, &d.ServerID, &d.Label, &d.CapacityBytes,
-		&d.MinioBucket, &d.IsActive, &d.CreatedAt)
+		&d.MinioBucket, &d.IsActive, &d.Tier, &d.State, &d.DrainStartedAt, &d.RetiredAt, &d.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +35,7 @@ func scanDrive(row *sql.Row) (*models.Drive, error) {
 func scanDriveRow(rows *sql.Rows) (*models.Drive, error) {
 	var d models.Drive
 	err := rows.Scan(&d.ID, &d.ServerID, &d.Label, &d.CapacityBytes,
-		&d.MinioBucket, &d.IsActive, &d.CreatedAt)
+		&d.MinioBucket, &d.IsActive, &d.Tier, &d.State, &d.DrainStartedAt, &d.RetiredAt, &d.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -83,15 +85,20 @@ type CreateDriveParams struct {
 	Label         string
 	CapacityBytes int64
 	MinioBucket   string
+	// Tier defaults to models.DriveTierStandard when empty.
+	Tier string
 }
 
 // CreateDrive inserts a new drive and returns the created row.
 func (q *Queries) CreateDrive(ctx context.Context, p CreateDriveParams) (*models.Drive, error) {
+	if p.Tier == "" {
+		p.Tier = models.DriveTierStandard
+	}
 	row := q.db.QueryRowContext(ctx, `
-		INSERT INTO drives (server_id, label, capacity_bytes, minio_bucket)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO drives (server_id, label, capacity_bytes, minio_bucket, tier)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING`+driveColumns,
-		p.ServerID, p.Label, p.CapacityBytes, p.MinioBucket,
+		p.ServerID, p.Label, p.CapacityBytes, p.MinioBucket, p.Tier,
 	)
 	d, err := scanDrive(row)
 	if err != nil {
@@ -105,15 +112,16 @@ type UpdateDriveParams struct {
 	Label         string
 	CapacityBytes int64
 	IsActive      bool
+	Tier          string
 }
 
-// UpdateDrive updates label, capacity and active flag for a drive.
+// UpdateDrive updates label, capacity, active flag and tier for a drive.
 func (q *Queries) UpdateDrive(ctx context.Context, id uuid.UUID, p UpdateDriveParams) (*models.Drive, error) {
 	row := q.db.QueryRowContext(ctx, `
-		UPDATE drives SET label = $2, capacity_bytes = $3, is_active = $4
+		UPDATE drives SET label = $2, capacity_bytes = $3, is_active = $4, tier = $5
 		WHERE id = $1
 		RETURNING`+driveColumns,
-		id, p.Label, p.CapacityBytes, p.IsActive,
+		id, p.Label, p.CapacityBytes, p.IsActive, p.Tier,
 	)
 	d, err := scanDrive(row)
 	if err != nil {
@@ -125,15 +133,16 @@ func (q *Queries) UpdateDrive(ctx context.Context, id uuid.UUID, p UpdateDrivePa
 // ── Capacity queries ──────────────────────────────────────────────────────────
 
 // GetDriveAvailableBytes returns the unallocated capacity on a drive:
-// capacity_bytes − SUM(storage_quota_bytes) for all users on this drive.
+// capacity_bytes − SUM(storage_quota_bytes) for all users on this drive,
+// counting replica allocations as well as primary ones.
 // The result is the maximum additional quota that can be allocated here.
 func (q *Queries) GetDriveAvailableBytes(ctx context.Context, driveID uuid.UUID) (int64, error) {
 	var avail int64
 	err := q.db.QueryRowContext(ctx, `
 		SELECT d.capacity_bytes - COALESCE(SUM(u.storage_quota_bytes), 0)
 		FROM drives d
-		LEFT JOIN user_drive_allocations uda ON uda.drive_id = d.id
-		LEFT JOIN users u ON u.username = uda.user_id
+		LEFT JOIN drive_allocations da ON da.drive_id = d.id
+		LEFT JOIN users u ON u.username = da.user_id
 		WHERE d.id = $1
 		GROUP BY d.capacity_bytes
 	`, driveID).Scan(&avail)
@@ -146,21 +155,85 @@ func (q *Queries) GetDriveAvailableBytes(ctx context.Context, driveID uuid.UUID)
 	return avail, nil
 }
 
+// DriveCandidate is one row of ListDriveCandidates: a drive that may receive
+// a new user, with the quota already allocated to it.
+type DriveCandidate struct {
+	Drive          models.Drive
+	AllocatedBytes int64
+	// LastAllocatedAt is when a user was last placed on the drive; nil if never.
+	LastAllocatedAt *time.Time
+}
+
+// FreeBytes returns the capacity not yet promised to any user.
+func (c DriveCandidate) FreeBytes() int64 {
+	return c.Drive.CapacityBytes - c.AllocatedBytes
+}
+
+// ListDriveCandidates returns every active drive on an active server with the
+// sum of storage_quota_bytes allocated to it (replicas included), ordered by
+// creation time. Fit and server health are left to the caller.
+func (q *Queries) ListDriveCandidates(ctx context.Context) ([]DriveCandidate, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT d.id, d.server_id, d.label, d.capacity_bytes, d.minio_bucket, d.is_active,
+		       d.tier, d.state, d.drain_started_at, d.retired_at, d.created_at,
+		       COALESCE(a.allocated, 0), l.last_allocated_at
+		FROM drives d
+		JOIN servers s ON s.id = d.server_id
+		LEFT JOIN (
+			SELECT da.drive_id, SUM(u.storage_quota_bytes) AS allocated
+			FROM drive_allocations da
+			JOIN users u ON u.username = da.user_id
+			GROUP BY da.drive_id
+		) a ON a.drive_id = d.id
+		LEFT JOIN (
+			SELECT drive_id, MAX(allocated_at) AS last_allocated_at
+			FROM user_drive_allocations
+			GROUP BY drive_id
+		) l ON l.drive_id = d.id
+		WHERE d.is_active = true AND s.is_active = true
+		ORDER BY d.created_at ASC, d.id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ListDriveCandidates: %w", err)
+	}
+	defer rows.Close()
+
+	var out []DriveCandidate
+	for rows.Next() {
+		var c DriveCandidate
+		d := &c.Drive
+		if err := rows.Scan(&d.ID, &d.ServerID, &d.Label, &d.CapacityBytes,
+			&d.MinioBucket, &d.IsActive, &d.Tier, &d.State, &d.DrainStartedAt, &d.RetiredAt, &d.CreatedAt,
+			&c.AllocatedBytes, &c.LastAllocatedAt); err != nil {
+			return nil, fmt.Errorf("ListDriveCandidates scan: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListDriveCandidates: %w", err)
+	}
+	return out, nil
+}
+
 // SelectDriveForQuota finds the best-fit active drive that can accommodate
 // quotaBytes of additional allocation (smallest remaining capacity that still
 // fits). Returns ErrNoCapacity if no drive qualifies.
 func (q *Queries) SelectDriveForQuota(ctx context.Context, quotaBytes int64) (*models.Drive, error) {
 	row := q.db.QueryRowContext(ctx, `
 		SELECT`+driveColumns+`
-		FROM drives d
-		JOIN servers s ON s.id = d.server_id
-		LEFT JOIN user_drive_allocations uda ON uda.drive_id = d.id
-		LEFT JOIN users u ON u.username = uda.user_id
-		WHERE d.is_active = true AND s.is_active = true
-		GROUP BY d.id
-		HAVING d.capacity_bytes - COALESCE(SUM(u.storage_quota_bytes), 0) >= $1
-		ORDER BY (d.capacity_bytes - COALESCE(SUM(u.storage_quota_bytes), 0)) ASC
-		LIMIT 1
+		FROM drives
+		WHERE id = (
+			SELECT d.id
+			FROM drives d
+			JOIN servers s ON s.id = d.server_id
+			LEFT JOIN drive_allocations da ON da.drive_id = d.id
+			LEFT JOIN users u ON u.username = da.user_id
+			WHERE d.is_active = true AND s.is_active = true
+			GROUP BY d.id
+			HAVING d.capacity_bytes - COALESCE(SUM(u.storage_quota_bytes), 0) >= $1
+			ORDER BY (d.capacity_bytes - COALESCE(SUM(u.storage_quota_bytes), 0)) ASC
+			LIMIT 1
+		)
 	`, quotaBytes)
 	d, err := scanDrive(row)
 	if err == sql.ErrNoRows {
@@ -181,10 +254,10 @@ func (q *Queries) GetMaxAvailableQuota(ctx context.Context) (int64, error) {
 		FROM drives d
 		JOIN servers s ON s.id = d.server_id
 		LEFT JOIN (
-			SELECT uda.drive_id, SUM(u.storage_quota_bytes) AS allocated
-			FROM user_drive_allocations uda
-			JOIN users u ON u.username = uda.user_id
-			GROUP BY uda.drive_id
+			SELECT da.drive_id, SUM(u.storage_quota_bytes) AS allocated
+			FROM drive_allocations da
+			JOIN users u ON u.username = da.user_id
+			GROUP BY da.drive_id
 		) sub ON sub.drive_id = d.id
 		WHERE d.is_active = true AND s.is_active = true
 	`).Scan(&max)
@@ -199,24 +272,56 @@ func (q *Queries) GetMaxAvailableQuota(ctx context.Context) (int64, error) {
 // GetUserDrive returns the drive allocation for a user with the drive and
 // server details populated. Returns nil if the user has no allocation.
 func (q *Queries) GetUserDrive(ctx context.Context, username string) (*models.UserDriveAllocation, error) {
+	a, err := q.getAllocation(ctx, "user_drive_allocations", username)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserDrive: %w", err)
+	}
+	return a, nil
+}
+
+// LockUserDrive returns the drive username is allocated to, or uuid.Nil if
+// none, and holds a share lock on the allocation until the transaction
+// behind q ends. A writer that creates files rows on that drive takes it so
+// that a migration cannot flip the allocation in between.
+func (q *Queries) LockUserDrive(ctx context.Context, username string) (uuid.UUID, error) {
+	var driveID uuid.UUID
+	err := q.db.QueryRowContext(ctx, `
+		SELECT drive_id FROM user_drive_allocations WHERE user_id = $1 FOR SHARE
+	`, username).Scan(&driveID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("LockUserDrive: %w", err)
+	}
+	return driveID, nil
+}
+
+// getAllocation reads username's row from an allocation table
+// (user_drive_allocations or user_replica_allocations) joined with its drive
+// and server. Returns nil if the user has no row.
+func (q *Queries) getAllocation(ctx context.Context, table, username string) (*models.UserDriveAllocation, error) {
 	var a models.UserDriveAllocation
 	err := q.db.QueryRowContext(ctx, `
 		SELECT
 			uda.user_id, uda.drive_id, uda.allocated_at,
-			d.id, d.server_id, d.label, d.capacity_bytes, d.minio_bucket, d.is_active, d.created_at,
-			s.id, s.name, s.state, s.minio_endpoint, s.minio_use_ssl,
+			d.id, d.server_id, d.label, d.capacity_bytes, d.minio_bucket, d.is_active,
+			d.tier, d.state, d.drain_started_at, d.retired_at, d.created_at,
+			s.id, s.name, s.state, s.backend, s.region, s.minio_endpoint, s.minio_use_ssl,
 			s.minio_access_key_enc, s.minio_access_key_nonce,
 			s.minio_secret_key_enc, s.minio_secret_key_nonce,
 			s.is_active, s.created_at
-		FROM user_drive_allocations uda
+		FROM `+table+` uda
 		JOIN drives d ON d.id = uda.drive_id
 		JOIN servers s ON s.id = d.server_id
 		WHERE uda.user_id = $1
 	`, username).Scan(
 		&a.UserID, &a.DriveID, &a.AllocatedAt,
 		&a.Drive.ID, &a.Drive.ServerID, &a.Drive.Label, &a.Drive.CapacityBytes,
-		&a.Drive.MinioBucket, &a.Drive.IsActive, &a.Drive.CreatedAt,
-		&a.Server.ID, &a.Server.Name, &a.Server.State, &a.Server.MinioEndpoint,
+		&a.Drive.MinioBucket, &a.Drive.IsActive,
+		&a.Drive.Tier, &a.Drive.State, &a.Drive.DrainStartedAt, &a.Drive.RetiredAt, &a.Drive.CreatedAt,
+		&a.Server.ID, &a.Server.Name, &a.Server.State, &a.Server.Backend, &a.Server.Region,
+		&a.Server.MinioEndpoint,
 		&a.Server.MinioUseSSL,
 		&a.Server.MinioAccessKeyEnc, &a.Server.MinioAccessKeyNonce,
 		&a.Server.MinioSecretKeyEnc, &a.Server.MinioSecretKeyNonce,
@@ -226,7 +331,7 @@ func (q *Queries) GetUserDrive(ctx context.Context, username string) (*models.Us
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("GetUserDrive: %w", err)
+		return nil, err
 	}
 	return &a, nil
 }
@@ -251,11 +356,11 @@ func (q *Queries) GetDriveSummaries(ctx context.Context) ([]models.DriveSummary,
 			d.id, d.server_id, s.name, d.label, d.capacity_bytes, d.minio_bucket,
 			COALESCE(SUM(u.storage_quota_bytes), 0) AS allocated_quota_bytes,
 			COALESCE(SUM(u.storage_used_bytes), 0)  AS used_bytes,
-			d.is_active, s.is_active
+			d.is_active, d.tier, d.state, s.is_active
 		FROM drives d
 		JOIN servers s ON s.id = d.server_id
-		LEFT JOIN user_drive_allocations uda ON uda.drive_id = d.id
-		LEFT JOIN users u ON u.username = uda.user_id
+		LEFT JOIN drive_allocations da ON da.drive_id = d.id
+		LEFT JOIN users u ON u.username = da.user_id
 		GROUP BY d.id, s.id
 		ORDER BY s.name ASC, d.label ASC
 	`)
@@ -271,7 +376,7 @@ func (q *Queries) GetDriveSummaries(ctx context.Context) ([]models.DriveSummary,
 			&ds.DriveID, &ds.ServerID, &ds.ServerName, &ds.DriveLabel,
 			&ds.CapacityBytes, &ds.MinioBucket,
 			&ds.AllocatedQuotaBytes, &ds.UsedBytes,
-			&ds.DriveIsActive, &ds.ServerIsActive,
+			&ds.DriveIsActive, &ds.DriveTier, &ds.DriveState, &ds.ServerIsActive,
 		); err != nil {
 			return nil, fmt.Errorf("GetDriveSummaries scan: %w", err)
 		}
@@ -279,3 +384,100 @@ func (q *Queries) GetDriveSummaries(ctx context.Context) ([]models.DriveSummary,
 	}
 	return out, rows.Err()
 }
+
+// ── Draining ──────────────────────────────────────────────────────────────────
+
+// StartDriveDrain moves a drive into the draining state and deactivates it so
+// SelectDriveForQuota stops choosing it. drain_started_at is kept when the
+// drive is already draining. Returns sql.ErrNoRows if the drive does not exist
+// or is retired.
+func (q *Queries) StartDriveDrain(ctx context.Context, id uuid.UUID) (*models.Drive, error) {
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE drives
+		SET state            = 'draining',
+		    is_active        = false,
+		    drain_started_at = COALESCE(drain_started_at, NOW())
+		WHERE id = $1 AND state <> 'retired'
+		RETURNING`+driveColumns,
+		id,
+	)
+	d, err := scanDrive(row)
+	if err != nil {
+		return nil, fmt.Errorf("StartDriveDrain: %w", err)
+	}
+	return d, nil
+}
+
+// RetireDrive marks a draining drive retired once no user is allocated to it,
+// as primary or replica. Returns false when the drive still has allocations
+// or is not draining.
+func (q *Queries) RetireDrive(ctx context.Context, id uuid.UUID) (bool, error) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE drives
+		SET state = 'retired', is_active = false, retired_at = NOW()
+		WHERE id = $1 AND state = 'draining'
+		  AND NOT EXISTS (SELECT 1 FROM drive_allocations WHERE drive_id = $1)
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("RetireDrive: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// ListDrivesByState returns every drive in the given state, ordered by label.
+func (q *Queries) ListDrivesByState(ctx context.Context, state string) ([]models.Drive, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+driveColumns+`
+		FROM drives WHERE state = $1
+		ORDER BY label ASC
+	`, state)
+	if err != nil {
+		return nil, fmt.Errorf("ListDrivesByState: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.Drive, 0)
+	for rows.Next() {
+		d, err := scanDriveRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListDrivesByState scan: %w", err)
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// DriveUser is one row of ListDriveUsers.
+type DriveUser struct {
+	Username   string `json:"username"`
+	QuotaBytes int64  `json:"quota_bytes"`
+	UsedBytes  int64  `json:"used_bytes"`
+	IsPremium  bool   `json:"is_premium"`
+}
+
+// ListDriveUsers returns the users allocated to a drive, largest quota first
+// so a drain places the hardest-to-fit users while the most space is free.
+func (q *Queries) ListDriveUsers(ctx context.Context, driveID uuid.UUID) ([]DriveUser, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT u.username, u.storage_quota_bytes, u.storage_used_bytes, u.is_premium
+		FROM user_drive_allocations uda
+		JOIN users u ON u.username = uda.user_id
+		WHERE uda.drive_id = $1
+		ORDER BY u.storage_quota_bytes DESC, u.username ASC
+	`, driveID)
+	if err != nil {
+		return nil, fmt.Errorf("ListDriveUsers: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]DriveUser, 0)
+	for rows.Next() {
+		var du DriveUser
+		if err := rows.Scan(&du.Username, &du.QuotaBytes, &du.UsedBytes, &du.IsPremium); err != nil {
+			return nil, fmt.Errorf("ListDriveUsers scan: %w", err)
+		}
+		out = append(out, du)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+// HashedImage is an image with a perceptual hash, as considered by the
+// duplicate finder.
+type HashedImage struct {
+	FileID    uuid.UUID  `json:"file_id"`
+	FolderID  *uuid.UUID `json:"folder_id"`
+	Name      string     `json:"name"`
+	MimeType  string     `json:"mime_type"`
+	SizeBytes int64      `json:"size_bytes"`
+	// Width and Height come from media_metadata; nil when never extracted.
+	Width     *int       `json:"width"`
+	Height    *int       `json:"height"`
+	TakenAt   *time.Time `json:"taken_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	Hash      uint64     `json:"-"`
+}
+
+// SetFilePerceptualHash records the perceptual hash of an image. Like
+// SetFileTakenAt it runs from a background job outside the user-scoped
+// transaction, so it is intentionally not gated by RLS.
+func (q *Queries) SetFilePerceptualHash(ctx context.Context, id uuid.UUID, hash uint64) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE files SET perceptual_hash = $2 WHERE id = $1
+	`, id, int64(hash))
+	if err != nil {
+		return fmt.Errorf("SetFilePerceptualHash %s: %w", id, err)
+	}
+	return nil
+}
+
+// ListUnhashedImages returns userID's images that have no perceptual hash,
+// for backfilling it. Must run inside a ForUser transaction (RLS scopes rows).
+func (q *Queries) ListUnhashedImages(ctx context.Context, userID uuid.UUID) ([]models.File, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+fileColumns+`
+		FROM files
+		WHERE user_id = $1
+		  AND perceptual_hash IS NULL
+		  AND mime_type LIKE 'image/%'
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ListUnhashedImages: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.File, 0)
+	for rows.Next() {
+		f, err := scanFileRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListUnhashedImages scan: %w", err)
+		}
+		out = append(out, *f)
+	}
+	return out, rows.Err()
+}
+
+// ListHashedImages returns every visible (not hidden) file of userID that has
+// a perceptual hash. Must run inside a ForUser transaction (RLS scopes rows).
+func (q *Queries) ListHashedImages(ctx context.Context, userID uuid.UUID) ([]HashedImage, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT f.id, f.folder_id, f.name, f.mime_type, f.size_bytes, f.taken_at, f.created_at,
+		       f.perceptual_hash, m.width, m.height
+		FROM files f
+		LEFT JOIN media_metadata m ON m.file_id = f.id
+		WHERE f.user_id = $1
+		  AND f.perceptual_hash IS NOT NULL
+		  AND f.hidden = FALSE
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ListHashedImages: %w", err)
+	}
+	defer rows.Close()
+
+	var out []HashedImage
+	for rows.Next() {
+		var img HashedImage
+		var folderID uuid.NullUUID
+		var hash int64
+		if err := rows.Scan(&img.FileID, &folderID, &img.Name, &img.MimeType, &img.SizeBytes,
+			&img.TakenAt, &img.CreatedAt, &hash, &img.Width, &img.Height); err != nil {
+			return nil, fmt.Errorf("ListHashedImages scan: %w", err)
+		}
+		if folderID.Valid {
+			img.FolderID = &folderID.UUID
+		}
+		img.Hash = uint64(hash)
+		out = append(out, img)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// EventChannel is the PostgreSQL NOTIFY channel user events are published
+// on. Each payload is a JSON object {"id", "user_id", "type", "data",
+// "created_at"}; id is unique per event and user_id is the nil UUID for
+// admin events.
+//
+// NOTIFY is transactional: an event published through a transaction-bound
+// Queries is delivered only when that transaction commits, and not at all
+// when it rolls back, so listeners never hear about changes that did not
+// happen. Change journal entries are published by recordChange itself.
+// Both queue the webhook deliveries an event triggers in the same statement
+// (see queueWebhookDeliveries).
+const EventChannel = "user_events"
+
+// PublishEvent notifies listeners of EventChannel that eventType happened
+// for userID and queues the webhook deliveries it triggers. data is encoded
+// as JSON and must stay well below PostgreSQL's 8000-byte payload limit; a
+// file event's data carries the file's folder_id.
+func (q *Queries) PublishEvent(ctx context.Context, userID uuid.UUID, eventType string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("PublishEvent: encode %s: %w", eventType, err)
+	}
+	webhookType, fileEvent := webhookEventFor(userID, eventType)
+	_, err = q.db.ExecContext(ctx, `
+		WITH ev AS (
+			SELECT gen_random_uuid() AS id, NOW() AS created_at, $2::uuid AS user_id, $4::json AS data,
+			       NULLIF($5::text, '') AS webhook_type, $6::boolean AS file_event,
+			       CASE WHEN $6::boolean THEN ($4::jsonb ->> 'folder_id')::uuid END AS folder_id
+		), `+queueWebhookDeliveries+`
+		SELECT pg_notify($1, json_build_object(
+			'id', id, 'user_id', user_id, 'type', $3::text, 'data', data, 'created_at', created_at
+		)::text)
+		FROM ev
+	`, EventChannel, userID, eventType, string(b), webhookType, fileEvent)
+	if err != nil {
+		return fmt.Errorf("PublishEvent %s: %w", eventType, err)
+	}
+	return nil
+}
@@ -3,17 +3,19 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 
 	"apollo-sfs.com/api/models"
 )
 
 const fileColumns = `
 	id, user_id, folder_id, drive_id, name, mime_type,
-	size_bytes, minio_object_key, nonce, taken_at, hidden, created_at, updated_at`
+	size_bytes, minio_object_key, nonce, taken_at, hidden, tags, created_at, updated_at`
 
 func scanFile(row *sql.Row) (*models.File, error) {
 	var f models.File
@@ -22,7 +24,7 @@ func scanFile(row *sql.Row) (*models.File, error) {
 	var takenAt sql.NullTime
 	err := row.Scan(
 		&f.ID, &f.UserID, &folderID, &driveID, &f.Name, &f.MimeType,
-		&f.SizeBytes, &f.MinIOObjectKey, &f.Nonce, &takenAt, &f.Hidden, &f.CreatedAt, &f.UpdatedAt,
+		&f.SizeBytes, &f.MinIOObjectKey, &f.Nonce, &takenAt, &f.Hidden, pq.Array(&f.Tags), &f.CreatedAt, &f.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -36,18 +38,23 @@ func scanFile(row *sql.Row) (*models.File, error) {
 	if takenAt.Valid {
 		f.TakenAt = &takenAt.Time
 	}
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
 	return &f, nil
 }
 
-func scanFileRow(rows *sql.Rows) (*models.File, error) {
+// scanFileRow scans fileColumns, followed by any extra selected columns
+// into extra.
+func scanFileRow(rows *sql.Rows, extra ...any) (*models.File, error) {
 	var f models.File
 	var folderID uuid.NullUUID
 	var driveID uuid.NullUUID
 	var takenAt sql.NullTime
-	err := rows.Scan(
+	err := rows.Scan(append([]any{
 		&f.ID, &f.UserID, &folderID, &driveID, &f.Name, &f.MimeType,
-		&f.SizeBytes, &f.MinIOObjectKey, &f.Nonce, &takenAt, &f.Hidden, &f.CreatedAt, &f.UpdatedAt,
-	)
+		&f.SizeBytes, &f.MinIOObjectKey, &f.Nonce, &takenAt, &f.Hidden, pq.Array(&f.Tags), &f.CreatedAt, &f.UpdatedAt,
+	}, extra...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -60,6 +67,9 @@ func scanFileRow(rows *sql.Rows) (*models.File, error) {
 	if takenAt.Valid {
 		f.TakenAt = &takenAt.Time
 	}
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
 	return &f, nil
 }
 
@@ -92,6 +102,9 @@ func (q *Queries) CreateFile(ctx context.Context, f *models.File) (*models.File,
 	if err != nil {
 		return nil, fmt.Errorf("CreateFile: %w", err)
 	}
+	if err := q.recordFileChange(ctx, out, models.ChangeCreate); err != nil {
+		return nil, fmt.Errorf("CreateFile: %w", err)
+	}
 	return out, nil
 }
 
@@ -181,21 +194,31 @@ func (q *Queries) ListRootFiles(ctx context.Context, userID uuid.UUID, in PageIn
 }
 
 // SearchFilesByUser returns a page of files owned by userID whose name
-// contains term (case-insensitive), ordered by name.
-func (q *Queries) SearchFilesByUser(ctx context.Context, userID uuid.UUID, term string, in PageInput) (*PageResult[models.File], error) {
+// contains term (case-insensitive) and that match filter, ordered by name.
+// An empty term matches every name. Must run inside a ForUser transaction
+// (RLS scopes the files).
+func (q *Queries) SearchFilesByUser(ctx context.Context, userID uuid.UUID, term string, filter SearchFilter, in PageInput) (*PageResult[models.File], error) {
 	limit := clampLimit(in.Limit)
 	offset, err := decodeOffsetCursor(in.Cursor)
 	if err != nil {
 		return nil, fmt.Errorf("SearchFilesByUser: %w", err)
 	}
 
+	var w sqlWhere
+	userArg := w.arg(userID)
+	w.and("files.user_id = " + userArg)
+	if term != "" {
+		w.and("files.name ILIKE '%' || " + w.arg(term) + " || '%'")
+	}
+	filter.fileConditions(&w, "files", userArg)
+
 	rows, err := q.db.QueryContext(ctx, `
 		SELECT`+fileColumns+`
 		FROM files
-		WHERE user_id = $1 AND name ILIKE '%' || $2 || '%'
+		WHERE `+w.String()+`
 		ORDER BY name ASC
-		LIMIT $3 OFFSET $4
-	`, userID, term, limit, offset)
+		LIMIT `+w.arg(limit)+` OFFSET `+w.arg(offset),
+		w.args...)
 	if err != nil {
 		return nil, fmt.Errorf("SearchFilesByUser: %w", err)
 	}
@@ -266,9 +289,44 @@ func (q *Queries) UpdateFileName(ctx context.Context, id uuid.UUID, name string)
 	if err != nil {
 		return nil, fmt.Errorf("UpdateFileName %s: %w", id, err)
 	}
+	if err := q.recordFileChange(ctx, f, models.ChangeRename); err != nil {
+		return nil, fmt.Errorf("UpdateFileName %s: %w", id, err)
+	}
 	return f, nil
 }
 
+// ReplaceFileBlob points file f.ID at a rewritten blob: its object key,
+// nonce, plaintext size, drive and MIME type are set from f, and its capture
+// date when f.TakenAt is set. Name, folder and everything attached to the
+// file are kept. The caller stores the blob first and removes the old one
+// afterwards. Returns the updated record.
+func (q *Queries) ReplaceFileBlob(ctx context.Context, f *models.File) (*models.File, error) {
+	var driveID uuid.NullUUID
+	if f.DriveID != nil {
+		driveID = uuid.NullUUID{UUID: *f.DriveID, Valid: true}
+	}
+	var takenAt sql.NullTime
+	if f.TakenAt != nil {
+		takenAt = sql.NullTime{Time: *f.TakenAt, Valid: true}
+	}
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE files
+		SET minio_object_key = $2, nonce = $3, size_bytes = $4,
+		    drive_id = COALESCE($5, drive_id), mime_type = $6,
+		    taken_at = COALESCE($7, taken_at), updated_at = NOW()
+		WHERE id = $1
+		RETURNING`+fileColumns,
+		f.ID, f.MinIOObjectKey, f.Nonce, f.SizeBytes, driveID, f.MimeType, takenAt)
+	out, err := scanFile(row)
+	if err != nil {
+		return nil, fmt.Errorf("ReplaceFileBlob %s: %w", f.ID, err)
+	}
+	if err := q.recordFileChange(ctx, out, models.ChangeContent); err != nil {
+		return nil, fmt.Errorf("ReplaceFileBlob %s: %w", f.ID, err)
+	}
+	return out, nil
+}
+
 // MoveFileToRoot moves a file to the root level (folder_id IS NULL) and
 // bumps updated_at. Used by SFS /move when the destination key has no
 // directory components.
@@ -283,6 +341,9 @@ func (q *Queries) MoveFileToRoot(ctx context.Context, fileID uuid.UUID) (*models
 	if err != nil {
 		return nil, fmt.Errorf("MoveFileToRoot %s: %w", fileID, err)
 	}
+	if err := q.recordFileChange(ctx, f, models.ChangeMove); err != nil {
+		return nil, fmt.Errorf("MoveFileToRoot %s: %w", fileID, err)
+	}
 	return f, nil
 }
 
@@ -326,19 +387,43 @@ func (q *Queries) MoveFile(ctx context.Context, fileID, newFolderID uuid.UUID) (
 	if err != nil {
 		return nil, fmt.Errorf("MoveFile %s: %w", fileID, err)
 	}
+	if err := q.recordFileChange(ctx, f, models.ChangeMove); err != nil {
+		return nil, fmt.Errorf("MoveFile %s: %w", fileID, err)
+	}
 	return f, nil
 }
 
 // DeleteFile removes a file metadata row by id. The caller is responsible for
 // deleting the corresponding blob from MinIO before or after calling this.
+// Deleting a file that does not exist is not an error.
 func (q *Queries) DeleteFile(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, `DELETE FROM files WHERE id = $1`, id)
+	row := q.db.QueryRowContext(ctx, `DELETE FROM files WHERE id = $1 RETURNING`+fileColumns, id)
+	f, err := scanFile(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("DeleteFile %s: %w", id, err)
 	}
+	if err := q.recordFileChange(ctx, f, models.ChangeDelete); err != nil {
+		return fmt.Errorf("DeleteFile %s: %w", id, err)
+	}
 	return nil
 }
 
+// SetFilesDrive points every file row owned by userID at driveID. Must run
+// inside a ForUser transaction (files has FORCE RLS); returns the number of
+// rows updated.
+func (q *Queries) SetFilesDrive(ctx context.Context, userID, driveID uuid.UUID) (int64, error) {
+	res, err := q.db.ExecContext(ctx,
+		`UPDATE files SET drive_id = $2 WHERE user_id = $1`, userID, driveID)
+	if err != nil {
+		return 0, fmt.Errorf("SetFilesDrive: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
 // GetAllUserFiles returns all file records owned by username (no pagination).
 // Used for bulk deletion during a permanent ban.
 func (q *Queries) GetAllUserFiles(ctx context.Context, username string) ([]models.File, error) {
@@ -365,11 +450,29 @@ func (q *Queries) GetAllUserFiles(ctx context.Context, username string) ([]model
 // DeleteAllUserFileRows bulk-deletes every file row for username.
 // The caller must delete the MinIO objects first.
 func (q *Queries) DeleteAllUserFileRows(ctx context.Context, username string) error {
-	_, err := q.db.ExecContext(ctx,
-		`DELETE FROM files WHERE user_id = $1::uuid`, username)
+	rows, err := q.db.QueryContext(ctx,
+		`DELETE FROM files WHERE user_id = $1::uuid RETURNING`+fileColumns, username)
 	if err != nil {
 		return fmt.Errorf("DeleteAllUserFileRows: %w", err)
 	}
+	deleted := make([]models.File, 0)
+	for rows.Next() {
+		f, err := scanFileRow(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("DeleteAllUserFileRows scan: %w", err)
+		}
+		deleted = append(deleted, *f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("DeleteAllUserFileRows: %w", err)
+	}
+	for i := range deleted {
+		if err := q.recordFileChange(ctx, &deleted[i], models.ChangeDelete); err != nil {
+			return fmt.Errorf("DeleteAllUserFileRows: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -481,6 +584,27 @@ func (q *Queries) SetFileHidden(ctx context.Context, id uuid.UUID, hidden bool)
 	if err != nil {
 		return nil, fmt.Errorf("SetFileHidden %s: %w", id, err)
 	}
+	op := models.ChangeUnhide
+	if hidden {
+		op = models.ChangeHide
+	}
+	if err := q.recordFileChange(ctx, f, op); err != nil {
+		return nil, fmt.Errorf("SetFileHidden %s: %w", id, err)
+	}
+	return f, nil
+}
+
+// SetFileTags replaces a file's tags and returns the updated record.
+func (q *Queries) SetFileTags(ctx context.Context, id uuid.UUID, tags []string) (*models.File, error) {
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE files SET tags = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING`+fileColumns,
+		id, pq.Array(tags))
+	f, err := scanFile(row)
+	if err != nil {
+		return nil, fmt.Errorf("SetFileTags %s: %w", id, err)
+	}
 	return f, nil
 }
 
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -86,6 +87,9 @@ func (q *Queries) CreateFolder(ctx context.Context, f *models.Folder) (*models.F
 	if err != nil {
 		return nil, fmt.Errorf("CreateFolder: %w", err)
 	}
+	if err := q.recordFolderChange(ctx, out, models.ChangeCreate); err != nil {
+		return nil, fmt.Errorf("CreateFolder: %w", err)
+	}
 	return out, nil
 }
 
@@ -150,6 +154,9 @@ func (q *Queries) UpdateFolderName(ctx context.Context, id uuid.UUID, name strin
 	if err != nil {
 		return nil, fmt.Errorf("UpdateFolderName %s: %w", id, err)
 	}
+	if err := q.recordFolderChange(ctx, f, models.ChangeRename); err != nil {
+		return nil, fmt.Errorf("UpdateFolderName %s: %w", id, err)
+	}
 	return f, nil
 }
 
@@ -190,20 +197,30 @@ func (q *Queries) ListRootFolders(ctx context.Context, userID uuid.UUID, in Page
 }
 
 // SearchFoldersByUser returns a page of folders owned by userID whose name
-// contains term (case-insensitive), ordered by name. Searches across all
-// folders regardless of parent — intended for the global search endpoint.
-func (q *Queries) SearchFoldersByUser(ctx context.Context, userID uuid.UUID, term string, in PageInput) (*PageResult[models.Folder], error) {
+// contains term (case-insensitive) and that match filter, ordered by name.
+// Searches across all folders regardless of parent unless the filter is
+// scoped to one; an empty term matches every name. Must run inside a
+// ForUser transaction.
+func (q *Queries) SearchFoldersByUser(ctx context.Context, userID uuid.UUID, term string, filter SearchFilter, in PageInput) (*PageResult[models.Folder], error) {
 	limit := clampLimit(in.Limit)
 	offset, err := decodeOffsetCursor(in.Cursor)
 	if err != nil {
 		return nil, fmt.Errorf("SearchFoldersByUser: %w", err)
 	}
 
+	var w sqlWhere
+	userArg := w.arg(userID)
+	w.and("f.user_id = " + userArg)
+	if term != "" {
+		w.and("f.name ILIKE '%' || " + w.arg(term) + " || '%'")
+	}
+	filter.folderConditions(&w, "f", userArg)
+
 	rows, err := q.db.QueryContext(ctx, folderListSelect+`
-		WHERE f.user_id = $1 AND f.name ILIKE '%' || $2 || '%'
+		WHERE `+w.String()+`
 		ORDER BY f.name ASC
-		LIMIT $3 OFFSET $4
-	`, userID, term, limit, offset)
+		LIMIT `+w.arg(limit)+` OFFSET `+w.arg(offset),
+		w.args...)
 	if err != nil {
 		return nil, fmt.Errorf("SearchFoldersByUser: %w", err)
 	}
@@ -277,12 +294,20 @@ func (q *Queries) HasFolderChildren(ctx context.Context, folderID uuid.UUID) (bo
 	return total > 0, nil
 }
 
-// DeleteFolder removes a folder by id.
+// DeleteFolder removes a folder by id. Deleting a folder that does not
+// exist is not an error.
 func (q *Queries) DeleteFolder(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, `DELETE FROM folders WHERE id = $1`, id)
+	row := q.db.QueryRowContext(ctx, `DELETE FROM folders WHERE id = $1 RETURNING `+folderColumns, id)
+	f, err := scanFolder(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("DeleteFolder %s: %w", id, err)
 	}
+	if err := q.recordFolderChange(ctx, f, models.ChangeDelete); err != nil {
+		return fmt.Errorf("DeleteFolder %s: %w", id, err)
+	}
 	return nil
 }
 
@@ -298,6 +323,9 @@ func (q *Queries) UpdateFolderParent(ctx context.Context, id uuid.UUID, parentID
 	if err != nil {
 		return nil, fmt.Errorf("UpdateFolderParent %s: %w", id, err)
 	}
+	if err := q.recordFolderChange(ctx, f, models.ChangeMove); err != nil {
+		return nil, fmt.Errorf("UpdateFolderParent %s: %w", id, err)
+	}
 	return f, nil
 }
 
@@ -383,3 +411,36 @@ func (q *Queries) FolderWouldCreateCycle(ctx context.Context, folderID, targetID
 	}
 	return would, nil
 }
+
+// ListFolderSubtree returns rootID and every folder beneath it, parents
+// before children, each with its recursive size_bytes. The root comes first,
+// so its SizeBytes is the size of the whole subtree.
+func (q *Queries) ListFolderSubtree(ctx context.Context, rootID uuid.UUID) ([]models.Folder, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		WITH RECURSIVE t(id, depth) AS (
+			SELECT id, 0 FROM folders WHERE id = $1
+			UNION ALL
+			SELECT c.id, t.depth + 1 FROM folders c JOIN t ON c.parent_id = t.id
+		)
+	`+folderListSelect+`
+		JOIN t ON t.id = f.id
+		ORDER BY t.depth, f.name
+	`, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("ListFolderSubtree: %w", err)
+	}
+	defer rows.Close()
+
+	folders := make([]models.Folder, 0)
+	for rows.Next() {
+		f, err := scanFolderListRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListFolderSubtree scan: %w", err)
+		}
+		folders = append(folders, *f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListFolderSubtree: %w", err)
+	}
+	return folders, nil
+}
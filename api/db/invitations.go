@@ -18,6 +18,7 @@ func scanInvitation(row *sql.Row) (*models.Invitation, error) {
 		&inv.ID, &inv.InvitedByUserID, &inv.Email, &inv.Token,
 		&inv.TokenExpiresAt, &acceptedAt, &revokedAt, &inv.CreatedAt,
 		&inv.InitialQuotaBytes, &inv.GrantAdmin,
+		&inv.AllocationDriveID, &inv.AllocationPolicy,
 	)
 	if err != nil {
 		return nil, err
@@ -38,6 +39,7 @@ func scanInvitationRow(rows *sql.Rows) (*models.Invitation, error) {
 		&inv.ID, &inv.InvitedByUserID, &inv.Email, &inv.Token,
 		&inv.TokenExpiresAt, &acceptedAt, &revokedAt, &inv.CreatedAt,
 		&inv.InitialQuotaBytes, &inv.GrantAdmin,
+		&inv.AllocationDriveID, &inv.AllocationPolicy,
 	)
 	if err != nil {
 		return nil, err
@@ -56,9 +58,11 @@ func (q *Queries) CreateInvitation(ctx context.Context, inv *models.Invitation)
 	_, err := q.db.ExecContext(ctx, `
 		INSERT INTO invitations (
 			id, invited_by_user_id, email, token, token_expires_at,
-			initial_quota_bytes, grant_admin, created_at
-		) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW())
-	`, inv.InvitedByUserID, inv.Email, inv.Token, inv.TokenExpiresAt, inv.InitialQuotaBytes, inv.GrantAdmin)
+			initial_quota_bytes, grant_admin,
+			allocation_drive_id, allocation_policy, created_at
+		) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, NOW())
+	`, inv.InvitedByUserID, inv.Email, inv.Token, inv.TokenExpiresAt, inv.InitialQuotaBytes, inv.GrantAdmin,
+		inv.AllocationDriveID, inv.AllocationPolicy)
 	if err != nil {
 		return fmt.Errorf("CreateInvitation: %w", err)
 	}
@@ -71,7 +75,8 @@ func (q *Queries) GetInvitationByID(ctx context.Context, id uuid.UUID) (*models.
 	row := q.db.QueryRowContext(ctx, `
 		SELECT id, invited_by_user_id, email, token,
 		       token_expires_at, accepted_at, revoked_at, created_at,
-		       initial_quota_bytes, grant_admin
+		       initial_quota_bytes, grant_admin,
+		       allocation_drive_id, allocation_policy
 		FROM invitations WHERE id = $1
 	`, id)
 	inv, err := scanInvitation(row)
@@ -87,7 +92,8 @@ func (q *Queries) GetInvitationByToken(ctx context.Context, token string) (*mode
 	row := q.db.QueryRowContext(ctx, `
 		SELECT id, invited_by_user_id, email, token,
 		       token_expires_at, accepted_at, revoked_at, created_at,
-		       initial_quota_bytes, grant_admin
+		       initial_quota_bytes, grant_admin,
+		       allocation_drive_id, allocation_policy
 		FROM invitations
 		WHERE token = $1
 		  AND accepted_at IS NULL
@@ -111,7 +117,8 @@ func (q *Queries) ListInvitations(ctx context.Context, in PageInput) (*PageResul
 	rows, err := q.db.QueryContext(ctx, `
 		SELECT id, invited_by_user_id, email, token,
 		       token_expires_at, accepted_at, revoked_at, created_at,
-		       initial_quota_bytes, grant_admin
+		       initial_quota_bytes, grant_admin,
+		       allocation_drive_id, allocation_policy
 		FROM invitations
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+const jobColumns = `
+	id, kind, file_id, user_id, username, status, attempts, max_attempts,
+	run_after, last_error, created_at, updated_at, started_at, finished_at`
+
+func scanJob(row interface {
+	Scan(...any) error
+}) (*models.Job, error) {
+	var j models.Job
+	err := row.Scan(&j.ID, &j.Kind, &j.FileID, &j.UserID, &j.Username, &j.Status, &j.Attempts, &j.MaxAttempts,
+		&j.RunAfter, &j.LastError, &j.CreatedAt, &j.UpdatedAt, &j.StartedAt, &j.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// EnqueueJob inserts a queued job of kind for fileID. Returns false without
+// an error when the file already has an unfinished job of that kind.
+func (q *Queries) EnqueueJob(ctx context.Context, kind string, fileID, userID uuid.UUID, username string) (bool, error) {
+	res, err := q.db.ExecContext(ctx, `
+		INSERT INTO jobs (kind, file_id, user_id, username)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (file_id, kind) WHERE status IN ('queued', 'running') DO NOTHING
+	`, kind, fileID, userID, username)
+	if err != nil {
+		return false, fmt.Errorf("EnqueueJob: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ClaimJob moves the oldest due queued job to 'running', counts the attempt
+// and returns it. Returns nil when nothing is due. SKIP LOCKED lets several
+// workers claim concurrently without handing out the same job twice.
+func (q *Queries) ClaimJob(ctx context.Context) (*models.Job, error) {
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status     = 'running',
+		    attempts   = attempts + 1,
+		    started_at = NOW(),
+		    updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'queued' AND run_after <= NOW()
+			ORDER BY run_after ASC, created_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING`+jobColumns)
+	j, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ClaimJob: %w", err)
+	}
+	return j, nil
+}
+
+// GetJob returns the job with id, or nil if none exists.
+func (q *Queries) GetJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT`+jobColumns+` FROM jobs WHERE id = $1`, id)
+	j, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetJob: %w", err)
+	}
+	return j, nil
+}
+
+// ListJobs returns a page of jobs, newest first. An empty status lists every job.
+func (q *Queries) ListJobs(ctx context.Context, status string, in PageInput) (*PageResult[models.Job], error) {
+	limit := clampLimit(in.Limit)
+	offset, err := decodeOffsetCursor(in.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("ListJobs: %w", err)
+	}
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+jobColumns+`
+		FROM jobs
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ListJobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]models.Job, 0)
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListJobs scan: %w", err)
+		}
+		jobs = append(jobs, *j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListJobs: %w", err)
+	}
+	return &PageResult[models.Job]{
+		Items:     jobs,
+		NextToken: offsetNextToken(len(jobs), limit, offset),
+	}, nil
+}
+
+// GetJobSummary returns the number of jobs in each status.
+func (q *Queries) GetJobSummary(ctx context.Context) ([]models.JobStatusCount, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT status, COUNT(*)
+		FROM jobs
+		GROUP BY status
+		ORDER BY status ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("GetJobSummary: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.JobStatusCount, 0)
+	for rows.Next() {
+		var c models.JobStatusCount
+		if err := rows.Scan(&c.Status, &c.Count); err != nil {
+			return nil, fmt.Errorf("GetJobSummary scan: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// FinishJob moves a running job to status ('done' or 'failed') and records
+// errMsg. Returns false when the job is no longer running, e.g. because an
+// admin cancelled it meanwhile.
+func (q *Queries) FinishJob(ctx context.Context, id uuid.UUID, status string, errMsg *string) (bool, error) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET status      = $2,
+		    last_error  = COALESCE($3, last_error),
+		    updated_at  = NOW(),
+		    finished_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, id, status, errMsg)
+	if err != nil {
+		return false, fmt.Errorf("FinishJob: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RescheduleJob puts a running job back in the queue after a failed attempt,
+// due again at runAfter. Returns false when the job is no longer running.
+func (q *Queries) RescheduleJob(ctx context.Context, id uuid.UUID, errMsg string, runAfter time.Time) (bool, error) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET status     = 'queued',
+		    last_error = $2,
+		    run_after  = $3,
+		    updated_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, id, errMsg, runAfter)
+	if err != nil {
+		return false, fmt.Errorf("RescheduleJob: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RequeueJob moves a failed or cancelled job back to 'queued' with a fresh
+// attempt budget and returns it. Returns nil when the job does not exist or
+// is not in one of those states. Fails on jobs_one_active_idx when the file
+// already has another unfinished job of the same kind.
+func (q *Queries) RequeueJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status      = 'queued',
+		    attempts    = 0,
+		    run_after   = NOW(),
+		    updated_at  = NOW(),
+		    finished_at = NULL
+		WHERE id = $1 AND status IN ('failed', 'cancelled')
+		RETURNING`+jobColumns, id)
+	j, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("RequeueJob: %w", err)
+	}
+	return j, nil
+}
+
+// CancelJob cancels the job if it is still in fromStatus and returns it.
+// Returns nil when the job has moved on meanwhile.
+func (q *Queries) CancelJob(ctx context.Context, id uuid.UUID, fromStatus string) (*models.Job, error) {
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status      = 'cancelled',
+		    updated_at  = NOW(),
+		    finished_at = NOW()
+		WHERE id = $1 AND status = $2
+		RETURNING`+jobColumns, id, fromStatus)
+	j, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CancelJob: %w", err)
+	}
+	return j, nil
+}
+
+// RequeueInterruptedJobs moves every running job back to 'queued'. Called at
+// startup, when any job still marked running was claimed by a process that
+// has since exited. The interrupted attempt still counts.
+func (q *Queries) RequeueInterruptedJobs(ctx context.Context) (int64, error) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE jobs SET status = 'queued', updated_at = NOW()
+		WHERE status = 'running'
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("RequeueInterruptedJobs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// DeleteFinishedJobs removes done jobs that finished before cutoff. Failed
+// and cancelled jobs are kept for inspection.
+func (q *Queries) DeleteFinishedJobs(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := q.db.ExecContext(ctx, `
+		DELETE FROM jobs WHERE status = 'done' AND finished_at < $1
+	`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("DeleteFinishedJobs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// ListStrandedVariants returns pending variants with no unfinished job that
+// would complete them: thumbnails ('thumb-*' qualities) need a thumbnail
+// job, HLS assets ('hls/*') an hls job, everything else a transcode job.
+// These are left behind by a crash before the job queue existed, or by a job
+// that was lost.
+func (q *Queries) ListStrandedVariants(ctx context.Context) ([]models.VideoVariant, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT `+videoVariantColumns+`
+		FROM video_variants v
+		WHERE v.status = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM jobs j
+			WHERE j.file_id = v.file_id
+			  AND j.status IN ('queued', 'running')
+			  AND j.kind = CASE
+				WHEN v.quality LIKE 'thumb-%' THEN 'thumbnail'
+				WHEN v.quality LIKE 'hls/%' THEN 'hls'
+				ELSE 'transcode'
+			  END
+		  )
+	`, models.VideoVariantStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("ListStrandedVariants: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.VideoVariant, 0)
+	for rows.Next() {
+		v, err := scanVideoVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListStrandedVariants scan: %w", err)
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
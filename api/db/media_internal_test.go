@@ -7,9 +7,9 @@ import (
 
 func TestMediaSortOrderClause(t *testing.T) {
 	cases := map[MediaSort]string{
-		MediaSortTakenAt: "COALESCE(f.taken_at, f.created_at) DESC",
-		MediaSortCreated: "f.created_at DESC",
-		MediaSortName:    "f.name ASC",
+		MediaSortTakenAt:   "COALESCE(f.taken_at, f.created_at) DESC",
+		MediaSortCreated:   "f.created_at DESC",
+		MediaSortName:      "f.name ASC",
 		MediaSort("bogus"): "COALESCE(f.taken_at, f.created_at) DESC", // unknown falls back to taken_at
 	}
 	for sort, want := range cases {
@@ -30,3 +30,27 @@ func TestHiddenFilterClause(t *testing.T) {
 		t.Errorf("HiddenOnly = %q", got)
 	}
 }
+
+func TestTimelinePeriodFormat(t *testing.T) {
+	cases := map[TimelineGranularity]string{
+		TimelineYear:                "YYYY",
+		TimelineMonth:               "YYYY-MM",
+		TimelineDay:                 "YYYY-MM-DD",
+		TimelineGranularity("week"): "YYYY-MM", // unknown falls back to month
+	}
+	for g, want := range cases {
+		if got := g.periodFormat(); got != want {
+			t.Errorf("periodFormat(%q) = %q, want %q", g, got, want)
+		}
+	}
+}
+
+func TestBBoxWidth(t *testing.T) {
+	if got := (BBox{West: -10, East: 30}).width(); got != 40 {
+		t.Errorf("width = %v, want 40", got)
+	}
+	// Crossing the antimeridian: 170°E to 170°W spans 20°.
+	if got := (BBox{West: 170, East: -170}).width(); got != 20 {
+		t.Errorf("antimeridian width = %v, want 20", got)
+	}
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+const mediaMetadataColumns = `
+	file_id, user_id, width, height, orientation, camera_make, camera_model, lens_model,
+	latitude, longitude, altitude, duration_ms, video_codec, audio_codec, bitrate, extracted_at`
+
+func scanMediaMetadata(row interface {
+	Scan(...any) error
+}) (*models.MediaMetadata, error) {
+	var m models.MediaMetadata
+	err := row.Scan(&m.FileID, &m.UserID, &m.Width, &m.Height, &m.Orientation, &m.CameraMake, &m.CameraModel, &m.LensModel,
+		&m.Latitude, &m.Longitude, &m.Altitude, &m.DurationMs, &m.VideoCodec, &m.AudioCodec, &m.Bitrate, &m.ExtractedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// UpsertMediaMetadata stores the extracted metadata of m.FileID, replacing
+// any earlier extraction.
+func (q *Queries) UpsertMediaMetadata(ctx context.Context, m *models.MediaMetadata) error {
+	_, err := q.db.ExecContext(ctx, `
+		INSERT INTO media_metadata (
+			file_id, user_id, width, height, orientation, camera_make, camera_model, lens_model,
+			latitude, longitude, altitude, duration_ms, video_codec, audio_codec, bitrate, extracted_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NOW())
+		ON CONFLICT (file_id) DO UPDATE SET
+			width        = EXCLUDED.width,
+			height       = EXCLUDED.height,
+			orientation  = EXCLUDED.orientation,
+			camera_make  = EXCLUDED.camera_make,
+			camera_model = EXCLUDED.camera_model,
+			lens_model   = EXCLUDED.lens_model,
+			latitude     = EXCLUDED.latitude,
+			longitude    = EXCLUDED.longitude,
+			altitude     = EXCLUDED.altitude,
+			duration_ms  = EXCLUDED.duration_ms,
+			video_codec  = EXCLUDED.video_codec,
+			audio_codec  = EXCLUDED.audio_codec,
+			bitrate      = EXCLUDED.bitrate,
+			extracted_at = NOW()
+	`, m.FileID, m.UserID, m.Width, m.Height, m.Orientation, m.CameraMake, m.CameraModel, m.LensModel,
+		m.Latitude, m.Longitude, m.Altitude, m.DurationMs, m.VideoCodec, m.AudioCodec, m.Bitrate)
+	if err != nil {
+		return fmt.Errorf("UpsertMediaMetadata: %w", err)
+	}
+	return nil
+}
+
+// GetMediaMetadata returns the metadata of fileID, or nil if none was
+// extracted. Callers must have checked that the file belongs to the user.
+func (q *Queries) GetMediaMetadata(ctx context.Context, fileID uuid.UUID) (*models.MediaMetadata, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT`+mediaMetadataColumns+` FROM media_metadata WHERE file_id = $1`, fileID)
+	m, err := scanMediaMetadata(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetMediaMetadata: %w", err)
+	}
+	return m, nil
+}
+
+// ClearMediaLocation drops the GPS coordinates of fileID.
+func (q *Queries) ClearMediaLocation(ctx context.Context, fileID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE media_metadata SET latitude = NULL, longitude = NULL, altitude = NULL
+		WHERE file_id = $1
+	`, fileID)
+	if err != nil {
+		return fmt.Errorf("ClearMediaLocation: %w", err)
+	}
+	return nil
+}
+
+// ClearUserMediaLocations drops the GPS coordinates of every file owned by
+// userID. Returns the number of rows that had any.
+func (q *Queries) ClearUserMediaLocations(ctx context.Context, userID uuid.UUID) (int64, error) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE media_metadata SET latitude = NULL, longitude = NULL, altitude = NULL
+		WHERE user_id = $1
+		  AND (latitude IS NOT NULL OR longitude IS NOT NULL OR altitude IS NOT NULL)
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("ClearUserMediaLocations: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ── Media collection timeline ─────────────────────────────────────────────────
+
+// TimelineGranularity selects the bucket size of a media timeline.
+type TimelineGranularity string
+
+const (
+	TimelineYear  TimelineGranularity = "year"
+	TimelineMonth TimelineGranularity = "month"
+	TimelineDay   TimelineGranularity = "day"
+)
+
+// periodFormat maps a granularity to a fixed to_char pattern. The mapping is
+// a closed set (never user-interpolated) so this is injection-safe.
+func (g TimelineGranularity) periodFormat() string {
+	switch g {
+	case TimelineYear:
+		return "YYYY"
+	case TimelineDay:
+		return "YYYY-MM-DD"
+	default: // TimelineMonth
+		return "YYYY-MM"
+	}
+}
+
+// TimelineBucket is the number of items captured in one period.
+type TimelineBucket struct {
+	// Period is "2024", "2024-05" or "2024-05-17" depending on granularity.
+	Period string `json:"period"`
+	Count  int64  `json:"count"`
+}
+
+// MediaTimeline counts the items of a media collection (physical residents
+// plus collection_items pointers, filtered by hidden) per period of their
+// capture date, falling back to upload date. Periods are computed in the
+// IANA time zone tz and returned newest first; empty periods are omitted.
+// Must run inside a ForUser transaction (RLS scopes rows).
+func (q *Queries) MediaTimeline(ctx context.Context, collectionID uuid.UUID, hidden HiddenFilter, g TimelineGranularity, tz string) ([]TimelineBucket, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT to_char(COALESCE(f.taken_at, f.created_at) AT TIME ZONE $2, '`+g.periodFormat()+`') AS period,
+		       COUNT(*)
+		FROM files f
+		WHERE (
+			f.folder_id = $1
+			OR f.id IN (SELECT file_id FROM collection_items WHERE collection_id = $1)
+		)
+		`+hidden.hiddenClause()+`
+		GROUP BY period
+		ORDER BY period DESC
+	`, collectionID, tz)
+	if err != nil {
+		return nil, fmt.Errorf("MediaTimeline: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]TimelineBucket, 0)
+	for rows.Next() {
+		var b TimelineBucket
+		if err := rows.Scan(&b.Period, &b.Count); err != nil {
+			return nil, fmt.Errorf("MediaTimeline scan: %w", err)
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// ── Media collection map ──────────────────────────────────────────────────────
+
+// BBox is a longitude/latitude bounding box in decimal degrees. West > East
+// describes a box crossing the antimeridian.
+type BBox struct {
+	West, South, East, North float64
+}
+
+// width returns the box's longitude span in degrees.
+func (b BBox) width() float64 {
+	if b.West > b.East {
+		return b.East + 360 - b.West
+	}
+	return b.East - b.West
+}
+
+// GeoCluster is a grid cell holding at least one geotagged item.
+type GeoCluster struct {
+	// Latitude and Longitude are the mean position of the items in the cell.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int64   `json:"count"`
+	// FileID is the most recently captured item, for a cover thumbnail (or
+	// the item itself when Count is 1).
+	FileID uuid.UUID `json:"file_id"`
+}
+
+// MediaGeoClusters groups the geotagged items of a media collection inside
+// bbox into a grid×grid grid laid over the box and returns one cluster per
+// non-empty cell, largest first. Items without stored coordinates are left
+// out. Membership and hidden filtering match ListMediaFiles. Must run inside
+// a ForUser transaction (RLS scopes rows).
+func (q *Queries) MediaGeoClusters(ctx context.Context, collectionID uuid.UUID, hidden HiddenFilter, bbox BBox, grid int) ([]GeoCluster, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		WITH box AS (
+			SELECT $2::float8 AS west, $3::float8 AS south, $4::float8 AS east, $5::float8 AS north,
+			       $6::float8 AS cell_w, $7::float8 AS cell_h, $8::int AS grid
+		), items AS (
+			SELECT f.id, COALESCE(f.taken_at, f.created_at) AS captured, m.latitude,
+			       -- Unwrap longitudes east of the antimeridian for boxes crossing it.
+			       CASE WHEN box.west > box.east AND m.longitude < box.west
+			            THEN m.longitude + 360 ELSE m.longitude END AS lon
+			FROM files f
+			JOIN media_metadata m ON m.file_id = f.id
+			CROSS JOIN box
+			WHERE (
+				f.folder_id = $1
+				OR f.id IN (SELECT file_id FROM collection_items WHERE collection_id = $1)
+			)
+			`+hidden.hiddenClause()+`
+			  AND m.latitude BETWEEN box.south AND box.north
+			  AND CASE WHEN box.west <= box.east THEN m.longitude BETWEEN box.west AND box.east
+			           ELSE m.longitude >= box.west OR m.longitude <= box.east END
+		)
+		SELECT AVG(items.latitude), AVG(items.lon), COUNT(*),
+		       (ARRAY_AGG(items.id ORDER BY items.captured DESC))[1]
+		FROM items
+		CROSS JOIN box
+		GROUP BY LEAST(FLOOR((items.lon - box.west) / box.cell_w), box.grid - 1),
+		         LEAST(FLOOR((items.latitude - box.south) / box.cell_h), box.grid - 1)
+		ORDER BY COUNT(*) DESC
+	`, collectionID, bbox.West, bbox.South, bbox.East, bbox.North,
+		bbox.width()/float64(grid), (bbox.North-bbox.South)/float64(grid), grid)
+	if err != nil {
+		return nil, fmt.Errorf("MediaGeoClusters: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]GeoCluster, 0)
+	for rows.Next() {
+		var c GeoCluster
+		if err := rows.Scan(&c.Latitude, &c.Longitude, &c.Count, &c.FileID); err != nil {
+			return nil, fmt.Errorf("MediaGeoClusters scan: %w", err)
+		}
+		if c.Longitude > 180 {
+			c.Longitude -= 360
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -152,3 +152,23 @@ func (q *Queries) ForUser(ctx context.Context, userID uuid.UUID) (*Queries, *sql
 	}
 	return &Queries{db: tx, pool: q.pool}, tx, nil
 }
+
+// Savepoint runs fn inside a savepoint of the transaction behind q. When fn
+// fails its statements are rolled back and its error returned, and the
+// transaction stays usable; without the savepoint a single failed statement
+// would abort everything after it. q must be a Queries returned by ForUser.
+func (q *Queries) Savepoint(ctx context.Context, fn func() error) error {
+	if _, err := q.db.ExecContext(ctx, `SAVEPOINT item`); err != nil {
+		return fmt.Errorf("Savepoint: %w", err)
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := q.db.ExecContext(ctx, `ROLLBACK TO SAVEPOINT item`); rbErr != nil {
+			return fmt.Errorf("Savepoint: roll back after %v: %w", err, rbErr)
+		}
+		return err
+	}
+	if _, err := q.db.ExecContext(ctx, `RELEASE SAVEPOINT item`); err != nil {
+		return fmt.Errorf("Savepoint: release: %w", err)
+	}
+	return nil
+}
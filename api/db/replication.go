@@ -0,0 +1,316 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+// ── Replica allocations ───────────────────────────────────────────────────────
+
+// GetUserReplicaDrive returns the replica allocation for a user with the drive
+// and server details populated. Returns nil if the user has no replica.
+func (q *Queries) GetUserReplicaDrive(ctx context.Context, username string) (*models.UserDriveAllocation, error) {
+	a, err := q.getAllocation(ctx, "user_replica_allocations", username)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserReplicaDrive: %w", err)
+	}
+	return a, nil
+}
+
+// AllocateUserReplica inserts (or replaces on conflict) a user's replica drive.
+func (q *Queries) AllocateUserReplica(ctx context.Context, username string, driveID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, `
+		INSERT INTO user_replica_allocations (user_id, drive_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET drive_id = EXCLUDED.drive_id, allocated_at = NOW()
+	`, username, driveID)
+	if err != nil {
+		return fmt.Errorf("AllocateUserReplica: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserReplica removes a user's replica allocation together with every
+// file_replicas row for that user.
+func (q *Queries) DeleteUserReplica(ctx context.Context, username string) error {
+	if _, err := q.db.ExecContext(ctx, `DELETE FROM file_replicas WHERE username = $1`, username); err != nil {
+		return fmt.Errorf("DeleteUserReplica: %w", err)
+	}
+	if _, err := q.db.ExecContext(ctx, `DELETE FROM user_replica_allocations WHERE user_id = $1`, username); err != nil {
+		return fmt.Errorf("DeleteUserReplica: %w", err)
+	}
+	return nil
+}
+
+// SelectReplicaDrive finds the best-fit active drive for a replica of a user
+// whose primary copy lives on primaryDriveID. Drives on another server are
+// preferred so a whole server can be lost; the primary drive itself is never
+// chosen. Returns ErrNoCapacity if no drive qualifies.
+func (q *Queries) SelectReplicaDrive(ctx context.Context, quotaBytes int64, primaryDriveID uuid.UUID) (*models.Drive, error) {
+	row := q.db.QueryRowContext(ctx, `
+		SELECT`+driveColumns+`
+		FROM drives
+		WHERE id = (
+			SELECT d.id
+			FROM drives d
+			JOIN servers s ON s.id = d.server_id
+			JOIN drives p ON p.id = $2
+			LEFT JOIN drive_allocations da ON da.drive_id = d.id
+			LEFT JOIN users u ON u.username = da.user_id
+			WHERE d.is_active = true AND s.is_active = true AND d.id <> p.id
+			GROUP BY d.id, p.server_id
+			HAVING d.capacity_bytes - COALESCE(SUM(u.storage_quota_bytes), 0) >= $1
+			ORDER BY (d.server_id = p.server_id) ASC,
+			         (d.capacity_bytes - COALESCE(SUM(u.storage_quota_bytes), 0)) ASC
+			LIMIT 1
+		)
+	`, quotaBytes, primaryDriveID)
+	d, err := scanDrive(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoCapacity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SelectReplicaDrive: %w", err)
+	}
+	return d, nil
+}
+
+// ReplicationUser is one row of ListReplicationUsers: a user with a primary
+// allocation, their replication override and their replica drive, if any.
+type ReplicationUser struct {
+	Username   string
+	QuotaBytes int64
+	IsPremium  bool
+	// Factor is users.replication_factor; nil follows the tier default.
+	Factor         *int
+	PrimaryDriveID uuid.UUID
+	ReplicaDriveID *uuid.UUID
+	// ReplicaUsable is false when the replica drive is no longer active
+	// (draining or retired) and the replica must be relocated.
+	ReplicaUsable bool
+}
+
+// ListReplicationUsers returns every user with a drive allocation, ordered by
+// username.
+func (q *Queries) ListReplicationUsers(ctx context.Context) ([]ReplicationUser, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT u.username, u.storage_quota_bytes, u.is_premium, u.replication_factor,
+		       uda.drive_id, ura.drive_id,
+		       COALESCE(rd.state = 'active' AND rd.is_active AND rs.is_active, false)
+		FROM users u
+		JOIN user_drive_allocations uda ON uda.user_id = u.username
+		LEFT JOIN user_replica_allocations ura ON ura.user_id = u.username
+		LEFT JOIN drives rd ON rd.id = ura.drive_id
+		LEFT JOIN servers rs ON rs.id = rd.server_id
+		ORDER BY u.username ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ListReplicationUsers: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]ReplicationUser, 0)
+	for rows.Next() {
+		var (
+			ru     ReplicationUser
+			factor sql.NullInt64
+		)
+		if err := rows.Scan(&ru.Username, &ru.QuotaBytes, &ru.IsPremium, &factor,
+			&ru.PrimaryDriveID, &ru.ReplicaDriveID, &ru.ReplicaUsable); err != nil {
+			return nil, fmt.Errorf("ListReplicationUsers scan: %w", err)
+		}
+		if factor.Valid {
+			f := int(factor.Int64)
+			ru.Factor = &f
+		}
+		out = append(out, ru)
+	}
+	return out, rows.Err()
+}
+
+// SetUserReplicationFactor sets or (with nil) clears a user's replication
+// override. Returns sql.ErrNoRows if the user does not exist.
+func (q *Queries) SetUserReplicationFactor(ctx context.Context, username string, factor *int) error {
+	res, err := q.db.ExecContext(ctx,
+		`UPDATE users SET replication_factor = $2 WHERE username = $1`, username, factor)
+	if err != nil {
+		return fmt.Errorf("SetUserReplicationFactor: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("SetUserReplicationFactor: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ── File replicas ─────────────────────────────────────────────────────────────
+
+const fileReplicaColumns = `
+	minio_object_key, file_id, username, drive_id, status, error, updated_at`
+
+func scanFileReplica(row interface {
+	Scan(...any) error
+}) (*models.FileReplica, error) {
+	var r models.FileReplica
+	err := row.Scan(&r.MinIOObjectKey, &r.FileID, &r.Username, &r.DriveID, &r.Status, &r.Error, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// UpsertFileReplica records the state of the replica of one object, replacing
+// any earlier row for the same key.
+func (q *Queries) UpsertFileReplica(ctx context.Context, r *models.FileReplica) error {
+	_, err := q.db.ExecContext(ctx, `
+		INSERT INTO file_replicas (minio_object_key, file_id, username, drive_id, status, error, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (minio_object_key) DO UPDATE
+		SET drive_id   = EXCLUDED.drive_id,
+		    status     = EXCLUDED.status,
+		    error      = EXCLUDED.error,
+		    updated_at = EXCLUDED.updated_at
+	`, r.MinIOObjectKey, r.FileID, r.Username, r.DriveID, r.Status, r.Error)
+	if err != nil {
+		return fmt.Errorf("UpsertFileReplica %s: %w", r.MinIOObjectKey, err)
+	}
+	return nil
+}
+
+// GetFileReplica returns the replica row for an object key, or nil if the
+// object has no replica.
+func (q *Queries) GetFileReplica(ctx context.Context, objectKey string) (*models.FileReplica, error) {
+	row := q.db.QueryRowContext(ctx, `
+		SELECT`+fileReplicaColumns+`
+		FROM file_replicas WHERE minio_object_key = $1
+	`, objectKey)
+	r, err := scanFileReplica(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetFileReplica: %w", err)
+	}
+	return r, nil
+}
+
+// ListUserReplicas returns every replica row for username.
+func (q *Queries) ListUserReplicas(ctx context.Context, username string) ([]models.FileReplica, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+fileReplicaColumns+`
+		FROM file_replicas WHERE username = $1
+		ORDER BY minio_object_key ASC
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("ListUserReplicas: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.FileReplica, 0)
+	for rows.Next() {
+		r, err := scanFileReplica(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListUserReplicas scan: %w", err)
+		}
+		out = append(out, *r)
+	}
+	return out, rows.Err()
+}
+
+// ListDriveReplicaKeys returns the object key of every replica row on driveID.
+func (q *Queries) ListDriveReplicaKeys(ctx context.Context, driveID uuid.UUID) (map[string]struct{}, error) {
+	rows, err := q.db.QueryContext(ctx,
+		`SELECT minio_object_key FROM file_replicas WHERE drive_id = $1`, driveID)
+	if err != nil {
+		return nil, fmt.Errorf("ListDriveReplicaKeys: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]struct{})
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("ListDriveReplicaKeys scan: %w", err)
+		}
+		out[key] = struct{}{}
+	}
+	return out, rows.Err()
+}
+
+// DeleteFileReplica removes the replica row for an object key.
+func (q *Queries) DeleteFileReplica(ctx context.Context, objectKey string) error {
+	if _, err := q.db.ExecContext(ctx, `DELETE FROM file_replicas WHERE minio_object_key = $1`, objectKey); err != nil {
+		return fmt.Errorf("DeleteFileReplica: %w", err)
+	}
+	return nil
+}
+
+// MoveUserReplicas points every replica row of username at driveID and marks
+// them pending, after the user's replica has been reallocated.
+func (q *Queries) MoveUserReplicas(ctx context.Context, username string, driveID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE file_replicas
+		SET drive_id = $2, status = 'pending', error = NULL, updated_at = NOW()
+		WHERE username = $1
+	`, username, driveID)
+	if err != nil {
+		return fmt.Errorf("MoveUserReplicas: %w", err)
+	}
+	return nil
+}
+
+// MarkDriveReplaced records that driveID has been swapped for an empty disk.
+// Replicas stored on it become pending; replicas of users whose primary copy
+// was on it become restoring so the primary is rebuilt from them. Returns the
+// number of rows moved to each state.
+func (q *Queries) MarkDriveReplaced(ctx context.Context, driveID uuid.UUID) (pending, restoring int64, err error) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE file_replicas
+		SET status = 'pending', error = NULL, updated_at = NOW()
+		WHERE drive_id = $1
+	`, driveID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("MarkDriveReplaced: %w", err)
+	}
+	pending, _ = res.RowsAffected()
+
+	res, err = q.db.ExecContext(ctx, `
+		UPDATE file_replicas fr
+		SET status = 'restoring', error = NULL, updated_at = NOW()
+		FROM user_drive_allocations uda
+		WHERE uda.user_id = fr.username AND uda.drive_id = $1 AND fr.status = 'ok'
+	`, driveID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("MarkDriveReplaced: %w", err)
+	}
+	restoring, _ = res.RowsAffected()
+	return pending, restoring, nil
+}
+
+// GetReplicaSummary returns the number of replica rows in each status.
+func (q *Queries) GetReplicaSummary(ctx context.Context) ([]models.ReplicaStatusCount, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT status, COUNT(*)
+		FROM file_replicas
+		GROUP BY status
+		ORDER BY status ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("GetReplicaSummary: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.ReplicaStatusCount, 0)
+	for rows.Next() {
+		var c models.ReplicaStatusCount
+		if err := rows.Scan(&c.Status, &c.Count); err != nil {
+			return nil, fmt.Errorf("GetReplicaSummary scan: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
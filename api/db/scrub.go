@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+const scrubResultColumns = `
+	id, file_id, variant_id, username, minio_object_key, status,
+	expected_bytes, actual_bytes, detail, checked_at`
+
+func scanScrubResult(row interface {
+	Scan(...any) error
+}) (*models.ScrubResult, error) {
+	var r models.ScrubResult
+	err := row.Scan(&r.ID, &r.FileID, &r.VariantID, &r.Username, &r.MinIOObjectKey, &r.Status,
+		&r.ExpectedBytes, &r.ActualBytes, &r.Detail, &r.CheckedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// UpsertScrubResult records the outcome of one object check, replacing any
+// earlier result for the same object key. scrub_results has no RLS, so this
+// runs on the pool from the background scrubber.
+func (q *Queries) UpsertScrubResult(ctx context.Context, r *models.ScrubResult) error {
+	_, err := q.db.ExecContext(ctx, `
+		INSERT INTO scrub_results
+			(file_id, variant_id, username, minio_object_key, status, expected_bytes, actual_bytes, detail, checked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		ON CONFLICT (minio_object_key) DO UPDATE
+		SET status         = EXCLUDED.status,
+		    expected_bytes = EXCLUDED.expected_bytes,
+		    actual_bytes   = EXCLUDED.actual_bytes,
+		    detail         = EXCLUDED.detail,
+		    checked_at     = EXCLUDED.checked_at
+	`, r.FileID, r.VariantID, r.Username, r.MinIOObjectKey, r.Status, r.ExpectedBytes, r.ActualBytes, r.Detail)
+	if err != nil {
+		return fmt.Errorf("UpsertScrubResult %s: %w", r.MinIOObjectKey, err)
+	}
+	return nil
+}
+
+// ListScrubResults returns a page of scrub results, most recently checked first.
+// An empty status returns every non-ok result (the admin "problems" view);
+// otherwise only rows with exactly that status are returned.
+func (q *Queries) ListScrubResults(ctx context.Context, status string, in PageInput) (*PageResult[models.ScrubResult], error) {
+	limit := clampLimit(in.Limit)
+	offset, err := decodeOffsetCursor(in.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("ListScrubResults: %w", err)
+	}
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+scrubResultColumns+`
+		FROM scrub_results
+		WHERE ($1 = '' AND status <> 'ok') OR status = $1
+		ORDER BY checked_at DESC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ListScrubResults: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]models.ScrubResult, 0)
+	for rows.Next() {
+		r, err := scanScrubResult(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListScrubResults scan: %w", err)
+		}
+		results = append(results, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListScrubResults: %w", err)
+	}
+	return &PageResult[models.ScrubResult]{
+		Items:     results,
+		NextToken: offsetNextToken(len(results), limit, offset),
+	}, nil
+}
+
+// GetScrubSummary returns the number of objects in each scrub status together
+// with the most recent check time for that status.
+func (q *Queries) GetScrubSummary(ctx context.Context) ([]models.ScrubStatusCount, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT status, COUNT(*), MAX(checked_at)
+		FROM scrub_results
+		GROUP BY status
+		ORDER BY status ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("GetScrubSummary: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.ScrubStatusCount, 0)
+	for rows.Next() {
+		var c models.ScrubStatusCount
+		if err := rows.Scan(&c.Status, &c.Count, &c.LastCheckedAt); err != nil {
+			return nil, fmt.Errorf("GetScrubSummary scan: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ── Passes ────────────────────────────────────────────────────────────────────
+
+// StartScrubPass records the start of a scrub pass and returns its ID.
+func (q *Queries) StartScrubPass(ctx context.Context) (uuid.UUID, error) {
+	var id uuid.UUID
+	if err := q.db.QueryRowContext(ctx, `INSERT INTO scrub_passes DEFAULT VALUES RETURNING id`).Scan(&id); err != nil {
+		return uuid.Nil, fmt.Errorf("StartScrubPass: %w", err)
+	}
+	return id, nil
+}
+
+// FinishScrubPass marks pass id finished. errMsg is nil for a clean pass.
+func (q *Queries) FinishScrubPass(ctx context.Context, id uuid.UUID, errMsg *string) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE scrub_passes SET finished_at = NOW(), error = $2 WHERE id = $1
+	`, id, errMsg)
+	if err != nil {
+		return fmt.Errorf("FinishScrubPass %s: %w", id, err)
+	}
+	return nil
+}
+
+// LastFinishedScrubPass returns the start and finish times of the most
+// recently finished scrub pass, or zero times if none has finished.
+func (q *Queries) LastFinishedScrubPass(ctx context.Context) (started, finished time.Time, err error) {
+	err = q.db.QueryRowContext(ctx, `
+		SELECT started_at, finished_at
+		FROM scrub_passes
+		WHERE finished_at IS NOT NULL
+		ORDER BY finished_at DESC
+		LIMIT 1
+	`).Scan(&started, &finished)
+	if err == sql.ErrNoRows {
+		return time.Time{}, time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("LastFinishedScrubPass: %w", err)
+	}
+	return started, finished, nil
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileCategory is a coarse grouping of MIME types for search filters.
+type FileCategory string
+
+const (
+	CategoryImage    FileCategory = "image"
+	CategoryVideo    FileCategory = "video"
+	CategoryDocument FileCategory = "document"
+	CategoryArchive  FileCategory = "archive"
+)
+
+// Valid reports whether c is one of the known categories.
+func (c FileCategory) Valid() bool {
+	switch c {
+	case CategoryImage, CategoryVideo, CategoryDocument, CategoryArchive:
+		return true
+	}
+	return false
+}
+
+// mimeClause maps a category to a condition on the mime_type column col.
+// The mapping is a closed set (never user-interpolated) so this is
+// injection-safe.
+func (c FileCategory) mimeClause(col string) string {
+	switch c {
+	case CategoryImage:
+		return col + ` LIKE 'image/%'`
+	case CategoryVideo:
+		return col + ` LIKE 'video/%'`
+	case CategoryDocument:
+		return `(` + col + ` LIKE 'text/%' OR ` + col + ` = ANY('{
+			application/pdf,
+			application/rtf,
+			application/epub+zip,
+			application/msword,
+			application/vnd.ms-excel,
+			application/vnd.ms-powerpoint,
+			application/vnd.openxmlformats-officedocument.wordprocessingml.document,
+			application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,
+			application/vnd.openxmlformats-officedocument.presentationml.presentation,
+			application/vnd.oasis.opendocument.text,
+			application/vnd.oasis.opendocument.spreadsheet,
+			application/vnd.oasis.opendocument.presentation
+		}'::text[]))`
+	case CategoryArchive:
+		return col + ` = ANY('{
+			application/zip,
+			application/x-tar,
+			application/gzip,
+			application/x-gzip,
+			application/x-bzip2,
+			application/x-xz,
+			application/zstd,
+			application/x-7z-compressed,
+			application/vnd.rar,
+			application/x-rar-compressed
+		}'::text[])`
+	}
+	return "TRUE"
+}
+
+// TimeRange bounds a timestamp: After is inclusive, Before exclusive. A nil
+// bound is open.
+type TimeRange struct {
+	After  *time.Time
+	Before *time.Time
+}
+
+func (r TimeRange) isZero() bool { return r.After == nil && r.Before == nil }
+
+// SearchFilter narrows a search. Every set field must match (AND); the zero
+// value matches everything.
+type SearchFilter struct {
+	Category FileCategory
+	// MinSize and MaxSize bound size_bytes, both inclusive.
+	MinSize *int64
+	MaxSize *int64
+	Created TimeRange
+	Updated TimeRange
+	Taken   TimeRange
+	// FolderID limits results to the direct children of a folder, or with
+	// Recursive to everything beneath it.
+	FolderID  *uuid.UUID
+	Recursive bool
+	Favorites bool
+	Hidden    bool
+	// Tag matches files carrying the (lower-cased) tag.
+	Tag string
+}
+
+// IsZero reports whether the filter matches everything.
+func (f SearchFilter) IsZero() bool {
+	return f.Category == "" && f.MinSize == nil && f.MaxSize == nil &&
+		f.Created.isZero() && f.Updated.isZero() && f.Taken.isZero() &&
+		f.FolderID == nil && !f.Favorites && !f.Hidden && f.Tag == ""
+}
+
+// FilesOnly reports whether the filter uses a criterion only files have
+// (type, size, capture date, hidden or tag), so that no folder can match.
+func (f SearchFilter) FilesOnly() bool {
+	return f.Category != "" || f.MinSize != nil || f.MaxSize != nil ||
+		!f.Taken.isZero() || f.Hidden || f.Tag != ""
+}
+
+// sqlWhere accumulates AND-ed conditions and their positional arguments.
+type sqlWhere struct {
+	conds []string
+	args  []any
+}
+
+// arg appends v to the arguments and returns its placeholder.
+func (w *sqlWhere) arg(v any) string {
+	w.args = append(w.args, v)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *sqlWhere) and(cond string) { w.conds = append(w.conds, cond) }
+
+func (w *sqlWhere) String() string { return strings.Join(w.conds, " AND ") }
+
+func (w *sqlWhere) timeRange(col string, r TimeRange) {
+	if r.After != nil {
+		w.and(col + " >= " + w.arg(*r.After))
+	}
+	if r.Before != nil {
+		w.and(col + " < " + w.arg(*r.Before))
+	}
+}
+
+// descendantsSQL selects the ids of a folder and every folder beneath it.
+func descendantsSQL(folderArg string) string {
+	return `(
+		WITH RECURSIVE d(id) AS (
+			SELECT ` + folderArg + `::uuid
+			UNION ALL
+			SELECT cf.id FROM folders cf JOIN d ON cf.parent_id = d.id
+		)
+		SELECT id FROM d
+	)`
+}
+
+// fileConditions adds the filter's conditions on the files table, aliased
+// as t. userArg is the placeholder of the owner's id.
+func (f SearchFilter) fileConditions(w *sqlWhere, t, userArg string) {
+	if f.Category != "" {
+		w.and(f.Category.mimeClause(t + ".mime_type"))
+	}
+	if f.MinSize != nil {
+		w.and(t + ".size_bytes >= " + w.arg(*f.MinSize))
+	}
+	if f.MaxSize != nil {
+		w.and(t + ".size_bytes <= " + w.arg(*f.MaxSize))
+	}
+	w.timeRange(t+".created_at", f.Created)
+	w.timeRange(t+".updated_at", f.Updated)
+	w.timeRange(t+".taken_at", f.Taken)
+	if f.FolderID != nil {
+		if f.Recursive {
+			w.and(t + ".folder_id IN " + descendantsSQL(w.arg(*f.FolderID)))
+		} else {
+			w.and(t + ".folder_id = " + w.arg(*f.FolderID))
+		}
+	}
+	if f.Favorites {
+		w.and(`EXISTS (SELECT 1 FROM favorites fav WHERE fav.user_id = ` + userArg + ` AND fav.file_id = ` + t + `.id)`)
+	}
+	if f.Hidden {
+		w.and(t + ".hidden")
+	}
+	if f.Tag != "" {
+		w.and(w.arg(f.Tag) + " = ANY(" + t + ".tags)")
+	}
+}
+
+// folderConditions adds the filter's conditions on the folders table,
+// aliased as t. Criteria folders lack are ignored; see FilesOnly.
+func (f SearchFilter) folderConditions(w *sqlWhere, t, userArg string) {
+	w.timeRange(t+".created_at", f.Created)
+	w.timeRange(t+".updated_at", f.Updated)
+	if f.FolderID != nil {
+		folderArg := w.arg(*f.FolderID)
+		if f.Recursive {
+			w.and(t + ".id IN " + descendantsSQL(folderArg) + " AND " + t + ".id <> " + folderArg)
+		} else {
+			w.and(t + ".parent_id = " + folderArg)
+		}
+	}
+	if f.Favorites {
+		w.and(`EXISTS (SELECT 1 FROM favorites fav WHERE fav.user_id = ` + userArg + ` AND fav.folder_id = ` + t + `.id)`)
+	}
+}
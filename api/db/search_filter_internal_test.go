@@ -0,0 +1,83 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSearchFilterFileConditions(t *testing.T) {
+	size := int64(1024)
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	folderID := uuid.New()
+	f := SearchFilter{
+		Category:  CategoryArchive,
+		MinSize:   &size,
+		Taken:     TimeRange{After: &after},
+		FolderID:  &folderID,
+		Recursive: true,
+		Favorites: true,
+		Hidden:    true,
+		Tag:       "holiday",
+	}
+
+	w := sqlWhere{args: []any{uuid.New()}}
+	f.fileConditions(&w, "files", "$1")
+	got := w.String()
+
+	for _, want := range []string{
+		"files.mime_type = ANY(",
+		"files.size_bytes >= $2",
+		"files.taken_at >= $3",
+		"files.folder_id IN (",
+		"SELECT $4::uuid",
+		"fav.user_id = $1 AND fav.file_id = files.id",
+		"files.hidden",
+		"$5 = ANY(files.tags)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("conditions %q lack %q", got, want)
+		}
+	}
+	if len(w.args) != 5 || w.args[4] != "holiday" {
+		t.Errorf("args = %v", w.args)
+	}
+	if strings.Count(got, " AND ") < 7 {
+		t.Errorf("conditions are not AND-ed: %q", got)
+	}
+}
+
+func TestSearchFilterFolderConditions(t *testing.T) {
+	folderID := uuid.New()
+	w := sqlWhere{args: []any{uuid.New()}}
+	SearchFilter{FolderID: &folderID}.folderConditions(&w, "f", "$1")
+	if got := w.String(); got != "f.parent_id = $2" {
+		t.Errorf("direct scope = %q", got)
+	}
+
+	w = sqlWhere{args: []any{uuid.New()}}
+	SearchFilter{FolderID: &folderID, Recursive: true, Favorites: true}.folderConditions(&w, "f", "$1")
+	got := w.String()
+	if !strings.Contains(got, "f.id <> $2") || !strings.Contains(got, "fav.folder_id = f.id") {
+		t.Errorf("recursive scope = %q", got)
+	}
+}
+
+func TestSearchFilterKinds(t *testing.T) {
+	if !(SearchFilter{}).IsZero() {
+		t.Error("zero filter should be zero")
+	}
+	if (SearchFilter{Favorites: true}).FilesOnly() {
+		t.Error("favorites applies to folders too")
+	}
+	for _, f := range []SearchFilter{{Category: CategoryImage}, {Hidden: true}, {Tag: "x"}} {
+		if f.IsZero() || !f.FilesOnly() {
+			t.Errorf("%+v should be a files-only filter", f)
+		}
+	}
+	if FileCategory("audio").Valid() || !CategoryDocument.Valid() {
+		t.Error("unexpected category validity")
+	}
+}
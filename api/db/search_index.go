@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"apollo-sfs.com/api/models"
+)
+
+// SearchDocument is the encrypted extracted text of one file together with
+// its blind-index terms (hashed word → occurrences).
+type SearchDocument struct {
+	FileID         uuid.UUID
+	UserID         uuid.UUID
+	DocLength      int
+	TextCiphertext []byte
+	TextNonce      []byte
+	Terms          map[int64]int
+}
+
+// ContentMatch is a file whose contents matched a search, with its BM25
+// score and encrypted text for cutting a snippet.
+type ContentMatch struct {
+	File           models.File
+	Score          float64
+	TextCiphertext []byte
+	TextNonce      []byte
+}
+
+// ReplaceSearchDocument stores doc, replacing any earlier index of the file.
+// Called from a background job outside the user-scoped transaction, like
+// SetFileTakenAt; the index tables carry user_id and are not under RLS.
+func (q *Queries) ReplaceSearchDocument(ctx context.Context, doc *SearchDocument) error {
+	tx, err := q.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ReplaceSearchDocument: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Deleting the document cascades to its terms.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM search_documents WHERE file_id = $1`, doc.FileID); err != nil {
+		return fmt.Errorf("ReplaceSearchDocument: delete: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO search_documents (file_id, user_id, doc_length, text_ciphertext, text_nonce)
+		VALUES ($1, $2, $3, $4, $5)
+	`, doc.FileID, doc.UserID, doc.DocLength, doc.TextCiphertext, doc.TextNonce); err != nil {
+		return fmt.Errorf("ReplaceSearchDocument: insert document: %w", err)
+	}
+
+	terms := make([]int64, 0, len(doc.Terms))
+	freqs := make([]int64, 0, len(doc.Terms))
+	for term, tf := range doc.Terms {
+		terms = append(terms, term)
+		freqs = append(freqs, int64(tf))
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO search_terms (file_id, user_id, term, tf)
+		SELECT $1, $2, t.term, t.tf
+		FROM unnest($3::bigint[], $4::int[]) AS t (term, tf)
+	`, doc.FileID, doc.UserID, pq.Array(terms), pq.Array(freqs)); err != nil {
+		return fmt.Errorf("ReplaceSearchDocument: insert terms: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SearchFileContents returns a page of userID's files that match filter and
+// contain every one of terms (hashed query words), best BM25 score first.
+// Must run inside a ForUser transaction (RLS scopes the files).
+func (q *Queries) SearchFileContents(ctx context.Context, userID uuid.UUID, terms []int64, filter SearchFilter, in PageInput) (*PageResult[ContentMatch], error) {
+	limit := clampLimit(in.Limit)
+	offset, err := decodeOffsetCursor(in.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("SearchFileContents: %w", err)
+	}
+
+	w := sqlWhere{args: []any{userID, pq.Array(terms), len(terms)}}
+	filter.fileConditions(&w, "files", "$1")
+	where := ""
+	if len(w.conds) > 0 {
+		where = "WHERE " + w.String()
+	}
+
+	// BM25 with k1 = 1.2, b = 0.75 over the user's own documents.
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+fileColumns+`, s.score,
+		       (SELECT text_ciphertext FROM search_documents WHERE file_id = files.id),
+		       (SELECT text_nonce FROM search_documents WHERE file_id = files.id)
+		FROM files
+		JOIN (
+			SELECT t.file_id,
+			       SUM(LN(1 + (st.n - df.df + 0.5) / (df.df + 0.5))
+			           * t.tf * 2.2 / (t.tf + 1.2 * (0.25 + 0.75 * d.doc_length / st.avgdl))) AS score
+			FROM search_terms t
+			JOIN search_documents d ON d.file_id = t.file_id
+			JOIN (
+				SELECT term, COUNT(*)::float8 AS df
+				FROM search_terms
+				WHERE user_id = $1 AND term = ANY($2::bigint[])
+				GROUP BY term
+			) df ON df.term = t.term
+			CROSS JOIN (
+				SELECT COUNT(*)::float8 AS n, GREATEST(AVG(doc_length), 1)::float8 AS avgdl
+				FROM search_documents
+				WHERE user_id = $1
+			) st
+			WHERE t.user_id = $1 AND t.term = ANY($2::bigint[])
+			GROUP BY t.file_id
+			HAVING COUNT(*) = $3
+		) s ON s.file_id = files.id
+		`+where+`
+		ORDER BY s.score DESC, files.name ASC
+		LIMIT `+w.arg(limit)+` OFFSET `+w.arg(offset),
+		w.args...)
+	if err != nil {
+		return nil, fmt.Errorf("SearchFileContents: %w", err)
+	}
+	defer rows.Close()
+
+	matches := make([]ContentMatch, 0)
+	for rows.Next() {
+		var m ContentMatch
+		f, err := scanFileRow(rows, &m.Score, &m.TextCiphertext, &m.TextNonce)
+		if err != nil {
+			return nil, fmt.Errorf("SearchFileContents scan: %w", err)
+		}
+		m.File = *f
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SearchFileContents: %w", err)
+	}
+	return &PageResult[ContentMatch]{
+		Items:     matches,
+		NextToken: offsetNextToken(len(matches), limit, offset),
+	}, nil
+}
+
+// ListUnindexedFiles returns userID's files that have no search document,
+// for backfilling the index. Must run inside a ForUser transaction (RLS
+// scopes the files).
+func (q *Queries) ListUnindexedFiles(ctx context.Context, userID uuid.UUID) ([]models.File, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+fileColumns+`
+		FROM files
+		WHERE user_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM search_documents d WHERE d.file_id = files.id)
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ListUnindexedFiles: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.File, 0)
+	for rows.Next() {
+		f, err := scanFileRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListUnindexedFiles scan: %w", err)
+		}
+		out = append(out, *f)
+	}
+	return out, rows.Err()
+}
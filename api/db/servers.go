@@ -11,7 +11,7 @@ import (
 )
 
 const serverColumns = `
-	id, name, state, minio_endpoint, minio_use_ssl,
+	id, name, state, backend, region, minio_endpoint, minio_use_ssl,
 	minio_access_key_enc, minio_access_key_nonce,
 	minio_secret_key_enc, minio_secret_key_nonce,
 	is_active, created_at`
@@ -19,7 +19,7 @@ const serverColumns = `
 func scanServer(row *sql.Row) (*models.Server, error) {
 	var s models.Server
 	err := row.Scan(
-		&s.ID, &s.Name, &s.State, &s.MinioEndpoint, &s.MinioUseSSL,
+		&s.ID, &s.Name, &s.State, &s.Backend, &s.Region, &s.MinioEndpoint, &s.MinioUseSSL,
 		&s.MinioAccessKeyEnc, &s.MinioAccessKeyNonce,
 		&s.MinioSecretKeyEnc, &s.MinioSecretKeyNonce,
 		&s.IsActive, &s.CreatedAt,
@@ -33,7 +33,7 @@ func scanServer(row *sql.Row) (*models.Server, error) {
 func scanServerRow(rows *sql.Rows) (*models.Server, error) {
 	var s models.Server
 	err := rows.Scan(
-		&s.ID, &s.Name, &s.State, &s.MinioEndpoint, &s.MinioUseSSL,
+		&s.ID, &s.Name, &s.State, &s.Backend, &s.Region, &s.MinioEndpoint, &s.MinioUseSSL,
 		&s.MinioAccessKeyEnc, &s.MinioAccessKeyNonce,
 		&s.MinioSecretKeyEnc, &s.MinioSecretKeyNonce,
 		&s.IsActive, &s.CreatedAt,
@@ -100,6 +100,8 @@ func (q *Queries) CountServersByState(ctx context.Context, state string) (int, e
 type CreateServerParams struct {
 	Name                string
 	State               string
+	Backend             string // models.ServerBackend*; "" means minio
+	Region              string
 	MinioEndpoint       string
 	MinioUseSSL         bool
 	MinioAccessKeyEnc   []byte
@@ -112,12 +114,12 @@ type CreateServerParams struct {
 func (q *Queries) CreateServer(ctx context.Context, p CreateServerParams) (*models.Server, error) {
 	row := q.db.QueryRowContext(ctx, `
 		INSERT INTO servers
-			(name, state, minio_endpoint, minio_use_ssl,
+			(name, state, backend, region, minio_endpoint, minio_use_ssl,
 			 minio_access_key_enc, minio_access_key_nonce,
 			 minio_secret_key_enc, minio_secret_key_nonce)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'minio'), $4, $5, $6, $7, $8, $9, $10)
 		RETURNING`+serverColumns,
-		p.Name, p.State, p.MinioEndpoint, p.MinioUseSSL,
+		p.Name, p.State, p.Backend, p.Region, p.MinioEndpoint, p.MinioUseSSL,
 		p.MinioAccessKeyEnc, p.MinioAccessKeyNonce,
 		p.MinioSecretKeyEnc, p.MinioSecretKeyNonce,
 	)
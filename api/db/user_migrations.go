@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+const userMigrationColumns = `
+	id, username, source_drive_id, target_drive_id, status,
+	total_objects, copied_objects, total_bytes, copied_bytes,
+	error, started_by, created_at, updated_at, finished_at`
+
+func scanUserMigration(row interface {
+	Scan(...any) error
+}) (*models.UserMigration, error) {
+	var m models.UserMigration
+	err := row.Scan(&m.ID, &m.Username, &m.SourceDriveID, &m.TargetDriveID, &m.Status,
+		&m.TotalObjects, &m.CopiedObjects, &m.TotalBytes, &m.CopiedBytes,
+		&m.Error, &m.StartedBy, &m.CreatedAt, &m.UpdatedAt, &m.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// CreateUserMigration inserts a pending migration. Fails on the
+// user_migrations_one_active_idx unique index if the user already has an
+// unfinished migration.
+func (q *Queries) CreateUserMigration(ctx context.Context, username string, sourceDriveID, targetDriveID uuid.UUID, startedBy string) (*models.UserMigration, error) {
+	row := q.db.QueryRowContext(ctx, `
+		INSERT INTO user_migrations (username, source_drive_id, target_drive_id, started_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING`+userMigrationColumns,
+		username, sourceDriveID, targetDriveID, startedBy,
+	)
+	m, err := scanUserMigration(row)
+	if err != nil {
+		return nil, fmt.Errorf("CreateUserMigration: %w", err)
+	}
+	return m, nil
+}
+
+// GetLatestUserMigration returns the most recent migration for username, or
+// nil if the user has never been migrated.
+func (q *Queries) GetLatestUserMigration(ctx context.Context, username string) (*models.UserMigration, error) {
+	row := q.db.QueryRowContext(ctx, `
+		SELECT`+userMigrationColumns+`
+		FROM user_migrations
+		WHERE username = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, username)
+	m, err := scanUserMigration(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetLatestUserMigration: %w", err)
+	}
+	return m, nil
+}
+
+// ListUnfinishedUserMigrations returns every migration that is pending,
+// copying or cleaning. Used at startup to resume work interrupted by a restart.
+func (q *Queries) ListUnfinishedUserMigrations(ctx context.Context) ([]models.UserMigration, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+userMigrationColumns+`
+		FROM user_migrations
+		WHERE status IN ($1, $2, $3)
+		ORDER BY created_at ASC
+	`, models.UserMigrationPending, models.UserMigrationCopying, models.UserMigrationCleaning)
+	if err != nil {
+		return nil, fmt.Errorf("ListUnfinishedUserMigrations: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.UserMigration, 0)
+	for rows.Next() {
+		m, err := scanUserMigration(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListUnfinishedUserMigrations scan: %w", err)
+		}
+		out = append(out, *m)
+	}
+	return out, rows.Err()
+}
+
+// SetUserMigrationStatus moves a migration to status and records errMsg
+// (nil clears it). finished_at is stamped for 'done' and 'failed' and cleared
+// otherwise, so a resumed migration no longer looks finished.
+func (q *Queries) SetUserMigrationStatus(ctx context.Context, id uuid.UUID, status string, errMsg *string) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE user_migrations
+		SET status      = $2,
+		    error       = $3,
+		    updated_at  = NOW(),
+		    finished_at = CASE WHEN $2 IN ('done', 'failed') THEN NOW() ELSE NULL END
+		WHERE id = $1
+	`, id, status, errMsg)
+	if err != nil {
+		return fmt.Errorf("SetUserMigrationStatus: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserMigrationProgress records the copy counters shown in the admin UI.
+func (q *Queries) UpdateUserMigrationProgress(ctx context.Context, id uuid.UUID, totalObjects, copiedObjects int, totalBytes, copiedBytes int64) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE user_migrations
+		SET total_objects  = $2,
+		    copied_objects = $3,
+		    total_bytes    = $4,
+		    copied_bytes   = $5,
+		    updated_at     = NOW()
+		WHERE id = $1
+	`, id, totalObjects, copiedObjects, totalBytes, copiedBytes)
+	if err != nil {
+		return fmt.Errorf("UpdateUserMigrationProgress: %w", err)
+	}
+	return nil
+}
+
+// ListMigrationsFromDrive returns migrations off driveID created at or after
+// since, newest first. Used to report drain progress.
+func (q *Queries) ListMigrationsFromDrive(ctx context.Context, driveID uuid.UUID, since time.Time) ([]models.UserMigration, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+userMigrationColumns+`
+		FROM user_migrations
+		WHERE source_drive_id = $1 AND created_at >= $2
+		ORDER BY created_at DESC
+	`, driveID, since)
+	if err != nil {
+		return nil, fmt.Errorf("ListMigrationsFromDrive: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.UserMigration, 0)
+	for rows.Next() {
+		m, err := scanUserMigration(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListMigrationsFromDrive scan: %w", err)
+		}
+		out = append(out, *m)
+	}
+	return out, rows.Err()
+}
@@ -18,11 +18,11 @@ func (q *Queries) GetUserPreferences(ctx context.Context, userID string) (*model
 	var p models.UserPreferences
 	var folderID uuid.NullUUID
 	err := q.db.QueryRowContext(ctx, `
-		SELECT user_id, media_autoupload_folder_id, created_at, updated_at
+		SELECT user_id, media_autoupload_folder_id, record_location, created_at, updated_at
 		FROM user_preferences WHERE user_id = $1
-	`, userID).Scan(&p.UserID, &folderID, &p.CreatedAt, &p.UpdatedAt)
+	`, userID).Scan(&p.UserID, &folderID, &p.RecordLocation, &p.CreatedAt, &p.UpdatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
-		return &models.UserPreferences{UserID: userID}, nil
+		return &models.UserPreferences{UserID: userID, RecordLocation: true}, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("GetUserPreferences: %w", err)
@@ -48,8 +48,8 @@ func (q *Queries) SetMediaAutouploadFolder(ctx context.Context, userID string, f
 		ON CONFLICT (user_id) DO UPDATE
 			SET media_autoupload_folder_id = EXCLUDED.media_autoupload_folder_id,
 			    updated_at = NOW()
-		RETURNING user_id, media_autoupload_folder_id, created_at, updated_at
-	`, userID, nf).Scan(&p.UserID, &out, &p.CreatedAt, &p.UpdatedAt)
+		RETURNING user_id, media_autoupload_folder_id, record_location, created_at, updated_at
+	`, userID, nf).Scan(&p.UserID, &out, &p.RecordLocation, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("SetMediaAutouploadFolder: %w", err)
 	}
@@ -58,3 +58,25 @@ func (q *Queries) SetMediaAutouploadFolder(ctx context.Context, userID string, f
 	}
 	return &p, nil
 }
+
+// SetRecordLocation upserts whether GPS coordinates of the user's uploads are
+// kept.
+func (q *Queries) SetRecordLocation(ctx context.Context, userID string, record bool) (*models.UserPreferences, error) {
+	var p models.UserPreferences
+	var folderID uuid.NullUUID
+	err := q.db.QueryRowContext(ctx, `
+		INSERT INTO user_preferences (user_id, record_location, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (user_id) DO UPDATE
+			SET record_location = EXCLUDED.record_location,
+			    updated_at = NOW()
+		RETURNING user_id, media_autoupload_folder_id, record_location, created_at, updated_at
+	`, userID, record).Scan(&p.UserID, &folderID, &p.RecordLocation, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("SetRecordLocation: %w", err)
+	}
+	if folderID.Valid {
+		p.MediaAutouploadFolderID = &folderID.UUID
+	}
+	return &p, nil
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/google/uuid"
+
 	"apollo-sfs.com/api/models"
 )
 
@@ -259,6 +261,25 @@ func (q *Queries) AddStorageUsed(ctx context.Context, username string, delta int
 	return nil
 }
 
+// RecomputeStorageUsed resets storage_used_bytes of username to the sum of
+// the files rows of userID, in one statement so that AddStorageUsed deltas
+// applied up to that moment are never overwritten, and returns the new
+// total. Used by orphan reconciliation to repair drift in the running total.
+// files is behind RLS, so q must be scoped to userID (see ForUser).
+func (q *Queries) RecomputeStorageUsed(ctx context.Context, username string, userID uuid.UUID) (int64, error) {
+	var total int64
+	err := q.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET storage_used_bytes = (SELECT COALESCE(SUM(size_bytes), 0) FROM files WHERE user_id = $2)
+		WHERE username = $1
+		RETURNING storage_used_bytes
+	`, username, userID).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("RecomputeStorageUsed %q: %w", username, err)
+	}
+	return total, nil
+}
+
 // ListUsersOnKeyVersion returns a page of users whose encryption key is still
 // wrapped under the given master key version. Used during key rotation to
 // identify users that have not yet been re-wrapped.
@@ -13,22 +13,27 @@ func scanVideoVariant(row interface {
 	Scan(...any) error
 }) (*models.VideoVariant, error) {
 	var v models.VideoVariant
-	err := row.Scan(&v.ID, &v.FileID, &v.Quality, &v.MinIOObjectKey, &v.SizeBytes, &v.Status, &v.CreatedAt)
+	err := row.Scan(&v.ID, &v.FileID, &v.Quality, &v.MimeType, &v.MinIOObjectKey, &v.SizeBytes, &v.Status, &v.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return &v, nil
 }
 
-const videoVariantColumns = `id, file_id, quality, minio_object_key, size_bytes, status, created_at`
+const videoVariantColumns = `id, file_id, quality, mime_type, minio_object_key, size_bytes, status, created_at`
 
 // CreateVideoVariant inserts a pending variant record and returns it.
-func (q *Queries) CreateVideoVariant(ctx context.Context, fileID uuid.UUID, quality, objectKey string) (*models.VideoVariant, error) {
+// mimeType is the content type of the decrypted variant. When the variant
+// already exists (a retried or recovered job) it is reset to pending and keeps
+// its original object key, so callers must write to the returned key.
+func (q *Queries) CreateVideoVariant(ctx context.Context, fileID uuid.UUID, quality, mimeType, objectKey string) (*models.VideoVariant, error) {
 	row := q.db.QueryRowContext(ctx, `
-		INSERT INTO video_variants (file_id, quality, minio_object_key, size_bytes, status)
-		VALUES ($1, $2, $3, 0, $4)
+		INSERT INTO video_variants (file_id, quality, mime_type, minio_object_key, size_bytes, status)
+		VALUES ($1, $2, $3, $4, 0, $5)
+		ON CONFLICT (file_id, quality) DO UPDATE
+		SET status = EXCLUDED.status, mime_type = EXCLUDED.mime_type
 		RETURNING `+videoVariantColumns,
-		fileID, quality, objectKey, models.VideoVariantStatusPending,
+		fileID, quality, mimeType, objectKey, models.VideoVariantStatusPending,
 	)
 	v, err := scanVideoVariant(row)
 	if err != nil {
@@ -96,3 +101,13 @@ func (q *Queries) MarkVideoVariantFailed(ctx context.Context, fileID uuid.UUID,
 	}
 	return nil
 }
+
+// DeleteVideoVariant removes a single variant row. The caller is responsible
+// for the MinIO object (if any).
+func (q *Queries) DeleteVideoVariant(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM video_variants WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("DeleteVideoVariant: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"apollo-sfs.com/api/models"
+)
+
+const webhookColumns = `
+	id, user_id, username, url, secret_enc, secret_nonce, events, folder_id, enabled, created_at, updated_at`
+
+func scanWebhook(row interface {
+	Scan(...any) error
+}) (*models.Webhook, error) {
+	var w models.Webhook
+	var folderID uuid.NullUUID
+	err := row.Scan(&w.ID, &w.UserID, &w.Username, &w.URL, &w.SecretEnc, &w.SecretNonce, pq.Array(&w.Events), &folderID,
+		&w.Enabled, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if folderID.Valid {
+		w.FolderID = &folderID.UUID
+	}
+	return &w, nil
+}
+
+const webhookDeliveryColumns = `
+	id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at`
+
+func scanWebhookDelivery(row interface {
+	Scan(...any) error
+}) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var code sql.NullInt64
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &code, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if code.Valid {
+		c := int(code.Int64)
+		d.LastStatusCode = &c
+	}
+	return &d, nil
+}
+
+// ── Webhooks ──────────────────────────────────────────────────────────────────
+
+// CreateWebhook inserts a webhook with its encrypted secret and returns it.
+func (q *Queries) CreateWebhook(ctx context.Context, w *models.Webhook) (*models.Webhook, error) {
+	row := q.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (user_id, username, url, secret_enc, secret_nonce, events, folder_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING`+webhookColumns,
+		w.UserID, w.Username, w.URL, w.SecretEnc, w.SecretNonce, pq.Array(w.Events), w.FolderID)
+	created, err := scanWebhook(row)
+	if err != nil {
+		return nil, fmt.Errorf("CreateWebhook: %w", err)
+	}
+	return created, nil
+}
+
+// CountWebhooks returns how many webhooks userID has.
+func (q *Queries) CountWebhooks(ctx context.Context, userID uuid.UUID) (int, error) {
+	var n int
+	if err := q.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhooks WHERE user_id = $1`, userID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("CountWebhooks: %w", err)
+	}
+	return n, nil
+}
+
+// ListWebhooks returns the webhooks of userID, oldest first.
+func (q *Queries) ListWebhooks(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+webhookColumns+`
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ListWebhooks: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListWebhooks scan: %w", err)
+		}
+		out = append(out, *w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListWebhooks: %w", err)
+	}
+	return out, nil
+}
+
+// GetWebhook returns the webhook with id, or nil if none exists.
+func (q *Queries) GetWebhook(ctx context.Context, id uuid.UUID) (*models.Webhook, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT`+webhookColumns+` FROM webhooks WHERE id = $1`, id)
+	w, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetWebhook: %w", err)
+	}
+	return w, nil
+}
+
+// UpdateWebhook saves the url, events and enabled flag of w and returns the
+// stored row.
+func (q *Queries) UpdateWebhook(ctx context.Context, w *models.Webhook) (*models.Webhook, error) {
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE webhooks
+		SET url = $2, events = $3, enabled = $4, updated_at = NOW()
+		WHERE id = $1
+		RETURNING`+webhookColumns,
+		w.ID, w.URL, pq.Array(w.Events), w.Enabled)
+	updated, err := scanWebhook(row)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateWebhook: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteWebhook deletes the webhook with id and, by cascade, its deliveries.
+func (q *Queries) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	if _, err := q.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("DeleteWebhook: %w", err)
+	}
+	return nil
+}
+
+// ── Deliveries ────────────────────────────────────────────────────────────────
+
+// queueWebhookDeliveries is a data-modifying CTE, named queued, that queues
+// an event for every enabled webhook subscribed to it. It reads the event
+// from a CTE named ev with the columns
+//
+//	id, created_at, user_id, data  the published event
+//	webhook_type                   the webhook event it triggers, or NULL
+//	file_event, folder_id          apply the webhooks' folder filter against
+//	                               folder_id (NULL for the root folder)
+//
+// An event published for the nil user is an admin event and goes to the
+// webhooks of admins. PublishEvent and recordChange run it in the same
+// statement as the notification, so a delivery is queued exactly when the
+// event's transaction commits, whether or not any API instance hears it.
+const queueWebhookDeliveries = `
+	queued AS (
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		SELECT w.id, ev.id, ev.webhook_type, json_build_object(
+			'id', ev.id, 'type', ev.webhook_type, 'created_at', ev.created_at, 'data', ev.data
+		)::jsonb
+		FROM ev
+		JOIN webhooks w ON w.enabled AND ev.webhook_type = ANY (w.events)
+		JOIN users u ON u.username = w.username
+		WHERE CASE WHEN ev.user_id = '00000000-0000-0000-0000-000000000000' THEN u.is_admin
+		           ELSE w.user_id = ev.user_id END
+		  AND (w.folder_id IS NULL OR NOT ev.file_event OR w.folder_id = ev.folder_id)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING
+	)`
+
+// webhookEventFor returns the webhook event type that an event published
+// for userID triggers, and whether it is a file event. Returns "" for events
+// no webhook can subscribe to, including user events published for the nil
+// user.
+func webhookEventFor(userID uuid.UUID, eventType string) (string, bool) {
+	switch {
+	case eventType == models.EventUserBanned:
+		if userID == uuid.Nil {
+			return models.WebhookUserBanned, false
+		}
+	case userID == uuid.Nil:
+	case eventType == models.EventFileUploaded:
+		return models.WebhookFileUploaded, true
+	case eventType == models.EventVariantReady:
+		return models.WebhookVariantReady, false
+	case eventType == models.EventQuotaWarning:
+		return models.WebhookQuotaWarning, false
+	}
+	return "", false
+}
+
+// changeWebhookEvent returns the webhook event type a change journal entry
+// triggers, or "". Only file deletions have one; they are file events.
+func changeWebhookEvent(itemType, op string) string {
+	if itemType == models.ChangeItemFile && op == models.ChangeDelete {
+		return models.WebhookFileDeleted
+	}
+	return ""
+}
+
+// CreateWebhookDelivery inserts a delivery of one event to one webhook that
+// is already claimed for its first attempt, for the caller to make right
+// away (the test-fire endpoint); the worker leaves it alone for lease.
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, webhookID, eventID uuid.UUID, eventType string, payload []byte, lease time.Duration) (*models.WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, attempts, next_attempt_at)
+		VALUES ($1, $2, $3, $4, 1, NOW() + make_interval(secs => $5))
+		RETURNING`+webhookDeliveryColumns,
+		webhookID, eventID, eventType, payload, lease.Seconds())
+	d, err := scanWebhookDelivery(row)
+	if err != nil {
+		return nil, fmt.Errorf("CreateWebhookDelivery: %w", err)
+	}
+	return d, nil
+}
+
+// ClaimWebhookDelivery takes the oldest due pending delivery, counts the
+// attempt and moves next_attempt_at out by lease, so a delivery whose worker
+// dies mid-attempt is retried afterwards. Returns nil when nothing is due.
+// SKIP LOCKED lets several workers claim concurrently.
+func (q *Queries) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts        = attempts + 1,
+		    next_attempt_at = NOW() + make_interval(secs => $1)
+		WHERE id = (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING`+webhookDeliveryColumns, lease.Seconds())
+	d, err := scanWebhookDelivery(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ClaimWebhookDelivery: %w", err)
+	}
+	return d, nil
+}
+
+// FinishWebhookDelivery records the outcome of the latest attempt. status
+// is 'delivered', 'failed', or 'pending' with the next attempt at retryAt.
+// statusCode is 0 when no response was received.
+func (q *Queries) FinishWebhookDelivery(ctx context.Context, id uuid.UUID, status string, statusCode int, errMsg *string, retryAt time.Time) (*models.WebhookDelivery, error) {
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	row := q.db.QueryRowContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status           = $2,
+		    last_status_code = $3,
+		    last_error       = $4,
+		    next_attempt_at  = $5,
+		    delivered_at     = CASE WHEN $2 = 'delivered' THEN NOW() END
+		WHERE id = $1
+		RETURNING`+webhookDeliveryColumns,
+		id, status, code, errMsg, retryAt)
+	d, err := scanWebhookDelivery(row)
+	if err != nil {
+		return nil, fmt.Errorf("FinishWebhookDelivery %s: %w", id, err)
+	}
+	return d, nil
+}
+
+// ListWebhookDeliveries returns a page of the deliveries of webhookID,
+// newest first.
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, in PageInput) (*PageResult[models.WebhookDelivery], error) {
+	limit := clampLimit(in.Limit)
+	offset, err := decodeOffsetCursor(in.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("ListWebhookDeliveries: %w", err)
+	}
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT`+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, webhookID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ListWebhookDeliveries: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListWebhookDeliveries scan: %w", err)
+		}
+		out = append(out, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListWebhookDeliveries: %w", err)
+	}
+	return &PageResult[models.WebhookDelivery]{
+		Items:     out,
+		NextToken: offsetNextToken(len(out), limit, offset),
+	}, nil
+}
+
+// DeleteFinishedWebhookDeliveries deletes delivered and failed deliveries
+// created before cutoff and returns how many were removed.
+func (q *Queries) DeleteFinishedWebhookDeliveries(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := q.db.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status IN ('delivered', 'failed') AND created_at < $1
+	`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("DeleteFinishedWebhookDeliveries: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
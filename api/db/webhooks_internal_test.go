@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+func TestWebhookEventFor(t *testing.T) {
+	user := uuid.New()
+	cases := []struct {
+		userID    uuid.UUID
+		event     string
+		want      string
+		fileEvent bool
+	}{
+		{user, models.EventFileUploaded, models.WebhookFileUploaded, true},
+		{user, models.EventVariantReady, models.WebhookVariantReady, false},
+		{user, models.EventQuotaWarning, models.WebhookQuotaWarning, false},
+		{uuid.Nil, models.EventUserBanned, models.WebhookUserBanned, false},
+		{user, models.EventUserBanned, "", false},       // only ever an admin event
+		{uuid.Nil, models.EventQuotaWarning, "", false}, // user event without a user
+		{user, models.EventResync, "", false},
+		{user, models.EventChange, "", false}, // queued by recordChange
+	}
+	for _, tc := range cases {
+		got, fileEvent := webhookEventFor(tc.userID, tc.event)
+		if got != tc.want || fileEvent != tc.fileEvent {
+			t.Errorf("webhookEventFor(%s, %q) = %q, %v; want %q, %v", tc.userID, tc.event, got, fileEvent, tc.want, tc.fileEvent)
+		}
+	}
+}
+
+func TestChangeWebhookEvent(t *testing.T) {
+	if got := changeWebhookEvent(models.ChangeItemFile, models.ChangeDelete); got != models.WebhookFileDeleted {
+		t.Errorf("file delete = %q; want %q", got, models.WebhookFileDeleted)
+	}
+	if got := changeWebhookEvent(models.ChangeItemFolder, models.ChangeDelete); got != "" {
+		t.Errorf("folder delete = %q; want none", got)
+	}
+	if got := changeWebhookEvent(models.ChangeItemFile, models.ChangeCreate); got != "" {
+		t.Errorf("file create = %q; want none", got)
+	}
+}
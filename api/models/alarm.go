@@ -18,5 +18,9 @@ type AlarmSettings struct {
 	NetworkTrafficLastFiredAt *time.Time `json:"network_traffic_last_fired_at" db:"network_traffic_last_fired_at"`
 	APIErrorRateEmails        []string   `json:"api_error_rate_emails"         db:"api_error_rate_emails"`
 	APIErrorRateLastFiredAt   *time.Time `json:"api_error_rate_last_fired_at"  db:"api_error_rate_last_fired_at"`
+	IntegrityEmails           []string   `json:"integrity_emails"              db:"integrity_emails"`
+	IntegrityLastFiredAt      *time.Time `json:"integrity_last_fired_at"       db:"integrity_last_fired_at"`
+	ServerDownEmails          []string   `json:"server_down_emails"            db:"server_down_emails"`
+	ServerDownLastFiredAt     *time.Time `json:"server_down_last_fired_at"     db:"server_down_last_fired_at"`
 	UpdatedAt                 time.Time  `json:"updated_at"                    db:"updated_at"`
 }
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BackupRunning = "running"
+	BackupDone    = "done"
+	BackupFailed  = "failed"
+
+	BackupVerifyRunning = "running"
+	BackupVerifyOK      = "ok"
+	BackupVerifyFailed  = "failed"
+)
+
+// BackupRun mirrors the backup_runs table: one attempt to write an off-site
+// backup. Blob counters cover every blob the backup references; the New*
+// counters only those copied by this run.
+type BackupRun struct {
+	ID              uuid.UUID  `json:"id"`
+	Target          string     `json:"target"`
+	Status          string     `json:"status"`
+	CatalogueRows   int64      `json:"catalogue_rows"`
+	CatalogueBytes  int64      `json:"catalogue_bytes"`
+	CatalogueSHA256 *string    `json:"catalogue_sha256,omitempty"`
+	BlobCount       int64      `json:"blob_count"`
+	BlobBytes       int64      `json:"blob_bytes"`
+	NewBlobCount    int64      `json:"new_blob_count"`
+	NewBlobBytes    int64      `json:"new_blob_bytes"`
+	Error           *string    `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+	VerifyStatus    *string    `json:"verify_status"`
+	VerifyError     *string    `json:"verify_error,omitempty"`
+	VerifiedAt      *time.Time `json:"verified_at"`
+}
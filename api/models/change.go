@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Change item types.
+const (
+	ChangeItemFile   = "file"
+	ChangeItemFolder = "folder"
+)
+
+// Change operations.
+const (
+	ChangeCreate  = "create"
+	ChangeRename  = "rename"
+	ChangeMove    = "move"
+	ChangeHide    = "hide"
+	ChangeUnhide  = "unhide"
+	ChangeDelete  = "delete"
+	ChangeContent = "content"
+)
+
+// Change mirrors the changes table: one entry of a user's change journal.
+// Name and ParentID are the item's state after the change, or before it for
+// a delete. ParentID is the folder a file is in or a folder's parent; nil
+// means root.
+type Change struct {
+	Seq       int64      `json:"seq" db:"seq"`
+	UserID    uuid.UUID  `json:"-" db:"user_id"`
+	ItemType  string     `json:"type" db:"item_type"`
+	ItemID    uuid.UUID  `json:"id" db:"item_id"`
+	Op        string     `json:"op" db:"op"`
+	Name      string     `json:"name" db:"name"`
+	ParentID  *uuid.UUID `json:"parent_id" db:"parent_id"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// User event types pushed over GET /events.
+const (
+	// EventChange carries a Change appended to the user's journal.
+	EventChange = "change"
+	// EventFileUploaded carries the File of a finished upload.
+	EventFileUploaded = "file.uploaded"
+	// EventVariantReady carries a VariantReadyEvent.
+	EventVariantReady = "variant.ready"
+	// EventQuotaWarning carries a QuotaWarningEvent.
+	EventQuotaWarning = "quota.warning"
+	// EventUserBanned carries a UserBannedEvent. It is an admin event: it is
+	// published for uuid.Nil and not pushed to any user's stream.
+	EventUserBanned = "user.banned"
+	// EventResync has no data. It is sent when events may have been missed,
+	// e.g. after the server lost its database connection; the client should
+	// catch up through GET /changes.
+	EventResync = "resync"
+)
+
+// VariantReadyEvent is sent when a derivative of a file becomes available:
+// the 480p transcode ("low"), an HLS rendition ("hls/720p") or a thumbnail
+// ("thumb-small").
+type VariantReadyEvent struct {
+	FileID  uuid.UUID `json:"file_id"`
+	Quality string    `json:"quality"`
+}
+
+// QuotaWarningEvent is sent when an upload takes the user past the warning
+// threshold or the full quota.
+type QuotaWarningEvent struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"`
+	Percent    int   `json:"percent"`
+}
+
+// UserBannedEvent is sent when an admin bans a user.
+type UserBannedEvent struct {
+	Username      string `json:"username"`
+	ViolationCode string `json:"violation_code"`
+	BannedBy      string `json:"banned_by"`
+}
@@ -24,6 +24,8 @@ type File struct {
 	TakenAt   *time.Time `json:"taken_at" db:"taken_at"`
 	// Hidden excludes the file from collection listings unless explicitly shown.
 	Hidden    bool      `json:"hidden" db:"hidden"`
+	// Tags are lower-cased labels set by the owner, matched by search filters.
+	Tags      []string  `json:"tags" db:"tags"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FileReplicaPending   = "pending"
+	FileReplicaOK        = "ok"
+	FileReplicaFailed    = "failed"
+	FileReplicaRestoring = "restoring"
+)
+
+// FileReplica mirrors the file_replicas table: the secondary copy of one
+// original blob or video variant. The primary copy is on the drive in
+// user_drive_allocations; DriveID is the replica drive.
+type FileReplica struct {
+	MinIOObjectKey string    `json:"minio_object_key"`
+	FileID         uuid.UUID `json:"file_id"`
+	Username       string    `json:"username"`
+	DriveID        uuid.UUID `json:"drive_id"`
+	Status         string    `json:"status"`
+	Error          *string   `json:"error,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ReplicaStatusCount is one row of the per-status replica summary.
+type ReplicaStatusCount struct {
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
@@ -21,4 +21,8 @@ type Invitation struct {
 	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
 	InitialQuotaBytes int64      `json:"initial_quota_bytes" db:"initial_quota_bytes"`
 	GrantAdmin        bool       `json:"grant_admin" db:"grant_admin"`
+	// AllocationDriveID and AllocationPolicy override where the invited user
+	// is placed; nil uses the default allocation policy.
+	AllocationDriveID *uuid.UUID `json:"allocation_drive_id" db:"allocation_drive_id"`
+	AllocationPolicy  *string    `json:"allocation_policy" db:"allocation_policy"`
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job kinds.
+const (
+	JobKindTranscode = "transcode"
+	JobKindTakenAt   = "taken_at"
+	JobKindThumbnail = "thumbnail"
+	JobKindHLS       = "hls"
+	JobKindTextIndex = "text_index"
+	// JobKindPerceptualHash hashes an image from its stored thumbnail,
+	// for images thumbnailed before perceptual hashes were recorded.
+	JobKindPerceptualHash = "perceptual_hash"
+)
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job mirrors the jobs table: one unit of background work on a file.
+type Job struct {
+	ID          uuid.UUID  `json:"id"`
+	Kind        string     `json:"kind"`
+	FileID      uuid.UUID  `json:"file_id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Username    string     `json:"username"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	RunAfter    time.Time  `json:"run_after"`
+	LastError   *string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// JobStatusCount is one row of the job queue summary.
+type JobStatusCount struct {
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
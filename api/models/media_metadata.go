@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MediaMetadata mirrors the `media_metadata` table: what EXIF (images) or
+// ffprobe (videos) reported about a file. Fields are nil when the source did
+// not carry them.
+type MediaMetadata struct {
+	FileID      uuid.UUID `json:"-" db:"file_id"`
+	UserID      uuid.UUID `json:"-" db:"user_id"`
+	Width       *int      `json:"width" db:"width"`
+	Height      *int      `json:"height" db:"height"`
+	Orientation *int      `json:"orientation" db:"orientation"`
+	CameraMake  *string   `json:"camera_make" db:"camera_make"`
+	CameraModel *string   `json:"camera_model" db:"camera_model"`
+	LensModel   *string   `json:"lens_model" db:"lens_model"`
+	// Latitude and Longitude are decimal degrees (WGS 84); Altitude is metres
+	// above sea level.
+	Latitude    *float64  `json:"latitude" db:"latitude"`
+	Longitude   *float64  `json:"longitude" db:"longitude"`
+	Altitude    *float64  `json:"altitude" db:"altitude"`
+	DurationMs  *int64    `json:"duration_ms" db:"duration_ms"`
+	VideoCodec  *string   `json:"video_codec" db:"video_codec"`
+	AudioCodec  *string   `json:"audio_codec" db:"audio_codec"`
+	Bitrate     *int64    `json:"bitrate" db:"bitrate"`
+	ExtractedAt time.Time `json:"extracted_at" db:"extracted_at"`
+}
+
+// HasLocation reports whether any GPS coordinate is set.
+func (m *MediaMetadata) HasLocation() bool {
+	return m.Latitude != nil || m.Longitude != nil || m.Altitude != nil
+}
+
+// ClearLocation drops the GPS coordinates.
+func (m *MediaMetadata) ClearLocation() {
+	m.Latitude, m.Longitude, m.Altitude = nil, nil, nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScrubStatusOK           = "ok"
+	ScrubStatusMissing      = "missing"
+	ScrubStatusSizeMismatch = "size_mismatch"
+	ScrubStatusCorrupt      = "corrupt"
+	ScrubStatusError        = "error"
+)
+
+// ScrubResult mirrors the scrub_results table: the outcome of the most recent
+// integrity check of one MinIO object. VariantID is nil for original blobs.
+type ScrubResult struct {
+	ID             uuid.UUID  `json:"id"`
+	FileID         uuid.UUID  `json:"file_id"`
+	VariantID      *uuid.UUID `json:"variant_id,omitempty"`
+	Username       string     `json:"username"`
+	MinIOObjectKey string     `json:"minio_object_key"`
+	Status         string     `json:"status"`
+	ExpectedBytes  int64      `json:"expected_bytes"`
+	ActualBytes    *int64     `json:"actual_bytes"`
+	Detail         *string    `json:"detail,omitempty"`
+	CheckedAt      time.Time  `json:"checked_at"`
+}
+
+// ScrubStatusCount is one row of the per-status summary shown in the admin report.
+type ScrubStatusCount struct {
+	Status        string    `json:"status"`
+	Count         int64     `json:"count"`
+	LastCheckedAt time.Time `json:"last_checked_at"`
+}
@@ -6,12 +6,22 @@ import (
 	"github.com/google/uuid"
 )
 
-// Server represents a physical machine running a MinIO instance.
+// Storage backends a server can use (servers.backend).
+const (
+	ServerBackendMinIO = "minio"
+	ServerBackendS3    = "s3" // any S3-compatible service; Region is sent when set
+	ServerBackendFS    = "fs" // local directory; MinioEndpoint is its path
+)
+
+// Server represents a physical machine running a MinIO instance (or another
+// storage backend, see Backend).
 // MinIO credentials are stored encrypted; never exposed in JSON responses.
 type Server struct {
 	ID                  uuid.UUID `json:"id"`
 	Name                string    `json:"name"`
 	State               string    `json:"state"`
+	Backend             string    `json:"backend"`
+	Region              string    `json:"region"`
 	MinioEndpoint       string    `json:"minio_endpoint"`
 	MinioUseSSL         bool      `json:"minio_use_ssl"`
 	MinioAccessKeyEnc   []byte    `json:"-"`
@@ -22,16 +32,55 @@ type Server struct {
 	CreatedAt           time.Time `json:"created_at"`
 }
 
+// Server health states reported by the MinIO registry's liveness checks.
+const (
+	ServerHealthHealthy  = "healthy"
+	ServerHealthDegraded = "degraded" // slow, or failing but not yet long enough to be down
+	ServerHealthDown     = "down"
+)
+
+// ServerHealth is the registry's in-memory view of one active server. It is
+// not persisted; a restart starts from a fresh probe.
+type ServerHealth struct {
+	ServerID            uuid.UUID  `json:"server_id"`
+	ServerName          string     `json:"server_name"`
+	Endpoint            string     `json:"minio_endpoint"`
+	State               string     `json:"state"`
+	LatencyMs           int64      `json:"latency_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastCheckedAt       *time.Time `json:"last_checked_at"`
+	LastHealthyAt       *time.Time `json:"last_healthy_at"`
+	DownSince           *time.Time `json:"down_since"`
+}
+
+// Drive lifecycle states (drives.state).
+const (
+	DriveStateActive   = "active"
+	DriveStateDraining = "draining"
+	DriveStateRetired  = "retired"
+)
+
+// Drive tiers (drives.tier). Only the tier-aware allocation policy reads it.
+const (
+	DriveTierStandard = "standard"
+	DriveTierPremium  = "premium"
+)
+
 // Drive represents a physical drive on a Server. All files for a user are
 // stored in a single drive's MinIO bucket; users are never split across drives.
 type Drive struct {
-	ID            uuid.UUID `json:"id"`
-	ServerID      uuid.UUID `json:"server_id"`
-	Label         string    `json:"label"`
-	CapacityBytes int64     `json:"capacity_bytes"`
-	MinioBucket   string    `json:"minio_bucket"`
-	IsActive      bool      `json:"is_active"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID             uuid.UUID  `json:"id"`
+	ServerID       uuid.UUID  `json:"server_id"`
+	Label          string     `json:"label"`
+	CapacityBytes  int64      `json:"capacity_bytes"`
+	MinioBucket    string     `json:"minio_bucket"`
+	IsActive       bool       `json:"is_active"`
+	Tier           string     `json:"tier"`
+	State          string     `json:"state"`
+	DrainStartedAt *time.Time `json:"drain_started_at"`
+	RetiredAt      *time.Time `json:"retired_at"`
+	CreatedAt      time.Time  `json:"created_at"`
 }
 
 // UserDriveAllocation records which drive a user's quota and files live on.
@@ -58,7 +107,12 @@ type DriveSummary struct {
 	AllocatedQuotaBytes  int64     `json:"allocated_quota_bytes"`
 	UsedBytes            int64     `json:"used_bytes"`
 	DriveIsActive        bool      `json:"drive_is_active"`
+	DriveTier            string    `json:"drive_tier"`
+	DriveState           string    `json:"drive_state"`
 	ServerIsActive       bool      `json:"server_is_active"`
+	// ServerHealth is filled from the MinIO registry, not the database;
+	// empty for inactive servers.
+	ServerHealth         string    `json:"server_health,omitempty"`
 }
 
 // ServerWithDrives is the response shape for the infrastructure listing.
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	UserMigrationPending  = "pending"
+	UserMigrationCopying  = "copying"
+	UserMigrationCleaning = "cleaning"
+	UserMigrationDone     = "done"
+	UserMigrationFailed   = "failed"
+)
+
+// UserMigration mirrors the user_migrations table: one attempt to move a
+// user's blobs from one drive to another. Progress counters cover original
+// blobs and ready video variants together.
+type UserMigration struct {
+	ID            uuid.UUID  `json:"id"`
+	Username      string     `json:"username"`
+	SourceDriveID uuid.UUID  `json:"source_drive_id"`
+	TargetDriveID uuid.UUID  `json:"target_drive_id"`
+	Status        string     `json:"status"`
+	TotalObjects  int        `json:"total_objects"`
+	CopiedObjects int        `json:"copied_objects"`
+	TotalBytes    int64      `json:"total_bytes"`
+	CopiedBytes   int64      `json:"copied_bytes"`
+	Error         *string    `json:"error,omitempty"`
+	StartedBy     string     `json:"started_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
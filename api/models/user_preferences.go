@@ -13,6 +13,9 @@ type UserPreferences struct {
 	// MediaAutouploadFolderID, when set, routes every image/video upload into
 	// that media folder automatically regardless of the requested target folder.
 	MediaAutouploadFolderID *uuid.UUID `json:"media_autoupload_folder_id" db:"media_autoupload_folder_id"`
-	CreatedAt               time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt               time.Time  `json:"updated_at" db:"updated_at"`
+	// RecordLocation controls whether GPS coordinates found in uploaded media
+	// are kept in media_metadata. Defaults to true.
+	RecordLocation bool      `json:"record_location" db:"record_location"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -12,13 +12,14 @@ const (
 	VideoVariantStatusFailed  = "failed"
 )
 
-// VideoVariant mirrors the video_variants table. Each row is a transcoded
-// derivative of a File (e.g. a 480p H.264/AAC MP4 stored in MinIO).
+// VideoVariant mirrors the video_variants table. Each row is a derivative of
+// a File stored in MinIO: a transcoded 480p H.264/AAC MP4 or a JPEG thumbnail.
 // Rows are cascade-deleted when the parent files row is removed.
 type VideoVariant struct {
 	ID             uuid.UUID `json:"id"`
 	FileID         uuid.UUID `json:"file_id"`
 	Quality        string    `json:"quality"`
+	MimeType       string    `json:"mime_type"`
 	MinIOObjectKey string    `json:"-"`
 	SizeBytes      int64     `json:"size_bytes"`
 	Status         string    `json:"status"`
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook event types. File and quota events are delivered to the owner's
+// webhooks; admin events to the webhooks of admins.
+const (
+	WebhookFileUploaded = "file.uploaded"
+	WebhookFileDeleted  = "file.deleted"
+	WebhookVariantReady = "variant.ready"
+	WebhookQuotaWarning = "quota.warning"
+	WebhookUserBanned   = "user.banned"
+	// WebhookTest is sent by the test-fire endpoint only.
+	WebhookTest = "webhook.test"
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook mirrors the webhooks table. Secret signs the deliveries and is
+// only handed to the client when the webhook is created. It is stored
+// encrypted with the KEK (SecretEnc, SecretNonce); the db layer leaves
+// Secret empty and WebhookService decrypts it when signing.
+type Webhook struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	Username    string     `json:"-"`
+	URL         string     `json:"url"`
+	Secret      string     `json:"-"`
+	SecretEnc   []byte     `json:"-"`
+	SecretNonce []byte     `json:"-"`
+	Events      []string   `json:"events"`
+	FolderID    *uuid.UUID `json:"folder_id"`
+	Enabled     bool       `json:"enabled"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery mirrors the webhook_deliveries table: one event queued for
+// one webhook, and the outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// ListBackups handles GET /api/v1/admin/system/backups
+//
+// Returns the backup job's state and one page of recorded backups, newest first.
+//
+// Query params:
+//
+//	cursor=<opaque>
+//	limit=<int>
+func (h *Handler) ListBackups(c *gin.Context) {
+	if h.backups == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "backups not configured"})
+		return
+	}
+	page := db.PageInput{Cursor: strings.TrimSpace(c.Query("cursor"))}
+	if err := parseLimit(c, &page.Limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	result, err := h.backups.List(c.Request.Context(), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list backups"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     h.backups.Status(),
+		"backups":    result.Items,
+		"next_token": result.NextToken,
+	})
+}
+
+// TriggerBackup handles POST /api/v1/admin/system/backups.
+// Starts a backup in the background and returns 202 immediately, or 409 if a
+// backup or verification is already running.
+func (h *Handler) TriggerBackup(c *gin.Context) {
+	if h.backups == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "backups not configured"})
+		return
+	}
+	if !h.backups.Trigger() {
+		c.JSON(http.StatusConflict, gin.H{"error": "a backup job is already running"})
+		return
+	}
+	c.JSON(http.StatusAccepted, h.backups.Status())
+}
+
+// VerifyBackup handles POST /api/v1/admin/system/backups/:backup_id/verify.
+// Starts verifying the backup in the background and returns 202 with the
+// backup row; the outcome lands in its verify_status and verify_error.
+func (h *Handler) VerifyBackup(c *gin.Context) {
+	if h.backups == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "backups not configured"})
+		return
+	}
+	id, err := uuid.Parse(c.Param("backup_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid backup_id"})
+		return
+	}
+
+	run, err := h.backups.Verify(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, services.ErrBackupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
+	case errors.Is(err, services.ErrBackupNotComplete):
+		c.JSON(http.StatusConflict, gin.H{"error": "only completed backups can be verified"})
+	case errors.Is(err, services.ErrBackupBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": "a backup job is already running"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start verification"})
+	default:
+		c.JSON(http.StatusAccepted, run)
+	}
+}
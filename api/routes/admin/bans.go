@@ -10,8 +10,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
 	"apollo-sfs.com/api/sanitize"
 )
 
@@ -89,6 +91,16 @@ func (h *Handler) BanUser(c *gin.Context) {
 		}
 	}
 
+	if h.events != nil {
+		if err := h.events.PublishEvent(ctx, uuid.Nil, models.EventUserBanned, models.UserBannedEvent{
+			Username:      target,
+			ViolationCode: req.ViolationCode,
+			BannedBy:      admin,
+		}); err != nil {
+			log.Printf("BanUser: publish event for %q: %v", target, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "user banned"})
 }
 
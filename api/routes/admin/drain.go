@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes/services"
+)
+
+// DrainDrive handles POST /api/v1/admin/system/servers/:server_id/drives/:drive_id/drain.
+// Stops new allocations to the drive and migrates every allocated user to
+// the best-fit active drive in the background; the drive is retired once it
+// is empty. Re-posting retries users whose migration failed.
+func (h *Handler) DrainDrive(c *gin.Context) {
+	if h.drainer == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "drive drain not configured"})
+		return
+	}
+	driveID, err := uuid.Parse(c.Param("drive_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid drive_id"})
+		return
+	}
+
+	progress, err := h.drainer.Drain(c.Request.Context(), driveID, c.GetString("username"))
+	if err != nil {
+		writeDrainError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, progress)
+}
+
+// GetDriveDrain handles GET /api/v1/admin/system/servers/:server_id/drives/:drive_id/drain.
+// Returns the drive's state, users and bytes still on it, and the migrations
+// started by the current drain.
+func (h *Handler) GetDriveDrain(c *gin.Context) {
+	if h.drainer == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "drive drain not configured"})
+		return
+	}
+	driveID, err := uuid.Parse(c.Param("drive_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid drive_id"})
+		return
+	}
+
+	progress, err := h.drainer.Progress(c.Request.Context(), driveID)
+	if err != nil {
+		writeDrainError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, progress)
+}
+
+func writeDrainError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDriveNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "drive not found"})
+	case errors.Is(err, services.ErrDriveRetired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load drain status"})
+	}
+}
@@ -44,6 +44,31 @@ type Handler struct {
 	// nil means the kill-switch endpoint is disabled.
 	shutdownCh   chan struct{}
 	shutdownOnce sync.Once
+
+	// scrubber runs the background integrity scrub. nil disables the
+	// integrity endpoints (they return 503).
+	scrubber IntegrityScrubber
+	// reconciler diffs MinIO buckets against the files table. nil disables
+	// the reconcile endpoints (they return 503).
+	reconciler StorageReconciler
+	// migrator moves users between drives. nil disables the migrate
+	// endpoints (they return 503).
+	migrator UserMigrator
+	// drainer empties drives for decommissioning. nil disables the drain
+	// endpoints (they return 503).
+	drainer DriveDrainer
+	// replication keeps user replicas in line with their replication factor.
+	// nil disables the replication endpoints (they return 503).
+	replication ReplicationManager
+	// backups writes and verifies off-site backups. nil disables the backup
+	// endpoints (they return 503).
+	backups BackupManager
+	// jobs is the background job queue. nil disables the job endpoints
+	// (they return 503).
+	jobs JobQueue
+	// events publishes admin events such as user.banned for webhooks. nil
+	// publishes nothing.
+	events EventPublisher
 }
 
 // NewHandler constructs an admin Handler.
@@ -55,3 +80,45 @@ type Handler struct {
 func NewHandler(queries AdminQuerier, inviteSvc AdminInviteService, metricsSvc MetricsServicer, authSvc *services.AuthService, fileSvc routes.FileServicer, registry *services.MinIORegistry, geoReader *geoip2.Reader, backendTestURL, apiDir, frontendTestURL, frontendE2EURL string, shutdownCh chan struct{}) *Handler {
 	return &Handler{queries: queries, invites: inviteSvc, metrics: metricsSvc, auth: authSvc, files: fileSvc, registry: registry, geo: geoReader, backendTestURL: backendTestURL, apiDir: apiDir, frontendTestURL: frontendTestURL, frontendE2EURL: frontendE2EURL, shutdownCh: shutdownCh}
 }
+
+// SetIntegrityScrubber attaches the integrity scrubber to an existing Handler.
+// Kept out of NewHandler because the scrubber depends on the alarm service,
+// which in turn is constructed from the Handler.
+func SetIntegrityScrubber(h *Handler, svc IntegrityScrubber) {
+	h.scrubber = svc
+}
+
+// SetStorageReconciler attaches the orphan reconciler to an existing Handler.
+func SetStorageReconciler(h *Handler, svc StorageReconciler) {
+	h.reconciler = svc
+}
+
+// SetUserMigrator attaches the drive migration service to an existing Handler.
+func SetUserMigrator(h *Handler, svc UserMigrator) {
+	h.migrator = svc
+}
+
+// SetDriveDrainer attaches the drive drain service to an existing Handler.
+func SetDriveDrainer(h *Handler, svc DriveDrainer) {
+	h.drainer = svc
+}
+
+// SetReplicationManager attaches the replication service to an existing Handler.
+func SetReplicationManager(h *Handler, svc ReplicationManager) {
+	h.replication = svc
+}
+
+// SetBackupManager attaches the backup service to an existing Handler.
+func SetBackupManager(h *Handler, svc BackupManager) {
+	h.backups = svc
+}
+
+// SetJobQueue attaches the background job queue to an existing Handler.
+func SetJobQueue(h *Handler, svc JobQueue) {
+	h.jobs = svc
+}
+
+// SetEventPublisher attaches the admin event publisher to an existing Handler.
+func SetEventPublisher(h *Handler, p EventPublisher) {
+	h.events = p
+}
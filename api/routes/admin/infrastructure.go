@@ -4,25 +4,40 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
 	"apollo-sfs.com/api/routes/services"
 	"apollo-sfs.com/api/sanitize"
 )
 
 // GetInfrastructure handles GET /api/v1/admin/system/infrastructure.
-// Returns all servers with their drives and per-drive usage summaries.
+// Returns all servers with their drives and per-drive usage summaries, plus
+// the latest liveness probe for every active server. Each drive also carries
+// its server's health state (healthy / degraded / down).
 func (h *Handler) GetInfrastructure(c *gin.Context) {
 	summaries, err := h.queries.GetDriveSummaries(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve infrastructure"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"drives": summaries})
+	health := []models.ServerHealth{}
+	if h.registry != nil {
+		health = h.registry.Health()
+	}
+	states := make(map[uuid.UUID]string, len(health))
+	for _, sh := range health {
+		states[sh.ServerID] = sh.State
+	}
+	for i := range summaries {
+		summaries[i].ServerHealth = states[summaries[i].ServerID]
+	}
+	c.JSON(http.StatusOK, gin.H{"drives": summaries, "servers": health})
 }
 
 // GetCapacity handles GET /api/v1/admin/system/capacity.
@@ -37,11 +52,15 @@ func (h *Handler) GetCapacity(c *gin.Context) {
 }
 
 type createServerRequest struct {
-	State         string `json:"state" binding:"required,min=2,max=2"`
+	State string `json:"state" binding:"required,min=2,max=2"`
+	// Backend is "minio" (default), "s3" or "fs". For "fs" MinioEndpoint is
+	// an absolute directory on the API host and the keys are not used.
+	Backend       string `json:"backend" binding:"omitempty,oneof=minio s3 fs"`
+	Region        string `json:"region"`
 	MinioEndpoint string `json:"minio_endpoint" binding:"required"`
 	MinioUseSSL   bool   `json:"minio_use_ssl"`
-	AccessKey     string `json:"access_key" binding:"required"`
-	SecretKey     string `json:"secret_key" binding:"required"`
+	AccessKey     string `json:"access_key"`
+	SecretKey     string `json:"secret_key"`
 }
 
 // CreateServer handles POST /api/v1/admin/system/servers.
@@ -55,12 +74,26 @@ func (h *Handler) CreateServer(c *gin.Context) {
 	}
 
 	state := strings.ToUpper(sanitize.String(req.State))
+	backend := req.Backend
+	if backend == "" {
+		backend = models.ServerBackendMinIO
+	}
 
-	// Test-connect to MinIO before persisting credentials.
-	client, err := services.NewMinIOClient(req.MinioEndpoint, req.AccessKey, req.SecretKey, req.MinioUseSSL)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot connect to MinIO: %v", err)})
-		return
+	if backend == models.ServerBackendFS {
+		if !filepath.IsAbs(req.MinioEndpoint) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fs servers need an absolute directory as minio_endpoint"})
+			return
+		}
+	} else {
+		if req.AccessKey == "" || req.SecretKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "access_key and secret_key are required"})
+			return
+		}
+		// Test-connect to MinIO before persisting credentials.
+		if _, err := services.NewS3Client(req.MinioEndpoint, req.Region, req.AccessKey, req.SecretKey, req.MinioUseSSL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot connect to MinIO: %v", err)})
+			return
+		}
 	}
 
 	// Encrypt credentials with the KEK stored in the registry.
@@ -87,6 +120,8 @@ func (h *Handler) CreateServer(c *gin.Context) {
 	server, err := h.queries.CreateServer(ctx, db.CreateServerParams{
 		Name:                name,
 		State:               state,
+		Backend:             backend,
+		Region:              req.Region,
 		MinioEndpoint:       req.MinioEndpoint,
 		MinioUseSSL:         req.MinioUseSSL,
 		MinioAccessKeyEnc:   accessEnc,
@@ -99,8 +134,8 @@ func (h *Handler) CreateServer(c *gin.Context) {
 		return
 	}
 
-	// Register the new client immediately so uploads can use it without a restart.
-	h.registry.Register(server.ID, client)
+	// Register the new server immediately so uploads can use it without a restart.
+	h.registry.Register(ctx, server)
 
 	c.JSON(http.StatusCreated, server)
 }
@@ -131,6 +166,9 @@ func (h *Handler) UpdateServer(c *gin.Context) {
 		}
 		if !*req.IsActive {
 			h.registry.Remove(serverID)
+		} else if server, err := h.queries.GetServer(ctx, serverID); err == nil && server != nil {
+			// Re-activated: reconnect so its drives are usable without a restart.
+			h.registry.Register(ctx, server)
 		}
 	}
 
@@ -141,6 +179,8 @@ type addDriveRequest struct {
 	Label         string `json:"label" binding:"required"`
 	MinioBucket   string `json:"minio_bucket" binding:"required"`
 	CapacityBytes int64  `json:"capacity_bytes" binding:"required,min=1"`
+	// Tier is "standard" (default) or "premium"; see the tier-aware allocation policy.
+	Tier string `json:"tier" binding:"omitempty,oneof=standard premium"`
 }
 
 // AddDrive handles POST /api/v1/admin/system/servers/:server_id/drives.
@@ -165,12 +205,11 @@ func (h *Handler) AddDrive(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
 		return
 	}
-	client, ok := h.registry.Client(serverID)
-	if !ok {
-		c.JSON(http.StatusConflict, gin.H{"error": "server has no active MinIO client; re-activate it first"})
-		return
-	}
-	if err := services.EnsureBucket(ctx, client, req.MinioBucket); err != nil {
+	if err := h.registry.EnsureBucket(ctx, serverID, req.MinioBucket); err != nil {
+		if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": "server is inactive or down; re-activate it or wait for it to recover"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot ensure bucket: %v", err)})
 		return
 	}
@@ -180,6 +219,7 @@ func (h *Handler) AddDrive(c *gin.Context) {
 		Label:         sanitize.String(req.Label),
 		CapacityBytes: req.CapacityBytes,
 		MinioBucket:   req.MinioBucket,
+		Tier:          req.Tier,
 	})
 	if err != nil {
 		if strings.Contains(err.Error(), "unique") {
@@ -197,6 +237,7 @@ type updateDriveRequest struct {
 	Label         string `json:"label"`
 	CapacityBytes int64  `json:"capacity_bytes"`
 	IsActive      *bool  `json:"is_active"`
+	Tier          string `json:"tier" binding:"omitempty,oneof=standard premium"`
 }
 
 // UpdateDrive handles PATCH /api/v1/admin/system/servers/:server_id/drives/:drive_id.
@@ -232,11 +273,21 @@ func (h *Handler) UpdateDrive(c *gin.Context) {
 	if req.IsActive != nil {
 		isActive = *req.IsActive
 	}
+	tier := existing.Tier
+	if req.Tier != "" {
+		tier = req.Tier
+	}
+	// Draining drives stay inactive until retired; retired drives for good.
+	if isActive && existing.State != models.DriveStateActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "drive is " + existing.State + " and cannot be reactivated"})
+		return
+	}
 
 	drive, err := h.queries.UpdateDrive(ctx, driveID, db.UpdateDriveParams{
 		Label:         label,
 		CapacityBytes: capacityBytes,
 		IsActive:      isActive,
+		Tier:          tier,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update drive"})
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+// GetIntegrityReport handles GET /api/v1/admin/system/integrity.
+// Returns the scrubber's current pass state and a per-status count of the
+// most recent result for every object.
+func (h *Handler) GetIntegrityReport(c *gin.Context) {
+	if h.scrubber == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "integrity scrubber not configured"})
+		return
+	}
+	summary, err := h.queries.GetScrubSummary(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load integrity summary"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"scrub":   h.scrubber.Status(),
+		"summary": summary,
+	})
+}
+
+// ListIntegrityResults handles GET /api/v1/admin/system/integrity/results
+//
+// Query params:
+//
+//	status=missing|size_mismatch|corrupt|error|ok (default: every non-ok result)
+//	cursor=<opaque>
+//	limit=<int>
+func (h *Handler) ListIntegrityResults(c *gin.Context) {
+	status := strings.ToLower(strings.TrimSpace(c.Query("status")))
+	switch status {
+	case "", models.ScrubStatusOK, models.ScrubStatusMissing, models.ScrubStatusSizeMismatch,
+		models.ScrubStatusCorrupt, models.ScrubStatusError:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+
+	page := db.PageInput{Cursor: strings.TrimSpace(c.Query("cursor"))}
+	if err := parseLimit(c, &page.Limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	result, err := h.queries.ListScrubResults(c.Request.Context(), status, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list integrity results"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// TriggerIntegrityScrub handles POST /api/v1/admin/system/integrity/scrub.
+// Starts a scrub pass in the background and returns 202 immediately, or 409
+// if a pass is already running.
+func (h *Handler) TriggerIntegrityScrub(c *gin.Context) {
+	if h.scrubber == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "integrity scrubber not configured"})
+		return
+	}
+	if !h.scrubber.Trigger() {
+		c.JSON(http.StatusConflict, gin.H{"error": "integrity scrub already in progress"})
+		return
+	}
+	c.JSON(http.StatusAccepted, h.scrubber.Status())
+}
@@ -66,6 +66,8 @@ func (h *Handler) UpdateInterestFormSettings(c *gin.Context) {
 type provisionInterestRequest struct {
 	InitialQuotaBytes int64 `json:"initial_quota_bytes"`
 	GrantAdmin        bool  `json:"grant_admin"`
+	// Optional placement override for the invited user's drive.
+	services.InvitePlacement
 }
 
 // ProvisionInterestSubmission handles POST /api/v1/admin/interest/:id/provision.
@@ -112,12 +114,16 @@ func (h *Handler) ProvisionInterestSubmission(c *gin.Context) {
 	}
 
 	// Create the invitation via the invite service (same as standard invite flow).
-	inv, err := h.invites.Create(ctx, adminID, invitedByUsername.(string), submission.Email, req.InitialQuotaBytes, req.GrantAdmin)
+	inv, err := h.invites.Create(ctx, adminID, invitedByUsername.(string), submission.Email, req.InitialQuotaBytes, req.GrantAdmin, req.InvitePlacement)
 	if err != nil {
 		if errors.Is(err, services.ErrInviteAlreadyPending) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, services.ErrInvalidInvitePlacement) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create invitation"})
 		return
 	}
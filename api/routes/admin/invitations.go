@@ -24,6 +24,8 @@ type createInvitationRequest struct {
 	Email             string `json:"email" binding:"required,email,max=254"`
 	InitialQuotaBytes int64  `json:"initial_quota_bytes"`
 	GrantAdmin        bool   `json:"grant_admin"`
+	// Optional placement override for the invited user's drive.
+	services.InvitePlacement
 }
 
 // CreateInvitation handles POST /api/v1/admin/invitations.
@@ -44,12 +46,16 @@ func (h *Handler) CreateInvitation(c *gin.Context) {
 		return
 	}
 
-	inv, err := h.invites.Create(c.Request.Context(), userID, invitedByUsername.(string), req.Email, req.InitialQuotaBytes, req.GrantAdmin)
+	inv, err := h.invites.Create(c.Request.Context(), userID, invitedByUsername.(string), req.Email, req.InitialQuotaBytes, req.GrantAdmin, req.InvitePlacement)
 	if err != nil {
 		if errors.Is(err, services.ErrInviteAlreadyPending) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, services.ErrInvalidInvitePlacement) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create invitation"})
 		return
 	}
@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// ListJobs handles GET /api/v1/admin/system/jobs
+//
+// Returns the queue summary (worker count, jobs per status) and one page of
+// jobs, newest first.
+//
+// Query params:
+//
+//	status=queued|running|done|failed|cancelled (default: every job)
+//	cursor=<opaque>
+//	limit=<int>
+func (h *Handler) ListJobs(c *gin.Context) {
+	if h.jobs == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "job queue not configured"})
+		return
+	}
+	status := strings.ToLower(strings.TrimSpace(c.Query("status")))
+	switch status {
+	case "", models.JobQueued, models.JobRunning, models.JobDone, models.JobFailed, models.JobCancelled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+
+	page := db.PageInput{Cursor: strings.TrimSpace(c.Query("cursor"))}
+	if err := parseLimit(c, &page.Limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	summary, err := h.jobs.Summary(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list jobs"})
+		return
+	}
+	result, err := h.jobs.List(c.Request.Context(), status, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     summary,
+		"jobs":       result.Items,
+		"next_token": result.NextToken,
+	})
+}
+
+// RetryJob handles POST /api/v1/admin/system/jobs/:job_id/retry.
+// Queues a failed or cancelled job again with a fresh attempt budget.
+func (h *Handler) RetryJob(c *gin.Context) {
+	if h.jobs == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "job queue not configured"})
+		return
+	}
+	id, err := uuid.Parse(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job_id"})
+		return
+	}
+
+	job, err := h.jobs.Retry(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case errors.Is(err, services.ErrJobNotRetryable),
+		errors.Is(err, services.ErrJobDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retry job"})
+	default:
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// CancelJob handles POST /api/v1/admin/system/jobs/:job_id/cancel.
+// Cancels a queued job, or stops a running one.
+func (h *Handler) CancelJob(c *gin.Context) {
+	if h.jobs == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "job queue not configured"})
+		return
+	}
+	id, err := uuid.Parse(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job_id"})
+		return
+	}
+
+	job, err := h.jobs.Cancel(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case errors.Is(err, services.ErrJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not cancel job"})
+	default:
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// BackfillJobs handles POST /api/v1/admin/system/jobs/backfill.
+//
+// Starts queueing, in the background, a job of the given kind for every file
+// stored before that kind of processing existed: text_index for files
+// uploaded before content search, perceptual_hash for images thumbnailed
+// before the duplicate finder. Files with an unfinished job of the kind are
+// skipped, so it is safe to repeat.
+//
+// Body: {"kind": "text_index" | "perceptual_hash"}
+func (h *Handler) BackfillJobs(c *gin.Context) {
+	if h.jobs == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "job queue not configured"})
+		return
+	}
+	var req struct {
+		Kind string `json:"kind" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind is required"})
+		return
+	}
+
+	err := h.jobs.Backfill(req.Kind)
+	switch {
+	case errors.Is(err, services.ErrJobNoBackfill):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrJobBackfillRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start backfill"})
+	default:
+		c.JSON(http.StatusAccepted, gin.H{"kind": req.Kind})
+	}
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes/services"
+	"apollo-sfs.com/api/sanitize"
+)
+
+type migrateUserRequest struct {
+	DriveID string `json:"drive_id" binding:"required"`
+}
+
+// MigrateUser handles POST /api/v1/admin/users/:user_id/migrate.
+// Starts moving the user's blobs to the drive in the body, or resumes a failed
+// migration to that same drive. Returns 202 with the migration row; poll
+// GET .../migrate for progress.
+func (h *Handler) MigrateUser(c *gin.Context) {
+	if h.migrator == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "user migration not configured"})
+		return
+	}
+	username := sanitize.String(c.Param("user_id"))
+	if username == "" || len(username) > 150 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+
+	var req migrateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "drive_id is required"})
+		return
+	}
+	driveID, err := uuid.Parse(req.DriveID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid drive_id"})
+		return
+	}
+
+	m, err := h.migrator.Migrate(c.Request.Context(), username, driveID, c.GetString("username"))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, services.ErrMigrationInvalidTarget),
+			errors.Is(err, services.ErrMigrationNoAllocation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrMigrationInProgress),
+			errors.Is(err, services.ErrNoCapacity),
+			errors.Is(err, services.ErrMigrationTargetOffline):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start migration"})
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, m)
+}
+
+// GetUserMigration handles GET /api/v1/admin/users/:user_id/migrate.
+// Returns the user's most recent migration with its progress counters.
+func (h *Handler) GetUserMigration(c *gin.Context) {
+	if h.migrator == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "user migration not configured"})
+		return
+	}
+	username := sanitize.String(c.Param("user_id"))
+	if username == "" || len(username) > 150 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+
+	m, err := h.migrator.Latest(c.Request.Context(), username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load migration"})
+		return
+	}
+	if m == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no migration for this user"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
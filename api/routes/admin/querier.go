@@ -56,11 +56,18 @@ type AdminQuerier interface {
 	UpdateInterestFormSettings(ctx context.Context, dailyCap int) (*models.InterestFormSettings, error)
 	GetInterestSubmissionByID(ctx context.Context, id uuid.UUID) (*models.InterestSubmission, error)
 	MarkInterestSubmissionProvisioned(ctx context.Context, id uuid.UUID, invitationID uuid.UUID) error
+
+	// Integrity scrubber
+	ListScrubResults(ctx context.Context, status string, in db.PageInput) (*db.PageResult[models.ScrubResult], error)
+	GetScrubSummary(ctx context.Context) ([]models.ScrubStatusCount, error)
+
+	// Replication
+	GetReplicaSummary(ctx context.Context) ([]models.ReplicaStatusCount, error)
 }
 
 // AdminInviteService is the subset of *services.InviteService used by admin handlers.
 type AdminInviteService interface {
-	Create(ctx context.Context, invitedByUserID uuid.UUID, invitedByUsername, email string, initialQuotaBytes int64, grantAdmin bool) (*models.Invitation, error)
+	Create(ctx context.Context, invitedByUserID uuid.UUID, invitedByUsername, email string, initialQuotaBytes int64, grantAdmin bool, placement services.InvitePlacement) (*models.Invitation, error)
 	List(ctx context.Context, page db.PageInput) (*db.PageResult[models.Invitation], error)
 	InvitationURL(token string) string
 	Resend(ctx context.Context, id uuid.UUID, byUsername string) error
@@ -78,7 +85,69 @@ type MetricsServicer interface {
 	Hub() *services.Hub
 }
 
+// IntegrityScrubber is the subset of *services.ScrubService used by admin handlers.
+type IntegrityScrubber interface {
+	Status() services.ScrubStatus
+	Trigger() bool
+}
+
+// StorageReconciler is the subset of *services.ReconcileService used by admin handlers.
+type StorageReconciler interface {
+	Status() services.ReconcileStatus
+	Trigger(mode string, dryRunID uuid.UUID) error
+}
+
+// UserMigrator is the subset of *services.UserMigrationService used by admin handlers.
+type UserMigrator interface {
+	Migrate(ctx context.Context, username string, targetDriveID uuid.UUID, startedBy string) (*models.UserMigration, error)
+	Latest(ctx context.Context, username string) (*models.UserMigration, error)
+}
+
+// DriveDrainer is the subset of *services.DrainService used by admin handlers.
+type DriveDrainer interface {
+	Drain(ctx context.Context, driveID uuid.UUID, startedBy string) (*services.DrainProgress, error)
+	Progress(ctx context.Context, driveID uuid.UUID) (*services.DrainProgress, error)
+}
+
+// ReplicationManager is the subset of *services.ReplicationService used by admin handlers.
+type ReplicationManager interface {
+	Status() services.ReplicationStatus
+	Trigger() bool
+	SetUserFactor(ctx context.Context, username string, factor *int) error
+	DriveReplaced(ctx context.Context, driveID uuid.UUID) (replicas, primaries int64, err error)
+}
+
+// BackupManager is the subset of *services.BackupService used by admin handlers.
+type BackupManager interface {
+	Status() services.BackupStatus
+	Trigger() bool
+	List(ctx context.Context, page db.PageInput) (*db.PageResult[models.BackupRun], error)
+	Verify(ctx context.Context, id uuid.UUID) (*models.BackupRun, error)
+}
+
+// JobQueue is the subset of *services.JobService used by admin handlers.
+type JobQueue interface {
+	Summary(ctx context.Context) (services.JobQueueStatus, error)
+	List(ctx context.Context, status string, page db.PageInput) (*db.PageResult[models.Job], error)
+	Retry(ctx context.Context, id uuid.UUID) (*models.Job, error)
+	Cancel(ctx context.Context, id uuid.UUID) (*models.Job, error)
+	Backfill(kind string) error
+}
+
+// EventPublisher publishes admin events (see db.EventChannel).
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, userID uuid.UUID, eventType string, data any) error
+}
+
 // Compile-time checks: ensure the concrete types satisfy the interfaces.
 var _ AdminQuerier = (*db.Queries)(nil)
+var _ EventPublisher = (*db.Queries)(nil)
 var _ AdminInviteService = (*services.InviteService)(nil)
 var _ MetricsServicer = (*services.MetricsService)(nil)
+var _ IntegrityScrubber = (*services.ScrubService)(nil)
+var _ StorageReconciler = (*services.ReconcileService)(nil)
+var _ UserMigrator = (*services.UserMigrationService)(nil)
+var _ DriveDrainer = (*services.DrainService)(nil)
+var _ ReplicationManager = (*services.ReplicationService)(nil)
+var _ BackupManager = (*services.BackupService)(nil)
+var _ JobQueue = (*services.JobService)(nil)
@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes/services"
+)
+
+// GetReconcileStatus handles GET /api/v1/admin/system/reconcile.
+// Returns whether a reconciliation pass is running and the latest report
+// (null before the first pass).
+func (h *Handler) GetReconcileStatus(c *gin.Context) {
+	if h.reconciler == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "storage reconciler not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, h.reconciler.Status())
+}
+
+type triggerReconcileRequest struct {
+	Mode     string `json:"mode" binding:"required"`
+	ReportID string `json:"report_id"`
+}
+
+// TriggerReconcile handles POST /api/v1/admin/system/reconcile.
+//
+// Body: {"mode": "dry_run"} or {"mode": "quarantine"|"delete", "report_id": "<dry run id>"}.
+// Quarantine and delete only act on orphans listed in the referenced dry run,
+// which must be the most recent one. Returns 202 with the new status.
+func (h *Handler) TriggerReconcile(c *gin.Context) {
+	if h.reconciler == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "storage reconciler not configured"})
+		return
+	}
+
+	var req triggerReconcileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode is required"})
+		return
+	}
+
+	var reportID uuid.UUID
+	switch req.Mode {
+	case services.ReconcileDryRun:
+	case services.ReconcileQuarantine, services.ReconcileDelete:
+		id, err := uuid.Parse(req.ReportID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "report_id of a dry run is required"})
+			return
+		}
+		reportID = id
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be dry_run, quarantine or delete"})
+		return
+	}
+
+	if err := h.reconciler.Trigger(req.Mode, reportID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrReconcileRunning), errors.Is(err, services.ErrReconcileNoDryRun):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start reconciliation"})
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, h.reconciler.Status())
+}
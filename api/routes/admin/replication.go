@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes/services"
+	"apollo-sfs.com/api/sanitize"
+)
+
+// GetReplicationStatus handles GET /api/v1/admin/system/replication.
+// Returns the repair job's pass state, the tier defaults and a per-status
+// count of every tracked replica.
+func (h *Handler) GetReplicationStatus(c *gin.Context) {
+	if h.replication == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "replication not configured"})
+		return
+	}
+	summary, err := h.queries.GetReplicaSummary(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load replica summary"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"repair":  h.replication.Status(),
+		"summary": summary,
+	})
+}
+
+// TriggerReplicationRepair handles POST /api/v1/admin/system/replication/repair.
+// Starts a repair pass in the background and returns 202 immediately, or 409
+// if a pass is already running.
+func (h *Handler) TriggerReplicationRepair(c *gin.Context) {
+	if h.replication == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "replication not configured"})
+		return
+	}
+	if !h.replication.Trigger() {
+		c.JSON(http.StatusConflict, gin.H{"error": "replication repair already in progress"})
+		return
+	}
+	c.JSON(http.StatusAccepted, h.replication.Status())
+}
+
+// MarkDriveReplaced handles POST /api/v1/admin/system/servers/:server_id/drives/:drive_id/replaced.
+// Call after swapping the disk behind a drive for an empty one: replicas it
+// held are rewritten from their primaries and primary objects it held are
+// restored from their replicas by a repair pass started in the background.
+func (h *Handler) MarkDriveReplaced(c *gin.Context) {
+	if h.replication == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "replication not configured"})
+		return
+	}
+	driveID, err := uuid.Parse(c.Param("drive_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid drive_id"})
+		return
+	}
+
+	replicas, primaries, err := h.replication.DriveReplaced(c.Request.Context(), driveID)
+	if err != nil {
+		if errors.Is(err, services.ErrDriveNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "drive not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not mark drive replaced"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"replicas_queued":  replicas,
+		"primaries_queued": primaries,
+	})
+}
+
+type setReplicationRequest struct {
+	// Factor is 1 or 2; null clears the override so the tier default applies.
+	Factor *int `json:"factor"`
+}
+
+// SetUserReplication handles PUT /api/v1/admin/users/:user_id/replication.
+// Sets or clears the user's replication factor override.
+func (h *Handler) SetUserReplication(c *gin.Context) {
+	if h.replication == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "replication not configured"})
+		return
+	}
+	username := sanitize.String(c.Param("user_id"))
+	if username == "" || len(username) > 150 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+
+	var req setReplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "factor must be 1, 2 or null"})
+		return
+	}
+
+	if err := h.replication.SetUserFactor(c.Request.Context(), username, req.Factor); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidReplicationFactor):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update replication factor"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"username": username, "factor": req.Factor})
+}
@@ -194,16 +194,16 @@ func (h *Handler) runSpeedTest(ctx context.Context) *SpeedTestResult {
 		return &SpeedTestResult{Error: fmt.Sprintf("list drives: %v", err), TestedAt: time.Now()}
 	}
 
-	var svc *services.MinIOService
+	var svc services.BlobStore
 	for _, d := range drives {
 		if !d.DriveIsActive || !d.ServerIsActive {
 			continue
 		}
-		client, ok := h.registry.Client(d.ServerID)
+		store, ok := h.registry.Store(d.ServerID, d.MinioBucket)
 		if !ok {
 			continue
 		}
-		svc = services.NewMinIOService(client, d.MinioBucket)
+		svc = store
 		break
 	}
 	if svc == nil {
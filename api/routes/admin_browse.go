@@ -28,12 +28,18 @@ func (h *Handler) kcID(c *gin.Context, username string) (uuid.UUID, error) {
 
 // AdminListUserFolders handles GET /api/v1/admin/users/:user_id/folders.
 // Returns the virtual root contents for the specified user (admin only, read-only).
+// Given q or any of the filters of GET /search, it instead returns that
+// user's folders and files matching them across the whole tree.
 func (h *Handler) AdminListUserFolders(c *gin.Context) {
 	username := sanitize.String(c.Param("user_id"))
 	if username == "" || len(username) > 150 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
 		return
 	}
+	q, filter, ok := parseSearchQuery(c, false)
+	if !ok {
+		return
+	}
 
 	if _, err := h.queries.GetUserByUsername(c.Request.Context(), username); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -51,12 +57,13 @@ func (h *Handler) AdminListUserFolders(c *gin.Context) {
 		return
 	}
 
-	contents, err := h.folders.ListRoot(
-		c.Request.Context(),
-		userID,
-		parsePage(c, "folder"),
-		parsePage(c, "file"),
-	)
+	folderPage, filePage := parsePage(c, "folder"), parsePage(c, "file")
+	var contents *services.FolderContents
+	if q != "" || !filter.IsZero() {
+		contents, err = h.folders.Search(c.Request.Context(), userID, q, filter, folderPage, filePage)
+	} else {
+		contents, err = h.folders.ListRoot(c.Request.Context(), userID, folderPage, filePage)
+	}
 	if err != nil {
 		log.Printf("AdminListUserFolders: username=%s err=%v", username, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list folder contents"})
@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/routes/services"
+	"apollo-sfs.com/api/sanitize"
+)
+
+type createArchiveRequest struct {
+	FileIDs   []uuid.UUID `json:"file_ids"`
+	FolderIDs []uuid.UUID `json:"folder_ids"`
+	// Name is the archive's file name without ".zip"; optional.
+	Name string `json:"name"`
+}
+
+type createArchiveResponse struct {
+	ArchiveID   uuid.UUID `json:"archive_id"`
+	Name        string    `json:"name"`
+	DownloadURL string    `json:"download_url"`
+	ExpiresAt   string    `json:"expires_at"`
+}
+
+// CreateArchive handles POST /api/v1/archives.
+// Prepares a zip of the selected files and folders and returns a presigned
+// URL that streams it. Body: {"file_ids": [...], "folder_ids": [...], "name": "..."}.
+func (h *Handler) CreateArchive(c *gin.Context) {
+	if h.archives == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "archives are not configured"})
+		return
+	}
+	var req createArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_ids and folder_ids must be lists of UUIDs"})
+		return
+	}
+	name := sanitize.Name(req.Name, 200)
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+
+	archive, err := h.archives.Create(c.Request.Context(), userID, username, name, req.FileIDs, req.FolderIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrArchiveEmpty), errors.Is(err, services.ErrArchiveTooLarge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		case errors.Is(err, services.ErrFolderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		default:
+			log.Printf("CreateArchive: user=%s err=%v", username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not prepare archive"})
+		}
+		return
+	}
+
+	token, expiresAt, err := h.presign.IssueForFile(archive.ID.String(), userID.String(), username, services.PresignActionArchive, time.Until(archive.ExpiresAt))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		return
+	}
+
+	h.logAudit(db.AuditInput{
+		TargetUsername: username,
+		ActorUsername:  username,
+		Action:         "archive_created",
+		ResourceType:   strPtr("archive"),
+		ResourceID:     &archive.ID,
+		ResourceName:   &archive.Name,
+	})
+
+	c.JSON(http.StatusCreated, createArchiveResponse{
+		ArchiveID:   archive.ID,
+		Name:        archive.Name,
+		DownloadURL: fmt.Sprintf("/api/v1/archives/%s/download/p?token=%s", archive.ID, token),
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// DownloadArchivePresigned handles GET /api/v1/archives/:archive_id/download/p.
+// Validates the presign token and streams the zip. Once the first byte is
+// sent the status cannot change, so a failure part-way through is logged
+// and the connection dropped: the client then sees a failed download
+// rather than a zip that ends without its central directory.
+func (h *Handler) DownloadArchivePresigned(c *gin.Context) {
+	if h.archives == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "archives are not configured"})
+		return
+	}
+	archiveIDStr := c.Param("archive_id")
+	archiveID, err := uuid.Parse(archiveIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid archive id"})
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token is required"})
+		return
+	}
+	claim, err := h.presign.ValidateForFile(token, services.PresignActionArchive)
+	if err != nil {
+		if errors.Is(err, services.ErrPresignExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": "presigned URL has expired"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid presigned token"})
+		return
+	}
+	userID, err := uuid.Parse(claim.UserID)
+	if err != nil || claim.FileID != archiveIDStr {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid presigned token"})
+		return
+	}
+
+	archive, err := h.archives.Get(archiveID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive not found or expired"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s"`, sanitize.ContentDispositionFilename(archive.Name)))
+	c.Status(http.StatusOK)
+	if err := h.archives.Write(c.Request.Context(), archive, c.Writer); err != nil {
+		log.Printf("DownloadArchivePresigned: archive=%s user=%s err=%v", archive.ID, claim.Username, err)
+		// gin refuses to hijack once the body has started; the net/http
+		// writer underneath does not.
+		if rw, ok := c.Writer.(interface{ Unwrap() http.ResponseWriter }); ok {
+			if conn, _, herr := http.NewResponseController(rw.Unwrap()).Hijack(); herr == nil {
+				_ = conn.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/routes/services"
+)
+
+type bulkRequest struct {
+	Op        string      `json:"op" binding:"required"`
+	FileIDs   []uuid.UUID `json:"file_ids"`
+	FolderIDs []uuid.UUID `json:"folder_ids"`
+	// FolderID is the destination of a move.
+	FolderID *uuid.UUID `json:"folder_id"`
+}
+
+// Bulk handles POST /api/v1/bulk.
+// Applies one operation (move, delete, hide, unhide, favorite, unfavorite)
+// to many files and folders, so a large selection is one request instead of
+// one per item. Body: {"op": "move", "file_ids": [...], "folder_ids": [...],
+// "folder_id": "<target>"}. Responds 200 with a result per item whenever the
+// request itself was valid, even if some items failed.
+func (h *Handler) Bulk(c *gin.Context) {
+	if h.bulk == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "bulk operations are not configured"})
+		return
+	}
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "op is required; file_ids, folder_ids and folder_id must be UUIDs"})
+		return
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+
+	res, err := h.bulk.Apply(c.Request.Context(), services.BulkInput{
+		UserID:         userID,
+		Username:       username,
+		Op:             req.Op,
+		FileIDs:        req.FileIDs,
+		FolderIDs:      req.FolderIDs,
+		TargetFolderID: req.FolderID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrBulkEmpty), errors.Is(err, services.ErrBulkTooLarge),
+			errors.Is(err, services.ErrBulkOperation), errors.Is(err, services.ErrBulkNoTarget):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrFolderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "target folder not found"})
+		default:
+			log.Printf("Bulk: user=%s op=%s err=%v", username, req.Op, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "bulk operation failed; nothing was changed"})
+		}
+		return
+	}
+
+	if res.Succeeded > 0 {
+		summary := fmt.Sprintf("%d of %d items", res.Succeeded, len(res.Items))
+		h.logAudit(db.AuditInput{
+			TargetUsername: username,
+			ActorUsername:  username,
+			Action:         "bulk_" + res.Op,
+			ResourceType:   strPtr("bulk"),
+			ResourceID:     req.FolderID,
+			ResourceName:   &summary,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes/services"
+)
+
+// ListChanges handles GET /api/v1/changes?cursor=&limit=.
+// Without a cursor it returns no changes and the current cursor, which a
+// sync client takes before listing the drive. With one it returns the file
+// and folder changes made after it, oldest first, and the cursor to pass
+// next; has_more means another page is ready. An expired cursor gets 410
+// Gone, after which the client lists the drive again.
+func (h *Handler) ListChanges(c *gin.Context) {
+	if h.changes == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "change feed is not configured"})
+		return
+	}
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	page, err := h.changes.List(c.Request.Context(), userID, c.Query("cursor"), limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrChangeCursorInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrChangeCursorExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			log.Printf("list changes: user=%s err=%v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list changes"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
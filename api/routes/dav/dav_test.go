@@ -0,0 +1,267 @@
+package dav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func TestSplitPath(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"/", nil},
+		{"/a", []string{"a"}},
+		{"/a/b/", []string{"a", "b"}},
+		{"a//b", []string{"a", "b"}},
+		{"/a/../b", []string{"b"}},
+		{"/../../etc", []string{"etc"}},
+	}
+	for _, tc := range cases {
+		if got := splitPath(tc.in); !slices.Equal(got, tc.want) {
+			t.Errorf("splitPath(%q) = %q; want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for _, name := range []string{"cat.jpg", "My Documents", ".DS_Store", "naïve résumé.pdf"} {
+		if !validName(name) {
+			t.Errorf("validName(%q) = false; want true", name)
+		}
+	}
+	for _, name := range []string{"", ".", "..", " padded", `back\slash`, "line\nbreak"} {
+		if validName(name) {
+			t.Errorf("validName(%q) = true; want false", name)
+		}
+	}
+}
+
+func TestScopeOps(t *testing.T) {
+	cases := []struct {
+		method   string
+		src, dst string
+	}{
+		{http.MethodOptions, "", ""},
+		{http.MethodGet, "read", ""},
+		{http.MethodHead, "read", ""},
+		{"PROPFIND", "list", ""},
+		{http.MethodPut, "write", ""},
+		{"MKCOL", "write", ""},
+		{"LOCK", "write", ""},
+		{http.MethodDelete, "delete", ""},
+		{"COPY", "read", "write"},
+		{"MOVE", "delete", "write"},
+	}
+	for _, tc := range cases {
+		src, dst := scopeOps(tc.method)
+		if src != tc.src || dst != tc.dst {
+			t.Errorf("scopeOps(%s) = (%q, %q); want (%q, %q)", tc.method, src, dst, tc.src, tc.dst)
+		}
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	h := NewHandler(nil, nil, nil, nil, nil, "/api/v1/dav/", nil)
+	cases := map[string]string{
+		"/api/v1/dav":                "",
+		"/api/v1/dav/":               "",
+		"/api/v1/dav/photos/cat.jpg": "photos/cat.jpg",
+		"/api/v1/dav/photos/":        "photos",
+	}
+	for in, want := range cases {
+		if got := h.objectKey(in); got != want {
+			t.Errorf("objectKey(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+// rangeFiles serves DownloadRange from an in-memory plaintext and records
+// each requested range.
+type rangeFiles struct {
+	FileServicer
+	data   []byte
+	ranges [][2]int64
+}
+
+func (r *rangeFiles) DownloadRange(_ context.Context, _ *models.File, _ string, start, end int64) ([]byte, error) {
+	r.ranges = append(r.ranges, [2]int64{start, end})
+	return r.data[start : end+1], nil
+}
+
+func TestReadFile_ChunkedWindows(t *testing.T) {
+	data := make([]byte, readWindow+readWindow/2)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	stub := &rangeFiles{data: data}
+	fs := newFileSystem(&Handler{files: stub}, &models.User{Username: "alice"}, uuid.New())
+	f := &readFile{fs: fs, ctx: context.Background(), file: &models.File{
+		ID:        uuid.New(),
+		SizeBytes: int64(len(data)),
+		Nonce:     []byte{}, // chunked
+	}}
+	if !services.IsChunked(f.file) {
+		t.Fatal("test file should be chunked")
+	}
+
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !slices.Equal(got, data) {
+		t.Fatal("ReadAll returned different bytes")
+	}
+	want := [][2]int64{{0, readWindow - 1}, {readWindow, int64(len(data)) - 1}}
+	if !slices.Equal(stub.ranges, want) {
+		t.Errorf("ranges = %v; want %v", stub.ranges, want)
+	}
+
+	// A seek back into the current window is served from memory; a seek
+	// outside it fetches a new window starting at the offset.
+	stub.ranges = nil
+	if _, err := f.Seek(readWindow+10, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(f, buf); err != nil || buf[0] != data[readWindow+10] {
+		t.Fatalf("read after in-window seek = %v, %v", buf, err)
+	}
+	if len(stub.ranges) != 0 {
+		t.Errorf("in-window seek fetched %v", stub.ranges)
+	}
+	if _, err := f.Seek(-int64(len(data)), io.SeekEnd); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if _, err := io.ReadFull(f, buf); err != nil || buf[0] != data[0] {
+		t.Fatalf("read after rewind = %v, %v", buf, err)
+	}
+	if len(stub.ranges) != 1 || stub.ranges[0][0] != 0 {
+		t.Errorf("rewind ranges = %v; want one window from 0", stub.ranges)
+	}
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("negative seek should fail")
+	}
+}
+
+func TestDirFile_QuotaProps(t *testing.T) {
+	user := &models.User{StorageUsedBytes: 300, StorageQuotaBytes: 1000}
+	d := &dirFile{fs: newFileSystem(&Handler{}, user, uuid.New()), node: &node{}}
+	props, err := d.DeadProps()
+	if err != nil {
+		t.Fatalf("DeadProps: %v", err)
+	}
+	for name, want := range map[string]string{"quota-used-bytes": "300", "quota-available-bytes": "700"} {
+		p, ok := props[xml.Name{Space: "DAV:", Local: name}]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if string(p.InnerXML) != want {
+			t.Errorf("%s = %s; want %s", name, p.InnerXML, want)
+		}
+	}
+
+	user.StorageUsedBytes = 1200 // over quota after a quota cut
+	props, _ = d.DeadProps()
+	if got := string(props[xml.Name{Space: "DAV:", Local: "quota-available-bytes"}].InnerXML); got != "0" {
+		t.Errorf("quota-available-bytes over quota = %s; want 0", got)
+	}
+}
+
+// uploadFiles records the input of each Upload call.
+type uploadFiles struct {
+	FileServicer
+	got []services.UploadInput
+}
+
+func (u *uploadFiles) Upload(_ context.Context, in services.UploadInput) (*models.File, error) {
+	body, _ := io.ReadAll(in.Reader)
+	in.Reader = nil
+	u.got = append(u.got, in)
+	return &models.File{ID: uuid.New(), SizeBytes: int64(len(body))}, nil
+}
+
+func TestWriteFile_OverwriteInPlace(t *testing.T) {
+	stub := &uploadFiles{}
+	fs := newFileSystem(&Handler{files: stub}, &models.User{Username: "alice"}, uuid.New())
+	old := &models.File{ID: uuid.New(), Name: "notes.txt", SizeBytes: 3}
+	tmp, err := os.CreateTemp(t.TempDir(), "put")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &writeFile{fs: fs, ctx: context.Background(), name: "notes.txt", replace: old, tmp: tmp}
+	if _, err := w.Write([]byte("new content")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The existing row is replaced under its own name; nothing is uploaded
+	// under a temporary name, removed or renamed.
+	if len(stub.got) != 1 {
+		t.Fatalf("Upload called %d times; want 1", len(stub.got))
+	}
+	if in := stub.got[0]; in.Replace != old || in.Name != "notes.txt" {
+		t.Errorf("Upload input = %+v; want Replace of the existing file under its name", in)
+	}
+}
+
+func TestUserLocks(t *testing.T) {
+	shared := webdav.NewMemLS()
+	alice, bob := newUserLocks(shared, uuid.New()), newUserLocks(shared, uuid.New())
+	now := time.Now()
+	details := webdav.LockDetails{Root: "/docs/a.txt", Duration: time.Minute, ZeroDepth: true}
+
+	aliceToken, err := alice.Create(now, details)
+	if err != nil {
+		t.Fatalf("alice Create: %v", err)
+	}
+	// The same path in another account is a different resource.
+	bobToken, err := bob.Create(now, details)
+	if err != nil {
+		t.Fatalf("bob Create on the same path: %v", err)
+	}
+	if _, err := alice.Create(now, details); !errors.Is(err, webdav.ErrLocked) {
+		t.Errorf("second alice Create = %v; want ErrLocked", err)
+	}
+
+	// A token is only honoured for the user it was issued to.
+	if err := bob.Unlock(now, aliceToken); !errors.Is(err, webdav.ErrNoSuchLock) {
+		t.Errorf("bob Unlock(alice token) = %v; want ErrNoSuchLock", err)
+	}
+	if _, err := bob.Confirm(now, "/docs/a.txt", "", webdav.Condition{Token: aliceToken}); err == nil {
+		t.Error("bob Confirm with alice's token should fail")
+	}
+	release, err := alice.Confirm(now, "/docs/a.txt", "", webdav.Condition{Token: aliceToken})
+	if err != nil {
+		t.Fatalf("alice Confirm: %v", err)
+	}
+	release()
+
+	got, err := alice.Refresh(now, aliceToken, time.Hour)
+	if err != nil || got.Root != "/docs/a.txt" {
+		t.Errorf("Refresh = %+v, %v; want root /docs/a.txt", got, err)
+	}
+	if err := alice.Unlock(now, aliceToken); err != nil {
+		t.Errorf("alice Unlock: %v", err)
+	}
+	if err := bob.Unlock(now, bobToken); err != nil {
+		t.Errorf("bob Unlock: %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+package dav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/services"
+)
+
+const (
+	// readWindow is how much plaintext a chunked file fetches per storage
+	// round trip while it is read sequentially.
+	readWindow = 4 << 20
+	// uploadPartSize is the part size for PUT bodies too large for a single
+	// Upload call. It must be a multiple of services.ChunkSize and at least
+	// the 5 MiB multipart minimum.
+	uploadPartSize = 8 * services.ChunkSize
+	// uploadParallel bounds the parts of one PUT being encrypted and stored
+	// at once, and so the memory it holds.
+	uploadParallel = 2
+)
+
+// Compile-time checks that the file types satisfy webdav's interfaces.
+var (
+	_ webdav.File            = (*readFile)(nil)
+	_ webdav.File            = (*dirFile)(nil)
+	_ webdav.File            = (*writeFile)(nil)
+	_ webdav.DeadPropsHolder = (*dirFile)(nil)
+	_ webdav.ContentTyper    = (*fileInfo)(nil)
+	_ webdav.ETager          = (*fileInfo)(nil)
+)
+
+var errReadOnly = errors.New("file not open for writing")
+
+// ── fileInfo ──────────────────────────────────────────────────────────────────
+
+// fileInfo is the os.FileInfo for a folder or file. It also answers
+// getcontenttype and getetag from metadata so PROPFIND never reads content.
+type fileInfo struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	dir      bool
+	mimeType string
+	etag     string
+}
+
+func fileStat(f *models.File) *fileInfo {
+	return &fileInfo{
+		name:     f.Name,
+		size:     f.SizeBytes,
+		modTime:  f.UpdatedAt,
+		mimeType: f.MimeType,
+		etag:     `"` + f.ID.String() + "-" + strconv.FormatInt(f.UpdatedAt.UnixNano(), 36) + `"`,
+	}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *fileInfo) ContentType(context.Context) (string, error) {
+	if fi.dir || fi.mimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.mimeType, nil
+}
+
+// ETag implements webdav.ETager. Files still being written have none yet
+// and fall back to webdav's modtime/size tag.
+func (fi *fileInfo) ETag(context.Context) (string, error) {
+	if fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.etag, nil
+}
+
+// ── readFile ──────────────────────────────────────────────────────────────────
+
+// readFile serves GET and COPY. Chunked files are decrypted a window at a
+// time with DownloadRange so Range requests and seeks only fetch what they
+// need; single-blob files can only be decrypted whole and are loaded on the
+// first Read.
+type readFile struct {
+	fs   *fileSystem
+	ctx  context.Context
+	file *models.File
+	off  int64
+
+	buf    []byte // decrypted plaintext starting at bufOff
+	bufOff int64
+	whole  bool // buf holds the entire file
+}
+
+func (f *readFile) Read(p []byte) (int, error) {
+	if f.off >= f.file.SizeBytes {
+		return 0, io.EOF
+	}
+	if f.off < f.bufOff || f.off >= f.bufOff+int64(len(f.buf)) {
+		if err := f.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.buf[f.off-f.bufOff:])
+	f.off += int64(n)
+	return n, nil
+}
+
+// fill loads the plaintext that covers f.off into buf.
+func (f *readFile) fill() error {
+	if f.whole {
+		return io.ErrUnexpectedEOF
+	}
+	if !services.IsChunked(f.file) {
+		_, data, err := f.fs.h.files.Download(f.ctx, f.file.ID, f.fs.userID, f.fs.user.Username)
+		if err != nil {
+			return fmt.Errorf("dav read: %w", err)
+		}
+		f.buf, f.bufOff, f.whole = data, 0, true
+		if f.off >= int64(len(data)) {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	end := min(f.off+readWindow, f.file.SizeBytes) - 1
+	data, err := f.fs.h.files.DownloadRange(f.ctx, f.file, f.fs.user.Username, f.off, end)
+	if err != nil {
+		return fmt.Errorf("dav read: %w", err)
+	}
+	if len(data) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	f.buf, f.bufOff = data, f.off
+	return nil
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.file.SizeBytes
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *readFile) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.file.Name, Err: errors.New("not a directory")}
+}
+
+func (f *readFile) Stat() (fs.FileInfo, error) { return fileStat(f.file), nil }
+func (f *readFile) Write([]byte) (int, error)  { return 0, errReadOnly }
+func (f *readFile) Close() error               { f.buf = nil; return nil }
+
+// ── dirFile ───────────────────────────────────────────────────────────────────
+
+// dirFile is an open folder (or the root). It lists its children for
+// PROPFIND and reports the owner's quota through the RFC 4331 properties.
+type dirFile struct {
+	fs   *fileSystem
+	ctx  context.Context
+	node *node
+
+	entries []fs.FileInfo
+	loaded  bool
+}
+
+func (d *dirFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if !d.loaded {
+		folders, files, err := d.fs.children(d.ctx, d.node.folderID())
+		if err != nil {
+			return nil, err
+		}
+		d.entries = make([]fs.FileInfo, 0, len(folders)+len(files))
+		for i := range folders {
+			d.entries = append(d.entries, (&node{folder: &folders[i]}).info())
+		}
+		for i := range files {
+			d.entries = append(d.entries, fileStat(&files[i]))
+		}
+		d.loaded = true
+	}
+	if count <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	out := d.entries[:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
+
+// DeadProps implements webdav.DeadPropsHolder. The quota properties are
+// computed, not stored, but webdav only has live properties for the ones
+// it defines itself.
+func (d *dirFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	used := d.fs.user.StorageUsedBytes
+	available := max(d.fs.user.StorageQuotaBytes-used, 0)
+	props := make(map[xml.Name]webdav.Property, 2)
+	for name, v := range map[string]int64{
+		"quota-used-bytes":      used,
+		"quota-available-bytes": available,
+	} {
+		xn := xml.Name{Space: "DAV:", Local: name}
+		props[xn] = webdav.Property{XMLName: xn, InnerXML: []byte(strconv.FormatInt(v, 10))}
+	}
+	return props, nil
+}
+
+// Patch implements webdav.DeadPropsHolder. Arbitrary properties are not
+// stored, so every PROPPATCH is refused.
+func (d *dirFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	stat := webdav.Propstat{Status: http.StatusForbidden}
+	for _, p := range patches {
+		for _, prop := range p.Props {
+			stat.Props = append(stat.Props, webdav.Property{XMLName: prop.XMLName})
+		}
+	}
+	return []webdav.Propstat{stat}, nil
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.node.info(), nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: d.node.info().name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) Seek(int64, int) (int64, error) { return 0, nil }
+func (d *dirFile) Write([]byte) (int, error)      { return 0, errReadOnly }
+func (d *dirFile) Close() error                   { return nil }
+
+// ── writeFile ─────────────────────────────────────────────────────────────────
+
+// writeFile spools a PUT body to a temp file and stores it on Close, so
+// the body is encrypted exactly as a browser upload would be. Overwriting an
+// existing file replaces its content in place: the file keeps its ID and
+// everything attached to it, and a failed upload leaves the original as it
+// was.
+type writeFile struct {
+	fs       *fileSystem
+	ctx      context.Context
+	folderID *uuid.UUID
+	name     string
+	replace  *models.File
+	tmp      *os.File
+	size     int64
+}
+
+func (w *writeFile) Write(p []byte) (int, error) {
+	n, err := w.tmp.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *writeFile) Stat() (fs.FileInfo, error) {
+	return &fileInfo{name: w.name, size: w.size, modTime: time.Now()}, nil
+}
+
+func (w *writeFile) Read([]byte) (int, error)           { return 0, errors.New("file open for writing") }
+func (w *writeFile) Seek(int64, int) (int64, error)     { return 0, errors.New("file open for writing") }
+func (w *writeFile) Readdir(int) ([]fs.FileInfo, error) { return nil, errors.New("not a directory") }
+
+func (w *writeFile) Close() error {
+	defer func() {
+		_ = w.tmp.Close()
+		_ = os.Remove(w.tmp.Name())
+	}()
+	w.fs.forget()
+	// webdav closes the file even when copying the body failed; storing what
+	// arrived would replace a good file with a truncated one.
+	if err := w.ctx.Err(); err != nil {
+		return fmt.Errorf("dav put: %w", err)
+	}
+	if w.fs.putSize >= 0 && w.size != w.fs.putSize {
+		return fmt.Errorf("dav put: body ended after %d of %d bytes", w.size, w.fs.putSize)
+	}
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("dav put: rewind spool: %w", err)
+	}
+
+	var err error
+	if w.size <= uploadPartSize {
+		_, err = w.fs.h.files.Upload(w.ctx, services.UploadInput{
+			Username:    w.fs.user.Username,
+			UserID:      w.fs.userID,
+			FolderID:    w.folderID,
+			Name:        w.name,
+			MimeType:    mime.TypeByExtension(path.Ext(w.name)),
+			ExactFolder: true,
+			Reader:      w.tmp,
+			Replace:     w.replace,
+		})
+	} else {
+		_, err = w.uploadChunked()
+	}
+	if err != nil {
+		return fmt.Errorf("dav put: %w", err)
+	}
+	return nil
+}
+
+// uploadChunked stores the spooled body through the chunked upload
+// pipeline, encrypting and storing up to uploadParallel parts at once.
+func (w *writeFile) uploadChunked() (*models.File, error) {
+	totalChunks := int((w.size + uploadPartSize - 1) / uploadPartSize)
+	sess, err := w.fs.h.uploads.Create(w.fs.userID, w.fs.user.Username, w.name, w.folderID, totalChunks, w.size)
+	if err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+	defer w.fs.h.uploads.Delete(sess.ID)
+	sess.ExactFolder = true
+	sess.Replace = w.replace
+	if err := w.fs.h.files.BeginChunkedUpload(w.ctx, sess); err != nil {
+		return nil, err
+	}
+
+	sem := make(chan struct{}, uploadParallel)
+	for i := range totalChunks {
+		sem <- struct{}{}
+		part := make([]byte, min(uploadPartSize, w.size-int64(i)*uploadPartSize))
+		if _, err := io.ReadFull(w.tmp, part); err != nil {
+			<-sem
+			_, _ = sess.Wait()
+			_ = sess.Storage.AbortMultipartUpload(w.ctx, sess.ObjectKey, sess.MinioUploadID)
+			return nil, fmt.Errorf("read spool: %w", err)
+		}
+		sess.DispatchChunk(i)
+		go func() {
+			defer func() { <-sem }()
+			w.fs.h.files.EncryptAndUploadPart(w.ctx, sess, i, part)
+		}()
+	}
+	return w.fs.h.files.FinalizeChunkedUpload(w.ctx, sess)
+}
@@ -0,0 +1,425 @@
+package dav
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/services"
+	"apollo-sfs.com/api/sanitize"
+)
+
+// maxNameLength matches the limit the upload and folder routes apply.
+const maxNameLength = 255
+
+// node is a resolved path: the root, a folder or a file.
+type node struct {
+	folder *models.Folder
+	file   *models.File
+}
+
+func (n *node) isRoot() bool { return n.folder == nil && n.file == nil }
+
+// folderID is the id to use as a parent for children of n; nil for the root.
+func (n *node) folderID() *uuid.UUID {
+	if n.folder == nil {
+		return nil
+	}
+	return &n.folder.ID
+}
+
+func (n *node) info() *fileInfo {
+	switch {
+	case n.file != nil:
+		return fileStat(n.file)
+	case n.folder != nil:
+		return &fileInfo{name: n.folder.Name, modTime: n.folder.UpdatedAt, dir: true}
+	}
+	return &fileInfo{name: "/", dir: true}
+}
+
+// fileSystem implements webdav.FileSystem over one user's folders and files.
+// A new one is built for every request, so its path cache only has to
+// survive a single PROPFIND walk.
+type fileSystem struct {
+	h        *Handler
+	user     *models.User
+	userID   uuid.UUID
+	resolved map[string]*node
+	// putSize is the Content-Length of a PUT, or -1. A body that ends short
+	// of it was cut off and is not stored.
+	putSize int64
+}
+
+var _ webdav.FileSystem = (*fileSystem)(nil)
+
+func newFileSystem(h *Handler, user *models.User, userID uuid.UUID) *fileSystem {
+	return &fileSystem{h: h, user: user, userID: userID, resolved: make(map[string]*node), putSize: -1}
+}
+
+// splitPath cleans a slash-separated path and returns its segments; the root
+// has none.
+func splitPath(name string) []string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// validName reports whether name survives sanitize.Name unchanged. Names the
+// rest of the app would rewrite are refused rather than silently renamed,
+// which would leave the client looking for a path that does not exist.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && sanitize.Name(name, maxNameLength) == name
+}
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+func exists(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrExist}
+}
+
+// resolve walks segs from the root. A missing segment yields an
+// os.ErrNotExist path error; a file in the middle of the path is treated
+// the same.
+func (fs *fileSystem) resolve(ctx context.Context, segs []string) (*node, error) {
+	key := strings.Join(segs, "/")
+	if n, ok := fs.resolved[key]; ok {
+		return n, nil
+	}
+	n := &node{}
+	if len(segs) == 0 {
+		return n, nil
+	}
+	q, tx, err := fs.h.pool.ForUser(ctx, fs.userID)
+	if err != nil {
+		return nil, fmt.Errorf("dav resolve: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var parentID *uuid.UUID
+	for i, seg := range segs {
+		folder, err := q.FindFolderByParentAndName(ctx, fs.userID, parentID, seg)
+		if err == nil {
+			n.folder = folder
+			parentID = &folder.ID
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("dav resolve: find folder: %w", err)
+		}
+		if i < len(segs)-1 {
+			return nil, notExist("stat", "/"+key)
+		}
+		file, err := q.FindFileByFolderAndName(ctx, fs.userID, parentID, seg)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, notExist("stat", "/"+key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dav resolve: find file: %w", err)
+		}
+		n.folder, n.file = nil, file
+	}
+	fs.resolved[key] = n
+	return n, nil
+}
+
+// resolveParent resolves the folder that holds the last segment of segs and
+// returns it along with that segment.
+func (fs *fileSystem) resolveParent(ctx context.Context, op, name string, segs []string) (*node, string, error) {
+	if len(segs) == 0 {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+	}
+	parent, err := fs.resolve(ctx, segs[:len(segs)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	if parent.file != nil {
+		return nil, "", notExist(op, name)
+	}
+	leaf := segs[len(segs)-1]
+	if !validName(leaf) {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	return parent, leaf, nil
+}
+
+// forget drops cached lookups after a mutation.
+func (fs *fileSystem) forget() {
+	clear(fs.resolved)
+}
+
+// Stat implements webdav.FileSystem.
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	n, err := fs.resolve(ctx, splitPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+// Mkdir implements webdav.FileSystem (MKCOL).
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	segs := splitPath(name)
+	parent, leaf, err := fs.resolveParent(ctx, "mkdir", name, segs)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.resolve(ctx, segs); err == nil {
+		return exists("mkdir", name)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	fs.forget()
+	_, err = fs.h.folders.Create(ctx, fs.userID, parent.folderID(), leaf, models.FolderKindRegular)
+	switch {
+	case errors.Is(err, services.ErrDuplicateFolderName):
+		return exists("mkdir", name)
+	case errors.Is(err, services.ErrFolderNotFound):
+		return notExist("mkdir", name)
+	}
+	return err
+}
+
+// OpenFile implements webdav.FileSystem. Reads are lazy: nothing is fetched
+// from storage until the first Read, so a PROPFIND over a large folder only
+// touches the database.
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	segs := splitPath(name)
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		n, err := fs.resolve(ctx, segs)
+		if err != nil {
+			return nil, err
+		}
+		if n.file != nil {
+			return &readFile{fs: fs, ctx: ctx, file: n.file}, nil
+		}
+		return &dirFile{fs: fs, ctx: ctx, node: n}, nil
+	}
+
+	parent, leaf, err := fs.resolveParent(ctx, "open", name, segs)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := fs.resolve(ctx, segs)
+	switch {
+	case err == nil && existing.file == nil:
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	case err == nil && flag&os.O_EXCL != 0:
+		return nil, exists("open", name)
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, err
+	}
+	var replace *models.File
+	if err == nil {
+		replace = existing.file
+	}
+	tmp, err := os.CreateTemp("", "dav-put-*")
+	if err != nil {
+		return nil, fmt.Errorf("dav open: spool: %w", err)
+	}
+	return &writeFile{fs: fs, ctx: ctx, folderID: parent.folderID(), name: leaf, replace: replace, tmp: tmp}, nil
+}
+
+// RemoveAll implements webdav.FileSystem (DELETE, and the overwrite half
+// of COPY and MOVE). Folders are emptied depth-first because
+// FolderService.Delete only removes empty folders. The root cannot be
+// removed.
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	n, err := fs.resolve(ctx, splitPath(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if n.isRoot() {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+	fs.forget()
+	if n.file != nil {
+		return fs.removeFile(ctx, n.file.ID)
+	}
+	return fs.removeFolder(ctx, n.folder.ID)
+}
+
+func (fs *fileSystem) removeFile(ctx context.Context, fileID uuid.UUID) error {
+	err := fs.h.files.Delete(ctx, fileID, fs.userID, fs.user.Username)
+	if errors.Is(err, services.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (fs *fileSystem) removeFolder(ctx context.Context, folderID uuid.UUID) error {
+	folders, files, err := fs.children(ctx, &folderID)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := fs.removeFile(ctx, f.ID); err != nil {
+			return err
+		}
+	}
+	for _, f := range folders {
+		if err := fs.removeFolder(ctx, f.ID); err != nil {
+			return err
+		}
+	}
+	err = fs.h.folders.Delete(ctx, folderID, fs.userID)
+	if errors.Is(err, services.ErrFolderNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Rename implements webdav.FileSystem (MOVE). The webdav package has
+// already removed an existing destination when the client asked to
+// overwrite it.
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	src, err := fs.resolve(ctx, splitPath(oldName))
+	if err != nil {
+		return err
+	}
+	if src.isRoot() {
+		return &os.PathError{Op: "rename", Path: oldName, Err: os.ErrPermission}
+	}
+	dstSegs := splitPath(newName)
+	parent, leaf, err := fs.resolveParent(ctx, "rename", newName, dstSegs)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.resolve(ctx, dstSegs); err == nil {
+		return exists("rename", newName)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	fs.forget()
+
+	q, tx, err := fs.h.pool.ForUser(ctx, fs.userID)
+	if err != nil {
+		return fmt.Errorf("dav rename: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	newParent := parent.folderID()
+	if src.file != nil {
+		err = renameFile(ctx, q, src.file, newParent, leaf)
+	} else {
+		err = renameFolder(ctx, q, src.folder, newParent, leaf)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func renameFile(ctx context.Context, q *db.Queries, f *models.File, parentID *uuid.UUID, name string) error {
+	if name != f.Name {
+		if _, err := q.UpdateFileName(ctx, f.ID, name); err != nil {
+			return fmt.Errorf("dav rename file: %w", err)
+		}
+	}
+	if sameParent(f.FolderID, parentID) {
+		return nil
+	}
+	var err error
+	if parentID == nil {
+		_, err = q.MoveFileToRoot(ctx, f.ID)
+	} else {
+		_, err = q.MoveFile(ctx, f.ID, *parentID)
+	}
+	if err != nil {
+		return fmt.Errorf("dav move file: %w", err)
+	}
+	return nil
+}
+
+func renameFolder(ctx context.Context, q *db.Queries, f *models.Folder, parentID *uuid.UUID, name string) error {
+	if !sameParent(f.ParentID, parentID) {
+		if parentID != nil {
+			cycle, err := q.FolderWouldCreateCycle(ctx, f.ID, *parentID)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return &os.PathError{Op: "rename", Path: f.Name, Err: services.ErrFolderCycle}
+			}
+		}
+		if _, err := q.UpdateFolderParent(ctx, f.ID, parentID); err != nil {
+			return fmt.Errorf("dav move folder: %w", err)
+		}
+	}
+	if name != f.Name {
+		if _, err := q.UpdateFolderName(ctx, f.ID, name); err != nil {
+			return fmt.Errorf("dav rename folder: %w", err)
+		}
+	}
+	return nil
+}
+
+func sameParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// children lists every folder and file directly inside folderID (nil for
+// the root), following pagination to the end.
+func (fs *fileSystem) children(ctx context.Context, folderID *uuid.UUID) ([]models.Folder, []models.File, error) {
+	q, tx, err := fs.h.pool.ForUser(ctx, fs.userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dav list: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var folders []models.Folder
+	for in := (db.PageInput{Limit: db.MaxPageLimit}); ; {
+		var page *db.PageResult[models.Folder]
+		if folderID == nil {
+			page, err = q.ListRootFolders(ctx, fs.userID, in)
+		} else {
+			page, err = q.ListFoldersByParent(ctx, fs.userID, *folderID, in)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("dav list folders: %w", err)
+		}
+		folders = append(folders, page.Items...)
+		if page.NextToken == "" {
+			break
+		}
+		in.Cursor = page.NextToken
+	}
+	var files []models.File
+	for in := (db.PageInput{Limit: db.MaxPageLimit}); ; {
+		var page *db.PageResult[models.File]
+		if folderID == nil {
+			page, err = q.ListRootFiles(ctx, fs.userID, in)
+		} else {
+			page, err = q.ListFilesByFolder(ctx, *folderID, in)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("dav list files: %w", err)
+		}
+		files = append(files, page.Items...)
+		if page.NextToken == "" {
+			break
+		}
+		in.Cursor = page.NextToken
+	}
+	return folders, files, nil
+}
@@ -0,0 +1,231 @@
+// Package dav serves a user's folders and files over WebDAV so the drive can
+// be mounted by desktop file managers (Finder, Windows Explorer, davfs2,
+// rclone). Requests are authenticated with an API key presented as the HTTP
+// Basic password; see middleware.RequireBasicAPIKey.
+package dav
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/middleware"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// Methods lists every HTTP method the WebDAV endpoint answers. cmd/main.go
+// registers Serve for each of them.
+var Methods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// FileServicer is the subset of *services.FileService used by the WebDAV
+// file system.
+type FileServicer interface {
+	Upload(ctx context.Context, in services.UploadInput) (*models.File, error)
+	CheckQuota(ctx context.Context, username string, additionalBytes int64) error
+	Download(ctx context.Context, fileID, userID uuid.UUID, username string) (*models.File, []byte, error)
+	DownloadRange(ctx context.Context, file *models.File, username string, rangeStart, rangeEnd int64) ([]byte, error)
+	Rename(ctx context.Context, fileID, userID uuid.UUID, name string) (*models.File, error)
+	Delete(ctx context.Context, fileID, userID uuid.UUID, username string) error
+	BeginChunkedUpload(ctx context.Context, sess *services.UploadSession) error
+	EncryptAndUploadPart(ctx context.Context, sess *services.UploadSession, index int, data []byte)
+	FinalizeChunkedUpload(ctx context.Context, sess *services.UploadSession) (*models.File, error)
+}
+
+// FolderServicer is the subset of *services.FolderService used by the WebDAV
+// file system.
+type FolderServicer interface {
+	Create(ctx context.Context, userID uuid.UUID, parentID *uuid.UUID, name string, kind string) (*models.Folder, error)
+	Delete(ctx context.Context, folderID, userID uuid.UUID) error
+}
+
+// UploadStore is the subset of *services.UploadSessionStore used for large
+// PUTs, which are stored through the chunked upload pipeline.
+type UploadStore interface {
+	Create(userID uuid.UUID, username, name string, folderID *uuid.UUID, totalChunks int, totalSize int64) (*services.UploadSession, error)
+	Delete(id uuid.UUID)
+}
+
+// APIKeyAuthorizer is the subset of *services.APIKeyService used to enforce
+// per-scope permissions on each request.
+type APIKeyAuthorizer interface {
+	Authorize(scopes []models.APIKeyScope, op, objectKey string) bool
+}
+
+// Compile-time checks that the concrete types satisfy these interfaces.
+var (
+	_ FileServicer     = (*services.FileService)(nil)
+	_ FolderServicer   = (*services.FolderService)(nil)
+	_ UploadStore      = (*services.UploadSessionStore)(nil)
+	_ APIKeyAuthorizer = (*services.APIKeyService)(nil)
+)
+
+// Handler serves /api/v1/dav/*. Constructed once at startup in
+// cmd/main.go:setupRouter.
+type Handler struct {
+	pool    *db.Queries // required to start ForUser txs
+	files   FileServicer
+	folders FolderServicer
+	uploads UploadStore
+	keys    APIKeyAuthorizer
+	prefix  string
+
+	resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)
+	userIDs       sync.Map // username → uuid.UUID; Keycloak ids never change
+
+	locks webdav.LockSystem // shared by every user; see userLocks
+}
+
+// NewHandler wires a WebDAV Handler mounted at prefix (e.g. "/api/v1/dav").
+// resolveUserID maps a username to the Keycloak id that owns its rows.
+func NewHandler(
+	q *db.Queries,
+	files FileServicer,
+	folders FolderServicer,
+	uploads UploadStore,
+	keys APIKeyAuthorizer,
+	prefix string,
+	resolveUserID func(ctx context.Context, username string) (uuid.UUID, error),
+) *Handler {
+	return &Handler{
+		pool:          q,
+		files:         files,
+		folders:       folders,
+		uploads:       uploads,
+		keys:          keys,
+		prefix:        strings.TrimSuffix(prefix, "/"),
+		resolveUserID: resolveUserID,
+		locks:         webdav.NewMemLS(),
+	}
+}
+
+// Serve handles every WebDAV method. It runs after RequireBasicAPIKey and
+// RequirePremiumAPI, checks the key's scopes against the request and hands
+// off to golang.org/x/net/webdav with a file system bound to the key owner.
+func (h *Handler) Serve(c *gin.Context) {
+	rawUser, _ := c.Get(middleware.CtxAPIKeyUser)
+	user, ok := rawUser.(*models.User)
+	if !ok || user == nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "invalid api key context"})
+		return
+	}
+	userID, err := h.userID(c.Request.Context(), user.Username)
+	if err != nil {
+		log.Printf("dav: resolve user %q: %v", user.Username, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "could not resolve user"})
+		return
+	}
+
+	if status := h.authorize(c); status != 0 {
+		c.AbortWithStatus(status)
+		return
+	}
+
+	// Reject a PUT that cannot fit before the body is spooled to disk. Bodies
+	// without a Content-Length are checked again when the upload is stored.
+	if c.Request.Method == http.MethodPut && c.Request.ContentLength > 0 {
+		if err := h.files.CheckQuota(c.Request.Context(), user.Username, c.Request.ContentLength); err != nil {
+			if errors.Is(err, services.ErrQuotaExceeded) {
+				c.AbortWithStatus(http.StatusInsufficientStorage)
+				return
+			}
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	fs := newFileSystem(h, user, userID)
+	if c.Request.Method == http.MethodPut {
+		fs.putSize = c.Request.ContentLength
+	}
+	srv := &webdav.Handler{
+		Prefix:     h.prefix,
+		FileSystem: fs,
+		LockSystem: newUserLocks(h.locks, userID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !os.IsNotExist(err) && !errors.Is(err, os.ErrExist) {
+				log.Printf("dav %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	srv.ServeHTTP(c.Writer, c.Request)
+}
+
+// userID returns the Keycloak id for username, caching it for the life of
+// the process so a chatty client does not hit Keycloak on every request.
+func (h *Handler) userID(ctx context.Context, username string) (uuid.UUID, error) {
+	if v, ok := h.userIDs.Load(username); ok {
+		return v.(uuid.UUID), nil
+	}
+	id, err := h.resolveUserID(ctx, username)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	h.userIDs.Store(username, id)
+	return id, nil
+}
+
+// authorize checks the API key scopes for the request path and, for COPY
+// and MOVE, the Destination path. Returns 0 when allowed, otherwise the
+// status to answer with.
+func (h *Handler) authorize(c *gin.Context) int {
+	raw, _ := c.Get(middleware.CtxAPIKeyScopes)
+	scopes, _ := raw.([]models.APIKeyScope)
+
+	src := h.objectKey(c.Request.URL.Path)
+	srcOp, dstOp := scopeOps(c.Request.Method)
+	if srcOp != "" && !h.keys.Authorize(scopes, srcOp, src) {
+		return http.StatusForbidden
+	}
+	if dstOp == "" {
+		return 0
+	}
+	u, err := url.Parse(c.GetHeader("Destination"))
+	if err != nil || u.Path == "" {
+		return http.StatusBadRequest
+	}
+	if !h.keys.Authorize(scopes, dstOp, h.objectKey(u.Path)) {
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// objectKey maps a request path to the key API key scopes are matched
+// against: the path below the mount point, without a leading slash.
+func (h *Handler) objectKey(p string) string {
+	return strings.Join(splitPath(strings.TrimPrefix(p, h.prefix)), "/")
+}
+
+// scopeOps returns the scope operation a method needs on its request path
+// and, for COPY and MOVE, on its Destination. An empty operation needs no
+// scope (OPTIONS).
+func scopeOps(method string) (src, dst string) {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "read", ""
+	case "PROPFIND":
+		return "list", ""
+	case http.MethodPut, "MKCOL", "PROPPATCH", "LOCK", "UNLOCK":
+		return "write", ""
+	case http.MethodDelete:
+		return "delete", ""
+	case "COPY":
+		return "read", "write"
+	case "MOVE":
+		return "delete", "write"
+	}
+	return "", ""
+}
@@ -0,0 +1,89 @@
+package dav
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+)
+
+// userLocks is one user's view of the lock system shared by every user.
+// Lock names are moved under /<user id> and tokens are prefixed with the
+// user id, so locks on the same path in two accounts never conflict and a
+// token issued to one user is never accepted from another (memLS tokens are
+// sequential, so they are easy to guess). Only held locks take memory in the
+// shared system; memLS drops each one when it is unlocked or expires.
+type userLocks struct {
+	ls     webdav.LockSystem
+	root   string // "/<user id>"
+	prefix string // "<user id>:"
+}
+
+func newUserLocks(ls webdav.LockSystem, userID uuid.UUID) *userLocks {
+	return &userLocks{ls: ls, root: "/" + userID.String(), prefix: userID.String() + ":"}
+}
+
+func (l *userLocks) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	if name0 != "" {
+		name0 = l.name(name0)
+	}
+	if name1 != "" {
+		name1 = l.name(name1)
+	}
+	scoped := make([]webdav.Condition, len(conditions))
+	for i, c := range conditions {
+		c.Token = l.inner(c.Token)
+		scoped[i] = c
+	}
+	return l.ls.Confirm(now, name0, name1, scoped...)
+}
+
+func (l *userLocks) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	details.Root = l.name(details.Root)
+	token, err := l.ls.Create(now, details)
+	if err != nil {
+		return "", err
+	}
+	return l.prefix + token, nil
+}
+
+func (l *userLocks) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	inner := l.inner(token)
+	if inner == "" {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+	details, err := l.ls.Refresh(now, inner, duration)
+	if err != nil {
+		return webdav.LockDetails{}, err
+	}
+	details.Root = strings.TrimPrefix(details.Root, l.root)
+	if details.Root == "" {
+		details.Root = "/"
+	}
+	return details, nil
+}
+
+func (l *userLocks) Unlock(now time.Time, token string) error {
+	inner := l.inner(token)
+	if inner == "" {
+		return webdav.ErrNoSuchLock
+	}
+	return l.ls.Unlock(now, inner)
+}
+
+// name moves a lock name under the user's root.
+func (l *userLocks) name(name string) string {
+	return l.root + path.Clean("/"+name)
+}
+
+// inner returns the shared system's token for one this user was given, or
+// "" (which matches no lock) for a token issued to anyone else.
+func (l *userLocks) inner(token string) string {
+	inner, ok := strings.CutPrefix(token, l.prefix)
+	if !ok {
+		return ""
+	}
+	return inner
+}
@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"apollo-sfs.com/api/routes/services"
+)
+
+var eventsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// StreamEvents checks the Origin header itself, before subscribing.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+const (
+	eventsWriteTimeout = 10 * time.Second
+	eventsPingInterval = 30 * time.Second
+)
+
+// StreamEvents handles GET /api/v1/events.
+// Upgrades to a WebSocket and pushes the caller's events as JSON text frames
+// ({"type", "data"}) until the client disconnects: "change" for every entry
+// of the change journal, "file.uploaded", "variant.ready", "quota.warning",
+// and "resync" when events may have been missed and the client should catch
+// up through GET /changes. Messages from the client are ignored.
+func (h *Handler) StreamEvents(c *gin.Context) {
+	if h.events == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "event stream is not configured"})
+		return
+	}
+	// Admin events are published for uuid.Nil; never hand those out.
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil || userID == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// The session cookie rides along on cross-site WebSocket handshakes, so
+	// a page on another site could otherwise read the caller's events.
+	// Clients other than browsers send no Origin and are let through.
+	if origin := c.GetHeader("Origin"); origin != "" && (h.eventsOrigin == "" || originOf(origin) != h.eventsOrigin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+		return
+	}
+
+	ch, err := h.events.Subscribe(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrTooManyEventStreams) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("StreamEvents: subscribe: user=%s err=%v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not open event stream"})
+		return
+	}
+	defer h.events.Unsubscribe(userID, ch)
+
+	conn, err := eventsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("StreamEvents: upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Read pump: detect client-side close frames without blocking the write pump.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Write pump: forward events and send keepalive pings.
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout)) //nolint:errcheck
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout)) //nolint:errcheck
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// originOf returns the lower-cased scheme://host[:port] of rawURL, or "" if
+// it has none.
+func originOf(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
@@ -93,10 +93,14 @@ func (h *Handler) UploadFile(c *gin.Context) {
 			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
 			return
 		}
-		if errors.Is(err, services.ErrDuplicateName) {
+		if errors.Is(err, services.ErrDuplicateName) || errors.Is(err, services.ErrDriveMoved) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("upload: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed"})
 		return
@@ -129,10 +133,13 @@ func (h *Handler) UploadFile(c *gin.Context) {
 // ── Get metadata ──────────────────────────────────────────────────────────────
 
 // fileResponse wraps File metadata with variant availability flags so the
-// frontend can render a quality toggle without a separate API call.
+// frontend can render a quality toggle without a separate API call, and with
+// the media metadata (null for files that have none).
 type fileResponse struct {
 	*models.File
-	HasLowVariant bool `json:"has_low_variant"`
+	HasLowVariant bool                  `json:"has_low_variant"`
+	HasThumbnail  bool                  `json:"has_thumbnail"`
+	MediaMetadata *models.MediaMetadata `json:"media_metadata"`
 }
 
 // GetFile handles GET /api/v1/files/:file_id.
@@ -156,10 +163,63 @@ func (h *Handler) GetFile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve file"})
 		return
 	}
+	media, err := h.files.MediaMetadata(ctx, file.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve file"})
+		return
+	}
 
 	c.JSON(http.StatusOK, &fileResponse{
 		File:          file,
 		HasLowVariant: h.files.HasReadyVariant(ctx, file.ID),
+		HasThumbnail:  h.files.HasThumbnail(ctx, file.ID),
+		MediaMetadata: media,
+	})
+}
+
+// StripFileLocation handles POST /api/v1/files/:file_id/strip-location.
+//
+// Removes the GPS position from a JPEG image or a video, both from the
+// stored file and from its media metadata, so it can be shared without
+// revealing where it was taken. Returns the updated file.
+func (h *Handler) StripFileLocation(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+	ctx := c.Request.Context()
+
+	file, err := h.files.StripLocation(ctx, fileID, userID, username)
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	case errors.Is(err, services.ErrLocationUnsupported):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrStorageUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("StripFileLocation: file=%s user=%s: %v", fileID, username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not strip location"})
+		return
+	}
+	media, err := h.files.MediaMetadata(ctx, file.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve file"})
+		return
+	}
+
+	c.JSON(http.StatusOK, &fileResponse{
+		File:          file,
+		HasLowVariant: h.files.HasReadyVariant(ctx, file.ID),
+		HasThumbnail:  h.files.HasThumbnail(ctx, file.ID),
+		MediaMetadata: media,
 	})
 }
 
@@ -196,6 +256,10 @@ func (h *Handler) serveDecrypted(c *gin.Context, inline bool) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 			return
 		}
+		if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("serveDecrypted: file=%s user=%s err=%v", fileID, username, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve file"})
 		return
@@ -271,7 +335,7 @@ func (h *Handler) StreamFile(c *gin.Context) {
 		file = &models.File{
 			ID:             file.ID,
 			UserID:         file.UserID,
-			MimeType:       "video/mp4",
+			MimeType:       variant.MimeType,
 			SizeBytes:      variant.SizeBytes,
 			MinIOObjectKey: variant.MinIOObjectKey,
 			Nonce:          []byte{}, // always chunked
@@ -308,6 +372,10 @@ func (h *Handler) StreamFile(c *gin.Context) {
 
 		chunk, err := h.files.DownloadRange(ctx, file, username, rangeStart, rangeEnd)
 		if err != nil {
+			if errors.Is(err, services.ErrStorageUnavailable) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
 			log.Printf("StreamFile: DownloadRange file=%s user=%s range=%d-%d: %v", fileID, username, rangeStart, rangeEnd, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not stream range"})
 			return
@@ -334,6 +402,10 @@ func (h *Handler) StreamFile(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 			return
 		}
+		if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("StreamFile: download file=%s user=%s: %v", fileID, username, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not stream file"})
 		return
@@ -343,6 +415,194 @@ func (h *Handler) StreamFile(c *gin.Context) {
 	http.ServeContent(c.Writer, c.Request, file.Name, file.UpdatedAt, bytes.NewReader(plaintext))
 }
 
+// GetThumbnail handles GET /api/v1/files/:file_id/thumbnail.
+//
+// Returns the decrypted JPEG thumbnail of an image, video or PDF. Files
+// uploaded before thumbnails existed get theirs rendered on the first
+// request, which answers 202 until it is ready.
+//
+// Query params:
+//
+//	size=small|large   (default small; 256 and 1024 px on the longest edge)
+func (h *Handler) GetThumbnail(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+	size := c.DefaultQuery("size", services.ThumbnailSmall)
+	if !services.ValidThumbnailSize(size) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be small or large"})
+		return
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+	ctx := c.Request.Context()
+
+	file, err := h.files.GetMetadata(ctx, fileID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve thumbnail"})
+		return
+	}
+
+	thumb, err := h.files.Thumbnail(ctx, file, username, size)
+	switch {
+	case errors.Is(err, services.ErrThumbnailPending):
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending"})
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "thumbnail not available"})
+	case errors.Is(err, services.ErrStorageUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("GetThumbnail: file=%s user=%s: %v", fileID, username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve thumbnail"})
+	default:
+		c.Header("Cache-Control", "private, max-age=86400")
+		c.Data(http.StatusOK, services.ThumbnailMimeType, thumb)
+	}
+}
+
+// ── HLS ──────────────────────────────────────────────────────────────────────
+
+// presignedHLSTTL bounds how long a master playlist stays playable: every
+// playlist and segment URL in it carries the same token.
+const presignedHLSTTL = 6 * time.Hour
+
+// GetHLSMaster handles GET /api/v1/files/:file_id/hls/master.m3u8.
+//
+// Returns the HLS master playlist of a video, listing the renditions ready to
+// play. The rendition playlist and segment URLs are presigned, so players
+// that do not send the session cookie can follow them. Videos uploaded
+// before HLS existed get encoded on the first request, which answers 202
+// until the first rendition is ready.
+func (h *Handler) GetHLSMaster(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+	ctx := c.Request.Context()
+
+	file, err := h.files.GetMetadata(ctx, fileID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve playlist"})
+		return
+	}
+
+	renditions, err := h.files.HLSRenditions(ctx, file, username)
+	switch {
+	case errors.Is(err, services.ErrHLSPending):
+		c.Header("Retry-After", "10")
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending"})
+		return
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "HLS not available"})
+		return
+	case err != nil:
+		log.Printf("GetHLSMaster: file=%s user=%s: %v", fileID, username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve playlist"})
+		return
+	}
+
+	token, _, err := h.presign.IssueForFile(fileID.String(), userID.String(), username, services.PresignActionHLS, presignedHLSTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, services.HLSPlaylistMimeType, services.MasterPlaylist(renditions, token))
+}
+
+// GetHLSAsset handles GET /api/v1/files/:file_id/hls/:rendition/:name?token=.
+//
+// Token-authenticated: serves one decrypted file of a rendition (its media
+// playlist, init segment or a media segment). Media playlists are rewritten
+// so every segment URL carries the same token.
+func (h *Handler) GetHLSAsset(c *gin.Context) {
+	fileIDStr := c.Param("file_id")
+	fileID, err := uuid.Parse(fileIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+	rendition, name := c.Param("rendition"), c.Param("name")
+	if _, ok := services.HLSRenditionByName(rendition); !ok || !services.ValidHLSAsset(name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token is required"})
+		return
+	}
+	claim, err := h.presign.ValidateForFile(token, services.PresignActionHLS)
+	if err != nil {
+		if errors.Is(err, services.ErrPresignExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": "presigned URL has expired"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid presigned token"})
+		return
+	}
+	if claim.FileID != fileIDStr {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid presigned token"})
+		return
+	}
+	userID, err := uuid.Parse(claim.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid presigned token"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	file, err := h.files.GetMetadata(ctx, fileID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve segment"})
+		return
+	}
+
+	data, err := h.files.HLSAsset(ctx, file, claim.Username, rendition, name)
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	case errors.Is(err, services.ErrStorageUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("GetHLSAsset: file=%s user=%s %s/%s: %v", fileID, claim.Username, rendition, name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve segment"})
+		return
+	}
+
+	if services.IsHLSPlaylist(name) {
+		c.Header("Cache-Control", "no-store")
+		data = services.SignHLSPlaylist(data, token)
+	} else {
+		c.Header("Cache-Control", "private, max-age=86400")
+	}
+	c.Data(http.StatusOK, services.HLSAssetMimeType(name), data)
+}
+
 // parseRange parses a single "bytes=start-end" Range header for a resource of
 // the given size. Returns the inclusive [start, end] after clamping.
 // Returns ok=false for malformed headers, unsatisfiable ranges, or multi-range
@@ -489,6 +749,47 @@ func (h *Handler) UpdateFile(c *gin.Context) {
 	c.JSON(http.StatusOK, updated)
 }
 
+type setFileTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SetFileTags handles PUT /api/v1/files/:file_id/tags.
+// Replaces the file's tags. Body: {"tags": ["holiday", "2024"]}; an empty
+// list clears them. Tags are trimmed and lower-cased.
+func (h *Handler) SetFileTags(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	var req setFileTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Tags == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tags is required"})
+		return
+	}
+	for i, t := range req.Tags {
+		req.Tags[i] = sanitize.String(t)
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	updated, err := h.files.SetTags(c.Request.Context(), fileID, userID, req.Tags)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidTag):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update file"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
 // ── Delete ────────────────────────────────────────────────────────────────────
 
 // DeleteFile handles DELETE /api/v1/files/:file_id.
@@ -700,8 +1001,10 @@ func (h *Handler) CompleteUpload(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, services.ErrQuotaExceeded) {
 			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
-		} else if errors.Is(err, services.ErrDuplicateName) {
+		} else if errors.Is(err, services.ErrDuplicateName) || errors.Is(err, services.ErrDriveMoved) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		} else {
 			log.Printf("complete upload %s: %v", uploadID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed"})
@@ -850,6 +1153,10 @@ func (h *Handler) servePresigned(c *gin.Context, inline bool) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 			return
 		}
+		if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("servePresigned: file=%s user=%s err=%v", fileID, claim.Username, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve file"})
 		return
@@ -1010,10 +1317,14 @@ func (h *Handler) UploadFilePresigned(c *gin.Context) {
 			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
 			return
 		}
-		if errors.Is(err, services.ErrDuplicateName) {
+		if errors.Is(err, services.ErrDuplicateName) || errors.Is(err, services.ErrDriveMoved) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("presigned upload: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed"})
 		return
@@ -1255,8 +1566,10 @@ func (h *Handler) CompleteUploadPresigned(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, services.ErrQuotaExceeded) {
 			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
-		} else if errors.Is(err, services.ErrDuplicateName) {
+		} else if errors.Is(err, services.ErrDuplicateName) || errors.Is(err, services.ErrDriveMoved) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrStorageUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		} else {
 			log.Printf("complete presigned upload %s: %v", uploadID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed"})
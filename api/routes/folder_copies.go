@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// copyFolderRequest is the body of CopyFolder. An empty parent_id places the
+// copy at root.
+type copyFolderRequest struct {
+	ParentID string `json:"parent_id"`
+}
+
+// CopyFolder handles POST /api/v1/folders/:folder_id/copy.
+// Clones the folder and its subfolders into parent_id right away and copies
+// the files beneath them in the background. Responds 202 with the copy
+// status, whose folder_id is the new folder.
+func (h *Handler) CopyFolder(c *gin.Context) {
+	if h.folderCopies == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "folder copy is not configured"})
+		return
+	}
+	folderID, err := uuid.Parse(c.Param("folder_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder_id"})
+		return
+	}
+
+	var req copyFolderRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+	}
+	var parentID *uuid.UUID
+	if req.ParentID != "" {
+		parsed, err := uuid.Parse(req.ParentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent_id must be a valid UUID"})
+			return
+		}
+		parentID = &parsed
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+
+	status, err := h.folderCopies.Start(c.Request.Context(), services.FolderCopyInput{
+		UserID:   userID,
+		Username: username,
+		FolderID: folderID,
+		ParentID: parentID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrFolderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		case errors.Is(err, services.ErrFolderCopyInProgress),
+			errors.Is(err, services.ErrFolderCopyCycle),
+			errors.Is(err, services.ErrDuplicateFolderName):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrQuotaExceeded):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrFolderCopyTooLarge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("copy folder: user=%s folder=%s err=%v", username, folderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not copy folder"})
+		}
+		return
+	}
+
+	h.logAudit(db.AuditInput{
+		TargetUsername: username,
+		ActorUsername:  username,
+		Action:         "folder_copied",
+		ResourceType:   strPtr("folder"),
+		ResourceID:     &status.FolderID,
+		ResourceName:   &status.Name,
+	})
+	c.JSON(http.StatusAccepted, status)
+}
+
+// GetFolderCopy handles GET /api/v1/folders/copies/:copy_id.
+// Returns the progress of a folder copy and the files that failed so far.
+func (h *Handler) GetFolderCopy(c *gin.Context) {
+	if h.folderCopies == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "folder copy is not configured"})
+		return
+	}
+	copyID, err := uuid.Parse(c.Param("copy_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid copy id"})
+		return
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	status, err := h.folderCopies.Get(copyID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"context"
+	"io"
 
 	"github.com/google/uuid"
 
@@ -32,6 +33,15 @@ type FileServicer interface {
 	CheckQuota(ctx context.Context, username string, additionalBytes int64) error
 	GetMetadata(ctx context.Context, fileID, userID uuid.UUID) (*models.File, error)
 	HasReadyVariant(ctx context.Context, fileID uuid.UUID) bool
+	HasThumbnail(ctx context.Context, fileID uuid.UUID) bool
+	MediaMetadata(ctx context.Context, fileID uuid.UUID) (*models.MediaMetadata, error)
+	StripLocation(ctx context.Context, fileID, userID uuid.UUID, username string) (*models.File, error)
+	SearchContent(ctx context.Context, userID uuid.UUID, username, query string, filter db.SearchFilter, page db.PageInput) (*db.PageResult[services.ContentHit], error)
+	FindDuplicates(ctx context.Context, userID uuid.UUID, threshold int) ([]services.DuplicateCluster, error)
+	ResolveDuplicates(ctx context.Context, userID uuid.UUID, username string, action services.DuplicateAction, groups []services.DuplicateGroup) (*services.DuplicateResolution, error)
+	Thumbnail(ctx context.Context, file *models.File, username, size string) ([]byte, error)
+	HLSRenditions(ctx context.Context, file *models.File, username string) ([]services.HLSRendition, error)
+	HLSAsset(ctx context.Context, file *models.File, username, rendition, name string) ([]byte, error)
 	Download(ctx context.Context, fileID, userID uuid.UUID, username string) (*models.File, []byte, error)
 	GetVariant(ctx context.Context, fileID uuid.UUID, quality string) (*models.VideoVariant, error)
 	DownloadRange(ctx context.Context, file *models.File, username string, rangeStart, rangeEnd int64) ([]byte, error)
@@ -39,6 +49,7 @@ type FileServicer interface {
 	Move(ctx context.Context, fileID, userID, newFolderID uuid.UUID) (*models.File, error)
 	Rename(ctx context.Context, fileID, userID uuid.UUID, name string) (*models.File, error)
 	SetHidden(ctx context.Context, fileID, userID uuid.UUID, hidden bool) (*models.File, error)
+	SetTags(ctx context.Context, fileID, userID uuid.UUID, tags []string) (*models.File, error)
 	Delete(ctx context.Context, fileID, userID uuid.UUID, username string) error
 	AdminDeleteAllFiles(ctx context.Context, username string) error
 	BeginChunkedUpload(ctx context.Context, sess *services.UploadSession) error
@@ -49,8 +60,11 @@ type FileServicer interface {
 // FolderServicer is the subset of *services.FolderService used by route handlers.
 type FolderServicer interface {
 	ListRoot(ctx context.Context, userID uuid.UUID, folderPage, filePage db.PageInput) (*services.FolderContents, error)
+	Search(ctx context.Context, userID uuid.UUID, term string, filter db.SearchFilter, folderPage, filePage db.PageInput) (*services.FolderContents, error)
 	GetContents(ctx context.Context, folderID, userID uuid.UUID, folderPage, filePage db.PageInput) (*services.FolderContents, error)
 	GetMediaContents(ctx context.Context, folderID, userID uuid.UUID, sort db.MediaSort, hidden db.HiddenFilter, folderPage, filePage db.PageInput) (*services.FolderContents, error)
+	GetMediaTimeline(ctx context.Context, folderID, userID uuid.UUID, hidden db.HiddenFilter, granularity db.TimelineGranularity, tz string) ([]db.TimelineBucket, error)
+	GetMediaGeo(ctx context.Context, folderID, userID uuid.UUID, hidden db.HiddenFilter, bbox db.BBox, grid int) ([]db.GeoCluster, error)
 	Create(ctx context.Context, userID uuid.UUID, parentID *uuid.UUID, name string, kind string) (*models.Folder, error)
 	Rename(ctx context.Context, folderID, userID uuid.UUID, name string) (*models.Folder, error)
 	Move(ctx context.Context, folderID, targetID, userID uuid.UUID) (*models.Folder, error)
@@ -61,9 +75,62 @@ type FolderServicer interface {
 	GetAncestors(ctx context.Context, folderID, userID uuid.UUID) ([]models.Folder, error)
 }
 
+// ArchiveServicer is the subset of *services.ArchiveService used by route handlers.
+type ArchiveServicer interface {
+	Create(ctx context.Context, userID uuid.UUID, username, name string, fileIDs, folderIDs []uuid.UUID) (*services.Archive, error)
+	Get(id, userID uuid.UUID) (*services.Archive, error)
+	Write(ctx context.Context, a *services.Archive, w io.Writer) error
+}
+
+// ImportServicer is the subset of *services.ImportService used by route handlers.
+type ImportServicer interface {
+	Start(ctx context.Context, in services.ImportInput) (*services.ImportStatus, error)
+	Get(id, userID uuid.UUID) (*services.ImportStatus, error)
+}
+
+// BulkServicer is the subset of *services.BulkService used by route handlers.
+type BulkServicer interface {
+	Apply(ctx context.Context, in services.BulkInput) (*services.BulkResult, error)
+}
+
+// FolderCopyServicer is the subset of *services.FolderCopyService used by route handlers.
+type FolderCopyServicer interface {
+	Start(ctx context.Context, in services.FolderCopyInput) (*services.FolderCopyStatus, error)
+	Get(id, userID uuid.UUID) (*services.FolderCopyStatus, error)
+}
+
+// ChangeServicer is the subset of *services.ChangeService used by route handlers.
+type ChangeServicer interface {
+	List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*services.ChangePage, error)
+}
+
+// WebhookServicer is the subset of *services.WebhookService used by route handlers.
+type WebhookServicer interface {
+	Create(ctx context.Context, userID uuid.UUID, username string, isAdmin bool, in services.WebhookInput) (*models.Webhook, error)
+	List(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error)
+	Get(ctx context.Context, userID, id uuid.UUID) (*models.Webhook, error)
+	Update(ctx context.Context, userID uuid.UUID, isAdmin bool, id uuid.UUID, in services.WebhookUpdate) (*models.Webhook, error)
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+	Deliveries(ctx context.Context, userID, id uuid.UUID, page db.PageInput) (*db.PageResult[models.WebhookDelivery], error)
+	Test(ctx context.Context, userID, id uuid.UUID) (*models.WebhookDelivery, error)
+}
+
+// EventServicer is the subset of *services.EventService used by route handlers.
+type EventServicer interface {
+	Subscribe(userID uuid.UUID) (chan []byte, error)
+	Unsubscribe(userID uuid.UUID, ch chan []byte)
+}
+
 // Compile-time checks that the concrete service types satisfy these interfaces.
 var _ FileServicer = (*services.FileService)(nil)
 var _ FolderServicer = (*services.FolderService)(nil)
+var _ ArchiveServicer = (*services.ArchiveService)(nil)
+var _ ImportServicer = (*services.ImportService)(nil)
+var _ BulkServicer = (*services.BulkService)(nil)
+var _ FolderCopyServicer = (*services.FolderCopyService)(nil)
+var _ ChangeServicer = (*services.ChangeService)(nil)
+var _ EventServicer = (*services.EventService)(nil)
+var _ WebhookServicer = (*services.WebhookService)(nil)
 
 // Handler holds shared dependencies for route handlers in the routes package.
 // Methods on Handler implement the individual endpoint logic.
@@ -79,6 +146,14 @@ type Handler struct {
 	email           *services.EmailService
 	presign         *services.PresignService
 	apiKeys         *services.APIKeyService
+	archives        ArchiveServicer
+	imports         ImportServicer
+	bulk            BulkServicer
+	folderCopies    FolderCopyServicer
+	changes         ChangeServicer
+	events          EventServicer
+	eventsOrigin    string // scheme://host browsers may open the event stream from
+	webhooks        WebhookServicer
 	turnstileSecret string
 	// verifyCaptcha overrides the real Turnstile HTTP call. When nil the
 	// production verifyTurnstile function is used.
@@ -116,6 +191,50 @@ func SetAPIKeyService(h *Handler, svc *services.APIKeyService) {
 	h.apiKeys = svc
 }
 
+// SetArchiveService installs the archive service on an existing Handler.
+// When unset the archive endpoints return 503.
+func SetArchiveService(h *Handler, svc ArchiveServicer) {
+	h.archives = svc
+}
+
+// SetImportService installs the archive import service on an existing
+// Handler. When unset the import endpoints return 503.
+func SetImportService(h *Handler, svc ImportServicer) {
+	h.imports = svc
+}
+
+// SetBulkService installs the bulk operations service on an existing
+// Handler. When unset the bulk endpoint returns 503.
+func SetBulkService(h *Handler, svc BulkServicer) {
+	h.bulk = svc
+}
+
+// SetFolderCopyService installs the folder copy service on an existing
+// Handler. When unset the folder copy endpoints return 503.
+func SetFolderCopyService(h *Handler, svc FolderCopyServicer) {
+	h.folderCopies = svc
+}
+
+// SetChangeService installs the change feed service on an existing Handler.
+// When unset the change feed endpoint returns 503.
+func SetChangeService(h *Handler, svc ChangeServicer) {
+	h.changes = svc
+}
+
+// SetEventService installs the user event stream service on an existing
+// Handler. When unset the event stream endpoint returns 503. Browsers may
+// only open the stream from a page served at appBaseURL.
+func SetEventService(h *Handler, svc EventServicer, appBaseURL string) {
+	h.events = svc
+	h.eventsOrigin = originOf(appBaseURL)
+}
+
+// SetWebhookService installs the webhook service on an existing Handler.
+// When unset the webhook endpoints return 503.
+func SetWebhookService(h *Handler, svc WebhookServicer) {
+	h.webhooks = svc
+}
+
 // SetInviteService replaces the invite service on an existing Handler.
 // Provided so test packages can inject stub implementations.
 func SetInviteService(h *Handler, svc InviteService) {
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/routes/services"
+	"apollo-sfs.com/api/sanitize"
+)
+
+// ImportArchive handles POST /api/v1/files/import-archive.
+// Accepts a multipart form with an optional folder_id field followed by a
+// file field holding a zip, tar or tar.gz archive. The archive is read
+// straight from the request body rather than through c.FormFile, so a
+// multi-gigabyte export is written to disk once; that is also why folder_id
+// must come before file. Responds 202 with the import status once the
+// archive has passed its checks; extraction continues in the background.
+func (h *Handler) ImportArchive(c *gin.Context) {
+	if h.imports == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "archive import is not configured"})
+		return
+	}
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart/form-data body"})
+		return
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+
+	var folderID *uuid.UUID
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file field is required"})
+			return
+		}
+		if err != nil {
+			log.Printf("import archive: read multipart body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "upload interrupted — please retry"})
+			return
+		}
+
+		switch part.FormName() {
+		case "folder_id":
+			raw, _ := io.ReadAll(io.LimitReader(part, 64))
+			if len(raw) == 0 {
+				continue
+			}
+			parsed, err := uuid.Parse(string(raw))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "folder_id must be a valid UUID"})
+				return
+			}
+			folderID = &parsed
+
+		case "file":
+			name := sanitize.Name(part.FileName(), 255)
+			status, err := h.imports.Start(c.Request.Context(), services.ImportInput{
+				UserID:   userID,
+				Username: username,
+				FolderID: folderID,
+				Name:     name,
+				Reader:   part,
+			})
+			if err != nil {
+				h.importError(c, username, err)
+				return
+			}
+
+			h.logAudit(db.AuditInput{
+				TargetUsername: username,
+				ActorUsername:  username,
+				Action:         "archive_imported",
+				ResourceType:   strPtr("import"),
+				ResourceID:     &status.ID,
+				ResourceName:   &status.Name,
+			})
+			c.JSON(http.StatusAccepted, status)
+			return
+		}
+	}
+}
+
+func (h *Handler) importError(c *gin.Context, username string, err error) {
+	switch {
+	case errors.Is(err, services.ErrImportInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImportTooLarge), errors.Is(err, services.ErrQuotaExceeded):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImportFormat),
+		errors.Is(err, services.ErrImportTooManyEntries),
+		errors.Is(err, services.ErrImportBomb):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImportInterrupted):
+		log.Printf("import archive: user=%s err=%v", username, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrImportInterrupted.Error()})
+	case errors.Is(err, services.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("import archive: user=%s err=%v", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "import failed"})
+	}
+}
+
+// GetArchiveImport handles GET /api/v1/files/import-archive/:import_id.
+// Returns the progress of an import and the entries that failed so far.
+func (h *Handler) GetArchiveImport(c *gin.Context) {
+	if h.imports == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "archive import is not configured"})
+		return
+	}
+	importID, err := uuid.Parse(c.Param("import_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import id"})
+		return
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	status, err := h.imports.Get(importID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
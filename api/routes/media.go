@@ -2,7 +2,11 @@ package routes
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -59,20 +63,146 @@ func (h *Handler) GetMediaFolder(c *gin.Context) {
 		parsePage(c, "file"),
 	)
 	if err != nil {
-		switch {
-		case errors.Is(err, services.ErrFolderNotFound):
-			c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
-		case errors.Is(err, services.ErrNotMediaCollection):
-			c.JSON(http.StatusBadRequest, gin.H{"error": "folder is not a media collection"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve media collection"})
-		}
+		writeMediaFolderError(c, err, "could not retrieve media collection")
 		return
 	}
 
 	c.JSON(http.StatusOK, contents)
 }
 
+// writeMediaFolderError maps media-collection lookup errors to HTTP
+// responses; anything unexpected becomes a 500 carrying fallback.
+func writeMediaFolderError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+	case errors.Is(err, services.ErrNotMediaCollection):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "folder is not a media collection"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// ── Timeline and map views ─────────────────────────────────────────────────
+
+const (
+	defaultGeoGrid = 32
+	maxGeoGrid     = 128
+)
+
+// GetMediaTimeline handles GET /api/v1/folders/:folder_id/media/timeline.
+// Query: granularity=year|month|day (default month), tz=<IANA zone> (default
+// UTC), hidden as for GetMediaFolder. Returns item counts per capture period,
+// newest first, for a timeline scrubber.
+func (h *Handler) GetMediaTimeline(c *gin.Context) {
+	folderID, err := uuid.Parse(c.Param("folder_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder_id"})
+		return
+	}
+
+	granularity := db.TimelineGranularity(c.DefaultQuery("granularity", string(db.TimelineMonth)))
+	switch granularity {
+	case db.TimelineYear, db.TimelineMonth, db.TimelineDay:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be year, month or day"})
+		return
+	}
+
+	// Validate here so an unknown zone is a 400 rather than a query error;
+	// the name itself is passed to Postgres, which shares the IANA database.
+	tz := c.DefaultQuery("tz", "UTC")
+	if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tz"})
+		return
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	buckets, err := h.folders.GetMediaTimeline(c.Request.Context(), folderID, userID, parseHiddenFilter(c), granularity, tz)
+	if err != nil {
+		writeMediaFolderError(c, err, "could not build timeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"granularity": granularity,
+		"time_zone":   tz,
+		"buckets":     buckets,
+	})
+}
+
+// GetMediaGeo handles GET /api/v1/folders/:folder_id/media/geo.
+// Query: bbox=west,south,east,north in decimal degrees (default the whole
+// world; west > east crosses the antimeridian), grid=1..128 cells per side
+// (default 32), hidden as for GetMediaFolder. Returns geotagged items
+// clustered per grid cell, largest cluster first.
+func (h *Handler) GetMediaGeo(c *gin.Context) {
+	folderID, err := uuid.Parse(c.Param("folder_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder_id"})
+		return
+	}
+
+	bbox := db.BBox{West: -180, South: -90, East: 180, North: 90}
+	if raw := c.Query("bbox"); raw != "" {
+		var ok bool
+		if bbox, ok = parseBBox(raw); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bbox must be west,south,east,north in degrees"})
+			return
+		}
+	}
+
+	grid := defaultGeoGrid
+	if raw := c.Query("grid"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxGeoGrid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "grid must be between 1 and 128"})
+			return
+		}
+		grid = n
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	clusters, err := h.folders.GetMediaGeo(c.Request.Context(), folderID, userID, parseHiddenFilter(c), bbox, grid)
+	if err != nil {
+		writeMediaFolderError(c, err, "could not build map view")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bbox":     []float64{bbox.West, bbox.South, bbox.East, bbox.North},
+		"grid":     grid,
+		"clusters": clusters,
+	})
+}
+
+// parseBBox parses "west,south,east,north". Latitudes must lie in [-90, 90]
+// with south < north, longitudes in [-180, 180] with west != east.
+func parseBBox(raw string) (db.BBox, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return db.BBox{}, false
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) {
+			return db.BBox{}, false
+		}
+		v[i] = f
+	}
+	b := db.BBox{West: v[0], South: v[1], East: v[2], North: v[3]}
+	if b.West < -180 || b.West > 180 || b.East < -180 || b.East > 180 || b.West == b.East {
+		return db.BBox{}, false
+	}
+	if b.South < -90 || b.North > 90 || b.South >= b.North {
+		return db.BBox{}, false
+	}
+	return b, true
+}
+
 // ── Hide / unhide ──────────────────────────────────────────────────────────
 
 // HideFile handles PATCH /api/v1/files/:file_id/hide.
@@ -218,10 +348,13 @@ type updatePreferencesRequest struct {
 	// MediaAutouploadFolderID: a media folder UUID to enable auto-upload, or null
 	// to disable it. The field must be present in the body.
 	MediaAutouploadFolderID *string `json:"media_autoupload_folder_id"`
+	// RecordLocation: whether GPS coordinates of uploaded media are kept.
+	// Omit to leave it unchanged; false also clears every stored location.
+	RecordLocation *bool `json:"record_location"`
 }
 
 // UpdatePreferences handles PUT /api/v1/me/preferences.
-// Body: {"media_autoupload_folder_id": "<uuid>" | null}.
+// Body: {"media_autoupload_folder_id": "<uuid>" | null, "record_location": bool}.
 func (h *Handler) UpdatePreferences(c *gin.Context) {
 	var req updatePreferencesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -262,5 +395,78 @@ func (h *Handler) UpdatePreferences(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save preferences"})
 		return
 	}
+	if req.RecordLocation != nil {
+		prefs, err = h.queries.SetRecordLocation(c.Request.Context(), username, *req.RecordLocation)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save preferences"})
+			return
+		}
+		if !*req.RecordLocation {
+			if _, err := h.queries.ClearUserMediaLocations(c.Request.Context(), userID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not clear stored locations"})
+				return
+			}
+		}
+	}
 	c.JSON(http.StatusOK, prefs)
 }
+
+// ── Duplicate photos ───────────────────────────────────────────────────────
+
+// GetMediaDuplicates handles GET /api/v1/me/media/duplicates.
+// Query: threshold=0..10, the Hamming distance between perceptual hashes up
+// to which images count as duplicates (default 4). Returns clusters of
+// visually similar images, each with a suggested copy to keep.
+func (h *Handler) GetMediaDuplicates(c *gin.Context) {
+	threshold := services.DefaultDuplicateThreshold
+	if raw := c.Query("threshold"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > services.MaxDuplicateThreshold {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be between 0 and 10"})
+			return
+		}
+		threshold = n
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	clusters, err := h.files.FindDuplicates(c.Request.Context(), userID, threshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find duplicates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"threshold": threshold, "clusters": clusters})
+}
+
+type resolveDuplicatesRequest struct {
+	// Action is "hide" or "delete" (permanent; there is no trash).
+	Action string                    `json:"action" binding:"required"`
+	Groups []services.DuplicateGroup `json:"groups" binding:"required"`
+}
+
+// ResolveMediaDuplicates handles POST /api/v1/me/media/duplicates/resolve.
+// Body: {"action": "hide"|"delete", "groups": [{"keep": "<uuid>", "discard": ["<uuid>", ...]}]}.
+// Keeps one copy per group and hides or deletes the others; files that are
+// not near-duplicates of their kept copy are reported back and left alone.
+func (h *Handler) ResolveMediaDuplicates(c *gin.Context) {
+	var req resolveDuplicatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	action := services.DuplicateAction(req.Action)
+	if action != services.DuplicateHide && action != services.DuplicateDelete {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be hide or delete"})
+		return
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+
+	res, err := h.files.ResolveDuplicates(c.Request.Context(), userID, username, action, req.Groups)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not resolve duplicates"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -44,30 +44,69 @@ func (m *APIKeyMiddleware) RequireAPIKey() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing api key"})
 			return
 		}
-		result, err := m.svc.Verify(c.Request.Context(), raw)
-		if err != nil {
-			switch {
-			case errors.Is(err, services.ErrAPIKeyMalformed),
-				errors.Is(err, services.ErrAPIKeyNotFound),
-				errors.Is(err, services.ErrAPIKeyRevoked),
-				errors.Is(err, services.ErrAPIKeyExpired),
-				errors.Is(err, services.ErrAPIKeyOwnerNotFound):
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
-				return
-			default:
-				log.Printf("RequireAPIKey: verify: %v", err)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
-				return
+		if m.verify(c, raw, "") {
+			c.Next()
+		}
+	}
+}
+
+// RequireBasicAPIKey is RequireAPIKey for clients that only speak HTTP Basic
+// auth, such as the WebDAV clients of desktop file managers: the username is
+// the key owner's and the password is the API key. A Bearer token is
+// accepted too. Failures carry a WWW-Authenticate challenge so the client
+// prompts for credentials.
+func (m *APIKeyMiddleware) RequireBasicAPIKey(realm string) gin.HandlerFunc {
+	challenge := `Basic realm="` + realm + `", charset="UTF-8"`
+	return func(c *gin.Context) {
+		username, raw, ok := c.Request.BasicAuth()
+		if !ok {
+			username, raw = "", extractBearer(c)
+		}
+		if raw == "" {
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing api key"})
+			return
+		}
+		if !m.verify(c, raw, username) {
+			if c.Writer.Status() == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", challenge)
 			}
+			return
 		}
-		c.Set(CtxAPIKey, result.Key)
-		c.Set(CtxAPIKeyID, result.Key.ID)
-		c.Set(CtxAPIKeyScopes, result.Scopes)
-		c.Set(CtxAPIKeyUser, result.User)
 		c.Next()
 	}
 }
 
+// verify checks raw and, when username is non-empty, that the key belongs
+// to that user. On success it populates the Gin context; otherwise it
+// aborts with 401 (or 500) and returns false.
+func (m *APIKeyMiddleware) verify(c *gin.Context, raw, username string) bool {
+	result, err := m.svc.Verify(c.Request.Context(), raw)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAPIKeyMalformed),
+			errors.Is(err, services.ErrAPIKeyNotFound),
+			errors.Is(err, services.ErrAPIKeyRevoked),
+			errors.Is(err, services.ErrAPIKeyExpired),
+			errors.Is(err, services.ErrAPIKeyOwnerNotFound):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+		default:
+			log.Printf("RequireAPIKey: verify: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		}
+		return false
+	}
+	if username != "" && !strings.EqualFold(username, result.User.Username) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+		return false
+	}
+	c.Set(CtxAPIKey, result.Key)
+	c.Set(CtxAPIKeyID, result.Key.ID)
+	c.Set(CtxAPIKeyScopes, result.Scopes)
+	c.Set(CtxAPIKeyUser, result.User)
+	return true
+}
+
 // RequirePremiumAPI asserts the API key's owner is premium or admin.
 // Returns 402 Payment Required for free users so clients can show a
 // targeted upgrade prompt.
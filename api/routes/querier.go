@@ -19,16 +19,14 @@ type Querier interface {
 	// User preferences
 	GetUserPreferences(ctx context.Context, userID string) (*models.UserPreferences, error)
 	SetMediaAutouploadFolder(ctx context.Context, userID string, folderID *uuid.UUID) (*models.UserPreferences, error)
+	SetRecordLocation(ctx context.Context, userID string, record bool) (*models.UserPreferences, error)
+	ClearUserMediaLocations(ctx context.Context, userID uuid.UUID) (int64, error)
 
 	// Ban / suspension enforcement (checked on every /me call)
 	GetActiveBan(ctx context.Context, username string) (*models.UserBan, error)
 	AutoPardonExpiredSuspension(ctx context.Context, username string) error
 	AddBannedIP(ctx context.Context, ip, jail string) error
 
-	// Search
-	SearchFoldersByUser(ctx context.Context, userID uuid.UUID, term string, in db.PageInput) (*db.PageResult[models.Folder], error)
-	SearchFilesByUser(ctx context.Context, userID uuid.UUID, term string, in db.PageInput) (*db.PageResult[models.File], error)
-
 	// Interest form
 	GetInterestFormSettings(ctx context.Context) (*models.InterestFormSettings, error)
 	CountInterestSubmissionsToday(ctx context.Context) (int, error)
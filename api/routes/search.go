@@ -1,67 +1,199 @@
 package routes
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"apollo-sfs.com/api/db"
-	"apollo-sfs.com/api/models"
 	"apollo-sfs.com/api/routes/services"
 	"apollo-sfs.com/api/sanitize"
 )
 
-// Search handles GET /api/v1/search?q=&folder_cursor=&file_cursor=&folder_limit=&file_limit=
+// searchResponse is the name matches of Search plus its content matches.
+type searchResponse struct {
+	services.FolderContents
+	Content *db.PageResult[services.ContentHit] `json:"content"`
+}
+
+// Search handles GET /api/v1/search?q=&folder_cursor=&file_cursor=&content_cursor=&folder_limit=&file_limit=&content_limit=
 //
 // Returns a page of folders and files owned by the authenticated user whose
-// names contain the query term (case-insensitive). Both lists are independently
-// paginated using the same cursor scheme as the folder listing endpoints.
-// Passing folder_limit=0 or file_limit=0 skips that list entirely, allowing the
-// client to advance one list independently once the other is exhausted.
+// names contain the query term (case-insensitive), and a page of files whose
+// indexed contents contain every word of it, ranked by relevance and each
+// with a snippet. The lists are independently paginated using the same
+// cursor scheme as the folder listing endpoints. Passing folder_limit=0,
+// file_limit=0 or content_limit=0 skips that list entirely, allowing the
+// client to advance one list independently once the others are exhausted.
+//
+// The filters of parseSearchFilter narrow every list (AND). q may be omitted
+// when a filter is given; the name lists then hold everything that matches
+// the filters and the content list is empty.
 func (h *Handler) Search(c *gin.Context) {
-	q := sanitize.String(strings.TrimSpace(c.Query("q")))
-	if q == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
-		return
-	}
-	if len(q) > 200 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "q must be 200 characters or fewer"})
+	q, filter, ok := parseSearchQuery(c, true)
+	if !ok {
 		return
 	}
 
 	userID, _ := uuid.Parse(c.GetString("userID"))
-	folderPage := parsePage(c, "folder")
-	filePage := parsePage(c, "file")
+	contentPage := parsePage(c, "content")
+	if q == "" {
+		contentPage.Skip = true
+	}
 
-	var subfolders *db.PageResult[models.Folder]
-	if folderPage.Skip {
-		subfolders = &db.PageResult[models.Folder]{Items: []models.Folder{}}
+	contents, err := h.folders.Search(c.Request.Context(), userID, q, filter, parsePage(c, "folder"), parsePage(c, "file"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+		return
+	}
+
+	var content *db.PageResult[services.ContentHit]
+	if contentPage.Skip {
+		content = &db.PageResult[services.ContentHit]{Items: []services.ContentHit{}}
 	} else {
-		var err error
-		subfolders, err = h.queries.SearchFoldersByUser(c.Request.Context(), userID, q, folderPage)
+		content, err = h.files.SearchContent(c.Request.Context(), userID, c.GetString("username"), q, filter, contentPage)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
 			return
 		}
 	}
 
-	var files *db.PageResult[models.File]
-	if filePage.Skip {
-		files = &db.PageResult[models.File]{Items: []models.File{}}
-	} else {
-		var err error
-		files, err = h.queries.SearchFilesByUser(c.Request.Context(), userID, q, filePage)
+	c.JSON(http.StatusOK, searchResponse{
+		FolderContents: *contents,
+		Content:        content,
+	})
+}
+
+// parseSearchQuery reads q and the search filters, writing a 400 and
+// returning ok=false when either is invalid. With requireOne, a request
+// carrying neither a term nor a filter is rejected too.
+func parseSearchQuery(c *gin.Context, requireOne bool) (q string, filter db.SearchFilter, ok bool) {
+	q = sanitize.String(strings.TrimSpace(c.Query("q")))
+	if len(q) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must be 200 characters or fewer"})
+		return "", filter, false
+	}
+	filter, err := parseSearchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", filter, false
+	}
+	if requireOne && q == "" && filter.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q or a filter is required"})
+		return "", filter, false
+	}
+	return q, filter, true
+}
+
+// parseSearchFilter reads the search filters from the query string:
+//
+//	type=image|video|document|archive
+//	min_size=, max_size=                  bytes, inclusive
+//	created_after=, created_before=       RFC 3339 or YYYY-MM-DD (UTC);
+//	updated_after=, updated_before=       after is inclusive, before exclusive
+//	taken_after=, taken_before=
+//	folder_id=&recursive=true             direct children, or the whole subtree
+//	favorites=true, hidden=true, tag=
+func parseSearchFilter(c *gin.Context) (db.SearchFilter, error) {
+	var f db.SearchFilter
+
+	if raw := c.Query("type"); raw != "" {
+		f.Category = db.FileCategory(raw)
+		if !f.Category.Valid() {
+			return f, errors.New("type must be image, video, document or archive")
+		}
+	}
+
+	var err error
+	if f.MinSize, err = querySize(c, "min_size"); err != nil {
+		return f, err
+	}
+	if f.MaxSize, err = querySize(c, "max_size"); err != nil {
+		return f, err
+	}
+	if f.MinSize != nil && f.MaxSize != nil && *f.MinSize > *f.MaxSize {
+		return f, errors.New("min_size must not exceed max_size")
+	}
+
+	for _, r := range []struct {
+		prefix string
+		dst    *db.TimeRange
+	}{{"created", &f.Created}, {"updated", &f.Updated}, {"taken", &f.Taken}} {
+		if r.dst.After, err = queryTime(c, r.prefix+"_after"); err != nil {
+			return f, err
+		}
+		if r.dst.Before, err = queryTime(c, r.prefix+"_before"); err != nil {
+			return f, err
+		}
+	}
+
+	if raw := c.Query("folder_id"); raw != "" {
+		id, err := uuid.Parse(raw)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
-			return
+			return f, errors.New("invalid folder_id")
 		}
+		f.FolderID = &id
+	}
+	if f.Recursive, err = queryBool(c, "recursive"); err != nil {
+		return f, err
+	}
+	if f.Recursive && f.FolderID == nil {
+		return f, errors.New("recursive requires folder_id")
+	}
+	if f.Favorites, err = queryBool(c, "favorites"); err != nil {
+		return f, err
+	}
+	if f.Hidden, err = queryBool(c, "hidden"); err != nil {
+		return f, err
 	}
 
-	c.JSON(http.StatusOK, services.FolderContents{
-		Folder:     nil,
-		Subfolders: subfolders,
-		Files:      files,
-	})
+	if raw, ok := c.GetQuery("tag"); ok {
+		if f.Tag, err = services.NormalizeTag(sanitize.String(raw)); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+func querySize(c *gin.Context, key string) (*int64, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative number of bytes", key)
+	}
+	return &n, nil
+}
+
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or YYYY-MM-DD date", key)
+}
+
+func queryBool(c *gin.Context, key string) (bool, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+	return b, nil
 }
@@ -273,6 +273,44 @@ func (s *AlarmService) checkAPIErrorRate(ctx context.Context, cfg *models.AlarmS
 	}
 }
 
+// ── Event-driven alarms ───────────────────────────────────────────────────────
+
+// NotifyIntegrityFailure raises the "integrity" alarm for subscribers. Unlike
+// the metric checks above it is not evaluated on the alarm ticker; the
+// integrity scrubber calls it at the end of a pass that found damaged or
+// missing objects. The usual cooldown applies.
+func (s *AlarmService) NotifyIntegrityFailure(ctx context.Context, detail string) {
+	settings, err := s.queries.GetAlarmSettings(ctx)
+	if err != nil {
+		log.Printf("alarm: load settings: %v", err)
+		return
+	}
+	if len(settings.IntegrityEmails) == 0 {
+		return
+	}
+	s.maybeNotify(ctx, "integrity", settings.IntegrityEmails, "Storage Integrity Failure", detail)
+}
+
+// NotifyServerDown raises the "server_down" alarm for h's server. The MinIO
+// registry calls it on every health check while the server stays down past
+// its grace period; the per-server cooldown keeps that to one email an hour.
+func (s *AlarmService) NotifyServerDown(ctx context.Context, h models.ServerHealth) {
+	settings, err := s.queries.GetAlarmSettings(ctx)
+	if err != nil {
+		log.Printf("alarm: load settings: %v", err)
+		return
+	}
+	if len(settings.ServerDownEmails) == 0 || h.DownSince == nil {
+		return
+	}
+	detail := fmt.Sprintf("Storage server \"%s\" (%s) has been unreachable since %s. Users whose drives are on it cannot access their files.",
+		h.ServerName, h.Endpoint, h.DownSince.Format(time.RFC1123))
+	if h.LastError != "" {
+		detail += " Last error: " + h.LastError
+	}
+	s.maybeNotify(ctx, "server_down_"+h.ServerID.String(), settings.ServerDownEmails, "Storage Server Down", detail)
+}
+
 // ── Notification helper ───────────────────────────────────────────────────────
 
 func (s *AlarmService) maybeNotify(ctx context.Context, key string, emails []string, title, detail string) {
@@ -291,10 +329,13 @@ func (s *AlarmService) maybeNotify(ctx context.Context, key string, emails []str
 	}
 
 	// Persist last_fired_at to DB so the admin UI can display it.
-	// drive_load uses a per-drive key prefix; strip the UUID suffix for the DB call.
+	// drive_load and server_down use a per-drive/per-server key prefix; strip
+	// the UUID suffix for the DB call.
 	dbType := key
-	if len(key) > len("drive_load_") && key[:len("drive_load_")] == "drive_load_" {
-		dbType = "drive_load"
+	for _, prefix := range []string{"drive_load_", "server_down_"} {
+		if len(key) > len(prefix) && key[:len(prefix)] == prefix {
+			dbType = prefix[:len(prefix)-1]
+		}
 	}
 	if err := s.queries.RecordAlarmFired(ctx, dbType); err != nil {
 		log.Printf("alarm: record fired for %q: %v", dbType, err)
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+// Allocation policy names, as used by ALLOCATION_POLICY and
+// invitations.allocation_policy.
+const (
+	AllocationBestFit     = "best-fit"
+	AllocationLeastLoaded = "least-loaded"
+	AllocationRoundRobin  = "round-robin"
+	AllocationTierAware   = "tier-aware"
+)
+
+var (
+	// ErrUnknownAllocationPolicy is returned for a policy name not listed above.
+	ErrUnknownAllocationPolicy = errors.New("unknown allocation policy")
+	// ErrAllocationDriveUnavailable is returned when a pinned drive is
+	// inactive, on an inactive or down server, or lacks room for the quota.
+	ErrAllocationDriveUnavailable = errors.New("the requested drive cannot take this allocation")
+)
+
+// ── Policies ──────────────────────────────────────────────────────────────────
+
+// AllocationRequest describes the user being placed on a drive.
+type AllocationRequest struct {
+	QuotaBytes int64
+	// Premium selects the premium drive tier under the tier-aware policy.
+	Premium bool
+	// DriveID pins the user to one drive, bypassing the policy.
+	DriveID *uuid.UUID
+	// Policy overrides the allocator's default policy when non-empty.
+	Policy string
+	// ExcludeDriveID is never chosen, e.g. the drive a drain is emptying.
+	ExcludeDriveID *uuid.UUID
+}
+
+// AllocationPolicy picks one drive for a new user. Candidates are never
+// empty and every one of them has room for req.QuotaBytes.
+type AllocationPolicy interface {
+	Name() string
+	Choose(req AllocationRequest, candidates []db.DriveCandidate) db.DriveCandidate
+}
+
+// bestFitPolicy packs users onto the fullest drive that still fits, keeping
+// large contiguous free space on the others for big quotas.
+type bestFitPolicy struct{}
+
+func (bestFitPolicy) Name() string { return AllocationBestFit }
+
+func (bestFitPolicy) Choose(_ AllocationRequest, candidates []db.DriveCandidate) db.DriveCandidate {
+	return minCandidate(candidates, func(a, b db.DriveCandidate) bool {
+		return a.FreeBytes() < b.FreeBytes()
+	})
+}
+
+// leastLoadedPolicy spreads users across drives by the share of capacity
+// already allocated, so drives of different sizes fill at the same rate.
+type leastLoadedPolicy struct{}
+
+func (leastLoadedPolicy) Name() string { return AllocationLeastLoaded }
+
+func (leastLoadedPolicy) Choose(_ AllocationRequest, candidates []db.DriveCandidate) db.DriveCandidate {
+	return minCandidate(candidates, func(a, b db.DriveCandidate) bool {
+		return loadRatio(a) < loadRatio(b)
+	})
+}
+
+// roundRobinPolicy places each user on the drive that least recently received
+// one; drives that never did come first.
+type roundRobinPolicy struct{}
+
+func (roundRobinPolicy) Name() string { return AllocationRoundRobin }
+
+func (roundRobinPolicy) Choose(_ AllocationRequest, candidates []db.DriveCandidate) db.DriveCandidate {
+	return minCandidate(candidates, func(a, b db.DriveCandidate) bool {
+		switch {
+		case a.LastAllocatedAt == nil:
+			return b.LastAllocatedAt != nil
+		case b.LastAllocatedAt == nil:
+			return false
+		default:
+			return a.LastAllocatedAt.Before(*b.LastAllocatedAt)
+		}
+	})
+}
+
+// tierAwarePolicy places premium users on premium-tier drives and everyone
+// else on standard ones, best-fit within the tier. When no drive of the
+// user's tier fits it falls back to the other tier rather than failing.
+type tierAwarePolicy struct{}
+
+func (tierAwarePolicy) Name() string { return AllocationTierAware }
+
+func (tierAwarePolicy) Choose(req AllocationRequest, candidates []db.DriveCandidate) db.DriveCandidate {
+	tier := models.DriveTierStandard
+	if req.Premium {
+		tier = models.DriveTierPremium
+	}
+	var matching []db.DriveCandidate
+	for _, c := range candidates {
+		if c.Drive.Tier == tier {
+			matching = append(matching, c)
+		}
+	}
+	if len(matching) == 0 {
+		matching = candidates
+	}
+	return bestFitPolicy{}.Choose(req, matching)
+}
+
+var allocationPolicies = map[string]AllocationPolicy{
+	AllocationBestFit:     bestFitPolicy{},
+	AllocationLeastLoaded: leastLoadedPolicy{},
+	AllocationRoundRobin:  roundRobinPolicy{},
+	AllocationTierAware:   tierAwarePolicy{},
+}
+
+// AllocationPolicyByName returns the policy registered under name.
+func AllocationPolicyByName(name string) (AllocationPolicy, error) {
+	p, ok := allocationPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAllocationPolicy, name)
+	}
+	return p, nil
+}
+
+// AllocationPolicyNames lists the registered policy names in sorted order.
+func AllocationPolicyNames() []string {
+	names := make([]string, 0, len(allocationPolicies))
+	for name := range allocationPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// minCandidate returns the first candidate for which no other is less.
+// Candidates arrive oldest drive first, so ties go to the oldest drive.
+func minCandidate(candidates []db.DriveCandidate, less func(a, b db.DriveCandidate) bool) db.DriveCandidate {
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if less(c, best) {
+			best = c
+		}
+	}
+	return best
+}
+
+func loadRatio(c db.DriveCandidate) float64 {
+	if c.Drive.CapacityBytes <= 0 {
+		return 1
+	}
+	return float64(c.AllocatedBytes) / float64(c.Drive.CapacityBytes)
+}
+
+// ── Allocator ─────────────────────────────────────────────────────────────────
+
+// DriveAllocator chooses the drive a new user is placed on.
+type DriveAllocator struct {
+	queries  *db.Queries
+	registry *MinIORegistry // optional — nil skips the server health check
+	policy   AllocationPolicy
+}
+
+// NewDriveAllocator constructs a DriveAllocator whose default policy is
+// policyName; an empty name selects best-fit.
+func NewDriveAllocator(q *db.Queries, registry *MinIORegistry, policyName string) (*DriveAllocator, error) {
+	if policyName == "" {
+		policyName = AllocationBestFit
+	}
+	policy, err := AllocationPolicyByName(policyName)
+	if err != nil {
+		return nil, err
+	}
+	return &DriveAllocator{queries: q, registry: registry, policy: policy}, nil
+}
+
+// Policy returns the name of the default policy.
+func (a *DriveAllocator) Policy() string {
+	return a.policy.Name()
+}
+
+// SelectDrive returns the drive req should be placed on. It does not record
+// the allocation. Returns ErrNoCapacity when no usable drive fits the quota.
+func (a *DriveAllocator) SelectDrive(ctx context.Context, req AllocationRequest) (*models.Drive, error) {
+	policy := a.policy
+	if req.Policy != "" {
+		p, err := AllocationPolicyByName(req.Policy)
+		if err != nil {
+			return nil, err
+		}
+		policy = p
+	}
+
+	candidates, err := a.queries.ListDriveCandidates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select drive: %w", err)
+	}
+	return chooseDrive(policy, req, candidates, a.serverStates())
+}
+
+// serverStates maps each registered server to its health state.
+func (a *DriveAllocator) serverStates() map[uuid.UUID]string {
+	if a.registry == nil {
+		return nil
+	}
+	health := a.registry.Health()
+	states := make(map[uuid.UUID]string, len(health))
+	for _, h := range health {
+		states[h.ServerID] = h.State
+	}
+	return states
+}
+
+// chooseDrive applies policy to the candidates that fit req. Drives on down
+// servers are never chosen; drives on degraded servers only when no drive on
+// a healthy server fits. Servers missing from states count as healthy.
+func chooseDrive(policy AllocationPolicy, req AllocationRequest, candidates []db.DriveCandidate, states map[uuid.UUID]string) (*models.Drive, error) {
+	if req.DriveID != nil {
+		for _, c := range candidates {
+			if c.Drive.ID != *req.DriveID {
+				continue
+			}
+			if states[c.Drive.ServerID] == models.ServerHealthDown || c.FreeBytes() < req.QuotaBytes {
+				return nil, ErrAllocationDriveUnavailable
+			}
+			return &c.Drive, nil
+		}
+		return nil, ErrAllocationDriveUnavailable
+	}
+
+	var healthy, degraded []db.DriveCandidate
+	for _, c := range candidates {
+		if c.FreeBytes() < req.QuotaBytes {
+			continue
+		}
+		if req.ExcludeDriveID != nil && c.Drive.ID == *req.ExcludeDriveID {
+			continue
+		}
+		switch states[c.Drive.ServerID] {
+		case models.ServerHealthDown:
+		case models.ServerHealthDegraded:
+			degraded = append(degraded, c)
+		default:
+			healthy = append(healthy, c)
+		}
+	}
+	for _, group := range [][]db.DriveCandidate{healthy, degraded} {
+		if len(group) > 0 {
+			chosen := policy.Choose(req, group)
+			return &chosen.Drive, nil
+		}
+	}
+	return nil, ErrNoCapacity
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+func candidate(label, tier string, capacity, allocated int64, last *time.Time) db.DriveCandidate {
+	return db.DriveCandidate{
+		Drive: models.Drive{
+			ID:            uuid.New(),
+			ServerID:      uuid.New(),
+			Label:         label,
+			CapacityBytes: capacity,
+			IsActive:      true,
+			Tier:          tier,
+		},
+		AllocatedBytes:  allocated,
+		LastAllocatedAt: last,
+	}
+}
+
+func TestAllocationPolicies(t *testing.T) {
+	hourAgo, dayAgo := time.Now().Add(-time.Hour), time.Now().Add(-24*time.Hour)
+	// small: 40 free of 100 (60%), big: 500 free of 1000 (50%),
+	// fast: 150 free of 200 (25%), full: 5 free.
+	small := candidate("small", models.DriveTierStandard, 100, 60, &hourAgo)
+	big := candidate("big", models.DriveTierStandard, 1000, 500, &dayAgo)
+	fast := candidate("fast", models.DriveTierPremium, 200, 50, nil)
+	full := candidate("full", models.DriveTierStandard, 100, 95, nil)
+	all := []db.DriveCandidate{small, big, fast, full}
+
+	cases := []struct {
+		policy string
+		req    AllocationRequest
+		want   string
+	}{
+		{AllocationBestFit, AllocationRequest{QuotaBytes: 10}, "small"},
+		{AllocationBestFit, AllocationRequest{QuotaBytes: 100}, "fast"},
+		{AllocationLeastLoaded, AllocationRequest{QuotaBytes: 10}, "fast"},
+		{AllocationRoundRobin, AllocationRequest{QuotaBytes: 10}, "fast"},
+		{AllocationRoundRobin, AllocationRequest{QuotaBytes: 200}, "big"},
+		{AllocationTierAware, AllocationRequest{QuotaBytes: 10}, "small"},
+		{AllocationTierAware, AllocationRequest{QuotaBytes: 10, Premium: true}, "fast"},
+		// No premium drive fits: fall back to the standard tier.
+		{AllocationTierAware, AllocationRequest{QuotaBytes: 300, Premium: true}, "big"},
+	}
+	for _, tc := range cases {
+		policy, err := AllocationPolicyByName(tc.policy)
+		if err != nil {
+			t.Fatalf("AllocationPolicyByName(%q): %v", tc.policy, err)
+		}
+		got, err := chooseDrive(policy, tc.req, all, nil)
+		if err != nil || got.Label != tc.want {
+			t.Errorf("%s %+v: got %v, %v; want %s", tc.policy, tc.req, got, err, tc.want)
+		}
+	}
+
+	if _, err := chooseDrive(bestFitPolicy{}, AllocationRequest{QuotaBytes: 600}, all, nil); !errors.Is(err, ErrNoCapacity) {
+		t.Errorf("oversized quota: got %v, want ErrNoCapacity", err)
+	}
+	if _, err := AllocationPolicyByName("random"); !errors.Is(err, ErrUnknownAllocationPolicy) {
+		t.Errorf("unknown policy: got %v", err)
+	}
+}
+
+func TestChooseDrive_ServerHealth(t *testing.T) {
+	small := candidate("small", models.DriveTierStandard, 100, 60, nil)
+	big := candidate("big", models.DriveTierStandard, 1000, 500, nil)
+	all := []db.DriveCandidate{small, big}
+	req := AllocationRequest{QuotaBytes: 10}
+
+	states := map[uuid.UUID]string{small.Drive.ServerID: models.ServerHealthDown}
+	if got, err := chooseDrive(bestFitPolicy{}, req, all, states); err != nil || got.Label != "big" {
+		t.Errorf("down server: got %v, %v; want big", got, err)
+	}
+
+	// A degraded server is only used when no healthy one fits.
+	states = map[uuid.UUID]string{small.Drive.ServerID: models.ServerHealthHealthy, big.Drive.ServerID: models.ServerHealthDegraded}
+	if got, err := chooseDrive(bestFitPolicy{}, AllocationRequest{QuotaBytes: 10}, all, states); err != nil || got.Label != "small" {
+		t.Errorf("degraded fallback unused: got %v, %v; want small", got, err)
+	}
+	if got, err := chooseDrive(bestFitPolicy{}, AllocationRequest{QuotaBytes: 100}, all, states); err != nil || got.Label != "big" {
+		t.Errorf("degraded fallback: got %v, %v; want big", got, err)
+	}
+
+	states = map[uuid.UUID]string{small.Drive.ServerID: models.ServerHealthDown, big.Drive.ServerID: models.ServerHealthDown}
+	if _, err := chooseDrive(bestFitPolicy{}, req, all, states); !errors.Is(err, ErrNoCapacity) {
+		t.Errorf("all servers down: got %v, want ErrNoCapacity", err)
+	}
+}
+
+func TestChooseDrive_ExcludedDrive(t *testing.T) {
+	small := candidate("small", models.DriveTierStandard, 100, 60, nil)
+	big := candidate("big", models.DriveTierStandard, 1000, 500, nil)
+	all := []db.DriveCandidate{small, big}
+
+	exclude := small.Drive.ID
+	if got, err := chooseDrive(bestFitPolicy{}, AllocationRequest{QuotaBytes: 10, ExcludeDriveID: &exclude}, all, nil); err != nil || got.Label != "big" {
+		t.Errorf("excluded drive: got %v, %v; want big", got, err)
+	}
+	exclude = big.Drive.ID
+	if _, err := chooseDrive(bestFitPolicy{}, AllocationRequest{QuotaBytes: 100, ExcludeDriveID: &exclude}, all, nil); !errors.Is(err, ErrNoCapacity) {
+		t.Errorf("only fit excluded: got %v, want ErrNoCapacity", err)
+	}
+}
+
+func TestChooseDrive_PinnedDrive(t *testing.T) {
+	small := candidate("small", models.DriveTierStandard, 100, 60, nil)
+	big := candidate("big", models.DriveTierStandard, 1000, 500, nil)
+	all := []db.DriveCandidate{small, big}
+
+	pin := big.Drive.ID
+	if got, err := chooseDrive(bestFitPolicy{}, AllocationRequest{QuotaBytes: 10, DriveID: &pin}, all, nil); err != nil || got.Label != "big" {
+		t.Errorf("pinned drive: got %v, %v; want big", got, err)
+	}
+
+	cases := map[string]struct {
+		pin    uuid.UUID
+		quota  int64
+		states map[uuid.UUID]string
+	}{
+		"too small":     {small.Drive.ID, 50, nil},
+		"server down":   {big.Drive.ID, 10, map[uuid.UUID]string{big.Drive.ServerID: models.ServerHealthDown}},
+		"not candidate": {uuid.New(), 10, nil},
+	}
+	for name, tc := range cases {
+		pin := tc.pin
+		if _, err := chooseDrive(bestFitPolicy{}, AllocationRequest{QuotaBytes: tc.quota, DriveID: &pin}, all, tc.states); !errors.Is(err, ErrAllocationDriveUnavailable) {
+			t.Errorf("%s: got %v, want ErrAllocationDriveUnavailable", name, err)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// MaxArchiveItems caps the files and folders selected for one archive.
+	// Folders count once however much they contain.
+	MaxArchiveItems = 1000
+	// archiveTTL is how long a prepared archive can be downloaded. It
+	// matches the presigned URL issued for it.
+	archiveTTL = time.Hour
+	// archiveWindow is how much plaintext of a chunked file is decrypted per
+	// storage round trip while it is written into an archive.
+	archiveWindow = 4 << 20
+)
+
+var (
+	ErrArchiveEmpty    = errors.New("select at least one file or folder")
+	ErrArchiveTooLarge = fmt.Errorf("an archive can hold at most %d selected files and folders", MaxArchiveItems)
+)
+
+// Archive is a prepared zip download: the selection is validated when it is
+// created and streamed, decrypting file by file, each time it is fetched.
+type Archive struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Username  string
+	Name      string
+	FileIDs   []uuid.UUID
+	FolderIDs []uuid.UUID
+	ExpiresAt time.Time
+}
+
+// ArchiveService prepares and streams zip archives of files and folders.
+// Prepared archives live in memory until they expire; a restart only costs
+// the user a fresh click.
+type ArchiveService struct {
+	queries  *db.Queries
+	files    *FileService
+	archives sync.Map // uuid.UUID → *Archive
+}
+
+// NewArchiveService creates an ArchiveService and starts its expiry loop.
+func NewArchiveService(q *db.Queries, files *FileService) *ArchiveService {
+	s := &ArchiveService{queries: q, files: files}
+	go s.cleanupLoop()
+	return s
+}
+
+// Create validates that every selected file and folder belongs to userID
+// and stores the selection for download. name is the archive's file name
+// without the .zip extension; empty picks one from the selection. Returns
+// ErrNotFound or ErrFolderNotFound for an id the user does not own.
+func (s *ArchiveService) Create(ctx context.Context, userID uuid.UUID, username, name string, fileIDs, folderIDs []uuid.UUID) (*Archive, error) {
+	fileIDs, folderIDs = dedupeIDs(fileIDs), dedupeIDs(folderIDs)
+	switch n := len(fileIDs) + len(folderIDs); {
+	case n == 0:
+		return nil, ErrArchiveEmpty
+	case n > MaxArchiveItems:
+		return nil, ErrArchiveTooLarge
+	}
+
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("create archive: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	var only string
+	for _, id := range fileIDs {
+		f, err := q.GetFileByID(ctx, id)
+		if err != nil || f.UserID != userID {
+			if err == nil || errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("create archive: get file: %w", err)
+		}
+		only = strings.TrimSuffix(f.Name, path.Ext(f.Name))
+	}
+	for _, id := range folderIDs {
+		f, err := q.GetFolderByID(ctx, id)
+		if err != nil || f.UserID != userID {
+			if err == nil || errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrFolderNotFound
+			}
+			return nil, fmt.Errorf("create archive: get folder: %w", err)
+		}
+		only = f.Name
+	}
+
+	if name == "" {
+		name = only
+		if len(fileIDs)+len(folderIDs) > 1 || name == "" {
+			name = "apollo-sfs-" + time.Now().UTC().Format("2006-01-02")
+		}
+	}
+	a := &Archive{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Username:  username,
+		Name:      name + ".zip",
+		FileIDs:   fileIDs,
+		FolderIDs: folderIDs,
+		ExpiresAt: time.Now().Add(archiveTTL),
+	}
+	s.archives.Store(a.ID, a)
+	return a, nil
+}
+
+// Get returns a prepared archive owned by userID. Returns ErrNotFound when
+// it does not exist, has expired or belongs to someone else.
+func (s *ArchiveService) Get(id, userID uuid.UUID) (*Archive, error) {
+	v, ok := s.archives.Load(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	a := v.(*Archive)
+	if a.UserID != userID || time.Now().After(a.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return a, nil
+}
+
+// Write streams a as a zip to w. Selected files sit at the top level and
+// selected folders keep their structure beneath them. Files and folders
+// deleted since the archive was created are skipped.
+//
+// Memory stays flat however large the archive is: folders are listed a
+// page at a time and chunked files are decrypted a window at a time.
+// Single-blob files are decrypted whole, as every download of them is.
+// Zip64 records are written automatically once an entry or the archive
+// passes 4 GiB.
+func (s *ArchiveService) Write(ctx context.Context, a *Archive, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	top := make(entryNames)
+	for _, id := range a.FileIDs {
+		f, err := s.file(ctx, a.UserID, id)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			continue
+		}
+		if err := s.writeFile(ctx, zw, a.Username, top.unique("", f.Name), f); err != nil {
+			return err
+		}
+	}
+	for _, id := range a.FolderIDs {
+		f, err := s.folder(ctx, a.UserID, id)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			continue
+		}
+		if err := s.writeFolder(ctx, zw, a, top.unique("", f.Name)+"/", f.ID); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeFolder adds the directory entry dir (ending in "/") and everything
+// beneath folderID.
+func (s *ArchiveService) writeFolder(ctx context.Context, zw *zip.Writer, a *Archive, dir string, folderID uuid.UUID) error {
+	if _, err := zw.Create(dir); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	names := make(entryNames)
+
+	for in := (db.PageInput{Limit: db.MaxPageLimit}); ; {
+		page, err := s.filePage(ctx, a.UserID, folderID, in)
+		if err != nil {
+			return err
+		}
+		for i := range page.Items {
+			f := &page.Items[i]
+			if err := s.writeFile(ctx, zw, a.Username, names.unique(dir, f.Name), f); err != nil {
+				return err
+			}
+		}
+		if page.NextToken == "" {
+			break
+		}
+		in.Cursor = page.NextToken
+	}
+
+	for in := (db.PageInput{Limit: db.MaxPageLimit}); ; {
+		page, err := s.folderPage(ctx, a.UserID, folderID, in)
+		if err != nil {
+			return err
+		}
+		for _, sub := range page.Items {
+			if err := s.writeFolder(ctx, zw, a, names.unique(dir, sub.Name)+"/", sub.ID); err != nil {
+				return err
+			}
+		}
+		if page.NextToken == "" {
+			break
+		}
+		in.Cursor = page.NextToken
+	}
+	return nil
+}
+
+// writeFile adds one decrypted file as the entry name.
+func (s *ArchiveService) writeFile(ctx context.Context, zw *zip.Writer, username, name string, f *models.File) error {
+	method := zip.Deflate
+	if incompressible(f.MimeType) {
+		method = zip.Store
+	}
+	ew, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: f.UpdatedAt.UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	if _, err := s.files.WritePlaintext(ctx, f, username, ew); err != nil {
+		return fmt.Errorf("archive %s: %w", f.ID, err)
+	}
+	return nil
+}
+
+// file loads a selected file, returning nil if it has since been deleted.
+func (s *ArchiveService) file(ctx context.Context, userID, id uuid.UUID) (*models.File, error) {
+	f, err := s.files.GetMetadata(ctx, id, userID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return f, err
+}
+
+// folder loads a selected folder, returning nil if it has since been
+// deleted.
+func (s *ArchiveService) folder(ctx context.Context, userID, id uuid.UUID) (*models.Folder, error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("archive: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	f, err := q.GetFolderByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("archive: get folder: %w", err)
+	}
+	return f, nil
+}
+
+// filePage and folderPage each hold a transaction only for one page, never
+// while file contents are being streamed.
+func (s *ArchiveService) filePage(ctx context.Context, userID, folderID uuid.UUID, in db.PageInput) (*db.PageResult[models.File], error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("archive: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	page, err := q.ListFilesByFolder(ctx, folderID, in)
+	if err != nil {
+		return nil, fmt.Errorf("archive: list files: %w", err)
+	}
+	return page, nil
+}
+
+func (s *ArchiveService) folderPage(ctx context.Context, userID, folderID uuid.UUID, in db.PageInput) (*db.PageResult[models.Folder], error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("archive: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	page, err := q.ListFoldersByParent(ctx, userID, folderID, in)
+	if err != nil {
+		return nil, fmt.Errorf("archive: list folders: %w", err)
+	}
+	return page, nil
+}
+
+func (s *ArchiveService) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		removed := 0
+		s.archives.Range(func(k, v any) bool {
+			if now.After(v.(*Archive).ExpiresAt) {
+				s.archives.Delete(k)
+				removed++
+			}
+			return true
+		})
+		if removed > 0 {
+			log.Printf("archives: expired %d", removed)
+		}
+	}
+}
+
+// ── Plaintext streaming ───────────────────────────────────────────────────────
+
+// WritePlaintext decrypts file and writes its plaintext to w. Chunked files
+// are decrypted archiveWindow bytes at a time so memory does not grow with
+// the file; single-blob files must be decrypted whole.
+func (s *FileService) WritePlaintext(ctx context.Context, file *models.File, username string, w io.Writer) (int64, error) {
+	if !IsChunked(file) {
+		plaintext, err := s.decryptBlob(ctx, username, file)
+		if err != nil {
+			return 0, err
+		}
+		n, err := w.Write(plaintext)
+		return int64(n), err
+	}
+	var written int64
+	for written < file.SizeBytes {
+		end := min(written+archiveWindow, file.SizeBytes) - 1
+		data, err := s.DownloadRange(ctx, file, username, written, end)
+		if err != nil {
+			return written, err
+		}
+		if len(data) == 0 {
+			return written, io.ErrUnexpectedEOF
+		}
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ── Helpers ───────────────────────────────────────────────────────────────────
+
+// entryNames hands out unique entry names within one archive directory.
+type entryNames map[string]bool
+
+// unique returns dir+name, with " (2)", " (3)"… inserted before the
+// extension if that entry is taken. Names that would escape the directory
+// are replaced.
+func (n entryNames) unique(dir, name string) string {
+	if name == "" || name == "." || name == ".." {
+		name = "_"
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; n[candidate]; i++ {
+		candidate = base + " (" + strconv.Itoa(i) + ")" + ext
+	}
+	n[candidate] = true
+	return dir + candidate
+}
+
+// incompressible reports whether a MIME type is already compressed, so
+// deflating it would only cost CPU.
+func incompressible(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"),
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"):
+		return mimeType != "image/bmp" && mimeType != "image/svg+xml"
+	}
+	switch mimeType {
+	case "application/zip", "application/gzip", "application/x-gzip",
+		"application/x-bzip2", "application/x-xz", "application/zstd",
+		"application/x-7z-compressed", "application/vnd.rar", "application/x-rar-compressed",
+		"application/pdf", "application/epub+zip":
+		return true
+	}
+	return false
+}
+
+func dedupeIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
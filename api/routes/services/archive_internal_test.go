@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEntryNamesUnique(t *testing.T) {
+	n := entryNames{}
+	got := []string{
+		n.unique("", "report.pdf"),
+		n.unique("", "report.pdf"),
+		n.unique("", "report.pdf"),
+		n.unique("", "Makefile"),
+		n.unique("", "Makefile"),
+		n.unique("", ".."),
+		n.unique("", ""),
+	}
+	want := []string{"report.pdf", "report (2).pdf", "report (3).pdf", "Makefile", "Makefile (2)", "_", "_ (2)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Each directory has its own set of names.
+	sub := entryNames{}
+	if got := sub.unique("photos/", "report.pdf"); got != "photos/report.pdf" {
+		t.Errorf("nested entry = %q", got)
+	}
+}
+
+func TestIncompressible(t *testing.T) {
+	for _, m := range []string{"image/jpeg", "video/mp4", "audio/mpeg", "application/zip", "application/pdf"} {
+		if !incompressible(m) {
+			t.Errorf("incompressible(%q) = false", m)
+		}
+	}
+	for _, m := range []string{"text/plain", "application/json", "image/bmp", "image/svg+xml", ""} {
+		if incompressible(m) {
+			t.Errorf("incompressible(%q) = true", m)
+		}
+	}
+}
+
+func TestDedupeIDs(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	if got := dedupeIDs([]uuid.UUID{a, b, a, b, a}); !reflect.DeepEqual(got, []uuid.UUID{a, b}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestArchiveGet(t *testing.T) {
+	s := &ArchiveService{}
+	owner := uuid.New()
+	live := &Archive{ID: uuid.New(), UserID: owner, ExpiresAt: time.Now().Add(time.Hour)}
+	stale := &Archive{ID: uuid.New(), UserID: owner, ExpiresAt: time.Now().Add(-time.Second)}
+	s.archives.Store(live.ID, live)
+	s.archives.Store(stale.ID, stale)
+
+	if a, err := s.Get(live.ID, owner); err != nil || a != live {
+		t.Errorf("Get(live) = %v, %v", a, err)
+	}
+	for name, args := range map[string][2]uuid.UUID{
+		"other user": {live.ID, uuid.New()},
+		"expired":    {stale.ID, owner},
+		"unknown":    {uuid.New(), owner},
+	} {
+		if _, err := s.Get(args[0], args[1]); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: err = %v, want ErrNotFound", name, err)
+		}
+	}
+}
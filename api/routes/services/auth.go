@@ -92,6 +92,11 @@ type AuthService struct {
 	// encryption service is wired in), random placeholder bytes are stored and
 	// must be replaced before the user can upload files.
 	ProvisionUserKey func(ctx context.Context) (encryptedKey, nonce []byte, masterKeyVersion string, err error)
+
+	// SelectDrive picks the drive a newly registered user is placed on
+	// (DriveAllocator.SelectDrive). When nil, registration falls back to a
+	// best-fit choice over all active drives.
+	SelectDrive func(ctx context.Context, req AllocationRequest) (*models.Drive, error)
 }
 
 // NewAuthService constructs an AuthService with a 10-second HTTP timeout.
@@ -212,13 +217,22 @@ func (s *AuthService) Register(ctx context.Context, username, email, password, i
 		quotaBytes = defaultQuotaBytes
 	}
 
-	// Select the best-fit drive before creating the user so we can fail fast
-	// if no drive has enough free capacity for the requested quota.
-	drive, err := s.queries.SelectDriveForQuota(ctx, quotaBytes)
+	// Select the drive before creating the user so we can fail fast if no
+	// drive has enough free capacity for the requested quota. The invitation
+	// may pin a drive or name a policy other than the default.
+	drive, err := s.selectDrive(ctx, AllocationRequest{
+		QuotaBytes: quotaBytes,
+		Premium:    inv.GrantAdmin,
+		DriveID:    inv.AllocationDriveID,
+		Policy:     derefString(inv.AllocationPolicy),
+	})
 	if err != nil {
 		if errors.Is(err, db.ErrNoCapacity) {
 			return nil, fmt.Errorf("register: no drive has sufficient capacity for the requested quota")
 		}
+		if errors.Is(err, ErrAllocationDriveUnavailable) {
+			return nil, fmt.Errorf("register: the drive reserved by the invitation cannot take the requested quota")
+		}
 		return nil, fmt.Errorf("register: select drive: %w", err)
 	}
 
@@ -358,6 +372,15 @@ func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword stri
 
 // ── Private helpers ───────────────────────────────────────────────────────────
 
+// selectDrive places a new user with SelectDrive when wired, otherwise with
+// the best-fit query (which ignores any pinned drive or policy override).
+func (s *AuthService) selectDrive(ctx context.Context, req AllocationRequest) (*models.Drive, error) {
+	if s.SelectDrive != nil {
+		return s.SelectDrive(ctx, req)
+	}
+	return s.queries.SelectDriveForQuota(ctx, req.QuotaBytes)
+}
+
 // tokenRequest posts form-encoded values to the Keycloak token endpoint.
 func (s *AuthService) tokenRequest(ctx context.Context, body url.Values) (*TokenPair, error) {
 	endpoint := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", s.kcURL, s.kcRealm)
@@ -0,0 +1,809 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	psdisk "github.com/shirou/gopsutil/v4/disk"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// backupFormat is bumped whenever the catalogue layout changes in a way
+	// an older restore command cannot read.
+	backupFormat = 1
+
+	backupBlobPrefix    = "blobs/"
+	backupRunPrefix     = "backups/"
+	backupCatalogueName = "catalogue.enc"
+	backupManifestName  = "manifest.json"
+
+	// backupKeyInfo domain-separates the catalogue key derived from the KEK.
+	backupKeyInfo = "apollo-sfs backup catalogue v1"
+	// backupVerifySample caps the problems listed in verify_error.
+	backupVerifySample = 10
+)
+
+// Backup target kinds accepted in BACKUP_TARGET.
+const (
+	BackupTargetFS   = "fs"
+	BackupTargetS3   = "s3"
+	BackupTargetSFTP = "sftp"
+)
+
+var (
+	// ErrBackupNotFound is returned when a backup ID is unknown.
+	ErrBackupNotFound = errors.New("backup not found")
+	// ErrBackupNotComplete is returned when verifying a backup that failed or
+	// is still being written.
+	ErrBackupNotComplete = errors.New("backup is not complete")
+	// ErrBackupBusy is returned when a backup or verification is already running.
+	ErrBackupBusy = errors.New("a backup job is already running")
+	// errBackupDamaged marks a catalogue whose checksum or GCM tag does not match.
+	errBackupDamaged = errors.New("backup catalogue is damaged or was sealed with another KEK")
+)
+
+// ── Target ────────────────────────────────────────────────────────────────────
+
+// BackupTargetConfig selects where backups are written. Kind "fs" writes to
+// Path, "s3" to a bucket on a second S3 endpoint, and "sftp" to Path as well,
+// where Path must be the mount point of the remote share (e.g. sshfs); the
+// mount is checked before every run so a dropped share is not silently
+// replaced by the local disk.
+type BackupTargetConfig struct {
+	Kind        string
+	Path        string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+}
+
+// BackupTarget is an opened backup destination.
+type BackupTarget struct {
+	// Name describes the target in logs and backup_runs, e.g. "s3:host/bucket".
+	Name  string
+	Store BlobStore
+	// check is run before every backup; it fails when the target is unusable.
+	check func(ctx context.Context) error
+}
+
+// OpenBackupTarget validates cfg and returns the target it describes. It does
+// not contact the target; that happens before every run.
+func OpenBackupTarget(cfg BackupTargetConfig) (*BackupTarget, error) {
+	switch cfg.Kind {
+	case BackupTargetFS, BackupTargetSFTP:
+		if !filepath.IsAbs(cfg.Path) {
+			return nil, fmt.Errorf("backup: %s target needs an absolute BACKUP_PATH (got %q)", cfg.Kind, cfg.Path)
+		}
+		root := filepath.Clean(cfg.Path)
+		fs := &fsBackend{root: root}
+		t := &BackupTarget{Name: cfg.Kind + ":" + root, Store: NewFSStore(root)}
+		if cfg.Kind == BackupTargetFS {
+			t.check = func(ctx context.Context) error {
+				if err := os.MkdirAll(root, 0o750); err != nil {
+					return err
+				}
+				return fs.Probe(ctx)
+			}
+		} else {
+			t.check = func(ctx context.Context) error {
+				if err := checkMountPoint(ctx, root); err != nil {
+					return err
+				}
+				return fs.Probe(ctx)
+			}
+		}
+		return t, nil
+	case BackupTargetS3:
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return nil, errors.New("backup: s3 target needs BACKUP_S3_ENDPOINT and BACKUP_S3_BUCKET")
+		}
+		core, err := NewS3Client(cfg.S3Endpoint, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3UseSSL)
+		if err != nil {
+			return nil, fmt.Errorf("backup: %w", err)
+		}
+		b := &s3Backend{core: core}
+		return &BackupTarget{
+			Name:  "s3:" + cfg.S3Endpoint + "/" + cfg.S3Bucket,
+			Store: b.Store(cfg.S3Bucket),
+			check: func(ctx context.Context) error { return b.EnsureBucket(ctx, cfg.S3Bucket) },
+		}, nil
+	default:
+		return nil, fmt.Errorf("backup: unknown target %q (want fs, s3 or sftp)", cfg.Kind)
+	}
+}
+
+// Check reports whether the target can be written to right now.
+func (t *BackupTarget) Check(ctx context.Context) error {
+	if t.check == nil {
+		return nil
+	}
+	if err := t.check(ctx); err != nil {
+		return fmt.Errorf("backup target %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// checkMountPoint fails unless path is itself a mount point.
+func checkMountPoint(ctx context.Context, path string) error {
+	parts, err := psdisk.PartitionsWithContext(ctx, true)
+	if err != nil {
+		return fmt.Errorf("list mounts: %w", err)
+	}
+	for _, p := range parts {
+		if filepath.Clean(p.Mountpoint) == path {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a mount point; is the remote share mounted?", path)
+}
+
+// ── Archive format ────────────────────────────────────────────────────────────
+
+// BackupManifest is backups/<id>/manifest.json. It is stored in the clear so
+// backups can be listed without the KEK; the catalogue it describes is sealed.
+type BackupManifest struct {
+	Format          int              `json:"format"`
+	ID              uuid.UUID        `json:"id"`
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at"`
+	Tables          map[string]int64 `json:"tables"`
+	BlobCount       int64            `json:"blob_count"`
+	BlobBytes       int64            `json:"blob_bytes"`
+	CatalogueBytes  int64            `json:"catalogue_bytes"`
+	CatalogueSHA256 string           `json:"catalogue_sha256"`
+}
+
+// BackupBlob is one blob referenced by a backup: the drive it was found on,
+// its object key and its stored (ciphertext) size. A blob replicated on two
+// drives appears twice but is stored on the target once.
+type BackupBlob struct {
+	DriveID uuid.UUID `json:"d"`
+	Key     string    `json:"k"`
+	Size    int64     `json:"s"`
+}
+
+// BackupArchive is the decrypted content of one backup.
+type BackupArchive struct {
+	Manifest BackupManifest
+	Rows     []db.CatalogueRow
+	Blobs    []BackupBlob
+}
+
+// backupRecord is one line of the catalogue: either a table row or a blob.
+type backupRecord struct {
+	Table string          `json:"t,omitempty"`
+	User  string          `json:"u,omitempty"`
+	Row   json.RawMessage `json:"r,omitempty"`
+	Blob  *BackupBlob     `json:"b,omitempty"`
+}
+
+func backupDir(id uuid.UUID) string {
+	return backupRunPrefix + id.String() + "/"
+}
+
+// backupKey derives the catalogue key from the KEK. Restoring therefore needs
+// the same KEY_ENCRYPTION_KEY as the instance that took the backup, which it
+// needs anyway to unwrap master_keys.
+func backupKey(kek []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, kek, nil, backupKeyInfo, 32)
+}
+
+// catalogueWriter accumulates the gzip NDJSON catalogue in memory.
+type catalogueWriter struct {
+	buf       bytes.Buffer
+	gz        *gzip.Writer
+	enc       *json.Encoder
+	tables    map[string]int64
+	blobCount int64
+	blobBytes int64
+}
+
+func newCatalogueWriter() *catalogueWriter {
+	w := &catalogueWriter{tables: make(map[string]int64)}
+	w.gz = gzip.NewWriter(&w.buf)
+	w.enc = json.NewEncoder(w.gz)
+	return w
+}
+
+func (w *catalogueWriter) row(r db.CatalogueRow) error {
+	w.tables[r.Table]++
+	return w.enc.Encode(backupRecord{Table: r.Table, User: r.User, Row: r.Row})
+}
+
+func (w *catalogueWriter) blob(b BackupBlob) error {
+	w.blobCount++
+	w.blobBytes += b.Size
+	return w.enc.Encode(backupRecord{Blob: &b})
+}
+
+// seal finishes the catalogue and encrypts it: nonce ‖ AES-256-GCM ciphertext.
+func (w *catalogueWriter) seal(kek []byte) ([]byte, error) {
+	if err := w.gz.Close(); err != nil {
+		return nil, err
+	}
+	key, err := backupKey(kek)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(key)
+	ct, nonce, err := aesGCMEncrypt(key, w.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, ct...), nil
+}
+
+// openCatalogue decrypts and parses a sealed catalogue.
+func openCatalogue(kek, sealed []byte) (rows []db.CatalogueRow, blobs []BackupBlob, err error) {
+	key, err := backupKey(kek)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zeroBytes(key)
+	if len(sealed) < 12 {
+		return nil, nil, errBackupDamaged
+	}
+	plain, err := aesGCMDecrypt(key, sealed[:12], sealed[12:])
+	if err != nil {
+		return nil, nil, errBackupDamaged
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, nil, fmt.Errorf("catalogue: %w", err)
+	}
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	for {
+		var rec backupRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("catalogue: %w", err)
+		}
+		if rec.Blob != nil {
+			blobs = append(blobs, *rec.Blob)
+		} else {
+			rows = append(rows, db.CatalogueRow{Table: rec.Table, User: rec.User, Row: rec.Row})
+		}
+	}
+	return rows, blobs, nil
+}
+
+// writeBackupArchive uploads the sealed catalogue, then the manifest. The
+// manifest goes last so its presence means the backup is complete.
+func writeBackupArchive(ctx context.Context, target BlobStore, m BackupManifest, sealed []byte) error {
+	dir := backupDir(m.ID)
+	if err := target.PutObject(ctx, dir+backupCatalogueName, bytes.NewReader(sealed), int64(len(sealed)), "application/octet-stream"); err != nil {
+		return fmt.Errorf("write catalogue: %w", err)
+	}
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := target.PutObject(ctx, dir+backupManifestName, bytes.NewReader(raw), int64(len(raw)), "application/json"); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+func readBackupManifest(ctx context.Context, target BlobStore, key string) (*BackupManifest, error) {
+	rc, err := target.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var m BackupManifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", key, err)
+	}
+	return &m, nil
+}
+
+// ListBackupManifests returns the manifest of every complete backup on the
+// target, newest first.
+func ListBackupManifests(ctx context.Context, target BlobStore) ([]BackupManifest, error) {
+	var keys []string
+	err := target.ListObjects(ctx, backupRunPrefix, func(o BlobInfo) error {
+		if strings.HasSuffix(o.Key, "/"+backupManifestName) {
+			keys = append(keys, o.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	out := make([]BackupManifest, 0, len(keys))
+	for _, k := range keys {
+		m, err := readBackupManifest(ctx, target, k)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.After(out[j].StartedAt) })
+	return out, nil
+}
+
+// ReadBackup fetches backup id from the target, checks the catalogue against
+// the manifest checksum and decrypts it with a key derived from kek.
+func ReadBackup(ctx context.Context, target BlobStore, kek []byte, id uuid.UUID) (*BackupArchive, error) {
+	dir := backupDir(id)
+	m, err := readBackupManifest(ctx, target, dir+backupManifestName)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Format > backupFormat {
+		return nil, fmt.Errorf("backup %s has format %d; this build reads up to %d", id, m.Format, backupFormat)
+	}
+
+	rc, err := target.GetObject(ctx, dir+backupCatalogueName)
+	if err != nil {
+		return nil, fmt.Errorf("read catalogue: %w", err)
+	}
+	sealed, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read catalogue: %w", err)
+	}
+	sum := sha256.Sum256(sealed)
+	if int64(len(sealed)) != m.CatalogueBytes || hex.EncodeToString(sum[:]) != m.CatalogueSHA256 {
+		return nil, errBackupDamaged
+	}
+
+	rows, blobs, err := openCatalogue(kek, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupArchive{Manifest: *m, Rows: rows, Blobs: blobs}, nil
+}
+
+// ── Blob copy ─────────────────────────────────────────────────────────────────
+
+// blobExport copies drive blobs to the target, skipping those it already holds.
+type blobExport struct {
+	target BlobStore
+	// known maps object keys already on the target to their size.
+	known map[string]int64
+	// record persists a blob as present on the target.
+	record func(ctx context.Context, key string, size int64) error
+	out    *catalogueWriter
+
+	newCount int64
+	newBytes int64
+}
+
+// drive exports every blob on store, which backs driveID. Blobs moved to
+// quarantine by the reconciler are not user data and are left out.
+func (e *blobExport) drive(ctx context.Context, driveID uuid.UUID, store BlobStore) error {
+	return store.ListObjects(ctx, "", func(o BlobInfo) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if strings.HasPrefix(o.Key, QuarantinePrefix) {
+			return nil
+		}
+		copied, err := e.blob(ctx, store, o)
+		if errors.Is(err, ErrBlobNotFound) {
+			return nil // deleted since it was listed
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", o.Key, err)
+		}
+		if copied {
+			e.newCount++
+			e.newBytes += o.Size
+		}
+		return e.out.blob(BackupBlob{DriveID: driveID, Key: o.Key, Size: o.Size})
+	})
+}
+
+// blob makes sure o is on the target and reports whether it had to be copied.
+func (e *blobExport) blob(ctx context.Context, store BlobStore, o BlobInfo) (bool, error) {
+	if size, ok := e.known[o.Key]; ok && size == o.Size {
+		return false, nil
+	}
+	dst := backupBlobPrefix + o.Key
+	// Already on the target (a chain started by a restored instance, or a
+	// run that stopped before recording it): just record it.
+	if info, err := e.target.StatObject(ctx, dst); err == nil && info.Size == o.Size {
+		e.known[o.Key] = o.Size
+		return false, e.record(ctx, o.Key, o.Size)
+	}
+
+	rc, err := store.GetObject(ctx, o.Key)
+	if err != nil {
+		return false, err
+	}
+	err = e.target.PutObject(ctx, dst, rc, o.Size, "application/octet-stream")
+	rc.Close()
+	if err != nil {
+		return false, err
+	}
+	e.known[o.Key] = o.Size
+	return true, e.record(ctx, o.Key, o.Size)
+}
+
+// RestoreBlobs copies every blob of a backup from the target back onto the
+// drive it was found on; storeFor resolves a drive ID to its BlobStore. Blobs
+// already present with the right size are skipped, so an interrupted restore
+// can simply be run again. Returns the number of blobs copied.
+func RestoreBlobs(ctx context.Context, target BlobStore, blobs []BackupBlob, storeFor func(ctx context.Context, driveID uuid.UUID) (BlobStore, error)) (int64, error) {
+	var copied int64
+	for _, b := range blobs {
+		if ctx.Err() != nil {
+			return copied, ctx.Err()
+		}
+		store, err := storeFor(ctx, b.DriveID)
+		if err != nil {
+			return copied, fmt.Errorf("drive %s: %w", b.DriveID, err)
+		}
+		if info, err := store.StatObject(ctx, b.Key); err == nil && info.Size == b.Size {
+			continue
+		}
+		rc, err := target.GetObject(ctx, backupBlobPrefix+b.Key)
+		if err != nil {
+			return copied, fmt.Errorf("%s: %w", b.Key, err)
+		}
+		err = store.PutObject(ctx, b.Key, rc, b.Size, "application/octet-stream")
+		rc.Close()
+		if err != nil {
+			return copied, fmt.Errorf("%s: %w", b.Key, err)
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// verifyArchive checks a decrypted backup against its manifest and the
+// target: row counts per table, and every referenced blob present with its
+// recorded size. Returns a description of each problem found.
+func verifyArchive(ctx context.Context, target BlobStore, a *BackupArchive) ([]string, error) {
+	var problems []string
+	tables := make(map[string]int64)
+	for _, r := range a.Rows {
+		tables[r.Table]++
+	}
+	for t, want := range a.Manifest.Tables {
+		if tables[t] != want {
+			problems = append(problems, fmt.Sprintf("table %s: %d rows, manifest says %d", t, tables[t], want))
+		}
+	}
+	if int64(len(a.Blobs)) != a.Manifest.BlobCount {
+		problems = append(problems, fmt.Sprintf("%d blobs listed, manifest says %d", len(a.Blobs), a.Manifest.BlobCount))
+	}
+
+	seen := make(map[string]bool)
+	for _, b := range a.Blobs {
+		if seen[b.Key] {
+			continue
+		}
+		seen[b.Key] = true
+		if ctx.Err() != nil {
+			return problems, ctx.Err()
+		}
+		info, err := target.StatObject(ctx, backupBlobPrefix+b.Key)
+		switch {
+		case errors.Is(err, ErrBlobNotFound):
+			problems = append(problems, fmt.Sprintf("blob %s: missing", b.Key))
+		case err != nil:
+			return problems, err
+		case info.Size != b.Size:
+			problems = append(problems, fmt.Sprintf("blob %s: %d bytes, expected %d", b.Key, info.Size, b.Size))
+		}
+	}
+	return problems, nil
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// BackupStatus describes the current or most recent backup job.
+type BackupStatus struct {
+	Running bool `json:"running"`
+	// Job is "backup" or "verify".
+	Job            string     `json:"job,omitempty"`
+	Target         string     `json:"target"`
+	IntervalHours  int        `json:"interval_hours"`
+	LastStartedAt  *time.Time `json:"last_started_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// BackupService periodically writes an off-site backup to its target: a
+// consistent snapshot of the metadata catalogue (including master_keys),
+// sealed with a key derived from the KEK, plus every drive blob the target
+// does not hold yet. Blobs are already ciphertext and are copied as they are.
+// One job (a backup or a verification) runs at a time.
+type BackupService struct {
+	queries  *db.Queries
+	registry *MinIORegistry
+	target   *BackupTarget
+	kek      []byte
+	interval time.Duration
+
+	running atomic.Bool
+	mu      sync.RWMutex
+	status  BackupStatus
+}
+
+// NewBackupService constructs a BackupService that backs up every interval.
+func NewBackupService(q *db.Queries, registry *MinIORegistry, target *BackupTarget, kek []byte, interval time.Duration) *BackupService {
+	return &BackupService{
+		queries:  q,
+		registry: registry,
+		target:   target,
+		kek:      kek,
+		interval: interval,
+		status:   BackupStatus{Target: target.Name, IntervalHours: int(interval / time.Hour)},
+	}
+}
+
+// Start fails runs interrupted by a restart, then backs up every interval
+// until ctx is cancelled.
+func (s *BackupService) Start(ctx context.Context) {
+	if n, err := s.queries.FailInterruptedBackupRuns(ctx); err != nil {
+		log.Printf("backup service: %v", err)
+	} else if n > 0 {
+		log.Printf("backup service: marked %d interrupted job(s) as failed", n)
+	}
+	log.Printf("backup service: started (every %s to %s)", s.interval, s.target.Name)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.running.CompareAndSwap(false, true) {
+				s.backup(ctx)
+				s.running.Store(false)
+			}
+		}
+	}
+}
+
+// Trigger starts a backup in the background. Returns false when a job is
+// already running.
+func (s *BackupService) Trigger() bool {
+	if !s.running.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer s.running.Store(false)
+		s.backup(context.Background())
+	}()
+	return true
+}
+
+// Status returns a snapshot of the current or most recent job.
+func (s *BackupService) Status() BackupStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.status
+	st.Running = s.running.Load()
+	return st
+}
+
+// List returns recorded backup runs, newest first.
+func (s *BackupService) List(ctx context.Context, page db.PageInput) (*db.PageResult[models.BackupRun], error) {
+	return s.queries.ListBackupRuns(ctx, page)
+}
+
+// Verify starts verifying backup id in the background: the catalogue is
+// fetched, checked against its manifest checksum and decrypted, and every
+// blob it references is looked up on the target.
+func (s *BackupService) Verify(ctx context.Context, id uuid.UUID) (*models.BackupRun, error) {
+	run, err := s.queries.GetBackupRun(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, ErrBackupNotFound
+	}
+	if run.Status != models.BackupDone {
+		return nil, ErrBackupNotComplete
+	}
+	if !s.running.CompareAndSwap(false, true) {
+		return nil, ErrBackupBusy
+	}
+	if err := s.queries.SetBackupVerifyStatus(ctx, id, models.BackupVerifyRunning, nil); err != nil {
+		s.running.Store(false)
+		return nil, err
+	}
+	status := models.BackupVerifyRunning
+	run.VerifyStatus, run.VerifyError = &status, nil
+
+	go func() {
+		defer s.running.Store(false)
+		s.verify(context.Background(), id)
+	}()
+	return run, nil
+}
+
+func (s *BackupService) begin(job string) time.Time {
+	started := time.Now().UTC()
+	s.mu.Lock()
+	s.status.Job = job
+	s.status.LastStartedAt = &started
+	s.status.LastFinishedAt = nil
+	s.status.LastError = ""
+	s.mu.Unlock()
+	return started
+}
+
+func (s *BackupService) end(err error) {
+	finished := time.Now().UTC()
+	s.mu.Lock()
+	s.status.LastFinishedAt = &finished
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+}
+
+// ── Backup ────────────────────────────────────────────────────────────────────
+
+// backup writes one backup. The caller holds the running flag.
+func (s *BackupService) backup(ctx context.Context) {
+	id := uuid.New()
+	started := s.begin("backup")
+	log.Printf("backup: %s started", id)
+
+	err := s.writeBackup(ctx, id, started)
+	if err != nil {
+		log.Printf("backup: %s failed: %v", id, err)
+		if ferr := s.queries.FailBackupRun(context.Background(), id, err.Error()); ferr != nil {
+			log.Printf("backup: %v", ferr)
+		}
+	}
+	s.end(err)
+}
+
+func (s *BackupService) writeBackup(ctx context.Context, id uuid.UUID, started time.Time) error {
+	if err := s.target.Check(ctx); err != nil {
+		return err
+	}
+	if _, err := s.queries.CreateBackupRun(ctx, id, s.target.Name); err != nil {
+		return err
+	}
+
+	// The catalogue snapshot is taken before blobs are listed, so every blob
+	// a catalogued file points at is either copied or was deleted meanwhile.
+	w := newCatalogueWriter()
+	rows, err := s.queries.ExportCatalogue(ctx, w.row)
+	if err != nil {
+		return err
+	}
+
+	known, err := s.queries.ListBackedUpBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	e := &blobExport{
+		target: s.target.Store,
+		known:  known,
+		out:    w,
+		record: func(ctx context.Context, key string, size int64) error {
+			return s.queries.RecordBackedUpBlob(ctx, key, size, id)
+		},
+	}
+	servers, err := s.queries.ListServers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, srv := range servers {
+		if !srv.IsActive {
+			continue
+		}
+		drives, err := s.queries.ListDrives(ctx, srv.ID)
+		if err != nil {
+			return err
+		}
+		for _, d := range drives {
+			if d.State == models.DriveStateRetired {
+				continue
+			}
+			store, ok := s.registry.Store(srv.ID, d.MinioBucket)
+			if !ok {
+				return fmt.Errorf("drive %s on %s: %w", d.Label, srv.Name, ErrStorageUnavailable)
+			}
+			if err := e.drive(ctx, d.ID, store); err != nil {
+				return fmt.Errorf("drive %s: %w", d.Label, err)
+			}
+		}
+	}
+
+	sealed, err := w.seal(s.kek)
+	if err != nil {
+		return fmt.Errorf("seal catalogue: %w", err)
+	}
+	sum := sha256.Sum256(sealed)
+	m := BackupManifest{
+		Format:          backupFormat,
+		ID:              id,
+		StartedAt:       started,
+		FinishedAt:      time.Now().UTC(),
+		Tables:          w.tables,
+		BlobCount:       w.blobCount,
+		BlobBytes:       w.blobBytes,
+		CatalogueBytes:  int64(len(sealed)),
+		CatalogueSHA256: hex.EncodeToString(sum[:]),
+	}
+	if err := writeBackupArchive(ctx, s.target.Store, m, sealed); err != nil {
+		return err
+	}
+
+	log.Printf("backup: %s done — %d rows, %d blobs (%d new, %d bytes)", id, rows, w.blobCount, e.newCount, e.newBytes)
+	return s.queries.FinishBackupRun(ctx, id, db.FinishBackupRunParams{
+		CatalogueRows:   rows,
+		CatalogueBytes:  m.CatalogueBytes,
+		CatalogueSHA256: m.CatalogueSHA256,
+		BlobCount:       w.blobCount,
+		BlobBytes:       w.blobBytes,
+		NewBlobCount:    e.newCount,
+		NewBlobBytes:    e.newBytes,
+	})
+}
+
+// ── Verify ────────────────────────────────────────────────────────────────────
+
+// verify checks backup id and records the outcome. The caller holds the
+// running flag.
+func (s *BackupService) verify(ctx context.Context, id uuid.UUID) {
+	s.begin("verify")
+	log.Printf("backup: verifying %s", id)
+
+	var problems []string
+	archive, err := ReadBackup(ctx, s.target.Store, s.kek, id)
+	if err == nil {
+		problems, err = verifyArchive(ctx, s.target.Store, archive)
+	}
+
+	status := models.BackupVerifyOK
+	var detail *string
+	switch {
+	case err != nil:
+		status = models.BackupVerifyFailed
+		msg := err.Error()
+		detail = &msg
+	case len(problems) > 0:
+		status = models.BackupVerifyFailed
+		msg := fmt.Sprintf("%d problem(s): %s", len(problems), strings.Join(problems[:min(len(problems), backupVerifySample)], "; "))
+		detail = &msg
+	}
+	if detail != nil {
+		log.Printf("backup: verify %s failed: %s", id, *detail)
+	} else {
+		log.Printf("backup: verify %s ok", id)
+	}
+	if uerr := s.queries.SetBackupVerifyStatus(context.Background(), id, status, detail); uerr != nil {
+		log.Printf("backup: %v", uerr)
+	}
+	s.end(err)
+}
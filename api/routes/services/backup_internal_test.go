@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+)
+
+// writeTestBackup seals rows and blobs into a backup on target and returns its manifest.
+func writeTestBackup(t *testing.T, target BlobStore, kek []byte, rows []db.CatalogueRow, blobs []BackupBlob) BackupManifest {
+	t.Helper()
+	w := newCatalogueWriter()
+	for _, r := range rows {
+		if err := w.row(r); err != nil {
+			t.Fatalf("row: %v", err)
+		}
+	}
+	for _, b := range blobs {
+		if err := w.blob(b); err != nil {
+			t.Fatalf("blob: %v", err)
+		}
+	}
+	sealed, err := w.seal(kek)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	sum := sha256.Sum256(sealed)
+	m := BackupManifest{
+		Format:          backupFormat,
+		ID:              uuid.New(),
+		StartedAt:       time.Now().UTC(),
+		FinishedAt:      time.Now().UTC(),
+		Tables:          w.tables,
+		BlobCount:       w.blobCount,
+		BlobBytes:       w.blobBytes,
+		CatalogueBytes:  int64(len(sealed)),
+		CatalogueSHA256: hex.EncodeToString(sum[:]),
+	}
+	if err := writeBackupArchive(context.Background(), target, m, sealed); err != nil {
+		t.Fatalf("writeBackupArchive: %v", err)
+	}
+	return m
+}
+
+func TestBackupArchive_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	target := NewFSStore(t.TempDir())
+	kek := bytes.Repeat([]byte{1}, 32)
+	rows := []db.CatalogueRow{
+		{Table: "master_keys", Row: json.RawMessage(`{"id":"v1","status":"active","encrypted_key_material":"\\x0102"}`)},
+		{Table: "users", Row: json.RawMessage(`{"username":"alice","email":"alice@example.com"}`)},
+		{Table: "files", User: "alice", Row: json.RawMessage(`{"id":"f1","user_id":"alice"}`)},
+	}
+	blobs := []BackupBlob{{DriveID: uuid.New(), Key: "alice/f1", Size: 42}}
+	m := writeTestBackup(t, target, kek, rows, blobs)
+
+	a, err := ReadBackup(ctx, target, kek, m.ID)
+	if err != nil {
+		t.Fatalf("ReadBackup: %v", err)
+	}
+	if len(a.Rows) != 3 || a.Rows[2].User != "alice" || string(a.Rows[0].Row) != string(rows[0].Row) {
+		t.Errorf("rows did not round-trip: %+v", a.Rows)
+	}
+	if len(a.Blobs) != 1 || a.Blobs[0] != blobs[0] {
+		t.Errorf("blobs did not round-trip: %+v", a.Blobs)
+	}
+	if a.Manifest.Tables["master_keys"] != 1 || a.Manifest.BlobBytes != 42 {
+		t.Errorf("unexpected manifest: %+v", a.Manifest)
+	}
+
+	// The catalogue is not readable in the clear.
+	raw := readBlob(t, target, backupDir(m.ID)+backupCatalogueName)
+	if bytes.Contains(raw, []byte("alice@example.com")) {
+		t.Error("catalogue stored in plaintext")
+	}
+
+	if _, err := ReadBackup(ctx, target, bytes.Repeat([]byte{2}, 32), m.ID); !errors.Is(err, errBackupDamaged) {
+		t.Errorf("wrong KEK: got %v, want errBackupDamaged", err)
+	}
+	if _, err := ReadBackup(ctx, target, kek, uuid.New()); !errors.Is(err, ErrBackupNotFound) {
+		t.Errorf("unknown backup: got %v, want ErrBackupNotFound", err)
+	}
+
+	raw[len(raw)-1] ^= 0xff
+	if err := target.PutObject(ctx, backupDir(m.ID)+backupCatalogueName, bytes.NewReader(raw), int64(len(raw)), ""); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if _, err := ReadBackup(ctx, target, kek, m.ID); !errors.Is(err, errBackupDamaged) {
+		t.Errorf("tampered catalogue: got %v, want errBackupDamaged", err)
+	}
+}
+
+func TestListBackupManifests_NewestFirst(t *testing.T) {
+	ctx := context.Background()
+	target := NewFSStore(t.TempDir())
+	kek := bytes.Repeat([]byte{1}, 32)
+
+	first := writeTestBackup(t, target, kek, nil, nil)
+	time.Sleep(time.Millisecond)
+	second := writeTestBackup(t, target, kek, nil, nil)
+	// A backup that stopped before its manifest was written is not listed.
+	if err := target.PutObject(ctx, backupDir(uuid.New())+backupCatalogueName, strings.NewReader("x"), 1, ""); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	got, err := ListBackupManifests(ctx, target)
+	if err != nil {
+		t.Fatalf("ListBackupManifests: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != second.ID || got[1].ID != first.ID {
+		t.Errorf("unexpected manifests: %+v", got)
+	}
+}
+
+func TestBlobExport_Incremental(t *testing.T) {
+	ctx := context.Background()
+	src, target := NewFSStore(t.TempDir()), NewFSStore(t.TempDir())
+	driveID := uuid.New()
+	for _, k := range []string{"u/a", "u/b", QuarantinePrefix + "u/orphan"} {
+		if err := src.PutObject(ctx, k, strings.NewReader(k), int64(len(k)), ""); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+
+	recorded := make(map[string]int64)
+	run := func(known map[string]int64) *blobExport {
+		e := &blobExport{
+			target: target,
+			known:  known,
+			out:    newCatalogueWriter(),
+			record: func(_ context.Context, key string, size int64) error {
+				recorded[key] = size
+				return nil
+			},
+		}
+		if err := e.drive(ctx, driveID, src); err != nil {
+			t.Fatalf("drive: %v", err)
+		}
+		return e
+	}
+
+	e := run(make(map[string]int64))
+	if e.newCount != 2 || e.out.blobCount != 2 || len(recorded) != 2 {
+		t.Fatalf("first run: copied %d, listed %d, recorded %v", e.newCount, e.out.blobCount, recorded)
+	}
+	if got := readBlob(t, target, backupBlobPrefix+"u/a"); string(got) != "u/a" {
+		t.Errorf("backed-up blob = %q", got)
+	}
+
+	// Second run with the recorded state copies nothing but still lists both.
+	if e := run(recorded); e.newCount != 0 || e.out.blobCount != 2 {
+		t.Errorf("second run: copied %d, listed %d", e.newCount, e.out.blobCount)
+	}
+
+	// A fresh chain (no records) re-discovers blobs already on the target.
+	recorded = make(map[string]int64)
+	if e := run(make(map[string]int64)); e.newCount != 0 || len(recorded) != 2 {
+		t.Errorf("fresh chain: copied %d, recorded %v", e.newCount, recorded)
+	}
+
+	// A blob whose size changed is copied again.
+	if err := src.PutObject(ctx, "u/b", strings.NewReader("changed"), 7, ""); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if e := run(recorded); e.newCount != 1 || recorded["u/b"] != 7 {
+		t.Errorf("changed blob: copied %d, recorded %v", e.newCount, recorded)
+	}
+}
+
+func TestVerifyAndRestoreBlobs(t *testing.T) {
+	ctx := context.Background()
+	target, dst := NewFSStore(t.TempDir()), NewFSStore(t.TempDir())
+	driveID := uuid.New()
+	blobs := []BackupBlob{
+		{DriveID: driveID, Key: "u/a", Size: 3},
+		{DriveID: driveID, Key: "u/b", Size: 3},
+	}
+	for _, b := range blobs {
+		if err := target.PutObject(ctx, backupBlobPrefix+b.Key, strings.NewReader(b.Key), b.Size, ""); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	a := &BackupArchive{
+		Manifest: BackupManifest{Tables: map[string]int64{"users": 1}, BlobCount: 2},
+		Rows:     []db.CatalogueRow{{Table: "users", Row: json.RawMessage(`{}`)}},
+		Blobs:    blobs,
+	}
+
+	if problems, err := verifyArchive(ctx, target, a); err != nil || len(problems) != 0 {
+		t.Fatalf("verify intact backup: %v, %v", problems, err)
+	}
+
+	storeFor := func(_ context.Context, id uuid.UUID) (BlobStore, error) {
+		if id != driveID {
+			t.Fatalf("unexpected drive %s", id)
+		}
+		return dst, nil
+	}
+	if n, err := RestoreBlobs(ctx, target, blobs, storeFor); err != nil || n != 2 {
+		t.Fatalf("RestoreBlobs = %d, %v", n, err)
+	}
+	if got := readBlob(t, dst, "u/b"); string(got) != "u/b" {
+		t.Errorf("restored blob = %q", got)
+	}
+	if n, err := RestoreBlobs(ctx, target, blobs, storeFor); err != nil || n != 0 {
+		t.Errorf("second RestoreBlobs = %d, %v; want a no-op", n, err)
+	}
+
+	if err := target.RemoveObject(ctx, backupBlobPrefix+"u/a"); err != nil {
+		t.Fatalf("RemoveObject: %v", err)
+	}
+	a.Manifest.Tables["users"] = 2
+	problems, err := verifyArchive(ctx, target, a)
+	if err != nil || len(problems) != 2 {
+		t.Fatalf("verify damaged backup: %v, %v", problems, err)
+	}
+	if !strings.Contains(strings.Join(problems, ";"), "blob u/a: missing") {
+		t.Errorf("missing blob not reported: %v", problems)
+	}
+}
+
+func TestOpenBackupTarget(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     BackupTargetConfig
+		want    string
+		wantErr bool
+	}{
+		{"fs", BackupTargetConfig{Kind: BackupTargetFS, Path: "/backups/"}, "fs:/backups", false},
+		{"relative path", BackupTargetConfig{Kind: BackupTargetFS, Path: "backups"}, "", true},
+		{"sftp", BackupTargetConfig{Kind: BackupTargetSFTP, Path: "/mnt/offsite"}, "sftp:/mnt/offsite", false},
+		{"s3", BackupTargetConfig{Kind: BackupTargetS3, S3Endpoint: "s3.example.com", S3Bucket: "bk"}, "s3:s3.example.com/bk", false},
+		{"s3 without bucket", BackupTargetConfig{Kind: BackupTargetS3, S3Endpoint: "s3.example.com"}, "", true},
+		{"unknown", BackupTargetConfig{Kind: "ftp"}, "", true},
+	}
+	for _, tc := range cases {
+		got, err := OpenBackupTarget(tc.cfg)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil || got.Name != tc.want {
+			t.Errorf("%s: got %v, %v; want %q", tc.name, got, err, tc.want)
+		}
+	}
+
+	// A directory that is not a mount point is refused for sftp.
+	target, _ := OpenBackupTarget(BackupTargetConfig{Kind: BackupTargetSFTP, Path: t.TempDir()})
+	if err := target.Check(context.Background()); err == nil {
+		t.Error("sftp check on a plain directory: expected an error")
+	}
+	target, _ = OpenBackupTarget(BackupTargetConfig{Kind: BackupTargetFS, Path: t.TempDir() + "/new"})
+	if err := target.Check(context.Background()); err != nil {
+		t.Errorf("fs check: %v", err)
+	}
+}
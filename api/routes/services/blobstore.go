@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrBlobNotFound is wrapped by BlobStore implementations when the requested
+// key does not exist.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is the raw object I/O layer for a single drive: a flat key space
+// of opaque blobs. Encryption is the caller's responsibility. S3Store speaks
+// the S3 API (MinIO or any S3-compatible service); FSStore keeps blobs on a
+// local filesystem for installs that do not run MinIO.
+type BlobStore interface {
+	// PutObject stores r at key, replacing any existing blob. size is the
+	// exact number of bytes r yields, or -1 if unknown.
+	PutObject(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// GetObject returns a reader for the whole blob. The caller must close it.
+	GetObject(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetObjectRange returns a reader for bytes [start, end] (inclusive).
+	GetObjectRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error)
+	// RemoveObject deletes the blob at key. Removing a missing key is not an error.
+	RemoveObject(ctx context.Context, key string) error
+	// StatObject returns the blob's metadata without reading its body.
+	StatObject(ctx context.Context, key string) (BlobInfo, error)
+	// CopyObject copies srcKey to dstKey within the store.
+	CopyObject(ctx context.Context, srcKey, dstKey string) error
+	// ListObjects calls fn for every blob whose key starts with prefix
+	// ("" lists everything), stopping at the first error.
+	ListObjects(ctx context.Context, prefix string, fn func(BlobInfo) error) error
+
+	// CreateMultipartUpload starts a multipart upload and returns its ID.
+	CreateMultipartUpload(ctx context.Context, key string) (string, error)
+	// UploadPart stores data as part partNumber (1-based) of uploadID. Parts
+	// may arrive in any order and concurrently.
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (BlobPart, error)
+	// CompleteMultipartUpload assembles parts (ascending PartNumber) into the
+	// blob at key.
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []BlobPart) error
+	// AbortMultipartUpload discards an unfinished upload and its parts.
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// BlobPart identifies one uploaded part of a multipart upload.
+type BlobPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// storageBackend is the registry's connection to one server. It hands out a
+// BlobStore per drive bucket and answers liveness probes.
+type storageBackend interface {
+	Store(bucket string) BlobStore
+	EnsureBucket(ctx context.Context, bucket string) error
+	// Probe returns nil if the server is up and serving requests.
+	Probe(ctx context.Context) error
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+// MaxBulkItems caps the files and folders in one bulk request.
+const MaxBulkItems = 1000
+
+// Bulk operations.
+const (
+	BulkMove       = "move"
+	BulkDelete     = "delete"
+	BulkHide       = "hide"
+	BulkUnhide     = "unhide"
+	BulkFavorite   = "favorite"
+	BulkUnfavorite = "unfavorite"
+)
+
+var (
+	ErrBulkEmpty       = errors.New("select at least one file or folder")
+	ErrBulkTooLarge    = fmt.Errorf("a bulk request can hold at most %d files and folders", MaxBulkItems)
+	ErrBulkOperation   = errors.New("op must be one of move, delete, hide, unhide, favorite, unfavorite")
+	ErrBulkNoTarget    = errors.New("folder_id is required to move")
+	ErrBulkFilesOnly   = errors.New("only files can be hidden or unhidden")
+	errBulkAlreadyDone = errors.New("already in the requested state")
+)
+
+// BulkInput is one operation applied to many files and folders.
+type BulkInput struct {
+	UserID    uuid.UUID
+	Username  string
+	Op        string
+	FileIDs   []uuid.UUID
+	FolderIDs []uuid.UUID
+	// TargetFolderID is the destination of a move.
+	TargetFolderID *uuid.UUID
+}
+
+// BulkItemResult is the outcome for one file or folder.
+type BulkItemResult struct {
+	ID    uuid.UUID `json:"id"`
+	Type  string    `json:"type"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+// BulkResult lists the outcome of every item in request order, files first.
+type BulkResult struct {
+	Op        string           `json:"op"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+}
+
+func (r *BulkResult) set(i int, err error) {
+	if err == nil {
+		r.Items[i].OK = true
+		return
+	}
+	r.Items[i].Error = err.Error()
+}
+
+// BulkService applies move, delete, hide and favorite to many files and
+// folders in one request.
+//
+// Every item runs in a single ForUser transaction, each inside its own
+// savepoint: an item that fails (not found, name clash, non-empty folder)
+// is reported and skipped while the rest commit together. An unexpected
+// database error fails the whole request and nothing is committed. Items
+// already in the requested state (moved to the folder they are in,
+// favorited twice) count as successes, as they do for the single-item
+// endpoints.
+type BulkService struct {
+	queries *db.Queries
+	files   *FileService
+	folders *FolderService
+}
+
+// NewBulkService constructs a BulkService.
+func NewBulkService(q *db.Queries, files *FileService, folders *FolderService) *BulkService {
+	return &BulkService{queries: q, files: files, folders: folders}
+}
+
+// Apply runs in.Op on every selected item. It returns ErrBulkEmpty,
+// ErrBulkTooLarge, ErrBulkOperation or ErrBulkNoTarget for a malformed
+// request and ErrFolderNotFound when the move target does not belong to the
+// user; per-item failures are reported in the result instead.
+func (s *BulkService) Apply(ctx context.Context, in BulkInput) (*BulkResult, error) {
+	in.FileIDs, in.FolderIDs = dedupeIDs(in.FileIDs), dedupeIDs(in.FolderIDs)
+	switch n := len(in.FileIDs) + len(in.FolderIDs); {
+	case n == 0:
+		return nil, ErrBulkEmpty
+	case n > MaxBulkItems:
+		return nil, ErrBulkTooLarge
+	}
+	switch in.Op {
+	case BulkMove:
+		if in.TargetFolderID == nil {
+			return nil, ErrBulkNoTarget
+		}
+	case BulkDelete, BulkHide, BulkUnhide, BulkFavorite, BulkUnfavorite:
+	default:
+		return nil, ErrBulkOperation
+	}
+
+	q, tx, err := s.queries.ForUser(ctx, in.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("bulk %s: begin tx: %w", in.Op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if in.Op == BulkMove {
+		if _, err := s.folders.getOwned(ctx, q, *in.TargetFolderID, in.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &BulkResult{Op: in.Op, Items: make([]BulkItemResult, 0, len(in.FileIDs)+len(in.FolderIDs))}
+	for _, id := range in.FileIDs {
+		res.Items = append(res.Items, BulkItemResult{ID: id, Type: "file"})
+	}
+	for _, id := range in.FolderIDs {
+		res.Items = append(res.Items, BulkItemResult{ID: id, Type: "folder"})
+	}
+
+	var deleted []deletedFile
+	for i, id := range in.FileIDs {
+		var gone *deletedFile
+		err := q.Savepoint(ctx, func() error {
+			var err error
+			gone, err = s.applyFile(ctx, q, in, id)
+			return err
+		})
+		if err = bulkItemError(err); err != nil && !isBulkItemError(err) {
+			return nil, fmt.Errorf("bulk %s: file %s: %w", in.Op, id, err)
+		}
+		res.set(i, err)
+		if err == nil && gone != nil {
+			deleted = append(deleted, *gone)
+		}
+	}
+
+	// A folder can only be deleted once it is empty, and the selection may
+	// hold its contents too, so folders left non-empty are retried for as
+	// long as each pass deletes something.
+	pending := make([]int, len(in.FolderIDs))
+	for i := range pending {
+		pending[i] = len(in.FileIDs) + i
+	}
+	for len(pending) > 0 {
+		var retry []int
+		for _, i := range pending {
+			id := res.Items[i].ID
+			err := bulkItemError(q.Savepoint(ctx, func() error {
+				return s.applyFolder(ctx, q, in, id)
+			}))
+			if err != nil && !isBulkItemError(err) {
+				return nil, fmt.Errorf("bulk %s: folder %s: %w", in.Op, id, err)
+			}
+			if errors.Is(err, ErrFolderNotEmpty) {
+				retry = append(retry, i)
+				continue
+			}
+			res.set(i, err)
+		}
+		if len(retry) == len(pending) {
+			for _, i := range retry {
+				res.set(i, ErrFolderNotEmpty)
+			}
+			break
+		}
+		pending = retry
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("bulk %s: commit: %w", in.Op, err)
+	}
+	if len(deleted) > 0 {
+		s.files.removeDeleted(ctx, in.Username, deleted)
+	}
+
+	for _, item := range res.Items {
+		if item.OK {
+			res.Succeeded++
+		} else {
+			res.Failed++
+		}
+	}
+	return res, nil
+}
+
+// applyFile runs the operation on one file. For a delete it returns what
+// must be removed from storage once the transaction commits.
+func (s *BulkService) applyFile(ctx context.Context, q *db.Queries, in BulkInput, id uuid.UUID) (*deletedFile, error) {
+	file, err := q.GetFileByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if file.UserID != in.UserID {
+		return nil, ErrNotFound
+	}
+
+	switch in.Op {
+	case BulkMove:
+		if file.FolderID != nil && *file.FolderID == *in.TargetFolderID {
+			return nil, nil
+		}
+		if _, err := q.MoveFile(ctx, id, *in.TargetFolderID); err != nil {
+			if isDuplicateKeyError(err) {
+				return nil, ErrDuplicateName
+			}
+			return nil, err
+		}
+	case BulkHide, BulkUnhide:
+		if _, err := q.SetFileHidden(ctx, id, in.Op == BulkHide); err != nil {
+			return nil, err
+		}
+	case BulkFavorite:
+		if err := q.AddFileFavorite(ctx, in.UserID, id); err != nil {
+			if isDuplicateKeyError(err) {
+				return nil, errBulkAlreadyDone
+			}
+			return nil, err
+		}
+	case BulkUnfavorite:
+		return nil, q.RemoveFileFavorite(ctx, in.UserID, id)
+	case BulkDelete:
+		variants, err := q.ListVideoVariants(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.DeleteFile(ctx, id); err != nil {
+			return nil, err
+		}
+		gone := &deletedFile{file: file}
+		for _, v := range variants {
+			gone.variantKeys = append(gone.variantKeys, v.MinIOObjectKey)
+		}
+		return gone, nil
+	}
+	return nil, nil
+}
+
+// applyFolder runs the operation on one folder.
+func (s *BulkService) applyFolder(ctx context.Context, q *db.Queries, in BulkInput, id uuid.UUID) error {
+	folder, err := s.folders.getOwned(ctx, q, id, in.UserID)
+	if err != nil {
+		return err
+	}
+
+	switch in.Op {
+	case BulkMove:
+		if folder.ParentID != nil && *folder.ParentID == *in.TargetFolderID {
+			return nil
+		}
+		cycle, err := q.FolderWouldCreateCycle(ctx, id, *in.TargetFolderID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrFolderCycle
+		}
+		if _, err := q.UpdateFolderParent(ctx, id, in.TargetFolderID); err != nil {
+			if isDuplicateKeyError(err) {
+				return ErrDuplicateFolderName
+			}
+			return err
+		}
+	case BulkHide, BulkUnhide:
+		return ErrBulkFilesOnly
+	case BulkFavorite:
+		if err := q.AddFolderFavorite(ctx, in.UserID, id); err != nil {
+			if isDuplicateKeyError(err) {
+				return errBulkAlreadyDone
+			}
+			return err
+		}
+	case BulkUnfavorite:
+		return q.RemoveFolderFavorite(ctx, in.UserID, id)
+	case BulkDelete:
+		hasChildren, err := q.HasFolderChildren(ctx, id)
+		if err != nil {
+			return err
+		}
+		if hasChildren {
+			return ErrFolderNotEmpty
+		}
+		return q.DeleteFolder(ctx, id)
+	}
+	return nil
+}
+
+// bulkItemError maps the error from one item's savepoint to what is
+// reported for it: nil for an item that was already done.
+func bulkItemError(err error) error {
+	if errors.Is(err, errBulkAlreadyDone) {
+		return nil
+	}
+	return err
+}
+
+// isBulkItemError reports whether err is a failure of one item rather than
+// of the request.
+func isBulkItemError(err error) bool {
+	for _, target := range []error{
+		ErrNotFound, ErrFolderNotFound, ErrDuplicateName, ErrDuplicateFolderName,
+		ErrFolderCycle, ErrFolderNotEmpty, ErrBulkFilesOnly,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ── Deferred blob removal ─────────────────────────────────────────────────────
+
+// deletedFile is a file whose row was deleted in a transaction that has
+// not committed yet.
+type deletedFile struct {
+	file        *models.File
+	variantKeys []string
+}
+
+// removeDeleted removes the blobs of committed file deletions and gives
+// their space back to the user. Unlike Delete, the rows go first: removing
+// hundreds of blobs before a commit that might still fail would leave rows
+// pointing at nothing, whereas a blob left behind here is only an orphan
+// for the reconciler to sweep.
+func (s *FileService) removeDeleted(ctx context.Context, username string, files []deletedFile) {
+	storage, _, err := s.storageFor(ctx, username)
+	if err != nil {
+		log.Printf("bulk delete: %v", err)
+	}
+	replica, _, err := s.replicaFor(ctx, username)
+	if err != nil {
+		log.Printf("bulk delete: %v", err)
+	}
+
+	var freed int64
+	for _, d := range files {
+		freed += d.file.SizeBytes
+		for _, key := range append(d.variantKeys, d.file.MinIOObjectKey) {
+			if storage != nil {
+				if err := storage.RemoveObject(ctx, key); err != nil {
+					log.Printf("bulk delete: remove %s: %v", key, err)
+				}
+			}
+			if replica != nil {
+				_ = replica.RemoveObject(ctx, key)
+			}
+		}
+	}
+	// AddStorageUsed touches the users table (no RLS) — use the pool directly.
+	if err := s.queries.AddStorageUsed(ctx, username, -freed); err != nil {
+		log.Printf("bulk delete: update storage for %q: %v", username, err)
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBulkApply_Validation(t *testing.T) {
+	s := &BulkService{}
+	one := []uuid.UUID{uuid.New()}
+	many := make([]uuid.UUID, MaxBulkItems+1)
+	for i := range many {
+		many[i] = uuid.New()
+	}
+	cases := []struct {
+		name string
+		in   BulkInput
+		want error
+	}{
+		{"empty", BulkInput{Op: BulkHide}, ErrBulkEmpty},
+		{"duplicates only count once", BulkInput{Op: "nope", FileIDs: []uuid.UUID{one[0], one[0]}}, ErrBulkOperation},
+		{"too many", BulkInput{Op: BulkHide, FileIDs: many}, ErrBulkTooLarge},
+		{"unknown op", BulkInput{Op: "explode", FileIDs: one}, ErrBulkOperation},
+		{"move without target", BulkInput{Op: BulkMove, FolderIDs: one}, ErrBulkNoTarget},
+	}
+	for _, tc := range cases {
+		if _, err := s.Apply(context.Background(), tc.in); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v; want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestBulkItemErrors(t *testing.T) {
+	if err := bulkItemError(errBulkAlreadyDone); err != nil {
+		t.Errorf("already done = %v; want nil", err)
+	}
+	for _, err := range []error{ErrNotFound, ErrFolderNotEmpty, fmt.Errorf("wrapped: %w", ErrDuplicateName), ErrBulkFilesOnly} {
+		if !isBulkItemError(err) {
+			t.Errorf("isBulkItemError(%v) = false", err)
+		}
+	}
+	// Anything else fails the whole request, including a savepoint that
+	// could not be rolled back after an item-level error.
+	for _, err := range []error{errors.New("connection reset"), fmt.Errorf("Savepoint: roll back after %v: %w", ErrNotFound, errors.New("broken"))} {
+		if isBulkItemError(err) {
+			t.Errorf("isBulkItemError(%v) = true", err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// DefaultChangesLimit and MaxChangesLimit bound one page of changes.
+	DefaultChangesLimit = 500
+	MaxChangesLimit     = 5000
+	// changeRetention is how long journal entries are kept. A client that
+	// has not synced for longer starts over from a full listing.
+	changeRetention = 90 * 24 * time.Hour
+	// changePruneInterval is how often expired entries are swept.
+	changePruneInterval = 6 * time.Hour
+)
+
+var (
+	ErrChangeCursorInvalid = errors.New("invalid cursor")
+	ErrChangeCursorExpired = errors.New("cursor has expired; list the drive again and continue from a fresh cursor")
+)
+
+// ChangePage is one page of a user's change journal. Cursor is passed back
+// to fetch the changes after this page; it is returned even when the page
+// is empty. HasMore means the next page can be fetched right away.
+type ChangePage struct {
+	Changes []models.Change `json:"changes"`
+	Cursor  string          `json:"cursor"`
+	HasMore bool            `json:"has_more"`
+}
+
+// ChangeService serves the per-user change journal that the file and folder
+// queries write (see db/changes.go) and prunes entries past their retention.
+//
+// A sync client first asks for a cursor without passing one, lists the
+// drive, and from then on only fetches the changes after its cursor, so
+// staying in sync costs work in proportion to what changed.
+type ChangeService struct {
+	queries *db.Queries
+}
+
+// NewChangeService constructs a ChangeService.
+func NewChangeService(q *db.Queries) *ChangeService {
+	return &ChangeService{queries: q}
+}
+
+// Start prunes expired journal entries every changePruneInterval until ctx
+// is cancelled.
+func (s *ChangeService) Start(ctx context.Context) {
+	ticker := time.NewTicker(changePruneInterval)
+	defer ticker.Stop()
+
+	log.Printf("change journal: started (retention %s)", changeRetention)
+	for {
+		s.prune(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ChangeService) prune(ctx context.Context) {
+	n, err := s.queries.PruneChanges(ctx, time.Now().Add(-changeRetention))
+	if err != nil {
+		log.Printf("change journal: prune: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("change journal: pruned %d entries", n)
+	}
+}
+
+// List returns up to limit changes of userID after cursor. An empty cursor
+// returns no changes and the latest cursor, to be taken before a full
+// listing. Returns ErrChangeCursorInvalid for a cursor that was never
+// handed out and ErrChangeCursorExpired for one older than the journal.
+func (s *ChangeService) List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*ChangePage, error) {
+	switch {
+	case limit <= 0:
+		limit = DefaultChangesLimit
+	case limit > MaxChangesLimit:
+		limit = MaxChangesLimit
+	}
+
+	oldest, latest, err := s.queries.GetChangeBounds(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list changes: %w", err)
+	}
+	if cursor == "" {
+		return &ChangePage{Changes: []models.Change{}, Cursor: formatChangeCursor(latest)}, nil
+	}
+	after, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || after < 0 || after > latest {
+		return nil, ErrChangeCursorInvalid
+	}
+	if after < oldest-1 {
+		return nil, ErrChangeCursorExpired
+	}
+
+	changes, err := s.queries.ListChanges(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("list changes: %w", err)
+	}
+	page := &ChangePage{Changes: changes, Cursor: cursor}
+	if len(changes) > limit {
+		page.Changes, page.HasMore = changes[:limit], true
+	}
+	if n := len(page.Changes); n > 0 {
+		page.Cursor = formatChangeCursor(page.Changes[n-1].Seq)
+	}
+	return page, nil
+}
+
+func formatChangeCursor(seq int64) string {
+	return strconv.FormatInt(seq, 10)
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+// drainPollInterval is how often a drain checks on the migration it is waiting for.
+const drainPollInterval = 5 * time.Second
+
+var (
+	// ErrDriveNotFound is returned when the drive to drain does not exist.
+	ErrDriveNotFound = errors.New("drive not found")
+	// ErrDriveRetired is returned when draining a drive that is already retired.
+	ErrDriveRetired = errors.New("drive is already retired")
+)
+
+// DrainProgress is the admin-facing view of a drive drain. It is rebuilt from
+// the database on every call so it survives restarts.
+type DrainProgress struct {
+	Drive          models.Drive           `json:"drive"`
+	Running        bool                   `json:"running"`
+	UsersRemaining int                    `json:"users_remaining"`
+	BytesRemaining int64                  `json:"bytes_remaining"`
+	Migrations     []models.UserMigration `json:"migrations"`
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// DrainService empties a drive so it can be replaced. Draining deactivates
+// the drive (no new allocations), migrates each allocated user one at a time
+// to the best-fit active drive, and marks the drive retired once nobody is
+// left. Users whose migration fails are skipped; draining the drive again
+// retries them.
+type DrainService struct {
+	queries  *db.Queries
+	migrator *UserMigrationService
+	// selectDrive picks each user's new drive (DriveAllocator.SelectDrive).
+	// When nil, users go to the best-fit active drive.
+	selectDrive func(ctx context.Context, req AllocationRequest) (*models.Drive, error)
+
+	mu     sync.Mutex
+	active map[uuid.UUID]struct{} // drives with a drain goroutine in this process
+}
+
+// NewDrainService constructs a DrainService. selectDrive places the users
+// moved off a drained drive (DriveAllocator.SelectDrive); nil falls back to
+// best fit.
+func NewDrainService(q *db.Queries, migrator *UserMigrationService, selectDrive func(ctx context.Context, req AllocationRequest) (*models.Drive, error)) *DrainService {
+	return &DrainService{queries: q, migrator: migrator, selectDrive: selectDrive, active: make(map[uuid.UUID]struct{})}
+}
+
+// Start resumes every drain left unfinished by a previous process.
+func (s *DrainService) Start(ctx context.Context) {
+	drives, err := s.queries.ListDrivesByState(ctx, models.DriveStateDraining)
+	if err != nil {
+		log.Printf("drain service: list draining drives: %v", err)
+		return
+	}
+	log.Printf("drain service: started (resuming %d drain(s))", len(drives))
+	for _, d := range drives {
+		if s.claim(d.ID) {
+			go s.run(ctx, d.ID, "drain:"+d.Label)
+		}
+	}
+}
+
+// Drain puts driveID into the draining state and starts migrating its users
+// in the background. Calling it on a drive that is already draining retries
+// any users still left on it.
+func (s *DrainService) Drain(ctx context.Context, driveID uuid.UUID, startedBy string) (*DrainProgress, error) {
+	existing, err := s.queries.GetDrive(ctx, driveID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, ErrDriveNotFound
+	}
+	if existing.State == models.DriveStateRetired {
+		return nil, ErrDriveRetired
+	}
+	if _, err := s.queries.StartDriveDrain(ctx, driveID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDriveRetired
+		}
+		return nil, err
+	}
+	if s.claim(driveID) {
+		go s.run(context.Background(), driveID, startedBy)
+	}
+	return s.Progress(ctx, driveID)
+}
+
+// Progress reports the drain state of driveID.
+func (s *DrainService) Progress(ctx context.Context, driveID uuid.UUID) (*DrainProgress, error) {
+	d, err := s.queries.GetDrive(ctx, driveID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, ErrDriveNotFound
+	}
+	users, err := s.queries.ListDriveUsers(ctx, driveID)
+	if err != nil {
+		return nil, err
+	}
+	p := &DrainProgress{
+		Drive:          *d,
+		UsersRemaining: len(users),
+		Migrations:     []models.UserMigration{},
+	}
+	for _, u := range users {
+		p.BytesRemaining += u.UsedBytes
+	}
+	if d.DrainStartedAt != nil {
+		if p.Migrations, err = s.queries.ListMigrationsFromDrive(ctx, driveID, *d.DrainStartedAt); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	_, p.Running = s.active[driveID]
+	s.mu.Unlock()
+	return p, nil
+}
+
+func (s *DrainService) claim(driveID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.active[driveID]; ok {
+		return false
+	}
+	s.active[driveID] = struct{}{}
+	return true
+}
+
+func (s *DrainService) release(driveID uuid.UUID) {
+	s.mu.Lock()
+	delete(s.active, driveID)
+	s.mu.Unlock()
+}
+
+// ── Run ───────────────────────────────────────────────────────────────────────
+
+// run migrates every user off driveID and retires it. The caller must have
+// claimed driveID.
+func (s *DrainService) run(ctx context.Context, driveID uuid.UUID, startedBy string) {
+	defer s.release(driveID)
+	log.Printf("drain: drive %s started", driveID)
+
+	users, err := s.queries.ListDriveUsers(ctx, driveID)
+	if err != nil {
+		log.Printf("drain: drive %s: %v", driveID, err)
+		return
+	}
+	failed := 0
+	for _, u := range users {
+		if err := s.moveUser(ctx, driveID, u, startedBy); err != nil {
+			log.Printf("drain: drive %s: user %q: %v", driveID, u.Username, err)
+			failed++
+		}
+	}
+
+	retired, err := s.queries.RetireDrive(ctx, driveID)
+	switch {
+	case err != nil:
+		log.Printf("drain: drive %s: %v", driveID, err)
+	case retired:
+		log.Printf("drain: drive %s retired", driveID)
+	default:
+		log.Printf("drain: drive %s still has users (%d migration(s) failed); drain again to retry", driveID, failed)
+	}
+}
+
+// moveUser migrates one user off driveID to the drive the allocation policy
+// picks and waits for the migration to finish.
+func (s *DrainService) moveUser(ctx context.Context, driveID uuid.UUID, u db.DriveUser, startedBy string) error {
+	target, err := s.selectTarget(ctx, driveID, u)
+	if err != nil {
+		return err
+	}
+	m, err := s.migrator.Migrate(ctx, u.Username, target.ID, startedBy)
+	if err != nil {
+		return fmt.Errorf("migrate to %s: %w", target.Label, err)
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		latest, err := s.migrator.Latest(ctx, u.Username)
+		if err != nil {
+			return err
+		}
+		if latest == nil || latest.ID != m.ID {
+			return fmt.Errorf("migration %s disappeared", m.ID)
+		}
+		switch latest.Status {
+		case models.UserMigrationDone:
+			return nil
+		case models.UserMigrationFailed:
+			return fmt.Errorf("migration %s failed: %s", m.ID, derefString(latest.Error))
+		}
+	}
+}
+
+// selectTarget picks the drive u moves to off driveID, with the allocation
+// policy like a newly registered user. The best-fit fallback cannot pick
+// driveID either: StartDriveDrain deactivated it.
+func (s *DrainService) selectTarget(ctx context.Context, driveID uuid.UUID, u db.DriveUser) (*models.Drive, error) {
+	if s.selectDrive == nil {
+		return s.queries.SelectDriveForQuota(ctx, u.QuotaBytes)
+	}
+	return s.selectDrive(ctx, AllocationRequest{
+		QuotaBytes:     u.QuotaBytes,
+		Premium:        u.IsPremium,
+		ExcludeDriveID: &driveID,
+	})
+}
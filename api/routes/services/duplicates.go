@@ -0,0 +1,383 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+// Hamming-distance thresholds for GET /me/media/duplicates. 0 finds exact
+// visual copies only; around 4 also catches re-saved and re-compressed
+// copies; towards 10 it groups burst shots of the same scene.
+const (
+	DefaultDuplicateThreshold = 4
+	MaxDuplicateThreshold     = 10
+)
+
+// DuplicateAction is what ResolveDuplicates does with the copies not kept.
+type DuplicateAction string
+
+const (
+	DuplicateHide   DuplicateAction = "hide"
+	DuplicateDelete DuplicateAction = "delete"
+)
+
+// ErrNotDuplicate is reported for a file that is not a near-duplicate of the
+// copy it was resolved against.
+var ErrNotDuplicate = errors.New("file is not a duplicate of the kept copy")
+
+// DuplicateCluster is a group of visually similar images. Files[0] is the
+// suggested copy to keep (see bestCopy); ReclaimableBytes is the size of the
+// others.
+type DuplicateCluster struct {
+	KeepFileID       uuid.UUID        `json:"keep_file_id"`
+	Files            []db.HashedImage `json:"files"`
+	TotalBytes       int64            `json:"total_bytes"`
+	ReclaimableBytes int64            `json:"reclaimable_bytes"`
+}
+
+// DuplicateGroup names one copy to keep and the copies to hide or delete.
+type DuplicateGroup struct {
+	Keep    uuid.UUID   `json:"keep"`
+	Discard []uuid.UUID `json:"discard"`
+}
+
+// DuplicateFailure is a file ResolveDuplicates left alone, and why.
+type DuplicateFailure struct {
+	FileID uuid.UUID `json:"file_id"`
+	Error  string    `json:"error"`
+}
+
+// DuplicateResolution summarises a ResolveDuplicates call.
+type DuplicateResolution struct {
+	Resolved   int                `json:"resolved"`
+	FreedBytes int64              `json:"freed_bytes"`
+	Failed     []DuplicateFailure `json:"failed"`
+}
+
+// ── Hashing ───────────────────────────────────────────────────────────────────
+
+// PerceptualHash returns the 64-bit difference hash of an encoded image.
+func PerceptualHash(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("decode image: %w", err)
+	}
+	return dHash(img), nil
+}
+
+// dHash reduces img to a 9×8 grayscale grid by averaging and sets one bit per
+// row-adjacent pair whose left pixel is brighter than its right. The result
+// survives rescaling, recompression and small exposure changes.
+func dHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 {
+		return 0
+	}
+
+	var sums, counts [w * h]uint64
+	for y := 0; y < sh; y++ {
+		row := (y * h / sh) * w
+		for x := 0; x < sw; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			// ITU-R BT.601 luma, in 16-bit range.
+			i := row + x*w/sw
+			sums[i] += (299*uint64(r) + 587*uint64(g) + 114*uint64(bl)) / 1000
+			counts[i]++
+		}
+	}
+	var gray [w * h]uint64
+	for i := range gray {
+		if counts[i] > 0 {
+			gray[i] = sums[i] / counts[i]
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y*w+x] > gray[y*w+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// runPerceptualHashJob records the perceptual hash of the job's image from
+// its stored small thumbnail, the same bytes the thumbnail job hashes. An
+// image without one has a thumbnail job queued instead, which records the
+// hash as it renders.
+func (s *FileService) runPerceptualHashJob(ctx context.Context, job *models.Job) error {
+	file, err := s.GetMetadata(ctx, job.FileID, job.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil // deleted since the job was queued
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(file.MimeType, "image/") {
+		return permanentJobError(fmt.Errorf("%s is not an image", file.MimeType))
+	}
+
+	thumb, err := s.Thumbnail(ctx, file, job.Username, ThumbnailSmall)
+	switch {
+	case errors.Is(err, ErrThumbnailPending):
+		return nil // the thumbnail job records the hash
+	case errors.Is(err, ErrNotFound):
+		return permanentJobError(fmt.Errorf("no thumbnail for %s", file.MimeType))
+	case err != nil:
+		return err
+	}
+	hash, err := PerceptualHash(thumb)
+	if err != nil {
+		return permanentJobError(fmt.Errorf("perceptual hash: %w", err))
+	}
+	if err := s.queries.SetFilePerceptualHash(ctx, file.ID, hash); err != nil {
+		return fmt.Errorf("persist perceptual hash: %w", err)
+	}
+	return nil
+}
+
+// unhashedImages lists the images of userID that can be thumbnailed but have
+// no perceptual hash. Backfill for JobKindPerceptualHash.
+func (s *FileService) unhashedImages(ctx context.Context, userID uuid.UUID) ([]models.File, error) {
+	if s.thumbs == nil {
+		return nil, nil
+	}
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	files, err := q.ListUnhashedImages(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := files[:0]
+	for _, f := range files {
+		if s.thumbs.Supports(f.MimeType) {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// hammingDistance counts the bits in which two hashes differ.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// clusterHashes groups the indexes of hashes into clusters whose members are
+// linked by chains of pairs at most threshold bits apart. Singletons are
+// dropped. Rather than comparing every pair it splits each hash into
+// threshold+1 bands: two hashes within threshold bits must agree on at least
+// one whole band (pigeonhole), so only hashes sharing a band are compared.
+func clusterHashes(hashes []uint64, threshold int) [][]int {
+	// Identical hashes are one node; this also keeps buckets of e.g. plain
+	// black frames from degrading into a full pairwise comparison.
+	byHash := make(map[uint64][]int)
+	var unique []uint64
+	for i, h := range hashes {
+		if _, ok := byHash[h]; !ok {
+			unique = append(unique, h)
+		}
+		byHash[h] = append(byHash[h], i)
+	}
+
+	parent := make([]int, len(unique))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	bands := threshold + 1
+	for band := 0; band < bands; band++ {
+		lo, hi := band*64/bands, (band+1)*64/bands
+		mask := (^uint64(0) >> (64 - (hi - lo))) << lo
+		buckets := make(map[uint64][]int)
+		for i, h := range unique {
+			buckets[h&mask] = append(buckets[h&mask], i)
+		}
+		for _, members := range buckets {
+			for a := 0; a < len(members); a++ {
+				for b := a + 1; b < len(members); b++ {
+					i, j := members[a], members[b]
+					if hammingDistance(unique[i], unique[j]) <= threshold {
+						parent[find(i)] = find(j)
+					}
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i, h := range unique {
+		root := find(i)
+		groups[root] = append(groups[root], byHash[h]...)
+	}
+	var out [][]int
+	for _, g := range groups {
+		if len(g) > 1 {
+			sort.Ints(g)
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// bestCopy orders images most-worth-keeping first: the most pixels, then the
+// largest file (least compressed), then the earliest capture or upload (the
+// original rather than a copy).
+func bestCopy(a, b *db.HashedImage) bool {
+	if pa, pb := pixels(a), pixels(b); pa != pb {
+		return pa > pb
+	}
+	if a.SizeBytes != b.SizeBytes {
+		return a.SizeBytes > b.SizeBytes
+	}
+	if ta, tb := capturedAt(a), capturedAt(b); !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return a.FileID.String() < b.FileID.String()
+}
+
+func pixels(img *db.HashedImage) int64 {
+	if img.Width == nil || img.Height == nil {
+		return 0
+	}
+	return int64(*img.Width) * int64(*img.Height)
+}
+
+func capturedAt(img *db.HashedImage) time.Time {
+	if img.TakenAt != nil {
+		return *img.TakenAt
+	}
+	return img.CreatedAt
+}
+
+// ── FileService operations ────────────────────────────────────────────────────
+
+// FindDuplicates returns userID's visually similar images, grouped into
+// clusters whose members are at most threshold bits apart (transitively).
+// Hidden files are left out, so resolving a cluster by hiding removes it.
+// Clusters are ordered by the space deleting the extra copies would free.
+func (s *FileService) FindDuplicates(ctx context.Context, userID uuid.UUID, threshold int) ([]DuplicateCluster, error) {
+	images, err := s.hashedImages(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("find duplicates: %w", err)
+	}
+
+	hashes := make([]uint64, len(images))
+	for i, img := range images {
+		hashes[i] = img.Hash
+	}
+	out := make([]DuplicateCluster, 0)
+	for _, members := range clusterHashes(hashes, threshold) {
+		c := DuplicateCluster{Files: make([]db.HashedImage, len(members))}
+		for i, idx := range members {
+			c.Files[i] = images[idx]
+			c.TotalBytes += images[idx].SizeBytes
+		}
+		sort.Slice(c.Files, func(i, j int) bool { return bestCopy(&c.Files[i], &c.Files[j]) })
+		c.KeepFileID = c.Files[0].FileID
+		c.ReclaimableBytes = c.TotalBytes - c.Files[0].SizeBytes
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ReclaimableBytes != out[j].ReclaimableBytes {
+			return out[i].ReclaimableBytes > out[j].ReclaimableBytes
+		}
+		return out[i].KeepFileID.String() < out[j].KeepFileID.String()
+	})
+	return out, nil
+}
+
+// ResolveDuplicates keeps one copy of each group and hides or deletes the
+// rest. There is no trash: DuplicateDelete removes the files permanently.
+// A discarded file must be a visible image of userID within
+// MaxDuplicateThreshold bits of its group's kept copy, so a mistaken request
+// cannot remove unrelated files or every copy of a photo; files failing that
+// check, or whose hide/delete fails, are reported in Failed and skipped.
+func (s *FileService) ResolveDuplicates(ctx context.Context, userID uuid.UUID, username string, action DuplicateAction, groups []DuplicateGroup) (*DuplicateResolution, error) {
+	images, err := s.hashedImages(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve duplicates: %w", err)
+	}
+	byID := make(map[uuid.UUID]*db.HashedImage, len(images))
+	for i := range images {
+		byID[images[i].FileID] = &images[i]
+	}
+
+	res := &DuplicateResolution{Failed: make([]DuplicateFailure, 0)}
+	fail := func(id uuid.UUID, err error) {
+		res.Failed = append(res.Failed, DuplicateFailure{FileID: id, Error: err.Error()})
+	}
+	for _, g := range groups {
+		keep, ok := byID[g.Keep]
+		if !ok {
+			for _, id := range g.Discard {
+				fail(id, fmt.Errorf("kept copy %s: %w", g.Keep, ErrNotFound))
+			}
+			continue
+		}
+		for _, id := range g.Discard {
+			img, ok := byID[id]
+			switch {
+			case !ok:
+				fail(id, ErrNotFound)
+				continue
+			case id == g.Keep || hammingDistance(img.Hash, keep.Hash) > MaxDuplicateThreshold:
+				fail(id, ErrNotDuplicate)
+				continue
+			}
+
+			if action == DuplicateDelete {
+				err = s.Delete(ctx, id, userID, username)
+			} else {
+				_, err = s.SetHidden(ctx, id, userID, true)
+			}
+			if err != nil {
+				fail(id, err)
+				continue
+			}
+			// Each file is resolved once even if it is listed in several groups.
+			delete(byID, id)
+			res.Resolved++
+			if action == DuplicateDelete {
+				res.FreedBytes += img.SizeBytes
+			}
+		}
+	}
+	return res, nil
+}
+
+// hashedImages lists userID's hashed images inside a user-scoped transaction.
+func (s *FileService) hashedImages(ctx context.Context, userID uuid.UUID) ([]db.HashedImage, error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	return q.ListHashedImages(ctx, userID)
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+)
+
+// gradientImage draws a diagonal gradient with a dark square left of centre.
+func gradientImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*255/w + y*255/h) / 2)
+			img.Set(x, y, color.RGBA{v, v, v, 0xff})
+		}
+	}
+	for y := h / 4; y < h/2; y++ {
+		for x := w / 8; x < w/8+w/4; x++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+	return img
+}
+
+// mirror flips img left to right.
+func mirror(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.Set(b.Max.X-1-x, y, img.At(x, y))
+		}
+	}
+	return out
+}
+
+func TestPerceptualHash_SimilarAndDifferent(t *testing.T) {
+	encode := func(img image.Image, quality int) []byte {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	hash := func(data []byte) uint64 {
+		h, err := PerceptualHash(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	original := hash(encode(gradientImage(640, 480), 95))
+	// A downscaled, heavily recompressed copy stays within a few bits.
+	resaved := hash(encode(scaleToFit(gradientImage(640, 480), 200), 30))
+	if d := hammingDistance(original, resaved); d > DefaultDuplicateThreshold {
+		t.Errorf("re-saved copy is %d bits away, want ≤ %d", d, DefaultDuplicateThreshold)
+	}
+	other := hash(encode(mirror(gradientImage(640, 480)), 95))
+	if d := hammingDistance(original, other); d <= MaxDuplicateThreshold {
+		t.Errorf("different image is only %d bits away", d)
+	}
+
+	if _, err := PerceptualHash([]byte("not an image")); err == nil {
+		t.Error("expected an error for non-image bytes")
+	}
+}
+
+func TestClusterHashes(t *testing.T) {
+	hashes := []uint64{
+		0x0000_0000_0000_0000,
+		0xFFFF_FFFF_FFFF_FFFF,
+		0x0000_0000_0000_0003, // 2 bits from [0]
+		0x0000_0000_0000_0000, // identical to [0]
+		0xFFFF_FFFF_FFFF_FFF0, // 4 bits from [1]
+		0x00FF_00FF_00FF_00FF, // far from everything
+		0x0000_0000_0000_001F, // 3 bits from [2], 5 from [0]: joins by chain
+	}
+	got := clusterHashes(hashes, 3)
+	if len(got) != 1 || !reflect.DeepEqual(got[0], []int{0, 2, 3, 6}) {
+		t.Errorf("threshold 3: got %v, want [[0 2 3 6]]", got)
+	}
+
+	got = clusterHashes(hashes, 4)
+	if len(got) != 2 {
+		t.Fatalf("threshold 4: got %v, want two clusters", got)
+	}
+
+	got = clusterHashes(hashes, 0)
+	if len(got) != 1 || !reflect.DeepEqual(got[0], []int{0, 3}) {
+		t.Errorf("threshold 0: got %v, want [[0 3]]", got)
+	}
+}
+
+func TestBestCopy(t *testing.T) {
+	w, h := 4000, 3000
+	sw, sh := 1000, 750
+	old := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	big := db.HashedImage{FileID: uuid.New(), Width: &w, Height: &h, SizeBytes: 100, CreatedAt: old.Add(time.Hour)}
+	small := db.HashedImage{FileID: uuid.New(), Width: &sw, Height: &sh, SizeBytes: 900, CreatedAt: old}
+	if !bestCopy(&big, &small) || bestCopy(&small, &big) {
+		t.Error("more pixels should win over a larger file")
+	}
+
+	heavier := small
+	heavier.FileID, heavier.SizeBytes = uuid.New(), 1000
+	if !bestCopy(&heavier, &small) {
+		t.Error("same resolution: the larger (less compressed) file should win")
+	}
+
+	later := small
+	later.FileID, later.TakenAt = uuid.New(), &[]time.Time{old.Add(time.Minute)}[0]
+	if !bestCopy(&small, &later) {
+		t.Error("otherwise the earliest capture should win")
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// MaxEventStreamsPerUser caps the open event streams of one user (tabs,
+	// devices and sync clients together).
+	MaxEventStreamsPerUser = 20
+	// eventStreamBuffer is the per-stream channel capacity. A stream that
+	// falls this far behind is sent a resync instead of the events it missed.
+	eventStreamBuffer = 64
+
+	eventListenerMinReconnect = 10 * time.Second
+	eventListenerMaxReconnect = time.Minute
+	// eventListenerPingInterval is how long the listener waits without a
+	// notification before checking that its connection is still alive.
+	eventListenerPingInterval = 90 * time.Second
+)
+
+var ErrTooManyEventStreams = errors.New("too many open event streams")
+
+// EventService fans user events out to the event streams open on this
+// server. Events are published with PostgreSQL NOTIFY (see db.EventChannel)
+// by whatever changed the user's data, here or on another API instance, and
+// reach subscribers only once the publishing transaction has committed.
+//
+// Delivery is best effort: a stream that cannot keep up, or any stream while
+// the listener reconnects, is sent a resync event and should catch up
+// through the change journal.
+type EventService struct {
+	dsn   string
+	sinks []func(Event) // set before Start; see AddSink
+
+	mu   sync.RWMutex
+	subs map[uuid.UUID]map[chan []byte]struct{}
+}
+
+// Event is one notification heard on db.EventChannel. UserID is uuid.Nil
+// for admin events.
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewEventService constructs an EventService that listens on the database
+// at dsn.
+func NewEventService(dsn string) *EventService {
+	return &EventService{dsn: dsn, subs: make(map[uuid.UUID]map[chan []byte]struct{})}
+}
+
+// Start listens on db.EventChannel and dispatches notifications until ctx is
+// cancelled. The listener reconnects on its own after connection loss.
+func (s *EventService) Start(ctx context.Context) {
+	l := pq.NewListener(s.dsn, eventListenerMinReconnect, eventListenerMaxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("events: listener %s: %v", ev, err)
+		}
+	})
+	defer l.Close()
+	if err := l.Listen(db.EventChannel); err != nil {
+		log.Printf("events: listen: %v", err)
+		return
+	}
+
+	log.Printf("events: started")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-l.Notify:
+			if n == nil {
+				// The connection was re-established; anything published
+				// in between is lost.
+				s.resyncAll()
+				continue
+			}
+			s.dispatch(n.Extra)
+		case <-time.After(eventListenerPingInterval):
+			go func() { _ = l.Ping() }()
+		}
+	}
+}
+
+// AddSink registers fn to be called with every event heard, including
+// admin events. It must be called before Start, and fn must not block: it
+// runs on the listener goroutine.
+func (s *EventService) AddSink(fn func(Event)) {
+	s.sinks = append(s.sinks, fn)
+}
+
+// Subscribe opens an event stream for userID. Every message is one encoded
+// event, {"type", "data"}. Returns ErrTooManyEventStreams when the user
+// already has MaxEventStreamsPerUser streams open.
+func (s *EventService) Subscribe(userID uuid.UUID) (chan []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subs[userID]) >= MaxEventStreamsPerUser {
+		return nil, ErrTooManyEventStreams
+	}
+	ch := make(chan []byte, eventStreamBuffer)
+	if s.subs[userID] == nil {
+		s.subs[userID] = make(map[chan []byte]struct{})
+	}
+	s.subs[userID][ch] = struct{}{}
+	return ch, nil
+}
+
+// Unsubscribe closes a stream opened by Subscribe.
+func (s *EventService) Unsubscribe(userID uuid.UUID, ch chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[userID][ch]; !ok {
+		return
+	}
+	delete(s.subs[userID], ch)
+	if len(s.subs[userID]) == 0 {
+		delete(s.subs, userID)
+	}
+	close(ch)
+}
+
+// eventMessage is a client-facing event.
+type eventMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+var resyncMessage, _ = json.Marshal(eventMessage{Type: models.EventResync})
+
+// dispatch decodes a notification payload, hands the event to the sinks and
+// sends it to the streams of its user.
+func (s *EventService) dispatch(payload string) {
+	var ev Event
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		log.Printf("events: bad payload: %v", err)
+		return
+	}
+	for _, fn := range s.sinks {
+		fn(ev)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.subs[ev.UserID]) == 0 {
+		return
+	}
+	msg, err := json.Marshal(eventMessage{Type: ev.Type, Data: ev.Data})
+	if err != nil {
+		return
+	}
+	for ch := range s.subs[ev.UserID] {
+		sendEvent(ch, msg)
+	}
+}
+
+// resyncAll tells every open stream to catch up.
+func (s *EventService) resyncAll() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, chs := range s.subs {
+		for ch := range chs {
+			sendEvent(ch, resyncMessage)
+		}
+	}
+}
+
+// sendEvent delivers msg without blocking. When ch is full a queued message
+// is dropped to make room for a resync, which supersedes what was lost.
+func sendEvent(ch chan []byte, msg []byte) {
+	select {
+	case ch <- msg:
+		return
+	default:
+	}
+	for {
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- resyncMessage:
+			return
+		default:
+		}
+	}
+}
+
+// publishEvent publishes a user event outside any transaction. Failures are
+// logged; events are a convenience and never fail the operation behind them.
+func (s *FileService) publishEvent(ctx context.Context, userID uuid.UUID, eventType string, data any) {
+	if err := s.queries.PublishEvent(ctx, userID, eventType, data); err != nil {
+		log.Printf("events: %v", err)
+	}
+}
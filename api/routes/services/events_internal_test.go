@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEventServiceDispatch(t *testing.T) {
+	s := NewEventService("")
+	alice, bob := uuid.New(), uuid.New()
+	a1, _ := s.Subscribe(alice)
+	a2, _ := s.Subscribe(alice)
+	b, _ := s.Subscribe(bob)
+
+	s.dispatch(`{"user_id":"` + alice.String() + `","type":"change","data":{"seq":3}}`)
+	for i, ch := range []chan []byte{a1, a2} {
+		select {
+		case msg := <-ch:
+			if want := `{"type":"change","data":{"seq":3}}`; string(msg) != want {
+				t.Errorf("stream %d got %s; want %s", i, msg, want)
+			}
+		default:
+			t.Errorf("stream %d got nothing", i)
+		}
+	}
+	if len(b) != 0 {
+		t.Error("event leaked to another user")
+	}
+
+	s.dispatch(`not json`)
+	s.Unsubscribe(alice, a1)
+	if _, ok := <-a1; ok {
+		t.Error("unsubscribed stream is still open")
+	}
+	s.Unsubscribe(alice, a1) // second call is a no-op
+}
+
+func TestEventServiceOverflowResyncs(t *testing.T) {
+	s := NewEventService("")
+	user := uuid.New()
+	ch, _ := s.Subscribe(user)
+
+	for i := 0; i < eventStreamBuffer+5; i++ {
+		s.dispatch(`{"user_id":"` + user.String() + `","type":"change","data":{}}`)
+	}
+	if len(ch) != eventStreamBuffer {
+		t.Fatalf("queued %d messages; want %d", len(ch), eventStreamBuffer)
+	}
+	var last []byte
+	for len(ch) > 0 {
+		last = <-ch
+	}
+	if string(last) != string(resyncMessage) {
+		t.Errorf("last message %s; want a resync", last)
+	}
+}
+
+func TestEventServiceStreamLimit(t *testing.T) {
+	s := NewEventService("")
+	user := uuid.New()
+	for i := 0; i < MaxEventStreamsPerUser; i++ {
+		if _, err := s.Subscribe(user); err != nil {
+			t.Fatalf("Subscribe %d: %v", i, err)
+		}
+	}
+	if _, err := s.Subscribe(user); !errors.Is(err, ErrTooManyEventStreams) {
+		t.Errorf("err = %v; want ErrTooManyEventStreams", err)
+	}
+	if _, err := s.Subscribe(uuid.New()); err != nil {
+		t.Errorf("other user: %v", err)
+	}
+}
@@ -16,7 +16,6 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
-	"github.com/minio/minio-go/v7"
 
 	"apollo-sfs.com/api/db"
 	"apollo-sfs.com/api/models"
@@ -44,11 +43,19 @@ type UploadInput struct {
 	// MimeType is provided by the client. If empty the service detects it from
 	// the file contents. Always treat as a hint; server-detected type is preferred.
 	MimeType string
+	// ExactFolder places the file in FolderID even when it is media that
+	// would otherwise be routed to the user's auto-upload folder. Set by
+	// clients that address files by path, such as WebDAV.
+	ExactFolder bool
 	// Reader is the raw plaintext byte stream (multipart file reader).
 	// The service reads it fully into memory before encrypting; this is required
 	// for single-blob AES-256-GCM and for MIME detection. Video files use chunked
 	// AES-256-GCM (1 MiB chunks with independent nonces) for range-based streaming.
 	Reader io.Reader
+	// Replace, when set, stores the upload as the new content of that file
+	// instead of creating one; FolderID, Name and ExactFolder are ignored.
+	// See saveUpload.
+	Replace *models.File
 }
 
 // ── Service ───────────────────────────────────────────────────────────────────
@@ -93,7 +100,7 @@ type raEntry struct {
 }
 
 type cachedAlloc struct {
-	storage   *MinIOService
+	storage   BlobStore
 	driveID   uuid.UUID
 	expiresAt time.Time
 }
@@ -108,6 +115,9 @@ type FileService struct {
 	email        *EmailService
 	transcode    *TranscodeService
 	meta         *MetadataService
+	thumbs       *ThumbnailService
+	text         *TextExtractService
+	jobs         *JobService // set by RegisterJobs; nil disables background media work
 	quotaWarnPct int
 
 	userCacheMu sync.RWMutex
@@ -115,6 +125,7 @@ type FileService struct {
 
 	allocCacheMu sync.RWMutex
 	allocCache   map[string]cachedAlloc
+	replicaCache map[string]cachedAlloc // storage is nil for users without a replica
 
 	raMu       sync.Mutex
 	raCache    map[raKey]*raEntry
@@ -122,7 +133,7 @@ type FileService struct {
 }
 
 // NewFileService constructs a FileService.
-func NewFileService(q *db.Queries, registry *MinIORegistry, enc *EncryptionService, email *EmailService, transcode *TranscodeService, meta *MetadataService, cfg FileServiceConfig) *FileService {
+func NewFileService(q *db.Queries, registry *MinIORegistry, enc *EncryptionService, email *EmailService, transcode *TranscodeService, meta *MetadataService, thumbs *ThumbnailService, text *TextExtractService, cfg FileServiceConfig) *FileService {
 	return &FileService{
 		queries:      q,
 		registry:     registry,
@@ -130,17 +141,20 @@ func NewFileService(q *db.Queries, registry *MinIORegistry, enc *EncryptionServi
 		email:        email,
 		transcode:    transcode,
 		meta:         meta,
+		thumbs:       thumbs,
+		text:         text,
 		quotaWarnPct: cfg.QuotaWarnPct,
 		userCache:    make(map[string]cachedUser),
 		allocCache:   make(map[string]cachedAlloc),
+		replicaCache: make(map[string]cachedAlloc),
 		raCache:      make(map[raKey]*raEntry),
 		raInflight:   make(map[raKey]struct{}),
 	}
 }
 
-// storageFor returns the MinIOService and driveID for the given user. Results
+// storageFor returns the BlobStore and driveID for the given user. Results
 // are cached for userCacheTTL to avoid a DB round-trip on every range request.
-func (s *FileService) storageFor(ctx context.Context, username string) (*MinIOService, uuid.UUID, error) {
+func (s *FileService) storageFor(ctx context.Context, username string) (BlobStore, uuid.UUID, error) {
 	s.allocCacheMu.RLock()
 	entry, ok := s.allocCache[username]
 	s.allocCacheMu.RUnlock()
@@ -155,11 +169,10 @@ func (s *FileService) storageFor(ctx context.Context, username string) (*MinIOSe
 	if alloc == nil {
 		return nil, uuid.Nil, fmt.Errorf("storage lookup for %q: no drive allocation", username)
 	}
-	client, ok := s.registry.Client(alloc.Server.ID)
+	svc, ok := s.registry.Store(alloc.Server.ID, alloc.Drive.MinioBucket)
 	if !ok {
-		return nil, uuid.Nil, fmt.Errorf("storage lookup for %q: no MinIO client for server %s", username, alloc.Server.Name)
+		return nil, uuid.Nil, fmt.Errorf("storage lookup for %q: server %s: %w", username, alloc.Server.Name, ErrStorageUnavailable)
 	}
-	svc := NewMinIOService(client, alloc.Drive.MinioBucket)
 
 	s.allocCacheMu.Lock()
 	s.allocCache[username] = cachedAlloc{
@@ -172,6 +185,66 @@ func (s *FileService) storageFor(ctx context.Context, username string) (*MinIOSe
 	return svc, alloc.DriveID, nil
 }
 
+// checkDrive locks username's drive allocation in the transaction behind q
+// and returns ErrDriveMoved unless it is still driveID, the drive a new blob
+// was just stored on. Holding the lock until commit keeps a migration from
+// flipping the allocation before the files row exists, so its sweep copies
+// the blob; a row that would point at the old drive after the flip, whose
+// objects the migration deletes, is refused instead.
+func (s *FileService) checkDrive(ctx context.Context, q *db.Queries, username string, driveID uuid.UUID) error {
+	current, err := q.LockUserDrive(ctx, username)
+	if err != nil {
+		return err
+	}
+	if current != driveID {
+		s.forgetStorage(username)
+		return ErrDriveMoved
+	}
+	return nil
+}
+
+// replicaFor returns the BlobStore and driveID of the user's replica
+// drive, or a nil BlobStore when the user has no replica. Cached like
+// storageFor.
+func (s *FileService) replicaFor(ctx context.Context, username string) (BlobStore, uuid.UUID, error) {
+	s.allocCacheMu.RLock()
+	entry, ok := s.replicaCache[username]
+	s.allocCacheMu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.storage, entry.driveID, nil
+	}
+
+	alloc, err := s.queries.GetUserReplicaDrive(ctx, username)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("replica lookup for %q: %w", username, err)
+	}
+	entry = cachedAlloc{expiresAt: time.Now().Add(userCacheTTL)}
+	if alloc != nil {
+		store, ok := s.registry.Store(alloc.Server.ID, alloc.Drive.MinioBucket)
+		if !ok {
+			return nil, uuid.Nil, fmt.Errorf("replica lookup for %q: server %s: %w", username, alloc.Server.Name, ErrStorageUnavailable)
+		}
+		entry.storage = store
+		entry.driveID = alloc.DriveID
+	}
+
+	s.allocCacheMu.Lock()
+	s.replicaCache[username] = entry
+	s.allocCacheMu.Unlock()
+
+	return entry.storage, entry.driveID, nil
+}
+
+// forgetStorage drops the cached drive allocations for username so the next
+// storageFor or replicaFor call re-reads them (e.g. after the user has been
+// migrated or their replica moved).
+func (s *FileService) forgetStorage(username string) {
+	s.allocCacheMu.Lock()
+	delete(s.allocCache, username)
+	delete(s.replicaCache, username)
+	s.allocCacheMu.Unlock()
+}
+
 // ── Public operations ─────────────────────────────────────────────────────────
 
 // Upload reads the plaintext stream from in.Reader, detects the MIME type,
@@ -193,13 +266,18 @@ func (s *FileService) Upload(ctx context.Context, in UploadInput) (*models.File,
 	}
 
 	// 2b. Auto-route image/video uploads to the user's media folder if configured.
-	in.FolderID = s.resolveUploadFolder(ctx, in.Username, in.FolderID, mimeType)
+	if !in.ExactFolder && in.Replace == nil {
+		in.FolderID = s.resolveUploadFolder(ctx, in.Username, in.FolderID, mimeType)
+	}
 
-	// 2c. For images, extract the capture date now (plaintext is already in
-	// memory). Videos are probed asynchronously after the blob is stored.
+	// 2c. For images, extract the capture date and media metadata now
+	// (plaintext is already in memory). Videos are probed asynchronously
+	// after the blob is stored.
 	var takenAt *time.Time
+	var media *models.MediaMetadata
 	if strings.HasPrefix(mimeType, "image/") {
 		takenAt = ExtractImageTakenAt(plaintext)
+		media = ExtractImageMetadata(plaintext)
 	}
 
 	// 3. Quota check.
@@ -208,7 +286,11 @@ func (s *FileService) Upload(ctx context.Context, in UploadInput) (*models.File,
 		return nil, fmt.Errorf("upload: get user: %w", err)
 	}
 	fileSize := int64(len(plaintext))
-	if user.StorageUsedBytes+fileSize > user.StorageQuotaBytes {
+	added := fileSize
+	if in.Replace != nil {
+		added -= in.Replace.SizeBytes
+	}
+	if user.StorageUsedBytes+added > user.StorageQuotaBytes {
 		return nil, ErrQuotaExceeded
 	}
 
@@ -263,7 +345,11 @@ func (s *FileService) Upload(ctx context.Context, in UploadInput) (*models.File,
 		return nil, fmt.Errorf("upload: begin tx: %w", err)
 	}
 	defer func() { _ = utx.Rollback() }()
-	file, err := uq.CreateFile(ctx, &models.File{
+	if err := s.checkDrive(ctx, uq, in.Username, driveID); err != nil {
+		_ = storage.RemoveObject(ctx, objectKey)
+		return nil, fmt.Errorf("upload: %w", err)
+	}
+	file, err := saveUpload(ctx, uq, in.Replace, &models.File{
 		ID:             fileID,
 		UserID:         in.UserID,
 		FolderID:       in.FolderID,
@@ -289,44 +375,121 @@ func (s *FileService) Upload(ctx context.Context, in UploadInput) (*models.File,
 		return nil, fmt.Errorf("upload: commit: %w", err)
 	}
 
+	// 8b. Write the second copy when the user is replicated.
+	s.replicate(ctx, in.Username, fileID, objectKey, func(dst BlobStore) error {
+		return dst.PutObject(ctx, objectKey, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream")
+	})
+
 	// 8. Update the user's running storage total (users table has no RLS).
-	if err := s.queries.AddStorageUsed(ctx, in.Username, fileSize); err != nil {
+	if in.Replace != nil {
+		s.dropReplaced(ctx, in.Username, in.Replace)
+	}
+	if err := s.queries.AddStorageUsed(ctx, in.Username, added); err != nil {
 		return nil, fmt.Errorf("upload: update storage: %w", err)
 	}
 
-	// 9. Send quota warning / limit email if the upload crossed a threshold.
-	// Failures are non-fatal and logged; they must not block the upload response.
-	if s.email != nil && s.quotaWarnPct > 0 {
-		newUsed := user.StorageUsedBytes + fileSize
-		pct := int(newUsed * 100 / user.StorageQuotaBytes)
-		prevPct := int(user.StorageUsedBytes * 100 / user.StorageQuotaBytes)
-		usedFmt := fmtBytes(newUsed)
-		quotaFmt := fmtBytes(user.StorageQuotaBytes)
-		switch {
-		case pct >= 100 && prevPct < 100:
-			if err := s.email.SendQuotaLimit(ctx, user, usedFmt, quotaFmt); err != nil {
-				log.Printf("upload: send quota-limit email for %q: %v", in.Username, err)
-			}
-		case pct >= s.quotaWarnPct && prevPct < s.quotaWarnPct:
-			if err := s.email.SendQuotaWarning(ctx, user, pct, usedFmt, quotaFmt); err != nil {
-				log.Printf("upload: send quota-warning email for %q: %v", in.Username, err)
-			}
-		}
+	// 8c. Store the image metadata extracted in step 2c.
+	if err := s.storeMediaMetadata(ctx, file, in.Username, media); err != nil {
+		log.Printf("upload: %v", err)
 	}
 
-	// 10. Kick off background 480p transcoding for video files.
+	// 9. Tell the user's open tabs, and send a quota warning / limit email
+	// if the upload crossed a threshold. Failures are non-fatal and logged;
+	// they must not block the upload response.
+	s.publishEvent(ctx, file.UserID, models.EventFileUploaded, file)
+	s.warnQuota(ctx, file.UserID, user, added, "upload")
+
+	// 10. Queue 480p transcoding and HLS encoding for video files.
 	if strings.HasPrefix(mimeType, "video/") && s.transcode != nil && s.transcode.Available() {
-		go s.createVariant(file, in.Username)
+		s.enqueueJob(ctx, models.JobKindTranscode, file, in.Username)
+		s.enqueueJob(ctx, models.JobKindHLS, file, in.Username)
 	}
 
-	// 11. Probe video capture date in the background (images were done in step 2c).
+	// 11. Queue a video capture date probe (images were done in step 2c).
 	if strings.HasPrefix(mimeType, "video/") {
-		go s.extractTakenAtAsync(file, in.Username)
+		s.enqueueJob(ctx, models.JobKindTakenAt, file, in.Username)
+	}
+
+	// 12. Queue thumbnail rendering.
+	if s.thumbs != nil && s.thumbs.Supports(mimeType) {
+		s.enqueueJob(ctx, models.JobKindThumbnail, file, in.Username)
+	}
+
+	// 13. Queue text extraction for the content search index.
+	if s.text != nil && s.text.Supports(mimeType) {
+		s.enqueueJob(ctx, models.JobKindTextIndex, file, in.Username)
 	}
 
 	return file, nil
 }
 
+// saveUpload records a stored upload: a new files row for f, or, when
+// replace is set, f's blob as the new content of replace. The replaced file
+// keeps its ID, name, folder, favorites, tags, collections and shares, and
+// the change journal records a content change rather than a delete and a
+// create.
+func saveUpload(ctx context.Context, q *db.Queries, replace, f *models.File) (*models.File, error) {
+	if replace == nil {
+		return q.CreateFile(ctx, f)
+	}
+	f.ID = replace.ID
+	return q.ReplaceFileBlob(ctx, f)
+}
+
+// dropReplaced removes what belonged to the previous content of a file
+// replaced by an upload: its blob and replica, and its video variants and
+// thumbnails, which the jobs queued for the upload render afresh.
+func (s *FileService) dropReplaced(ctx context.Context, username string, old *models.File) {
+	s.removeReplacedBlob(ctx, username, old)
+	s.dropVariants(ctx, username, old.ID)
+}
+
+// dropVariants deletes every variant of a file whose content changed (480p
+// transcode, HLS renditions and thumbnails), rows and blobs alike, so the
+// caller can queue them again from the new content. Failures are logged.
+func (s *FileService) dropVariants(ctx context.Context, username string, fileID uuid.UUID) {
+	variants, err := s.queries.ListVideoVariants(ctx, fileID)
+	if err != nil {
+		log.Printf("replace %s: %v", fileID, err)
+		return
+	}
+	storage, _, err := s.storageFor(ctx, username)
+	if err != nil {
+		log.Printf("replace %s: %v", fileID, err)
+		return
+	}
+	replica, _, _ := s.replicaFor(ctx, username)
+	for _, v := range variants {
+		_ = storage.RemoveObject(ctx, v.MinIOObjectKey)
+		if replica != nil {
+			_ = replica.RemoveObject(ctx, v.MinIOObjectKey)
+		}
+		if err := s.queries.DeleteFileReplica(ctx, v.MinIOObjectKey); err != nil {
+			log.Printf("replace %s: %v", fileID, err)
+		}
+		if err := s.queries.DeleteVideoVariant(ctx, v.ID); err != nil {
+			log.Printf("replace %s: %v", fileID, err)
+		}
+	}
+}
+
+// removeReplacedBlob removes the blob old pointed at, and its replica, once
+// the row has been pointed at new content. Failures are logged; the
+// reconciler reports anything left behind as an orphan.
+func (s *FileService) removeReplacedBlob(ctx context.Context, username string, old *models.File) {
+	if storage, _, err := s.storageFor(ctx, username); err != nil {
+		log.Printf("replace blob: %v", err)
+	} else if err := storage.RemoveObject(ctx, old.MinIOObjectKey); err != nil {
+		log.Printf("replace blob: remove %s: %v", old.MinIOObjectKey, err)
+	}
+	if replica, _, err := s.replicaFor(ctx, username); err == nil && replica != nil {
+		_ = replica.RemoveObject(ctx, old.MinIOObjectKey)
+	}
+	if err := s.queries.DeleteFileReplica(ctx, old.MinIOObjectKey); err != nil {
+		log.Printf("replace blob: %v", err)
+	}
+}
+
 // resolveUploadFolder returns the destination folder for an upload. When the
 // user has configured a media auto-upload folder and the upload is an image or
 // video, every such upload is routed there — UNLESS the user is explicitly
@@ -354,54 +517,58 @@ func isMediaMime(mimeType string) bool {
 	return strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/")
 }
 
-// extractTakenAtAsync downloads a stored file, extracts its capture date
-// (EXIF for images, ffprobe for videos), and persists it. Best-effort: any
-// failure is logged and leaves taken_at null so listings fall back to upload date.
-func (s *FileService) extractTakenAtAsync(file *models.File, username string) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("metadata: recovered panic for %s: %v", file.ID, r)
-		}
-	}()
-	ctx := context.Background()
+// runTakenAtJob downloads a stored file, extracts its capture date and media
+// metadata (EXIF for images, ffprobe for videos), and persists them. A file
+// without a date is not an error: taken_at stays null so listings fall back
+// to upload date.
+func (s *FileService) runTakenAtJob(ctx context.Context, job *models.Job) error {
+	file, err := s.GetMetadata(ctx, job.FileID, job.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil // deleted since the job was queued
+	}
+	if err != nil {
+		return err
+	}
 
-	var (
-		plaintext []byte
-		err       error
-	)
+	var plaintext []byte
 	if IsChunked(file) {
-		plaintext, err = s.DownloadChunked(ctx, file, username)
+		plaintext, err = s.DownloadChunked(ctx, file, job.Username)
 	} else {
-		_, plaintext, err = s.Download(ctx, file.ID, file.UserID, username)
+		plaintext, err = s.decryptBlob(ctx, job.Username, file)
 	}
 	if err != nil {
-		log.Printf("metadata: download %s: %v", file.ID, err)
-		return
+		return fmt.Errorf("download: %w", err)
 	}
 
 	var takenAt *time.Time
+	var media *models.MediaMetadata
 	switch {
 	case strings.HasPrefix(file.MimeType, "image/"):
 		takenAt = ExtractImageTakenAt(plaintext)
+		media = ExtractImageMetadata(plaintext)
 	case strings.HasPrefix(file.MimeType, "video/"):
 		if s.meta == nil {
-			return
+			return nil
 		}
-		path, cleanup, terr := extractToTempFile(plaintext, mimeToExt(file.MimeType))
-		if terr != nil {
-			log.Printf("metadata: temp file %s: %v", file.ID, terr)
-			return
+		path, cleanup, err := extractToTempFile(plaintext, mimeToExt(file.MimeType))
+		if err != nil {
+			return fmt.Errorf("temp file: %w", err)
 		}
 		defer cleanup()
 		takenAt = s.meta.ExtractVideoTakenAt(ctx, path)
+		media = s.meta.ExtractVideoMetadata(ctx, path)
 	}
 
+	if err := s.storeMediaMetadata(ctx, file, job.Username, media); err != nil {
+		return err
+	}
 	if takenAt == nil {
-		return
+		return nil
 	}
 	if err := s.queries.SetFileTakenAt(ctx, file.ID, *takenAt); err != nil {
-		log.Printf("metadata: persist taken_at %s: %v", file.ID, err)
+		return fmt.Errorf("persist taken_at: %w", err)
 	}
+	return nil
 }
 
 // SetHidden toggles a file's hidden flag. Returns ErrNotFound if the file does
@@ -548,13 +715,25 @@ func (s *FileService) Delete(ctx context.Context, fileID, userID uuid.UUID, user
 	if err != nil {
 		return fmt.Errorf("delete: %w", err)
 	}
+	// Replica blobs are removed best-effort; file_replicas rows cascade with
+	// the files row and the reconciler sweeps anything left behind.
+	replica, _, err := s.replicaFor(ctx, username)
+	if err != nil {
+		log.Printf("delete: %v", err)
+	}
 
 	// Best-effort: remove any transcoded variant blobs before the parent row is deleted.
 	if variants, err := q.ListVideoVariants(ctx, fileID); err == nil {
 		for _, v := range variants {
 			_ = storage.RemoveObject(ctx, v.MinIOObjectKey)
+			if replica != nil {
+				_ = replica.RemoveObject(ctx, v.MinIOObjectKey)
+			}
 		}
 	}
+	if replica != nil {
+		_ = replica.RemoveObject(ctx, file.MinIOObjectKey)
+	}
 
 	if err := storage.RemoveObject(ctx, file.MinIOObjectKey); err != nil {
 		return fmt.Errorf("delete: remove blob: %w", err)
@@ -580,6 +759,10 @@ func (s *FileService) AdminDeleteAllFiles(ctx context.Context, username string)
 	if err != nil {
 		return fmt.Errorf("AdminDeleteAllFiles: %w", err)
 	}
+	replica, _, err := s.replicaFor(ctx, username)
+	if err != nil {
+		log.Printf("AdminDeleteAllFiles: %v", err)
+	}
 
 	files, err := s.queries.GetAllUserFiles(ctx, username)
 	if err != nil {
@@ -591,9 +774,15 @@ func (s *FileService) AdminDeleteAllFiles(ctx context.Context, username string)
 		if variants, err := s.queries.ListVideoVariants(ctx, f.ID); err == nil {
 			for _, v := range variants {
 				_ = storage.RemoveObject(ctx, v.MinIOObjectKey)
+				if replica != nil {
+					_ = replica.RemoveObject(ctx, v.MinIOObjectKey)
+				}
 			}
 		}
 		_ = storage.RemoveObject(ctx, f.MinIOObjectKey)
+		if replica != nil {
+			_ = replica.RemoveObject(ctx, f.MinIOObjectKey)
+		}
 	}
 
 	if err := s.queries.DeleteAllUserFileRows(ctx, username); err != nil {
@@ -627,65 +816,54 @@ func (s *FileService) HasReadyVariant(ctx context.Context, fileID uuid.UUID) boo
 	return err == nil && v.Status == models.VideoVariantStatusReady
 }
 
-// createVariant decrypts the source video, transcodes it to 480p with FFmpeg,
-// re-encrypts the result, and stores it in MinIO. Runs as a background goroutine
-// after a successful video upload. Panics are recovered and logged.
-func (s *FileService) createVariant(file *models.File, username string) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("transcode: recovered panic for %s: %v", file.ID, r)
-			_ = s.queries.MarkVideoVariantFailed(context.Background(), file.ID, LowQualityLabel)
-		}
-	}()
-
-	ctx := context.Background()
-	variantKey := objectKeyFor(file.UserID, uuid.New())
-
-	storage, _, storErr := s.storageFor(ctx, username)
-	if storErr != nil {
-		log.Printf("transcode: storage lookup for %s: %v", file.ID, storErr)
-		return
+// runTranscodeJob decrypts the source video, transcodes it to 480p with
+// FFmpeg, re-encrypts the result, and stores it as the file's low-quality
+// variant. The variant row stays pending across retries; abandonVariants
+// marks it failed once the job gives up.
+func (s *FileService) runTranscodeJob(ctx context.Context, job *models.Job) error {
+	file, err := s.GetMetadata(ctx, job.FileID, job.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil // deleted since the job was queued
 	}
-
-	if _, err := s.queries.CreateVideoVariant(ctx, file.ID, LowQualityLabel, variantKey); err != nil {
-		log.Printf("transcode: create record for %s: %v", file.ID, err)
-		return
+	if err != nil {
+		return err
+	}
+	if s.transcode == nil || !s.transcode.Available() {
+		return permanentJobError(errors.New("ffmpeg not available"))
 	}
 
-	markFailed := func() { _ = s.queries.MarkVideoVariantFailed(ctx, file.ID, LowQualityLabel) }
+	storage, _, err := s.storageFor(ctx, job.Username)
+	if err != nil {
+		return fmt.Errorf("storage lookup: %w", err)
+	}
+	variant, err := s.queries.CreateVideoVariant(ctx, file.ID, LowQualityLabel, "video/mp4", objectKeyFor(file.UserID, uuid.New()))
+	if err != nil {
+		return fmt.Errorf("create record: %w", err)
+	}
+	variantKey := variant.MinIOObjectKey
 
-	log.Printf("transcode: start %s (%.1f MB)", file.ID, float64(file.SizeBytes)/(1024*1024))
+	log.Printf("transcode: start %s (%.1f MB, attempt %d)", file.ID, float64(file.SizeBytes)/(1024*1024), job.Attempts)
 
 	// Decrypt source.
-	var (
-		plaintext []byte
-		err       error
-	)
+	var plaintext []byte
 	if IsChunked(file) {
-		plaintext, err = s.DownloadChunked(ctx, file, username)
+		plaintext, err = s.DownloadChunked(ctx, file, job.Username)
 	} else {
-		_, plaintext, err = s.Download(ctx, file.ID, file.UserID, username)
+		plaintext, err = s.decryptBlob(ctx, job.Username, file)
 	}
 	if err != nil {
-		log.Printf("transcode: download source for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("download source: %w", err)
 	}
 
 	// Write plaintext to a temp input file so FFmpeg can seek in it.
-	ext := mimeToExt(file.MimeType)
-	inFile, err := os.CreateTemp("", "transcode-in-*."+ext)
+	inFile, err := os.CreateTemp("", "transcode-in-*."+mimeToExt(file.MimeType))
 	if err != nil {
-		log.Printf("transcode: create temp input for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("create temp input: %w", err)
 	}
 	defer os.Remove(inFile.Name())
 	if _, err := inFile.Write(plaintext); err != nil {
 		inFile.Close()
-		log.Printf("transcode: write temp input for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("write temp input: %w", err)
 	}
 	inFile.Close()
 	plaintext = nil // allow GC before allocating output
@@ -693,56 +871,219 @@ func (s *FileService) createVariant(file *models.File, username string) {
 	// Prepare output temp file.
 	outFile, err := os.CreateTemp("", "transcode-out-*.mp4")
 	if err != nil {
-		log.Printf("transcode: create temp output for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("create temp output: %w", err)
 	}
 	outPath := outFile.Name()
 	outFile.Close()
 	defer os.Remove(outPath)
 
 	if err := s.transcode.TranscodeTo480p(ctx, inFile.Name(), outPath); err != nil {
-		log.Printf("transcode: ffmpeg for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("ffmpeg: %w", err)
 	}
 
 	transcoded, err := os.ReadFile(outPath)
 	if err != nil {
-		log.Printf("transcode: read output for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("read output: %w", err)
 	}
 	variantPlaintextSize := int64(len(transcoded))
 
-	userKey, err := s.userKey(ctx, username)
+	userKey, err := s.userKey(ctx, job.Username)
 	if err != nil {
-		log.Printf("transcode: get user key for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("get user key: %w", err)
 	}
 	defer zeroBytes(userKey)
 
 	ciphertext, err := s.enc.EncryptChunked(userKey, transcoded)
 	transcoded = nil
 	if err != nil {
-		log.Printf("transcode: encrypt variant for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("encrypt variant: %w", err)
 	}
 
 	if err := storage.PutObject(ctx, variantKey, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream"); err != nil {
-		log.Printf("transcode: upload variant for %s: %v", file.ID, err)
-		markFailed()
-		return
+		return fmt.Errorf("upload variant: %w", err)
 	}
 
 	if err := s.queries.MarkVideoVariantReady(ctx, file.ID, LowQualityLabel, variantPlaintextSize); err != nil {
-		log.Printf("transcode: mark ready for %s: %v", file.ID, err)
 		_ = storage.RemoveObject(ctx, variantKey)
-		return
+		return fmt.Errorf("mark ready: %w", err)
 	}
+	s.replicate(ctx, job.Username, file.ID, variantKey, func(dst BlobStore) error {
+		return dst.PutObject(ctx, variantKey, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream")
+	})
 	log.Printf("transcode: done %s → 480p (%.1f MB)", file.ID, float64(variantPlaintextSize)/(1024*1024))
+	s.publishEvent(ctx, file.UserID, models.EventVariantReady, models.VariantReadyEvent{FileID: file.ID, Quality: LowQualityLabel})
+	return nil
+}
+
+// Thumbnail returns the decrypted JPEG thumbnail of file at size.
+// Returns ErrThumbnailPending while it is being rendered, and starts rendering
+// for files uploaded before thumbnails existed. Returns ErrNotFound when the
+// file type has no thumbnailer or rendering failed.
+func (s *FileService) Thumbnail(ctx context.Context, file *models.File, username, size string) ([]byte, error) {
+	v, err := s.queries.GetVideoVariant(ctx, file.ID, ThumbnailQuality(size))
+	if errors.Is(err, sql.ErrNoRows) {
+		if s.thumbs == nil || !s.thumbs.Supports(file.MimeType) {
+			return nil, ErrNotFound
+		}
+		if s.jobs == nil {
+			return nil, ErrNotFound
+		}
+		if err := s.jobs.Enqueue(ctx, models.JobKindThumbnail, file.ID, file.UserID, username); err != nil {
+			return nil, fmt.Errorf("thumbnail: %w", err)
+		}
+		return nil, ErrThumbnailPending
+	}
+	if err != nil {
+		return nil, fmt.Errorf("thumbnail: %w", err)
+	}
+	switch v.Status {
+	case models.VideoVariantStatusPending:
+		return nil, ErrThumbnailPending
+	case models.VideoVariantStatusFailed:
+		return nil, ErrNotFound
+	}
+	return s.DownloadChunked(ctx, &models.File{
+		ID:             file.ID,
+		UserID:         file.UserID,
+		MimeType:       v.MimeType,
+		SizeBytes:      v.SizeBytes,
+		MinIOObjectKey: v.MinIOObjectKey,
+		Nonce:          []byte{}, // always chunked
+	}, username)
+}
+
+// HasThumbnail reports whether a ready small thumbnail exists for fileID.
+func (s *FileService) HasThumbnail(ctx context.Context, fileID uuid.UUID) bool {
+	v, err := s.queries.GetVideoVariant(ctx, fileID, ThumbnailQuality(ThumbnailSmall))
+	return err == nil && v.Status == models.VideoVariantStatusReady
+}
+
+// runThumbnailJob renders every thumbnail size for the job's file, encrypts
+// each with the owner's key and stores it as a variant; for images it also
+// records the perceptual hash. The variant rows stay pending across retries;
+// abandonVariants marks them failed once the job gives up.
+func (s *FileService) runThumbnailJob(ctx context.Context, job *models.Job) error {
+	file, err := s.GetMetadata(ctx, job.FileID, job.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil // deleted since the job was queued
+	}
+	if err != nil {
+		return err
+	}
+	if s.thumbs == nil || !s.thumbs.Supports(file.MimeType) {
+		return permanentJobError(fmt.Errorf("no thumbnailer for %s", file.MimeType))
+	}
+
+	storage, _, err := s.storageFor(ctx, job.Username)
+	if err != nil {
+		return fmt.Errorf("storage lookup: %w", err)
+	}
+
+	keys := make(map[string]string, len(thumbnailSizes))
+	for _, size := range thumbnailSizes {
+		v, err := s.queries.CreateVideoVariant(ctx, file.ID, ThumbnailQuality(size), ThumbnailMimeType, objectKeyFor(file.UserID, uuid.New()))
+		if err != nil {
+			return fmt.Errorf("create record: %w", err)
+		}
+		keys[size] = v.MinIOObjectKey
+	}
+
+	var plaintext []byte
+	if IsChunked(file) {
+		plaintext, err = s.DownloadChunked(ctx, file, job.Username)
+	} else {
+		plaintext, err = s.decryptBlob(ctx, job.Username, file)
+	}
+	if err != nil {
+		return fmt.Errorf("download source: %w", err)
+	}
+
+	thumbs, err := s.thumbs.Render(ctx, file.MimeType, plaintext)
+	plaintext = nil
+	if err != nil {
+		// Rendering is deterministic: the same source fails the same way.
+		return permanentJobError(fmt.Errorf("render (%s): %w", file.MimeType, err))
+	}
+
+	// The duplicate finder hashes the small thumbnail: already decoded,
+	// upright and cheap to read back.
+	if strings.HasPrefix(file.MimeType, "image/") {
+		hash, err := PerceptualHash(thumbs[ThumbnailSmall])
+		if err != nil {
+			return permanentJobError(fmt.Errorf("perceptual hash: %w", err))
+		}
+		if err := s.queries.SetFilePerceptualHash(ctx, file.ID, hash); err != nil {
+			return fmt.Errorf("persist perceptual hash: %w", err)
+		}
+	}
+
+	userKey, err := s.userKey(ctx, job.Username)
+	if err != nil {
+		return fmt.Errorf("get user key: %w", err)
+	}
+	defer zeroBytes(userKey)
+
+	for _, size := range thumbnailSizes {
+		quality, key := ThumbnailQuality(size), keys[size]
+		ciphertext, err := s.enc.EncryptChunked(userKey, thumbs[size])
+		if err != nil {
+			return fmt.Errorf("encrypt %s: %w", size, err)
+		}
+		if err := storage.PutObject(ctx, key, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream"); err != nil {
+			return fmt.Errorf("upload %s: %w", size, err)
+		}
+		if err := s.queries.MarkVideoVariantReady(ctx, file.ID, quality, int64(len(thumbs[size]))); err != nil {
+			_ = storage.RemoveObject(ctx, key)
+			return fmt.Errorf("mark ready %s: %w", size, err)
+		}
+		s.replicate(ctx, job.Username, file.ID, key, func(dst BlobStore) error {
+			return dst.PutObject(ctx, key, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream")
+		})
+		s.publishEvent(ctx, file.UserID, models.EventVariantReady, models.VariantReadyEvent{FileID: file.ID, Quality: quality})
+	}
+	return nil
+}
+
+// abandonVariants marks the pending variants a transcode, thumbnail or HLS
+// job would have completed as failed. Ready variants are left alone.
+func (s *FileService) abandonVariants(ctx context.Context, job *models.Job) {
+	variants, err := s.queries.ListVideoVariants(ctx, job.FileID)
+	if err != nil {
+		log.Printf("%s: list variants for %s: %v", job.Kind, job.FileID, err)
+		return
+	}
+	for _, v := range variants {
+		if v.Status != models.VideoVariantStatusPending || variantJobKind(v.Quality) != job.Kind {
+			continue
+		}
+		if err := s.queries.MarkVideoVariantFailed(ctx, job.FileID, v.Quality); err != nil {
+			log.Printf("%s: mark %s failed for %s: %v", job.Kind, v.Quality, job.FileID, err)
+		}
+	}
+}
+
+// RegisterJobs attaches the job queue and registers the handlers for the
+// transcode, HLS, taken_at, thumbnail and text_index jobs queued after uploads,
+// and for the perceptual_hash jobs queued by a backfill.
+func (s *FileService) RegisterJobs(jobs *JobService) {
+	s.jobs = jobs
+	jobs.Register(models.JobKindTranscode, JobHandler{Run: s.runTranscodeJob, Abandon: s.abandonVariants})
+	jobs.Register(models.JobKindHLS, JobHandler{Run: s.runHLSJob, Abandon: s.abandonVariants})
+	jobs.Register(models.JobKindTakenAt, JobHandler{Run: s.runTakenAtJob})
+	jobs.Register(models.JobKindThumbnail, JobHandler{Run: s.runThumbnailJob, Abandon: s.abandonVariants})
+	jobs.Register(models.JobKindTextIndex, JobHandler{Run: s.runTextIndexJob, Backfill: s.unindexedFiles})
+	jobs.Register(models.JobKindPerceptualHash, JobHandler{Run: s.runPerceptualHashJob, Backfill: s.unhashedImages})
+}
+
+// enqueueJob queues background work on file. A failure is only logged: the
+// upload itself has already succeeded.
+func (s *FileService) enqueueJob(ctx context.Context, kind string, file *models.File, username string) {
+	if s.jobs == nil {
+		return
+	}
+	if err := s.jobs.Enqueue(ctx, kind, file.ID, file.UserID, username); err != nil {
+		log.Printf("%s: enqueue for %s: %v", kind, file.ID, err)
+	}
 }
 
 // mimeToExt returns a file extension for a video MIME type so FFmpeg can
@@ -781,28 +1122,17 @@ func (s *FileService) DownloadChunked(ctx context.Context, file *models.File, us
 	}
 	defer zeroBytes(userKey)
 
-	storage, _, err := s.storageFor(ctx, username)
-	if err != nil {
-		return nil, fmt.Errorf("download chunked: %w", err)
-	}
-
-	rc, err := storage.GetObject(ctx, file.MinIOObjectKey)
+	blob, err := s.readObject(ctx, username, file.MinIOObjectKey)
 	if err != nil {
 		return nil, fmt.Errorf("download chunked: fetch blob: %w", err)
 	}
-	defer rc.Close()
-
-	blob, err := io.ReadAll(rc)
-	if err != nil {
-		return nil, fmt.Errorf("download chunked: read blob: %w", err)
-	}
 	return s.enc.DecryptChunked(userKey, blob)
 }
 
 // fetchRange fetches and decrypts plaintext bytes [rangeStart, rangeEnd] for a
 // chunked-encrypted file, bypassing the read-ahead cache. It is the inner
 // implementation shared by DownloadRange and the prefetch goroutine.
-func (s *FileService) fetchRange(ctx context.Context, storage *MinIOService, file *models.File, username string, rangeStart, rangeEnd int64) ([]byte, error) {
+func (s *FileService) fetchRange(ctx context.Context, file *models.File, username string, rangeStart, rangeEnd int64) ([]byte, error) {
 	userKey, err := s.userKey(ctx, username)
 	if err != nil {
 		return nil, fmt.Errorf("fetch range: %w", err)
@@ -826,16 +1156,10 @@ func (s *FileService) fetchRange(ctx context.Context, storage *MinIOService, fil
 	}
 	blobEnd := blobStart + (lastChunkIdx-firstChunkIdx)*int64(StoredChunkSize) + lastStoredSize - 1
 
-	rc, err := storage.GetObjectRange(ctx, file.MinIOObjectKey, blobStart, blobEnd)
+	blobSlice, err := s.readObjectRange(ctx, username, file.MinIOObjectKey, blobStart, blobEnd)
 	if err != nil {
 		return nil, fmt.Errorf("fetch range: get object: %w", err)
 	}
-	defer rc.Close()
-
-	blobSlice, err := io.ReadAll(rc)
-	if err != nil {
-		return nil, fmt.Errorf("fetch range: read: %w", err)
-	}
 
 	return s.enc.DecryptChunkedRange(userKey, blobSlice, firstChunkIdx, numChunks, totalSize, rangeStart, rangeEnd)
 }
@@ -846,28 +1170,23 @@ func (s *FileService) fetchRange(ctx context.Context, storage *MinIOService, fil
 // response from RAM; on a miss, fetchRange is called and a prefetch goroutine
 // is scheduled for the next segment to hide the latency of the following request.
 func (s *FileService) DownloadRange(ctx context.Context, file *models.File, username string, rangeStart, rangeEnd int64) ([]byte, error) {
-	storage, _, err := s.storageFor(ctx, username)
-	if err != nil {
-		return nil, fmt.Errorf("download range: %w", err)
-	}
-
 	key := raKey{objectKey: file.MinIOObjectKey, offset: rangeStart}
 
 	if cached, ok := s.raCacheGet(key); ok {
 		need := rangeEnd - rangeStart + 1
 		if int64(len(cached)) >= need {
 			// Prefetch the segment that follows the full cached window, not just rangeEnd.
-			s.schedulePrefetch(storage, file, username, rangeStart+int64(len(cached)))
+			s.schedulePrefetch(file, username, rangeStart+int64(len(cached)))
 			return cached[:need], nil
 		}
 		// Cache holds fewer bytes than needed (e.g. near EOF) — fall through.
 	}
 
-	data, err := s.fetchRange(ctx, storage, file, username, rangeStart, rangeEnd)
+	data, err := s.fetchRange(ctx, file, username, rangeStart, rangeEnd)
 	if err != nil {
 		return nil, err
 	}
-	s.schedulePrefetch(storage, file, username, rangeEnd+1)
+	s.schedulePrefetch(file, username, rangeEnd+1)
 	return data, nil
 }
 
@@ -918,7 +1237,7 @@ func (s *FileService) raCachePut(key raKey, data []byte) {
 
 // schedulePrefetch launches a background goroutine to fetch and cache the
 // segment starting at offset, unless one is already in-flight or cached.
-func (s *FileService) schedulePrefetch(storage *MinIOService, file *models.File, username string, offset int64) {
+func (s *FileService) schedulePrefetch(file *models.File, username string, offset int64) {
 	if offset >= file.SizeBytes {
 		return
 	}
@@ -946,7 +1265,7 @@ func (s *FileService) schedulePrefetch(storage *MinIOService, file *models.File,
 		if end >= fileCopy.SizeBytes {
 			end = fileCopy.SizeBytes - 1
 		}
-		data, err := s.fetchRange(context.Background(), storage, &fileCopy, username, offset, end)
+		data, err := s.fetchRange(context.Background(), &fileCopy, username, offset, end)
 		if err != nil {
 			log.Printf("read-ahead: prefetch %s@%d: %v", fileCopy.MinIOObjectKey, offset, err)
 			return
@@ -965,24 +1284,11 @@ func (s *FileService) decryptBlob(ctx context.Context, username string, file *mo
 	}
 	defer zeroBytes(userKey)
 
-	storage, _, err := s.storageFor(ctx, username)
-	if err != nil {
-		log.Printf("decryptBlob: storageFor(%s) file=%s: %v", username, file.ID, err)
-		return nil, fmt.Errorf("decrypt blob: %w", err)
-	}
-
-	rc, err := storage.GetObject(ctx, file.MinIOObjectKey)
+	data, err := s.readObject(ctx, username, file.MinIOObjectKey)
 	if err != nil {
-		log.Printf("decryptBlob: GetObject(%s) file=%s: %v", file.MinIOObjectKey, file.ID, err)
+		log.Printf("decryptBlob: readObject(%s) file=%s: %v", file.MinIOObjectKey, file.ID, err)
 		return nil, fmt.Errorf("fetch blob: %w", err)
 	}
-	defer rc.Close()
-
-	data, err := io.ReadAll(rc)
-	if err != nil {
-		log.Printf("decryptBlob: ReadAll(%s) file=%s: %v", file.MinIOObjectKey, file.ID, err)
-		return nil, fmt.Errorf("read blob: %w", err)
-	}
 
 	chunked := IsChunked(file)
 	var plaintext []byte
@@ -1029,11 +1335,73 @@ func (s *FileService) userKey(ctx context.Context, username string) ([]byte, err
 	return key, nil
 }
 
+// listAllUserFiles returns every file row owned by userID. Pages are read in
+// short ForUser transactions so background jobs that walk a user's files do
+// not hold a transaction open while they talk to MinIO.
+func listAllUserFiles(ctx context.Context, q *db.Queries, userID uuid.UUID) ([]models.File, error) {
+	var (
+		out    []models.File
+		cursor string
+	)
+	for {
+		uq, tx, err := q.ForUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		page, err := uq.ListFilesByUser(ctx, userID, db.PageInput{Cursor: cursor, Limit: db.MaxPageLimit})
+		_ = tx.Rollback()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page.Items...)
+		if page.NextToken == "" {
+			return out, nil
+		}
+		cursor = page.NextToken
+	}
+}
+
 // objectKeyFor builds the MinIO object key: {userID}/{fileID}.
 func objectKeyFor(userID, fileID uuid.UUID) string {
 	return userID.String() + "/" + fileID.String()
 }
 
+// warnQuota sends the quota warning or limit email, and a quota.warning event
+// to userID, when adding added bytes took user past the warning threshold or
+// the full quota. op prefixes the log lines of failures, which are non-fatal.
+func (s *FileService) warnQuota(ctx context.Context, userID uuid.UUID, user *models.User, added int64, op string) {
+	if s.quotaWarnPct <= 0 {
+		return
+	}
+	newUsed := user.StorageUsedBytes + added
+	pct := int(newUsed * 100 / user.StorageQuotaBytes)
+	prevPct := int(user.StorageUsedBytes * 100 / user.StorageQuotaBytes)
+	crossedLimit := pct >= 100 && prevPct < 100
+	if !crossedLimit && (pct < s.quotaWarnPct || prevPct >= s.quotaWarnPct) {
+		return
+	}
+
+	s.publishEvent(ctx, userID, models.EventQuotaWarning, models.QuotaWarningEvent{
+		UsedBytes:  newUsed,
+		QuotaBytes: user.StorageQuotaBytes,
+		Percent:    pct,
+	})
+	if s.email == nil {
+		return
+	}
+	usedFmt := fmtBytes(newUsed)
+	quotaFmt := fmtBytes(user.StorageQuotaBytes)
+	if crossedLimit {
+		if err := s.email.SendQuotaLimit(ctx, user, usedFmt, quotaFmt); err != nil {
+			log.Printf("%s: send quota-limit email for %q: %v", op, user.Username, err)
+		}
+		return
+	}
+	if err := s.email.SendQuotaWarning(ctx, user, pct, usedFmt, quotaFmt); err != nil {
+		log.Printf("%s: send quota-warning email for %q: %v", op, user.Username, err)
+	}
+}
+
 // fmtBytes formats a byte count as a human-readable string (e.g. "1.2 GB").
 func fmtBytes(n int64) string {
 	const (
@@ -1085,7 +1453,7 @@ func (s *FileService) BeginChunkedUpload(ctx context.Context, sess *UploadSessio
 	sess.MinioUploadID = uploadID
 	sess.UserKey = userKey
 	sess.DriveID = driveID
-	sess.MinIOStorage = storage
+	sess.Storage = storage
 	return nil
 }
 
@@ -1110,13 +1478,13 @@ func (s *FileService) EncryptAndUploadPart(ctx context.Context, sess *UploadSess
 	// EncryptChunked call, so the existing Download/Stream paths work unchanged.
 	ciphertext, err := s.enc.EncryptChunked(sess.UserKey, data)
 	if err != nil {
-		sess.RecordPart(index, minio.CompletePart{}, fmt.Errorf("encrypt part %d: %w", index, err))
+		sess.RecordPart(index, BlobPart{}, fmt.Errorf("encrypt part %d: %w", index, err))
 		return
 	}
 
-	part, err := sess.MinIOStorage.UploadPart(ctx, sess.ObjectKey, sess.MinioUploadID, index+1, ciphertext)
+	part, err := sess.Storage.UploadPart(ctx, sess.ObjectKey, sess.MinioUploadID, index+1, ciphertext)
 	if err != nil {
-		sess.RecordPart(index, minio.CompletePart{}, fmt.Errorf("upload part %d: %w", index, err))
+		sess.RecordPart(index, BlobPart{}, fmt.Errorf("upload part %d: %w", index, err))
 		return
 	}
 	sess.RecordPart(index, part, nil)
@@ -1130,12 +1498,12 @@ func (s *FileService) FinalizeChunkedUpload(ctx context.Context, sess *UploadSes
 
 	parts, err := sess.Wait()
 	if err != nil {
-		_ = sess.MinIOStorage.AbortMultipartUpload(ctx, sess.ObjectKey, sess.MinioUploadID)
+		_ = sess.Storage.AbortMultipartUpload(ctx, sess.ObjectKey, sess.MinioUploadID)
 		return nil, fmt.Errorf("finalize: part upload failed: %w", err)
 	}
 
-	if err := sess.MinIOStorage.CompleteMultipartUpload(ctx, sess.ObjectKey, sess.MinioUploadID, parts); err != nil {
-		_ = sess.MinIOStorage.AbortMultipartUpload(ctx, sess.ObjectKey, sess.MinioUploadID)
+	if err := sess.Storage.CompleteMultipartUpload(ctx, sess.ObjectKey, sess.MinioUploadID, parts); err != nil {
+		_ = sess.Storage.AbortMultipartUpload(ctx, sess.ObjectKey, sess.MinioUploadID)
 		return nil, fmt.Errorf("finalize: complete multipart: %w", err)
 	}
 
@@ -1145,18 +1513,24 @@ func (s *FileService) FinalizeChunkedUpload(ctx context.Context, sess *UploadSes
 	}
 
 	// Auto-route image/video uploads to the user's media folder if configured.
-	sess.FolderID = s.resolveUploadFolder(ctx, sess.Username, sess.FolderID, mimeType)
+	if !sess.ExactFolder && sess.Replace == nil {
+		sess.FolderID = s.resolveUploadFolder(ctx, sess.Username, sess.FolderID, mimeType)
+	}
 
 	// Read current usage before updating so we can compute threshold crossings below.
 	user, userErr := s.queries.GetUserByUsername(ctx, sess.Username)
 
 	uq, utx, err := s.queries.ForUser(ctx, sess.UserID)
 	if err != nil {
-		_ = sess.MinIOStorage.RemoveObject(ctx, sess.ObjectKey)
+		_ = sess.Storage.RemoveObject(ctx, sess.ObjectKey)
 		return nil, fmt.Errorf("finalize: begin tx: %w", err)
 	}
 	defer func() { _ = utx.Rollback() }()
-	file, err := uq.CreateFile(ctx, &models.File{
+	if err := s.checkDrive(ctx, uq, sess.Username, sess.DriveID); err != nil {
+		_ = sess.Storage.RemoveObject(ctx, sess.ObjectKey)
+		return nil, fmt.Errorf("finalize: %w", err)
+	}
+	file, err := saveUpload(ctx, uq, sess.Replace, &models.File{
 		ID:             sess.FileID,
 		UserID:         sess.UserID,
 		FolderID:       sess.FolderID,
@@ -1168,7 +1542,7 @@ func (s *FileService) FinalizeChunkedUpload(ctx context.Context, sess *UploadSes
 		Nonce:          []byte{}, // empty nonce signals chunked encryption mode
 	})
 	if err != nil {
-		_ = sess.MinIOStorage.RemoveObject(ctx, sess.ObjectKey)
+		_ = sess.Storage.RemoveObject(ctx, sess.ObjectKey)
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return nil, ErrDuplicateName
@@ -1176,40 +1550,47 @@ func (s *FileService) FinalizeChunkedUpload(ctx context.Context, sess *UploadSes
 		return nil, fmt.Errorf("finalize: save metadata: %w", err)
 	}
 	if err := utx.Commit(); err != nil {
-		_ = sess.MinIOStorage.RemoveObject(ctx, sess.ObjectKey)
+		_ = sess.Storage.RemoveObject(ctx, sess.ObjectKey)
 		return nil, fmt.Errorf("finalize: commit: %w", err)
 	}
 
-	if err := s.queries.AddStorageUsed(ctx, sess.Username, sess.TotalSize); err != nil {
+	// The ciphertext was streamed part by part, so the replica is copied from
+	// the primary in the background (the session key is zeroed on return).
+	go s.replicateStored(sess.Username, file.ID, sess.ObjectKey, nil)
+
+	added := sess.TotalSize
+	if sess.Replace != nil {
+		added -= sess.Replace.SizeBytes
+		s.dropReplaced(ctx, sess.Username, sess.Replace)
+	}
+	if err := s.queries.AddStorageUsed(ctx, sess.Username, added); err != nil {
 		return nil, fmt.Errorf("finalize: update storage: %w", err)
 	}
 
-	if userErr == nil && s.email != nil && s.quotaWarnPct > 0 {
-		newUsed := user.StorageUsedBytes + sess.TotalSize
-		pct := int(newUsed * 100 / user.StorageQuotaBytes)
-		prevPct := int(user.StorageUsedBytes * 100 / user.StorageQuotaBytes)
-		usedFmt := fmtBytes(newUsed)
-		quotaFmt := fmtBytes(user.StorageQuotaBytes)
-		switch {
-		case pct >= 100 && prevPct < 100:
-			if err := s.email.SendQuotaLimit(ctx, user, usedFmt, quotaFmt); err != nil {
-				log.Printf("finalize upload: send quota-limit email for %q: %v", sess.Username, err)
-			}
-		case pct >= s.quotaWarnPct && prevPct < s.quotaWarnPct:
-			if err := s.email.SendQuotaWarning(ctx, user, pct, usedFmt, quotaFmt); err != nil {
-				log.Printf("finalize upload: send quota-warning email for %q: %v", sess.Username, err)
-			}
-		}
+	s.publishEvent(ctx, file.UserID, models.EventFileUploaded, file)
+	if userErr == nil {
+		s.warnQuota(ctx, file.UserID, user, added, "finalize upload")
 	}
 
-	// Kick off background 480p transcoding for video files.
+	// Queue 480p transcoding and HLS encoding for video files.
 	if strings.HasPrefix(mimeType, "video/") && s.transcode != nil && s.transcode.Available() {
-		go s.createVariant(file, sess.Username)
+		s.enqueueJob(ctx, models.JobKindTranscode, file, sess.Username)
+		s.enqueueJob(ctx, models.JobKindHLS, file, sess.Username)
 	}
 
-	// Probe capture date in the background for media files.
+	// Queue a capture date probe for media files.
 	if isMediaMime(mimeType) {
-		go s.extractTakenAtAsync(file, sess.Username)
+		s.enqueueJob(ctx, models.JobKindTakenAt, file, sess.Username)
+	}
+
+	// Queue thumbnail rendering.
+	if s.thumbs != nil && s.thumbs.Supports(mimeType) {
+		s.enqueueJob(ctx, models.JobKindThumbnail, file, sess.Username)
+	}
+
+	// Queue text extraction for the content search index.
+	if s.text != nil && s.text.Supports(mimeType) {
+		s.enqueueJob(ctx, models.JobKindTextIndex, file, sess.Username)
 	}
 
 	return file, nil
@@ -1220,3 +1601,8 @@ func (s *FileService) FinalizeChunkedUpload(ctx context.Context, sess *UploadSes
 var ErrQuotaExceeded = errors.New("storage quota exceeded")
 var ErrNotFound = errors.New("file not found")
 var ErrDuplicateName = errors.New("a file with that name already exists in this folder")
+
+// ErrDriveMoved is returned when the user's files were migrated to another
+// drive while an upload was being stored; the upload has to be repeated.
+var ErrDriveMoved = errors.New("your files were moved to another drive during the upload; please try again")
+var ErrThumbnailPending = errors.New("thumbnail is being generated")
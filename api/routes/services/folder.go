@@ -143,6 +143,50 @@ func (s *FolderService) GetContents(
 	}, nil
 }
 
+// Search returns the folders and files of userID whose names contain term
+// and that match filter, across the whole tree. Folder is always nil. A
+// filter on a file-only criterion (see db.SearchFilter.FilesOnly) yields no
+// folders. Skipped pages are returned empty without hitting the database.
+func (s *FolderService) Search(
+	ctx context.Context,
+	userID uuid.UUID,
+	term string,
+	filter db.SearchFilter,
+	folderPage, filePage db.PageInput,
+) (*FolderContents, error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("search: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var subfolders *db.PageResult[models.Folder]
+	if folderPage.Skip || filter.FilesOnly() {
+		subfolders = emptyFolders()
+	} else {
+		subfolders, err = q.SearchFoldersByUser(ctx, userID, term, filter, folderPage)
+		if err != nil {
+			return nil, fmt.Errorf("search folders: %w", err)
+		}
+	}
+
+	var files *db.PageResult[models.File]
+	if filePage.Skip {
+		files = emptyFiles()
+	} else {
+		files, err = q.SearchFilesByUser(ctx, userID, term, filter, filePage)
+		if err != nil {
+			return nil, fmt.Errorf("search files: %w", err)
+		}
+	}
+
+	return &FolderContents{
+		Folder:     nil,
+		Subfolders: subfolders,
+		Files:      files,
+	}, nil
+}
+
 // Create inserts a new folder owned by userID. If parentID is non-nil the
 // parent folder must exist and be owned by the same user.
 // kind is "regular" or "media"; an empty or unknown value defaults to regular.
@@ -247,6 +291,70 @@ func (s *FolderService) GetMediaContents(
 	}, nil
 }
 
+// GetMediaTimeline returns per-period item counts for a media folder, for a
+// timeline scrubber. Membership and hidden filtering match GetMediaContents.
+// Returns ErrFolderNotFound if the folder does not belong to userID,
+// ErrNotMediaCollection if it is not a media folder.
+func (s *FolderService) GetMediaTimeline(
+	ctx context.Context,
+	folderID, userID uuid.UUID,
+	hidden db.HiddenFilter,
+	granularity db.TimelineGranularity,
+	tz string,
+) ([]db.TimelineBucket, error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get media timeline: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	folder, err := s.getOwned(ctx, q, folderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.Kind != models.FolderKindMedia {
+		return nil, ErrNotMediaCollection
+	}
+
+	buckets, err := q.MediaTimeline(ctx, folderID, hidden, granularity, tz)
+	if err != nil {
+		return nil, fmt.Errorf("get media timeline: %w", err)
+	}
+	return buckets, nil
+}
+
+// GetMediaGeo returns the geotagged items of a media folder inside bbox,
+// clustered to a grid×grid grid for a map view. Membership and hidden
+// filtering match GetMediaContents. Returns ErrFolderNotFound if the folder
+// does not belong to userID, ErrNotMediaCollection if it is not a media folder.
+func (s *FolderService) GetMediaGeo(
+	ctx context.Context,
+	folderID, userID uuid.UUID,
+	hidden db.HiddenFilter,
+	bbox db.BBox,
+	grid int,
+) ([]db.GeoCluster, error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get media geo: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	folder, err := s.getOwned(ctx, q, folderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.Kind != models.FolderKindMedia {
+		return nil, ErrNotMediaCollection
+	}
+
+	clusters, err := q.MediaGeoClusters(ctx, folderID, hidden, bbox, grid)
+	if err != nil {
+		return nil, fmt.Errorf("get media geo: %w", err)
+	}
+	return clusters, nil
+}
+
 // CopyToSubcollection adds a pointer placing fileID into the subcollection
 // collectionID without moving the file's physical home. Both must belong to
 // userID and collectionID must be a media folder. A duplicate pointer is a no-op.
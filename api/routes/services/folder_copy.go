@@ -0,0 +1,608 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// MaxCopyFolders caps the folders in one copied subtree.
+	MaxCopyFolders = 10_000
+	// folderCopyWorkers bounds how many copies run at once; the rest wait in
+	// the queued state.
+	folderCopyWorkers = 2
+	// maxFolderCopyFailures caps the per-file failures kept for the status
+	// response. Further failures are only counted.
+	maxFolderCopyFailures = 1000
+	// folderCopyRetention is how long a finished copy's status stays readable.
+	folderCopyRetention = 24 * time.Hour
+	// maxCopyNameAttempts bounds the "(copy N)" names tried for the root of a
+	// copy placed next to a folder of the same name.
+	maxCopyNameAttempts = 100
+)
+
+// Folder copy states.
+const (
+	FolderCopyQueued  = "queued"
+	FolderCopyRunning = "running"
+	FolderCopyDone    = "done"
+	FolderCopyFailed  = "failed"
+)
+
+var (
+	ErrFolderCopyTooLarge   = fmt.Errorf("a folder copy can hold at most %d folders", MaxCopyFolders)
+	ErrFolderCopyCycle      = errors.New("cannot copy a folder into itself or one of its subfolders")
+	ErrFolderCopyInProgress = errors.New("a folder copy is already running")
+	ErrFolderCopyNotFound   = errors.New("folder copy not found")
+)
+
+// FolderCopyInput names the folder to copy and where to put the copy.
+type FolderCopyInput struct {
+	UserID   uuid.UUID
+	Username string
+	FolderID uuid.UUID
+	// ParentID is the folder the copy is placed in. Nil means root.
+	ParentID *uuid.UUID
+}
+
+// FolderCopyFailure is one file that could not be copied.
+type FolderCopyFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// FolderCopyStatus is the progress of a folder copy.
+type FolderCopyStatus struct {
+	ID       uuid.UUID  `json:"id"`
+	SourceID uuid.UUID  `json:"source_id"`
+	ParentID *uuid.UUID `json:"parent_id"`
+	// FolderID is the root of the copy. The whole folder tree exists by the
+	// time the copy is accepted; files appear in it as they are copied.
+	FolderID    uuid.UUID           `json:"folder_id"`
+	Name        string              `json:"name"`
+	Status      string              `json:"status"`
+	Folders     int                 `json:"folders"`
+	TotalBytes  int64               `json:"total_bytes"`
+	CopiedFiles int                 `json:"copied_files"`
+	CopiedBytes int64               `json:"copied_bytes"`
+	Failed      int                 `json:"failed"`
+	Failures    []FolderCopyFailure `json:"failures"`
+	// Error is set when the copy stopped before reaching the last file.
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// clonedFolder pairs a source folder with its copy.
+type clonedFolder struct {
+	src, dst uuid.UUID
+	path     string
+}
+
+// folderCopyJob is an accepted copy whose folder tree already exists.
+type folderCopyJob struct {
+	userID   uuid.UUID
+	username string
+	folders  []clonedFolder // parents before children
+
+	mu     sync.Mutex
+	status FolderCopyStatus
+}
+
+func (j *folderCopyJob) snapshot() *FolderCopyStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := j.status
+	st.Failures = append([]FolderCopyFailure{}, j.status.Failures...)
+	return &st
+}
+
+func (j *folderCopyJob) update(fn func(st *FolderCopyStatus)) {
+	j.mu.Lock()
+	fn(&j.status)
+	j.mu.Unlock()
+}
+
+func (j *folderCopyJob) fail(path string, err error) {
+	j.update(func(st *FolderCopyStatus) {
+		st.Failed++
+		if len(st.Failures) < maxFolderCopyFailures {
+			st.Failures = append(st.Failures, FolderCopyFailure{Path: path, Error: err.Error()})
+		}
+	})
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// FolderCopyService copies a folder and everything beneath it into another
+// folder. The folder rows are cloned in one transaction when the copy is
+// accepted; file contents are then copied in the background and followed
+// through Get. Status lives in memory: a copy interrupted by a restart
+// stops where it was, and the files copied so far stay in place.
+type FolderCopyService struct {
+	queries *db.Queries
+	files   *FileService
+	folders *FolderService
+
+	slots  chan struct{}
+	active sync.Map // uuid.UUID (user) → struct{}
+	copies sync.Map // uuid.UUID → *folderCopyJob
+}
+
+// NewFolderCopyService creates a FolderCopyService and starts its cleanup loop.
+func NewFolderCopyService(q *db.Queries, files *FileService, folders *FolderService) *FolderCopyService {
+	s := &FolderCopyService{
+		queries: q,
+		files:   files,
+		folders: folders,
+		slots:   make(chan struct{}, folderCopyWorkers),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// Start clones the folder tree under in.FolderID into in.ParentID and
+// queues its files for copying. Nothing is created before the checks pass:
+//   - both folders must belong to the user (ErrFolderNotFound);
+//   - the target must not be the folder or lie beneath it (ErrFolderCopyCycle);
+//   - the subtree must hold at most MaxCopyFolders folders
+//     (ErrFolderCopyTooLarge) and its files must fit in the remaining quota
+//     (ErrQuotaExceeded).
+//
+// The copy keeps the folder's name, or "Name (copy)", "Name (copy 2)"… when
+// the target already has a folder of that name. A user runs one copy at a
+// time (ErrFolderCopyInProgress).
+func (s *FolderCopyService) Start(ctx context.Context, in FolderCopyInput) (*FolderCopyStatus, error) {
+	if _, busy := s.active.LoadOrStore(in.UserID, struct{}{}); busy {
+		return nil, ErrFolderCopyInProgress
+	}
+	accepted := false
+	defer func() {
+		if !accepted {
+			s.active.Delete(in.UserID)
+		}
+	}()
+
+	user, err := s.queries.GetUserByUsername(ctx, in.Username)
+	if err != nil {
+		return nil, fmt.Errorf("copy folder: get user: %w", err)
+	}
+
+	q, tx, err := s.queries.ForUser(ctx, in.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("copy folder: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	tree, err := q.ListFolderSubtree(ctx, in.FolderID)
+	if err != nil {
+		return nil, fmt.Errorf("copy folder: list subtree: %w", err)
+	}
+	if len(tree) == 0 || tree[0].UserID != in.UserID {
+		return nil, ErrFolderNotFound
+	}
+	if len(tree) > MaxCopyFolders {
+		return nil, ErrFolderCopyTooLarge
+	}
+	root := tree[0]
+
+	var parent *models.Folder
+	if in.ParentID != nil {
+		if parent, err = s.folders.getOwned(ctx, q, *in.ParentID, in.UserID); err != nil {
+			return nil, err
+		}
+		cycle, err := q.FolderWouldCreateCycle(ctx, root.ID, parent.ID)
+		if err != nil {
+			return nil, fmt.Errorf("copy folder: %w", err)
+		}
+		if cycle {
+			return nil, ErrFolderCopyCycle
+		}
+	}
+	if root.SizeBytes > user.StorageQuotaBytes-user.StorageUsedBytes {
+		return nil, ErrQuotaExceeded
+	}
+
+	cloned, err := cloneFolderTree(ctx, q, tree, parent)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("copy folder: commit: %w", err)
+	}
+
+	job := &folderCopyJob{
+		userID:   in.UserID,
+		username: in.Username,
+		folders:  cloned,
+		status: FolderCopyStatus{
+			ID:         uuid.New(),
+			SourceID:   root.ID,
+			ParentID:   in.ParentID,
+			FolderID:   cloned[0].dst,
+			Name:       cloned[0].path,
+			Status:     FolderCopyQueued,
+			Folders:    len(cloned),
+			TotalBytes: root.SizeBytes,
+			Failures:   []FolderCopyFailure{},
+			CreatedAt:  time.Now(),
+		},
+	}
+	s.copies.Store(job.status.ID, job)
+	accepted = true
+	go s.run(job)
+	return job.snapshot(), nil
+}
+
+// Get returns the status of a copy started by userID. Returns
+// ErrFolderCopyNotFound when it does not exist, has been pruned or belongs
+// to someone else.
+func (s *FolderCopyService) Get(id, userID uuid.UUID) (*FolderCopyStatus, error) {
+	v, ok := s.copies.Load(id)
+	if !ok || v.(*folderCopyJob).userID != userID {
+		return nil, ErrFolderCopyNotFound
+	}
+	return v.(*folderCopyJob).snapshot(), nil
+}
+
+// cloneFolderTree creates a copy of every folder in tree (parents before
+// children, as ListFolderSubtree returns them) with the root placed in
+// parent. Folders copied into a media folder become media subcollections,
+// as FolderService.Create makes them.
+func cloneFolderTree(ctx context.Context, q *db.Queries, tree []models.Folder, parent *models.Folder) ([]clonedFolder, error) {
+	type copied struct {
+		id   uuid.UUID
+		kind string
+		path string
+	}
+	dst := make(map[uuid.UUID]copied, len(tree))
+	out := make([]clonedFolder, 0, len(tree))
+
+	for i, f := range tree {
+		var parentID *uuid.UUID
+		parentKind, parentPath := "", ""
+		if i == 0 {
+			if parent != nil {
+				parentID, parentKind = &parent.ID, parent.Kind
+			}
+		} else {
+			p, ok := dst[*f.ParentID]
+			if !ok {
+				return nil, fmt.Errorf("copy folder: %s listed before its parent", f.ID)
+			}
+			parentID, parentKind, parentPath = &p.id, p.kind, p.path+"/"
+		}
+		kind := f.Kind
+		if parentKind == models.FolderKindMedia {
+			kind = models.FolderKindMedia
+		}
+
+		var created *models.Folder
+		for n := 1; ; n++ {
+			name := f.Name
+			if i == 0 {
+				name = copyName(f.Name, n)
+			}
+			err := q.Savepoint(ctx, func() error {
+				var err error
+				created, err = q.CreateFolder(ctx, &models.Folder{
+					UserID:   f.UserID,
+					ParentID: parentID,
+					Name:     name,
+					Kind:     kind,
+				})
+				return err
+			})
+			if err == nil {
+				break
+			}
+			if !isDuplicateKeyError(err) {
+				return nil, fmt.Errorf("copy folder: %w", err)
+			}
+			if i > 0 || n == maxCopyNameAttempts {
+				return nil, ErrDuplicateFolderName
+			}
+		}
+
+		c := copied{id: created.ID, kind: created.Kind, path: parentPath + created.Name}
+		dst[f.ID] = c
+		out = append(out, clonedFolder{src: f.ID, dst: c.id, path: c.path})
+	}
+	return out, nil
+}
+
+// copyName returns the name tried on the nth attempt to place a copy of
+// name: name itself, then "name (copy)", "name (copy 2)" and so on.
+func copyName(name string, n int) string {
+	switch n {
+	case 1:
+		return name
+	case 2:
+		return name + " (copy)"
+	}
+	return name + " (copy " + strconv.Itoa(n-1) + ")"
+}
+
+// run copies an accepted job's files once a worker slot is free.
+func (s *FolderCopyService) run(job *folderCopyJob) {
+	s.slots <- struct{}{}
+	defer func() {
+		<-s.slots
+		s.active.Delete(job.userID)
+	}()
+	job.update(func(st *FolderCopyStatus) { st.Status = FolderCopyRunning })
+
+	ctx := context.Background()
+	err := s.copyFiles(ctx, job)
+
+	now := time.Now()
+	job.update(func(st *FolderCopyStatus) {
+		st.Status = FolderCopyDone
+		if err != nil {
+			st.Status = FolderCopyFailed
+			st.Error = err.Error()
+		}
+		st.FinishedAt = &now
+	})
+	st := job.snapshot()
+	log.Printf("folder copy %s: user=%s status=%s copied=%d failed=%d", st.ID, job.username, st.Status, st.CopiedFiles, st.Failed)
+}
+
+// copyFiles copies the files of every source folder into its clone. Files
+// are listed a page at a time, so files added or deleted while the copy runs
+// are picked up or skipped.
+func (s *FolderCopyService) copyFiles(ctx context.Context, job *folderCopyJob) error {
+	for _, f := range job.folders {
+		for in := (db.PageInput{Limit: db.MaxPageLimit}); ; {
+			page, err := s.filePage(ctx, job.userID, f.src, in)
+			if err != nil {
+				return err
+			}
+			for i := range page.Items {
+				src := &page.Items[i]
+				_, err := s.files.copyFile(ctx, job.username, src, f.dst)
+				if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrStorageUnavailable) {
+					// Every later file would fail the same way.
+					return err
+				}
+				if err != nil {
+					job.fail(f.path+"/"+src.Name, err)
+					continue
+				}
+				job.update(func(st *FolderCopyStatus) {
+					st.CopiedFiles++
+					st.CopiedBytes += src.SizeBytes
+				})
+			}
+			if page.NextToken == "" {
+				break
+			}
+			in.Cursor = page.NextToken
+		}
+	}
+	return nil
+}
+
+// filePage holds a transaction only for one page, never while blobs are
+// being copied.
+func (s *FolderCopyService) filePage(ctx context.Context, userID, folderID uuid.UUID, in db.PageInput) (*db.PageResult[models.File], error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("copy folder: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	page, err := q.ListFilesByFolder(ctx, folderID, in)
+	if err != nil {
+		return nil, fmt.Errorf("copy folder: list files: %w", err)
+	}
+	return page, nil
+}
+
+func (s *FolderCopyService) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-folderCopyRetention)
+		s.copies.Range(func(k, v any) bool {
+			if st := v.(*folderCopyJob).snapshot(); st.FinishedAt != nil && st.FinishedAt.Before(cutoff) {
+				s.copies.Delete(k)
+			}
+			return true
+		})
+	}
+}
+
+// ── File copies ───────────────────────────────────────────────────────────────
+
+// copyFile stores a copy of src in folderID under a new id and object key.
+// A blob on the user's current drive is copied server-side as it is; one
+// still on another drive (a migration in progress) is decrypted from there
+// and encrypted afresh onto the current drive. The capture date, media
+// metadata, tags and hidden flag are copied; thumbnails, video variants and
+// the text index are rebuilt by the jobs an upload queues.
+func (s *FileService) copyFile(ctx context.Context, username string, src *models.File, folderID uuid.UUID) (*models.File, error) {
+	if err := s.CheckQuota(ctx, username, src.SizeBytes); err != nil {
+		return nil, err
+	}
+	storage, driveID, err := s.storageFor(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("copy: %w", err)
+	}
+
+	objectKey := objectKeyFor(src.UserID, uuid.New())
+	nonce := src.Nonce
+	if src.DriveID == nil || *src.DriveID == driveID {
+		err = storage.CopyObject(ctx, src.MinIOObjectKey, objectKey)
+	} else {
+		nonce, err = s.reencryptObject(ctx, username, src, storage, objectKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("copy: store: %w", err)
+	}
+
+	q, tx, err := s.queries.ForUser(ctx, src.UserID)
+	if err != nil {
+		_ = storage.RemoveObject(ctx, objectKey)
+		return nil, fmt.Errorf("copy: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := s.checkDrive(ctx, q, username, driveID); err != nil {
+		_ = storage.RemoveObject(ctx, objectKey)
+		return nil, fmt.Errorf("copy: %w", err)
+	}
+	file, err := q.CreateFile(ctx, &models.File{
+		UserID:         src.UserID,
+		FolderID:       &folderID,
+		DriveID:        &driveID,
+		Name:           src.Name,
+		MimeType:       src.MimeType,
+		SizeBytes:      src.SizeBytes,
+		MinIOObjectKey: objectKey,
+		Nonce:          nonce,
+		TakenAt:        src.TakenAt,
+	})
+	if err == nil && src.Hidden {
+		file, err = q.SetFileHidden(ctx, file.ID, true)
+	}
+	if err == nil && len(src.Tags) > 0 {
+		file, err = q.SetFileTags(ctx, file.ID, src.Tags)
+	}
+	if err != nil {
+		_ = storage.RemoveObject(ctx, objectKey)
+		if isDuplicateKeyError(err) {
+			return nil, ErrDuplicateName
+		}
+		return nil, fmt.Errorf("copy: save metadata: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		_ = storage.RemoveObject(ctx, objectKey)
+		return nil, fmt.Errorf("copy: commit: %w", err)
+	}
+
+	go s.replicateStored(username, file.ID, objectKey, nonce)
+
+	if err := s.queries.AddStorageUsed(ctx, username, src.SizeBytes); err != nil {
+		return nil, fmt.Errorf("copy: update storage: %w", err)
+	}
+
+	if media, err := s.MediaMetadata(ctx, src.ID); err != nil {
+		log.Printf("copy: %v", err)
+	} else if err := s.storeMediaMetadata(ctx, file, username, media); err != nil {
+		log.Printf("copy: %v", err)
+	}
+
+	if strings.HasPrefix(file.MimeType, "video/") && s.transcode != nil && s.transcode.Available() {
+		s.enqueueJob(ctx, models.JobKindTranscode, file, username)
+		s.enqueueJob(ctx, models.JobKindHLS, file, username)
+	}
+	if s.thumbs != nil && s.thumbs.Supports(file.MimeType) {
+		s.enqueueJob(ctx, models.JobKindThumbnail, file, username)
+	}
+	if s.text != nil && s.text.Supports(file.MimeType) {
+		s.enqueueJob(ctx, models.JobKindTextIndex, file, username)
+	}
+	return file, nil
+}
+
+// reencryptObject decrypts src from the drive it is stored on and writes it
+// to objectKey on dst under fresh nonces. Chunked blobs are streamed a chunk
+// at a time; single blobs are decrypted whole, as every download of them is.
+// Returns the nonce to store with the copy (empty for chunked blobs).
+func (s *FileService) reencryptObject(ctx context.Context, username string, src *models.File, dst BlobStore, objectKey string) ([]byte, error) {
+	from, err := storageForDrive(ctx, s.queries, s.registry, *src.DriveID)
+	if err != nil {
+		return nil, err
+	}
+	userKey, err := s.userKey(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(userKey)
+
+	rc, err := from.GetObject(ctx, src.MinIOObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	if !IsChunked(src) {
+		ciphertext, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := s.enc.DecryptFile(userKey, src.Nonce, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		out, nonce, err := s.enc.EncryptFile(userKey, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		return nonce, dst.PutObject(ctx, objectKey, bytes.NewReader(out), int64(len(out)), "application/octet-stream")
+	}
+
+	// Re-encrypting keeps every chunk's length, so the copy is exactly as
+	// large as the source.
+	info, err := from.StatObject(ctx, src.MinIOObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(reencryptChunks(userKey, rc, pw))
+	}()
+	err = dst.PutObject(ctx, objectKey, pr, info.Size, "application/octet-stream")
+	_ = pr.CloseWithError(err)
+	<-done
+	return []byte{}, err
+}
+
+// reencryptChunks reads a chunked blob from r, authenticates every chunk
+// and writes it to w encrypted under a fresh nonce.
+func reencryptChunks(userKey []byte, r io.Reader, w io.Writer) error {
+	buf := make([]byte, StoredChunkSize)
+	for idx := 0; ; idx++ {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			if idx == 0 {
+				return fmt.Errorf("%w: empty blob", errCorruptBlob)
+			}
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("read chunk %d: %w", idx, err)
+		}
+		if n <= chunkNonceSize {
+			return fmt.Errorf("%w: chunk %d too short (%d bytes)", errCorruptBlob, idx, n)
+		}
+		plain, derr := aesGCMDecrypt(userKey, buf[:chunkNonceSize], buf[chunkNonceSize:n])
+		if derr != nil {
+			return fmt.Errorf("%w: chunk %d: %v", errCorruptBlob, idx, derr)
+		}
+		ciphertext, nonce, eerr := aesGCMEncrypt(userKey, plain)
+		if eerr != nil {
+			return fmt.Errorf("encrypt chunk %d: %w", idx, eerr)
+		}
+		if _, werr := w.Write(append(nonce, ciphertext...)); werr != nil {
+			return werr
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil // short final chunk
+		}
+	}
+}
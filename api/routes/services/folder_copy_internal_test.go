@@ -0,0 +1,51 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCopyName(t *testing.T) {
+	want := []string{"Photos", "Photos (copy)", "Photos (copy 2)", "Photos (copy 3)"}
+	for i, w := range want {
+		if got := copyName("Photos", i+1); got != w {
+			t.Errorf("copyName(%d) = %q; want %q", i+1, got, w)
+		}
+	}
+}
+
+func TestReencryptChunks(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	enc := &EncryptionService{}
+
+	plain := bytes.Repeat([]byte("copy"), (2*ChunkSize+100)/4)
+	blob, err := enc.EncryptChunked(key, plain)
+	if err != nil {
+		t.Fatalf("EncryptChunked: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := reencryptChunks(key, bytes.NewReader(blob), &out); err != nil {
+		t.Fatalf("reencryptChunks: %v", err)
+	}
+	if out.Len() != len(blob) {
+		t.Errorf("re-encrypted %d bytes; want %d", out.Len(), len(blob))
+	}
+	if bytes.Equal(out.Bytes()[:chunkNonceSize], blob[:chunkNonceSize]) {
+		t.Error("first chunk kept its nonce")
+	}
+	got, err := enc.DecryptChunked(key, out.Bytes())
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("round trip: %d bytes, %v; want the original %d bytes", len(got), err, len(plain))
+	}
+
+	tampered := append([]byte(nil), blob...)
+	tampered[chunkNonceSize+7] ^= 0xff
+	if err := reencryptChunks(key, bytes.NewReader(tampered), &bytes.Buffer{}); !errors.Is(err, errCorruptBlob) {
+		t.Errorf("tampered: err = %v; want errCorruptBlob", err)
+	}
+	if err := reencryptChunks(key, bytes.NewReader(nil), &bytes.Buffer{}); !errors.Is(err, errCorruptBlob) {
+		t.Errorf("empty: err = %v; want errCorruptBlob", err)
+	}
+}
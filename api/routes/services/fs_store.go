@@ -0,0 +1,454 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Reserved directories inside an FSStore root. Keys may not start with "."
+// so they can never collide with these.
+const (
+	fsTempDir    = ".tmp"     // partially written blobs, renamed into place when complete
+	fsUploadsDir = ".uploads" // one subdirectory of part files per multipart upload
+	fsUploadKey  = "key"      // file inside an upload directory holding its target key
+)
+
+var errInvalidBlobKey = errors.New("invalid blob key")
+
+// FSStore is the BlobStore for the local filesystem backend. Each drive is a
+// directory and each blob a file at root/<key>. Writes go to a temp file in
+// the same filesystem, are fsynced and then renamed into place, so a reader
+// never sees a partial blob and a crash leaves either the old or the new one.
+type FSStore struct {
+	root string
+}
+
+var _ BlobStore = (*FSStore)(nil)
+
+// NewFSStore constructs an FSStore rooted at dir. The directory is created on
+// the first write.
+func NewFSStore(dir string) *FSStore {
+	return &FSStore{root: dir}
+}
+
+// path maps key to its file, rejecting anything that could escape the root or
+// reach the reserved directories.
+func (s *FSStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasPrefix(key, ".") || path.Clean(key) != key {
+		return "", fmt.Errorf("%w: %q", errInvalidBlobKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %q", errInvalidBlobKey, key)
+		}
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// PutObject writes r to key atomically. When size is not -1 the write fails
+// unless r yields exactly size bytes.
+func (s *FSStore) PutObject(ctx context.Context, key string, r io.Reader, size int64, _ string) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("fs: put: %w", err)
+	}
+	err = s.writeAtomic(dst, func(f *os.File) error {
+		n, err := io.Copy(f, ctxReader{ctx, r})
+		if err != nil {
+			return err
+		}
+		if size >= 0 && n != size {
+			return fmt.Errorf("short write: got %d bytes, want %d", n, size)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fs: put %q: %w", key, err)
+	}
+	return nil
+}
+
+// GetObject opens the blob at key. Unlike S3Store a missing key is reported
+// here rather than on the first Read.
+func (s *FSStore) GetObject(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, fmt.Errorf("fs: get %q: %w", key, err)
+	}
+	return f, nil
+}
+
+// GetObjectRange returns a reader for [start, end] (inclusive). As with S3 an
+// end past the last byte is clamped, but a start past it is an error.
+func (s *FSStore) GetObjectRange(_ context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, fmt.Errorf("fs: get range [%d-%d] on %q: %w", start, end, key, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("fs: get range [%d-%d] on %q: %w", start, end, key, err)
+	}
+	if start < 0 || end < start || start >= info.Size() {
+		f.Close()
+		return nil, fmt.Errorf("fs: get range [%d-%d] on %q: invalid range for %d-byte blob", start, end, key, info.Size())
+	}
+	if end >= info.Size() {
+		end = info.Size() - 1
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, start, end-start+1), f}, nil
+}
+
+// RemoveObject deletes the blob at key (idempotent) and prunes the now-empty
+// directories above it.
+func (s *FSStore) RemoveObject(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("fs: remove: %w", err)
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("fs: remove %q: %w", key, err)
+	}
+	for dir := filepath.Dir(p); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty
+		}
+	}
+	return nil
+}
+
+// StatObject returns the size and modification time of the blob at key.
+func (s *FSStore) StatObject(_ context.Context, key string) (BlobInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return BlobInfo{}, fmt.Errorf("fs: stat: %w", err)
+	}
+	info, err := os.Stat(p)
+	if err != nil || info.IsDir() {
+		return BlobInfo{}, fmt.Errorf("fs: stat %q: %w", key, notFound(err))
+	}
+	return BlobInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+// CopyObject copies srcKey to dstKey atomically.
+func (s *FSStore) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.open(srcKey)
+	if err != nil {
+		return fmt.Errorf("fs: copy %q to %q: %w", srcKey, dstKey, err)
+	}
+	defer src.Close()
+	dst, err := s.path(dstKey)
+	if err != nil {
+		return fmt.Errorf("fs: copy: %w", err)
+	}
+	err = s.writeAtomic(dst, func(f *os.File) error {
+		_, err := io.Copy(f, ctxReader{ctx, src})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("fs: copy %q to %q: %w", srcKey, dstKey, err)
+	}
+	return nil
+}
+
+// ListObjects walks the store in lexical key order, skipping the reserved
+// directories.
+func (s *FSStore) ListObjects(ctx context.Context, prefix string, fn func(BlobInfo) error) error {
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == s.root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll // nothing written yet
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			switch {
+			case p == s.root:
+				return nil
+			case strings.HasPrefix(key, "."):
+				return fs.SkipDir
+			case !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/"):
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(key, ".") || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(BlobInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+	})
+	if err != nil {
+		return fmt.Errorf("fs: list %q: %w", s.root, err)
+	}
+	return nil
+}
+
+// ── Multipart upload ──────────────────────────────────────────────────────────
+
+// CreateMultipartUpload creates a directory to collect the upload's parts.
+func (s *FSStore) CreateMultipartUpload(_ context.Context, key string) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", fmt.Errorf("fs: create multipart upload: %w", err)
+	}
+	uploadID := uuid.NewString()
+	dir := filepath.Join(s.root, fsUploadsDir, uploadID)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("fs: create multipart upload for %q: %w", key, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fsUploadKey), []byte(key), 0o640); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("fs: create multipart upload for %q: %w", key, err)
+	}
+	return uploadID, nil
+}
+
+// UploadPart writes data as part partNumber. Each part is written atomically,
+// so a retried part simply replaces the earlier attempt.
+func (s *FSStore) UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (BlobPart, error) {
+	dir, err := s.uploadDir(key, uploadID)
+	if err != nil {
+		return BlobPart{}, fmt.Errorf("fs: upload part %d of %q: %w", partNumber, key, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return BlobPart{}, fmt.Errorf("fs: upload part %d of %q: %w", partNumber, key, err)
+	}
+	err = s.writeAtomic(filepath.Join(dir, partFileName(partNumber)), func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+	if err != nil {
+		return BlobPart{}, fmt.Errorf("fs: upload part %d of %q: %w", partNumber, key, err)
+	}
+	sum := sha256.Sum256(data)
+	return BlobPart{PartNumber: partNumber, ETag: hex.EncodeToString(sum[:])}, nil
+}
+
+// CompleteMultipartUpload concatenates parts into the blob at key, checking
+// each part against its ETag, then removes the upload directory.
+func (s *FSStore) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []BlobPart) error {
+	dir, err := s.uploadDir(key, uploadID)
+	if err != nil {
+		return fmt.Errorf("fs: complete multipart upload for %q: %w", key, err)
+	}
+	dst, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("fs: complete multipart upload: %w", err)
+	}
+	err = s.writeAtomic(dst, func(f *os.File) error {
+		for i, p := range parts {
+			if i > 0 && p.PartNumber <= parts[i-1].PartNumber {
+				return fmt.Errorf("parts out of order at part %d", p.PartNumber)
+			}
+			if err := appendPart(ctx, f, filepath.Join(dir, partFileName(p.PartNumber)), p.ETag); err != nil {
+				return fmt.Errorf("part %d: %w", p.PartNumber, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fs: complete multipart upload for %q: %w", key, err)
+	}
+	_ = os.RemoveAll(dir)
+	return nil
+}
+
+// AbortMultipartUpload removes the upload directory and any parts in it.
+func (s *FSStore) AbortMultipartUpload(_ context.Context, key, uploadID string) error {
+	dir, err := s.uploadDir(key, uploadID)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fs: abort multipart upload for %q: %w", key, err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("fs: abort multipart upload for %q: %w", key, err)
+	}
+	return nil
+}
+
+// ── Helpers ───────────────────────────────────────────────────────────────────
+
+func (s *FSStore) open(key string) (*os.File, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		f.Close()
+		return nil, notFound(err)
+	}
+	return f, nil
+}
+
+// uploadDir returns the directory of an upload started for key.
+func (s *FSStore) uploadDir(key, uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+	dir := filepath.Join(s.root, fsUploadsDir, uploadID)
+	owner, err := os.ReadFile(filepath.Join(dir, fsUploadKey))
+	if err != nil {
+		return "", fmt.Errorf("upload %s: %w", uploadID, notFound(err))
+	}
+	if string(owner) != key {
+		return "", fmt.Errorf("upload %s belongs to %q", uploadID, owner)
+	}
+	return dir, nil
+}
+
+// writeAtomic fills a temp file via write, fsyncs it, renames it to dst and
+// fsyncs dst's directory so the rename itself survives a crash.
+func (s *FSStore) writeAtomic(dst string, write func(*os.File) error) error {
+	tmpDir := filepath.Join(s.root, fsTempDir)
+	if err := os.MkdirAll(tmpDir, 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(dst))
+}
+
+// appendPart copies one part file onto w, verifying it still matches etag.
+func appendPart(ctx context.Context, w io.Writer, partPath, etag string) error {
+	f, err := os.Open(partPath)
+	if err != nil {
+		return notFound(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), ctxReader{ctx, f}); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != etag {
+		return fmt.Errorf("etag mismatch (have %s, want %s)", got, etag)
+	}
+	return nil
+}
+
+func partFileName(partNumber int) string {
+	return fmt.Sprintf("part-%05d", partNumber)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// notFound maps a missing file (or a directory where a blob was expected,
+// err == nil) to ErrBlobNotFound.
+func notFound(err error) error {
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+// ctxReader stops a long copy once ctx is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// ── Backend ───────────────────────────────────────────────────────────────────
+
+// fsBackend serves an "fs" server: its endpoint is a directory and each of
+// its drives is a subdirectory named after the drive's bucket.
+type fsBackend struct {
+	root string
+}
+
+func (b *fsBackend) Store(bucket string) BlobStore {
+	return NewFSStore(filepath.Join(b.root, bucket))
+}
+
+func (b *fsBackend) EnsureBucket(_ context.Context, bucket string) error {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || strings.HasPrefix(bucket, ".") {
+		return fmt.Errorf("fs: invalid bucket name %q", bucket)
+	}
+	if err := os.MkdirAll(filepath.Join(b.root, bucket), 0o750); err != nil {
+		return fmt.Errorf("fs: create bucket %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// Probe checks that the root is a writable directory; a read-only remount
+// after a disk error is as good as down.
+func (b *fsBackend) Probe(_ context.Context) error {
+	info, err := os.Stat(b.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", b.root)
+	}
+	f, err := os.CreateTemp(b.root, ".probe-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readBlob(t *testing.T, s BlobStore, key string) []byte {
+	t.Helper()
+	rc, err := s.GetObject(context.Background(), key)
+	if err != nil {
+		t.Fatalf("GetObject(%q): %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %q: %v", key, err)
+	}
+	return data
+}
+
+func TestFSStore_PutGetStatRemove(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+	key := "user/file.bin"
+	data := []byte("hello, filesystem backend")
+
+	if err := s.PutObject(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if got := readBlob(t, s, key); !bytes.Equal(got, data) {
+		t.Errorf("GetObject = %q, want %q", got, data)
+	}
+	info, err := s.StatObject(ctx, key)
+	if err != nil || info.Size != int64(len(data)) || info.Key != key {
+		t.Errorf("StatObject = %+v, %v", info, err)
+	}
+
+	if err := s.RemoveObject(ctx, key); err != nil {
+		t.Fatalf("RemoveObject: %v", err)
+	}
+	if err := s.RemoveObject(ctx, key); err != nil {
+		t.Errorf("second RemoveObject should be a no-op, got %v", err)
+	}
+	if _, err := s.StatObject(ctx, key); !errors.Is(err, ErrBlobNotFound) || !isNoSuchKey(err) {
+		t.Errorf("StatObject after remove: got %v, want ErrBlobNotFound", err)
+	}
+	if _, err := s.GetObject(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("GetObject after remove: got %v, want ErrBlobNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.root, "user")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty user directory to be pruned, got %v", err)
+	}
+}
+
+func TestFSStore_PutShortWriteLeavesNothing(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+
+	if err := s.PutObject(ctx, "k", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Fatal("expected an error for a short body")
+	}
+	if _, err := s.StatObject(ctx, "k"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("partial blob became visible: %v", err)
+	}
+	tmp, _ := os.ReadDir(filepath.Join(s.root, fsTempDir))
+	if len(tmp) != 0 {
+		t.Errorf("expected no temp files left behind, found %d", len(tmp))
+	}
+}
+
+func TestFSStore_GetObjectRange(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+	data := []byte("0123456789")
+	if err := s.PutObject(ctx, "r", bytes.NewReader(data), -1, ""); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	cases := []struct {
+		start, end int64
+		want       string
+		wantErr    bool
+	}{
+		{0, 0, "0", false},
+		{2, 5, "2345", false},
+		{7, 100, "789", false}, // end is clamped like S3
+		{10, 12, "", true},     // start past the end
+		{5, 2, "", true},
+	}
+	for _, tc := range cases {
+		rc, err := s.GetObjectRange(ctx, "r", tc.start, tc.end)
+		if tc.wantErr {
+			if err == nil {
+				rc.Close()
+				t.Errorf("[%d-%d]: expected an error", tc.start, tc.end)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d-%d]: %v", tc.start, tc.end, err)
+			continue
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(got) != tc.want {
+			t.Errorf("[%d-%d] = %q, want %q", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestFSStore_RejectsUnsafeKeys(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+	for _, key := range []string{"", "/etc/passwd", "../escape", "a/../../escape", "a//b", "a/", ".tmp/x", ".uploads/x"} {
+		if err := s.PutObject(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, errInvalidBlobKey) {
+			t.Errorf("PutObject(%q): got %v, want errInvalidBlobKey", key, err)
+		}
+	}
+}
+
+func TestFSStore_ListObjects(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+
+	var none []string
+	if err := s.ListObjects(ctx, "", func(o BlobInfo) error { none = append(none, o.Key); return nil }); err != nil || len(none) != 0 {
+		t.Fatalf("listing an unwritten store: %v, %v", none, err)
+	}
+
+	for _, k := range []string{"a/1", "a/2", "ab/1", "b/1", "quarantine/a/1"} {
+		if err := s.PutObject(ctx, k, strings.NewReader(k), int64(len(k)), ""); err != nil {
+			t.Fatalf("PutObject(%q): %v", k, err)
+		}
+	}
+	// An unfinished multipart upload must not show up in listings.
+	if _, err := s.CreateMultipartUpload(ctx, "a/3"); err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+
+	cases := map[string][]string{
+		"":   {"a/1", "a/2", "ab/1", "b/1", "quarantine/a/1"},
+		"a/": {"a/1", "a/2"},
+		"a":  {"a/1", "a/2", "ab/1"},
+		"b/": {"b/1"},
+		"c/": nil,
+	}
+	for prefix, want := range cases {
+		var got []string
+		err := s.ListObjects(ctx, prefix, func(o BlobInfo) error {
+			if o.Size != int64(len(o.Key)) {
+				t.Errorf("%q: size %d, want %d", o.Key, o.Size, len(o.Key))
+			}
+			got = append(got, o.Key)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ListObjects(%q): %v", prefix, err)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("ListObjects(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestFSStore_CopyObject(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+	if err := s.PutObject(ctx, "src", strings.NewReader("payload"), 7, ""); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if err := s.CopyObject(ctx, "src", "quarantine/src"); err != nil {
+		t.Fatalf("CopyObject: %v", err)
+	}
+	if got := readBlob(t, s, "quarantine/src"); string(got) != "payload" {
+		t.Errorf("copy = %q", got)
+	}
+	if err := s.CopyObject(ctx, "missing", "dst"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("copying a missing key: got %v, want ErrBlobNotFound", err)
+	}
+}
+
+func TestFSStore_Multipart(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+	key := "user/big.bin"
+
+	id, err := s.CreateMultipartUpload(ctx, key)
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	chunks := [][]byte{[]byte("first-"), []byte("second-"), []byte("third")}
+	parts := make([]BlobPart, len(chunks))
+	// Upload out of order, as the chunked upload goroutines do.
+	for _, i := range []int{2, 0, 1} {
+		if parts[i], err = s.UploadPart(ctx, key, id, i+1, chunks[i]); err != nil {
+			t.Fatalf("UploadPart %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.StatObject(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("blob visible before completion: %v", err)
+	}
+	if _, err := s.UploadPart(ctx, "user/other.bin", id, 1, chunks[0]); err == nil {
+		t.Error("expected an error uploading a part under the wrong key")
+	}
+
+	if err := s.CompleteMultipartUpload(ctx, key, id, parts); err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	if got := readBlob(t, s, key); string(got) != "first-second-third" {
+		t.Errorf("assembled blob = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(s.root, fsUploadsDir, id)); !os.IsNotExist(err) {
+		t.Errorf("expected the upload directory to be removed, got %v", err)
+	}
+}
+
+func TestFSStore_MultipartRejectsBadParts(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir())
+	key := "k"
+	id, _ := s.CreateMultipartUpload(ctx, key)
+	p1, _ := s.UploadPart(ctx, key, id, 1, []byte("aaa"))
+	p2, _ := s.UploadPart(ctx, key, id, 2, []byte("bbb"))
+
+	if err := s.CompleteMultipartUpload(ctx, key, id, []BlobPart{p2, p1}); err == nil {
+		t.Error("expected an error for parts out of order")
+	}
+	p2.ETag = p1.ETag
+	if err := s.CompleteMultipartUpload(ctx, key, id, []BlobPart{p1, p2}); err == nil {
+		t.Error("expected an error for an ETag mismatch")
+	}
+	if _, err := s.StatObject(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("failed completion left a blob behind: %v", err)
+	}
+
+	if err := s.AbortMultipartUpload(ctx, key, id); err != nil {
+		t.Fatalf("AbortMultipartUpload: %v", err)
+	}
+	if err := s.AbortMultipartUpload(ctx, key, id); err != nil {
+		t.Errorf("second abort should be a no-op, got %v", err)
+	}
+	if _, err := s.UploadPart(ctx, key, id, 3, []byte("c")); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("UploadPart after abort: got %v, want ErrBlobNotFound", err)
+	}
+}
+
+// The migration and replication copy path only sees BlobStore, so it can be
+// exercised end to end on two filesystem drives.
+func TestCopyAndVerify_FSStores(t *testing.T) {
+	ctx := context.Background()
+	src, dst := NewFSStore(t.TempDir()), NewFSStore(t.TempDir())
+	userKey := bytes.Repeat([]byte{7}, 32)
+
+	ct, nonce, err := aesGCMEncrypt(userKey, []byte("secret contents"))
+	if err != nil {
+		t.Fatalf("aesGCMEncrypt: %v", err)
+	}
+	o := migrationObject{key: "u/blob", nonce: nonce}
+	if err := src.PutObject(ctx, o.key, bytes.NewReader(ct), int64(len(ct)), ""); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	n, err := copyAndVerify(ctx, src, dst, userKey, o)
+	if err != nil || n != int64(len(ct)) {
+		t.Fatalf("copyAndVerify = %d, %v", n, err)
+	}
+	if !bytes.Equal(readBlob(t, dst, o.key), ct) {
+		t.Error("copied blob differs from the source")
+	}
+
+	// A blob deleted after listing is skipped, not an error.
+	if n, err := copyAndVerify(ctx, src, dst, userKey, migrationObject{key: "u/gone", nonce: nonce}); err != nil || n != 0 {
+		t.Errorf("missing source: got %d, %v", n, err)
+	}
+
+	// A damaged copy on the target is detected and rewritten.
+	if err := dst.PutObject(ctx, o.key, strings.NewReader("garbage"), 7, ""); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if _, err := copyAndVerify(ctx, src, dst, userKey, o); err != nil {
+		t.Fatalf("copyAndVerify over a damaged copy: %v", err)
+	}
+	if !bytes.Equal(readBlob(t, dst, o.key), ct) {
+		t.Error("damaged copy was not replaced")
+	}
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	hlsSegmentSeconds = 6
+	hlsAudioKbps      = 128
+	hlsPlaylistName   = "index.m3u8"
+	hlsInitName       = "init.mp4"
+	// hlsQualityPrefix starts the video_variants quality of every HLS asset:
+	// "hls/<rendition>/<file name>", e.g. "hls/720p/seg_00003.m4s".
+	hlsQualityPrefix = "hls/"
+
+	// HLSPlaylistMimeType is the content type of master and media playlists.
+	HLSPlaylistMimeType = "application/vnd.apple.mpegurl"
+)
+
+// ErrHLSPending is returned while a video's HLS renditions are being encoded.
+var ErrHLSPending = errors.New("HLS renditions are being generated")
+
+// HLSRendition is one rung of the HLS bitrate ladder.
+type HLSRendition struct {
+	Name      string
+	Height    int
+	VideoKbps int
+}
+
+// Bandwidth returns the peak bits per second advertised for the rendition in
+// the master playlist, allowing 10% for container overhead.
+func (r HLSRendition) Bandwidth() int {
+	return (r.VideoKbps + hlsAudioKbps) * 1100
+}
+
+// hlsRenditions is the bitrate ladder, lowest first.
+var hlsRenditions = []HLSRendition{
+	{Name: "360p", Height: 360, VideoKbps: 800},
+	{Name: "720p", Height: 720, VideoKbps: 2800},
+	{Name: "1080p", Height: 1080, VideoKbps: 5000},
+}
+
+var hlsSegmentPattern = regexp.MustCompile(`^seg_\d{5}\.m4s$`)
+
+// HLSRenditionByName returns the ladder rendition called name.
+func HLSRenditionByName(name string) (HLSRendition, bool) {
+	for _, r := range hlsRenditions {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return HLSRendition{}, false
+}
+
+// ValidHLSAsset reports whether name is a file a rendition can contain: its
+// media playlist, its init segment or a media segment.
+func ValidHLSAsset(name string) bool {
+	return name == hlsPlaylistName || name == hlsInitName || hlsSegmentPattern.MatchString(name)
+}
+
+// HLSAssetMimeType returns the content type of a rendition file.
+func HLSAssetMimeType(name string) string {
+	switch {
+	case name == hlsPlaylistName:
+		return HLSPlaylistMimeType
+	case strings.HasSuffix(name, ".m4s"):
+		return "video/iso.segment"
+	default:
+		return "video/mp4"
+	}
+}
+
+// IsHLSPlaylist reports whether a rendition file is its media playlist.
+func IsHLSPlaylist(name string) bool {
+	return name == hlsPlaylistName
+}
+
+func hlsQuality(rendition, name string) string {
+	return hlsQualityPrefix + rendition + "/" + name
+}
+
+// isHLSQuality reports whether a variant quality label is an HLS asset.
+func isHLSQuality(quality string) bool {
+	return strings.HasPrefix(quality, hlsQualityPrefix)
+}
+
+// hlsLadder returns the renditions worth encoding for a source of the given
+// height: those no taller than the source, and always at least the lowest.
+// An unknown height (0) encodes the whole ladder.
+func hlsLadder(sourceHeight int) []HLSRendition {
+	if sourceHeight <= 0 {
+		return hlsRenditions
+	}
+	out := hlsRenditions[:1]
+	for _, r := range hlsRenditions[1:] {
+		if r.Height <= sourceHeight {
+			out = append(out[:len(out):len(out)], r)
+		}
+	}
+	return out
+}
+
+// ── Playlists ─────────────────────────────────────────────────────────────────
+
+// MasterPlaylist renders the master playlist for renditions. Each entry points
+// at the rendition's media playlist relative to the master URL, signed with
+// token so players that do not send cookies can follow it.
+func MasterPlaylist(renditions []HLSRendition, token string) []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,NAME=%q\n", r.Bandwidth(), r.Name)
+		fmt.Fprintf(&b, "%s/%s?token=%s\n", r.Name, hlsPlaylistName, url.QueryEscape(token))
+	}
+	return b.Bytes()
+}
+
+var hlsMapURI = regexp.MustCompile(`URI="([^"]*)"`)
+
+// SignHLSPlaylist appends ?token= to every URI of a stored media playlist:
+// the segment lines and the EXT-X-MAP init segment.
+func SignHLSPlaylist(playlist []byte, token string) []byte {
+	query := "?token=" + url.QueryEscape(token)
+	var b bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(playlist))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			line = hlsMapURI.ReplaceAllString(line, `URI="${1}`+query+`"`)
+		case !strings.HasPrefix(line, "#"):
+			line += query
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// ── File service ──────────────────────────────────────────────────────────────
+
+// HLSRenditions returns the renditions of a video that are ready to play,
+// lowest first. Returns ErrHLSPending while none is ready yet, and queues
+// encoding for videos uploaded before HLS existed. Returns ErrNotFound when
+// the file is not a video, FFmpeg is unavailable or encoding failed.
+func (s *FileService) HLSRenditions(ctx context.Context, file *models.File, username string) ([]HLSRendition, error) {
+	if !strings.HasPrefix(file.MimeType, "video/") || s.transcode == nil || !s.transcode.Available() {
+		return nil, ErrNotFound
+	}
+	variants, err := s.queries.ListVideoVariants(ctx, file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("hls renditions: %w", err)
+	}
+	ready := make(map[string]bool)
+	seen, pending := false, false
+	for _, v := range variants {
+		if !isHLSQuality(v.Quality) {
+			continue
+		}
+		seen = true
+		switch {
+		case v.Status == models.VideoVariantStatusPending:
+			pending = true
+		case v.Status == models.VideoVariantStatusReady && strings.HasSuffix(v.Quality, "/"+hlsPlaylistName):
+			ready[strings.TrimSuffix(strings.TrimPrefix(v.Quality, hlsQualityPrefix), "/"+hlsPlaylistName)] = true
+		}
+	}
+
+	var out []HLSRendition
+	for _, r := range hlsRenditions {
+		if ready[r.Name] {
+			out = append(out, r)
+		}
+	}
+	switch {
+	case len(out) > 0:
+		return out, nil
+	case pending:
+		return nil, ErrHLSPending
+	case !seen && s.jobs != nil:
+		// Queued at upload, or an older video: either way make sure a job exists.
+		if err := s.jobs.Enqueue(ctx, models.JobKindHLS, file.ID, file.UserID, username); err != nil {
+			return nil, fmt.Errorf("hls renditions: %w", err)
+		}
+		return nil, ErrHLSPending
+	}
+	return nil, ErrNotFound
+}
+
+// HLSAsset returns the decrypted contents of one file of a ready rendition.
+// Returns ErrNotFound when it does not exist or is not ready.
+func (s *FileService) HLSAsset(ctx context.Context, file *models.File, username, rendition, name string) ([]byte, error) {
+	v, err := s.queries.GetVideoVariant(ctx, file.ID, hlsQuality(rendition, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("hls asset: %w", err)
+	}
+	if v.Status != models.VideoVariantStatusReady {
+		return nil, ErrNotFound
+	}
+	return s.DownloadChunked(ctx, &models.File{
+		ID:             file.ID,
+		UserID:         file.UserID,
+		MimeType:       v.MimeType,
+		SizeBytes:      v.SizeBytes,
+		MinIOObjectKey: v.MinIOObjectKey,
+		Nonce:          []byte{}, // always chunked
+	}, username)
+}
+
+// runHLSJob encodes every rendition of the ladder that fits the source video
+// and stores each init segment, media segment and media playlist as an
+// encrypted variant. Renditions whose playlist is already ready (from an
+// earlier attempt) are skipped; the playlist is stored last, so a rendition
+// only becomes playable once all its segments are in place.
+func (s *FileService) runHLSJob(ctx context.Context, job *models.Job) error {
+	file, err := s.GetMetadata(ctx, job.FileID, job.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil // deleted since the job was queued
+	}
+	if err != nil {
+		return err
+	}
+	if s.transcode == nil || !s.transcode.Available() {
+		return permanentJobError(errors.New("ffmpeg not available"))
+	}
+
+	storage, _, err := s.storageFor(ctx, job.Username)
+	if err != nil {
+		return fmt.Errorf("storage lookup: %w", err)
+	}
+
+	var plaintext []byte
+	if IsChunked(file) {
+		plaintext, err = s.DownloadChunked(ctx, file, job.Username)
+	} else {
+		plaintext, err = s.decryptBlob(ctx, job.Username, file)
+	}
+	if err != nil {
+		return fmt.Errorf("download source: %w", err)
+	}
+	inPath, cleanup, err := extractToTempFile(plaintext, mimeToExt(file.MimeType))
+	plaintext = nil
+	if err != nil {
+		return fmt.Errorf("temp input: %w", err)
+	}
+	defer cleanup()
+
+	height, err := s.transcode.VideoHeight(ctx, inPath)
+	if err != nil {
+		log.Printf("hls: probe %s: %v (encoding the whole ladder)", file.ID, err)
+	}
+
+	userKey, err := s.userKey(ctx, job.Username)
+	if err != nil {
+		return fmt.Errorf("get user key: %w", err)
+	}
+	defer zeroBytes(userKey)
+
+	for _, r := range hlsLadder(height) {
+		if v, err := s.queries.GetVideoVariant(ctx, file.ID, hlsQuality(r.Name, hlsPlaylistName)); err == nil && v.Status == models.VideoVariantStatusReady {
+			continue
+		}
+		log.Printf("hls: start %s → %s (attempt %d)", file.ID, r.Name, job.Attempts)
+		if err := s.storeHLSRendition(ctx, file, job.Username, storage, userKey, inPath, r); err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+		log.Printf("hls: done %s → %s", file.ID, r.Name)
+		s.publishEvent(ctx, file.UserID, models.EventVariantReady, models.VariantReadyEvent{FileID: file.ID, Quality: hlsQualityPrefix + r.Name})
+	}
+	return nil
+}
+
+// storeHLSRendition encodes one rendition into a temp directory and uploads
+// its files, media playlist last.
+func (s *FileService) storeHLSRendition(ctx context.Context, file *models.File, username string, storage BlobStore, userKey []byte, inPath string, r HLSRendition) error {
+	dir, err := os.MkdirTemp("", "hls-*")
+	if err != nil {
+		return fmt.Errorf("create temp output: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := s.transcode.TranscodeToHLS(ctx, inPath, dir, r); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read output: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if ValidHLSAsset(e.Name()) && !IsHLSPlaylist(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	names = append(names, hlsPlaylistName)
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		quality := hlsQuality(r.Name, name)
+		v, err := s.queries.CreateVideoVariant(ctx, file.ID, quality, HLSAssetMimeType(name), objectKeyFor(file.UserID, uuid.New()))
+		if err != nil {
+			return fmt.Errorf("create record %s: %w", name, err)
+		}
+		ciphertext, err := s.enc.EncryptChunked(userKey, data)
+		if err != nil {
+			return fmt.Errorf("encrypt %s: %w", name, err)
+		}
+		key := v.MinIOObjectKey
+		if err := storage.PutObject(ctx, key, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream"); err != nil {
+			return fmt.Errorf("upload %s: %w", name, err)
+		}
+		if err := s.queries.MarkVideoVariantReady(ctx, file.ID, quality, int64(len(data))); err != nil {
+			_ = storage.RemoveObject(ctx, key)
+			return fmt.Errorf("mark ready %s: %w", name, err)
+		}
+		s.replicate(ctx, username, file.ID, key, func(dst BlobStore) error {
+			return dst.PutObject(ctx, key, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream")
+		})
+	}
+	return nil
+}
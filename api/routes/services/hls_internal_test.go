@@ -0,0 +1,69 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHLSLadder(t *testing.T) {
+	cases := []struct {
+		height int
+		want   string
+	}{
+		{0, "360p,720p,1080p"}, // unknown: encode everything
+		{240, "360p"},          // never below the lowest rung
+		{720, "360p,720p"},
+		{1080, "360p,720p,1080p"},
+		{2160, "360p,720p,1080p"},
+	}
+	for _, tc := range cases {
+		var names []string
+		for _, r := range hlsLadder(tc.height) {
+			names = append(names, r.Name)
+		}
+		if got := strings.Join(names, ","); got != tc.want {
+			t.Errorf("hlsLadder(%d) = %s, want %s", tc.height, got, tc.want)
+		}
+	}
+	if len(hlsRenditions) != 3 {
+		t.Fatalf("hlsLadder modified the ladder: %v", hlsRenditions)
+	}
+}
+
+func TestValidHLSAsset(t *testing.T) {
+	for name, want := range map[string]bool{
+		"index.m3u8":      true,
+		"init.mp4":        true,
+		"seg_00012.m4s":   true,
+		"seg_12.m4s":      false,
+		"../index.m3u8":   false,
+		"seg_00012.m4s.x": false,
+		"master.m3u8":     false,
+	} {
+		if got := ValidHLSAsset(name); got != want {
+			t.Errorf("ValidHLSAsset(%q) = %v", name, got)
+		}
+	}
+}
+
+func TestSignHLSPlaylist(t *testing.T) {
+	in := "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:6\n" +
+		"#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:6.000000,\nseg_00000.m4s\n" +
+		"#EXTINF:2.500000,\nseg_00001.m4s\n#EXT-X-ENDLIST\n"
+	want := "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:6\n" +
+		"#EXT-X-MAP:URI=\"init.mp4?token=a.b\"\n#EXTINF:6.000000,\nseg_00000.m4s?token=a.b\n" +
+		"#EXTINF:2.500000,\nseg_00001.m4s?token=a.b\n#EXT-X-ENDLIST\n"
+	if got := string(SignHLSPlaylist([]byte(in), "a.b")); got != want {
+		t.Errorf("SignHLSPlaylist:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMasterPlaylist(t *testing.T) {
+	got := string(MasterPlaylist(hlsRenditions[:2], "a.b"))
+	want := "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1020800,NAME=\"360p\"\n360p/index.m3u8?token=a.b\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=3220800,NAME=\"720p\"\n720p/index.m3u8?token=a.b\n"
+	if got != want {
+		t.Errorf("MasterPlaylist:\n%s\nwant:\n%s", got, want)
+	}
+}
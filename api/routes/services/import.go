@@ -0,0 +1,620 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/sanitize"
+)
+
+const (
+	// MaxImportArchiveBytes caps the size of an uploaded archive.
+	MaxImportArchiveBytes = 50 << 30
+	// MaxImportEntries caps the files and folders in one archive.
+	MaxImportEntries = 100_000
+	// maxImportRatio is how far an archive may expand beyond its own size.
+	// Real archives of photos and documents stay well below it; zip bombs
+	// are far above it.
+	maxImportRatio = 100
+	// importRatioFloor exempts small archives from the ratio check: a few
+	// highly compressible text files cost nothing to extract.
+	importRatioFloor = 64 << 20
+	// importPartSize is the largest entry uploaded from memory in one piece;
+	// larger entries go through the chunked upload pipeline in parts of this
+	// size, with up to importParallel parts in flight.
+	importPartSize = 8 * ChunkSize
+	importParallel = 2
+	// importWorkers bounds how many imports extract at once; the rest wait
+	// in the queued state.
+	importWorkers = 2
+	// maxImportFailures caps the per-entry failures kept for the status
+	// response. Further failures are only counted.
+	maxImportFailures = 1000
+	// importRetention is how long a finished import's status stays readable.
+	importRetention = 24 * time.Hour
+)
+
+// Import states.
+const (
+	ImportQueued  = "queued"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// Archive formats accepted for import.
+const (
+	importZip   = "zip"
+	importTar   = "tar"
+	importTarGz = "tar.gz"
+)
+
+var (
+	ErrImportFormat         = errors.New("archive must be a zip, tar or tar.gz file")
+	ErrImportTooLarge       = fmt.Errorf("archive is larger than %s", fmtBytes(MaxImportArchiveBytes))
+	ErrImportTooManyEntries = fmt.Errorf("archive has more than %d entries", MaxImportEntries)
+	ErrImportBomb           = errors.New("archive expands to far more than its own size")
+	ErrImportInProgress     = errors.New("an archive import is already running")
+	ErrImportInterrupted    = errors.New("upload interrupted — please retry")
+	ErrImportNotFound       = errors.New("import not found")
+)
+
+// ImportInput carries an uploaded archive and where to extract it.
+type ImportInput struct {
+	UserID   uuid.UUID
+	Username string
+	// FolderID is the folder the archive is extracted into. Nil means root.
+	FolderID *uuid.UUID
+	// Name is the archive's file name, shown in the import status.
+	Name   string
+	Reader io.Reader
+}
+
+// ImportFailure is one archive entry that could not be imported.
+type ImportFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ImportStatus is the progress of an archive import.
+type ImportStatus struct {
+	ID         uuid.UUID       `json:"id"`
+	Name       string          `json:"name"`
+	FolderID   *uuid.UUID      `json:"folder_id"`
+	Status     string          `json:"status"`
+	Entries    int             `json:"entries"`
+	TotalBytes int64           `json:"total_bytes"`
+	Processed  int             `json:"processed"`
+	Imported   int             `json:"imported"`
+	Failed     int             `json:"failed"`
+	Failures   []ImportFailure `json:"failures"`
+	// Error is set when the import stopped before reaching the last entry.
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// importJob is an accepted import and its spooled archive.
+type importJob struct {
+	userID   uuid.UUID
+	username string
+	spool    string
+	format   string
+
+	mu     sync.Mutex
+	status ImportStatus
+}
+
+func (j *importJob) snapshot() *ImportStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := j.status
+	st.Failures = append([]ImportFailure{}, j.status.Failures...)
+	return &st
+}
+
+func (j *importJob) update(fn func(st *ImportStatus)) {
+	j.mu.Lock()
+	fn(&j.status)
+	j.mu.Unlock()
+}
+
+func (j *importJob) fail(entry string, err error) {
+	j.update(func(st *ImportStatus) {
+		st.Processed++
+		st.Failed++
+		if len(st.Failures) < maxImportFailures {
+			st.Failures = append(st.Failures, ImportFailure{Path: entry, Error: err.Error()})
+		}
+	})
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// ImportService extracts uploaded zip and tar archives into a folder tree.
+// Folders are created through FolderService and every file is stored
+// through FileService exactly as an upload would be, so MIME detection,
+// media routing, metadata extraction and background jobs all apply.
+//
+// An archive is spooled to disk and checked before it is accepted; the
+// extraction itself runs in the background and is followed through Get.
+// Status lives in memory: an import interrupted by a restart stops where it
+// was, and its files so far stay in place.
+type ImportService struct {
+	queries *db.Queries
+	files   *FileService
+	folders *FolderService
+
+	slots   chan struct{}
+	active  sync.Map // uuid.UUID (user) → struct{}
+	imports sync.Map // uuid.UUID → *importJob
+}
+
+// NewImportService creates an ImportService and starts its cleanup loop.
+func NewImportService(q *db.Queries, files *FileService, folders *FolderService) *ImportService {
+	s := &ImportService{
+		queries: q,
+		files:   files,
+		folders: folders,
+		slots:   make(chan struct{}, importWorkers),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// Start spools in.Reader to disk, checks the archive and queues it for
+// extraction. Nothing is created before the checks pass:
+//   - the target folder must belong to the user (ErrFolderNotFound);
+//   - the archive must be a readable zip, tar or tar.gz (ErrImportFormat) of
+//     at most MaxImportArchiveBytes (ErrImportTooLarge) and MaxImportEntries
+//     entries (ErrImportTooManyEntries);
+//   - its contents must fit in the remaining quota (ErrQuotaExceeded) and not
+//     expand beyond maxImportRatio times its size (ErrImportBomb).
+//
+// A user runs one import at a time (ErrImportInProgress).
+func (s *ImportService) Start(ctx context.Context, in ImportInput) (*ImportStatus, error) {
+	if _, busy := s.active.LoadOrStore(in.UserID, struct{}{}); busy {
+		return nil, ErrImportInProgress
+	}
+	accepted := false
+	defer func() {
+		if !accepted {
+			s.active.Delete(in.UserID)
+		}
+	}()
+
+	if in.FolderID != nil {
+		if err := s.checkFolder(ctx, in.UserID, *in.FolderID); err != nil {
+			return nil, err
+		}
+	}
+	user, err := s.queries.GetUserByUsername(ctx, in.Username)
+	if err != nil {
+		return nil, fmt.Errorf("import: get user: %w", err)
+	}
+
+	tmp, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return nil, fmt.Errorf("import: create spool: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		if !accepted {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	size, err := io.Copy(tmp, io.LimitReader(in.Reader, MaxImportArchiveBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImportInterrupted, err)
+	}
+	if size > MaxImportArchiveBytes {
+		return nil, ErrImportTooLarge
+	}
+
+	format := detectArchiveFormat(tmp)
+	if format == "" {
+		return nil, ErrImportFormat
+	}
+	entries, total, err := scanArchive(tmp, format, size, user.StorageQuotaBytes-user.StorageUsedBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &importJob{
+		userID:   in.UserID,
+		username: in.Username,
+		spool:    tmp.Name(),
+		format:   format,
+		status: ImportStatus{
+			ID:         uuid.New(),
+			Name:       in.Name,
+			FolderID:   in.FolderID,
+			Status:     ImportQueued,
+			Entries:    entries,
+			TotalBytes: total,
+			Failures:   []ImportFailure{},
+			CreatedAt:  time.Now(),
+		},
+	}
+	s.imports.Store(job.status.ID, job)
+	accepted = true
+	go s.run(job)
+	return job.snapshot(), nil
+}
+
+// Get returns the status of an import started by userID. Returns
+// ErrImportNotFound when it does not exist, has been pruned or belongs to
+// someone else.
+func (s *ImportService) Get(id, userID uuid.UUID) (*ImportStatus, error) {
+	v, ok := s.imports.Load(id)
+	if !ok || v.(*importJob).userID != userID {
+		return nil, ErrImportNotFound
+	}
+	return v.(*importJob).snapshot(), nil
+}
+
+func (s *ImportService) checkFolder(ctx context.Context, userID, folderID uuid.UUID) error {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("import: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	f, err := q.GetFolderByID(ctx, folderID)
+	if err != nil || f.UserID != userID {
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			return ErrFolderNotFound
+		}
+		return fmt.Errorf("import: get folder: %w", err)
+	}
+	return nil
+}
+
+// run extracts an accepted import once a worker slot is free.
+func (s *ImportService) run(job *importJob) {
+	s.slots <- struct{}{}
+	defer func() {
+		<-s.slots
+		_ = os.Remove(job.spool)
+		s.active.Delete(job.userID)
+	}()
+	job.update(func(st *ImportStatus) { st.Status = ImportRunning })
+
+	ctx := context.Background()
+	err := s.extract(ctx, job)
+
+	now := time.Now()
+	job.update(func(st *ImportStatus) {
+		st.Status = ImportDone
+		if err != nil {
+			st.Status = ImportFailed
+			st.Error = err.Error()
+		}
+		st.FinishedAt = &now
+	})
+	st := job.snapshot()
+	log.Printf("import %s: user=%s status=%s imported=%d failed=%d", st.ID, job.username, st.Status, st.Imported, st.Failed)
+}
+
+func (s *ImportService) extract(ctx context.Context, job *importJob) error {
+	f, err := os.Open(job.spool)
+	if err != nil {
+		return fmt.Errorf("open spool: %w", err)
+	}
+	defer f.Close()
+
+	folders := make(map[string]*uuid.UUID)
+	return walkArchive(f, job.format, func(e importEntry) error {
+		segs, err := importPath(e.name)
+		switch {
+		case err != nil:
+			job.fail(e.name, err)
+		case len(segs) == 0 || segs[0] == "__MACOSX":
+			// Resource forks added by macOS; nothing a user put there.
+			job.update(func(st *ImportStatus) { st.Processed++ })
+		case e.dir:
+			if _, err := s.ensureFolder(ctx, job, folders, segs); err != nil {
+				job.fail(e.name, err)
+			} else {
+				job.update(func(st *ImportStatus) { st.Processed++ })
+			}
+		case !e.regular:
+			job.fail(e.name, errors.New("links and special files are not imported"))
+		default:
+			err := s.importFile(ctx, job, folders, segs, e)
+			if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrStorageUnavailable) {
+				// Every later entry would fail the same way.
+				return err
+			}
+			if err != nil {
+				job.fail(e.name, err)
+			} else {
+				job.update(func(st *ImportStatus) { st.Processed++; st.Imported++ })
+			}
+		}
+		return nil
+	})
+}
+
+// ensureFolder returns the folder for segs below the import's target,
+// creating missing folders and reusing existing ones of the same name.
+func (s *ImportService) ensureFolder(ctx context.Context, job *importJob, cache map[string]*uuid.UUID, segs []string) (*uuid.UUID, error) {
+	parent := job.status.FolderID
+	for i, name := range segs {
+		key := strings.Join(segs[:i+1], "/")
+		if id, ok := cache[key]; ok {
+			parent = id
+			continue
+		}
+		folder, err := s.folders.Create(ctx, job.userID, parent, name, "")
+		if errors.Is(err, ErrDuplicateFolderName) {
+			folder, err = s.findFolder(ctx, job.userID, parent, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent = &folder.ID
+		cache[key] = parent
+	}
+	return parent, nil
+}
+
+func (s *ImportService) findFolder(ctx context.Context, userID uuid.UUID, parentID *uuid.UUID, name string) (*models.Folder, error) {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("find folder: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	folder, err := q.FindFolderByParentAndName(ctx, userID, parentID, name)
+	if err != nil {
+		return nil, fmt.Errorf("find folder: %w", err)
+	}
+	return folder, nil
+}
+
+func (s *ImportService) importFile(ctx context.Context, job *importJob, folders map[string]*uuid.UUID, segs []string, e importEntry) error {
+	folderID, err := s.ensureFolder(ctx, job, folders, segs[:len(segs)-1])
+	if err != nil {
+		return err
+	}
+	rc, err := e.open()
+	if err != nil {
+		return fmt.Errorf("read entry: %w", err)
+	}
+	defer rc.Close()
+
+	name := segs[len(segs)-1]
+	in := UploadInput{
+		Username: job.username,
+		UserID:   job.userID,
+		FolderID: folderID,
+		Name:     name,
+		MimeType: mime.TypeByExtension(path.Ext(name)),
+		// The zip and tar readers both stop at the entry's recorded size,
+		// which is what the scan counted against the quota.
+		Reader: rc,
+	}
+	if e.size <= importPartSize {
+		_, err = s.files.Upload(ctx, in)
+	} else {
+		_, err = s.files.uploadSized(ctx, in, e.size)
+	}
+	return err
+}
+
+func (s *ImportService) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-importRetention)
+		s.imports.Range(func(k, v any) bool {
+			if st := v.(*importJob).snapshot(); st.FinishedAt != nil && st.FinishedAt.Before(cutoff) {
+				s.imports.Delete(k)
+			}
+			return true
+		})
+	}
+}
+
+// ── Sized uploads ─────────────────────────────────────────────────────────────
+
+// uploadSized stores exactly size bytes from in.Reader through the chunked
+// upload pipeline, holding at most importParallel parts in memory.
+func (s *FileService) uploadSized(ctx context.Context, in UploadInput, size int64) (*models.File, error) {
+	if err := s.CheckQuota(ctx, in.Username, size); err != nil {
+		return nil, err
+	}
+	totalChunks := int((size + importPartSize - 1) / importPartSize)
+	sess := newUploadSession(in.UserID, in.Username, in.Name, in.FolderID, totalChunks, size)
+	sess.ExactFolder = in.ExactFolder
+	if err := s.BeginChunkedUpload(ctx, sess); err != nil {
+		return nil, err
+	}
+
+	sem := make(chan struct{}, importParallel)
+	for i := range totalChunks {
+		sem <- struct{}{}
+		part := make([]byte, min(importPartSize, size-int64(i)*importPartSize))
+		if _, err := io.ReadFull(in.Reader, part); err != nil {
+			<-sem
+			_, _ = sess.Wait()
+			sess.Zero()
+			_ = sess.Storage.AbortMultipartUpload(ctx, sess.ObjectKey, sess.MinioUploadID)
+			return nil, fmt.Errorf("read entry: %w", err)
+		}
+		sess.DispatchChunk(i)
+		go func() {
+			defer func() { <-sem }()
+			s.EncryptAndUploadPart(ctx, sess, i, part)
+		}()
+	}
+	return s.FinalizeChunkedUpload(ctx, sess)
+}
+
+// ── Archive reading ───────────────────────────────────────────────────────────
+
+// importEntry is one member of an archive. open is only valid during the
+// walkArchive callback that received the entry.
+type importEntry struct {
+	name    string
+	size    int64
+	dir     bool
+	regular bool
+	open    func() (io.ReadCloser, error)
+}
+
+// detectArchiveFormat identifies an archive by its leading bytes.
+func detectArchiveFormat(r io.ReaderAt) string {
+	head := make([]byte, 262)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return importZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return importTarGz
+	case len(head) == 262 && string(head[257:262]) == "ustar":
+		return importTar
+	}
+	return ""
+}
+
+// scanArchive counts the entries and uncompressed bytes in an archive of
+// size bytes without extracting anything. A tar.gz has no index, so it is
+// decompressed, but the scan stops as soon as the contents outgrow
+// available.
+func scanArchive(f *os.File, format string, size, available int64) (entries int, total int64, err error) {
+	err = walkArchive(f, format, func(e importEntry) error {
+		entries++
+		if entries > MaxImportEntries {
+			return ErrImportTooManyEntries
+		}
+		if e.size < 0 {
+			return ErrImportFormat
+		}
+		total += e.size
+		if total > available {
+			return ErrQuotaExceeded
+		}
+		if total > importRatioFloor && total > size*maxImportRatio {
+			return ErrImportBomb
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		return entries, total, nil
+	case errors.Is(err, ErrImportTooManyEntries), errors.Is(err, ErrQuotaExceeded),
+		errors.Is(err, ErrImportBomb), errors.Is(err, ErrImportFormat):
+		return 0, 0, err
+	default:
+		// A damaged or mislabelled archive (e.g. a plain .gz).
+		return 0, 0, ErrImportFormat
+	}
+}
+
+// walkArchive calls fn for each entry of the archive in f, in archive order.
+func walkArchive(f *os.File, format string, fn func(importEntry) error) error {
+	if format == importZip {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return fmt.Errorf("read zip: %w", err)
+		}
+		for _, zf := range zr.File {
+			mode := zf.Mode()
+			if err := fn(importEntry{
+				name:    zf.Name,
+				size:    int64(zf.UncompressedSize64),
+				dir:     mode.IsDir() || strings.HasSuffix(zf.Name, "/"),
+				regular: mode.IsRegular(),
+				open:    zf.Open,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var r io.Reader = f
+	if format == importTarGz {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("read gzip: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		mode := hdr.FileInfo().Mode()
+		if err := fn(importEntry{
+			name:    hdr.Name,
+			size:    hdr.Size,
+			dir:     mode.IsDir(),
+			regular: mode.IsRegular(),
+			open:    func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// importPath splits an archive entry name into sanitized folder and file
+// names. Absolute names and names that climb out of the archive with ".."
+// are refused rather than cleaned, since either means the archive was not
+// made to be extracted where the user asked.
+func importPath(name string) ([]string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return nil, errors.New("absolute paths are not allowed")
+	}
+	var segs []string
+	for _, seg := range strings.Split(name, "/") {
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			return nil, errors.New("paths outside the archive are not allowed")
+		}
+		clean := sanitize.Name(seg, 255)
+		if clean == "" || clean == "." || clean == ".." {
+			return nil, errors.New("invalid file or folder name")
+		}
+		segs = append(segs, clean)
+	}
+	return segs, nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportPath(t *testing.T) {
+	ok := map[string][]string{
+		"Takeout/Google Photos/IMG_1.jpg": {"Takeout", "Google Photos", "IMG_1.jpg"},
+		"./docs//a.txt":                   {"docs", "a.txt"},
+		`win\style\path.txt`:              {"win", "style", "path.txt"},
+		"photos/":                         {"photos"},
+	}
+	for in, want := range ok {
+		got, err := importPath(in)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("importPath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"../etc/passwd", "a/../../b", "/etc/passwd", `C:\Windows\x`, `..\evil`, "a/ \n/b"} {
+		if got, err := importPath(in); err == nil {
+			t.Errorf("importPath(%q) = %q; want an error", in, got)
+		}
+	}
+}
+
+// spool writes b to a temp file for the archive readers.
+func spool(t *testing.T, b []byte) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "import-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzOf(t *testing.T, hdrs []*tar.Header, content map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, h := range hdrs {
+		h.Size = int64(len(content[h.Name]))
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(tw, content[h.Name])
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	return buf.Bytes()
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	var plain bytes.Buffer
+	tw := tar.NewWriter(&plain)
+	_ = tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0o644})
+	_ = tw.Close()
+
+	cases := map[string][]byte{
+		importZip:   zipOf(t, map[string]string{"a.txt": "hi"}),
+		importTarGz: tarGzOf(t, []*tar.Header{{Name: "a", Typeflag: tar.TypeReg}}, nil),
+		importTar:   plain.Bytes(),
+		"":          []byte("just some text that is not an archive"),
+	}
+	for want, b := range cases {
+		if got := detectArchiveFormat(bytes.NewReader(b)); got != want {
+			t.Errorf("detectArchiveFormat = %q; want %q", got, want)
+		}
+	}
+}
+
+func TestWalkArchive_TarGz(t *testing.T) {
+	f := spool(t, tarGzOf(t, []*tar.Header{
+		{Name: "pics/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "pics/a.jpg", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "pics/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+	}, map[string]string{"pics/a.jpg": "jpeg bytes"}))
+
+	var got []string
+	err := walkArchive(f, importTarGz, func(e importEntry) error {
+		kind := "other"
+		switch {
+		case e.dir:
+			kind = "dir"
+		case e.regular:
+			rc, _ := e.open()
+			b, _ := io.ReadAll(rc)
+			kind = "file:" + string(b)
+		}
+		got = append(got, e.name+"="+kind)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pics/=dir", "pics/a.jpg=file:jpeg bytes", "pics/link=other"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestScanArchive(t *testing.T) {
+	b := zipOf(t, map[string]string{"a.txt": "hello", "dir/b.txt": "world!"})
+	f := spool(t, b)
+	entries, total, err := scanArchive(f, importZip, int64(len(b)), 1<<20)
+	if err != nil || entries != 2 || total != 11 {
+		t.Errorf("scan = %d entries, %d bytes, %v; want 2, 11, nil", entries, total, err)
+	}
+	if _, _, err := scanArchive(f, importZip, int64(len(b)), 10); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("over quota: err = %v", err)
+	}
+
+	// 80 MiB of zeros deflates to well under 1 MiB.
+	bomb := zipOf(t, map[string]string{"zeros.bin": strings.Repeat("\x00", 80<<20)})
+	bf := spool(t, bomb)
+	if _, _, err := scanArchive(bf, importZip, int64(len(bomb)), 1<<40); !errors.Is(err, ErrImportBomb) {
+		t.Errorf("bomb: err = %v", err)
+	}
+
+	// A gzip stream that is not a tar.
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("not a tarball"))
+	_ = zw.Close()
+	if _, _, err := scanArchive(spool(t, gz.Bytes()), importTarGz, int64(gz.Len()), 1<<20); !errors.Is(err, ErrImportFormat) {
+		t.Errorf("plain gzip: err = %v", err)
+	}
+}
@@ -31,6 +31,14 @@ type InviteValidation struct {
 	GrantAdmin      bool      `json:"grant_admin"`
 }
 
+// InvitePlacement overrides where the invited user's drive allocation lands.
+// The zero value leaves placement to the default allocation policy; at most
+// one of DriveID and Policy may be set.
+type InvitePlacement struct {
+	DriveID *uuid.UUID `json:"allocation_drive_id"`
+	Policy  string     `json:"allocation_policy"`
+}
+
 // ── Service ───────────────────────────────────────────────────────────────────
 
 // InviteService creates, validates, lists, and revokes user invitations.
@@ -66,7 +74,11 @@ func NewInviteService(q *db.Queries, emailSvc *EmailService, appURL string, toke
 // invitedByUserID is the Keycloak sub UUID of the admin creating the invite.
 // invitedByUsername is used in the email copy ("X invited you to apollo-sfs").
 //
-// Returns ErrInviteAlreadyPending if a pending invite for this email already exists.
+// placement is checked now (the pinned drive must exist and be active, the
+// policy must be known) but capacity only at registration time.
+//
+// Returns ErrInviteAlreadyPending if a pending invite for this email already exists,
+// ErrInvalidInvitePlacement if placement is rejected.
 func (s *InviteService) Create(
 	ctx context.Context,
 	invitedByUserID uuid.UUID,
@@ -74,7 +86,12 @@ func (s *InviteService) Create(
 	email string,
 	initialQuotaBytes int64,
 	grantAdmin bool,
+	placement InvitePlacement,
 ) (*models.Invitation, error) {
+	if err := s.checkPlacement(ctx, placement); err != nil {
+		return nil, err
+	}
+
 	token, err := generateInviteToken()
 	if err != nil {
 		return nil, fmt.Errorf("create invitation: generate token: %w", err)
@@ -93,6 +110,10 @@ func (s *InviteService) Create(
 		TokenExpiresAt:    expiresAt,
 		InitialQuotaBytes: initialQuotaBytes,
 		GrantAdmin:        grantAdmin,
+		AllocationDriveID: placement.DriveID,
+	}
+	if placement.Policy != "" {
+		inv.AllocationPolicy = &placement.Policy
 	}
 
 	if err := s.queries.CreateInvitation(ctx, inv); err != nil {
@@ -241,8 +262,32 @@ func humanizeDuration(d time.Duration) string {
 	return fmt.Sprintf("%d hours", hours)
 }
 
+// checkPlacement validates an invitation's placement override.
+func (s *InviteService) checkPlacement(ctx context.Context, p InvitePlacement) error {
+	if p.DriveID != nil && p.Policy != "" {
+		return fmt.Errorf("%w: set either allocation_drive_id or allocation_policy, not both", ErrInvalidInvitePlacement)
+	}
+	if p.Policy != "" {
+		if _, err := AllocationPolicyByName(p.Policy); err != nil {
+			return fmt.Errorf("%w: allocation_policy must be one of %s",
+				ErrInvalidInvitePlacement, strings.Join(AllocationPolicyNames(), ", "))
+		}
+	}
+	if p.DriveID != nil {
+		d, err := s.queries.GetDrive(ctx, *p.DriveID)
+		if err != nil {
+			return fmt.Errorf("create invitation: %w", err)
+		}
+		if d == nil || !d.IsActive {
+			return fmt.Errorf("%w: allocation_drive_id must name an active drive", ErrInvalidInvitePlacement)
+		}
+	}
+	return nil
+}
+
 // ── Sentinel errors ───────────────────────────────────────────────────────────
 
 var ErrInviteNotFound = errors.New("invitation not found or already used")
 var ErrInviteExpired = errors.New("invitation link has expired")
 var ErrInviteAlreadyPending = errors.New("a pending invitation already exists for this email address")
+var ErrInvalidInvitePlacement = errors.New("invalid drive placement")
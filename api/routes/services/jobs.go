@@ -0,0 +1,495 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// jobPollInterval is how often an idle worker looks for due jobs. Enqueue
+	// wakes a worker straight away; polling picks up delayed retries.
+	jobPollInterval = 5 * time.Second
+	// jobRetryBase is the delay before the first retry; it doubles with every
+	// further attempt up to jobRetryMax.
+	jobRetryBase = 30 * time.Second
+	jobRetryMax  = 30 * time.Minute
+	// jobRetention is how long done jobs are kept before they are pruned.
+	jobRetention     = 7 * 24 * time.Hour
+	jobPruneInterval = time.Hour
+)
+
+var (
+	// ErrJobNotFound is returned for an unknown job ID.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotRetryable is returned when retrying a job that is not failed or cancelled.
+	ErrJobNotRetryable = errors.New("only failed or cancelled jobs can be retried")
+	// ErrJobDuplicate is returned when retrying a job whose file already has
+	// another unfinished job of the same kind.
+	ErrJobDuplicate = errors.New("the file already has an unfinished job of this kind")
+	// ErrJobFinished is returned when cancelling a job that is no longer queued or running.
+	ErrJobFinished = errors.New("job has already finished")
+	// ErrJobNoBackfill is returned when backfilling a kind of job that has no backfill.
+	ErrJobNoBackfill = errors.New("this kind of job cannot be backfilled")
+	// ErrJobBackfillRunning is returned when a backfill is already in progress.
+	ErrJobBackfillRunning = errors.New("a backfill is already in progress")
+)
+
+// JobHandler runs one kind of job.
+type JobHandler struct {
+	// Run does the work. It must be safe to run again after a failure or a
+	// crash part-way through. Errors wrapped with permanentJobError are not
+	// retried.
+	Run func(ctx context.Context, job *models.Job) error
+	// Abandon, when set, is called once a job will not run again because it
+	// failed for the last time or was cancelled. It should move anything the
+	// job would have completed (e.g. pending variant rows) to a final state.
+	Abandon func(ctx context.Context, job *models.Job)
+	// Backfill, when set, lists the files of userID that still need a job of
+	// this kind, so an admin can queue one for files stored before the kind
+	// existed. It runs outside any ForUser transaction.
+	Backfill func(ctx context.Context, userID uuid.UUID) ([]models.File, error)
+}
+
+// permanentError marks a job failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// permanentJobError wraps err so the job fails without further attempts.
+func permanentJobError(err error) error {
+	return permanentError{err: err}
+}
+
+// JobQueueStatus is the queue summary shown in the admin panel.
+type JobQueueStatus struct {
+	Workers int                     `json:"workers"`
+	Busy    int                     `json:"busy"`
+	Counts  []models.JobStatusCount `json:"counts"`
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// JobService runs background work on files from the Postgres jobs table with
+// a fixed pool of workers. Failed attempts are retried with exponential
+// backoff up to the job's max_attempts. Jobs interrupted by a restart are
+// requeued at startup, and pending variants that no job would complete are
+// given a new one.
+type JobService struct {
+	queries *db.Queries
+	workers int
+	// resolveUserID maps a username to the Keycloak UUID stored in files.user_id.
+	resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)
+
+	handlers map[string]JobHandler
+	wake     chan struct{}
+	busy     atomic.Int32
+
+	backfilling atomic.Bool
+
+	mu      sync.Mutex
+	cancels map[uuid.UUID]context.CancelFunc // running jobs in this process
+}
+
+// NewJobService constructs a JobService with the given number of workers
+// (at least one). Handlers must be registered before Start.
+func NewJobService(q *db.Queries, workers int, resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)) *JobService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &JobService{
+		queries:       q,
+		workers:       workers,
+		resolveUserID: resolveUserID,
+		handlers:      make(map[string]JobHandler),
+		wake:          make(chan struct{}, workers),
+		cancels:       make(map[uuid.UUID]context.CancelFunc),
+	}
+}
+
+// Register sets the handler for jobs of kind.
+func (s *JobService) Register(kind string, h JobHandler) {
+	s.handlers[kind] = h
+}
+
+// Start requeues interrupted jobs, recovers stranded variants, launches the
+// workers and prunes old done jobs until ctx is cancelled.
+func (s *JobService) Start(ctx context.Context) {
+	requeued, err := s.queries.RequeueInterruptedJobs(ctx)
+	if err != nil {
+		log.Printf("job queue: requeue interrupted jobs: %v", err)
+	}
+	s.recoverStranded(ctx)
+	log.Printf("job queue: started (%d worker(s), %d interrupted job(s) requeued)", s.workers, requeued)
+
+	for i := 0; i < s.workers; i++ {
+		go s.worker(ctx)
+	}
+
+	ticker := time.NewTicker(jobPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.queries.DeleteFinishedJobs(ctx, time.Now().Add(-jobRetention)); err != nil {
+				log.Printf("job queue: prune: %v", err)
+			} else if n > 0 {
+				log.Printf("job queue: pruned %d done job(s)", n)
+			}
+		}
+	}
+}
+
+// Enqueue queues a job of kind for a file. It is a no-op when the file
+// already has an unfinished job of that kind.
+func (s *JobService) Enqueue(ctx context.Context, kind string, fileID, userID uuid.UUID, username string) error {
+	added, err := s.queries.EnqueueJob(ctx, kind, fileID, userID, username)
+	if err != nil {
+		return err
+	}
+	if added {
+		s.notify()
+	}
+	return nil
+}
+
+// Summary returns the worker pool size and the number of jobs in each status.
+func (s *JobService) Summary(ctx context.Context) (JobQueueStatus, error) {
+	counts, err := s.queries.GetJobSummary(ctx)
+	if err != nil {
+		return JobQueueStatus{}, err
+	}
+	return JobQueueStatus{Workers: s.workers, Busy: int(s.busy.Load()), Counts: counts}, nil
+}
+
+// List returns a page of jobs, newest first, optionally filtered by status.
+func (s *JobService) List(ctx context.Context, status string, page db.PageInput) (*db.PageResult[models.Job], error) {
+	return s.queries.ListJobs(ctx, status, page)
+}
+
+// Retry queues a failed or cancelled job again with a fresh attempt budget.
+func (s *JobService) Retry(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	job, err := s.queries.RequeueJob(ctx, id)
+	if isDuplicateKeyError(err) {
+		return nil, ErrJobDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		existing, err := s.queries.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, ErrJobNotFound
+		}
+		return nil, ErrJobNotRetryable
+	}
+	s.notify()
+	return job, nil
+}
+
+// Cancel stops a queued or running job. A running job's context is
+// cancelled; its handler gives up at the next point it checks.
+func (s *JobService) Cancel(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	job, err := s.queries.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != models.JobQueued && job.Status != models.JobRunning {
+		return nil, ErrJobFinished
+	}
+	cancelled, err := s.queries.CancelJob(ctx, id, job.Status)
+	if err != nil {
+		return nil, err
+	}
+	if cancelled == nil {
+		return nil, ErrJobFinished
+	}
+
+	if job.Status == models.JobRunning {
+		// The worker sees the cancelled row when it finishes and abandons the job.
+		s.mu.Lock()
+		cancel := s.cancels[id]
+		s.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+	} else {
+		s.abandon(ctx, cancelled)
+	}
+	log.Printf("job queue: cancelled %s job %s for file %s", job.Kind, job.ID, job.FileID)
+	return cancelled, nil
+}
+
+// Backfill starts queueing a job of kind, in the background, for every file
+// its handler's Backfill lists. Files that already have an unfinished job of
+// kind are skipped. One backfill runs at a time.
+func (s *JobService) Backfill(kind string) error {
+	h, ok := s.handlers[kind]
+	if !ok || h.Backfill == nil || s.resolveUserID == nil {
+		return ErrJobNoBackfill
+	}
+	if !s.backfilling.CompareAndSwap(false, true) {
+		return ErrJobBackfillRunning
+	}
+	go func() {
+		defer s.backfilling.Store(false)
+		s.backfill(context.Background(), kind, h)
+	}()
+	return nil
+}
+
+// backfill walks every user and queues a job of kind for each file that
+// h.Backfill lists.
+func (s *JobService) backfill(ctx context.Context, kind string, h JobHandler) {
+	queued := 0
+	cursor := ""
+	for {
+		page, err := s.queries.ListUsers(ctx, db.PageInput{Cursor: cursor, Limit: db.MaxPageLimit})
+		if err != nil {
+			log.Printf("job queue: backfill %s: list users: %v", kind, err)
+			return
+		}
+		for _, u := range page.Items {
+			userID, err := s.resolveUserID(ctx, u.Username)
+			if err != nil {
+				log.Printf("job queue: backfill %s: user %q: %v", kind, u.Username, err)
+				continue
+			}
+			files, err := h.Backfill(ctx, userID)
+			if err != nil {
+				log.Printf("job queue: backfill %s: user %q: %v", kind, u.Username, err)
+				continue
+			}
+			for _, f := range files {
+				ok, err := s.queries.EnqueueJob(ctx, kind, f.ID, userID, u.Username)
+				if err != nil {
+					log.Printf("job queue: backfill %s for %s: %v", kind, f.ID, err)
+					continue
+				}
+				if ok {
+					queued++
+				}
+			}
+			if len(files) > 0 {
+				s.notify()
+			}
+		}
+		if page.NextToken == "" {
+			break
+		}
+		cursor = page.NextToken
+	}
+	log.Printf("job queue: backfill queued %d %s job(s)", queued, kind)
+}
+
+// ── Workers ───────────────────────────────────────────────────────────────────
+
+// notify wakes one idle worker, if any.
+func (s *JobService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *JobService) worker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		for s.runNext(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs one due job. Returns false when none was due.
+func (s *JobService) runNext(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	job, err := s.queries.ClaimJob(ctx)
+	if err != nil {
+		log.Printf("job queue: claim: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+	s.busy.Add(1)
+	defer s.busy.Add(-1)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancels[job.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.cancels, job.ID)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	s.finish(ctx, job, s.runHandler(jobCtx, job))
+	return true
+}
+
+// runHandler calls the job's handler, turning a panic into a permanent error.
+func (s *JobService) runHandler(ctx context.Context, job *models.Job) (err error) {
+	h, ok := s.handlers[job.Kind]
+	if !ok || h.Run == nil {
+		return permanentJobError(fmt.Errorf("no handler for job kind %q", job.Kind))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = permanentJobError(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	return h.Run(ctx, job)
+}
+
+// finish records the outcome of one attempt: done, queued again after a
+// backoff, or failed for good.
+func (s *JobService) finish(ctx context.Context, job *models.Job, runErr error) {
+	if runErr == nil {
+		if _, err := s.queries.FinishJob(ctx, job.ID, models.JobDone, nil); err != nil {
+			log.Printf("job queue: mark %s done: %v", job.ID, err)
+		}
+		return
+	}
+
+	msg := runErr.Error()
+	var perm permanentError
+	if !errors.As(runErr, &perm) && job.Attempts < job.MaxAttempts {
+		delay := jobRetryDelay(job.Attempts)
+		moved, err := s.queries.RescheduleJob(ctx, job.ID, msg, time.Now().Add(delay))
+		if err != nil {
+			// Still marked running: the next startup requeues it.
+			log.Printf("job queue: reschedule %s: %v", job.ID, err)
+			return
+		}
+		if moved {
+			log.Printf("job queue: %s job %s for file %s failed (attempt %d/%d), retrying in %s: %v",
+				job.Kind, job.ID, job.FileID, job.Attempts, job.MaxAttempts, delay, runErr)
+			return
+		}
+		// Not running any more: cancelled while this attempt ran.
+	} else if _, err := s.queries.FinishJob(ctx, job.ID, models.JobFailed, &msg); err != nil {
+		log.Printf("job queue: mark %s failed: %v", job.ID, err)
+	} else {
+		log.Printf("job queue: %s job %s for file %s failed after %d attempt(s): %v",
+			job.Kind, job.ID, job.FileID, job.Attempts, runErr)
+	}
+	s.abandon(ctx, job)
+}
+
+func (s *JobService) abandon(ctx context.Context, job *models.Job) {
+	if h, ok := s.handlers[job.Kind]; ok && h.Abandon != nil {
+		h.Abandon(ctx, job)
+	}
+}
+
+// jobRetryDelay returns the backoff before the retry that follows attempt.
+func jobRetryDelay(attempt int) time.Duration {
+	delay := jobRetryBase
+	for i := 1; i < attempt && delay < jobRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > jobRetryMax {
+		delay = jobRetryMax
+	}
+	return delay
+}
+
+// ── Recovery ──────────────────────────────────────────────────────────────────
+
+// recoverStranded queues a job for every pending variant that no unfinished
+// job would complete. Variants only record their file, so owners are found
+// by walking each user's files; the walk is skipped when nothing is stranded.
+func (s *JobService) recoverStranded(ctx context.Context) {
+	variants, err := s.queries.ListStrandedVariants(ctx)
+	if err != nil {
+		log.Printf("job queue: list stranded variants: %v", err)
+		return
+	}
+	if len(variants) == 0 || s.resolveUserID == nil {
+		return
+	}
+	kinds := make(map[uuid.UUID]map[string]bool)
+	for _, v := range variants {
+		if kinds[v.FileID] == nil {
+			kinds[v.FileID] = make(map[string]bool)
+		}
+		kinds[v.FileID][variantJobKind(v.Quality)] = true
+	}
+
+	queued := 0
+	cursor := ""
+	for len(kinds) > 0 {
+		page, err := s.queries.ListUsers(ctx, db.PageInput{Cursor: cursor, Limit: db.MaxPageLimit})
+		if err != nil {
+			log.Printf("job queue: recover stranded variants: list users: %v", err)
+			return
+		}
+		for _, u := range page.Items {
+			userID, err := s.resolveUserID(ctx, u.Username)
+			if err != nil {
+				log.Printf("job queue: recover stranded variants: user %q: %v", u.Username, err)
+				continue
+			}
+			files, err := listAllUserFiles(ctx, s.queries, userID)
+			if err != nil {
+				log.Printf("job queue: recover stranded variants: user %q: %v", u.Username, err)
+				continue
+			}
+			for _, f := range files {
+				for kind := range kinds[f.ID] {
+					if _, err := s.queries.EnqueueJob(ctx, kind, f.ID, userID, u.Username); err != nil {
+						log.Printf("job queue: recover %s for %s: %v", kind, f.ID, err)
+						continue
+					}
+					queued++
+				}
+				delete(kinds, f.ID)
+			}
+		}
+		if page.NextToken == "" {
+			break
+		}
+		cursor = page.NextToken
+	}
+	log.Printf("job queue: queued %d job(s) for %d stranded variant(s)", queued, len(variants))
+}
+
+// variantJobKind returns the kind of job that completes a variant.
+func variantJobKind(quality string) string {
+	if isThumbnailQuality(quality) {
+		return models.JobKindThumbnail
+	}
+	if isHLSQuality(quality) {
+		return models.JobKindHLS
+	}
+	return models.JobKindTranscode
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"apollo-sfs.com/api/models"
+)
+
+func TestJobRetryDelay(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{7, jobRetryMax},
+		{50, jobRetryMax},
+	}
+	for _, tc := range cases {
+		if got := jobRetryDelay(tc.attempt); got != tc.want {
+			t.Errorf("jobRetryDelay(%d) = %s, want %s", tc.attempt, got, tc.want)
+		}
+	}
+}
+
+func TestPermanentJobError(t *testing.T) {
+	cause := errors.New("no thumbnailer")
+	err := fmt.Errorf("render: %w", permanentJobError(cause))
+
+	var perm permanentError
+	if !errors.As(err, &perm) {
+		t.Error("wrapped permanent error not detected")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("permanent error does not unwrap to its cause")
+	}
+	if errors.As(errors.New("timeout"), &perm) {
+		t.Error("plain error detected as permanent")
+	}
+}
+
+func TestJobServiceRunHandler(t *testing.T) {
+	s := NewJobService(nil, 0, nil)
+	if s.workers != 1 {
+		t.Errorf("workers = %d, want at least 1", s.workers)
+	}
+	s.Register(models.JobKindThumbnail, JobHandler{Run: func(context.Context, *models.Job) error {
+		panic("boom")
+	}})
+
+	var perm permanentError
+	if err := s.runHandler(context.Background(), &models.Job{Kind: models.JobKindThumbnail}); !errors.As(err, &perm) {
+		t.Errorf("panic: got %v, want a permanent error", err)
+	}
+	if err := s.runHandler(context.Background(), &models.Job{Kind: models.JobKindTranscode}); !errors.As(err, &perm) {
+		t.Errorf("unregistered kind: got %v, want a permanent error", err)
+	}
+}
+
+func TestVariantJobKind(t *testing.T) {
+	for quality, want := range map[string]string{
+		LowQualityLabel:                     models.JobKindTranscode,
+		ThumbnailQuality(ThumbnailSmall):    models.JobKindThumbnail,
+		ThumbnailQuality(ThumbnailLarge):    models.JobKindThumbnail,
+		hlsQuality("720p", hlsPlaylistName): models.JobKindHLS,
+		hlsQuality("360p", "seg_00000.m4s"): models.JobKindHLS,
+	} {
+		if got := variantJobKind(quality); got != want {
+			t.Errorf("variantJobKind(%q) = %q, want %q", quality, got, want)
+		}
+	}
+}
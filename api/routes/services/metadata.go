@@ -3,18 +3,29 @@ package services
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rwcarlsen/goexif/exif"
+
+	"apollo-sfs.com/api/models"
 )
 
-// MetadataService extracts capture dates from media. Images are parsed in-process
-// via EXIF; videos are probed with ffprobe (part of the FFmpeg suite). If ffprobe
-// is not found, video extraction is a no-op and callers fall back to upload date.
+// MetadataService extracts capture dates and media metadata. Images are parsed
+// in-process via EXIF; videos are probed with ffprobe (part of the FFmpeg
+// suite). If ffprobe is not found, video extraction is a no-op and callers
+// fall back to upload date.
 type MetadataService struct {
 	ffprobePath string
 }
@@ -77,6 +88,360 @@ func (m *MetadataService) ExtractVideoTakenAt(ctx context.Context, path string)
 	return nil
 }
 
+// ExtractImageMetadata returns the pixel size of an image and what its EXIF
+// block records: orientation, camera, lens and GPS position. Returns nil when
+// neither the size nor any EXIF field could be read.
+func ExtractImageMetadata(data []byte) *models.MediaMetadata {
+	m := &models.MediaMetadata{}
+	found := false
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		m.Width, m.Height = &cfg.Width, &cfg.Height
+		found = true
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		if !found {
+			return nil
+		}
+		return m
+	}
+	if m.Width == nil {
+		m.Width, m.Height = exifInt(x, exif.PixelXDimension), exifInt(x, exif.PixelYDimension)
+	}
+	m.Orientation = exifInt(x, exif.Orientation)
+	m.CameraMake = exifString(x, exif.Make)
+	m.CameraModel = exifString(x, exif.Model)
+	m.LensModel = exifString(x, exif.LensModel)
+	if lat, long, err := x.LatLong(); err == nil && validLatLong(lat, long) {
+		m.Latitude, m.Longitude = &lat, &long
+		m.Altitude = exifAltitude(x)
+	}
+	if !found && m.Width == nil && m.Orientation == nil && m.CameraMake == nil &&
+		m.CameraModel == nil && m.LensModel == nil && !m.HasLocation() {
+		return nil
+	}
+	return m
+}
+
+func exifInt(x *exif.Exif, name exif.FieldName) *int {
+	tag, err := x.Get(name)
+	if err != nil {
+		return nil
+	}
+	v, err := tag.Int(0)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) *string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return nil
+	}
+	v, err := tag.StringVal()
+	if err != nil {
+		return nil
+	}
+	return nonEmpty(v)
+}
+
+// exifAltitude returns GPSAltitude in metres, negative below sea level.
+func exifAltitude(x *exif.Exif) *float64 {
+	tag, err := x.Get(exif.GPSAltitude)
+	if err != nil {
+		return nil
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return nil
+	}
+	alt := float64(num) / float64(den)
+	if ref := exifInt(x, exif.GPSAltitudeRef); ref != nil && *ref == 1 {
+		alt = -alt
+	}
+	return &alt
+}
+
+// ExtractVideoMetadata probes the video at path with ffprobe for its size,
+// rotation, duration, codecs, bitrate, recording device and location. Returns
+// nil when ffprobe is unavailable or cannot read the file.
+func (m *MetadataService) ExtractVideoMetadata(ctx context.Context, path string) *models.MediaMetadata {
+	if m.ffprobePath == "" {
+		return nil
+	}
+	out, err := exec.CommandContext(ctx, m.ffprobePath,
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	).Output()
+	if err != nil {
+		return nil
+	}
+	return parseVideoProbe(out)
+}
+
+// videoProbe is the part of ffprobe's -show_format -show_streams output that
+// parseVideoProbe reads.
+type videoProbe struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation *float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		Duration string            `json:"duration"`
+		BitRate  string            `json:"bit_rate"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+func parseVideoProbe(out []byte) *models.MediaMetadata {
+	var probe videoProbe
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil
+	}
+	m := &models.MediaMetadata{}
+	for _, st := range probe.Streams {
+		switch st.CodecType {
+		case "video":
+			if m.VideoCodec != nil {
+				continue
+			}
+			m.VideoCodec = nonEmpty(st.CodecName)
+			if st.Width > 0 && st.Height > 0 {
+				w, h := st.Width, st.Height
+				m.Width, m.Height = &w, &h
+			}
+			// The display matrix holds the counter-clockwise rotation; the
+			// legacy rotate tag the clockwise one.
+			rotation := 0
+			if r, err := strconv.Atoi(st.Tags["rotate"]); err == nil {
+				rotation = r
+			}
+			for _, sd := range st.SideDataList {
+				if sd.Rotation != nil {
+					rotation = -int(math.Round(*sd.Rotation))
+				}
+			}
+			m.Orientation = rotationOrientation(rotation)
+		case "audio":
+			if m.AudioCodec == nil {
+				m.AudioCodec = nonEmpty(st.CodecName)
+			}
+		}
+	}
+	if d, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil && d > 0 {
+		ms := int64(math.Round(d * 1000))
+		m.DurationMs = &ms
+	}
+	if b, err := strconv.ParseInt(probe.Format.BitRate, 10, 64); err == nil && b > 0 {
+		m.Bitrate = &b
+	}
+
+	tags := probe.Format.Tags
+	m.CameraMake = nonEmpty(firstTag(tags, "com.apple.quicktime.make", "make", "com.android.manufacturer"))
+	m.CameraModel = nonEmpty(firstTag(tags, "com.apple.quicktime.model", "model", "com.android.model"))
+	if lat, long, alt, ok := parseISO6709(firstTag(tags, "com.apple.quicktime.location.ISO6709", "location", "location-eng")); ok {
+		m.Latitude, m.Longitude, m.Altitude = &lat, &long, alt
+	}
+	if m.VideoCodec == nil && m.DurationMs == nil {
+		return nil
+	}
+	return m
+}
+
+// rotationOrientation maps a clockwise display rotation in degrees to the
+// equivalent EXIF orientation, so images and videos report it the same way.
+func rotationOrientation(degrees int) *int {
+	o := 1
+	switch ((degrees % 360) + 360) % 360 {
+	case 90:
+		o = 6
+	case 180:
+		o = 3
+	case 270:
+		o = 8
+	}
+	return &o
+}
+
+func firstTag(tags map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := strings.TrimSpace(tags[k]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var iso6709Pattern = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)?`)
+
+// parseISO6709 parses the decimal-degree form of an ISO 6709 location string
+// as written by phones into video containers, e.g. "+37.7749-122.4194+010.000/".
+func parseISO6709(s string) (lat, long float64, alt *float64, ok bool) {
+	mm := iso6709Pattern.FindStringSubmatch(strings.TrimSpace(s))
+	if mm == nil {
+		return 0, 0, nil, false
+	}
+	lat, _ = strconv.ParseFloat(mm[1], 64)
+	long, _ = strconv.ParseFloat(mm[2], 64)
+	if !validLatLong(lat, long) {
+		return 0, 0, nil, false
+	}
+	if mm[3] != "" {
+		a, _ := strconv.ParseFloat(mm[3], 64)
+		alt = &a
+	}
+	return lat, long, alt, true
+}
+
+func validLatLong(lat, long float64) bool {
+	return lat >= -90 && lat <= 90 && long >= -180 && long <= 180 && !(lat == 0 && long == 0)
+}
+
+func nonEmpty(s string) *string {
+	s = strings.TrimSpace(strings.Trim(s, "\x00"))
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// ── Location stripping ────────────────────────────────────────────────────────
+
+// StripJPEGLocation removes the GPS position from a JPEG: the entries of the
+// EXIF GPS IFD and the values they point to are zeroed in place, so every
+// other EXIF offset stays valid, and XMP packets carrying GPS fields are
+// dropped. Returns the rewritten image and whether anything was removed; data
+// itself is not modified.
+func StripJPEGLocation(data []byte) ([]byte, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data, false
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	changed := false
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + size
+		if size < 2 || end > len(data) {
+			break
+		}
+		seg := append([]byte(nil), data[pos:end]...)
+		if marker == 0xE1 {
+			payload := seg[4:]
+			switch {
+			case bytes.HasPrefix(payload, []byte("Exif\x00\x00")):
+				if blankGPSIFD(payload[6:]) {
+					changed = true
+				}
+			case bytes.HasPrefix(payload, []byte("http://ns.adobe.com/xap/1.0/")) && bytes.Contains(payload, []byte("GPS")):
+				changed = true
+				pos = end
+				continue
+			}
+		}
+		out = append(out, seg...)
+		pos = end
+	}
+	if !changed {
+		return data, false
+	}
+	return append(out, data[pos:]...), true
+}
+
+// blankGPSIFD zeroes the GPS IFD of the TIFF structure in tiff and reports
+// whether it had any entries. The GPS pointer in IFD0 is kept; it then points
+// at an empty directory.
+func blankGPSIFD(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+	ifd0 := int(order.Uint32(tiff[4:]))
+	if ifd0+2 > len(tiff) {
+		return false
+	}
+	gps := -1
+	n := int(order.Uint16(tiff[ifd0:]))
+	for i := 0; i < n; i++ {
+		e := ifd0 + 2 + 12*i
+		if e+12 > len(tiff) {
+			return false
+		}
+		if order.Uint16(tiff[e:]) == 0x8825 {
+			gps = int(order.Uint32(tiff[e+8:]))
+		}
+	}
+	if gps < 0 || gps+2 > len(tiff) {
+		return false
+	}
+	n = int(order.Uint16(tiff[gps:]))
+	if n == 0 {
+		return false
+	}
+	end := gps + 2 + 12*n
+	if end > len(tiff) {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		e := gps + 2 + 12*i
+		if size := tiffValueSize(order.Uint16(tiff[e+2:]), order.Uint32(tiff[e+4:])); size > 4 {
+			off := int(order.Uint32(tiff[e+8:]))
+			if off >= 0 && off+size <= len(tiff) {
+				clear(tiff[off : off+size])
+			}
+		}
+	}
+	// The entries, and the next-IFD offset when present.
+	clear(tiff[gps:min(end+4, len(tiff))])
+	return true
+}
+
+// tiffValueSize returns the byte size of count values of a TIFF field type.
+func tiffValueSize(typ uint16, count uint32) int {
+	var unit int
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		unit = 1
+	case 3, 8: // SHORT, SSHORT
+		unit = 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		unit = 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		unit = 8
+	default:
+		return 0
+	}
+	if count > 1<<24 {
+		return 0
+	}
+	return unit * int(count)
+}
+
 // extractToTempFile writes plaintext to a temp file so ffprobe can read it,
 // returning the path and a cleanup func. The caller must call cleanup.
 func extractToTempFile(plaintext []byte, ext string) (string, func(), error) {
@@ -92,3 +457,196 @@ func extractToTempFile(plaintext []byte, ext string) (string, func(), error) {
 	f.Close()
 	return f.Name(), func() { os.Remove(f.Name()) }, nil
 }
+
+// ── File service ──────────────────────────────────────────────────────────────
+
+// ErrLocationUnsupported is returned by StripLocation for files whose stored
+// content it cannot rewrite.
+var ErrLocationUnsupported = errors.New("location can only be removed from JPEG images and videos")
+
+// storeMediaMetadata saves m as the metadata of file, without the GPS
+// position when the owner turned location recording off.
+func (s *FileService) storeMediaMetadata(ctx context.Context, file *models.File, username string, m *models.MediaMetadata) error {
+	if m == nil {
+		return nil
+	}
+	m.FileID, m.UserID = file.ID, file.UserID
+	if m.HasLocation() {
+		prefs, err := s.queries.GetUserPreferences(ctx, username)
+		if err != nil {
+			return fmt.Errorf("store media metadata: %w", err)
+		}
+		if !prefs.RecordLocation {
+			m.ClearLocation()
+		}
+	}
+	if err := s.queries.UpsertMediaMetadata(ctx, m); err != nil {
+		return fmt.Errorf("store media metadata: %w", err)
+	}
+	return nil
+}
+
+// MediaMetadata returns the extracted metadata of a file, or nil when none
+// was extracted. The caller must have checked that the file is the user's.
+func (s *FileService) MediaMetadata(ctx context.Context, fileID uuid.UUID) (*models.MediaMetadata, error) {
+	m, err := s.queries.GetMediaMetadata(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("media metadata: %w", err)
+	}
+	return m, nil
+}
+
+// StripLocation removes the GPS position from a JPEG image or a video, both
+// from the stored file (so it can be shared without revealing where it was
+// taken) and from its media metadata. A video's variants are rendered again
+// from the stripped file. Files that carry no position are left
+// unchanged. Returns ErrNotFound when the file is not the user's and
+// ErrLocationUnsupported for other file types.
+func (s *FileService) StripLocation(ctx context.Context, fileID, userID uuid.UUID, username string) (*models.File, error) {
+	file, err := s.GetMetadata(ctx, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	isJPEG := file.MimeType == "image/jpeg"
+	isVideo := strings.HasPrefix(file.MimeType, "video/")
+	if !isJPEG && !(isVideo && s.transcode != nil && s.transcode.Available() && s.meta != nil) {
+		return nil, ErrLocationUnsupported
+	}
+
+	var plaintext []byte
+	if IsChunked(file) {
+		plaintext, err = s.DownloadChunked(ctx, file, username)
+	} else {
+		plaintext, err = s.decryptBlob(ctx, username, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("strip location: download: %w", err)
+	}
+
+	var stripped []byte
+	changed := false
+	if isJPEG {
+		stripped, changed = StripJPEGLocation(plaintext)
+	} else {
+		stripped, changed, err = s.stripVideoLocation(ctx, file, plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("strip location: %w", err)
+		}
+	}
+	if changed {
+		if file, err = s.replaceBlob(ctx, file, username, stripped); err != nil {
+			return nil, fmt.Errorf("strip location: %w", err)
+		}
+		if isVideo {
+			// Shares stream the 480p and HLS variants, which were encoded
+			// from the original and still carry its position.
+			s.dropVariants(ctx, username, file.ID)
+			s.enqueueJob(ctx, models.JobKindTranscode, file, username)
+			s.enqueueJob(ctx, models.JobKindHLS, file, username)
+			if s.thumbs != nil && s.thumbs.Supports(file.MimeType) {
+				s.enqueueJob(ctx, models.JobKindThumbnail, file, username)
+			}
+		}
+	}
+	if err := s.queries.ClearMediaLocation(ctx, file.ID); err != nil {
+		return nil, fmt.Errorf("strip location: %w", err)
+	}
+	return file, nil
+}
+
+// stripVideoLocation remuxes a video without its location tags when it has
+// any, and checks that the result no longer carries a position.
+func (s *FileService) stripVideoLocation(ctx context.Context, file *models.File, plaintext []byte) ([]byte, bool, error) {
+	ext := mimeToExt(file.MimeType)
+	in, cleanup, err := extractToTempFile(plaintext, ext)
+	if err != nil {
+		return nil, false, fmt.Errorf("temp input: %w", err)
+	}
+	defer cleanup()
+	if m := s.meta.ExtractVideoMetadata(ctx, in); m == nil || !m.HasLocation() {
+		return nil, false, nil
+	}
+
+	out := strings.TrimSuffix(in, "."+ext) + "-stripped." + ext
+	defer os.Remove(out)
+	if err := s.transcode.RemuxWithoutLocation(ctx, in, out); err != nil {
+		return nil, false, err
+	}
+	if m := s.meta.ExtractVideoMetadata(ctx, out); m == nil || m.HasLocation() {
+		return nil, false, errors.New("location still present after remux")
+	}
+	stripped, err := os.ReadFile(out)
+	if err != nil {
+		return nil, false, fmt.Errorf("read output: %w", err)
+	}
+	return stripped, true, nil
+}
+
+// replaceBlob stores plaintext as the new content of file under a fresh
+// object key, encrypted the same way as before, then removes the old blob
+// and its replica and adjusts the owner's storage total.
+func (s *FileService) replaceBlob(ctx context.Context, file *models.File, username string, plaintext []byte) (*models.File, error) {
+	userKey, err := s.userKey(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("get user key: %w", err)
+	}
+	defer zeroBytes(userKey)
+
+	var ciphertext, nonce []byte
+	if IsChunked(file) {
+		ciphertext, err = s.enc.EncryptChunked(userKey, plaintext)
+		nonce = []byte{}
+	} else {
+		ciphertext, nonce, err = s.enc.EncryptFile(userKey, plaintext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+
+	storage, driveID, err := s.storageFor(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	key := objectKeyFor(file.UserID, uuid.New())
+	if err := storage.PutObject(ctx, key, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream"); err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+
+	uq, utx, err := s.queries.ForUser(ctx, file.UserID)
+	if err != nil {
+		_ = storage.RemoveObject(ctx, key)
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = utx.Rollback() }()
+	err = s.checkDrive(ctx, uq, username, driveID)
+	var updated *models.File
+	if err == nil {
+		updated, err = uq.ReplaceFileBlob(ctx, &models.File{
+			ID:             file.ID,
+			DriveID:        &driveID,
+			MimeType:       file.MimeType,
+			SizeBytes:      int64(len(plaintext)),
+			MinIOObjectKey: key,
+			Nonce:          nonce,
+		})
+	}
+	if err == nil {
+		err = utx.Commit()
+	}
+	if err != nil {
+		_ = storage.RemoveObject(ctx, key)
+		return nil, fmt.Errorf("save metadata: %w", err)
+	}
+
+	s.replicate(ctx, username, file.ID, key, func(dst BlobStore) error {
+		return dst.PutObject(ctx, key, bytes.NewReader(ciphertext), int64(len(ciphertext)), "application/octet-stream")
+	})
+	s.removeReplacedBlob(ctx, username, file)
+
+	if delta := updated.SizeBytes - file.SizeBytes; delta != 0 {
+		if err := s.queries.AddStorageUsed(ctx, username, delta); err != nil {
+			return nil, fmt.Errorf("update storage: %w", err)
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// exifJPEG returns a 32×16 JPEG whose EXIF block names the camera, sets
+// orientation 6 and places it at 37°46'30"N 122°25'0"W.
+func exifJPEG(t *testing.T) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+	tiff := make([]byte, 158)
+	copy(tiff, "II")
+	le.PutUint16(tiff[2:], 42)
+	le.PutUint32(tiff[4:], 8)
+	entry := func(at int, tag, typ uint16, count, value uint32) {
+		le.PutUint16(tiff[at:], tag)
+		le.PutUint16(tiff[at+2:], typ)
+		le.PutUint32(tiff[at+4:], count)
+		le.PutUint32(tiff[at+8:], value)
+	}
+	rationals := func(at int, vals ...uint32) {
+		for i, v := range vals {
+			le.PutUint32(tiff[at+8*i:], v)
+			le.PutUint32(tiff[at+8*i+4:], 1)
+		}
+	}
+
+	// IFD0 at 8: Make, Orientation, GPS pointer; the Make string at 50.
+	le.PutUint16(tiff[8:], 3)
+	entry(10, 0x010F, 2, 6, 50)
+	entry(22, 0x0112, 3, 1, 6)
+	entry(34, 0x8825, 4, 1, 56)
+	copy(tiff[50:], "Canon\x00")
+
+	// GPS IFD at 56; the latitude and longitude rationals at 110 and 134.
+	le.PutUint16(tiff[56:], 4)
+	entry(58, 0x0001, 2, 2, uint32('N'))
+	entry(70, 0x0002, 5, 3, 110)
+	entry(82, 0x0003, 2, 2, uint32('W'))
+	entry(94, 0x0004, 5, 3, 134)
+	rationals(110, 37, 46, 30)
+	rationals(134, 122, 25, 0)
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 32, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(2+6+len(tiff)))
+	app1 = append(append(app1, "Exif\x00\x00"...), tiff...)
+
+	raw := img.Bytes()
+	return append(append(append([]byte{}, raw[:2]...), app1...), raw[2:]...)
+}
+
+func TestExtractImageMetadata(t *testing.T) {
+	m := ExtractImageMetadata(exifJPEG(t))
+	if m == nil {
+		t.Fatal("no metadata")
+	}
+	if m.Width == nil || *m.Width != 32 || m.Height == nil || *m.Height != 16 {
+		t.Errorf("size = %v×%v", m.Width, m.Height)
+	}
+	if m.Orientation == nil || *m.Orientation != 6 {
+		t.Errorf("orientation = %v", m.Orientation)
+	}
+	if m.CameraMake == nil || *m.CameraMake != "Canon" {
+		t.Errorf("make = %v", m.CameraMake)
+	}
+	if m.Latitude == nil || math.Abs(*m.Latitude-37.775) > 1e-6 ||
+		m.Longitude == nil || math.Abs(*m.Longitude+122.416667) > 1e-6 {
+		t.Errorf("position = %v, %v", m.Latitude, m.Longitude)
+	}
+
+	if ExtractImageMetadata([]byte("not an image")) != nil {
+		t.Error("expected nil for non-image bytes")
+	}
+}
+
+func TestStripJPEGLocation(t *testing.T) {
+	src := exifJPEG(t)
+	orig := append([]byte(nil), src...)
+
+	out, changed := StripJPEGLocation(src)
+	if !changed {
+		t.Fatal("expected the GPS block to be removed")
+	}
+	if !bytes.Equal(src, orig) {
+		t.Error("input was modified")
+	}
+	m := ExtractImageMetadata(out)
+	if m == nil || m.HasLocation() {
+		t.Fatalf("location survived: %+v", m)
+	}
+	if m.CameraMake == nil || *m.CameraMake != "Canon" || m.Orientation == nil || *m.Orientation != 6 {
+		t.Errorf("other EXIF fields lost: %+v", m)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stripped image no longer decodes: %v", err)
+	}
+
+	if _, changed := StripJPEGLocation(out); changed {
+		t.Error("second strip reported a change")
+	}
+	if _, changed := StripJPEGLocation([]byte("plain text")); changed {
+		t.Error("non-JPEG reported a change")
+	}
+}
+
+func TestParseISO6709(t *testing.T) {
+	lat, long, alt, ok := parseISO6709("+37.7749-122.4194+010.500/")
+	if !ok || lat != 37.7749 || long != -122.4194 || alt == nil || *alt != 10.5 {
+		t.Errorf("got %v %v %v %v", lat, long, alt, ok)
+	}
+	if _, _, alt, ok := parseISO6709("-33.8688+151.2093/"); !ok || alt != nil {
+		t.Errorf("without altitude: ok=%v alt=%v", ok, alt)
+	}
+	for _, bad := range []string{"", "garbage", "+95.0+10.0/", "+0.0+0.0/"} {
+		if _, _, _, ok := parseISO6709(bad); ok {
+			t.Errorf("parseISO6709(%q) accepted", bad)
+		}
+	}
+}
+
+func TestParseVideoProbe(t *testing.T) {
+	out := []byte(`{
+		"streams": [
+			{"codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080,
+			 "side_data_list": [{"rotation": -90}]},
+			{"codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {
+			"duration": "12.345600", "bit_rate": "8123456",
+			"tags": {
+				"com.apple.quicktime.make": "Apple",
+				"com.apple.quicktime.model": "iPhone 15",
+				"com.apple.quicktime.location.ISO6709": "+48.8584+002.2945+035.000/"
+			}
+		}
+	}`)
+	m := parseVideoProbe(out)
+	if m == nil {
+		t.Fatal("no metadata")
+	}
+	if *m.VideoCodec != "hevc" || *m.AudioCodec != "aac" || *m.Width != 1920 || *m.Height != 1080 {
+		t.Errorf("streams: %+v", m)
+	}
+	if *m.Orientation != 6 {
+		t.Errorf("orientation = %d, want 6 (rotate 90° clockwise)", *m.Orientation)
+	}
+	if *m.DurationMs != 12346 || *m.Bitrate != 8123456 {
+		t.Errorf("duration %d ms, bitrate %d", *m.DurationMs, *m.Bitrate)
+	}
+	if *m.CameraMake != "Apple" || *m.CameraModel != "iPhone 15" {
+		t.Errorf("device %q %q", *m.CameraMake, *m.CameraModel)
+	}
+	if *m.Latitude != 48.8584 || *m.Longitude != 2.2945 || *m.Altitude != 35 {
+		t.Errorf("position %v %v %v", *m.Latitude, *m.Longitude, *m.Altitude)
+	}
+
+	if parseVideoProbe([]byte(`{"streams": [], "format": {}}`)) != nil {
+		t.Error("expected nil for a probe without video")
+	}
+}
@@ -2,78 +2,373 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
 
 	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
 )
 
-// MinIORegistry maintains one *minio.Core client per server, loaded from the
+const (
+	serverHealthInterval = 30 * time.Second
+	serverProbeTimeout   = 5 * time.Second
+	serverSlowProbe      = 2 * time.Second  // a successful probe slower than this is "degraded"
+	serverDownAfter      = 3                // consecutive failed probes before a server is "down"
+	serverRedialInterval = 10 * time.Second // minimum gap between on-demand reconnect attempts
+	serverDownAlarmAfter = 5 * time.Minute  // how long a server must stay down before alarming
+)
+
+// ErrStorageUnavailable is returned when the MinIO server hosting a user's
+// drive is down, so requests for that user fail fast instead of timing out.
+var ErrStorageUnavailable = errors.New("storage server is unavailable")
+
+// registryEntry is the registry's view of one active server.
+type registryEntry struct {
+	server  models.Server  // credentials stay encrypted; decrypted on (re)connect
+	backend storageBackend // nil until a connection has been established
+	health  models.ServerHealth
+	probing bool
+}
+
+// MinIORegistry maintains one storage backend per server, loaded from the
 // database at startup. FileService uses it to route each operation to the
-// MinIO instance that hosts the user's drive.
+// server that hosts the user's drive. Despite the name, a server may be
+// MinIO, any other S3-compatible service or a local directory (see
+// models.Server.Backend).
+//
+// Each server is probed every serverHealthInterval (see Start). A server that
+// fails serverDownAfter probes in a row is "down": Client reports it as
+// unavailable, so only the users on that server are affected, and the first
+// request for it after serverRedialInterval triggers a background reconnect.
 type MinIORegistry struct {
 	mu      sync.RWMutex
-	clients map[uuid.UUID]*minio.Core
+	servers map[uuid.UUID]*registryEntry
 	kek     []byte // key-encryption key; stored so new servers can encrypt credentials
+	alarms  *AlarmService
 }
 
 // NewMinIORegistry loads all active servers from the DB, decrypts their
-// credentials using kek, and opens a client for each.
+// credentials using kek, opens a client for each and probes them once.
+// Servers that cannot be reached are logged and marked down rather than
+// failing startup.
 func NewMinIORegistry(ctx context.Context, queries *db.Queries, kek []byte) (*MinIORegistry, error) {
 	servers, err := queries.ListServers(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("minio registry: list servers: %w", err)
 	}
 
-	r := &MinIORegistry{clients: make(map[uuid.UUID]*minio.Core), kek: kek}
-	for _, s := range servers {
-		if !s.IsActive {
+	r := &MinIORegistry{servers: make(map[uuid.UUID]*registryEntry), kek: kek}
+	for i := range servers {
+		if !servers[i].IsActive {
 			continue
 		}
-		accessKey, err := DecryptMinIOSecret(kek, s.MinioAccessKeyEnc, s.MinioAccessKeyNonce)
-		if err != nil {
-			return nil, fmt.Errorf("minio registry: decrypt access key for server %s: %w", s.Name, err)
-		}
-		secretKey, err := DecryptMinIOSecret(kek, s.MinioSecretKeyEnc, s.MinioSecretKeyNonce)
-		if err != nil {
-			return nil, fmt.Errorf("minio registry: decrypt secret key for server %s: %w", s.Name, err)
-		}
-		client, err := NewMinIOClient(s.MinioEndpoint, accessKey, secretKey, s.MinioUseSSL)
-		if err != nil {
-			return nil, fmt.Errorf("minio registry: connect to server %s (%s): %w", s.Name, s.MinioEndpoint, err)
+		r.add(&servers[i])
+	}
+	r.checkAll(ctx)
+
+	// Without a history to go on, a server that misses its first probe is
+	// treated as down straight away so its users get a fast 503.
+	r.mu.Lock()
+	for _, e := range r.servers {
+		if e.health.State != models.ServerHealthHealthy && e.health.ConsecutiveFailures > 0 {
+			e.health.State = models.ServerHealthDown
+			if e.health.DownSince == nil {
+				e.health.DownSince = e.health.LastCheckedAt
+			}
+			log.Printf("minio registry: server %s (%s) is down; its users are unavailable until it recovers", e.server.Name, e.server.MinioEndpoint)
 		}
-		r.clients[s.ID] = client
 	}
+	r.mu.Unlock()
 	return r, nil
 }
 
-// Client returns the *minio.Core for the given server ID, or false if unknown.
-func (r *MinIORegistry) Client(serverID uuid.UUID) (*minio.Core, bool) {
+// SetAlarmService attaches the alarm service used to report servers that stay
+// down. Without one, outages are only logged.
+func (r *MinIORegistry) SetAlarmService(alarms *AlarmService) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alarms = alarms
+}
+
+// Start probes every registered server on a fixed interval until ctx is
+// cancelled.
+func (r *MinIORegistry) Start(ctx context.Context) {
+	log.Printf("minio registry: health checks started (every %s, down after %d failures)", serverHealthInterval, serverDownAfter)
+	ticker := time.NewTicker(serverHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkAll(ctx)
+			r.alarmDown(ctx)
+		}
+	}
+}
+
+// Store returns the BlobStore for bucket on the given server, or false if the
+// server is unknown or down. Asking for a down server schedules a reconnect.
+func (r *MinIORegistry) Store(serverID uuid.UUID, bucket string) (BlobStore, bool) {
+	b, ok := r.backend(serverID)
+	if !ok {
+		return nil, false
+	}
+	return b.Store(bucket), true
+}
+
+// EnsureBucket creates bucket on the given server if it does not exist yet
+// (a bucket for S3 backends, a directory for the filesystem backend).
+func (r *MinIORegistry) EnsureBucket(ctx context.Context, serverID uuid.UUID, bucket string) error {
+	b, ok := r.backend(serverID)
+	if !ok {
+		return ErrStorageUnavailable
+	}
+	return b.EnsureBucket(ctx, bucket)
+}
+
+func (r *MinIORegistry) backend(serverID uuid.UUID) (storageBackend, bool) {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
-	c, ok := r.clients[serverID]
-	return c, ok
+	e, ok := r.servers[serverID]
+	if !ok {
+		r.mu.RUnlock()
+		return nil, false
+	}
+	backend, state, probing := e.backend, e.health.State, e.probing
+	redial := e.health.LastCheckedAt == nil || time.Since(*e.health.LastCheckedAt) >= serverRedialInterval
+	r.mu.RUnlock()
+
+	if backend == nil || state == models.ServerHealthDown {
+		if !probing && redial {
+			go r.check(context.Background(), serverID)
+		}
+		return nil, false
+	}
+	return backend, true
 }
 
-// Register adds or replaces a client for a server (e.g. after adding a new
-// server at runtime via the admin UI).
-func (r *MinIORegistry) Register(serverID uuid.UUID, client *minio.Core) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.clients[serverID] = client
+// Register adds or replaces a server (e.g. after adding a new server or
+// re-activating one via the admin UI) and probes it before returning.
+func (r *MinIORegistry) Register(ctx context.Context, server *models.Server) {
+	r.add(server)
+	r.check(ctx, server.ID)
 }
 
 // Remove removes the client for a server (e.g. after deactivating it).
 func (r *MinIORegistry) Remove(serverID uuid.UUID) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	delete(r.clients, serverID)
+	delete(r.servers, serverID)
+}
+
+// Health returns the latest probe result for every registered server, ordered
+// by server name.
+func (r *MinIORegistry) Health() []models.ServerHealth {
+	r.mu.RLock()
+	out := make([]models.ServerHealth, 0, len(r.servers))
+	for _, e := range r.servers {
+		out = append(out, e.health)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ServerName < out[j].ServerName })
+	return out
 }
 
 // KEK returns the key-encryption key so admin handlers can encrypt new server credentials.
 func (r *MinIORegistry) KEK() []byte {
 	return r.kek
 }
+
+// ── Health checks ─────────────────────────────────────────────────────────────
+
+// add stores server with a fresh backend, or as down when none can be built.
+func (r *MinIORegistry) add(server *models.Server) {
+	e := &registryEntry{
+		server: *server,
+		health: models.ServerHealth{
+			ServerID:   server.ID,
+			ServerName: server.Name,
+			Endpoint:   server.MinioEndpoint,
+			State:      models.ServerHealthHealthy,
+		},
+	}
+	backend, err := r.connect(server)
+	if err != nil {
+		log.Printf("minio registry: %v", err)
+		now := time.Now().UTC()
+		e.health.State = models.ServerHealthDown
+		e.health.DownSince = &now
+		e.health.LastError = err.Error()
+	}
+	e.backend = backend
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.servers[server.ID] = e
+}
+
+// connect builds a new backend for s. For S3 backends it decrypts the
+// credentials; minio-go dials lazily, so this only fails on bad credentials
+// or a malformed endpoint.
+func (r *MinIORegistry) connect(s *models.Server) (storageBackend, error) {
+	switch s.Backend {
+	case models.ServerBackendFS:
+		return &fsBackend{root: s.MinioEndpoint}, nil
+	case models.ServerBackendMinIO, models.ServerBackendS3, "":
+	default:
+		return nil, fmt.Errorf("server %s: unknown storage backend %q", s.Name, s.Backend)
+	}
+	accessKey, err := DecryptMinIOSecret(r.kek, s.MinioAccessKeyEnc, s.MinioAccessKeyNonce)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt access key for server %s: %w", s.Name, err)
+	}
+	secretKey, err := DecryptMinIOSecret(r.kek, s.MinioSecretKeyEnc, s.MinioSecretKeyNonce)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt secret key for server %s: %w", s.Name, err)
+	}
+	client, err := NewS3Client(s.MinioEndpoint, s.Region, accessKey, secretKey, s.MinioUseSSL)
+	if err != nil {
+		return nil, fmt.Errorf("connect to server %s (%s): %w", s.Name, s.MinioEndpoint, err)
+	}
+	return &s3Backend{core: client}, nil
+}
+
+// checkAll probes every registered server concurrently.
+func (r *MinIORegistry) checkAll(ctx context.Context) {
+	r.mu.RLock()
+	ids := make([]uuid.UUID, 0, len(r.servers))
+	for id := range r.servers {
+		ids = append(ids, id)
+	}
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id uuid.UUID) {
+			defer wg.Done()
+			r.check(ctx, id)
+		}(id)
+	}
+	wg.Wait()
+}
+
+// check probes one server and records the outcome. A server that was down
+// gets a brand-new backend so no pooled connection to the old MinIO process
+// survives the reconnect; the swap only happens once the new one answers.
+func (r *MinIORegistry) check(ctx context.Context, serverID uuid.UUID) {
+	r.mu.Lock()
+	e, ok := r.servers[serverID]
+	if !ok || e.probing {
+		r.mu.Unlock()
+		return
+	}
+	e.probing = true
+	server, backend := e.server, e.backend
+	reconnect := backend == nil || e.health.State == models.ServerHealthDown
+	r.mu.Unlock()
+
+	var err error
+	if reconnect {
+		backend, err = r.connect(&server)
+	}
+	var latency time.Duration
+	if err == nil {
+		latency, err = probe(ctx, backend)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.servers[serverID] != e {
+		return // removed or replaced while probing
+	}
+	e.probing = false
+
+	now := time.Now().UTC()
+	h := &e.health
+	prev := h.State
+	h.LastCheckedAt = &now
+	h.LatencyMs = latency.Milliseconds()
+	if err == nil {
+		e.backend = backend
+		h.ConsecutiveFailures = 0
+		h.LastError = ""
+		h.LastHealthyAt = &now
+	} else {
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+	}
+	h.State = nextServerState(err == nil, latency, h.ConsecutiveFailures)
+	if e.backend == nil {
+		h.State = models.ServerHealthDown
+	}
+
+	switch {
+	case h.State == models.ServerHealthDown && h.DownSince == nil:
+		h.DownSince = &now
+	case h.State != models.ServerHealthDown:
+		h.DownSince = nil
+	}
+	if h.State != prev {
+		if err != nil {
+			log.Printf("minio registry: server %s (%s) %s → %s: %v", server.Name, server.MinioEndpoint, prev, h.State, err)
+		} else {
+			log.Printf("minio registry: server %s (%s) %s → %s (%dms)", server.Name, server.MinioEndpoint, prev, h.State, h.LatencyMs)
+		}
+	}
+}
+
+// alarmDown raises the "server_down" alarm for every server that has been
+// down for longer than serverDownAlarmAfter. The alarm cooldown keeps this
+// from re-sending on every tick.
+func (r *MinIORegistry) alarmDown(ctx context.Context) {
+	r.mu.RLock()
+	alarms := r.alarms
+	var down []models.ServerHealth
+	for _, e := range r.servers {
+		if e.health.DownSince != nil && time.Since(*e.health.DownSince) >= serverDownAlarmAfter {
+			down = append(down, e.health)
+		}
+	}
+	r.mu.RUnlock()
+
+	if alarms == nil {
+		return
+	}
+	for _, h := range down {
+		alarms.NotifyServerDown(ctx, h)
+	}
+}
+
+// probe runs one liveness check with a timeout and returns how long it took.
+func probe(ctx context.Context, b storageBackend) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, serverProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := b.Probe(ctx)
+	return time.Since(start), err
+}
+
+// nextServerState derives a server's health state from its latest probe and
+// the number of consecutive failed probes so far.
+func nextServerState(ok bool, latency time.Duration, failures int) string {
+	switch {
+	case ok && latency <= serverSlowProbe:
+		return models.ServerHealthHealthy
+	case ok:
+		return models.ServerHealthDegraded
+	case failures < serverDownAfter:
+		return models.ServerHealthDegraded
+	default:
+		return models.ServerHealthDown
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"apollo-sfs.com/api/models"
+)
+
+func TestNextServerState(t *testing.T) {
+	cases := []struct {
+		name     string
+		ok       bool
+		latency  time.Duration
+		failures int
+		want     string
+	}{
+		{"fast probe", true, 50 * time.Millisecond, 0, models.ServerHealthHealthy},
+		{"slow probe", true, serverSlowProbe + time.Millisecond, 0, models.ServerHealthDegraded},
+		{"first failure", false, 0, 1, models.ServerHealthDegraded},
+		{"just below threshold", false, 0, serverDownAfter - 1, models.ServerHealthDegraded},
+		{"at threshold", false, 0, serverDownAfter, models.ServerHealthDown},
+		{"well past threshold", false, 0, serverDownAfter + 10, models.ServerHealthDown},
+	}
+	for _, tc := range cases {
+		if got := nextServerState(tc.ok, tc.latency, tc.failures); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestServerAnswered(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", errors.New("dial tcp 10.0.0.5:9000: connect: connection refused"), false},
+		{"access denied", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, true},
+		{"server not initialised", minio.ErrorResponse{Code: "XMinioServerNotInitialized", StatusCode: http.StatusServiceUnavailable}, false},
+		{"internal error", minio.ErrorResponse{Code: "InternalError", StatusCode: http.StatusInternalServerError}, false},
+	}
+	for _, tc := range cases {
+		if got := serverAnswered(tc.err); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMinIORegistryStore_DownServer(t *testing.T) {
+	up, down, unknown := uuid.New(), uuid.New(), uuid.New()
+	backend := &fsBackend{root: t.TempDir()}
+	recent := time.Now().UTC()
+	r := &MinIORegistry{servers: map[uuid.UUID]*registryEntry{
+		up: {backend: backend, health: models.ServerHealth{ServerID: up, ServerName: "NH-0001", State: models.ServerHealthDegraded}},
+		// Probed just now, so Store must not schedule a reconnect.
+		down: {backend: backend, health: models.ServerHealth{ServerID: down, ServerName: "LOCAL-0001", State: models.ServerHealthDown, LastCheckedAt: &recent}},
+	}}
+
+	if s, ok := r.Store(up, "bucket"); !ok || s == nil {
+		t.Errorf("degraded server: expected a store, got %v/%v", s, ok)
+	}
+	if _, ok := r.Store(down, "bucket"); ok {
+		t.Error("down server: expected no store")
+	}
+	if _, ok := r.Store(unknown, "bucket"); ok {
+		t.Error("unknown server: expected no store")
+	}
+	if err := r.EnsureBucket(context.Background(), down, "bucket"); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("EnsureBucket on down server: got %v, want ErrStorageUnavailable", err)
+	}
+
+	health := r.Health()
+	if len(health) != 2 || health[0].ServerName != "LOCAL-0001" || health[1].ServerName != "NH-0001" {
+		t.Errorf("expected health sorted by name, got %+v", health)
+	}
+}
+
+func TestMinIORegistryCheck_Transitions(t *testing.T) {
+	id := uuid.New()
+	root := t.TempDir()
+	r := &MinIORegistry{servers: map[uuid.UUID]*registryEntry{}}
+	r.add(&models.Server{ID: id, Name: "LOCAL-0001", Backend: models.ServerBackendFS, MinioEndpoint: root})
+
+	ctx := context.Background()
+	r.check(ctx, id)
+	if h := r.Health()[0]; h.State != models.ServerHealthHealthy || h.LastHealthyAt == nil {
+		t.Fatalf("reachable root: got %+v", h)
+	}
+
+	// Point the server at a directory that does not exist.
+	r.servers[id].backend = &fsBackend{root: root + "/missing"}
+	for i := 1; i <= serverDownAfter; i++ {
+		r.check(ctx, id)
+	}
+	h := r.Health()[0]
+	if h.State != models.ServerHealthDown || h.DownSince == nil || h.ConsecutiveFailures != serverDownAfter {
+		t.Fatalf("after %d failures: got %+v", serverDownAfter, h)
+	}
+
+	// A down server is reconnected from its row, which still points at root.
+	r.check(ctx, id)
+	if h := r.Health()[0]; h.State != models.ServerHealthHealthy || h.DownSince != nil || h.ConsecutiveFailures != 0 {
+		t.Fatalf("after recovery: got %+v", h)
+	}
+}
@@ -17,6 +17,8 @@ const (
 	PresignActionPreview        = "preview"
 	PresignActionUpload         = "upload"
 	PresignActionUploadChunked  = "upload_chunked"
+	PresignActionHLS            = "hls"
+	PresignActionArchive        = "archive"
 )
 
 var (
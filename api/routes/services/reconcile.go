@@ -0,0 +1,575 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// reconcileGracePeriod hides objects and rows younger than this from the
+	// report. Uploads write the blob before the files row (and variant jobs
+	// write the row before the blob), so very recent entries are expected to
+	// be briefly one-sided.
+	reconcileGracePeriod = time.Hour
+	// QuarantinePrefix is the key prefix orphaned objects are moved under when
+	// reconciliation runs in quarantine mode. Objects below it are never listed
+	// as orphans themselves.
+	QuarantinePrefix = "quarantine/"
+)
+
+// Reconciliation modes.
+const (
+	ReconcileDryRun     = "dry_run"
+	ReconcileQuarantine = "quarantine"
+	ReconcileDelete     = "delete"
+)
+
+var (
+	// ErrReconcileRunning is returned by Trigger when a pass is already in progress.
+	ErrReconcileRunning = errors.New("reconciliation already running")
+	// ErrReconcileNoDryRun is returned when a quarantine or delete pass is
+	// requested without the ID of the most recent dry-run report.
+	ErrReconcileNoDryRun = errors.New("report_id does not match the latest dry run")
+)
+
+// OrphanObject is a MinIO object with no files, video_variants or
+// file_replicas row.
+type OrphanObject struct {
+	DriveID      uuid.UUID `json:"drive_id"`
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	SizeBytes    int64     `json:"size_bytes"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// OrphanRow is a files or video_variants row whose MinIO object is missing.
+type OrphanRow struct {
+	Kind      string     `json:"kind"` // "file" | "variant"
+	FileID    uuid.UUID  `json:"file_id"`
+	VariantID *uuid.UUID `json:"variant_id,omitempty"`
+	Username  string     `json:"username"`
+	DriveID   uuid.UUID  `json:"drive_id"`
+	Key       string     `json:"key"`
+	SizeBytes int64      `json:"size_bytes"`
+
+	userID uuid.UUID
+}
+
+// StorageDrift is a user whose users.storage_used_bytes disagrees with the
+// sum of their files rows. When the pass applies, ActualBytes is the total
+// that was written back.
+type StorageDrift struct {
+	Username      string `json:"username"`
+	RecordedBytes int64  `json:"recorded_bytes"`
+	ActualBytes   int64  `json:"actual_bytes"`
+}
+
+// ReconcileReport is the outcome of one reconciliation pass.
+type ReconcileReport struct {
+	ID             uuid.UUID      `json:"id"`
+	Mode           string         `json:"mode"`
+	DryRunID       *uuid.UUID     `json:"dry_run_id,omitempty"`
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     *time.Time     `json:"finished_at"`
+	DrivesScanned  int            `json:"drives_scanned"`
+	ObjectsScanned int64          `json:"objects_scanned"`
+	OrphanObjects  []OrphanObject `json:"orphan_objects"`
+	OrphanRows     []OrphanRow    `json:"orphan_rows"`
+	StorageDrift   []StorageDrift `json:"storage_drift"`
+	// Applied counts the orphans acted on in quarantine/delete mode.
+	Applied int      `json:"applied"`
+	Errors  []string `json:"errors"`
+}
+
+// ReconcileStatus is the admin-facing view of the reconciler.
+type ReconcileStatus struct {
+	Running bool             `json:"running"`
+	Report  *ReconcileReport `json:"report"`
+}
+
+// objectRef is one DB row that points at a MinIO object.
+type objectRef struct {
+	kind      string
+	fileID    uuid.UUID
+	variantID *uuid.UUID
+	userID    uuid.UUID
+	username  string
+	sizeBytes int64
+	createdAt time.Time
+	// expectObject is false for pending/failed variants, whose object may
+	// legitimately not exist yet (or ever).
+	expectObject bool
+}
+
+// reconcileDrive is one bucket to scan together with the rows that point into it.
+type reconcileDrive struct {
+	drive   models.Drive
+	storage BlobStore
+	refs    map[string]objectRef
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// ReconcileService diffs every drive's bucket against files.minio_object_key
+// and video_variants.minio_object_key. A dry run only reports; quarantine and
+// delete passes act on orphans that appeared in the referenced dry run and are
+// still orphaned, then rewrite users.storage_used_bytes from the rows left.
+type ReconcileService struct {
+	queries  *db.Queries
+	registry *MinIORegistry
+	// resolveUserID maps a username to the Keycloak UUID stored in files.user_id.
+	resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)
+
+	running    atomic.Bool
+	mu         sync.RWMutex
+	last       *ReconcileReport
+	lastDryRun *ReconcileReport
+}
+
+// NewReconcileService constructs a ReconcileService.
+func NewReconcileService(q *db.Queries, registry *MinIORegistry, resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)) *ReconcileService {
+	return &ReconcileService{queries: q, registry: registry, resolveUserID: resolveUserID}
+}
+
+// Status returns whether a pass is running and the most recent report.
+func (s *ReconcileService) Status() ReconcileStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ReconcileStatus{Running: s.running.Load(), Report: s.last}
+}
+
+// Trigger starts a pass in the background. mode is one of ReconcileDryRun,
+// ReconcileQuarantine or ReconcileDelete; the latter two require dryRunID to
+// be the ID of the most recent completed dry run.
+func (s *ReconcileService) Trigger(mode string, dryRunID uuid.UUID) error {
+	var approved *ReconcileReport
+	switch mode {
+	case ReconcileDryRun:
+	case ReconcileQuarantine, ReconcileDelete:
+		s.mu.RLock()
+		approved = s.lastDryRun
+		s.mu.RUnlock()
+		if approved == nil || approved.ID != dryRunID {
+			return ErrReconcileNoDryRun
+		}
+	default:
+		return fmt.Errorf("unknown reconcile mode %q", mode)
+	}
+
+	if !s.running.CompareAndSwap(false, true) {
+		return ErrReconcileRunning
+	}
+	report := &ReconcileReport{
+		ID:            uuid.New(),
+		Mode:          mode,
+		StartedAt:     time.Now().UTC(),
+		OrphanObjects: []OrphanObject{},
+		OrphanRows:    []OrphanRow{},
+		StorageDrift:  []StorageDrift{},
+		Errors:        []string{},
+	}
+	if approved != nil {
+		report.DryRunID = &approved.ID
+	}
+	s.mu.Lock()
+	s.last = report
+	s.mu.Unlock()
+
+	go func() {
+		defer s.running.Store(false)
+		s.run(context.Background(), report, approved)
+	}()
+	return nil
+}
+
+// ── Pass ──────────────────────────────────────────────────────────────────────
+
+func (s *ReconcileService) run(ctx context.Context, report *ReconcileReport, approved *ReconcileReport) {
+	log.Printf("reconcile: %s pass started", report.Mode)
+
+	// Each step appends to report under s.mu so Status() can be polled mid-pass.
+	addErr := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		log.Printf("reconcile: %s", msg)
+		s.mu.Lock()
+		report.Errors = append(report.Errors, msg)
+		s.mu.Unlock()
+	}
+
+	drives, err := s.loadDrives(ctx)
+	if err != nil {
+		addErr("load drives: %v", err)
+		s.finish(report)
+		return
+	}
+
+	// usedBytes is the per-user sum of files rows, keyed by username; recorded
+	// holds users.storage_used_bytes for the same users.
+	usedBytes := make(map[string]int64)
+	recorded := make(map[string]int64)
+	if err := s.collectRefs(ctx, drives, usedBytes, recorded, addErr); err != nil {
+		addErr("collect rows: %v", err)
+		s.finish(report)
+		return
+	}
+
+	cutoff := time.Now().Add(-reconcileGracePeriod)
+	for _, d := range drives {
+		if d.storage == nil {
+			if len(d.refs) > 0 {
+				addErr("drive %s (%s): no MinIO client; %d row(s) not checked", d.drive.Label, d.drive.ID, len(d.refs))
+			}
+			continue
+		}
+		// Replicas of blobs whose primary copy lives on another drive.
+		replicas, err := s.queries.ListDriveReplicaKeys(ctx, d.drive.ID)
+		if err != nil {
+			addErr("drive %s (%s): %v", d.drive.Label, d.drive.ID, err)
+			continue
+		}
+		present := make(map[string]struct{})
+		var orphans []OrphanObject
+		var scanned int64
+		err = d.storage.ListObjects(ctx, "", func(obj BlobInfo) error {
+			if strings.HasPrefix(obj.Key, QuarantinePrefix) {
+				return nil
+			}
+			scanned++
+			present[obj.Key] = struct{}{}
+			_, isReplica := replicas[obj.Key]
+			if _, ok := d.refs[obj.Key]; !ok && !isReplica && obj.LastModified.Before(cutoff) {
+				orphans = append(orphans, OrphanObject{
+					DriveID:      d.drive.ID,
+					Bucket:       d.drive.MinioBucket,
+					Key:          obj.Key,
+					SizeBytes:    obj.Size,
+					LastModified: obj.LastModified,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			// A partial listing would flag every unlisted row as orphaned.
+			addErr("drive %s (%s): %v", d.drive.Label, d.drive.ID, err)
+			continue
+		}
+		rows := missingRows(d.drive.ID, d.refs, present, cutoff)
+
+		s.mu.Lock()
+		report.DrivesScanned++
+		report.ObjectsScanned += scanned
+		report.OrphanObjects = append(report.OrphanObjects, orphans...)
+		report.OrphanRows = append(report.OrphanRows, rows...)
+		s.mu.Unlock()
+	}
+
+	s.mu.RLock()
+	clean := len(report.Errors) == 0
+	s.mu.RUnlock()
+	if approved != nil && !clean {
+		// Rows that could not be read make their objects look orphaned.
+		addErr("not applying: the scan was incomplete")
+		approved = nil
+	}
+	if approved != nil {
+		s.apply(ctx, drives, report, approved, usedBytes, addErr)
+	}
+
+	drift := storageDrift(usedBytes, recorded)
+	s.mu.Lock()
+	report.StorageDrift = drift
+	s.mu.Unlock()
+	if approved != nil {
+		for i, d := range drift {
+			// Recomputed from the rows as they are now: uploads and deletes
+			// since collectRefs have already moved the recorded total.
+			total, err := s.recomputeStorageUsed(ctx, d.Username)
+			if err != nil {
+				addErr("%v", err)
+				continue
+			}
+			s.mu.Lock()
+			report.StorageDrift[i].ActualBytes = total
+			s.mu.Unlock()
+		}
+	}
+
+	s.finish(report)
+}
+
+// finish stamps the report and, for dry runs, makes it the report that a
+// later quarantine/delete pass must reference.
+func (s *ReconcileService) finish(report *ReconcileReport) {
+	finished := time.Now().UTC()
+	s.mu.Lock()
+	report.FinishedAt = &finished
+	if report.Mode == ReconcileDryRun && len(report.Errors) == 0 {
+		s.lastDryRun = report
+	}
+	s.mu.Unlock()
+	log.Printf("reconcile: %s pass finished in %s — %d orphan object(s), %d orphan row(s), %d drifted user(s), %d applied",
+		report.Mode, finished.Sub(report.StartedAt).Round(time.Second),
+		len(report.OrphanObjects), len(report.OrphanRows), len(report.StorageDrift), report.Applied)
+}
+
+// loadDrives returns every drive keyed by ID. storage is nil for drives whose
+// server has no registered MinIO client (inactive or unreachable).
+func (s *ReconcileService) loadDrives(ctx context.Context) (map[uuid.UUID]*reconcileDrive, error) {
+	servers, err := s.queries.ListServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uuid.UUID]*reconcileDrive)
+	for _, srv := range servers {
+		drives, err := s.queries.ListDrives(ctx, srv.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range drives {
+			rd := &reconcileDrive{drive: d, refs: make(map[string]objectRef)}
+			if store, ok := s.registry.Store(srv.ID, d.MinioBucket); ok {
+				rd.storage = store
+			}
+			out[d.ID] = rd
+		}
+	}
+	return out, nil
+}
+
+// collectRefs walks every user's files and variants and files each object key
+// under the drive it should live on: files.drive_id when set, otherwise the
+// user's current allocation.
+func (s *ReconcileService) collectRefs(ctx context.Context, drives map[uuid.UUID]*reconcileDrive, usedBytes, recorded map[string]int64, addErr func(string, ...any)) error {
+	cursor := ""
+	for {
+		page, err := s.queries.ListUsers(ctx, db.PageInput{Cursor: cursor, Limit: db.MaxPageLimit})
+		if err != nil {
+			return err
+		}
+		for _, u := range page.Items {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			recorded[u.Username] = u.StorageUsedBytes
+			usedBytes[u.Username] = 0
+
+			userID, err := s.resolveUserID(ctx, u.Username)
+			if err != nil {
+				// Without the user's rows every object they own would look orphaned.
+				delete(recorded, u.Username)
+				addErr("user %q: resolve user id: %v", u.Username, err)
+				continue
+			}
+			files, err := listAllUserFiles(ctx, s.queries, userID)
+			if err != nil {
+				delete(recorded, u.Username)
+				addErr("user %q: list files: %v", u.Username, err)
+				continue
+			}
+			var allocDrive uuid.UUID
+			if len(files) > 0 {
+				alloc, err := s.queries.GetUserDrive(ctx, u.Username)
+				if err != nil {
+					addErr("user %q: %v", u.Username, err)
+				} else if alloc != nil {
+					allocDrive = alloc.DriveID
+				}
+			}
+
+			for _, f := range files {
+				usedBytes[u.Username] += f.SizeBytes
+				driveID := allocDrive
+				if f.DriveID != nil {
+					driveID = *f.DriveID
+				}
+				d, ok := drives[driveID]
+				if !ok {
+					addErr("file %s: drive %s not found; not checked", f.ID, driveID)
+					continue
+				}
+				d.refs[f.MinIOObjectKey] = objectRef{
+					kind:         "file",
+					fileID:       f.ID,
+					userID:       userID,
+					username:     u.Username,
+					sizeBytes:    f.SizeBytes,
+					createdAt:    f.CreatedAt,
+					expectObject: true,
+				}
+				variants, err := s.queries.ListVideoVariants(ctx, f.ID)
+				if err != nil {
+					addErr("file %s: list variants: %v", f.ID, err)
+					continue
+				}
+				for _, v := range variants {
+					variantID := v.ID
+					d.refs[v.MinIOObjectKey] = objectRef{
+						kind:         "variant",
+						fileID:       f.ID,
+						variantID:    &variantID,
+						userID:       userID,
+						username:     u.Username,
+						sizeBytes:    v.SizeBytes,
+						createdAt:    v.CreatedAt,
+						expectObject: v.Status == models.VideoVariantStatusReady,
+					}
+				}
+			}
+		}
+		if page.NextToken == "" {
+			return nil
+		}
+		cursor = page.NextToken
+	}
+}
+
+// apply acts on orphans present in both this pass and the approved dry run.
+// Orphan objects are quarantined or deleted according to report.Mode; orphan
+// rows are only removed in delete mode.
+func (s *ReconcileService) apply(ctx context.Context, drives map[uuid.UUID]*reconcileDrive, report, approved *ReconcileReport, usedBytes map[string]int64, addErr func(string, ...any)) {
+	approvedObjects := make(map[string]struct{}, len(approved.OrphanObjects))
+	for _, o := range approved.OrphanObjects {
+		approvedObjects[o.DriveID.String()+"/"+o.Key] = struct{}{}
+	}
+	approvedRows := make(map[string]struct{}, len(approved.OrphanRows))
+	for _, r := range approved.OrphanRows {
+		approvedRows[r.DriveID.String()+"/"+r.Key] = struct{}{}
+	}
+
+	applied := 0
+	for _, o := range report.OrphanObjects {
+		if _, ok := approvedObjects[o.DriveID.String()+"/"+o.Key]; !ok {
+			continue
+		}
+		storage := drives[o.DriveID].storage
+		if report.Mode == ReconcileQuarantine {
+			if err := storage.CopyObject(ctx, o.Key, QuarantinePrefix+o.Key); err != nil {
+				addErr("%v", err)
+				continue
+			}
+		}
+		if err := storage.RemoveObject(ctx, o.Key); err != nil {
+			addErr("%v", err)
+			continue
+		}
+		applied++
+	}
+
+	if report.Mode == ReconcileDelete {
+		for _, r := range report.OrphanRows {
+			if _, ok := approvedRows[r.DriveID.String()+"/"+r.Key]; !ok {
+				continue
+			}
+			if err := s.deleteRow(ctx, drives[r.DriveID], r); err != nil {
+				addErr("%v", err)
+				continue
+			}
+			if r.Kind == "file" {
+				usedBytes[r.Username] -= r.SizeBytes
+			}
+			applied++
+		}
+	}
+
+	s.mu.Lock()
+	report.Applied = applied
+	s.mu.Unlock()
+}
+
+// deleteRow removes an orphaned files or video_variants row. For files, the
+// blobs of any variants are removed first since their rows cascade.
+func (s *ReconcileService) deleteRow(ctx context.Context, d *reconcileDrive, r OrphanRow) error {
+	if r.Kind == "variant" {
+		return s.queries.DeleteVideoVariant(ctx, *r.VariantID)
+	}
+
+	if variants, err := s.queries.ListVideoVariants(ctx, r.FileID); err == nil && d.storage != nil {
+		for _, v := range variants {
+			_ = d.storage.RemoveObject(ctx, v.MinIOObjectKey)
+		}
+	}
+	q, tx, err := s.queries.ForUser(ctx, r.userID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := q.DeleteFile(ctx, r.FileID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recomputeStorageUsed resets the recorded total of username to the sum of
+// their files rows and returns it.
+func (s *ReconcileService) recomputeStorageUsed(ctx context.Context, username string) (int64, error) {
+	userID, err := s.resolveUserID(ctx, username)
+	if err != nil {
+		return 0, fmt.Errorf("user %q: resolve user id: %w", username, err)
+	}
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	total, err := q.RecomputeStorageUsed(ctx, username, userID)
+	if err != nil {
+		return 0, err
+	}
+	return total, tx.Commit()
+}
+
+// ── Diff helpers ──────────────────────────────────────────────────────────────
+
+// missingRows returns the refs that expect an object, are older than cutoff,
+// and whose key is not in present. Results are sorted by key.
+func missingRows(driveID uuid.UUID, refs map[string]objectRef, present map[string]struct{}, cutoff time.Time) []OrphanRow {
+	var out []OrphanRow
+	for key, ref := range refs {
+		if !ref.expectObject || ref.createdAt.After(cutoff) {
+			continue
+		}
+		if _, ok := present[key]; ok {
+			continue
+		}
+		out = append(out, OrphanRow{
+			Kind:      ref.kind,
+			FileID:    ref.fileID,
+			VariantID: ref.variantID,
+			Username:  ref.username,
+			DriveID:   driveID,
+			Key:       key,
+			SizeBytes: ref.sizeBytes,
+			userID:    ref.userID,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// storageDrift returns the users whose recorded total differs from the sum of
+// their files rows, sorted by username. Users missing from actual (their rows
+// could not be read) are skipped.
+func storageDrift(actual, recorded map[string]int64) []StorageDrift {
+	out := make([]StorageDrift, 0)
+	for username, rec := range recorded {
+		act, ok := actual[username]
+		if !ok || act == rec {
+			continue
+		}
+		out = append(out, StorageDrift{Username: username, RecordedBytes: rec, ActualBytes: act})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out
+}
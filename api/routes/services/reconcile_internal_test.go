@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMissingRows(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * reconcileGracePeriod)
+	cutoff := now.Add(-reconcileGracePeriod)
+	driveID := uuid.New()
+
+	refs := map[string]objectRef{
+		"u/present":         {kind: "file", createdAt: old, expectObject: true},
+		"u/missing":         {kind: "file", createdAt: old, expectObject: true, sizeBytes: 42},
+		"u/missing-new":     {kind: "file", createdAt: now, expectObject: true},
+		"u/pending-variant": {kind: "variant", createdAt: old, expectObject: false},
+		"u/ready-variant":   {kind: "variant", createdAt: old, expectObject: true},
+	}
+	present := map[string]struct{}{"u/present": {}}
+
+	got := missingRows(driveID, refs, present, cutoff)
+	want := []string{"u/missing", "u/ready-variant"}
+	if len(got) != len(want) {
+		t.Fatalf("missingRows returned %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i, key := range want {
+		if got[i].Key != key {
+			t.Errorf("row %d: key = %q, want %q", i, got[i].Key, key)
+		}
+		if got[i].DriveID != driveID {
+			t.Errorf("row %d: drive = %s, want %s", i, got[i].DriveID, driveID)
+		}
+	}
+	if got[0].SizeBytes != 42 {
+		t.Errorf("row 0: size = %d, want 42", got[0].SizeBytes)
+	}
+}
+
+func TestStorageDrift(t *testing.T) {
+	actual := map[string]int64{"alice": 100, "bob": 50, "carol": 0}
+	recorded := map[string]int64{"alice": 100, "bob": 70, "carol": 10, "dave": 5}
+
+	got := storageDrift(actual, recorded)
+	want := []StorageDrift{
+		{Username: "bob", RecordedBytes: 70, ActualBytes: 50},
+		{Username: "carol", RecordedBytes: 10, ActualBytes: 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("storageDrift returned %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
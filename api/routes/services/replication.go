@@ -0,0 +1,597 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+// replicationRepairInterval is how often the repair job walks replicated users.
+const replicationRepairInterval = time.Hour
+
+// ErrInvalidReplicationFactor is returned for a factor other than 1 or 2.
+var ErrInvalidReplicationFactor = errors.New("replication factor must be 1 or 2")
+
+// ReplicationConfig holds the tier defaults for users without an override.
+// A factor of 1 keeps a single copy; 2 adds a replica on a second drive.
+type ReplicationConfig struct {
+	DefaultFactor int
+	PremiumFactor int
+}
+
+// ReplicationStatus describes the current or most recent repair pass.
+type ReplicationStatus struct {
+	Running        bool       `json:"running"`
+	LastStartedAt  *time.Time `json:"last_started_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at"`
+	DefaultFactor  int        `json:"default_factor"`
+	PremiumFactor  int        `json:"premium_factor"`
+	// Counters for the current (or last) pass.
+	UsersChecked int    `json:"users_checked"`
+	Replicated   int64  `json:"replicated"`
+	Restored     int64  `json:"restored"`
+	Failed       int64  `json:"failed"`
+	LastError    string `json:"last_error,omitempty"`
+}
+
+// ── FileService replica I/O ───────────────────────────────────────────────────
+
+// replicate writes the second copy of key when username has a replica drive
+// and records the outcome in file_replicas. Failures are logged and left for
+// the repair job; they never fail the caller's write.
+func (s *FileService) replicate(ctx context.Context, username string, fileID uuid.UUID, key string, write func(dst BlobStore) error) {
+	replica, driveID, err := s.replicaFor(ctx, username)
+	if err != nil {
+		// No row is written; the repair job notices the missing replica.
+		log.Printf("replication: %s: %v", key, err)
+		return
+	}
+	if replica == nil {
+		return
+	}
+	r := &models.FileReplica{
+		MinIOObjectKey: key,
+		FileID:         fileID,
+		Username:       username,
+		DriveID:        driveID,
+		Status:         models.FileReplicaPending,
+	}
+	if err := s.queries.UpsertFileReplica(ctx, r); err != nil {
+		log.Printf("replication: %v", err)
+		return
+	}
+	if err := write(replica); err != nil {
+		log.Printf("replication: write %s: %v", key, err)
+		msg := err.Error()
+		r.Status, r.Error = models.FileReplicaFailed, &msg
+	} else {
+		r.Status = models.FileReplicaOK
+	}
+	if err := s.queries.UpsertFileReplica(ctx, r); err != nil {
+		log.Printf("replication: %v", err)
+	}
+}
+
+// replicateStored copies an object that is already on the primary drive to
+// the replica, authenticating the copy. Used for uploads whose ciphertext
+// was never held in memory as a whole.
+func (s *FileService) replicateStored(username string, fileID uuid.UUID, key string, nonce []byte) {
+	ctx := context.Background()
+	s.replicate(ctx, username, fileID, key, func(dst BlobStore) error {
+		src, _, err := s.storageFor(ctx, username)
+		if err != nil {
+			return err
+		}
+		userKey, err := s.userKey(ctx, username)
+		if err != nil {
+			return err
+		}
+		defer zeroBytes(userKey)
+		return copyReplica(ctx, src, dst, userKey, migrationObject{fileID: fileID, key: key, nonce: nonce})
+	})
+}
+
+// readObject reads the whole object at key from username's primary drive,
+// failing over to the replica when the primary cannot be read.
+func (s *FileService) readObject(ctx context.Context, username, key string) ([]byte, error) {
+	return s.readWithFailover(ctx, username, key, func(m BlobStore) (io.ReadCloser, error) {
+		return m.GetObject(ctx, key)
+	})
+}
+
+// readObjectRange reads bytes [start, end] of key, failing over to the
+// replica like readObject.
+func (s *FileService) readObjectRange(ctx context.Context, username, key string, start, end int64) ([]byte, error) {
+	return s.readWithFailover(ctx, username, key, func(m BlobStore) (io.ReadCloser, error) {
+		return m.GetObjectRange(ctx, key, start, end)
+	})
+}
+
+// readWithFailover reads through open on the primary drive and, if that
+// fails for any reason (no registry client, unreachable server, missing
+// object), on the replica. MinIO readers are lazy, so the body is read in
+// full before deciding. The primary's error is returned when both fail.
+func (s *FileService) readWithFailover(ctx context.Context, username, key string, open func(BlobStore) (io.ReadCloser, error)) ([]byte, error) {
+	storage, _, err := s.storageFor(ctx, username)
+	if err == nil {
+		var data []byte
+		if data, err = readAllFrom(storage, open); err == nil {
+			return data, nil
+		}
+	}
+	replica, rerr := s.readableReplica(ctx, username, key)
+	if rerr != nil {
+		log.Printf("replication: %s: %v", key, rerr)
+	}
+	if replica == nil {
+		return nil, err
+	}
+	data, rerr := readAllFrom(replica, open)
+	if rerr != nil {
+		log.Printf("replication: read %s from replica: %v", key, rerr)
+		return nil, err
+	}
+	log.Printf("replication: served %s from replica (primary: %v)", key, err)
+	return data, nil
+}
+
+// readableReplica returns the replica drive holding a usable copy of key, or
+// nil when there is none.
+func (s *FileService) readableReplica(ctx context.Context, username, key string) (BlobStore, error) {
+	r, err := s.queries.GetFileReplica(ctx, key)
+	if err != nil || r == nil || !replicaReadable(r.Status) {
+		return nil, err
+	}
+	replica, driveID, err := s.replicaFor(ctx, username)
+	if err != nil || replica == nil || driveID != r.DriveID {
+		return nil, err
+	}
+	return replica, nil
+}
+
+func readAllFrom(storage BlobStore, open func(BlobStore) (io.ReadCloser, error)) ([]byte, error) {
+	rc, err := open(storage)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// replicaReadable reports whether reads may fail over to a replica in status.
+func replicaReadable(status string) bool {
+	return status == models.FileReplicaOK || status == models.FileReplicaRestoring
+}
+
+// copyReplica copies o from src to dst and authenticates the copy. Unlike
+// copyAndVerify on its own, an object missing from src is an error: here the
+// source is the only good copy, not a file the user may have just deleted.
+func copyReplica(ctx context.Context, src, dst BlobStore, userKey []byte, o migrationObject) error {
+	if _, err := src.StatObject(ctx, o.key); err != nil {
+		return err
+	}
+	_, err := copyAndVerify(ctx, src, dst, userKey, o)
+	return err
+}
+
+// ── Repair service ────────────────────────────────────────────────────────────
+
+// ReplicationService keeps every user's replica in line with their
+// replication factor. Each pass allocates a replica drive for users who
+// need one (or whose replica drive is draining or retired), writes replicas
+// that are pending or failed, rebuilds primaries marked restoring after a
+// drive swap, and drops replicas of users back at factor 1.
+type ReplicationService struct {
+	queries  *db.Queries
+	files    *FileService
+	registry *MinIORegistry
+	cfg      ReplicationConfig
+	// resolveUserID maps a username to the Keycloak UUID stored in files.user_id.
+	resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)
+
+	running atomic.Bool
+	mu      sync.RWMutex
+	status  ReplicationStatus
+}
+
+// NewReplicationService constructs a ReplicationService. Factors outside
+// 1–2 are clamped.
+func NewReplicationService(q *db.Queries, files *FileService, registry *MinIORegistry, cfg ReplicationConfig, resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)) *ReplicationService {
+	cfg.DefaultFactor = clampReplicationFactor(cfg.DefaultFactor)
+	cfg.PremiumFactor = clampReplicationFactor(cfg.PremiumFactor)
+	return &ReplicationService{
+		queries:       q,
+		files:         files,
+		registry:      registry,
+		cfg:           cfg,
+		resolveUserID: resolveUserID,
+	}
+}
+
+// Start runs a repair pass every replicationRepairInterval until ctx is cancelled.
+func (s *ReplicationService) Start(ctx context.Context) {
+	log.Printf("replication service: started (default factor %d, premium factor %d, repair every %s)",
+		s.cfg.DefaultFactor, s.cfg.PremiumFactor, replicationRepairInterval)
+	ticker := time.NewTicker(replicationRepairInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runOnce(ctx)
+		}
+	}
+}
+
+// Trigger starts a repair pass in the background. Returns false when a pass
+// is already running.
+func (s *ReplicationService) Trigger() bool {
+	if !s.running.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer s.running.Store(false)
+		s.pass(context.Background())
+	}()
+	return true
+}
+
+// Status returns a snapshot of the current or most recent pass.
+func (s *ReplicationService) Status() ReplicationStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.status
+	st.Running = s.running.Load()
+	st.DefaultFactor = s.cfg.DefaultFactor
+	st.PremiumFactor = s.cfg.PremiumFactor
+	return st
+}
+
+// SetUserFactor sets username's replication override (nil follows the tier)
+// and starts a repair pass so the change takes effect.
+func (s *ReplicationService) SetUserFactor(ctx context.Context, username string, factor *int) error {
+	if factor != nil && (*factor < 1 || *factor > 2) {
+		return ErrInvalidReplicationFactor
+	}
+	if err := s.queries.SetUserReplicationFactor(ctx, username, factor); err != nil {
+		return err
+	}
+	s.Trigger()
+	return nil
+}
+
+// DriveReplaced records that driveID now holds an empty disk and starts a
+// repair pass: replicas it held are rewritten and primaries it held are
+// rebuilt from their replicas. Returns the number of objects queued for each.
+func (s *ReplicationService) DriveReplaced(ctx context.Context, driveID uuid.UUID) (replicas, primaries int64, err error) {
+	d, err := s.queries.GetDrive(ctx, driveID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if d == nil {
+		return 0, 0, ErrDriveNotFound
+	}
+	replicas, primaries, err = s.queries.MarkDriveReplaced(ctx, driveID)
+	if err != nil {
+		return 0, 0, err
+	}
+	log.Printf("replication: drive %s replaced — %d replica(s) to rewrite, %d primary object(s) to restore", d.Label, replicas, primaries)
+	s.Trigger()
+	return replicas, primaries, nil
+}
+
+// ── Pass ──────────────────────────────────────────────────────────────────────
+
+// runOnce runs one pass unless a manually triggered pass is already running.
+func (s *ReplicationService) runOnce(ctx context.Context) {
+	if !s.running.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.running.Store(false)
+	s.pass(ctx)
+}
+
+// pass repairs every user with a drive allocation. The caller holds the running flag.
+func (s *ReplicationService) pass(ctx context.Context) {
+	started := time.Now().UTC()
+	s.mu.Lock()
+	s.status = ReplicationStatus{LastStartedAt: &started}
+	s.mu.Unlock()
+
+	var passErr error
+	users, err := s.queries.ListReplicationUsers(ctx)
+	if err != nil {
+		passErr = fmt.Errorf("list users: %w", err)
+	}
+	for _, u := range users {
+		if ctx.Err() != nil {
+			passErr = ctx.Err()
+			break
+		}
+		if err := s.repairUser(ctx, u); err != nil {
+			log.Printf("replication: user %q: %v", u.Username, err)
+		}
+		s.mu.Lock()
+		s.status.UsersChecked++
+		s.mu.Unlock()
+	}
+
+	// Relocated replicas may have been all that kept a draining drive from
+	// being retired.
+	if draining, err := s.queries.ListDrivesByState(ctx, models.DriveStateDraining); err == nil {
+		for _, d := range draining {
+			if retired, err := s.queries.RetireDrive(ctx, d.ID); err == nil && retired {
+				log.Printf("replication: drive %s retired", d.Label)
+			}
+		}
+	}
+
+	finished := time.Now().UTC()
+	s.mu.Lock()
+	s.status.LastFinishedAt = &finished
+	if passErr != nil {
+		s.status.LastError = passErr.Error()
+	}
+	st := s.status
+	s.mu.Unlock()
+	log.Printf("replication: pass finished in %s — %d user(s), %d replicated, %d restored, %d failed",
+		finished.Sub(started).Round(time.Second), st.UsersChecked, st.Replicated, st.Restored, st.Failed)
+}
+
+// repairUser brings one user's replica in line with their factor. Users
+// with a migration under way are left to it until the next pass: u was read
+// before the migration may have moved their primary.
+func (s *ReplicationService) repairUser(ctx context.Context, u db.ReplicationUser) error {
+	if m, err := s.queries.GetLatestUserMigration(ctx, u.Username); err != nil {
+		return err
+	} else if m != nil && isUnfinishedMigration(m.Status) {
+		log.Printf("replication: %s skipped, migration %s is %s", u.Username, m.ID, m.Status)
+		return nil
+	}
+	if effectiveReplicationFactor(u, s.cfg) < 2 {
+		if u.ReplicaDriveID == nil {
+			return nil
+		}
+		return s.dropReplica(ctx, u)
+	}
+
+	userID, err := s.resolveUserID(ctx, u.Username)
+	if err != nil {
+		return fmt.Errorf("resolve user id: %w", err)
+	}
+
+	replicaDriveID := u.ReplicaDriveID
+	var oldDriveID *uuid.UUID
+	var oldKeys []string
+	if replicaDriveID == nil || !u.ReplicaUsable {
+		d, err := s.queries.SelectReplicaDrive(ctx, u.QuotaBytes, u.PrimaryDriveID)
+		if err != nil {
+			return fmt.Errorf("select replica drive: %w", err)
+		}
+		if replicaDriveID != nil {
+			// MoveUserReplicas repoints the rows, so note what the old
+			// drive holds first.
+			if oldKeys, err = s.replicaKeys(ctx, u.Username, *replicaDriveID); err != nil {
+				return err
+			}
+		}
+		if err := s.queries.AllocateUserReplica(ctx, u.Username, d.ID); err != nil {
+			return err
+		}
+		if err := s.queries.MoveUserReplicas(ctx, u.Username, d.ID); err != nil {
+			return err
+		}
+		s.files.forgetStorage(u.Username)
+		log.Printf("replication: %s replicated to drive %s", u.Username, d.Label)
+		oldDriveID, replicaDriveID = replicaDriveID, &d.ID
+	}
+
+	if err := s.syncUser(ctx, u.Username, userID, *replicaDriveID); err != nil {
+		return err
+	}
+	if oldDriveID != nil {
+		s.removeUserObjects(ctx, u.Username, userID, *oldDriveID, oldKeys)
+	}
+	return nil
+}
+
+// syncUser writes every missing, pending or failed replica of username and
+// restores primaries marked restoring.
+func (s *ReplicationService) syncUser(ctx context.Context, username string, userID, replicaDriveID uuid.UUID) error {
+	primary, _, err := s.files.storageFor(ctx, username)
+	if err != nil {
+		return err
+	}
+	replica, err := storageForDrive(ctx, s.queries, s.registry, replicaDriveID)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	objects, err := listUserObjects(ctx, s.queries, userID)
+	if err != nil {
+		return err
+	}
+	existing, err := s.queries.ListUserReplicas(ctx, username)
+	if err != nil {
+		return err
+	}
+	rows := make(map[string]models.FileReplica, len(existing))
+	for _, r := range existing {
+		rows[r.MinIOObjectKey] = r
+	}
+
+	userKey, err := s.files.userKey(ctx, username)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(userKey)
+
+	for _, o := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row, ok := rows[o.key]
+		if ok && row.DriveID == replicaDriveID && row.Status == models.FileReplicaOK {
+			continue
+		}
+		restore := ok && row.DriveID == replicaDriveID && row.Status == models.FileReplicaRestoring
+
+		var err error
+		if restore {
+			err = copyReplica(ctx, replica, primary, userKey, o)
+		} else {
+			err = copyReplica(ctx, primary, replica, userKey, o)
+		}
+		r := &models.FileReplica{
+			MinIOObjectKey: o.key,
+			FileID:         o.fileID,
+			Username:       username,
+			DriveID:        replicaDriveID,
+			Status:         models.FileReplicaOK,
+		}
+		s.mu.Lock()
+		switch {
+		case err != nil:
+			s.status.Failed++
+		case restore:
+			s.status.Restored++
+		default:
+			s.status.Replicated++
+		}
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("replication: %s: %v", o.key, err)
+			if restore {
+				// The replica is still the good copy; keep serving reads from it.
+				r.Status = models.FileReplicaRestoring
+			} else {
+				r.Status = models.FileReplicaFailed
+			}
+			msg := err.Error()
+			r.Error = &msg
+		}
+		if err := s.queries.UpsertFileReplica(ctx, r); err != nil {
+			log.Printf("replication: %v", err)
+		}
+	}
+	return nil
+}
+
+// dropReplica removes the replica of a user who is back at factor 1.
+func (s *ReplicationService) dropReplica(ctx context.Context, u db.ReplicationUser) error {
+	userID, err := s.resolveUserID(ctx, u.Username)
+	if err != nil {
+		return fmt.Errorf("resolve user id: %w", err)
+	}
+	keys, err := s.replicaKeys(ctx, u.Username, *u.ReplicaDriveID)
+	if err != nil {
+		return err
+	}
+	if err := s.queries.DeleteUserReplica(ctx, u.Username); err != nil {
+		return err
+	}
+	s.files.forgetStorage(u.Username)
+	s.removeUserObjects(ctx, u.Username, userID, *u.ReplicaDriveID, keys)
+	log.Printf("replication: %s no longer replicated", u.Username)
+	return nil
+}
+
+// replicaKeys returns the object keys of username's replica rows on driveID.
+func (s *ReplicationService) replicaKeys(ctx context.Context, username string, driveID uuid.UUID) ([]string, error) {
+	rows, err := s.queries.ListUserReplicas(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(rows))
+	for _, r := range rows {
+		if r.DriveID == driveID {
+			keys = append(keys, r.MinIOObjectKey)
+		}
+	}
+	return keys, nil
+}
+
+// removeUserObjects deletes keys, the replicas username had on a drive that
+// no longer holds their replica. Only recorded replica keys are deleted,
+// never a prefix, and only while the allocation is locked and still points
+// elsewhere: a migration may meanwhile have made the drive the user's
+// primary, keeping the replica copies as its own. Best-effort: anything left
+// behind is picked up by the orphan reconciler.
+func (s *ReplicationService) removeUserObjects(ctx context.Context, username string, userID, driveID uuid.UUID, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	storage, err := storageForDrive(ctx, s.queries, s.registry, driveID)
+	if err != nil {
+		log.Printf("replication: clean drive %s: %v", driveID, err)
+		return
+	}
+
+	// The allocation stays locked until the deletes are done, so a
+	// migration cannot flip the user onto the drive halfway through; its
+	// post-flip sweep copies back anything it had kept from here.
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		log.Printf("replication: clean drive %s: %v", driveID, err)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	primary, err := q.LockUserDrive(ctx, username)
+	if err != nil {
+		log.Printf("replication: clean drive %s: %v", driveID, err)
+		return
+	}
+	if primary == uuid.Nil || primary == driveID {
+		return
+	}
+	if m, err := q.GetLatestUserMigration(ctx, username); err != nil {
+		log.Printf("replication: clean drive %s: %v", driveID, err)
+		return
+	} else if m != nil && isUnfinishedMigration(m.Status) {
+		log.Printf("replication: %s: left drive %s alone, migration %s is %s", username, driveID, m.ID, m.Status)
+		return
+	}
+	if replica, err := q.GetUserReplicaDrive(ctx, username); err != nil {
+		log.Printf("replication: clean drive %s: %v", driveID, err)
+		return
+	} else if replica != nil && replica.DriveID == driveID {
+		return
+	}
+	for _, key := range keys {
+		if err := storage.RemoveObject(ctx, key); err != nil {
+			log.Printf("replication: clean drive %s: %v", driveID, err)
+		}
+	}
+}
+
+// effectiveReplicationFactor resolves a user's override against the tier defaults.
+func effectiveReplicationFactor(u db.ReplicationUser, cfg ReplicationConfig) int {
+	if u.Factor != nil {
+		return clampReplicationFactor(*u.Factor)
+	}
+	if u.IsPremium {
+		return cfg.PremiumFactor
+	}
+	return cfg.DefaultFactor
+}
+
+func clampReplicationFactor(f int) int {
+	switch {
+	case f < 1:
+		return 1
+	case f > 2:
+		return 2
+	}
+	return f
+}
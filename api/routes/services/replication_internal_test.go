@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+func TestEffectiveReplicationFactor(t *testing.T) {
+	one, two, five := 1, 2, 5
+	cfg := ReplicationConfig{DefaultFactor: 1, PremiumFactor: 2}
+	cases := []struct {
+		name string
+		user db.ReplicationUser
+		want int
+	}{
+		{"regular follows default", db.ReplicationUser{}, 1},
+		{"premium follows premium tier", db.ReplicationUser{IsPremium: true}, 2},
+		{"override beats default", db.ReplicationUser{Factor: &two}, 2},
+		{"override beats premium tier", db.ReplicationUser{IsPremium: true, Factor: &one}, 1},
+		{"override is clamped", db.ReplicationUser{Factor: &five}, 2},
+	}
+	for _, tc := range cases {
+		if got := effectiveReplicationFactor(tc.user, cfg); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestClampReplicationFactor(t *testing.T) {
+	cases := map[int]int{-1: 1, 0: 1, 1: 1, 2: 2, 3: 2}
+	for in, want := range cases {
+		if got := clampReplicationFactor(in); got != want {
+			t.Errorf("clampReplicationFactor(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestReplicaReadable(t *testing.T) {
+	cases := map[string]bool{
+		models.FileReplicaOK:        true,
+		models.FileReplicaRestoring: true,
+		models.FileReplicaPending:   false,
+		models.FileReplicaFailed:    false,
+	}
+	for status, want := range cases {
+		if got := replicaReadable(status); got != want {
+			t.Errorf("replicaReadable(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
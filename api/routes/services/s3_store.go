@@ -0,0 +1,245 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ── Client constructors ───────────────────────────────────────────────────────
+
+// NewMinIOClient creates a MinIO Core client (superset of the standard client
+// that also exposes low-level multipart upload APIs).
+// endpoint should be "host:port" (e.g. "minio:9000").
+// useSSL should be false on the internal Docker network (TLS terminated by Nginx).
+func NewMinIOClient(endpoint, accessKey, secretKey string, useSSL bool) (*minio.Core, error) {
+	return NewS3Client(endpoint, "", accessKey, secretKey, useSSL)
+}
+
+// NewS3Client creates a Core client for any S3-compatible service. region may
+// be empty for services that do not care (MinIO); providers such as AWS need
+// it to sign requests without an extra bucket-location round trip.
+func NewS3Client(endpoint, region, accessKey, secretKey string, useSSL bool) (*minio.Core, error) {
+	core, err := minio.NewCore(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: create client: %w", err)
+	}
+	return core, nil
+}
+
+// EnsureBucket creates the named bucket if it does not already exist.
+func EnsureBucket(ctx context.Context, client *minio.Core, bucket string) error {
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("s3: check bucket %q: %w", bucket, err)
+	}
+	if exists {
+		return nil
+	}
+	if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+		return fmt.Errorf("s3: create bucket %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// ── Backend ───────────────────────────────────────────────────────────────────
+
+// s3Backend serves "minio" and "s3" servers; each drive is a bucket.
+type s3Backend struct {
+	core *minio.Core
+}
+
+func (b *s3Backend) Store(bucket string) BlobStore {
+	return NewS3Store(b.core, bucket)
+}
+
+func (b *s3Backend) EnsureBucket(ctx context.Context, bucket string) error {
+	return EnsureBucket(ctx, b.core, bucket)
+}
+
+// Probe lists buckets as a liveness check. Any answer short of a server error
+// counts as alive: an access denied still proves the service is up.
+func (b *s3Backend) Probe(ctx context.Context) error {
+	if _, err := b.core.ListBuckets(ctx); err != nil && !serverAnswered(err) {
+		return err
+	}
+	return nil
+}
+
+// serverAnswered reports whether err is an S3 error response from a working
+// server rather than a transport failure or a 5xx.
+func serverAnswered(err error) bool {
+	code := minio.ToErrorResponse(err).StatusCode
+	return code != 0 && code < http.StatusInternalServerError
+}
+
+// ── S3Store ───────────────────────────────────────────────────────────────────
+
+// S3Store is the BlobStore for MinIO and other S3-compatible services. It
+// wraps a Core client and binds all operations to a single bucket.
+type S3Store struct {
+	core   *minio.Core
+	bucket string
+}
+
+var _ BlobStore = (*S3Store)(nil)
+
+// NewS3Store constructs an S3Store for the given bucket.
+func NewS3Store(client *minio.Core, bucket string) *S3Store {
+	return &S3Store{core: client, bucket: bucket}
+}
+
+// s3Err marks S3 "does not exist" responses with ErrBlobNotFound so callers
+// need not know which backend they are talking to.
+func s3Err(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %v", ErrBlobNotFound, err)
+	}
+	return err
+}
+
+// PutObject streams r into the bucket as a new object at key.
+func (s *S3Store) PutObject(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.core.Client.PutObject(ctx, s.bucket, key, r, size,
+		minio.PutObjectOptions{ContentType: contentType},
+	)
+	if err != nil {
+		return fmt.Errorf("s3: put %q: %w", key, err)
+	}
+	return nil
+}
+
+// GetObject returns a streaming reader for the object at key.
+// The caller must close the returned ReadCloser after reading. The request is
+// only sent on the first Read, so a missing key surfaces there.
+func (s *S3Store) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.core.Client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("s3: get %q: %w", key, s3Err(err))
+	}
+	return obj, nil
+}
+
+// GetObjectRange returns a streaming reader for [start, end] (inclusive).
+// The caller must close the returned ReadCloser after reading.
+func (s *S3Store) GetObjectRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(start, end); err != nil {
+		return nil, fmt.Errorf("s3: set range [%d-%d] on %q: %w", start, end, key, err)
+	}
+	obj, err := s.core.Client.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, fmt.Errorf("s3: get range [%d-%d] on %q: %w", start, end, key, s3Err(err))
+	}
+	return obj, nil
+}
+
+// RemoveObject deletes the object at key (idempotent).
+func (s *S3Store) RemoveObject(ctx context.Context, key string) error {
+	err := s.core.Client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("s3: remove %q: %w", key, err)
+	}
+	return nil
+}
+
+// StatObject returns metadata for the object at key without fetching its body.
+func (s *S3Store) StatObject(ctx context.Context, key string) (BlobInfo, error) {
+	info, err := s.core.Client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return BlobInfo{}, fmt.Errorf("s3: stat %q: %w", key, s3Err(err))
+	}
+	return BlobInfo{Key: info.Key, Size: info.Size, LastModified: info.LastModified}, nil
+}
+
+// CopyObject server-side copies the object at srcKey to dstKey within the bucket.
+func (s *S3Store) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	_, err := s.core.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey},
+	)
+	if err != nil {
+		return fmt.Errorf("s3: copy %q to %q: %w", srcKey, dstKey, s3Err(err))
+	}
+	return nil
+}
+
+// ListObjects calls fn for every object in the bucket whose key starts with
+// prefix ("" lists the whole bucket). Listing stops at the first error from
+// the server or fn.
+func (s *S3Store) ListObjects(ctx context.Context, prefix string, fn func(BlobInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the lister goroutine if fn returns early
+
+	for obj := range s.core.Client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("s3: list %q: %w", s.bucket, obj.Err)
+		}
+		if err := fn(BlobInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ── Multipart upload ──────────────────────────────────────────────────────────
+
+// CreateMultipartUpload initiates a server-side multipart upload and returns
+// the upload ID used to reference it in subsequent calls.
+func (s *S3Store) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	uploadID, err := s.core.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3: create multipart upload for %q: %w", key, err)
+	}
+	return uploadID, nil
+}
+
+// UploadPart uploads data as part partNumber (1-based) of the multipart upload
+// identified by uploadID. Returns the BlobPart needed to finalise the upload.
+func (s *S3Store) UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (BlobPart, error) {
+	part, err := s.core.PutObjectPart(
+		ctx, s.bucket, key, uploadID,
+		partNumber,
+		bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectPartOptions{},
+	)
+	if err != nil {
+		return BlobPart{}, fmt.Errorf("s3: upload part %d of %q: %w", partNumber, key, err)
+	}
+	return BlobPart{PartNumber: part.PartNumber, ETag: part.ETag}, nil
+}
+
+// CompleteMultipartUpload finalises a multipart upload. parts must be sorted
+// in ascending PartNumber order.
+func (s *S3Store) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []BlobPart) error {
+	complete := make([]minio.CompletePart, len(parts))
+	for i, p := range parts {
+		complete[i] = minio.CompletePart{PartNumber: p.PartNumber, ETag: p.ETag}
+	}
+	_, err := s.core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, complete, minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("s3: complete multipart upload for %q: %w", key, err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload cancels an in-progress multipart upload and removes any
+// uploaded parts. Call this whenever a chunked upload is abandoned or fails.
+func (s *S3Store) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	err := s.core.AbortMultipartUpload(ctx, s.bucket, key, uploadID)
+	if err != nil {
+		return fmt.Errorf("s3: abort multipart upload for %q: %w", key, err)
+	}
+	return nil
+}
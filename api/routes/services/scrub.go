@@ -0,0 +1,460 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	scrubInterval = 24 * time.Hour
+	// scrubRetryInterval is the longest Start sleeps before re-reading the
+	// schedule.
+	scrubRetryInterval = time.Hour
+	// scrubMaxBytesPerSec caps the read rate of a pass so a scrub never starves
+	// user traffic on the drive it is verifying.
+	scrubMaxBytesPerSec = 16 << 20
+)
+
+// errCorruptBlob marks a verification failure caused by the stored bytes
+// themselves (GCM tag mismatch, truncated chunk) rather than by I/O.
+var errCorruptBlob = errors.New("blob failed authentication")
+
+// ScrubStatus describes the current or most recent scrub pass.
+type ScrubStatus struct {
+	Running        bool       `json:"running"`
+	LastStartedAt  *time.Time `json:"last_started_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at"`
+	// Checked and Failed count the objects examined in the current (or last)
+	// pass. Failed excludes status "error", which reflects the check, not the blob.
+	Checked   int64  `json:"checked"`
+	Failed    int64  `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// scrubTarget is one MinIO object to verify: an original blob or a variant.
+type scrubTarget struct {
+	fileID    uuid.UUID
+	variantID *uuid.UUID
+	objectKey string
+	plainSize int64
+	nonce     []byte // empty → chunked mode
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// ScrubService periodically walks every files and video_variants row, checks
+// that the MinIO object exists with the size implied by its plaintext length,
+// and re-reads it to authenticate every AES-GCM tag. Results are upserted into
+// scrub_results and damaged or missing objects raise the "integrity" alarm.
+type ScrubService struct {
+	queries *db.Queries
+	files   *FileService
+	alarms  *AlarmService
+	// resolveUserID maps a username to the Keycloak UUID stored in files.user_id.
+	resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)
+
+	running atomic.Bool
+	mu      sync.RWMutex
+	status  ScrubStatus
+	// ctx is the context passed to Start; passes started through Trigger
+	// run on it.
+	ctx context.Context
+}
+
+// NewScrubService constructs a ScrubService. alarms may be nil (no alarm is raised).
+func NewScrubService(q *db.Queries, files *FileService, alarms *AlarmService, resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)) *ScrubService {
+	return &ScrubService{
+		queries:       q,
+		files:         files,
+		alarms:        alarms,
+		resolveUserID: resolveUserID,
+		ctx:           context.Background(),
+	}
+}
+
+// Start runs a scrub pass whenever scrubInterval has passed since the start
+// of the last finished pass, until ctx is cancelled. The schedule is read
+// from scrub_passes, so a restart neither delays the next pass nor keeps one
+// from ever running; with no finished pass on record, one runs straight away.
+// Passes started through Trigger are cancelled with ctx as well.
+func (s *ScrubService) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+	log.Printf("scrub service: started (every %s, throttle %d MiB/s)", scrubInterval, scrubMaxBytesPerSec>>20)
+
+	var wait time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = s.nextPassDelay(ctx)
+		if wait == 0 {
+			// Also covers a pass that could not run or be recorded: cool
+			// down instead of retrying in a tight loop.
+			s.runOnce(ctx)
+			wait = scrubRetryInterval
+		}
+	}
+}
+
+// nextPassDelay returns how long to wait before the next scheduled pass.
+// A failed lookup waits scrubRetryInterval rather than scrubbing blindly.
+func (s *ScrubService) nextPassDelay(ctx context.Context) time.Duration {
+	started, finished, err := s.queries.LastFinishedScrubPass(ctx)
+	if err != nil {
+		log.Printf("scrub service: %v", err)
+		return scrubRetryInterval
+	}
+	if finished.IsZero() {
+		return 0
+	}
+	// Report the recorded pass until one runs in this process.
+	s.mu.Lock()
+	if s.status.LastStartedAt == nil {
+		st, fin := started.UTC(), finished.UTC()
+		s.status.LastStartedAt, s.status.LastFinishedAt = &st, &fin
+	}
+	s.mu.Unlock()
+
+	delay := time.Until(started.Add(scrubInterval))
+	if delay < 0 {
+		return 0
+	}
+	// Sleeping a day at a time would miss a pass that Trigger finished in
+	// the meantime; wake at least hourly to re-read the schedule.
+	return min(delay, scrubRetryInterval)
+}
+
+// Trigger starts a scrub pass in the background. Returns false when a pass is
+// already running.
+func (s *ScrubService) Trigger() bool {
+	if !s.running.CompareAndSwap(false, true) {
+		return false
+	}
+	s.mu.RLock()
+	ctx := s.ctx
+	s.mu.RUnlock()
+	go func() {
+		defer s.running.Store(false)
+		s.pass(ctx)
+	}()
+	return true
+}
+
+// Status returns a snapshot of the current or most recent pass.
+func (s *ScrubService) Status() ScrubStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.status
+	st.Running = s.running.Load()
+	return st
+}
+
+// ── Pass ──────────────────────────────────────────────────────────────────────
+
+// runOnce runs one pass unless a manually triggered pass is already running.
+func (s *ScrubService) runOnce(ctx context.Context) {
+	if !s.running.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.running.Store(false)
+	s.pass(ctx)
+}
+
+// pass walks every user's files. The caller holds the running flag.
+func (s *ScrubService) pass(ctx context.Context) {
+	started := time.Now().UTC()
+	s.mu.Lock()
+	s.status = ScrubStatus{LastStartedAt: &started}
+	s.mu.Unlock()
+	log.Printf("scrub: pass started")
+	passID, err := s.queries.StartScrubPass(ctx)
+	if err != nil {
+		log.Printf("scrub: %v", err)
+	}
+
+	counts := make(map[string]int64)
+	var passErr error
+	cursor := ""
+	for {
+		page, err := s.queries.ListUsers(ctx, db.PageInput{Cursor: cursor, Limit: db.MaxPageLimit})
+		if err != nil {
+			passErr = fmt.Errorf("list users: %w", err)
+			break
+		}
+		for _, u := range page.Items {
+			if ctx.Err() != nil {
+				passErr = ctx.Err()
+				break
+			}
+			if err := s.scrubUser(ctx, u.Username, counts); err != nil {
+				log.Printf("scrub: user %q: %v", u.Username, err)
+			}
+		}
+		if passErr != nil || page.NextToken == "" {
+			break
+		}
+		cursor = page.NextToken
+	}
+
+	finished := time.Now().UTC()
+	failed := counts[models.ScrubStatusMissing] + counts[models.ScrubStatusSizeMismatch] + counts[models.ScrubStatusCorrupt]
+	s.mu.Lock()
+	s.status.LastFinishedAt = &finished
+	if passErr != nil {
+		s.status.LastError = passErr.Error()
+	}
+	s.mu.Unlock()
+
+	// A pass cut short by shutdown stays unfinished and runs again after boot.
+	if passID != uuid.Nil && ctx.Err() == nil {
+		var errMsg *string
+		if passErr != nil {
+			m := passErr.Error()
+			errMsg = &m
+		}
+		if err := s.queries.FinishScrubPass(ctx, passID, errMsg); err != nil {
+			log.Printf("scrub: %v", err)
+		}
+	}
+
+	log.Printf("scrub: pass finished in %s — ok=%d missing=%d size_mismatch=%d corrupt=%d error=%d",
+		finished.Sub(started).Round(time.Second),
+		counts[models.ScrubStatusOK], counts[models.ScrubStatusMissing],
+		counts[models.ScrubStatusSizeMismatch], counts[models.ScrubStatusCorrupt],
+		counts[models.ScrubStatusError])
+
+	if failed > 0 && s.alarms != nil {
+		s.alarms.NotifyIntegrityFailure(ctx, fmt.Sprintf(
+			"The integrity scrub found %d damaged or missing object(s): %d missing, %d with the wrong size, %d failing GCM authentication. See the integrity report in the admin panel.",
+			failed, counts[models.ScrubStatusMissing], counts[models.ScrubStatusSizeMismatch], counts[models.ScrubStatusCorrupt]))
+	}
+}
+
+// scrubUser verifies every original blob and ready variant owned by username.
+func (s *ScrubService) scrubUser(ctx context.Context, username string, counts map[string]int64) error {
+	userID, err := s.resolveUserID(ctx, username)
+	if err != nil {
+		return fmt.Errorf("resolve user id: %w", err)
+	}
+	files, err := listAllUserFiles(ctx, s.queries, userID)
+	if err != nil {
+		return fmt.Errorf("list files: %w", err)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	storage, _, err := s.files.storageFor(ctx, username)
+	if err != nil {
+		return err
+	}
+	userKey, err := s.files.userKey(ctx, username)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(userKey)
+
+	for _, f := range files {
+		targets := []scrubTarget{{
+			fileID:    f.ID,
+			objectKey: f.MinIOObjectKey,
+			plainSize: f.SizeBytes,
+			nonce:     f.Nonce,
+		}}
+		if variants, err := s.queries.ListVideoVariants(ctx, f.ID); err == nil {
+			for _, v := range variants {
+				if v.Status != models.VideoVariantStatusReady {
+					continue
+				}
+				targets = append(targets, scrubTarget{
+					fileID:    f.ID,
+					variantID: &v.ID,
+					objectKey: v.MinIOObjectKey,
+					plainSize: v.SizeBytes,
+				})
+			}
+		}
+
+		for _, t := range targets {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			result := s.checkObject(ctx, storage, userKey, t)
+			result.Username = username
+			if err := s.queries.UpsertScrubResult(ctx, result); err != nil {
+				log.Printf("scrub: %v", err)
+			}
+			counts[result.Status]++
+
+			s.mu.Lock()
+			s.status.Checked++
+			if result.Status != models.ScrubStatusOK && result.Status != models.ScrubStatusError {
+				s.status.Failed++
+			}
+			s.mu.Unlock()
+
+			if result.Status != models.ScrubStatusOK {
+				log.Printf("scrub: %s %s: %s", result.Status, t.objectKey, derefString(result.Detail))
+			}
+			if result.ActualBytes != nil {
+				throttle(*result.ActualBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// checkObject HEADs and then reads one object, returning the scrub result
+// (Username is filled in by the caller).
+func (s *ScrubService) checkObject(ctx context.Context, storage BlobStore, userKey []byte, t scrubTarget) *models.ScrubResult {
+	chunked := len(t.nonce) == 0
+	r := &models.ScrubResult{
+		FileID:         t.fileID,
+		VariantID:      t.variantID,
+		MinIOObjectKey: t.objectKey,
+		ExpectedBytes:  expectedStoredSize(t.plainSize, chunked),
+	}
+	fail := func(status, detail string) *models.ScrubResult {
+		r.Status = status
+		r.Detail = &detail
+		return r
+	}
+
+	info, err := storage.StatObject(ctx, t.objectKey)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return fail(models.ScrubStatusMissing, "object not found")
+		}
+		return fail(models.ScrubStatusError, err.Error())
+	}
+	actual := info.Size
+	r.ActualBytes = &actual
+	if actual != r.ExpectedBytes {
+		return fail(models.ScrubStatusSizeMismatch,
+			fmt.Sprintf("stored %d bytes, expected %d", actual, r.ExpectedBytes))
+	}
+
+	rc, err := storage.GetObject(ctx, t.objectKey)
+	if err != nil {
+		return fail(models.ScrubStatusError, err.Error())
+	}
+	defer rc.Close()
+
+	if chunked {
+		_, err = verifyChunkedStream(userKey, rc)
+	} else {
+		err = verifySingleBlob(userKey, t.nonce, rc)
+	}
+	if err != nil {
+		if errors.Is(err, errCorruptBlob) {
+			return fail(models.ScrubStatusCorrupt, err.Error())
+		}
+		return fail(models.ScrubStatusError, err.Error())
+	}
+	r.Status = models.ScrubStatusOK
+	return r
+}
+
+// ── Verification helpers ──────────────────────────────────────────────────────
+
+// expectedStoredSize returns the ciphertext length for a plaintext of
+// plainSize bytes. Single-blob files carry one GCM tag; chunked files carry a
+// nonce and tag per ChunkSize chunk, and an empty plaintext still produces one
+// (empty) chunk.
+func expectedStoredSize(plainSize int64, chunked bool) int64 {
+	if !chunked {
+		return plainSize + chunkTagSize
+	}
+	numChunks := (plainSize + ChunkSize - 1) / ChunkSize
+	if numChunks == 0 {
+		numChunks = 1
+	}
+	return plainSize + numChunks*ChunkOverhead
+}
+
+// verifyChunkedStream reads a chunked blob one stored chunk at a time and
+// authenticates each chunk, using the same layout DecryptChunked expects.
+// Memory stays at one chunk regardless of blob size. Returns the number of
+// plaintext bytes authenticated.
+func verifyChunkedStream(userKey []byte, r io.Reader) (int64, error) {
+	buf := make([]byte, StoredChunkSize)
+	var (
+		total int64
+		idx   int
+	)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			if idx == 0 {
+				return 0, fmt.Errorf("%w: empty blob", errCorruptBlob)
+			}
+			return total, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return total, fmt.Errorf("read chunk %d: %w", idx, err)
+		}
+		if n <= chunkNonceSize {
+			return total, fmt.Errorf("%w: chunk %d too short (%d bytes)", errCorruptBlob, idx, n)
+		}
+		plain, derr := aesGCMDecrypt(userKey, buf[:chunkNonceSize], buf[chunkNonceSize:n])
+		if derr != nil {
+			return total, fmt.Errorf("%w: chunk %d: %v", errCorruptBlob, idx, derr)
+		}
+		total += int64(len(plain))
+		idx++
+		if err == io.ErrUnexpectedEOF {
+			return total, nil // short final chunk
+		}
+	}
+}
+
+// verifySingleBlob reads a legacy single-blob object and authenticates it.
+func verifySingleBlob(userKey, nonce []byte, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read blob: %w", err)
+	}
+	if _, err := aesGCMDecrypt(userKey, nonce, data); err != nil {
+		return fmt.Errorf("%w: %v", errCorruptBlob, err)
+	}
+	return nil
+}
+
+// isNoSuchKey reports whether err means the object does not exist. S3Store
+// only maps this to ErrBlobNotFound where it can see the response, so errors
+// from lazily read bodies are checked for the raw S3 code as well.
+func isNoSuchKey(err error) bool {
+	if errors.Is(err, ErrBlobNotFound) {
+		return true
+	}
+	var resp minio.ErrorResponse
+	return errors.As(err, &resp) && resp.Code == "NoSuchKey"
+}
+
+// throttle sleeps long enough that reading n bytes stays under scrubMaxBytesPerSec.
+func throttle(n int64) {
+	time.Sleep(time.Duration(n) * time.Second / scrubMaxBytesPerSec)
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
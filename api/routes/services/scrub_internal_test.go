@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestExpectedStoredSize(t *testing.T) {
+	cases := []struct {
+		plain   int64
+		chunked bool
+		want    int64
+	}{
+		{0, false, 16},
+		{100, false, 116},
+		{0, true, ChunkOverhead},
+		{1, true, 1 + ChunkOverhead},
+		{ChunkSize, true, StoredChunkSize},
+		{ChunkSize + 1, true, ChunkSize + 1 + 2*ChunkOverhead},
+		{3 * ChunkSize, true, 3 * StoredChunkSize},
+	}
+	for _, tc := range cases {
+		got := expectedStoredSize(tc.plain, tc.chunked)
+		if got != tc.want {
+			t.Errorf("expectedStoredSize(%d, %v) = %d, want %d", tc.plain, tc.chunked, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyChunkedStream(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	enc := &EncryptionService{}
+
+	plain := bytes.Repeat([]byte("scrub"), (ChunkSize+100)/5)
+	blob, err := enc.EncryptChunked(key, plain)
+	if err != nil {
+		t.Fatalf("EncryptChunked: %v", err)
+	}
+	empty, err := enc.EncryptChunked(key, nil)
+	if err != nil {
+		t.Fatalf("EncryptChunked(empty): %v", err)
+	}
+
+	tampered := append([]byte(nil), blob...)
+	tampered[StoredChunkSize+chunkNonceSize+3] ^= 0xff
+
+	cases := []struct {
+		name        string
+		blob        []byte
+		wantPlain   int64
+		wantCorrupt bool
+	}{
+		{"intact", blob, int64(len(plain)), false},
+		{"empty plaintext", empty, 0, false},
+		{"tampered last chunk", tampered, 0, true},
+		{"truncated", blob[:len(blob)-5], 0, true},
+		{"zero bytes", nil, 0, true},
+	}
+	for _, tc := range cases {
+		n, err := verifyChunkedStream(key, bytes.NewReader(tc.blob))
+		if tc.wantCorrupt {
+			if !errors.Is(err, errCorruptBlob) {
+				t.Errorf("%s: err = %v, want errCorruptBlob", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if n != tc.wantPlain {
+			t.Errorf("%s: authenticated %d bytes, want %d", tc.name, n, tc.wantPlain)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// maxTextIndexSource skips files too large to be worth downloading and
+	// decrypting just to index their text.
+	maxTextIndexSource = 100 << 20
+	// maxSearchTerms caps the distinct words of a content query.
+	maxSearchTerms = 16
+	// Words shorter or longer than this (in characters) are not indexed.
+	minTermRunes = 2
+	maxTermRunes = 64
+	// snippetBefore and snippetAfter are the characters of context kept on
+	// either side of the first match.
+	snippetBefore = 60
+	snippetAfter  = 160
+)
+
+// searchIndexKeyLabel derives the blind-index key from a user's file key.
+// Changing it invalidates every stored index.
+const searchIndexKeyLabel = "apollo-sfs search index v1"
+
+// ContentHit is a file whose contents matched a search, with its relevance
+// score (higher is better) and the passage around the first match.
+type ContentHit struct {
+	File    models.File `json:"file"`
+	Score   float64     `json:"score"`
+	Snippet string      `json:"snippet"`
+}
+
+// ── Indexing ──────────────────────────────────────────────────────────────────
+
+// tokenize lower-cases text and splits it into words: runs of letters and
+// digits between minTermRunes and maxTermRunes characters long.
+func tokenize(text string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(text, notWordRune) {
+		if n := utf8.RuneCountInString(w); n >= minTermRunes && n <= maxTermRunes {
+			out = append(out, strings.ToLower(w))
+		}
+	}
+	return out
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// searchIndexKey derives a user's blind-index key from their file key, so
+// the index can only be queried by someone who can also decrypt the files.
+func searchIndexKey(userKey []byte) []byte {
+	mac := hmac.New(sha256.New, userKey)
+	mac.Write([]byte(searchIndexKeyLabel))
+	return mac.Sum(nil)
+}
+
+// termHash is the stored form of a word: the first 8 bytes of its
+// HMAC-SHA256 under the index key.
+func termHash(indexKey []byte, word string) int64 {
+	mac := hmac.New(sha256.New, indexKey)
+	mac.Write([]byte(word))
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+}
+
+// runTextIndexJob extracts the text of the job's file and replaces its entry
+// in the content search index. The text is stored encrypted with the
+// owner's key and the words only as keyed hashes.
+func (s *FileService) runTextIndexJob(ctx context.Context, job *models.Job) error {
+	file, err := s.GetMetadata(ctx, job.FileID, job.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil // deleted since the job was queued
+	}
+	if err != nil {
+		return err
+	}
+	if s.text == nil || !s.text.Supports(file.MimeType) {
+		return permanentJobError(fmt.Errorf("no text extractor for %s", file.MimeType))
+	}
+	if file.SizeBytes > maxTextIndexSource {
+		return permanentJobError(fmt.Errorf("%d bytes is too large to index", file.SizeBytes))
+	}
+
+	var plaintext []byte
+	if IsChunked(file) {
+		plaintext, err = s.DownloadChunked(ctx, file, job.Username)
+	} else {
+		plaintext, err = s.decryptBlob(ctx, job.Username, file)
+	}
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	text, err := s.text.Extract(ctx, file.MimeType, plaintext)
+	plaintext = nil
+	if err != nil {
+		// Extraction is deterministic: the same document fails the same way.
+		return permanentJobError(fmt.Errorf("extract (%s): %w", file.MimeType, err))
+	}
+
+	userKey, err := s.userKey(ctx, job.Username)
+	if err != nil {
+		return fmt.Errorf("get user key: %w", err)
+	}
+	defer zeroBytes(userKey)
+
+	indexKey := searchIndexKey(userKey)
+	defer zeroBytes(indexKey)
+	words := tokenize(text)
+	terms := make(map[int64]int)
+	for _, w := range words {
+		terms[termHash(indexKey, w)]++
+	}
+	ciphertext, nonce, err := s.enc.EncryptFile(userKey, []byte(text))
+	if err != nil {
+		return fmt.Errorf("encrypt text: %w", err)
+	}
+
+	err = s.queries.ReplaceSearchDocument(ctx, &db.SearchDocument{
+		FileID:         file.ID,
+		UserID:         file.UserID,
+		DocLength:      len(words),
+		TextCiphertext: ciphertext,
+		TextNonce:      nonce,
+		Terms:          terms,
+	})
+	if err != nil {
+		return fmt.Errorf("store index: %w", err)
+	}
+	return nil
+}
+
+// unindexedFiles lists the files of userID that the text index job would
+// index but that have no search document yet. Backfill for JobKindTextIndex.
+func (s *FileService) unindexedFiles(ctx context.Context, userID uuid.UUID) ([]models.File, error) {
+	if s.text == nil {
+		return nil, nil
+	}
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	files, err := q.ListUnindexedFiles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := files[:0]
+	for _, f := range files {
+		if s.text.Supports(f.MimeType) && f.SizeBytes <= maxTextIndexSource {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// ── Searching ─────────────────────────────────────────────────────────────────
+
+// SearchContent returns a page of userID's files that match filter and whose
+// contents contain every word of query, best match first, each with a
+// snippet around its first match. A query without indexable words yields an
+// empty page.
+func (s *FileService) SearchContent(ctx context.Context, userID uuid.UUID, username, query string, filter db.SearchFilter, page db.PageInput) (*db.PageResult[ContentHit], error) {
+	words := uniqueWords(tokenize(query))
+	if len(words) == 0 {
+		return &db.PageResult[ContentHit]{Items: []ContentHit{}}, nil
+	}
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+
+	userKey, err := s.userKey(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("search content: get user key: %w", err)
+	}
+	defer zeroBytes(userKey)
+	indexKey := searchIndexKey(userKey)
+	defer zeroBytes(indexKey)
+	terms := make([]int64, len(words))
+	for i, w := range words {
+		terms[i] = termHash(indexKey, w)
+	}
+
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("search content: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	matches, err := q.SearchFileContents(ctx, userID, terms, filter, page)
+	if err != nil {
+		return nil, fmt.Errorf("search content: %w", err)
+	}
+
+	out := &db.PageResult[ContentHit]{Items: make([]ContentHit, 0, len(matches.Items)), NextToken: matches.NextToken}
+	for _, m := range matches.Items {
+		hit := ContentHit{File: m.File, Score: m.Score}
+		if text, err := s.enc.DecryptFile(userKey, m.TextNonce, m.TextCiphertext); err == nil {
+			hit.Snippet = snippet(string(text), words)
+		}
+		out.Items = append(out.Items, hit)
+	}
+	return out, nil
+}
+
+// uniqueWords drops repeated words, keeping first occurrences in order.
+func uniqueWords(words []string) []string {
+	seen := make(map[string]bool, len(words))
+	out := words[:0]
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// snippet returns the passage of text around the first whole-word,
+// case-insensitive occurrence of any of words, with whitespace collapsed and
+// "…" marking cut ends. Without a match it returns the start of text.
+func snippet(text string, words []string) string {
+	want := make(map[string]bool, len(words))
+	for _, w := range words {
+		want[w] = true
+	}
+
+	match := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if notWordRune(r) {
+			i += size
+			continue
+		}
+		end := i + size
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if notWordRune(r) {
+				break
+			}
+			end += size
+		}
+		if want[strings.ToLower(text[i:end])] {
+			match = i
+			break
+		}
+		i = end
+	}
+
+	start := match
+	for n := 0; n < snippetBefore && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := match
+	for n := 0; n < snippetAfter && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	// Cut at word boundaries rather than mid-word.
+	if start > 0 {
+		if i := strings.IndexFunc(text[start:match], unicode.IsSpace); i >= 0 {
+			start += i
+		}
+	}
+	if end < len(text) {
+		if i := strings.LastIndexFunc(text[match:end], unicode.IsSpace); i > 0 {
+			end = match + i
+		}
+	}
+
+	out := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(text) {
+		out += "…"
+	}
+	return out
+}
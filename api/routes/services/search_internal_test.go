@@ -0,0 +1,51 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Quarterly Report — Q3 2024: revenue up 12%, café & naïve a")
+	want := []string{"quarterly", "report", "q3", "2024", "revenue", "up", "12", "café", "naïve"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestTermHash(t *testing.T) {
+	keyA := searchIndexKey([]byte("user key A"))
+	keyB := searchIndexKey([]byte("user key B"))
+	if termHash(keyA, "invoice") != termHash(keyA, "invoice") {
+		t.Error("hash is not deterministic")
+	}
+	if termHash(keyA, "invoice") == termHash(keyA, "invoices") {
+		t.Error("different words share a hash")
+	}
+	if termHash(keyA, "invoice") == termHash(keyB, "invoice") {
+		t.Error("hash does not depend on the user's key")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ipsum dolor ", 20) + "the Invoice\nnumber is   4711 " + strings.Repeat("sit amet ", 40)
+	got := snippet(text, []string{"invoice"})
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("cut ends not marked: %q", got)
+	}
+	if !strings.Contains(got, "the Invoice number is 4711") {
+		t.Errorf("match or collapsed whitespace missing: %q", got)
+	}
+	if strings.Contains(got, "  ") {
+		t.Errorf("whitespace not collapsed: %q", got)
+	}
+
+	// Whole words only: "invoices" does not match "invoice".
+	if got := snippet("invoices are due. one invoice paid", []string{"invoice"}); got != "invoices are due. one invoice paid" {
+		t.Errorf("short text = %q", got)
+	}
+	if got := snippet("no match here", []string{"absent"}); got != "no match here" {
+		t.Errorf("without a match = %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// MaxFileTags caps the tags on one file.
+	MaxFileTags = 32
+	// MaxTagLength caps a tag, in characters.
+	MaxTagLength = 64
+)
+
+// ErrInvalidTag is returned for an empty, over-long or control-character tag,
+// or when a file would carry more than MaxFileTags.
+var ErrInvalidTag = errors.New("invalid tag")
+
+// NormalizeTag trims and lower-cases a tag so that "Holiday " and "holiday"
+// are the same tag.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+		return "", fmt.Errorf("%w: must be 1-%d characters", ErrInvalidTag, MaxTagLength)
+	}
+	if strings.IndexFunc(tag, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("%w: contains control characters", ErrInvalidTag)
+	}
+	return tag, nil
+}
+
+// normalizeTags normalizes every tag and returns them sorted without
+// duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		n, err := NormalizeTag(t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > MaxFileTags {
+		return nil, fmt.Errorf("%w: at most %d tags per file", ErrInvalidTag, MaxFileTags)
+	}
+	return out, nil
+}
+
+// SetTags replaces the tags of a file owned by userID. Returns ErrNotFound
+// if the file does not belong to userID and ErrInvalidTag for a bad tag.
+func (s *FileService) SetTags(ctx context.Context, fileID, userID uuid.UUID, tags []string) (*models.File, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("set tags: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := q.GetFileByID(ctx, fileID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("set tags: get file: %w", err)
+	}
+	updated, err := q.SetFileTags(ctx, fileID, tags)
+	if err != nil {
+		return nil, fmt.Errorf("set tags: %w", err)
+	}
+	return updated, tx.Commit()
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := normalizeTags([]string{" Holiday", "2024", "holiday ", "Beach"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2024", "beach", "holiday"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, bad := range [][]string{
+		{"  "},
+		{strings.Repeat("x", MaxTagLength+1)},
+		{"tab\there"},
+	} {
+		if _, err := normalizeTags(bad); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("%q: err = %v, want ErrInvalidTag", bad, err)
+		}
+	}
+
+	many := make([]string, MaxFileTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("a", i+1)
+	}
+	if _, err := normalizeTags(many); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("too many tags: err = %v", err)
+	}
+}
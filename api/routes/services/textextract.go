@@ -0,0 +1,240 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Office Open XML MIME types whose text can be extracted.
+const (
+	mimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	mimePPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+)
+
+const (
+	// maxExtractedText caps the text indexed per file; the rest of a very
+	// long document is not searchable.
+	maxExtractedText = 1 << 20
+	// maxOOXMLPart caps the decompressed size read from any one part of an
+	// Office document, as a guard against zip bombs.
+	maxOOXMLPart = 64 << 20
+)
+
+// errNoTextExtractor is returned for file types Extract cannot read.
+var errNoTextExtractor = errors.New("no text extractor")
+
+// TextExtractService pulls the plain text out of documents for the content
+// search index. Text, Markdown and Office Open XML files are read
+// in-process; PDF text layers go through pdftotext (poppler-utils). If
+// pdftotext is missing from PATH, PDFs are simply not indexed.
+type TextExtractService struct {
+	pdftotextPath string
+}
+
+// NewTextExtractService probes PATH for pdftotext.
+func NewTextExtractService() *TextExtractService {
+	path, _ := exec.LookPath("pdftotext")
+	return &TextExtractService{pdftotextPath: path}
+}
+
+// Sources lists the kinds of file whose contents are indexed, for the
+// startup log.
+func (t *TextExtractService) Sources() []string {
+	out := []string{"text", "office documents"}
+	if t.pdftotextPath != "" {
+		out = append(out, "pdfs")
+	}
+	return out
+}
+
+// Supports reports whether text can be extracted from mimeType.
+func (t *TextExtractService) Supports(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return true
+	case mimeType == mimeDOCX, mimeType == mimeXLSX, mimeType == mimePPTX:
+		return true
+	case mimeType == "application/pdf":
+		return t.pdftotextPath != ""
+	}
+	return false
+}
+
+// Extract returns the text of a document, truncated to maxExtractedText
+// bytes of valid UTF-8.
+func (t *TextExtractService) Extract(ctx context.Context, mimeType string, plaintext []byte) (string, error) {
+	var text string
+	var err error
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		text = string(plaintext)
+	case mimeType == mimeDOCX:
+		text, err = ooxmlText(plaintext, func(name string) bool {
+			return name == "word/document.xml" || name == "word/footnotes.xml" || name == "word/endnotes.xml"
+		})
+	case mimeType == mimeXLSX:
+		text, err = ooxmlText(plaintext, func(name string) bool {
+			return name == "xl/sharedStrings.xml"
+		})
+	case mimeType == mimePPTX:
+		text, err = ooxmlText(plaintext, func(name string) bool {
+			return strings.HasPrefix(name, "ppt/slides/slide") && strings.HasSuffix(name, ".xml")
+		})
+	case mimeType == "application/pdf" && t.pdftotextPath != "":
+		text, err = t.pdfText(ctx, plaintext)
+	default:
+		return "", fmt.Errorf("%w for %s", errNoTextExtractor, mimeType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncateText(strings.ToValidUTF8(text, ""), maxExtractedText), nil
+}
+
+// pdfText runs pdftotext over a PDF and returns its text layer. Scanned PDFs
+// without one yield an empty string.
+func (t *TextExtractService) pdfText(ctx context.Context, plaintext []byte) (string, error) {
+	in, cleanup, err := extractToTempFile(plaintext, "pdf")
+	if err != nil {
+		return "", fmt.Errorf("write temp input: %w", err)
+	}
+	defer cleanup()
+	dir, err := os.MkdirTemp("", "text-*")
+	if err != nil {
+		return "", fmt.Errorf("create temp output: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "text.txt")
+	if err := runTool(ctx, t.pdftotextPath, "-enc", "UTF-8", "-q", in, out); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		return "", fmt.Errorf("read extracted text: %w", err)
+	}
+	return string(data), nil
+}
+
+// ooxmlText concatenates the text runs of the parts of an Office Open XML
+// package selected by want, in part order (slide2 before slide10). Text runs
+// are <t> elements in every format (w:t, a:t, and plain t in shared
+// strings); paragraphs, shared strings and line breaks become newlines.
+func ooxmlText(data []byte, want func(name string) bool) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open office document: %w", err)
+	}
+	var parts []*zip.File
+	for _, f := range zr.File {
+		if want(f.Name) {
+			parts = append(parts, f)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return naturalLess(parts[i].Name, parts[j].Name) })
+
+	var sb strings.Builder
+	for _, part := range parts {
+		if sb.Len() >= maxExtractedText {
+			break
+		}
+		rc, err := part.Open()
+		if err != nil {
+			return "", fmt.Errorf("open %s: %w", part.Name, err)
+		}
+		err = xmlText(&sb, io.LimitReader(rc, maxOOXMLPart))
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("parse %s: %w", part.Name, err)
+		}
+	}
+	return sb.String(), nil
+}
+
+// xmlText appends the character data of every <t> element read from r.
+func xmlText(sb *strings.Builder, r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	inText := false
+	for sb.Len() < maxExtractedText {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteByte('\t')
+			case "br":
+				sb.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "t":
+				inText = false
+			case "p", "si":
+				sb.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(el)
+			}
+		}
+	}
+	return nil
+}
+
+// naturalLess orders part names with a trailing number numerically, so
+// that "slide2.xml" sorts before "slide10.xml".
+func naturalLess(a, b string) bool {
+	pa, na := splitPartNumber(a)
+	pb, nb := splitPartNumber(b)
+	if pa != pb || na == nb {
+		return a < b
+	}
+	return na < nb
+}
+
+// splitPartNumber splits "ppt/slides/slide12.xml" into "ppt/slides/slide"
+// and 12. The number is -1 when the name has none.
+func splitPartNumber(name string) (string, int) {
+	base := strings.TrimSuffix(name, ".xml")
+	i := len(base)
+	for i > 0 && base[i-1] >= '0' && base[i-1] <= '9' {
+		i--
+	}
+	n, err := strconv.Atoi(base[i:])
+	if err != nil {
+		return base, -1
+	}
+	return base[:i], n
+}
+
+// truncateText cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// ooxmlPackage zips the given parts into an Office Open XML package.
+func ooxmlPackage(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractText_Office(t *testing.T) {
+	ext := &TextExtractService{}
+	cases := []struct {
+		mime  string
+		parts map[string]string
+		want  string
+	}{
+		{
+			mimeDOCX,
+			map[string]string{
+				"word/document.xml": `<w:document xmlns:w="w"><w:body>` +
+					`<w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">world</w:t></w:r></w:p>` +
+					`<w:p><w:r><w:t>Second &amp; last</w:t></w:r></w:p></w:body></w:document>`,
+				"word/styles.xml": `<w:styles xmlns:w="w"><w:t>not body text</w:t></w:styles>`,
+			},
+			"Hello\tworld\nSecond & last\n",
+		},
+		{
+			mimeXLSX,
+			map[string]string{
+				"xl/sharedStrings.xml": `<sst><si><t>Region</t></si><si><r><t>North</t></r><r><t>east</t></r></si></sst>`,
+			},
+			"Region\nNortheast\n",
+		},
+		{
+			mimePPTX,
+			map[string]string{
+				"ppt/slides/slide10.xml":           `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>ten</a:t></a:r></a:p></p:sld>`,
+				"ppt/slides/slide2.xml":            `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>two</a:t></a:r></a:p></p:sld>`,
+				"ppt/slides/_rels/slide2.xml.rels": `<Relationships/>`,
+			},
+			"two\nten\n",
+		},
+	}
+	for _, tc := range cases {
+		got, err := ext.Extract(context.Background(), tc.mime, ooxmlPackage(t, tc.parts))
+		if err != nil {
+			t.Errorf("%s: %v", tc.mime, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.mime, got, tc.want)
+		}
+	}
+
+	if _, err := ext.Extract(context.Background(), mimeDOCX, []byte("not a zip")); err == nil {
+		t.Error("expected an error for a corrupt document")
+	}
+}
+
+func TestExtractText_PlainAndUnsupported(t *testing.T) {
+	ext := &TextExtractService{}
+	got, err := ext.Extract(context.Background(), "text/markdown", []byte("# Notes\n\nbad \xff byte"))
+	if err != nil || got != "# Notes\n\nbad  byte" {
+		t.Errorf("markdown: %q, %v", got, err)
+	}
+	if ext.Supports("application/pdf") {
+		t.Error("PDFs supported without pdftotext")
+	}
+	if _, err := ext.Extract(context.Background(), "image/png", nil); err == nil {
+		t.Error("expected an error for an image")
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	names := []string{"slide10.xml", "slide2.xml", "slide1.xml", "notes.xml"}
+	sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+	if got := strings.Join(names, ","); got != "notes.xml,slide1.xml,slide2.xml,slide10.xml" {
+		t.Errorf("order = %s", got)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("héllo", 2); got != "h" {
+		t.Errorf("truncateText split a rune: %q", got)
+	}
+	if got := truncateText("abc", 10); got != "abc" {
+		t.Errorf("short text changed: %q", got)
+	}
+}
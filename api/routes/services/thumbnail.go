@@ -0,0 +1,357 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Thumbnail sizes accepted by GET /files/:file_id/thumbnail?size=.
+const (
+	ThumbnailSmall = "small"
+	ThumbnailLarge = "large"
+)
+
+// ThumbnailMimeType is the content type of every stored thumbnail.
+const ThumbnailMimeType = "image/jpeg"
+
+// thumbnailSizes lists the sizes in the order their variant rows are created.
+var thumbnailSizes = []string{ThumbnailSmall, ThumbnailLarge}
+
+// thumbnailEdges is the longest edge, in pixels, of each thumbnail size.
+// Sources smaller than a size are encoded at their own dimensions.
+var thumbnailEdges = map[string]int{
+	ThumbnailSmall: 256,
+	ThumbnailLarge: 1024,
+}
+
+const (
+	thumbnailJPEGQuality = 80
+	// maxThumbnailSourcePixels refuses decompression bombs before decoding.
+	maxThumbnailSourcePixels = 100_000_000
+)
+
+// errThumbnailSourceTooLarge is returned for images above maxThumbnailSourcePixels.
+var errThumbnailSourceTooLarge = errors.New("image too large to thumbnail")
+
+// thumbnailQualityPrefix starts the video_variants quality of every thumbnail.
+const thumbnailQualityPrefix = "thumb-"
+
+// ThumbnailQuality returns the video_variants quality label for a size.
+func ThumbnailQuality(size string) string {
+	return thumbnailQualityPrefix + size
+}
+
+// isThumbnailQuality reports whether a variant quality label is a thumbnail.
+func isThumbnailQuality(quality string) bool {
+	return strings.HasPrefix(quality, thumbnailQualityPrefix)
+}
+
+// ValidThumbnailSize reports whether size is one of the thumbnail sizes.
+func ValidThumbnailSize(size string) bool {
+	_, ok := thumbnailEdges[size]
+	return ok
+}
+
+// ThumbnailService renders thumbnails. JPEG, PNG and GIF images are decoded
+// in-process; other image formats and video poster frames go through FFmpeg
+// and PDF first pages through pdftoppm (poppler-utils). Sources whose tool
+// is missing from PATH are skipped and the file simply has no thumbnail.
+type ThumbnailService struct {
+	ffmpegPath   string
+	pdftoppmPath string
+}
+
+// NewThumbnailService probes PATH for ffmpeg and pdftoppm.
+func NewThumbnailService() *ThumbnailService {
+	ffmpeg, _ := exec.LookPath("ffmpeg")
+	pdftoppm, _ := exec.LookPath("pdftoppm")
+	return &ThumbnailService{ffmpegPath: ffmpeg, pdftoppmPath: pdftoppm}
+}
+
+// Sources lists the kinds of file thumbnails can be made for, for the
+// startup log.
+func (t *ThumbnailService) Sources() []string {
+	out := []string{"images"}
+	if t.ffmpegPath != "" {
+		out = append(out, "videos")
+	}
+	if t.pdftoppmPath != "" {
+		out = append(out, "pdfs")
+	}
+	return out
+}
+
+// Supports reports whether a thumbnail can be rendered for mimeType.
+func (t *ThumbnailService) Supports(mimeType string) bool {
+	switch {
+	case isNativeImage(mimeType):
+		return true
+	case strings.HasPrefix(mimeType, "image/"), strings.HasPrefix(mimeType, "video/"):
+		return t.ffmpegPath != ""
+	case mimeType == "application/pdf":
+		return t.pdftoppmPath != ""
+	}
+	return false
+}
+
+// Render returns one JPEG per thumbnail size for the given plaintext,
+// keyed by size.
+func (t *ThumbnailService) Render(ctx context.Context, mimeType string, plaintext []byte) (map[string][]byte, error) {
+	src, orientation, err := t.decode(ctx, mimeType, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]byte, len(thumbnailEdges))
+	for size, edge := range thumbnailEdges {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, orient(scaleToFit(src, edge), orientation), &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+			return nil, fmt.Errorf("encode %s thumbnail: %w", size, err)
+		}
+		out[size] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// decode turns the source into an image — the image itself, a video poster
+// frame or a PDF's first page — and the EXIF orientation to apply once it has
+// been scaled down.
+func (t *ThumbnailService) decode(ctx context.Context, mimeType string, plaintext []byte) (image.Image, int, error) {
+	if isNativeImage(mimeType) {
+		img, err := decodeImage(plaintext)
+		if err != nil {
+			return nil, 0, err
+		}
+		return img, exifOrientation(plaintext), nil
+	}
+	if !t.Supports(mimeType) {
+		return nil, 0, fmt.Errorf("no thumbnailer for %s", mimeType)
+	}
+
+	in, cleanup, err := extractToTempFile(plaintext, thumbnailSourceExt(mimeType))
+	if err != nil {
+		return nil, 0, fmt.Errorf("write temp input: %w", err)
+	}
+	defer cleanup()
+	dir, err := os.MkdirTemp("", "thumb-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("create temp output: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var png string
+	switch {
+	case mimeType == "application/pdf":
+		png, err = t.pdfFirstPage(ctx, in, dir)
+	case strings.HasPrefix(mimeType, "video/"):
+		png, err = t.posterFrame(ctx, in, dir)
+	default:
+		png = filepath.Join(dir, "frame.png")
+		err = runTool(ctx, t.ffmpegPath, "-i", in, "-frames:v", "1", "-y", png)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := os.ReadFile(png)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read rendered frame: %w", err)
+	}
+	// FFmpeg and pdftoppm already output upright frames.
+	img, err := decodeImage(data)
+	return img, 1, err
+}
+
+// posterFrame extracts a representative frame from about one second in,
+// falling back to the first frame for clips shorter than that.
+func (t *ThumbnailService) posterFrame(ctx context.Context, in, dir string) (string, error) {
+	out := filepath.Join(dir, "poster.png")
+	for _, seek := range []string{"1", "0"} {
+		err := runTool(ctx, t.ffmpegPath,
+			"-ss", seek, "-i", in,
+			"-vf", "thumbnail",
+			"-frames:v", "1",
+			"-y", out,
+		)
+		if err != nil {
+			return "", err
+		}
+		if fi, err := os.Stat(out); err == nil && fi.Size() > 0 {
+			return out, nil
+		}
+	}
+	return "", errors.New("ffmpeg: no video frame")
+}
+
+// pdfFirstPage rasterises page one at the largest thumbnail size.
+func (t *ThumbnailService) pdfFirstPage(ctx context.Context, in, dir string) (string, error) {
+	prefix := filepath.Join(dir, "page")
+	err := runTool(ctx, t.pdftoppmPath,
+		"-f", "1", "-l", "1",
+		"-png", "-singlefile",
+		"-scale-to", fmt.Sprint(thumbnailEdges[ThumbnailLarge]),
+		in, prefix,
+	)
+	return prefix + ".png", err
+}
+
+// runTool runs an external renderer, folding its stderr into the error.
+func runTool(ctx context.Context, path string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(path), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// isNativeImage reports whether the standard library can decode mimeType.
+func isNativeImage(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// thumbnailSourceExt returns a file extension the external tools can use to
+// detect the input format.
+func thumbnailSourceExt(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "video/"):
+		return mimeToExt(mimeType)
+	case mimeType == "application/pdf":
+		return "pdf"
+	}
+	sub := mimeType[strings.IndexByte(mimeType, '/')+1:]
+	return strings.TrimPrefix(sub, "x-")
+}
+
+// decodeImage decodes a JPEG, PNG or GIF after checking its dimensions.
+func decodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxThumbnailSourcePixels {
+		return nil, errThumbnailSourceTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	return img, nil
+}
+
+// exifOrientation returns the EXIF orientation tag (1–8), or 1 when absent.
+func exifOrientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	o, err := tag.Int(0)
+	if err != nil || o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// scaleToFit shrinks src so its longest edge is at most edge pixels, averaging
+// every source pixel that falls into a destination pixel. Transparent areas
+// are flattened onto white since JPEG has no alpha channel.
+func scaleToFit(src image.Image, edge int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dw, dh := sw, sh
+	if sw > edge || sh > edge {
+		if sw >= sh {
+			dw, dh = edge, max(1, sh*edge/sw)
+		} else {
+			dw, dh = max(1, sw*edge/sh), edge
+		}
+	}
+
+	sums := make([][4]uint64, dw*dh)
+	counts := make([]uint64, dw*dh)
+	for y := 0; y < sh; y++ {
+		row := (y * dh / sh) * dw
+		for x := 0; x < sw; x++ {
+			i := row + x*dw/sw
+			r, g, bl, a := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			sums[i][0] += uint64(r)
+			sums[i][1] += uint64(g)
+			sums[i][2] += uint64(bl)
+			sums[i][3] += uint64(a)
+			counts[i]++
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for i, s := range sums {
+		n := counts[i]
+		if n == 0 {
+			n = 1
+		}
+		// Premultiplied colour over white: c + (1 − α).
+		white := 0xffff - s[3]/n
+		p := dst.Pix[i*4 : i*4+4]
+		p[0] = uint8((s[0]/n + white) >> 8)
+		p[1] = uint8((s[1]/n + white) >> 8)
+		p[2] = uint8((s[2]/n + white) >> 8)
+		p[3] = 0xff
+	}
+	return dst
+}
+
+// orient applies an EXIF orientation so the image displays upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// mapXY returns the destination coordinates of source pixel (x, y).
+	var dw, dh int
+	var mapXY func(x, y int) (int, int)
+	switch orientation {
+	case 2: // mirrored
+		dw, dh, mapXY = w, h, func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // rotated 180°
+		dw, dh, mapXY = w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // flipped vertically
+		dw, dh, mapXY = w, h, func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // transposed
+		dw, dh, mapXY = h, w, func(x, y int) (int, int) { return y, x }
+	case 6: // rotated 90° clockwise to display
+		dw, dh, mapXY = h, w, func(x, y int) (int, int) { return h - 1 - y, x }
+	case 7: // transversed
+		dw, dh, mapXY = h, w, func(x, y int) (int, int) { return h - 1 - y, w - 1 - x }
+	case 8: // rotated 90° counter-clockwise to display
+		dw, dh, mapXY = h, w, func(x, y int) (int, int) { return y, w - 1 - x }
+	default:
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := mapXY(x, y)
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestScaleToFit(t *testing.T) {
+	cases := []struct {
+		w, h, edge   int
+		wantW, wantH int
+	}{
+		{4000, 3000, 256, 256, 192},
+		{3000, 4000, 256, 192, 256},
+		{100, 50, 256, 100, 50}, // never upscaled
+		{5000, 10, 256, 256, 1},
+	}
+	for _, tc := range cases {
+		got := scaleToFit(image.NewRGBA(image.Rect(0, 0, tc.w, tc.h)), tc.edge).Bounds()
+		if got.Dx() != tc.wantW || got.Dy() != tc.wantH {
+			t.Errorf("%dx%d → %d: got %dx%d, want %dx%d", tc.w, tc.h, tc.edge, got.Dx(), got.Dy(), tc.wantW, tc.wantH)
+		}
+	}
+
+	// Averaging: a 2x1 black/white image scaled to one pixel is mid-grey, and
+	// a fully transparent pixel comes out white.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.White)
+	src.Set(1, 0, color.Black)
+	if p := scaleToFit(src, 1).RGBAAt(0, 0); p.R < 126 || p.R > 128 || p.A != 0xff {
+		t.Errorf("averaged pixel = %v, want mid-grey", p)
+	}
+	if p := scaleToFit(image.NewRGBA(image.Rect(0, 0, 1, 1)), 1).RGBAAt(0, 0); p != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("transparent pixel = %v, want white", p)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 2x1 source with a red pixel on the left.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	src.SetRGBA(0, 0, red)
+
+	cases := []struct {
+		orientation int
+		w, h        int
+		redX, redY  int
+	}{
+		{1, 2, 1, 0, 0},
+		{2, 2, 1, 1, 0},
+		{3, 2, 1, 1, 0},
+		{6, 1, 2, 0, 0},
+		{8, 1, 2, 0, 1},
+	}
+	for _, tc := range cases {
+		got := orient(src, tc.orientation)
+		if got.Bounds().Dx() != tc.w || got.Bounds().Dy() != tc.h {
+			t.Errorf("orientation %d: got %v, want %dx%d", tc.orientation, got.Bounds(), tc.w, tc.h)
+			continue
+		}
+		if got.RGBAAt(tc.redX, tc.redY) != red {
+			t.Errorf("orientation %d: red pixel not at (%d,%d)", tc.orientation, tc.redX, tc.redY)
+		}
+	}
+}
+
+func TestThumbnailRender(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewRGBA(image.Rect(0, 0, 2000, 1000))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	thumbs, err := (&ThumbnailService{}).Render(context.Background(), "image/png", src.Bytes())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for size, want := range map[string]image.Point{ThumbnailSmall: {256, 128}, ThumbnailLarge: {1024, 512}} {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumbs[size]))
+		if err != nil {
+			t.Fatalf("%s: not a JPEG: %v", size, err)
+		}
+		if cfg.Width != want.X || cfg.Height != want.Y {
+			t.Errorf("%s: %dx%d, want %v", size, cfg.Width, cfg.Height, want)
+		}
+	}
+
+	if _, err := (&ThumbnailService{}).Render(context.Background(), "image/png", []byte("not an image")); err == nil {
+		t.Error("garbage input: expected an error")
+	}
+}
+
+func TestThumbnailSupports(t *testing.T) {
+	bare := &ThumbnailService{}
+	full := &ThumbnailService{ffmpegPath: "/usr/bin/ffmpeg", pdftoppmPath: "/usr/bin/pdftoppm"}
+	cases := []struct {
+		mime       string
+		bare, full bool
+	}{
+		{"image/jpeg", true, true},
+		{"image/png", true, true},
+		{"image/webp", false, true},
+		{"video/mp4", false, true},
+		{"application/pdf", false, true},
+		{"text/plain", false, false},
+	}
+	for _, tc := range cases {
+		if got := bare.Supports(tc.mime); got != tc.bare {
+			t.Errorf("without tools, Supports(%q) = %v", tc.mime, got)
+		}
+		if got := full.Supports(tc.mime); got != tc.full {
+			t.Errorf("with tools, Supports(%q) = %v", tc.mime, got)
+		}
+	}
+
+	for mime, want := range map[string]string{"image/webp": "webp", "image/x-ms-bmp": "ms-bmp", "video/webm": "webm", "application/pdf": "pdf"} {
+		if got := thumbnailSourceExt(mime); got != want {
+			t.Errorf("thumbnailSourceExt(%q) = %q, want %q", mime, got, want)
+		}
+	}
+}
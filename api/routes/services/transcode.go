@@ -3,8 +3,11 @@ package services
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 )
 
 // LowQualityLabel is the canonical quality identifier for the 480p variant.
@@ -14,13 +17,16 @@ const LowQualityLabel = "low"
 // If FFmpeg is not found in PATH, Available() returns false and all
 // transcode operations are no-ops (upload still works at original quality).
 type TranscodeService struct {
-	ffmpegPath string
+	ffmpegPath  string
+	ffprobePath string
 }
 
-// NewTranscodeService probes PATH for ffmpeg and returns a TranscodeService.
+// NewTranscodeService probes PATH for ffmpeg and ffprobe and returns a
+// TranscodeService.
 func NewTranscodeService() *TranscodeService {
 	path, _ := exec.LookPath("ffmpeg")
-	return &TranscodeService{ffmpegPath: path}
+	probe, _ := exec.LookPath("ffprobe")
+	return &TranscodeService{ffmpegPath: path, ffprobePath: probe}
 }
 
 // Available reports whether FFmpeg was found at construction time.
@@ -30,7 +36,9 @@ func (t *TranscodeService) Available() bool {
 
 // TranscodeTo480p transcodes the video at inputPath to a 480p H.264/AAC MP4
 // at outputPath. -movflags +faststart moves the moov atom to the front so
-// browsers can begin playback before the full file is downloaded.
+// browsers can begin playback before the full file is downloaded. Container
+// metadata, the location tags among it, is not copied: the variant is what
+// shares stream.
 func (t *TranscodeService) TranscodeTo480p(ctx context.Context, inputPath, outputPath string) error {
 	if !t.Available() {
 		return fmt.Errorf("ffmpeg not found in PATH")
@@ -38,6 +46,7 @@ func (t *TranscodeService) TranscodeTo480p(ctx context.Context, inputPath, outpu
 	var stderr bytes.Buffer
 	cmd := exec.CommandContext(ctx, t.ffmpegPath,
 		"-i", inputPath,
+		"-map_metadata", "-1",
 		"-vf", "scale=-2:480",
 		"-c:v", "libx264",
 		"-crf", "28",
@@ -55,3 +64,113 @@ func (t *TranscodeService) TranscodeTo480p(ctx context.Context, inputPath, outpu
 	}
 	return nil
 }
+
+// VideoHeight returns the pixel height of the first video stream of the file
+// at path. Returns 0 without an error when ffprobe is not installed.
+func (t *TranscodeService) VideoHeight(ctx context.Context, path string) (int, error) {
+	if t.ffprobePath == "" {
+		return 0, nil
+	}
+	out, err := exec.CommandContext(ctx, t.ffprobePath,
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=height",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	var probe struct {
+		Streams []struct {
+			Height int `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return 0, fmt.Errorf("ffprobe: no video stream")
+	}
+	return probe.Streams[0].Height, nil
+}
+
+// TranscodeToHLS encodes the video at inputPath as one HLS rendition in
+// outDir: an H.264/AAC fMP4 init segment (init.mp4), media segments of about
+// hlsSegmentSeconds each (seg_00000.m4s, ...) and a VOD media playlist
+// (index.m3u8) that refers to them by relative name. Keyframes are forced at
+// segment boundaries so every rendition switches cleanly. As with
+// TranscodeTo480p, container metadata is not copied.
+func (t *TranscodeService) TranscodeToHLS(ctx context.Context, inputPath, outDir string, r HLSRendition) error {
+	if !t.Available() {
+		return fmt.Errorf("ffmpeg not found in PATH")
+	}
+	kbps := strconv.Itoa(r.VideoKbps) + "k"
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.ffmpegPath,
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-map_metadata", "-1",
+		"-vf", "scale=-2:"+strconv.Itoa(r.Height),
+		"-c:v", "libx264",
+		"-preset", "fast",
+		"-b:v", kbps,
+		"-maxrate", kbps,
+		"-bufsize", strconv.Itoa(2*r.VideoKbps)+"k",
+		"-force_key_frames", "expr:gte(t,n_forced*"+strconv.Itoa(hlsSegmentSeconds)+")",
+		"-c:a", "aac",
+		"-b:a", strconv.Itoa(hlsAudioKbps)+"k",
+		"-ac", "2",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", hlsInitName,
+		"-hls_segment_filename", filepath.Join(outDir, "seg_%05d.m4s"),
+		filepath.Join(outDir, hlsPlaylistName),
+		"-y",
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// videoLocationTags are the container tags phones record the position in.
+var videoLocationTags = []string{"location", "location-eng", "com.apple.quicktime.location.ISO6709"}
+
+// RemuxWithoutLocation copies every stream of the video at inputPath to
+// outputPath without re-encoding, keeping the container tags except the
+// location ones. The output container follows outputPath's extension.
+func (t *TranscodeService) RemuxWithoutLocation(ctx context.Context, inputPath, outputPath string) error {
+	if !t.Available() {
+		return fmt.Errorf("ffmpeg not found in PATH")
+	}
+	args := []string{
+		"-i", inputPath,
+		"-map", "0",
+		"-c", "copy",
+		"-map_metadata", "0",
+	}
+	for _, tag := range videoLocationTags {
+		// An empty value deletes the tag.
+		args = append(args, "-metadata", tag+"=")
+	}
+	switch filepath.Ext(outputPath) {
+	case ".mp4", ".mov":
+		// Keep the remaining QuickTime metadata keys (make, model, ...).
+		args = append(args, "-movflags", "use_metadata_tags")
+	}
+	args = append(args, outputPath, "-y")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, stderr.String())
+	}
+	return nil
+}
@@ -6,7 +6,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
+
+	"apollo-sfs.com/api/models"
 )
 
 const uploadSessionTTL = 24 * time.Hour
@@ -23,6 +24,11 @@ type UploadSession struct {
 	FolderID    *uuid.UUID
 	TotalChunks int
 	TotalSize   int64
+	// ExactFolder skips the media auto-upload redirect; see UploadInput.
+	ExactFolder bool
+	// Replace, when set, makes the upload the new content of that file; see
+	// UploadInput.
+	Replace *models.File
 
 	// Set by FileService.BeginChunkedUpload before any chunks are dispatched.
 	FileID        uuid.UUID
@@ -31,15 +37,15 @@ type UploadSession struct {
 	UserKey       []byte // zeroed by Zero() when the session is finalised or deleted
 	MimeType      string // detected from the first chunk; set by EncryptAndUploadPart
 	DriveID       uuid.UUID
-	MinIOStorage  *MinIOService
+	Storage       BlobStore
 
 	createdAt time.Time
 	wg        sync.WaitGroup
 
 	mu         sync.Mutex
-	dispatched map[int]struct{}    // chunk indices for which a goroutine was launched
-	parts      []minio.CompletePart // indexed by chunk index; filled as goroutines complete
-	partErr    error               // first error reported by any goroutine
+	dispatched map[int]struct{} // chunk indices for which a goroutine was launched
+	parts      []BlobPart       // indexed by chunk index; filled as goroutines complete
+	partErr    error            // first error reported by any goroutine
 }
 
 // UploadSessionStore holds active sessions and cleans up expired ones hourly.
@@ -60,7 +66,15 @@ func (s *UploadSessionStore) Create(
 	folderID *uuid.UUID,
 	totalChunks int, totalSize int64,
 ) (*UploadSession, error) {
-	sess := &UploadSession{
+	sess := newUploadSession(userID, username, name, folderID, totalChunks, totalSize)
+	s.sessions.Store(sess.ID, sess)
+	return sess, nil
+}
+
+// newUploadSession returns a session that is not registered in any store,
+// for server-side uploads no client will address by ID.
+func newUploadSession(userID uuid.UUID, username, name string, folderID *uuid.UUID, totalChunks int, totalSize int64) *UploadSession {
+	return &UploadSession{
 		ID:          uuid.New(),
 		UserID:      userID,
 		Username:    username,
@@ -70,10 +84,8 @@ func (s *UploadSessionStore) Create(
 		TotalSize:   totalSize,
 		createdAt:   time.Now(),
 		dispatched:  make(map[int]struct{}),
-		parts:       make([]minio.CompletePart, totalChunks),
+		parts:       make([]BlobPart, totalChunks),
 	}
-	s.sessions.Store(sess.ID, sess)
-	return sess, nil
 }
 
 // Get returns the session for the given ID, if it exists.
@@ -106,7 +118,7 @@ func (sess *UploadSession) DispatchChunk(index int) {
 
 // RecordPart stores the result of a completed goroutine and decrements the WaitGroup.
 // On error the first failure is retained; subsequent errors are discarded.
-func (sess *UploadSession) RecordPart(index int, part minio.CompletePart, err error) {
+func (sess *UploadSession) RecordPart(index int, part BlobPart, err error) {
 	defer sess.wg.Done()
 	sess.mu.Lock()
 	defer sess.mu.Unlock()
@@ -136,7 +148,7 @@ func (sess *UploadSession) AllDispatched() bool {
 // Wait blocks until all dispatched goroutines complete and returns the ordered
 // parts slice and the first error (if any). Parts are indexed by chunk index,
 // so parts[i].PartNumber == i+1 — already in the order MinIO requires.
-func (sess *UploadSession) Wait() ([]minio.CompletePart, error) {
+func (sess *UploadSession) Wait() ([]BlobPart, error) {
 	sess.wg.Wait()
 	sess.mu.Lock()
 	defer sess.mu.Unlock()
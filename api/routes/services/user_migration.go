@@ -0,0 +1,477 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+// migrationDrainDelay is how long a migration waits after flipping the
+// allocation before it deletes source objects. It covers the FileService
+// allocation cache and gives in-flight downloads from the source time to finish.
+const migrationDrainDelay = 2 * userCacheTTL
+
+var (
+	// ErrMigrationInProgress is returned when the user already has a migration running.
+	ErrMigrationInProgress = errors.New("a migration is already in progress for this user")
+	// ErrMigrationNoAllocation is returned when the user has no drive to migrate from.
+	ErrMigrationNoAllocation = errors.New("user has no drive allocation")
+	// ErrMigrationInvalidTarget is returned when the target drive does not
+	// exist, is inactive, is the user's current drive, or shares its bucket.
+	ErrMigrationInvalidTarget = errors.New("invalid target drive")
+	// ErrMigrationTargetOffline is returned when the target drive's server has
+	// no MinIO client registered.
+	ErrMigrationTargetOffline = errors.New("target drive's server is not reachable")
+)
+
+// migrationObject is one blob the migration (or replication) must copy.
+type migrationObject struct {
+	fileID uuid.UUID // the parent file for variants
+	key    string
+	nonce  []byte // empty → chunked mode
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// UserMigrationService moves a user's blobs and video variants from their
+// current drive to another one. Objects are copied and authenticated on the
+// target while reads keep using the source; the allocation and files.drive_id
+// are then flipped in one transaction, and the source objects are deleted
+// after a drain delay. Progress is persisted in user_migrations so a
+// migration interrupted by a restart or an error can be resumed.
+type UserMigrationService struct {
+	queries  *db.Queries
+	files    *FileService
+	registry *MinIORegistry
+	// resolveUserID maps a username to the Keycloak UUID stored in files.user_id.
+	resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)
+
+	mu     sync.Mutex
+	active map[string]struct{} // usernames with a run goroutine in this process
+}
+
+// NewUserMigrationService constructs a UserMigrationService.
+func NewUserMigrationService(q *db.Queries, files *FileService, registry *MinIORegistry, resolveUserID func(ctx context.Context, username string) (uuid.UUID, error)) *UserMigrationService {
+	return &UserMigrationService{
+		queries:       q,
+		files:         files,
+		registry:      registry,
+		resolveUserID: resolveUserID,
+		active:        make(map[string]struct{}),
+	}
+}
+
+// Start resumes every migration left unfinished by a previous process.
+func (s *UserMigrationService) Start(ctx context.Context) {
+	pending, err := s.queries.ListUnfinishedUserMigrations(ctx)
+	if err != nil {
+		log.Printf("user migration service: list unfinished: %v", err)
+		return
+	}
+	log.Printf("user migration service: started (resuming %d migration(s))", len(pending))
+	for i := range pending {
+		m := pending[i]
+		if s.claim(m.Username) {
+			go s.run(ctx, &m)
+		}
+	}
+}
+
+// Migrate starts (or resumes) moving username to targetDriveID and returns
+// the migration row. A failed migration to the same target is resumed rather
+// than restarted; objects already verified on the target are not copied again.
+func (s *UserMigrationService) Migrate(ctx context.Context, username string, targetDriveID uuid.UUID, startedBy string) (*models.UserMigration, error) {
+	user, err := s.queries.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	alloc, err := s.queries.GetUserDrive(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if alloc == nil {
+		return nil, ErrMigrationNoAllocation
+	}
+
+	latest, err := s.queries.GetLatestUserMigration(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	resume := latest != nil && latest.Status == models.UserMigrationFailed && latest.TargetDriveID == targetDriveID
+	if latest != nil && isUnfinishedMigration(latest.Status) {
+		if latest.TargetDriveID != targetDriveID || !s.claim(username) {
+			return nil, ErrMigrationInProgress
+		}
+		// Unfinished but not running here: the process that owned it died.
+		go s.run(context.Background(), latest)
+		return latest, nil
+	}
+
+	// A resumed migration may already have flipped the allocation.
+	if !resume || alloc.DriveID != targetDriveID {
+		if err := s.checkTarget(ctx, alloc, targetDriveID, user.StorageQuotaBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.claim(username) {
+		return nil, ErrMigrationInProgress
+	}
+	var m *models.UserMigration
+	if resume {
+		if err := s.queries.SetUserMigrationStatus(ctx, latest.ID, models.UserMigrationPending, nil); err != nil {
+			s.release(username)
+			return nil, err
+		}
+		m = latest
+		m.Status = models.UserMigrationPending
+		m.Error = nil
+		m.FinishedAt = nil
+	} else {
+		m, err = s.queries.CreateUserMigration(ctx, username, alloc.DriveID, targetDriveID, startedBy)
+		if err != nil {
+			s.release(username)
+			return nil, err
+		}
+	}
+	go s.run(context.Background(), m)
+	return m, nil
+}
+
+// Latest returns the most recent migration for username, or nil if none.
+func (s *UserMigrationService) Latest(ctx context.Context, username string) (*models.UserMigration, error) {
+	return s.queries.GetLatestUserMigration(ctx, username)
+}
+
+// checkTarget validates targetDriveID as a destination for a user currently on alloc.
+func (s *UserMigrationService) checkTarget(ctx context.Context, alloc *models.UserDriveAllocation, targetDriveID uuid.UUID, quotaBytes int64) error {
+	target, err := s.queries.GetDrive(ctx, targetDriveID)
+	if err != nil {
+		return err
+	}
+	if target == nil || !target.IsActive || target.ID == alloc.DriveID {
+		return ErrMigrationInvalidTarget
+	}
+	if target.ServerID == alloc.Server.ID && target.MinioBucket == alloc.Drive.MinioBucket {
+		return ErrMigrationInvalidTarget
+	}
+	if _, ok := s.registry.Store(target.ServerID, target.MinioBucket); !ok {
+		return ErrMigrationTargetOffline
+	}
+	avail, err := s.queries.GetDriveAvailableBytes(ctx, target.ID)
+	if err != nil {
+		return err
+	}
+	// Moving onto the replica drive reuses the quota the replica already holds there.
+	replica, err := s.queries.GetUserReplicaDrive(ctx, alloc.UserID)
+	if err != nil {
+		return err
+	}
+	if replica != nil && replica.DriveID == target.ID {
+		avail += quotaBytes
+	}
+	if avail < quotaBytes {
+		return ErrNoCapacity
+	}
+	return nil
+}
+
+func (s *UserMigrationService) claim(username string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.active[username]; ok {
+		return false
+	}
+	s.active[username] = struct{}{}
+	return true
+}
+
+func (s *UserMigrationService) release(username string) {
+	s.mu.Lock()
+	delete(s.active, username)
+	s.mu.Unlock()
+}
+
+func isUnfinishedMigration(status string) bool {
+	switch status {
+	case models.UserMigrationPending, models.UserMigrationCopying, models.UserMigrationCleaning:
+		return true
+	}
+	return false
+}
+
+// ── Run ───────────────────────────────────────────────────────────────────────
+
+// run drives m to completion. The caller must have claimed m.Username.
+func (s *UserMigrationService) run(ctx context.Context, m *models.UserMigration) {
+	defer s.release(m.Username)
+	log.Printf("migrate: %s from drive %s to %s", m.Username, m.SourceDriveID, m.TargetDriveID)
+
+	if err := s.migrate(ctx, m); err != nil {
+		log.Printf("migrate: %s failed: %v", m.Username, err)
+		msg := err.Error()
+		if serr := s.queries.SetUserMigrationStatus(ctx, m.ID, models.UserMigrationFailed, &msg); serr != nil {
+			log.Printf("migrate: %v", serr)
+		}
+		return
+	}
+	if err := s.queries.SetUserMigrationStatus(ctx, m.ID, models.UserMigrationDone, nil); err != nil {
+		log.Printf("migrate: %v", err)
+	}
+	log.Printf("migrate: %s done (%d objects, %s)", m.Username, m.CopiedObjects, fmtBytes(m.CopiedBytes))
+}
+
+func (s *UserMigrationService) migrate(ctx context.Context, m *models.UserMigration) error {
+	src, err := storageForDrive(ctx, s.queries, s.registry, m.SourceDriveID)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	dst, err := storageForDrive(ctx, s.queries, s.registry, m.TargetDriveID)
+	if err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	userID, err := s.resolveUserID(ctx, m.Username)
+	if err != nil {
+		return fmt.Errorf("resolve user id: %w", err)
+	}
+	userKey, err := s.files.userKey(ctx, m.Username)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(userKey)
+
+	alloc, err := s.queries.GetUserDrive(ctx, m.Username)
+	if err != nil {
+		return err
+	}
+	flipped := alloc != nil && alloc.DriveID == m.TargetDriveID
+
+	// copied is what was listed for the copy; with the sweep's listing it
+	// names every source object the clean-up below may delete.
+	var copied []migrationObject
+	if !flipped {
+		if err := s.queries.SetUserMigrationStatus(ctx, m.ID, models.UserMigrationCopying, nil); err != nil {
+			return err
+		}
+		objects, err := listUserObjects(ctx, s.queries, userID)
+		if err != nil {
+			return err
+		}
+		copied = objects
+		m.TotalObjects, m.CopiedObjects, m.TotalBytes, m.CopiedBytes = len(objects), 0, 0, 0
+		for _, o := range objects {
+			if info, err := src.StatObject(ctx, o.key); err == nil {
+				m.TotalBytes += info.Size
+			}
+		}
+		for _, o := range objects {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := copyAndVerify(ctx, src, dst, userKey, o)
+			if err != nil {
+				return err
+			}
+			m.CopiedObjects++
+			m.CopiedBytes += n
+			if err := s.queries.UpdateUserMigrationProgress(ctx, m.ID, m.TotalObjects, m.CopiedObjects, m.TotalBytes, m.CopiedBytes); err != nil {
+				log.Printf("migrate: %v", err)
+			}
+		}
+
+		// Flip the allocation, every files.drive_id and the migration status together.
+		q, tx, err := s.queries.ForUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+		if _, err := q.SetFilesDrive(ctx, userID, m.TargetDriveID); err != nil {
+			return err
+		}
+		if err := q.AllocateUserToDrive(ctx, m.Username, m.TargetDriveID); err != nil {
+			return err
+		}
+		// Landing on the replica drive collapses both copies into one; the
+		// replication job picks a new replica drive on its next pass.
+		replica, err := q.GetUserReplicaDrive(ctx, m.Username)
+		if err != nil {
+			return err
+		}
+		if replica != nil && replica.DriveID == m.TargetDriveID {
+			if err := q.DeleteUserReplica(ctx, m.Username); err != nil {
+				return err
+			}
+		}
+		if err := q.SetUserMigrationStatus(ctx, m.ID, models.UserMigrationCleaning, nil); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("flip allocation: commit: %w", err)
+		}
+		s.files.forgetStorage(m.Username)
+		log.Printf("migrate: %s now allocated to drive %s", m.Username, m.TargetDriveID)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(migrationDrainDelay):
+		}
+	}
+
+	// Sweep: uploads that landed on the source between the copy listing and
+	// the flip are copied now. Writers create files rows under a lock on the
+	// allocation and refuse once it has moved (FileService.checkDrive), so an
+	// upload or chunked session still bound to the source cannot add a row
+	// after this point and every object listed here or for the copy can be
+	// deleted below.
+	objects, err := listUserObjects(ctx, s.queries, userID)
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if _, err := dst.StatObject(ctx, o.key); err == nil {
+			continue
+		} else if !isNoSuchKey(err) {
+			return err
+		}
+		if _, err := copyAndVerify(ctx, src, dst, userKey, o); err != nil {
+			return err
+		}
+	}
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := q.SetFilesDrive(ctx, userID, m.TargetDriveID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sweep: commit: %w", err)
+	}
+
+	// Delete the listed keys only, never the "{userID}/" prefix: once the
+	// allocation has flipped the source drive is free to become the user's
+	// replica drive, and its fresh replicas live under the same prefix.
+	replicas, err := s.queries.ListUserReplicas(ctx, m.Username)
+	if err != nil {
+		return err
+	}
+	onSource := make(map[string]bool, len(replicas))
+	for _, r := range replicas {
+		if r.DriveID == m.SourceDriveID {
+			onSource[r.MinIOObjectKey] = true
+		}
+	}
+	var removeErr error
+	removed := make(map[string]bool, len(copied)+len(objects))
+	for _, o := range append(copied, objects...) {
+		if removed[o.key] || onSource[o.key] {
+			continue
+		}
+		removed[o.key] = true
+		if err := src.RemoveObject(ctx, o.key); err != nil && !isNoSuchKey(err) && removeErr == nil {
+			removeErr = err
+		}
+	}
+	return removeErr
+}
+
+// listUserObjects lists every original blob and ready variant owned by userID.
+func listUserObjects(ctx context.Context, q *db.Queries, userID uuid.UUID) ([]migrationObject, error) {
+	files, err := listAllUserFiles(ctx, q, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list files: %w", err)
+	}
+	out := make([]migrationObject, 0, len(files))
+	for _, f := range files {
+		out = append(out, migrationObject{fileID: f.ID, key: f.MinIOObjectKey, nonce: f.Nonce})
+		variants, err := q.ListVideoVariants(ctx, f.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range variants {
+			if v.Status == models.VideoVariantStatusReady {
+				out = append(out, migrationObject{fileID: f.ID, key: v.MinIOObjectKey})
+			}
+		}
+	}
+	return out, nil
+}
+
+// storageForDrive returns the BlobStore for the given drive.
+func storageForDrive(ctx context.Context, q *db.Queries, registry *MinIORegistry, driveID uuid.UUID) (BlobStore, error) {
+	d, err := q.GetDrive(ctx, driveID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("drive %s not found", driveID)
+	}
+	store, ok := registry.Store(d.ServerID, d.MinioBucket)
+	if !ok {
+		return nil, fmt.Errorf("server %s: %w", d.ServerID, ErrStorageUnavailable)
+	}
+	return store, nil
+}
+
+// copyAndVerify makes sure o exists on dst with the same size as on src and
+// that every GCM tag in the dst copy authenticates. An existing dst copy that
+// already verifies is kept, which is what makes migrations resumable. Returns
+// the stored size of the object.
+func copyAndVerify(ctx context.Context, src, dst BlobStore, userKey []byte, o migrationObject) (int64, error) {
+	info, err := src.StatObject(ctx, o.key)
+	if err != nil {
+		if isNoSuchKey(err) {
+			// Deleted by the user after the listing; nothing to move.
+			return 0, nil
+		}
+		return 0, err
+	}
+	if verifyCopy(ctx, dst, userKey, o, info.Size) == nil {
+		return info.Size, nil
+	}
+
+	rc, err := src.GetObject(ctx, o.key)
+	if err != nil {
+		return 0, err
+	}
+	err = dst.PutObject(ctx, o.key, rc, info.Size, "application/octet-stream")
+	rc.Close()
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyCopy(ctx, dst, userKey, o, info.Size); err != nil {
+		return 0, fmt.Errorf("verify %s: %w", o.key, err)
+	}
+	return info.Size, nil
+}
+
+// verifyCopy checks the size of o on storage and authenticates its contents.
+func verifyCopy(ctx context.Context, storage BlobStore, userKey []byte, o migrationObject, size int64) error {
+	info, err := storage.StatObject(ctx, o.key)
+	if err != nil {
+		return err
+	}
+	if info.Size != size {
+		return fmt.Errorf("stored %d bytes, expected %d", info.Size, size)
+	}
+	rc, err := storage.GetObject(ctx, o.key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if len(o.nonce) == 0 {
+		_, err = verifyChunkedStream(userKey, rc)
+		return err
+	}
+	return verifySingleBlob(userKey, o.nonce, rc)
+}
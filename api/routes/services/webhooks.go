@@ -0,0 +1,577 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+)
+
+const (
+	// MaxWebhooksPerUser caps the webhooks one user can register.
+	MaxWebhooksPerUser  = 10
+	maxWebhookURLLength = 2048
+
+	// Webhook request headers. The signature header is
+	// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed by the secret>".
+	WebhookSignatureHeader = "X-Apollo-Signature"
+	WebhookEventHeader     = "X-Apollo-Event"
+	WebhookDeliveryHeader  = "X-Apollo-Delivery"
+
+	webhookWorkers = 2
+	// webhookPollInterval is how often an idle worker looks for due
+	// deliveries. Events heard by this instance wake a worker straight away.
+	webhookPollInterval = 5 * time.Second
+	// webhookMaxAttempts is how often a delivery is tried before it fails.
+	// The delay before a retry starts at webhookRetryBase and quadruples up
+	// to webhookRetryMax, so the last attempt is about 15 hours after the
+	// first.
+	webhookMaxAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = 6 * time.Hour
+	// webhookTimeout bounds one request, connection included.
+	webhookTimeout = 10 * time.Second
+	// webhookLease is how long a claimed delivery is left alone; a delivery
+	// whose worker died is retried after it.
+	webhookLease = 3 * webhookTimeout
+	// maxWebhookErrorLength truncates the error stored in the delivery log.
+	maxWebhookErrorLength = 500
+
+	webhookRetention     = 30 * 24 * time.Hour
+	webhookPruneInterval = time.Hour
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookInvalidURL    = errors.New("url must be an absolute http or https URL without credentials")
+	ErrWebhookPrivateURL    = errors.New("url must not point at a private or local address")
+	ErrWebhookInvalidEvents = errors.New("events must name at least one known event type")
+	ErrWebhookAdminOnly     = errors.New("only admins can subscribe to admin events")
+	ErrWebhookLimit         = fmt.Errorf("a user can register at most %d webhooks", MaxWebhooksPerUser)
+
+	errWebhookBlockedAddress = errors.New("address is private or local")
+)
+
+// webhookUserEvents and webhookAdminEvents are the event types a webhook
+// can subscribe to.
+var (
+	webhookUserEvents = []string{
+		models.WebhookFileUploaded,
+		models.WebhookFileDeleted,
+		models.WebhookVariantReady,
+		models.WebhookQuotaWarning,
+	}
+	webhookAdminEvents = []string{models.WebhookUserBanned}
+)
+
+// cgnatRange is the shared address space of carrier-grade NAT (RFC 6598),
+// which net.IP.IsPrivate does not cover.
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// WebhookInput is a new webhook.
+type WebhookInput struct {
+	URL    string
+	Events []string
+	// FolderID, when set, narrows file events to files directly in it.
+	FolderID *uuid.UUID
+}
+
+// WebhookUpdate changes a webhook; nil fields are left alone.
+type WebhookUpdate struct {
+	URL     *string
+	Events  []string
+	Enabled *bool
+}
+
+// webhookPayload is the JSON body POSTed to an endpoint.
+type webhookPayload struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// ── Service ───────────────────────────────────────────────────────────────────
+
+// WebhookService manages outbound webhooks and delivers their events.
+//
+// Deliveries are queued in webhook_deliveries by the statement that
+// publishes an event, in the event's own transaction (see
+// db.PublishEvent), so none is lost to a crash or a listener outage. A
+// small pool of workers drains the table, POSTing due deliveries with
+// retries and exponential backoff; the EventService wakes them when it
+// hears an event (see Wake) and they poll in between.
+//
+// Endpoints on private, loopback and link-local addresses are refused
+// unless allowPrivate is set, which keeps webhooks from reaching services
+// inside the deployment. The check is made on the address actually dialled,
+// so a DNS name cannot sidestep it.
+type WebhookService struct {
+	queries      *db.Queries
+	kek          []byte
+	client       *http.Client
+	allowPrivate bool
+
+	wake chan struct{}
+}
+
+// NewWebhookService constructs a WebhookService. kek encrypts the webhook
+// secrets at rest. allowPrivate permits endpoints on private and local
+// addresses, e.g. a receiver on the same host during development.
+func NewWebhookService(q *db.Queries, kek []byte, allowPrivate bool) *WebhookService {
+	return &WebhookService{
+		queries:      q,
+		kek:          kek,
+		client:       newWebhookClient(allowPrivate),
+		allowPrivate: allowPrivate,
+		wake:         make(chan struct{}, webhookWorkers),
+	}
+}
+
+// Create registers a webhook for userID and returns it with its secret,
+// which is not shown again. isAdmin allows admin event types.
+func (s *WebhookService) Create(ctx context.Context, userID uuid.UUID, username string, isAdmin bool, in WebhookInput) (*models.Webhook, error) {
+	rawURL, err := s.validateURL(in.URL)
+	if err != nil {
+		return nil, err
+	}
+	events, err := validateWebhookEvents(in.Events, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if in.FolderID != nil {
+		if err := s.checkFolder(ctx, userID, *in.FolderID); err != nil {
+			return nil, err
+		}
+	}
+	n, err := s.queries.CountWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n >= MaxWebhooksPerUser {
+		return nil, ErrWebhookLimit
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	enc, nonce, err := aesGCMEncrypt(s.kek, []byte(secret))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt webhook secret: %w", err)
+	}
+	w, err := s.queries.CreateWebhook(ctx, &models.Webhook{
+		UserID:      userID,
+		Username:    username,
+		URL:         rawURL,
+		SecretEnc:   enc,
+		SecretNonce: nonce,
+		Events:      events,
+		FolderID:    in.FolderID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.Secret = secret
+	return w, nil
+}
+
+// List returns the webhooks of userID.
+func (s *WebhookService) List(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error) {
+	return s.queries.ListWebhooks(ctx, userID)
+}
+
+// Get returns a webhook of userID.
+func (s *WebhookService) Get(ctx context.Context, userID, id uuid.UUID) (*models.Webhook, error) {
+	return s.owned(ctx, userID, id)
+}
+
+// Update changes the url, events or enabled flag of a webhook of userID.
+func (s *WebhookService) Update(ctx context.Context, userID uuid.UUID, isAdmin bool, id uuid.UUID, in WebhookUpdate) (*models.Webhook, error) {
+	w, err := s.owned(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if in.URL != nil {
+		if w.URL, err = s.validateURL(*in.URL); err != nil {
+			return nil, err
+		}
+	}
+	if in.Events != nil {
+		if w.Events, err = validateWebhookEvents(in.Events, isAdmin); err != nil {
+			return nil, err
+		}
+	}
+	if in.Enabled != nil {
+		w.Enabled = *in.Enabled
+	}
+	return s.queries.UpdateWebhook(ctx, w)
+}
+
+// Delete removes a webhook of userID and its delivery log.
+func (s *WebhookService) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	if _, err := s.owned(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.queries.DeleteWebhook(ctx, id)
+}
+
+// Deliveries returns a page of the delivery log of a webhook of userID,
+// newest first.
+func (s *WebhookService) Deliveries(ctx context.Context, userID, id uuid.UUID, page db.PageInput) (*db.PageResult[models.WebhookDelivery], error) {
+	if _, err := s.owned(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	return s.queries.ListWebhookDeliveries(ctx, id, page)
+}
+
+// Test sends a webhook.test event to a webhook of userID right away, even
+// when the webhook is disabled, and returns the logged delivery. A failed
+// test is not retried.
+func (s *WebhookService) Test(ctx context.Context, userID, id uuid.UUID) (*models.WebhookDelivery, error) {
+	w, err := s.owned(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(map[string]uuid.UUID{"webhook_id": w.ID})
+	if err != nil {
+		return nil, err
+	}
+	eventID := uuid.New()
+	payload, err := json.Marshal(webhookPayload{ID: eventID, Type: models.WebhookTest, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.queries.CreateWebhookDelivery(ctx, w.ID, eventID, models.WebhookTest, payload, webhookLease)
+	if err != nil {
+		return nil, err
+	}
+	return s.attempt(ctx, w, d, false)
+}
+
+func (s *WebhookService) owned(ctx context.Context, userID, id uuid.UUID) (*models.Webhook, error) {
+	w, err := s.queries.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil || w.UserID != userID {
+		return nil, ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+// checkFolder returns ErrFolderNotFound unless folderID belongs to userID.
+func (s *WebhookService) checkFolder(ctx context.Context, userID, folderID uuid.UUID) error {
+	q, tx, err := s.queries.ForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	f, err := q.GetFolderByID(ctx, folderID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && f.UserID != userID {
+		return ErrFolderNotFound
+	}
+	return err
+}
+
+// ── Validation ────────────────────────────────────────────────────────────────
+
+// validateURL checks an endpoint URL and returns it normalised.
+func (s *WebhookService) validateURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxWebhookURLLength {
+		return "", ErrWebhookInvalidURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return "", ErrWebhookInvalidURL
+	}
+	u.Fragment = ""
+	if !s.allowPrivate {
+		host := strings.ToLower(u.Hostname())
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return "", ErrWebhookPrivateURL
+		}
+		if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+			return "", ErrWebhookPrivateURL
+		}
+	}
+	return u.String(), nil
+}
+
+// validateWebhookEvents checks a list of event types and returns it sorted
+// without duplicates.
+func validateWebhookEvents(events []string, isAdmin bool) ([]string, error) {
+	out := make([]string, 0, len(events))
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		switch {
+		case slices.Contains(webhookUserEvents, e):
+		case slices.Contains(webhookAdminEvents, e):
+			if !isAdmin {
+				return nil, ErrWebhookAdminOnly
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown event %q", ErrWebhookInvalidEvents, e)
+		}
+		out = append(out, e)
+	}
+	if len(out) == 0 {
+		return nil, ErrWebhookInvalidEvents
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// publicIP reports whether ip is routable on the public internet.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || cgnatRange.Contains(ip))
+}
+
+// secret returns the signing secret of w, decrypting it with the KEK unless
+// it is already held in plain text (a webhook that was just created).
+func (s *WebhookService) secret(w *models.Webhook) (string, error) {
+	if w.Secret != "" {
+		return w.Secret, nil
+	}
+	plain, err := aesGCMDecrypt(s.kek, w.SecretNonce, w.SecretEnc)
+	if err != nil {
+		return "", fmt.Errorf("decrypt webhook secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// ── Workers ───────────────────────────────────────────────────────────────────
+
+// Wake is the EventService sink. The event's deliveries, if any, were
+// queued when it was published; Wake only nudges an idle worker to look
+// for them without waiting for the next poll. It never blocks.
+func (s *WebhookService) Wake(Event) {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the delivery workers and prunes the delivery log until ctx is
+// cancelled.
+func (s *WebhookService) Start(ctx context.Context) {
+	for i := 0; i < webhookWorkers; i++ {
+		go s.worker(ctx)
+	}
+	log.Printf("webhooks: started (%d worker(s))", webhookWorkers)
+
+	ticker := time.NewTicker(webhookPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.queries.DeleteFinishedWebhookDeliveries(ctx, time.Now().Add(-webhookRetention)); err != nil {
+				log.Printf("webhooks: prune: %v", err)
+			} else if n > 0 {
+				log.Printf("webhooks: pruned %d deliveries", n)
+			}
+		}
+	}
+}
+
+// ── Delivery ──────────────────────────────────────────────────────────────────
+
+func (s *WebhookService) worker(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		for s.deliverNext(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverNext claims and attempts one due delivery. Returns false when none
+// was due.
+func (s *WebhookService) deliverNext(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	d, err := s.queries.ClaimWebhookDelivery(ctx, webhookLease)
+	if err != nil {
+		log.Printf("webhooks: claim: %v", err)
+		return false
+	}
+	if d == nil {
+		return false
+	}
+	w, err := s.queries.GetWebhook(ctx, d.WebhookID)
+	if err != nil {
+		// Still claimed: it is retried once the lease runs out.
+		log.Printf("webhooks: delivery %s: %v", d.ID, err)
+		return true
+	}
+	if w == nil {
+		return true // deleted with its deliveries meanwhile
+	}
+	if !w.Enabled {
+		s.finish(ctx, d, models.WebhookDeliveryFailed, 0, errors.New("webhook is disabled"))
+		return true
+	}
+	if _, err := s.attempt(ctx, w, d, d.Attempts < webhookMaxAttempts); err != nil {
+		log.Printf("webhooks: delivery %s: %v", d.ID, err)
+	}
+	return true
+}
+
+// attempt POSTs d to w and records the outcome. A failure is retried after
+// a backoff when retry is set, and fails the delivery otherwise.
+func (s *WebhookService) attempt(ctx context.Context, w *models.Webhook, d *models.WebhookDelivery, retry bool) (*models.WebhookDelivery, error) {
+	code, err := s.send(ctx, w, d)
+	switch {
+	case err == nil:
+		return s.finish(ctx, d, models.WebhookDeliveryDelivered, code, nil)
+	case retry:
+		delay := webhookRetryDelay(d.Attempts)
+		log.Printf("webhooks: delivery %s to %s failed (attempt %d/%d), retrying in %s: %v",
+			d.ID, w.ID, d.Attempts, webhookMaxAttempts, delay, err)
+		return s.finishAt(ctx, d, models.WebhookDeliveryPending, code, err, time.Now().Add(delay))
+	default:
+		return s.finish(ctx, d, models.WebhookDeliveryFailed, code, err)
+	}
+}
+
+func (s *WebhookService) finish(ctx context.Context, d *models.WebhookDelivery, status string, code int, sendErr error) (*models.WebhookDelivery, error) {
+	return s.finishAt(ctx, d, status, code, sendErr, d.NextAttemptAt)
+}
+
+func (s *WebhookService) finishAt(ctx context.Context, d *models.WebhookDelivery, status string, code int, sendErr error, next time.Time) (*models.WebhookDelivery, error) {
+	var msg *string
+	if sendErr != nil {
+		m := sendErr.Error()
+		if len(m) > maxWebhookErrorLength {
+			m = m[:maxWebhookErrorLength]
+		}
+		msg = &m
+	}
+	return s.queries.FinishWebhookDelivery(ctx, d.ID, status, code, msg, next)
+}
+
+// send POSTs the payload of d to the endpoint of w, signed with its secret.
+// Any 2xx answer is a success; redirects are not followed. Returns the
+// status code, or 0 when no response was received.
+func (s *WebhookService) send(ctx context.Context, w *models.Webhook, d *models.WebhookDelivery) (int, error) {
+	secret, err := s.secret(w)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Apollo-SFS-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, d.ID.String())
+	req.Header.Set(WebhookSignatureHeader, signWebhook(secret, time.Now().Unix(), d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the signature header value for body sent at ts.
+func signWebhook(secret string, ts int64, body []byte) string {
+	t := strconv.FormatInt(ts, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay returns the backoff before the retry that follows
+// attempt.
+func webhookRetryDelay(attempt int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempt && delay < webhookRetryMax; i++ {
+		delay *= 4
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// newWebhookClient returns the HTTP client deliveries are sent with. Unless
+// allowPrivate is set it refuses to connect to non-public addresses; the
+// check runs after DNS resolution, on every address dialled.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return errWebhookBlockedAddress
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   webhookTimeout,
+			ResponseHeaderTimeout: webhookTimeout,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+)
+
+var testKEK = bytes.Repeat([]byte{7}, 32)
+
+func TestWebhookSecret(t *testing.T) {
+	s := NewWebhookService(nil, testKEK, false)
+	enc, nonce, err := aesGCMEncrypt(testKEK, []byte("whsec_k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.secret(&models.Webhook{SecretEnc: enc, SecretNonce: nonce})
+	if err != nil || got != "whsec_k" {
+		t.Fatalf("secret = %q, %v; want whsec_k", got, err)
+	}
+
+	other := NewWebhookService(nil, bytes.Repeat([]byte{8}, 32), false)
+	if _, err := other.secret(&models.Webhook{SecretEnc: enc, SecretNonce: nonce}); err == nil {
+		t.Fatal("secret decrypted with the wrong KEK")
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"id":"x"}`)
+	mac := hmac.New(sha256.New, []byte("whsec_k"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := signWebhook("whsec_k", 1700000000, body); got != want {
+		t.Fatalf("signWebhook = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookValidateURL(t *testing.T) {
+	strict := NewWebhookService(nil, testKEK, false)
+	for _, raw := range []string{
+		"ftp://example.com", "/relative", "https://user:pw@example.com", "https://",
+	} {
+		if _, err := strict.validateURL(raw); !errors.Is(err, ErrWebhookInvalidURL) {
+			t.Errorf("%q: expected ErrWebhookInvalidURL, got %v", raw, err)
+		}
+	}
+	for _, raw := range []string{
+		"http://localhost:8080", "http://127.0.0.1/hook", "http://10.0.0.5", "http://[::1]/", "http://169.254.169.254/",
+		"http://100.64.1.1",
+	} {
+		if _, err := strict.validateURL(raw); !errors.Is(err, ErrWebhookPrivateURL) {
+			t.Errorf("%q: expected ErrWebhookPrivateURL, got %v", raw, err)
+		}
+	}
+	if got, err := strict.validateURL(" https://hooks.example.com/a#frag "); err != nil || got != "https://hooks.example.com/a" {
+		t.Errorf("expected normalised public URL, got %q, %v", got, err)
+	}
+
+	lax := NewWebhookService(nil, testKEK, true)
+	if _, err := lax.validateURL("http://127.0.0.1:9000/hook"); err != nil {
+		t.Errorf("allowPrivate: expected loopback to be accepted, got %v", err)
+	}
+}
+
+func TestValidateWebhookEvents(t *testing.T) {
+	got, err := validateWebhookEvents([]string{"variant.ready", "file.uploaded", "variant.ready"}, false)
+	if err != nil || strings.Join(got, ",") != "file.uploaded,variant.ready" {
+		t.Errorf("expected sorted, deduplicated events, got %v, %v", got, err)
+	}
+	if _, err := validateWebhookEvents([]string{"user.banned"}, false); !errors.Is(err, ErrWebhookAdminOnly) {
+		t.Errorf("expected ErrWebhookAdminOnly, got %v", err)
+	}
+	if _, err := validateWebhookEvents([]string{"user.banned"}, true); err != nil {
+		t.Errorf("admin: expected user.banned to be accepted, got %v", err)
+	}
+	if _, err := validateWebhookEvents([]string{"file.renamed"}, false); !errors.Is(err, ErrWebhookInvalidEvents) {
+		t.Errorf("expected ErrWebhookInvalidEvents, got %v", err)
+	}
+	if _, err := validateWebhookEvents(nil, false); !errors.Is(err, ErrWebhookInvalidEvents) {
+		t.Errorf("empty: expected ErrWebhookInvalidEvents, got %v", err)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		1: 30 * time.Second,
+		2: 2 * time.Minute,
+		3: 8 * time.Minute,
+		5: 128 * time.Minute,
+		6: webhookRetryMax,
+		7: webhookRetryMax,
+	}
+	for attempt, want := range cases {
+		if got := webhookRetryDelay(attempt); got != want {
+			t.Errorf("attempt %d: got %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	var gotSig, gotEvent, gotDelivery string
+	var gotBody []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get(WebhookSignatureHeader)
+		gotEvent = r.Header.Get(WebhookEventHeader)
+		gotDelivery = r.Header.Get(WebhookDeliveryHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := NewWebhookService(nil, testKEK, true)
+	hook := &models.Webhook{URL: srv.URL, Secret: "whsec_k"}
+	d := &models.WebhookDelivery{ID: uuid.New(), EventType: models.WebhookTest, Payload: json.RawMessage(`{"type":"webhook.test"}`)}
+
+	code, err := s.send(context.Background(), hook, d)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("send = %d, %v", code, err)
+	}
+	if gotEvent != models.WebhookTest || gotDelivery != d.ID.String() || string(gotBody) != string(d.Payload) {
+		t.Errorf("unexpected request: event=%q delivery=%q body=%s", gotEvent, gotDelivery, gotBody)
+	}
+	ts := strings.TrimPrefix(strings.SplitN(gotSig, ",", 2)[0], "t=")
+	mac := hmac.New(sha256.New, []byte("whsec_k"))
+	mac.Write([]byte(ts + "." + string(gotBody)))
+	if !strings.HasSuffix(gotSig, ",v1="+hex.EncodeToString(mac.Sum(nil))) {
+		t.Errorf("signature %q does not verify", gotSig)
+	}
+
+	status = http.StatusInternalServerError
+	if code, err := s.send(context.Background(), hook, d); err == nil || code != http.StatusInternalServerError {
+		t.Errorf("expected error with 500, got %d, %v", code, err)
+	}
+}
+
+func TestWebhookSendBlocksPrivateAddress(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hit = true }))
+	defer srv.Close()
+
+	s := NewWebhookService(nil, testKEK, false)
+	hook := &models.Webhook{URL: srv.URL, Secret: "whsec_k"}
+	d := &models.WebhookDelivery{ID: uuid.New(), EventType: models.WebhookTest, Payload: json.RawMessage(`{}`)}
+
+	code, err := s.send(context.Background(), hook, d)
+	if !errors.Is(err, errWebhookBlockedAddress) || code != 0 {
+		t.Errorf("expected blocked address error, got %d, %v", code, err)
+	}
+	if hit {
+		t.Error("request must not reach a loopback endpoint")
+	}
+}
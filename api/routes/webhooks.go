@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/services"
+)
+
+type createWebhookRequest struct {
+	URL      string   `json:"url" binding:"required"`
+	Events   []string `json:"events" binding:"required"`
+	FolderID string   `json:"folder_id"`
+}
+
+type updateWebhookRequest struct {
+	URL     *string  `json:"url"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// createdWebhook is the CreateWebhook response: the webhook and its secret,
+// which is not shown again.
+type createdWebhook struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook handles POST /api/v1/webhooks.
+// Registers an endpoint for the given event types: file.uploaded,
+// file.deleted, variant.ready, quota.warning, and for admins user.banned.
+// folder_id narrows file events to the files directly in that folder.
+// Responds 201 with the webhook and the secret its deliveries are signed
+// with.
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+		return
+	}
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url and events are required"})
+		return
+	}
+	in := services.WebhookInput{URL: req.URL, Events: req.Events}
+	if req.FolderID != "" {
+		folderID, err := uuid.Parse(req.FolderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "folder_id must be a valid UUID"})
+			return
+		}
+		in.FolderID = &folderID
+	}
+
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+
+	w, err := h.webhooks.Create(c.Request.Context(), userID, username, hasAdminRole(c), in)
+	if err != nil {
+		h.webhookError(c, "create webhook", err)
+		return
+	}
+
+	h.logAudit(db.AuditInput{
+		TargetUsername: username,
+		ActorUsername:  username,
+		Action:         "webhook_created",
+		ResourceType:   strPtr("webhook"),
+		ResourceID:     &w.ID,
+		ResourceName:   &w.URL,
+	})
+	c.JSON(http.StatusCreated, createdWebhook{Webhook: w, Secret: w.Secret})
+}
+
+// ListWebhooks handles GET /api/v1/webhooks.
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+		return
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	webhooks, err := h.webhooks.List(c.Request.Context(), userID)
+	if err != nil {
+		h.webhookError(c, "list webhooks", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+// GetWebhook handles GET /api/v1/webhooks/:webhook_id.
+func (h *Handler) GetWebhook(c *gin.Context) {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	w, err := h.webhooks.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		h.webhookError(c, "get webhook", err)
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// UpdateWebhook handles PATCH /api/v1/webhooks/:webhook_id.
+// Changes the url, the event types or the enabled flag; omitted fields are
+// left alone. A disabled webhook queues no deliveries.
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	var req updateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	w, err := h.webhooks.Update(c.Request.Context(), userID, hasAdminRole(c), id, services.WebhookUpdate{
+		URL:     req.URL,
+		Events:  req.Events,
+		Enabled: req.Enabled,
+	})
+	if err != nil {
+		h.webhookError(c, "update webhook", err)
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// DeleteWebhook handles DELETE /api/v1/webhooks/:webhook_id.
+// Removes the webhook together with its pending deliveries and log.
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+	username := c.GetString("username")
+
+	if err := h.webhooks.Delete(c.Request.Context(), userID, id); err != nil {
+		h.webhookError(c, "delete webhook", err)
+		return
+	}
+
+	h.logAudit(db.AuditInput{
+		TargetUsername: username,
+		ActorUsername:  username,
+		Action:         "webhook_deleted",
+		ResourceType:   strPtr("webhook"),
+		ResourceID:     &id,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries handles GET /api/v1/webhooks/:webhook_id/deliveries.
+// Returns the delivery log, newest first: each event queued for the webhook,
+// its status, attempts and the last response code or error.
+// Query params: cursor=<opaque>, limit=<int>.
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	p := db.PageInput{Cursor: strings.TrimSpace(c.Query("cursor"))}
+	if raw := c.Query("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			p.Limit = n
+		}
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	result, err := h.webhooks.Deliveries(c.Request.Context(), userID, id, p)
+	if err != nil {
+		h.webhookError(c, "list webhook deliveries", err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// TestWebhook handles POST /api/v1/webhooks/:webhook_id/test.
+// Sends a webhook.test event to the endpoint straight away and responds
+// with the logged delivery; its status says whether the endpoint accepted
+// it. Test deliveries are not retried.
+func (h *Handler) TestWebhook(c *gin.Context) {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	d, err := h.webhooks.Test(c.Request.Context(), userID, id)
+	if err != nil {
+		h.webhookError(c, "test webhook", err)
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// webhookID parses :webhook_id, answering 400 when it is not a UUID.
+func webhookID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("webhook_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook_id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// webhookError maps a WebhookService error to a response.
+func (h *Handler) webhookError(c *gin.Context, op string, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+	case errors.Is(err, services.ErrWebhookInvalidURL),
+		errors.Is(err, services.ErrWebhookPrivateURL),
+		errors.Is(err, services.ErrWebhookInvalidEvents):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrWebhookAdminOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrWebhookLimit):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: user=%s err=%v", op, c.GetString("username"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not " + op})
+	}
+}
+
+// hasAdminRole reports whether the caller has the admin realm role set by
+// RequireAuth.
+func hasAdminRole(c *gin.Context) bool {
+	roles, _ := c.Get("roles")
+	list, _ := roles.([]string)
+	for _, r := range list {
+		if r == "admin" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/admin"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// newBackupsEngine wires the backup routes to an admin handler with the given
+// service (nil leaves it unconfigured).
+func newBackupsEngine(bm admin.BackupManager) *gin.Engine {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+	if bm != nil {
+		admin.SetBackupManager(h, bm)
+	}
+	r := newEngine()
+	ginContext(r, uuid.NewString(), testAdminUsername, true)
+	r.GET("/admin/system/backups", h.ListBackups)
+	r.POST("/admin/system/backups", h.TriggerBackup)
+	r.POST("/admin/system/backups/:backup_id/verify", h.VerifyBackup)
+	return r
+}
+
+func TestAdminBackups_NotConfigured(t *testing.T) {
+	r := newBackupsEngine(nil)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/system/backups", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/system/backups", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/system/backups/"+uuid.NewString()+"/verify", nil),
+	} {
+		w := doRequest(r, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: expected 503, got %d", req.Method, req.URL.Path, w.Code)
+		}
+	}
+}
+
+func TestAdminListBackups(t *testing.T) {
+	ok := models.BackupVerifyOK
+	bm := &stubBackups{
+		status: services.BackupStatus{Target: "s3:backup.example.com/apollo", IntervalHours: 24},
+		runs: []models.BackupRun{
+			{ID: uuid.New(), Status: models.BackupDone, BlobCount: 12, StartedAt: time.Now(), VerifyStatus: &ok},
+			{ID: uuid.New(), Status: models.BackupFailed, StartedAt: time.Now().Add(-24 * time.Hour)},
+		},
+	}
+	r := newBackupsEngine(bm)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/backups", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	var body struct {
+		Status  services.BackupStatus `json:"status"`
+		Backups []models.BackupRun    `json:"backups"`
+	}
+	decodeBody(w, &body) //nolint
+	if body.Status.Target != "s3:backup.example.com/apollo" || body.Status.IntervalHours != 24 {
+		t.Errorf("unexpected status: %+v", body.Status)
+	}
+	if len(body.Backups) != 2 || body.Backups[0].BlobCount != 12 || *body.Backups[0].VerifyStatus != ok {
+		t.Errorf("unexpected backups: %+v", body.Backups)
+	}
+}
+
+func TestAdminListBackups_Errors(t *testing.T) {
+	r := newBackupsEngine(&stubBackups{listErr: fmt.Errorf("db down")})
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/backups", nil)); w.Code != http.StatusInternalServerError {
+		t.Errorf("list error: expected 500, got %d", w.Code)
+	}
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/backups?limit=abc", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("bad limit: expected 400, got %d", w.Code)
+	}
+}
+
+func TestAdminTriggerBackup(t *testing.T) {
+	bm := &stubBackups{}
+	r := newBackupsEngine(bm)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/backups", nil))
+	if w.Code != http.StatusAccepted || bm.triggered != 1 {
+		t.Fatalf("expected 202 and one trigger, got %d / %d", w.Code, bm.triggered)
+	}
+
+	bm.busy = true
+	w = doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/backups", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("busy: expected 409, got %d", w.Code)
+	}
+}
+
+func TestAdminVerifyBackup(t *testing.T) {
+	id := uuid.New()
+	running := models.BackupVerifyRunning
+	bm := &stubBackups{verifyRun: &models.BackupRun{ID: id, Status: models.BackupDone, VerifyStatus: &running}}
+	r := newBackupsEngine(bm)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/backups/"+id.String()+"/verify", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if bm.verifyID != id {
+		t.Errorf("verified %s, want %s", bm.verifyID, id)
+	}
+	var run models.BackupRun
+	decodeBody(w, &run) //nolint
+	if run.VerifyStatus == nil || *run.VerifyStatus != models.BackupVerifyRunning {
+		t.Errorf("unexpected run: %+v", run)
+	}
+}
+
+func TestAdminVerifyBackup_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		err  error
+		want int
+	}{
+		{"invalid id", "/admin/system/backups/not-a-uuid/verify", nil, http.StatusBadRequest},
+		{"unknown backup", "/admin/system/backups/" + uuid.NewString() + "/verify", services.ErrBackupNotFound, http.StatusNotFound},
+		{"failed backup", "/admin/system/backups/" + uuid.NewString() + "/verify", services.ErrBackupNotComplete, http.StatusConflict},
+		{"job running", "/admin/system/backups/" + uuid.NewString() + "/verify", services.ErrBackupBusy, http.StatusConflict},
+		{"db error", "/admin/system/backups/" + uuid.NewString() + "/verify", fmt.Errorf("db down"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newBackupsEngine(&stubBackups{verifyErr: tc.err})
+		w := doRequest(r, httptest.NewRequest(http.MethodPost, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
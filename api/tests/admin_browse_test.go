@@ -11,6 +11,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"apollo-sfs.com/api/db"
 	"apollo-sfs.com/api/models"
 	"apollo-sfs.com/api/routes"
 	"apollo-sfs.com/api/routes/services"
@@ -48,6 +49,37 @@ func TestAdminListUserFolders_Success(t *testing.T) {
 	}
 }
 
+func TestAdminListUserFolders_Filtered(t *testing.T) {
+	q := &stubQuerier{user: sampleUser()}
+	folders := &stubFolderService{}
+	h := browsHandler(q, folders, nil, okKcResolver)
+
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "admin", true)
+	r.GET("/admin/users/:user_id/folders", h.AdminListUserFolders)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/users/alice/folders?type=video&hidden=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !folders.searched || folders.gotFilter.Category != db.CategoryVideo || !folders.gotFilter.Hidden {
+		t.Errorf("expected a filtered search, got searched=%v filter=%+v", folders.searched, folders.gotFilter)
+	}
+}
+
+func TestAdminListUserFolders_InvalidFilter(t *testing.T) {
+	q := &stubQuerier{user: sampleUser()}
+	h := browsHandler(q, &stubFolderService{}, nil, okKcResolver)
+
+	r := newEngine()
+	r.GET("/admin/users/:user_id/folders", h.AdminListUserFolders)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/users/alice/folders?min_size=huge", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
 func TestAdminListUserFolders_UserNotFound(t *testing.T) {
 	q := &stubQuerier{userErr: sql.ErrNoRows}
 	h := browsHandler(q, &stubFolderService{}, nil, okKcResolver)
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/admin"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// newDrainEngine wires the drain routes to an admin handler with the given
+// drainer (nil leaves it unconfigured).
+func newDrainEngine(q *stubAdminQuerier, d admin.DriveDrainer) *gin.Engine {
+	h := newAdminHandler(q, &stubAdminInviteService{})
+	if d != nil {
+		admin.SetDriveDrainer(h, d)
+	}
+	r := newEngine()
+	ginContext(r, uuid.NewString(), testAdminUsername, true)
+	r.GET("/admin/system/servers/:server_id/drives/:drive_id/drain", h.GetDriveDrain)
+	r.POST("/admin/system/servers/:server_id/drives/:drive_id/drain", h.DrainDrive)
+	r.PATCH("/admin/system/servers/:server_id/drives/:drive_id", h.UpdateDrive)
+	return r
+}
+
+func drainURL(driveID string) string {
+	return "/admin/system/servers/" + uuid.NewString() + "/drives/" + driveID + "/drain"
+}
+
+func TestAdminDrainDrive_NotConfigured(t *testing.T) {
+	r := newDrainEngine(&stubAdminQuerier{}, nil)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, drainURL(uuid.NewString()), nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestAdminDrainDrive_Accepted(t *testing.T) {
+	driveID := uuid.New()
+	d := &stubDrainer{progress: &services.DrainProgress{
+		Drive:          models.Drive{ID: driveID, State: models.DriveStateDraining},
+		Running:        true,
+		UsersRemaining: 3,
+		Migrations:     []models.UserMigration{},
+	}}
+	r := newDrainEngine(&stubAdminQuerier{}, d)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, drainURL(driveID.String()), nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if !d.drained || d.driveID != driveID {
+		t.Errorf("expected Drain(%s), got drained=%v drive=%s", driveID, d.drained, d.driveID)
+	}
+	var body services.DrainProgress
+	decodeBody(w, &body) //nolint
+	if body.Drive.State != models.DriveStateDraining || body.UsersRemaining != 3 {
+		t.Errorf("unexpected progress: %+v", body)
+	}
+}
+
+func TestAdminDrainDrive_InvalidID(t *testing.T) {
+	r := newDrainEngine(&stubAdminQuerier{}, &stubDrainer{})
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, drainURL("not-a-uuid"), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestAdminDrainDrive_Retired(t *testing.T) {
+	r := newDrainEngine(&stubAdminQuerier{}, &stubDrainer{err: services.ErrDriveRetired})
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, drainURL(uuid.NewString()), nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+}
+
+func TestAdminGetDriveDrain_NotFound(t *testing.T) {
+	r := newDrainEngine(&stubAdminQuerier{}, &stubDrainer{err: services.ErrDriveNotFound})
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, drainURL(uuid.NewString()), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestAdminUpdateDrive_CannotReactivateDrainingDrive(t *testing.T) {
+	driveID := uuid.New()
+	q := &stubAdminQuerier{drive: &models.Drive{ID: driveID, Label: "nvme-01", State: models.DriveStateDraining}}
+	r := newDrainEngine(q, nil)
+
+	url := "/admin/system/servers/" + uuid.NewString() + "/drives/" + driveID.String()
+	req := httptest.NewRequest(http.MethodPatch, url, jsonBody(map[string]any{"is_active": true}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d (body: %s)", w.Code, w.Body.String())
+	}
+}
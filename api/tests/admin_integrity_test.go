@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/admin"
+)
+
+// ── GET integrity report ──────────────────────────────────────────────────────
+
+func TestAdminGetIntegrityReport_NotConfigured(t *testing.T) {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+
+	r := newEngine()
+	r.GET("/admin/system/integrity", h.GetIntegrityReport)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/integrity", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d (body: %s)", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminGetIntegrityReport_OK(t *testing.T) {
+	q := &stubAdminQuerier{
+		scrubSummary: []models.ScrubStatusCount{
+			{Status: models.ScrubStatusOK, Count: 10},
+			{Status: models.ScrubStatusCorrupt, Count: 2},
+		},
+	}
+	h := newAdminHandler(q, &stubAdminInviteService{})
+	sc := &stubScrubber{}
+	sc.status.Checked = 12
+	sc.status.Failed = 2
+	admin.SetIntegrityScrubber(h, sc)
+
+	r := newEngine()
+	r.GET("/admin/system/integrity", h.GetIntegrityReport)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/integrity", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		Scrub struct {
+			Checked int64 `json:"checked"`
+			Failed  int64 `json:"failed"`
+		} `json:"scrub"`
+		Summary []models.ScrubStatusCount `json:"summary"`
+	}
+	decodeBody(w, &body) //nolint
+	if body.Scrub.Checked != 12 || body.Scrub.Failed != 2 {
+		t.Errorf("unexpected scrub status: %+v", body.Scrub)
+	}
+	if len(body.Summary) != 2 {
+		t.Errorf("expected 2 summary rows, got %d", len(body.Summary))
+	}
+}
+
+// ── GET integrity results ─────────────────────────────────────────────────────
+
+func TestAdminListIntegrityResults_DefaultsToProblems(t *testing.T) {
+	q := &stubAdminQuerier{
+		scrubResults: []models.ScrubResult{
+			{ID: uuid.New(), FileID: uuid.New(), MinIOObjectKey: "a/b", Status: models.ScrubStatusMissing},
+		},
+	}
+	h := newAdminHandler(q, &stubAdminInviteService{})
+
+	r := newEngine()
+	r.GET("/admin/system/integrity/results", h.ListIntegrityResults)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/integrity/results", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if q.scrubStatusArg != "" {
+		t.Errorf("expected empty status filter, got %q", q.scrubStatusArg)
+	}
+	var body struct {
+		Items []models.ScrubResult `json:"items"`
+	}
+	decodeBody(w, &body) //nolint
+	if len(body.Items) != 1 || body.Items[0].Status != models.ScrubStatusMissing {
+		t.Errorf("unexpected items: %+v", body.Items)
+	}
+}
+
+func TestAdminListIntegrityResults_StatusFilter(t *testing.T) {
+	q := &stubAdminQuerier{}
+	h := newAdminHandler(q, &stubAdminInviteService{})
+
+	r := newEngine()
+	r.GET("/admin/system/integrity/results", h.ListIntegrityResults)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/integrity/results?status=corrupt", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if q.scrubStatusArg != models.ScrubStatusCorrupt {
+		t.Errorf("expected status filter %q, got %q", models.ScrubStatusCorrupt, q.scrubStatusArg)
+	}
+}
+
+func TestAdminListIntegrityResults_InvalidStatus(t *testing.T) {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+
+	r := newEngine()
+	r.GET("/admin/system/integrity/results", h.ListIntegrityResults)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/integrity/results?status=bogus", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestAdminListIntegrityResults_DBError(t *testing.T) {
+	h := newAdminHandler(&stubAdminQuerier{scrubResultsErr: errors.New("db down")}, &stubAdminInviteService{})
+
+	r := newEngine()
+	r.GET("/admin/system/integrity/results", h.ListIntegrityResults)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/integrity/results", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
+
+// ── POST integrity scrub ──────────────────────────────────────────────────────
+
+func TestAdminTriggerIntegrityScrub_Accepted(t *testing.T) {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+	sc := &stubScrubber{}
+	admin.SetIntegrityScrubber(h, sc)
+
+	r := newEngine()
+	r.POST("/admin/system/integrity/scrub", h.TriggerIntegrityScrub)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/integrity/scrub", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if sc.triggered != 1 {
+		t.Errorf("expected scrubber to be triggered once, got %d", sc.triggered)
+	}
+}
+
+func TestAdminTriggerIntegrityScrub_AlreadyRunning(t *testing.T) {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+	admin.SetIntegrityScrubber(h, &stubScrubber{busy: true})
+
+	r := newEngine()
+	r.POST("/admin/system/integrity/scrub", h.TriggerIntegrityScrub)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/integrity/scrub", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+}
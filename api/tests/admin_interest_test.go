@@ -232,6 +232,44 @@ func TestAdminProvisionInterest_InviteAlreadyPending(t *testing.T) {
 	}
 }
 
+func TestAdminProvisionInterest_Placement(t *testing.T) {
+	subID := uuid.New()
+	q := &stubAdminQuerier{
+		singleSub: &models.InterestSubmission{
+			ID:    subID,
+			Email: "tiered@example.com",
+		},
+	}
+	inv := &stubAdminInviteService{inv: sampleInvitation()}
+	h := newAdminHandler(q, inv)
+
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "admin", true)
+	r.POST("/admin/interest/:id/provision", h.ProvisionInterestSubmission)
+
+	body := jsonBody(map[string]any{
+		"initial_quota_bytes": 10_000_000_000,
+		"allocation_policy":   services.AllocationTierAware,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/admin/interest/"+subID.String()+"/provision", body)
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if inv.placement.Policy != services.AllocationTierAware {
+		t.Errorf("placement not passed through: %+v", inv.placement)
+	}
+
+	inv.invErr = services.ErrInvalidInvitePlacement
+	w = doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/interest/"+subID.String()+"/provision",
+		jsonBody(map[string]any{"allocation_drive_id": uuid.NewString()})))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid placement: expected 400, got %d", w.Code)
+	}
+}
+
 func TestAdminProvisionInterest_InvalidUUID(t *testing.T) {
 	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
 
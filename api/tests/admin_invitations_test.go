@@ -143,6 +143,55 @@ func TestAdminCreateInvitation_AlreadyPending(t *testing.T) {
 	}
 }
 
+func TestAdminCreateInvitation_Placement(t *testing.T) {
+	inv := &stubAdminInviteService{inv: sampleInvitation()}
+	h := newAdminHandler(&stubAdminQuerier{}, inv)
+
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "admin", true)
+	r.POST("/admin/invitations", h.CreateInvitation)
+
+	driveID := uuid.New()
+	body := jsonBody(map[string]any{
+		"email":               "pinned@example.com",
+		"allocation_drive_id": driveID.String(),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/admin/invitations", body)
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if inv.placement.DriveID == nil || *inv.placement.DriveID != driveID {
+		t.Errorf("placement not passed through: %+v", inv.placement)
+	}
+}
+
+func TestAdminCreateInvitation_InvalidPlacement(t *testing.T) {
+	inv := &stubAdminInviteService{invErr: services.ErrInvalidInvitePlacement}
+	h := newAdminHandler(&stubAdminQuerier{}, inv)
+
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "admin", true)
+	r.POST("/admin/invitations", h.CreateInvitation)
+
+	body := jsonBody(map[string]any{
+		"email":             "newuser@example.com",
+		"allocation_policy": "random",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/admin/invitations", body)
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if inv.placement.Policy != "random" {
+		t.Errorf("policy not passed through: %+v", inv.placement)
+	}
+}
+
 func TestAdminResendInvitation_Valid(t *testing.T) {
 	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
 
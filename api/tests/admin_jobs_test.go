@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/admin"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// newJobsEngine wires the job routes to an admin handler with the given
+// queue (nil leaves it unconfigured).
+func newJobsEngine(jq admin.JobQueue) *gin.Engine {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+	if jq != nil {
+		admin.SetJobQueue(h, jq)
+	}
+	r := newEngine()
+	ginContext(r, uuid.NewString(), testAdminUsername, true)
+	r.GET("/admin/system/jobs", h.ListJobs)
+	r.POST("/admin/system/jobs/:job_id/retry", h.RetryJob)
+	r.POST("/admin/system/jobs/:job_id/cancel", h.CancelJob)
+	r.POST("/admin/system/jobs/backfill", h.BackfillJobs)
+	return r
+}
+
+func TestAdminJobs_NotConfigured(t *testing.T) {
+	r := newJobsEngine(nil)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/system/jobs", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/system/jobs/"+uuid.NewString()+"/retry", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/system/jobs/"+uuid.NewString()+"/cancel", nil),
+	} {
+		w := doRequest(r, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: expected 503, got %d", req.Method, req.URL.Path, w.Code)
+		}
+	}
+}
+
+func TestAdminListJobs(t *testing.T) {
+	jq := &stubJobs{
+		summary: services.JobQueueStatus{Workers: 2, Busy: 1, Counts: []models.JobStatusCount{
+			{Status: models.JobFailed, Count: 1},
+			{Status: models.JobRunning, Count: 1},
+		}},
+		jobs: []models.Job{
+			{ID: uuid.New(), Kind: models.JobKindTranscode, Status: models.JobFailed, Attempts: 3, MaxAttempts: 3},
+		},
+	}
+	r := newJobsEngine(jq)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/jobs?status=failed", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if jq.status != models.JobFailed {
+		t.Errorf("listed status %q, want failed", jq.status)
+	}
+	var body struct {
+		Status services.JobQueueStatus `json:"status"`
+		Jobs   []models.Job            `json:"jobs"`
+	}
+	decodeBody(w, &body) //nolint
+	if body.Status.Workers != 2 || body.Status.Busy != 1 || len(body.Status.Counts) != 2 {
+		t.Errorf("unexpected status: %+v", body.Status)
+	}
+	if len(body.Jobs) != 1 || body.Jobs[0].Kind != models.JobKindTranscode || body.Jobs[0].Attempts != 3 {
+		t.Errorf("unexpected jobs: %+v", body.Jobs)
+	}
+}
+
+func TestAdminListJobs_Errors(t *testing.T) {
+	r := newJobsEngine(&stubJobs{})
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/jobs?status=stuck", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("bad status: expected 400, got %d", w.Code)
+	}
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/jobs?limit=abc", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("bad limit: expected 400, got %d", w.Code)
+	}
+
+	r = newJobsEngine(&stubJobs{listErr: fmt.Errorf("db down")})
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/jobs", nil)); w.Code != http.StatusInternalServerError {
+		t.Errorf("list error: expected 500, got %d", w.Code)
+	}
+}
+
+func TestAdminRetryJob(t *testing.T) {
+	id := uuid.New()
+	jq := &stubJobs{job: &models.Job{ID: id, Status: models.JobQueued}}
+	r := newJobsEngine(jq)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/jobs/"+id.String()+"/retry", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if jq.retried != id {
+		t.Errorf("retried %s, want %s", jq.retried, id)
+	}
+	var job models.Job
+	decodeBody(w, &job) //nolint
+	if job.Status != models.JobQueued {
+		t.Errorf("unexpected job: %+v", job)
+	}
+}
+
+func TestAdminCancelJob(t *testing.T) {
+	id := uuid.New()
+	jq := &stubJobs{job: &models.Job{ID: id, Status: models.JobCancelled}}
+	r := newJobsEngine(jq)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/jobs/"+id.String()+"/cancel", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if jq.cancelled != id {
+		t.Errorf("cancelled %s, want %s", jq.cancelled, id)
+	}
+}
+
+func TestAdminJobActions_Errors(t *testing.T) {
+	cases := []struct {
+		name   string
+		action string
+		id     string
+		err    error
+		want   int
+	}{
+		{"retry invalid id", "retry", "not-a-uuid", nil, http.StatusBadRequest},
+		{"retry unknown job", "retry", uuid.NewString(), services.ErrJobNotFound, http.StatusNotFound},
+		{"retry running job", "retry", uuid.NewString(), services.ErrJobNotRetryable, http.StatusConflict},
+		{"retry duplicate", "retry", uuid.NewString(), services.ErrJobDuplicate, http.StatusConflict},
+		{"retry db error", "retry", uuid.NewString(), fmt.Errorf("db down"), http.StatusInternalServerError},
+		{"cancel invalid id", "cancel", "not-a-uuid", nil, http.StatusBadRequest},
+		{"cancel unknown job", "cancel", uuid.NewString(), services.ErrJobNotFound, http.StatusNotFound},
+		{"cancel finished job", "cancel", uuid.NewString(), services.ErrJobFinished, http.StatusConflict},
+		{"cancel db error", "cancel", uuid.NewString(), fmt.Errorf("db down"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newJobsEngine(&stubJobs{retryErr: tc.err, cancelErr: tc.err})
+		w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/jobs/"+tc.id+"/"+tc.action, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
+
+func TestAdminBackfillJobs(t *testing.T) {
+	jq := &stubJobs{}
+	r := newJobsEngine(jq)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/system/jobs/backfill", strings.NewReader(`{"kind":"text_index"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if jq.backfilled != models.JobKindTextIndex {
+		t.Errorf("backfilled %q, want text_index", jq.backfilled)
+	}
+}
+
+func TestAdminBackfillJobs_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		err  error
+		want int
+	}{
+		{"missing kind", `{}`, nil, http.StatusBadRequest},
+		{"no backfill", `{"kind":"transcode"}`, services.ErrJobNoBackfill, http.StatusBadRequest},
+		{"already running", `{"kind":"text_index"}`, services.ErrJobBackfillRunning, http.StatusConflict},
+		{"other error", `{"kind":"text_index"}`, fmt.Errorf("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newJobsEngine(&stubJobs{backfillErr: tc.err})
+		req := httptest.NewRequest(http.MethodPost, "/admin/system/jobs/backfill", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		if w := doRequest(r, req); w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/admin"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// newMigrationEngine wires the migrate routes to an admin handler with the
+// given migrator (nil leaves it unconfigured).
+func newMigrationEngine(m admin.UserMigrator) *gin.Engine {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+	if m != nil {
+		admin.SetUserMigrator(h, m)
+	}
+	r := newEngine()
+	ginContext(r, uuid.NewString(), testAdminUsername, true)
+	r.GET("/admin/users/:user_id/migrate", h.GetUserMigration)
+	r.POST("/admin/users/:user_id/migrate", h.MigrateUser)
+	return r
+}
+
+func TestAdminMigrateUser_NotConfigured(t *testing.T) {
+	r := newMigrationEngine(nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/alice/migrate", jsonBody(map[string]string{"drive_id": uuid.NewString()}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestAdminMigrateUser_Accepted(t *testing.T) {
+	driveID := uuid.New()
+	m := &stubMigrator{migration: &models.UserMigration{
+		ID: uuid.New(), Username: "alice", TargetDriveID: driveID, Status: models.UserMigrationPending,
+	}}
+	r := newMigrationEngine(m)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/alice/migrate", jsonBody(map[string]string{"drive_id": driveID.String()}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if m.username != "alice" || m.driveID != driveID || m.startedBy != testAdminUsername {
+		t.Errorf("unexpected Migrate args: user=%q drive=%s by=%q", m.username, m.driveID, m.startedBy)
+	}
+}
+
+func TestAdminMigrateUser_InvalidDriveID(t *testing.T) {
+	r := newMigrationEngine(&stubMigrator{})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/alice/migrate", jsonBody(map[string]string{"drive_id": "nope"}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestAdminMigrateUser_ErrorMapping(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("GetUserByUsername: %w", sql.ErrNoRows), http.StatusNotFound},
+		{services.ErrMigrationInvalidTarget, http.StatusBadRequest},
+		{services.ErrMigrationNoAllocation, http.StatusBadRequest},
+		{services.ErrMigrationInProgress, http.StatusConflict},
+		{services.ErrNoCapacity, http.StatusConflict},
+		{services.ErrMigrationTargetOffline, http.StatusConflict},
+		{fmt.Errorf("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newMigrationEngine(&stubMigrator{migrateErr: tc.err})
+		req := httptest.NewRequest(http.MethodPost, "/admin/users/alice/migrate", jsonBody(map[string]string{"drive_id": uuid.NewString()}))
+		w := doRequest(r, req)
+		if w.Code != tc.want {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.want, w.Code)
+		}
+	}
+}
+
+func TestAdminGetUserMigration_NotFound(t *testing.T) {
+	r := newMigrationEngine(&stubMigrator{})
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/users/alice/migrate", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestAdminGetUserMigration_Progress(t *testing.T) {
+	m := &stubMigrator{migration: &models.UserMigration{
+		ID: uuid.New(), Username: "alice", Status: models.UserMigrationCopying,
+		TotalObjects: 10, CopiedObjects: 4,
+	}}
+	r := newMigrationEngine(m)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/users/alice/migrate", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	var body models.UserMigration
+	decodeBody(w, &body) //nolint
+	if body.Status != models.UserMigrationCopying || body.CopiedObjects != 4 || body.TotalObjects != 10 {
+		t.Errorf("unexpected migration: %+v", body)
+	}
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes/admin"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// newReconcileEngine wires the reconcile routes to an admin handler with the
+// given reconciler (nil leaves it unconfigured).
+func newReconcileEngine(rec admin.StorageReconciler) *gin.Engine {
+	h := newAdminHandler(&stubAdminQuerier{}, &stubAdminInviteService{})
+	if rec != nil {
+		admin.SetStorageReconciler(h, rec)
+	}
+	r := newEngine()
+	r.GET("/admin/system/reconcile", h.GetReconcileStatus)
+	r.POST("/admin/system/reconcile", h.TriggerReconcile)
+	return r
+}
+
+func TestAdminGetReconcileStatus_NotConfigured(t *testing.T) {
+	r := newReconcileEngine(nil)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/reconcile", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestAdminGetReconcileStatus_OK(t *testing.T) {
+	id := uuid.New()
+	rec := &stubReconciler{status: services.ReconcileStatus{
+		Report: &services.ReconcileReport{ID: id, Mode: services.ReconcileDryRun},
+	}}
+	r := newReconcileEngine(rec)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/reconcile", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	var body services.ReconcileStatus
+	decodeBody(w, &body) //nolint
+	if body.Report == nil || body.Report.ID != id {
+		t.Errorf("expected report %s, got %+v", id, body.Report)
+	}
+}
+
+func TestAdminTriggerReconcile_DryRun(t *testing.T) {
+	rec := &stubReconciler{}
+	r := newReconcileEngine(rec)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/system/reconcile", jsonBody(map[string]string{"mode": "dry_run"}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if rec.mode != services.ReconcileDryRun {
+		t.Errorf("expected mode dry_run, got %q", rec.mode)
+	}
+}
+
+func TestAdminTriggerReconcile_ApplyRequiresReportID(t *testing.T) {
+	rec := &stubReconciler{}
+	r := newReconcileEngine(rec)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/system/reconcile", jsonBody(map[string]string{"mode": "delete"}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if rec.mode != "" {
+		t.Errorf("reconciler should not have been triggered, got mode %q", rec.mode)
+	}
+}
+
+func TestAdminTriggerReconcile_Quarantine(t *testing.T) {
+	rec := &stubReconciler{}
+	r := newReconcileEngine(rec)
+	id := uuid.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/system/reconcile",
+		jsonBody(map[string]string{"mode": "quarantine", "report_id": id.String()}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if rec.mode != services.ReconcileQuarantine || rec.reportID != id {
+		t.Errorf("unexpected trigger args: mode=%q report=%s", rec.mode, rec.reportID)
+	}
+}
+
+func TestAdminTriggerReconcile_StaleReport(t *testing.T) {
+	rec := &stubReconciler{triggerErr: services.ErrReconcileNoDryRun}
+	r := newReconcileEngine(rec)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/system/reconcile",
+		jsonBody(map[string]string{"mode": "delete", "report_id": uuid.NewString()}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+}
+
+func TestAdminTriggerReconcile_InvalidMode(t *testing.T) {
+	r := newReconcileEngine(&stubReconciler{})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/system/reconcile", jsonBody(map[string]string{"mode": "purge"}))
+	w := doRequest(r, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
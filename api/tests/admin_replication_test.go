@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes/admin"
+	"apollo-sfs.com/api/routes/services"
+)
+
+// newReplicationEngine wires the replication routes to an admin handler with
+// the given service (nil leaves it unconfigured).
+func newReplicationEngine(q *stubAdminQuerier, rm admin.ReplicationManager) *gin.Engine {
+	h := newAdminHandler(q, &stubAdminInviteService{})
+	if rm != nil {
+		admin.SetReplicationManager(h, rm)
+	}
+	r := newEngine()
+	ginContext(r, uuid.NewString(), testAdminUsername, true)
+	r.GET("/admin/system/replication", h.GetReplicationStatus)
+	r.POST("/admin/system/replication/repair", h.TriggerReplicationRepair)
+	r.POST("/admin/system/servers/:server_id/drives/:drive_id/replaced", h.MarkDriveReplaced)
+	r.PUT("/admin/users/:user_id/replication", h.SetUserReplication)
+	return r
+}
+
+func TestAdminReplication_NotConfigured(t *testing.T) {
+	r := newReplicationEngine(&stubAdminQuerier{}, nil)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/system/replication", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/system/replication/repair", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/system/servers/"+uuid.NewString()+"/drives/"+uuid.NewString()+"/replaced", nil),
+		httptest.NewRequest(http.MethodPut, "/admin/users/alice/replication", jsonBody(map[string]int{"factor": 2})),
+	} {
+		w := doRequest(r, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: expected 503, got %d", req.Method, req.URL.Path, w.Code)
+		}
+	}
+}
+
+func TestAdminGetReplicationStatus(t *testing.T) {
+	q := &stubAdminQuerier{replicaSummary: []models.ReplicaStatusCount{
+		{Status: models.FileReplicaOK, Count: 40},
+		{Status: models.FileReplicaFailed, Count: 2},
+	}}
+	rm := &stubReplication{status: services.ReplicationStatus{DefaultFactor: 1, PremiumFactor: 2, Replicated: 5}}
+	r := newReplicationEngine(q, rm)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/replication", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	var body struct {
+		Repair  services.ReplicationStatus  `json:"repair"`
+		Summary []models.ReplicaStatusCount `json:"summary"`
+	}
+	decodeBody(w, &body) //nolint
+	if body.Repair.PremiumFactor != 2 || body.Repair.Replicated != 5 {
+		t.Errorf("unexpected repair status: %+v", body.Repair)
+	}
+	if len(body.Summary) != 2 || body.Summary[1].Count != 2 {
+		t.Errorf("unexpected summary: %+v", body.Summary)
+	}
+}
+
+func TestAdminGetReplicationStatus_DBError(t *testing.T) {
+	q := &stubAdminQuerier{replicaSummaryErr: fmt.Errorf("db down")}
+	r := newReplicationEngine(q, &stubReplication{})
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/admin/system/replication", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
+
+func TestAdminTriggerReplicationRepair(t *testing.T) {
+	rm := &stubReplication{}
+	r := newReplicationEngine(&stubAdminQuerier{}, rm)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/replication/repair", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+	if rm.triggered != 1 {
+		t.Errorf("expected 1 trigger, got %d", rm.triggered)
+	}
+
+	rm.busy = true
+	w = doRequest(r, httptest.NewRequest(http.MethodPost, "/admin/system/replication/repair", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while running, got %d", w.Code)
+	}
+}
+
+func TestAdminMarkDriveReplaced(t *testing.T) {
+	driveID := uuid.New()
+	rm := &stubReplication{replicas: 12, primaries: 3}
+	r := newReplicationEngine(&stubAdminQuerier{}, rm)
+
+	url := "/admin/system/servers/" + uuid.NewString() + "/drives/" + driveID.String() + "/replaced"
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, url, nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if rm.driveID != driveID {
+		t.Errorf("expected DriveReplaced(%s), got %s", driveID, rm.driveID)
+	}
+	var body map[string]int64
+	decodeBody(w, &body) //nolint
+	if body["replicas_queued"] != 12 || body["primaries_queued"] != 3 {
+		t.Errorf("unexpected body: %v", body)
+	}
+}
+
+func TestAdminMarkDriveReplaced_Errors(t *testing.T) {
+	cases := []struct {
+		driveID string
+		err     error
+		want    int
+	}{
+		{"nope", nil, http.StatusBadRequest},
+		{uuid.NewString(), services.ErrDriveNotFound, http.StatusNotFound},
+		{uuid.NewString(), fmt.Errorf("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newReplicationEngine(&stubAdminQuerier{}, &stubReplication{replaceErr: tc.err})
+		url := "/admin/system/servers/" + uuid.NewString() + "/drives/" + tc.driveID + "/replaced"
+		w := doRequest(r, httptest.NewRequest(http.MethodPost, url, nil))
+		if w.Code != tc.want {
+			t.Errorf("drive %q err %v: expected %d, got %d", tc.driveID, tc.err, tc.want, w.Code)
+		}
+	}
+}
+
+func TestAdminSetUserReplication(t *testing.T) {
+	rm := &stubReplication{}
+	r := newReplicationEngine(&stubAdminQuerier{}, rm)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPut, "/admin/users/alice/replication", jsonBody(map[string]int{"factor": 2})))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if rm.username != "alice" || rm.factor == nil || *rm.factor != 2 {
+		t.Errorf("unexpected SetUserFactor args: user=%q factor=%v", rm.username, rm.factor)
+	}
+}
+
+func TestAdminSetUserReplication_ClearOverride(t *testing.T) {
+	rm := &stubReplication{}
+	r := newReplicationEngine(&stubAdminQuerier{}, rm)
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/users/alice/replication", strings.NewReader(`{"factor": null}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if rm.username != "alice" || rm.factor != nil {
+		t.Errorf("expected the override to be cleared, got factor=%v", rm.factor)
+	}
+}
+
+func TestAdminSetUserReplication_ErrorMapping(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{services.ErrInvalidReplicationFactor, http.StatusBadRequest},
+		{fmt.Errorf("SetUserReplicationFactor: %w", sql.ErrNoRows), http.StatusNotFound},
+		{fmt.Errorf("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newReplicationEngine(&stubAdminQuerier{}, &stubReplication{factorErr: tc.err})
+		w := doRequest(r, httptest.NewRequest(http.MethodPut, "/admin/users/alice/replication", jsonBody(map[string]int{"factor": 3})))
+		if w.Code != tc.want {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func newArchiveEngine(h *routes.Handler, userID string) *gin.Engine {
+	r := newEngine()
+	ginContext(r, userID, "alice", false)
+	r.POST("/archives", h.CreateArchive)
+	r.GET("/archives/:archive_id/download/p", h.DownloadArchivePresigned)
+	return r
+}
+
+// ── CreateArchive ─────────────────────────────────────────────────────────────
+
+func TestCreateArchive_NotConfigured(t *testing.T) {
+	r := newArchiveEngine(newArchiveHandler(nil), uuid.NewString())
+	req := httptest.NewRequest(http.MethodPost, "/archives", jsonBody(map[string]any{"file_ids": []string{uuid.NewString()}}))
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestCreateArchive_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		body any
+		err  error
+		want int
+	}{
+		{"bad ids", map[string]any{"file_ids": []string{"not-a-uuid"}}, nil, http.StatusBadRequest},
+		{"empty", map[string]any{}, services.ErrArchiveEmpty, http.StatusBadRequest},
+		{"too large", map[string]any{}, services.ErrArchiveTooLarge, http.StatusBadRequest},
+		{"file missing", map[string]any{}, services.ErrNotFound, http.StatusNotFound},
+		{"folder missing", map[string]any{}, services.ErrFolderNotFound, http.StatusNotFound},
+		{"db down", map[string]any{}, errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		h := newArchiveHandler(&stubArchiveService{createErr: tc.err})
+		r := newArchiveEngine(h, uuid.NewString())
+		w := doRequest(r, httptest.NewRequest(http.MethodPost, "/archives", jsonBody(tc.body)))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
+
+func TestCreateArchive_Success(t *testing.T) {
+	stub := &stubArchiveService{}
+	r := newArchiveEngine(newArchiveHandler(stub), uuid.NewString())
+
+	fileID := uuid.New()
+	req := httptest.NewRequest(http.MethodPost, "/archives", jsonBody(map[string]any{
+		"file_ids": []string{fileID.String()},
+		"name":     "  holiday ",
+	}))
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if stub.gotName != "holiday" || len(stub.gotFiles) != 1 || stub.gotFiles[0] != fileID {
+		t.Errorf("Create called with name=%q files=%v", stub.gotName, stub.gotFiles)
+	}
+
+	var body map[string]any
+	decodeBody(w, &body) //nolint
+	url, _ := body["download_url"].(string)
+	if !strings.HasPrefix(url, "/api/v1/archives/"+stub.archive.ID.String()+"/download/p?token=") {
+		t.Errorf("download_url = %q", url)
+	}
+	if body["name"] != "selection.zip" || body["expires_at"] == nil {
+		t.Errorf("response missing expected fields: %v", body)
+	}
+}
+
+// ── DownloadArchivePresigned ──────────────────────────────────────────────────
+
+func TestDownloadArchivePresigned_Success(t *testing.T) {
+	userID := uuid.New()
+	stub := &stubArchiveService{content: "PK\x05\x06"}
+	h := newArchiveHandler(stub)
+	r := newArchiveEngine(h, userID.String())
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/archives", jsonBody(map[string]any{"file_ids": []string{uuid.NewString()}})))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", w.Code)
+	}
+	var created map[string]any
+	decodeBody(w, &created) //nolint
+
+	w = doRequest(r, httptest.NewRequest(http.MethodGet, created["download_url"].(string)[len("/api/v1"):], nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="selection.zip"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if w.Body.String() != stub.content {
+		t.Errorf("body = %q", w.Body.String())
+	}
+}
+
+func TestDownloadArchivePresigned_Errors(t *testing.T) {
+	userID := uuid.New()
+	archive := &services.Archive{ID: uuid.New(), UserID: userID, Name: "a.zip", ExpiresAt: time.Now().Add(time.Hour)}
+
+	presignSvc := services.NewPresignService(testPresignSecret)
+	valid, _, _ := presignSvc.IssueForFile(archive.ID.String(), userID.String(), "alice", services.PresignActionArchive, time.Hour)
+	otherArchive, _, _ := presignSvc.IssueForFile(uuid.NewString(), userID.String(), "alice", services.PresignActionArchive, time.Hour)
+	download, _, _ := presignSvc.IssueForFile(archive.ID.String(), userID.String(), "alice", services.PresignActionDownload, time.Hour)
+	expired, _, _ := presignSvc.IssueForFile(archive.ID.String(), userID.String(), "alice", services.PresignActionArchive, -time.Minute)
+	otherUser, _, _ := presignSvc.IssueForFile(archive.ID.String(), uuid.NewString(), "bob", services.PresignActionArchive, time.Hour)
+
+	base := "/archives/" + archive.ID.String() + "/download/p"
+	cases := []struct {
+		name string
+		path string
+		err  error
+		want int
+	}{
+		{"bad id", "/archives/nope/download/p?token=" + valid, nil, http.StatusBadRequest},
+		{"missing token", base, nil, http.StatusUnauthorized},
+		{"garbage token", base + "?token=bad.token", nil, http.StatusUnauthorized},
+		{"other archive", base + "?token=" + otherArchive, nil, http.StatusUnauthorized},
+		{"download token", base + "?token=" + download, nil, http.StatusUnauthorized},
+		{"expired", base + "?token=" + expired, nil, http.StatusGone},
+		{"other user", base + "?token=" + otherUser, nil, http.StatusNotFound},
+		{"archive expired", base + "?token=" + valid, services.ErrNotFound, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		h := newArchiveHandler(&stubArchiveService{archive: archive, getErr: tc.err})
+		r := newArchiveEngine(h, userID.String())
+		w := doRequest(r, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
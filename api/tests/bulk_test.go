@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func newBulkEngine(h *routes.Handler) *gin.Engine {
+	r := newEngine()
+	ginContext(r, uuid.NewString(), "alice", false)
+	r.POST("/bulk", h.Bulk)
+	return r
+}
+
+func TestBulk_NotConfigured(t *testing.T) {
+	r := newBulkEngine(newBulkHandler(nil))
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/bulk", jsonBody(map[string]any{"op": "hide"})))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestBulk_Success(t *testing.T) {
+	stub := &stubBulkService{}
+	r := newBulkEngine(newBulkHandler(stub))
+
+	fileID, folderID, target := uuid.New(), uuid.New(), uuid.New()
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/bulk", jsonBody(map[string]any{
+		"op":         "move",
+		"file_ids":   []string{fileID.String()},
+		"folder_ids": []string{folderID.String()},
+		"folder_id":  target.String(),
+	})))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	in := stub.got
+	if in.Op != services.BulkMove || in.Username != "alice" || len(in.FileIDs) != 1 || in.FileIDs[0] != fileID ||
+		len(in.FolderIDs) != 1 || in.FolderIDs[0] != folderID || in.TargetFolderID == nil || *in.TargetFolderID != target {
+		t.Errorf("Apply called with %+v", in)
+	}
+
+	var body services.BulkResult
+	decodeBody(w, &body) //nolint
+	if body.Op != "move" || body.Succeeded != 1 || len(body.Items) != 1 || !body.Items[0].OK {
+		t.Errorf("unexpected response: %+v", body)
+	}
+}
+
+func TestBulk_PartialFailure(t *testing.T) {
+	ok, missing := uuid.New(), uuid.New()
+	stub := &stubBulkService{result: &services.BulkResult{
+		Op:        services.BulkDelete,
+		Succeeded: 1,
+		Failed:    1,
+		Items: []services.BulkItemResult{
+			{ID: ok, Type: "file", OK: true},
+			{ID: missing, Type: "file", Error: services.ErrNotFound.Error()},
+		},
+	}}
+	r := newBulkEngine(newBulkHandler(stub))
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/bulk", jsonBody(map[string]any{
+		"op":       "delete",
+		"file_ids": []string{ok.String(), missing.String()},
+	})))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body services.BulkResult
+	decodeBody(w, &body) //nolint
+	if body.Failed != 1 || body.Items[1].OK || body.Items[1].Error != "file not found" {
+		t.Errorf("unexpected response: %+v", body)
+	}
+}
+
+func TestBulk_Errors(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   any
+		err    error
+		expect int
+	}{
+		{"missing op", map[string]any{"file_ids": []string{uuid.NewString()}}, nil, http.StatusBadRequest},
+		{"bad id", map[string]any{"op": "hide", "file_ids": []string{"nope"}}, nil, http.StatusBadRequest},
+		{"empty", map[string]any{"op": "hide"}, services.ErrBulkEmpty, http.StatusBadRequest},
+		{"too large", map[string]any{"op": "hide"}, services.ErrBulkTooLarge, http.StatusBadRequest},
+		{"unknown op", map[string]any{"op": "explode"}, services.ErrBulkOperation, http.StatusBadRequest},
+		{"no target", map[string]any{"op": "move"}, services.ErrBulkNoTarget, http.StatusBadRequest},
+		{"target missing", map[string]any{"op": "move"}, services.ErrFolderNotFound, http.StatusNotFound},
+		{"db down", map[string]any{"op": "hide"}, errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newBulkEngine(newBulkHandler(&stubBulkService{err: tc.err}))
+		w := doRequest(r, httptest.NewRequest(http.MethodPost, "/bulk", jsonBody(tc.body)))
+		if w.Code != tc.expect {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.expect, w.Code)
+		}
+	}
+}
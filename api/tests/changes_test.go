@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func newChangeEngine(h *routes.Handler) *gin.Engine {
+	r := newEngine()
+	ginContext(r, uuid.NewString(), "alice", false)
+	r.GET("/changes", h.ListChanges)
+	return r
+}
+
+func TestListChanges_NotConfigured(t *testing.T) {
+	r := newChangeEngine(newChangeHandler(nil))
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/changes", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestListChanges_Success(t *testing.T) {
+	fileID := uuid.New()
+	stub := &stubChangeService{page: &services.ChangePage{
+		Changes: []models.Change{{Seq: 8, ItemType: models.ChangeItemFile, ItemID: fileID, Op: models.ChangeRename, Name: "b.txt"}},
+		Cursor:  "8",
+		HasMore: true,
+	}}
+	r := newChangeEngine(newChangeHandler(stub))
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/changes?cursor=7&limit=1", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if stub.gotCursor != "7" || stub.gotLimit != 1 {
+		t.Errorf("List called with cursor %q, limit %d", stub.gotCursor, stub.gotLimit)
+	}
+
+	var body struct {
+		Changes []map[string]any `json:"changes"`
+		Cursor  string           `json:"cursor"`
+		HasMore bool             `json:"has_more"`
+	}
+	decodeBody(w, &body) //nolint
+	if body.Cursor != "8" || !body.HasMore || len(body.Changes) != 1 {
+		t.Fatalf("unexpected response: %+v", body)
+	}
+	if c := body.Changes[0]; c["id"] != fileID.String() || c["type"] != "file" || c["op"] != "rename" || c["seq"] != float64(8) {
+		t.Errorf("unexpected change: %v", c)
+	}
+}
+
+func TestListChanges_NoCursor(t *testing.T) {
+	stub := &stubChangeService{}
+	r := newChangeEngine(newChangeHandler(stub))
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/changes", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if stub.gotCursor != "" || stub.gotLimit != 0 {
+		t.Errorf("List called with cursor %q, limit %d", stub.gotCursor, stub.gotLimit)
+	}
+}
+
+func TestListChanges_Errors(t *testing.T) {
+	cases := []struct {
+		name   string
+		query  string
+		err    error
+		expect int
+	}{
+		{"bad limit", "?limit=abc", nil, http.StatusBadRequest},
+		{"zero limit", "?limit=0", nil, http.StatusBadRequest},
+		{"invalid cursor", "?cursor=x", services.ErrChangeCursorInvalid, http.StatusBadRequest},
+		{"expired cursor", "?cursor=1", services.ErrChangeCursorExpired, http.StatusGone},
+		{"service error", "?cursor=1", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newChangeEngine(newChangeHandler(&stubChangeService{err: tc.err}))
+		w := doRequest(r, httptest.NewRequest(http.MethodGet, "/changes"+tc.query, nil))
+		if w.Code != tc.expect {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.expect, w.Code)
+		}
+	}
+}
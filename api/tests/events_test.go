@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"apollo-sfs.com/api/routes"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func newEventEngine(h *routes.Handler, userID string) *gin.Engine {
+	r := newEngine()
+	ginContext(r, userID, "alice", false)
+	r.GET("/events", h.StreamEvents)
+	return r
+}
+
+func TestStreamEvents_NotConfigured(t *testing.T) {
+	r := newEventEngine(newEventHandler(nil), uuid.NewString())
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestStreamEvents_TooManyStreams(t *testing.T) {
+	stub := &stubEventService{err: services.ErrTooManyEventStreams}
+	r := newEventEngine(newEventHandler(stub), uuid.NewString())
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+}
+
+func TestStreamEvents_SubscribeError(t *testing.T) {
+	stub := &stubEventService{err: errors.New("boom")}
+	r := newEventEngine(newEventHandler(stub), uuid.NewString())
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
+
+func TestStreamEvents_PushesUserEvents(t *testing.T) {
+	userID := uuid.New()
+	stub := &stubEventService{ch: make(chan []byte, 1), unsubscribed: make(chan struct{})}
+	srv := httptest.NewServer(newEventEngine(newEventHandler(stub), userID.String()))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/events", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if stub.gotUser != userID {
+		t.Errorf("subscribed user %s; want %s", stub.gotUser, userID)
+	}
+
+	event := `{"type":"file.uploaded","data":{"name":"a.txt"}}`
+	stub.ch <- []byte(event)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(msg) != event {
+		t.Errorf("got %s; want %s", msg, event)
+	}
+
+	conn.Close()
+	select {
+	case <-stub.unsubscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not unsubscribed after the client disconnected")
+	}
+}
+
+func TestStreamEvents_Origin(t *testing.T) {
+	stub := &stubEventService{ch: make(chan []byte, 1), unsubscribed: make(chan struct{})}
+	srv := httptest.NewServer(newEventEngine(newEventHandler(stub), uuid.NewString()))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/events"
+
+	for _, origin := range []string{"https://evil.example.com", "http://files.example.com", "null"} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {origin}})
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("origin %q: expected 403, got %v", origin, err)
+		}
+	}
+	if stub.gotUser != uuid.Nil {
+		t.Error("a rejected origin must not subscribe")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"https://FILES.example.com"}})
+	if err != nil {
+		t.Fatalf("dial from app origin: %v", err)
+	}
+	conn.Close()
+}
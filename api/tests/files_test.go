@@ -3,9 +3,11 @@ package tests
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"apollo-sfs.com/api/models"
@@ -75,6 +77,266 @@ func TestGetFile_Success(t *testing.T) {
 	}
 }
 
+func TestGetFile_MediaMetadata(t *testing.T) {
+	file := sampleFile()
+	width, lat := 4032, 37.775
+	h := newFileHandler(&stubFileService{file: file, media: &models.MediaMetadata{Width: &width, Latitude: &lat}})
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/files/:file_id", h.GetFile)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/files/"+file.ID.String(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	var body struct {
+		MediaMetadata map[string]any `json:"media_metadata"`
+	}
+	decodeBody(w, &body) //nolint
+	if body.MediaMetadata["width"] != float64(4032) || body.MediaMetadata["latitude"] != 37.775 {
+		t.Errorf("media_metadata = %v", body.MediaMetadata)
+	}
+}
+
+// ── StripFileLocation ─────────────────────────────────────────────────────────
+
+func TestStripFileLocation_Success(t *testing.T) {
+	file := sampleFile()
+	lat, long := 37.775, -122.42
+	h := newFileHandler(&stubFileService{file: file, media: &models.MediaMetadata{Latitude: &lat, Longitude: &long}})
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.POST("/files/:file_id/strip-location", h.StripFileLocation)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/files/"+file.ID.String()+"/strip-location", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	var body struct {
+		ID            string         `json:"id"`
+		MediaMetadata map[string]any `json:"media_metadata"`
+	}
+	decodeBody(w, &body) //nolint
+	if body.ID != file.ID.String() || body.MediaMetadata["latitude"] != nil || body.MediaMetadata["longitude"] != nil {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+}
+
+func TestStripFileLocation_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		err  error
+		want int
+	}{
+		{"invalid id", "/files/not-a-uuid/strip-location", nil, http.StatusBadRequest},
+		{"unknown file", "/files/" + uuid.NewString() + "/strip-location", services.ErrNotFound, http.StatusNotFound},
+		{"unsupported type", "/files/" + uuid.NewString() + "/strip-location", services.ErrLocationUnsupported, http.StatusUnprocessableEntity},
+		{"storage down", "/files/" + uuid.NewString() + "/strip-location", services.ErrStorageUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		h := newFileHandler(&stubFileService{file: sampleFile(), stripErr: tc.err})
+		r := newEngine()
+		ginContext(r, uuid.New().String(), "alice", false)
+		r.POST("/files/:file_id/strip-location", h.StripFileLocation)
+
+		w := doRequest(r, httptest.NewRequest(http.MethodPost, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
+
+// ── GetThumbnail ──────────────────────────────────────────────────────────────
+
+func TestGetThumbnail_Success(t *testing.T) {
+	file := sampleFile()
+	fs := &stubFileService{file: file, thumb: []byte("\xff\xd8jpeg")}
+	h := newFileHandler(fs)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/files/:file_id/thumbnail", h.GetThumbnail)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/"+file.ID.String()+"/thumbnail?size=large", nil)
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if w.Body.String() != "\xff\xd8jpeg" || fs.thumbSize != services.ThumbnailLarge {
+		t.Errorf("unexpected thumbnail %q for size %q", w.Body.String(), fs.thumbSize)
+	}
+
+	// size defaults to small.
+	doRequest(r, httptest.NewRequest(http.MethodGet, "/files/"+file.ID.String()+"/thumbnail", nil))
+	if fs.thumbSize != services.ThumbnailSmall {
+		t.Errorf("default size = %q", fs.thumbSize)
+	}
+}
+
+func TestGetThumbnail_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		path    string
+		fileErr error
+		err     error
+		want    int
+	}{
+		{"invalid id", "/files/not-a-uuid/thumbnail", nil, nil, http.StatusBadRequest},
+		{"invalid size", "/files/" + uuid.NewString() + "/thumbnail?size=huge", nil, nil, http.StatusBadRequest},
+		{"unknown file", "/files/" + uuid.NewString() + "/thumbnail", services.ErrNotFound, nil, http.StatusNotFound},
+		{"pending", "/files/" + uuid.NewString() + "/thumbnail", nil, services.ErrThumbnailPending, http.StatusAccepted},
+		{"unsupported type", "/files/" + uuid.NewString() + "/thumbnail", nil, services.ErrNotFound, http.StatusNotFound},
+		{"storage down", "/files/" + uuid.NewString() + "/thumbnail", nil, services.ErrStorageUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		h := newFileHandler(&stubFileService{file: sampleFile(), fileErr: tc.fileErr, thumbErr: tc.err})
+		r := newEngine()
+		ginContext(r, uuid.New().String(), "alice", false)
+		r.GET("/files/:file_id/thumbnail", h.GetThumbnail)
+
+		w := doRequest(r, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
+
+// ── HLS ───────────────────────────────────────────────────────────────────────
+
+// newHLSEngine registers the master playlist and asset routes side by side,
+// as cmd/main.go does.
+func newHLSEngine(fs *stubFileService) *gin.Engine {
+	h := newFileHandlerWithPresign(fs)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/files/:file_id/hls/master.m3u8", h.GetHLSMaster)
+	r.GET("/files/:file_id/hls/:rendition/:name", h.GetHLSAsset)
+	return r
+}
+
+func TestGetHLSMaster_Success(t *testing.T) {
+	file := sampleFile()
+	fs := &stubFileService{file: file, hlsRenditions: []services.HLSRendition{
+		{Name: "360p", Height: 360, VideoKbps: 800},
+		{Name: "720p", Height: 720, VideoKbps: 2800},
+	}}
+	r := newHLSEngine(fs)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/files/"+file.ID.String()+"/hls/master.m3u8", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != services.HLSPlaylistMimeType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "#EXTM3U\n") || strings.Count(body, "#EXT-X-STREAM-INF:") != 2 {
+		t.Fatalf("unexpected playlist:\n%s", body)
+	}
+
+	// The rendition URL is relative to the master and carries a token the
+	// asset route accepts without a session.
+	var uri string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "720p/") {
+			uri = line
+		}
+	}
+	if !strings.HasPrefix(uri, "720p/index.m3u8?token=") {
+		t.Fatalf("no signed 720p entry in:\n%s", body)
+	}
+	fs.hlsAsset = []byte("#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:6.0,\nseg_00000.m4s\n#EXT-X-ENDLIST\n")
+	w = doRequest(r, httptest.NewRequest(http.MethodGet, "/files/"+file.ID.String()+"/hls/"+uri, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for rendition playlist, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if fs.hlsAssetName != "720p/index.m3u8" {
+		t.Errorf("served %q", fs.hlsAssetName)
+	}
+	token := strings.TrimPrefix(uri, "720p/index.m3u8?token=")
+	if !strings.Contains(w.Body.String(), "seg_00000.m4s?token="+token+"\n") ||
+		!strings.Contains(w.Body.String(), `URI="init.mp4?token=`+token+`"`) {
+		t.Errorf("segments not signed:\n%s", w.Body.String())
+	}
+}
+
+func TestGetHLSMaster_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		fileErr error
+		err     error
+		want    int
+	}{
+		{"unknown file", services.ErrNotFound, nil, http.StatusNotFound},
+		{"pending", nil, services.ErrHLSPending, http.StatusAccepted},
+		{"not a video", nil, services.ErrNotFound, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		r := newHLSEngine(&stubFileService{file: sampleFile(), fileErr: tc.fileErr, hlsErr: tc.err})
+		w := doRequest(r, httptest.NewRequest(http.MethodGet, "/files/"+uuid.NewString()+"/hls/master.m3u8", nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
+
+func TestGetHLSAsset_Segment(t *testing.T) {
+	file := sampleFile()
+	fs := &stubFileService{file: file, hlsAsset: []byte("segment")}
+	r := newHLSEngine(fs)
+
+	presignSvc := services.NewPresignService(testPresignSecret)
+	token, _, _ := presignSvc.IssueForFile(file.ID.String(), file.UserID.String(), "alice", services.PresignActionHLS, time.Hour)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/files/"+file.ID.String()+"/hls/1080p/seg_00042.m4s?token="+token, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "segment" || fs.hlsAssetName != "1080p/seg_00042.m4s" {
+		t.Errorf("served %q as %q", w.Body.String(), fs.hlsAssetName)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "video/iso.segment" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestGetHLSAsset_Errors(t *testing.T) {
+	file := sampleFile()
+	presignSvc := services.NewPresignService(testPresignSecret)
+	valid, _, _ := presignSvc.IssueForFile(file.ID.String(), file.UserID.String(), "alice", services.PresignActionHLS, time.Hour)
+	otherFile, _, _ := presignSvc.IssueForFile(uuid.NewString(), file.UserID.String(), "alice", services.PresignActionHLS, time.Hour)
+	download, _, _ := presignSvc.IssueForFile(file.ID.String(), file.UserID.String(), "alice", services.PresignActionDownload, time.Hour)
+	expired, _, _ := presignSvc.IssueForFile(file.ID.String(), file.UserID.String(), "alice", services.PresignActionHLS, -time.Minute)
+
+	base := "/files/" + file.ID.String() + "/hls/"
+	cases := []struct {
+		name string
+		path string
+		err  error
+		want int
+	}{
+		{"missing token", base + "720p/init.mp4", nil, http.StatusUnauthorized},
+		{"other file", base + "720p/init.mp4?token=" + otherFile, nil, http.StatusUnauthorized},
+		{"download token", base + "720p/init.mp4?token=" + download, nil, http.StatusUnauthorized},
+		{"expired", base + "720p/init.mp4?token=" + expired, nil, http.StatusGone},
+		{"unknown rendition", base + "4k/init.mp4?token=" + valid, nil, http.StatusNotFound},
+		{"unknown asset", base + "720p/secret.bin?token=" + valid, nil, http.StatusNotFound},
+		{"not ready", base + "720p/seg_00001.m4s?token=" + valid, services.ErrNotFound, http.StatusNotFound},
+		{"storage down", base + "720p/seg_00001.m4s?token=" + valid, services.ErrStorageUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		r := newHLSEngine(&stubFileService{file: file, hlsAsset: []byte("x"), hlsErr: tc.err})
+		w := doRequest(r, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
+
 // ── DeleteFile ────────────────────────────────────────────────────────────────
 
 func TestDeleteFile_InvalidUUID(t *testing.T) {
@@ -184,6 +446,58 @@ func TestUpdateFile_Success(t *testing.T) {
 	}
 }
 
+// ── SetFileTags ───────────────────────────────────────────────────────────────
+
+func TestSetFileTags_MissingTags(t *testing.T) {
+	h := newFileHandler(nil)
+	r := newEngine()
+	r.PUT("/files/:file_id/tags", h.SetFileTags)
+
+	req := httptest.NewRequest(http.MethodPut, "/files/"+uuid.New().String()+"/tags", jsonBody(map[string]any{}))
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestSetFileTags_InvalidTag(t *testing.T) {
+	h := newFileHandler(&stubFileService{fileErr: services.ErrInvalidTag})
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.PUT("/files/:file_id/tags", h.SetFileTags)
+
+	req := httptest.NewRequest(http.MethodPut, "/files/"+uuid.New().String()+"/tags", jsonBody(map[string]any{"tags": []string{" "}}))
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestSetFileTags_Success(t *testing.T) {
+	file := sampleFile()
+	file.Tags = []string{"holiday"}
+	files := &stubFileService{file: file}
+	h := newFileHandler(files)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.PUT("/files/:file_id/tags", h.SetFileTags)
+
+	req := httptest.NewRequest(http.MethodPut, "/files/"+file.ID.String()+"/tags", jsonBody(map[string]any{"tags": []string{"Holiday"}}))
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if len(files.gotTags) != 1 || files.gotTags[0] != "Holiday" {
+		t.Errorf("service got tags %v", files.gotTags)
+	}
+}
+
 // ── MoveFile ──────────────────────────────────────────────────────────────────
 
 func TestMoveFile_InvalidFileUUID(t *testing.T) {
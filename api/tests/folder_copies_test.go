@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func newFolderCopyEngine(h *routes.Handler) *gin.Engine {
+	r := newEngine()
+	ginContext(r, uuid.NewString(), "alice", false)
+	r.POST("/folders/:folder_id/copy", h.CopyFolder)
+	r.GET("/folders/copies/:copy_id", h.GetFolderCopy)
+	return r
+}
+
+func copyRequest(folderID string, body any) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/folders/"+folderID+"/copy", nil)
+	if body != nil {
+		req = httptest.NewRequest(http.MethodPost, "/folders/"+folderID+"/copy", jsonBody(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// ── CopyFolder ────────────────────────────────────────────────────────────────
+
+func TestCopyFolder_NotConfigured(t *testing.T) {
+	r := newFolderCopyEngine(newFolderCopyHandler(nil))
+	w := doRequest(r, copyRequest(uuid.NewString(), nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestCopyFolder_Success(t *testing.T) {
+	stub := &stubFolderCopyService{}
+	r := newFolderCopyEngine(newFolderCopyHandler(stub))
+
+	folderID, parentID := uuid.New(), uuid.New()
+	w := doRequest(r, copyRequest(folderID.String(), map[string]string{"parent_id": parentID.String()}))
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if stub.got.FolderID != folderID || stub.got.ParentID == nil || *stub.got.ParentID != parentID || stub.got.Username != "alice" {
+		t.Errorf("Start called with %+v", stub.got)
+	}
+
+	var body map[string]any
+	decodeBody(w, &body) //nolint
+	if body["id"] != stub.status.ID.String() || body["folder_id"] != stub.status.FolderID.String() || body["status"] != services.FolderCopyQueued {
+		t.Errorf("unexpected response: %v", body)
+	}
+}
+
+func TestCopyFolder_ToRoot(t *testing.T) {
+	for _, body := range []any{nil, map[string]string{}} {
+		stub := &stubFolderCopyService{}
+		r := newFolderCopyEngine(newFolderCopyHandler(stub))
+		w := doRequest(r, copyRequest(uuid.NewString(), body))
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("body %v: expected 202, got %d", body, w.Code)
+		}
+		if stub.got.ParentID != nil {
+			t.Errorf("body %v: parent = %v; want root", body, stub.got.ParentID)
+		}
+	}
+}
+
+func TestCopyFolder_BadRequests(t *testing.T) {
+	cases := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"bad folder id", copyRequest("nope", nil)},
+		{"bad parent id", copyRequest(uuid.NewString(), map[string]string{"parent_id": "nope"})},
+		{"bad body", copyRequest(uuid.NewString(), "not an object")},
+	}
+	for _, tc := range cases {
+		r := newFolderCopyEngine(newFolderCopyHandler(&stubFolderCopyService{}))
+		w := doRequest(r, tc.req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tc.name, w.Code)
+		}
+	}
+}
+
+func TestCopyFolder_ServiceErrors(t *testing.T) {
+	cases := []struct {
+		err    error
+		expect int
+	}{
+		{services.ErrFolderNotFound, http.StatusNotFound},
+		{services.ErrFolderCopyInProgress, http.StatusConflict},
+		{services.ErrFolderCopyCycle, http.StatusConflict},
+		{services.ErrDuplicateFolderName, http.StatusConflict},
+		{services.ErrQuotaExceeded, http.StatusRequestEntityTooLarge},
+		{services.ErrFolderCopyTooLarge, http.StatusBadRequest},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newFolderCopyEngine(newFolderCopyHandler(&stubFolderCopyService{startErr: tc.err}))
+		w := doRequest(r, copyRequest(uuid.NewString(), nil))
+		if w.Code != tc.expect {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.expect, w.Code)
+		}
+	}
+}
+
+// ── GetFolderCopy ─────────────────────────────────────────────────────────────
+
+func TestGetFolderCopy(t *testing.T) {
+	stub := &stubFolderCopyService{}
+	r := newFolderCopyEngine(newFolderCopyHandler(stub))
+	if w := doRequest(r, copyRequest(uuid.NewString(), nil)); w.Code != http.StatusAccepted {
+		t.Fatalf("start: expected 202, got %d", w.Code)
+	}
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/folders/copies/"+stub.status.ID.String(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body map[string]any
+	decodeBody(w, &body) //nolint
+	if body["name"] != "Photos (copy)" {
+		t.Errorf("unexpected response: %v", body)
+	}
+
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/folders/copies/"+uuid.NewString(), nil)); w.Code != http.StatusNotFound {
+		t.Errorf("unknown copy: expected 404, got %d", w.Code)
+	}
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/folders/copies/nope", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("bad id: expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/routes"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func newImportEngine(h *routes.Handler) *gin.Engine {
+	r := newEngine()
+	ginContext(r, uuid.NewString(), "alice", false)
+	r.POST("/files/import-archive", h.ImportArchive)
+	r.GET("/files/import-archive/:import_id", h.GetArchiveImport)
+	return r
+}
+
+// importRequest builds a multipart import request. fields are written in
+// order before the file part; an empty fileName omits the file.
+func importRequest(fields [][2]string, fileName, content string) *http.Request {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, f := range fields {
+		_ = mw.WriteField(f[0], f[1])
+	}
+	if fileName != "" {
+		fw, _ := mw.CreateFormFile("file", fileName)
+		_, _ = fw.Write([]byte(content))
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/files/import-archive", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// ── ImportArchive ─────────────────────────────────────────────────────────────
+
+func TestImportArchive_NotConfigured(t *testing.T) {
+	r := newImportEngine(newImportHandler(nil))
+	w := doRequest(r, importRequest(nil, "takeout.zip", "PK"))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestImportArchive_Success(t *testing.T) {
+	stub := &stubImportService{}
+	r := newImportEngine(newImportHandler(stub))
+
+	folderID := uuid.New()
+	w := doRequest(r, importRequest([][2]string{{"folder_id", folderID.String()}}, "takeout.zip", "PK\x03\x04data"))
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if stub.got.FolderID == nil || *stub.got.FolderID != folderID || stub.got.Name != "takeout.zip" || stub.got.Username != "alice" {
+		t.Errorf("Start called with %+v", stub.got)
+	}
+	if stub.gotBody != "PK\x03\x04data" {
+		t.Errorf("archive body = %q", stub.gotBody)
+	}
+
+	var body map[string]any
+	decodeBody(w, &body) //nolint
+	if body["id"] != stub.status.ID.String() || body["status"] != services.ImportQueued {
+		t.Errorf("unexpected response: %v", body)
+	}
+}
+
+func TestImportArchive_BadRequests(t *testing.T) {
+	cases := []struct {
+		name   string
+		req    *http.Request
+		expect int
+	}{
+		{"not multipart", httptest.NewRequest(http.MethodPost, "/files/import-archive", jsonBody(map[string]string{})), http.StatusBadRequest},
+		{"no file", importRequest([][2]string{{"folder_id", uuid.NewString()}}, "", ""), http.StatusBadRequest},
+		{"bad folder", importRequest([][2]string{{"folder_id", "nope"}}, "a.zip", "PK"), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		r := newImportEngine(newImportHandler(&stubImportService{}))
+		w := doRequest(r, tc.req)
+		if w.Code != tc.expect {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.expect, w.Code)
+		}
+	}
+}
+
+func TestImportArchive_ServiceErrors(t *testing.T) {
+	cases := []struct {
+		err    error
+		expect int
+	}{
+		{services.ErrImportInProgress, http.StatusConflict},
+		{services.ErrImportTooLarge, http.StatusRequestEntityTooLarge},
+		{services.ErrQuotaExceeded, http.StatusRequestEntityTooLarge},
+		{services.ErrImportFormat, http.StatusBadRequest},
+		{services.ErrImportTooManyEntries, http.StatusBadRequest},
+		{services.ErrImportBomb, http.StatusBadRequest},
+		{services.ErrImportInterrupted, http.StatusBadRequest},
+		{services.ErrFolderNotFound, http.StatusNotFound},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		r := newImportEngine(newImportHandler(&stubImportService{startErr: tc.err}))
+		w := doRequest(r, importRequest(nil, "a.zip", "PK"))
+		if w.Code != tc.expect {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.expect, w.Code)
+		}
+	}
+}
+
+// ── GetArchiveImport ──────────────────────────────────────────────────────────
+
+func TestGetArchiveImport(t *testing.T) {
+	stub := &stubImportService{}
+	r := newImportEngine(newImportHandler(stub))
+	if w := doRequest(r, importRequest(nil, "a.tar.gz", "\x1f\x8b")); w.Code != http.StatusAccepted {
+		t.Fatalf("start: expected 202, got %d", w.Code)
+	}
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/files/import-archive/"+stub.status.ID.String(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body map[string]any
+	decodeBody(w, &body) //nolint
+	if body["name"] != "a.tar.gz" {
+		t.Errorf("unexpected response: %v", body)
+	}
+
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/files/import-archive/"+uuid.NewString(), nil)); w.Code != http.StatusNotFound {
+		t.Errorf("unknown import: expected 404, got %d", w.Code)
+	}
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/files/import-archive/nope", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("bad id: expected 400, got %d", w.Code)
+	}
+}
@@ -3,10 +3,12 @@ package tests
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 
+	"apollo-sfs.com/api/db"
 	"apollo-sfs.com/api/models"
 	"apollo-sfs.com/api/routes"
 	"apollo-sfs.com/api/routes/services"
@@ -85,6 +87,167 @@ func TestGetMediaFolder_Success(t *testing.T) {
 	}
 }
 
+// ── Timeline and map views ──────────────────────────────────────────────────
+
+func TestGetMediaTimeline_Success(t *testing.T) {
+	folders := &stubFolderService{timeline: []db.TimelineBucket{{Period: "2024-05-17", Count: 3}}}
+	h := newMediaHandler(nil, folders, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/timeline", h.GetMediaTimeline)
+
+	req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/timeline?granularity=day&tz=Europe/Paris", nil)
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if folders.gotGranularity != db.TimelineDay || folders.gotTZ != "Europe/Paris" {
+		t.Errorf("service got granularity %q tz %q", folders.gotGranularity, folders.gotTZ)
+	}
+	var body struct {
+		Granularity string              `json:"granularity"`
+		Buckets     []db.TimelineBucket `json:"buckets"`
+	}
+	if err := decodeBody(w, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Granularity != "day" || len(body.Buckets) != 1 || body.Buckets[0].Count != 3 {
+		t.Errorf("unexpected body %+v", body)
+	}
+}
+
+func TestGetMediaTimeline_Defaults(t *testing.T) {
+	folders := &stubFolderService{}
+	h := newMediaHandler(nil, folders, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/timeline", h.GetMediaTimeline)
+
+	req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/timeline", nil)
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if folders.gotGranularity != db.TimelineMonth || folders.gotTZ != "UTC" {
+		t.Errorf("service got granularity %q tz %q", folders.gotGranularity, folders.gotTZ)
+	}
+}
+
+func TestGetMediaTimeline_BadParams(t *testing.T) {
+	h := newMediaHandler(nil, &stubFolderService{}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/timeline", h.GetMediaTimeline)
+
+	for _, q := range []string{"granularity=week", "tz=Mars/Olympus", "tz=Local"} {
+		req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/timeline?"+q, nil)
+		if w := doRequest(r, req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestGetMediaTimeline_NotMediaCollection(t *testing.T) {
+	h := newMediaHandler(nil, &stubFolderService{folderErr: services.ErrNotMediaCollection}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/timeline", h.GetMediaTimeline)
+
+	req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/timeline", nil)
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestGetMediaGeo_Success(t *testing.T) {
+	fileID := uuid.New()
+	folders := &stubFolderService{clusters: []db.GeoCluster{{Latitude: 48.85, Longitude: 2.29, Count: 4, FileID: fileID}}}
+	h := newMediaHandler(nil, folders, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/geo", h.GetMediaGeo)
+
+	// West > east: a box crossing the antimeridian is accepted as-is.
+	req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/geo?bbox=170,-50,-170,10&grid=8", nil)
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	want := db.BBox{West: 170, South: -50, East: -170, North: 10}
+	if folders.gotBBox != want || folders.gotGrid != 8 {
+		t.Errorf("service got bbox %+v grid %d", folders.gotBBox, folders.gotGrid)
+	}
+	var body struct {
+		Clusters []db.GeoCluster `json:"clusters"`
+	}
+	if err := decodeBody(w, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Clusters) != 1 || body.Clusters[0].FileID != fileID || body.Clusters[0].Count != 4 {
+		t.Errorf("unexpected clusters %+v", body.Clusters)
+	}
+}
+
+func TestGetMediaGeo_DefaultsToWorld(t *testing.T) {
+	folders := &stubFolderService{}
+	h := newMediaHandler(nil, folders, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/geo", h.GetMediaGeo)
+
+	req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/geo", nil)
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if folders.gotBBox != (db.BBox{West: -180, South: -90, East: 180, North: 90}) || folders.gotGrid != 32 {
+		t.Errorf("service got bbox %+v grid %d", folders.gotBBox, folders.gotGrid)
+	}
+}
+
+func TestGetMediaGeo_BadParams(t *testing.T) {
+	h := newMediaHandler(nil, &stubFolderService{}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/geo", h.GetMediaGeo)
+
+	for _, q := range []string{
+		"bbox=1,2,3",       // too few values
+		"bbox=a,b,c,d",     // not numbers
+		"bbox=0,10,20,5",   // south above north
+		"bbox=0,-95,20,5",  // latitude out of range
+		"bbox=10,0,10,5",   // zero width
+		"bbox=-190,0,10,5", // longitude out of range
+		"grid=0",
+		"grid=500",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/geo?"+q, nil)
+		if w := doRequest(r, req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestGetMediaGeo_NotFound(t *testing.T) {
+	h := newMediaHandler(nil, &stubFolderService{folderErr: services.ErrFolderNotFound}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/folders/:folder_id/media/geo", h.GetMediaGeo)
+
+	req := httptest.NewRequest(http.MethodGet, "/folders/"+uuid.New().String()+"/media/geo", nil)
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
 // ── Hide / unhide ─────────────────────────────────────────────────────────────
 
 func TestHideFile_InvalidUUID(t *testing.T) {
@@ -301,3 +464,140 @@ func TestUpdatePreferences_AcceptsMediaFolder(t *testing.T) {
 		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
 	}
 }
+
+func TestUpdatePreferences_RecordLocationOff(t *testing.T) {
+	// Opting out of location recording clears the user's stored coordinates.
+	q := &stubQuerier{}
+	h := newMediaHandler(nil, &stubFolderService{}, q)
+	userID := uuid.New()
+	r := newEngine()
+	ginContext(r, userID.String(), "alice", false)
+	r.PUT("/me/preferences", h.UpdatePreferences)
+
+	req := httptest.NewRequest(http.MethodPut, "/me/preferences", jsonBody(map[string]any{"media_autoupload_folder_id": nil, "record_location": false}))
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	var body map[string]any
+	decodeBody(w, &body) //nolint
+	if body["record_location"] != false {
+		t.Errorf("record_location = %v", body["record_location"])
+	}
+	if q.clearedLocations == nil || *q.clearedLocations != userID {
+		t.Errorf("stored locations not cleared for %s", userID)
+	}
+
+	// Leaving the field out changes nothing.
+	q.clearedLocations = nil
+	req = httptest.NewRequest(http.MethodPut, "/me/preferences", jsonBody(map[string]any{"media_autoupload_folder_id": nil}))
+	req.Header.Set("Content-Type", "application/json")
+	doRequest(r, req)
+	if q.clearedLocations != nil {
+		t.Error("locations cleared without record_location in the body")
+	}
+}
+
+// ── Duplicate photos ──────────────────────────────────────────────────────────
+
+func TestGetMediaDuplicates_Success(t *testing.T) {
+	keep := uuid.New()
+	files := &stubFileService{duplicates: []services.DuplicateCluster{{
+		KeepFileID:       keep,
+		Files:            []db.HashedImage{{FileID: keep, SizeBytes: 300}, {FileID: uuid.New(), SizeBytes: 200}},
+		TotalBytes:       500,
+		ReclaimableBytes: 200,
+	}}}
+	h := newMediaHandler(files, nil, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/me/media/duplicates", h.GetMediaDuplicates)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/me/media/duplicates?threshold=7", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if files.gotThreshold != 7 {
+		t.Errorf("service got threshold %d, want 7", files.gotThreshold)
+	}
+	var body struct {
+		Clusters []services.DuplicateCluster `json:"clusters"`
+	}
+	if err := decodeBody(w, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Clusters) != 1 || body.Clusters[0].KeepFileID != keep || len(body.Clusters[0].Files) != 2 {
+		t.Errorf("unexpected clusters %+v", body.Clusters)
+	}
+}
+
+func TestGetMediaDuplicates_Threshold(t *testing.T) {
+	files := &stubFileService{}
+	h := newMediaHandler(files, nil, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/me/media/duplicates", h.GetMediaDuplicates)
+
+	if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/me/media/duplicates", nil)); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if files.gotThreshold != services.DefaultDuplicateThreshold {
+		t.Errorf("default threshold = %d", files.gotThreshold)
+	}
+	for _, q := range []string{"threshold=-1", "threshold=11", "threshold=abc"} {
+		if w := doRequest(r, httptest.NewRequest(http.MethodGet, "/me/media/duplicates?"+q, nil)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestResolveMediaDuplicates_Success(t *testing.T) {
+	files := &stubFileService{}
+	h := newMediaHandler(files, nil, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.POST("/me/media/duplicates/resolve", h.ResolveMediaDuplicates)
+
+	keep, discard := uuid.New(), uuid.New()
+	body := `{"action": "hide", "groups": [{"keep": "` + keep.String() + `", "discard": ["` + discard.String() + `"]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/me/media/duplicates/resolve", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if files.gotAction != services.DuplicateHide || len(files.gotDupeGroups) != 1 ||
+		files.gotDupeGroups[0].Keep != keep || files.gotDupeGroups[0].Discard[0] != discard {
+		t.Errorf("service got %q %+v", files.gotAction, files.gotDupeGroups)
+	}
+	var res services.DuplicateResolution
+	if err := decodeBody(w, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Resolved != 1 {
+		t.Errorf("resolved = %d, want 1", res.Resolved)
+	}
+}
+
+func TestResolveMediaDuplicates_BadRequest(t *testing.T) {
+	h := newMediaHandler(&stubFileService{}, nil, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.POST("/me/media/duplicates/resolve", h.ResolveMediaDuplicates)
+
+	for _, body := range []string{
+		`{"action": "trash", "groups": []}`,
+		`{"groups": []}`,
+		`{"action": "delete", "groups": [{"keep": "not-a-uuid"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/me/media/duplicates/resolve", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if w := doRequest(r, req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
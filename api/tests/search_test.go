@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/db"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func TestSearch_MissingQuery(t *testing.T) {
+	h := newMediaHandler(&stubFileService{}, &stubFolderService{}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/search", h.Search)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/search?q=%20", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestSearch_ContentHits(t *testing.T) {
+	file := sampleFile()
+	files := &stubFileService{contentHits: []services.ContentHit{{File: *file, Score: 2.5, Snippet: "…the quarterly report…"}}}
+	h := newMediaHandler(files, &stubFolderService{}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/search", h.Search)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/search?q=quarterly+report", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	if files.gotQuery != "quarterly report" {
+		t.Errorf("content search got query %q", files.gotQuery)
+	}
+	var body struct {
+		Files   struct{ Items []any }                 `json:"files"`
+		Content struct{ Items []services.ContentHit } `json:"content"`
+	}
+	if err := decodeBody(w, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Content.Items) != 1 || body.Content.Items[0].File.ID != file.ID || body.Content.Items[0].Snippet == "" {
+		t.Errorf("unexpected content hits %+v", body.Content.Items)
+	}
+}
+
+func TestSearch_SkipContent(t *testing.T) {
+	files := &stubFileService{}
+	h := newMediaHandler(files, &stubFolderService{}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/search", h.Search)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/search?q=report&content_limit=0", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if files.gotQuery != "" {
+		t.Error("content search ran although content_limit=0")
+	}
+}
+
+func TestSearch_FiltersWithoutQuery(t *testing.T) {
+	files := &stubFileService{}
+	folders := &stubFolderService{}
+	h := newMediaHandler(files, folders, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/search", h.Search)
+
+	folderID := uuid.New()
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/search?type=image&min_size=1024&max_size=4096"+
+		"&taken_after=2024-01-01&taken_before=2024-07-01T00:00:00Z&folder_id="+folderID.String()+
+		"&recursive=true&favorites=true&hidden=true&tag=Holiday", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", w.Code, w.Body.String())
+	}
+	f := folders.gotFilter
+	if folders.gotTerm != "" || f.Category != db.CategoryImage || *f.MinSize != 1024 || *f.MaxSize != 4096 {
+		t.Errorf("unexpected filter %+v (term %q)", f, folders.gotTerm)
+	}
+	if !f.Taken.After.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !f.Taken.Before.Equal(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected taken range %v – %v", f.Taken.After, f.Taken.Before)
+	}
+	if *f.FolderID != folderID || !f.Recursive || !f.Favorites || !f.Hidden || f.Tag != "holiday" {
+		t.Errorf("unexpected filter %+v", f)
+	}
+	if !files.gotFilter.IsZero() {
+		t.Error("content search ran without a query")
+	}
+}
+
+func TestSearch_FiltersApplyToContent(t *testing.T) {
+	files := &stubFileService{}
+	h := newMediaHandler(files, &stubFolderService{}, nil)
+	r := newEngine()
+	ginContext(r, uuid.New().String(), "alice", false)
+	r.GET("/search", h.Search)
+
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/search?q=report&type=document", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if files.gotQuery != "report" || files.gotFilter.Category != db.CategoryDocument {
+		t.Errorf("content search got %q, %+v", files.gotQuery, files.gotFilter)
+	}
+}
+
+func TestSearch_InvalidFilters(t *testing.T) {
+	for _, query := range []string{
+		"type=spreadsheet",
+		"min_size=-1",
+		"max_size=big",
+		"min_size=10&max_size=5",
+		"created_after=yesterday",
+		"updated_before=2024-13-01",
+		"folder_id=nope",
+		"recursive=true",
+		"favorites=maybe",
+		"tag=%20",
+	} {
+		h := newMediaHandler(&stubFileService{}, &stubFolderService{}, nil)
+		r := newEngine()
+		ginContext(r, uuid.New().String(), "alice", false)
+		r.GET("/search", h.Search)
+
+		w := doRequest(r, httptest.NewRequest(http.MethodGet, "/search?q=x&"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
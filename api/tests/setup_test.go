@@ -84,6 +84,7 @@ type stubQuerier struct {
 	createSubErr        error
 	adminEmails         []string
 	adminEmailsErr      error
+	clearedLocations    *uuid.UUID
 }
 
 func (s *stubQuerier) GetUserByUsername(_ context.Context, _ string) (*models.User, error) {
@@ -98,6 +99,13 @@ func (s *stubQuerier) GetUserPreferences(_ context.Context, userID string) (*mod
 func (s *stubQuerier) SetMediaAutouploadFolder(_ context.Context, userID string, folderID *uuid.UUID) (*models.UserPreferences, error) {
 	return &models.UserPreferences{UserID: userID, MediaAutouploadFolderID: folderID}, nil
 }
+func (s *stubQuerier) SetRecordLocation(_ context.Context, userID string, record bool) (*models.UserPreferences, error) {
+	return &models.UserPreferences{UserID: userID, RecordLocation: record}, nil
+}
+func (s *stubQuerier) ClearUserMediaLocations(_ context.Context, userID uuid.UUID) (int64, error) {
+	s.clearedLocations = &userID
+	return 0, nil
+}
 func (s *stubQuerier) AutoPardonExpiredSuspension(_ context.Context, _ string) error { return nil }
 func (s *stubQuerier) AddBannedIP(_ context.Context, _, _ string) error              { return nil }
 func (s *stubQuerier) GetInterestFormSettings(_ context.Context) (*models.InterestFormSettings, error) {
@@ -121,12 +129,6 @@ func (s *stubQuerier) CreateInterestSubmission(_ context.Context, _ *models.Inte
 func (s *stubQuerier) ListAdminEmails(_ context.Context) ([]string, error) {
 	return s.adminEmails, s.adminEmailsErr
 }
-func (s *stubQuerier) SearchFoldersByUser(_ context.Context, _ uuid.UUID, _ string, _ db.PageInput) (*db.PageResult[models.Folder], error) {
-	return &db.PageResult[models.Folder]{}, nil
-}
-func (s *stubQuerier) SearchFilesByUser(_ context.Context, _ uuid.UUID, _ string, _ db.PageInput) (*db.PageResult[models.File], error) {
-	return &db.PageResult[models.File]{}, nil
-}
 func (s *stubQuerier) InsertAuditLog(_ context.Context, _ db.AuditInput) error { return nil }
 func (s *stubQuerier) ListAuditLogsForUser(_ context.Context, _ string, _ db.PageInput) (*db.PageResult[models.AuditLog], error) {
 	return &db.PageResult[models.AuditLog]{Items: []models.AuditLog{}}, nil
@@ -164,10 +166,20 @@ type stubAdminQuerier struct {
 	driveAvail       int64
 	driveAvailErr    error
 	updateQuotaErr   error
+	drive            *models.Drive
 	// alarm settings fields
 	alarmSettings           *models.AlarmSettings
 	alarmSettingsErr        error
 	subscriptionErr         error
+	// integrity scrubber fields
+	scrubResults    []models.ScrubResult
+	scrubResultsErr error
+	scrubStatusArg  string
+	scrubSummary    []models.ScrubStatusCount
+	scrubSummaryErr error
+	// replication fields
+	replicaSummary    []models.ReplicaStatusCount
+	replicaSummaryErr error
 }
 
 func (s *stubAdminQuerier) ListUsers(_ context.Context, _ db.PageInput) (*db.PageResult[models.User], error) {
@@ -220,7 +232,7 @@ func (s *stubAdminQuerier) GetServer(_ context.Context, _ uuid.UUID) (*models.Se
 	return nil, nil
 }
 func (s *stubAdminQuerier) GetDrive(_ context.Context, _ uuid.UUID) (*models.Drive, error) {
-	return nil, nil
+	return s.drive, nil
 }
 func (s *stubAdminQuerier) CreateDrive(_ context.Context, _ db.CreateDriveParams) (*models.Drive, error) {
 	return nil, nil
@@ -238,6 +250,8 @@ func (s *stubAdminQuerier) GetAlarmSettings(_ context.Context) (*models.AlarmSet
 			DriveLoadEmails:      []string{},
 			NetworkTrafficEmails: []string{},
 			APIErrorRateEmails:   []string{},
+			IntegrityEmails:      []string{},
+			ServerDownEmails:     []string{},
 		}, nil
 	}
 	return s.alarmSettings, s.alarmSettingsErr
@@ -256,6 +270,8 @@ func (s *stubAdminQuerier) SetAlarmSubscription(_ context.Context, _, _ string,
 		DriveLoadEmails:      []string{},
 		NetworkTrafficEmails: []string{},
 		APIErrorRateEmails:   []string{},
+		IntegrityEmails:      []string{},
+		ServerDownEmails:     []string{},
 	}, nil
 }
 func (s *stubAdminQuerier) ListSnapshotsWindow(_ context.Context, _ time.Duration) ([]models.ServerMetricSnapshot, error) {
@@ -293,6 +309,206 @@ func (s *stubAdminQuerier) GetInterestSubmissionByID(_ context.Context, _ uuid.U
 func (s *stubAdminQuerier) MarkInterestSubmissionProvisioned(_ context.Context, _ uuid.UUID, _ uuid.UUID) error {
 	return s.provisionErr
 }
+func (s *stubAdminQuerier) ListScrubResults(_ context.Context, status string, _ db.PageInput) (*db.PageResult[models.ScrubResult], error) {
+	s.scrubStatusArg = status
+	if s.scrubResultsErr != nil {
+		return nil, s.scrubResultsErr
+	}
+	items := s.scrubResults
+	if items == nil {
+		items = []models.ScrubResult{}
+	}
+	return &db.PageResult[models.ScrubResult]{Items: items}, nil
+}
+func (s *stubAdminQuerier) GetScrubSummary(_ context.Context) ([]models.ScrubStatusCount, error) {
+	if s.scrubSummary == nil {
+		return []models.ScrubStatusCount{}, s.scrubSummaryErr
+	}
+	return s.scrubSummary, s.scrubSummaryErr
+}
+
+func (s *stubAdminQuerier) GetReplicaSummary(_ context.Context) ([]models.ReplicaStatusCount, error) {
+	if s.replicaSummary == nil {
+		return []models.ReplicaStatusCount{}, s.replicaSummaryErr
+	}
+	return s.replicaSummary, s.replicaSummaryErr
+}
+
+// ── Stub StorageReconciler ────────────────────────────────────────────────────
+
+type stubReconciler struct {
+	status     services.ReconcileStatus
+	triggerErr error
+	mode       string
+	reportID   uuid.UUID
+}
+
+func (s *stubReconciler) Status() services.ReconcileStatus { return s.status }
+func (s *stubReconciler) Trigger(mode string, reportID uuid.UUID) error {
+	s.mode, s.reportID = mode, reportID
+	return s.triggerErr
+}
+
+// ── Stub UserMigrator ─────────────────────────────────────────────────────────
+
+type stubMigrator struct {
+	migration  *models.UserMigration
+	migrateErr error
+	latestErr  error
+	username   string
+	driveID    uuid.UUID
+	startedBy  string
+}
+
+func (s *stubMigrator) Migrate(_ context.Context, username string, driveID uuid.UUID, startedBy string) (*models.UserMigration, error) {
+	s.username, s.driveID, s.startedBy = username, driveID, startedBy
+	if s.migrateErr != nil {
+		return nil, s.migrateErr
+	}
+	return s.migration, nil
+}
+func (s *stubMigrator) Latest(_ context.Context, _ string) (*models.UserMigration, error) {
+	return s.migration, s.latestErr
+}
+
+// ── Stub DriveDrainer ─────────────────────────────────────────────────────────
+
+type stubDrainer struct {
+	progress *services.DrainProgress
+	err      error
+	driveID  uuid.UUID
+	drained  bool
+}
+
+func (s *stubDrainer) Drain(_ context.Context, driveID uuid.UUID, _ string) (*services.DrainProgress, error) {
+	s.driveID, s.drained = driveID, true
+	return s.progress, s.err
+}
+func (s *stubDrainer) Progress(_ context.Context, driveID uuid.UUID) (*services.DrainProgress, error) {
+	s.driveID = driveID
+	return s.progress, s.err
+}
+
+// ── Stub ReplicationManager ───────────────────────────────────────────────────
+
+type stubReplication struct {
+	status     services.ReplicationStatus
+	busy       bool
+	triggered  int
+	factorErr  error
+	username   string
+	factor     *int
+	replaceErr error
+	driveID    uuid.UUID
+	replicas   int64
+	primaries  int64
+}
+
+func (s *stubReplication) Status() services.ReplicationStatus { return s.status }
+func (s *stubReplication) Trigger() bool {
+	if s.busy {
+		return false
+	}
+	s.triggered++
+	return true
+}
+func (s *stubReplication) SetUserFactor(_ context.Context, username string, factor *int) error {
+	s.username, s.factor = username, factor
+	return s.factorErr
+}
+func (s *stubReplication) DriveReplaced(_ context.Context, driveID uuid.UUID) (int64, int64, error) {
+	s.driveID = driveID
+	return s.replicas, s.primaries, s.replaceErr
+}
+
+// ── Stub BackupManager ────────────────────────────────────────────────────────
+
+type stubBackups struct {
+	status    services.BackupStatus
+	runs      []models.BackupRun
+	listErr   error
+	busy      bool
+	triggered int
+	verifyRun *models.BackupRun
+	verifyErr error
+	verifyID  uuid.UUID
+}
+
+func (s *stubBackups) Status() services.BackupStatus { return s.status }
+func (s *stubBackups) Trigger() bool {
+	if s.busy {
+		return false
+	}
+	s.triggered++
+	return true
+}
+func (s *stubBackups) List(_ context.Context, _ db.PageInput) (*db.PageResult[models.BackupRun], error) {
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	return &db.PageResult[models.BackupRun]{Items: s.runs}, nil
+}
+func (s *stubBackups) Verify(_ context.Context, id uuid.UUID) (*models.BackupRun, error) {
+	s.verifyID = id
+	return s.verifyRun, s.verifyErr
+}
+
+// ── Stub JobQueue ─────────────────────────────────────────────────────────────
+
+type stubJobs struct {
+	summary   services.JobQueueStatus
+	jobs      []models.Job
+	listErr   error
+	status    string
+	job       *models.Job
+	retryErr  error
+	cancelErr error
+	retried   uuid.UUID
+	cancelled uuid.UUID
+
+	backfillErr error
+	backfilled  string
+}
+
+func (s *stubJobs) Summary(_ context.Context) (services.JobQueueStatus, error) {
+	return s.summary, s.listErr
+}
+func (s *stubJobs) List(_ context.Context, status string, _ db.PageInput) (*db.PageResult[models.Job], error) {
+	s.status = status
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	return &db.PageResult[models.Job]{Items: s.jobs}, nil
+}
+func (s *stubJobs) Retry(_ context.Context, id uuid.UUID) (*models.Job, error) {
+	s.retried = id
+	return s.job, s.retryErr
+}
+func (s *stubJobs) Cancel(_ context.Context, id uuid.UUID) (*models.Job, error) {
+	s.cancelled = id
+	return s.job, s.cancelErr
+}
+func (s *stubJobs) Backfill(kind string) error {
+	s.backfilled = kind
+	return s.backfillErr
+}
+
+// ── Stub IntegrityScrubber ────────────────────────────────────────────────────
+
+type stubScrubber struct {
+	status    services.ScrubStatus
+	busy      bool
+	triggered int
+}
+
+func (s *stubScrubber) Status() services.ScrubStatus { return s.status }
+func (s *stubScrubber) Trigger() bool {
+	if s.busy {
+		return false
+	}
+	s.triggered++
+	return true
+}
 
 // ── Stub AdminInviteService ───────────────────────────────────────────────────
 
@@ -302,9 +518,11 @@ type stubAdminInviteService struct {
 	invs   []models.Invitation
 	resendErr error
 	revokeErr error
+	placement services.InvitePlacement
 }
 
-func (s *stubAdminInviteService) Create(_ context.Context, _ uuid.UUID, _, _ string, _ int64, _ bool) (*models.Invitation, error) {
+func (s *stubAdminInviteService) Create(_ context.Context, _ uuid.UUID, _, _ string, _ int64, _ bool, placement services.InvitePlacement) (*models.Invitation, error) {
+	s.placement = placement
 	return s.inv, s.invErr
 }
 func (s *stubAdminInviteService) List(_ context.Context, _ db.PageInput) (*db.PageResult[models.Invitation], error) {
@@ -330,6 +548,28 @@ type stubFileService struct {
 	file    *models.File
 	fileErr error
 	deleted bool
+
+	thumb     []byte
+	thumbErr  error
+	thumbSize string
+
+	hlsRenditions []services.HLSRendition
+	hlsErr        error
+	hlsAsset      []byte
+	hlsAssetName  string
+
+	media    *models.MediaMetadata
+	stripErr error
+
+	contentHits []services.ContentHit
+	gotQuery    string
+	gotFilter   db.SearchFilter
+	gotTags     []string
+
+	duplicates    []services.DuplicateCluster
+	gotThreshold  int
+	gotAction     services.DuplicateAction
+	gotDupeGroups []services.DuplicateGroup
 }
 
 func (s *stubFileService) Upload(_ context.Context, _ services.UploadInput) (*models.File, error) {
@@ -342,6 +582,55 @@ func (s *stubFileService) GetMetadata(_ context.Context, _ uuid.UUID, _ uuid.UUI
 	return s.file, s.fileErr
 }
 func (s *stubFileService) HasReadyVariant(_ context.Context, _ uuid.UUID) bool { return false }
+func (s *stubFileService) MediaMetadata(_ context.Context, _ uuid.UUID) (*models.MediaMetadata, error) {
+	return s.media, nil
+}
+func (s *stubFileService) StripLocation(_ context.Context, _, _ uuid.UUID, _ string) (*models.File, error) {
+	if s.stripErr != nil {
+		return nil, s.stripErr
+	}
+	if s.media != nil {
+		s.media.ClearLocation()
+	}
+	return s.file, s.fileErr
+}
+func (s *stubFileService) SearchContent(_ context.Context, _ uuid.UUID, _, query string, filter db.SearchFilter, _ db.PageInput) (*db.PageResult[services.ContentHit], error) {
+	s.gotQuery, s.gotFilter = query, filter
+	if s.contentHits == nil {
+		return &db.PageResult[services.ContentHit]{Items: []services.ContentHit{}}, s.fileErr
+	}
+	return &db.PageResult[services.ContentHit]{Items: s.contentHits}, s.fileErr
+}
+func (s *stubFileService) FindDuplicates(_ context.Context, _ uuid.UUID, threshold int) ([]services.DuplicateCluster, error) {
+	s.gotThreshold = threshold
+	if s.duplicates == nil {
+		return []services.DuplicateCluster{}, s.fileErr
+	}
+	return s.duplicates, s.fileErr
+}
+func (s *stubFileService) ResolveDuplicates(_ context.Context, _ uuid.UUID, _ string, action services.DuplicateAction, groups []services.DuplicateGroup) (*services.DuplicateResolution, error) {
+	s.gotAction, s.gotDupeGroups = action, groups
+	if s.fileErr != nil {
+		return nil, s.fileErr
+	}
+	res := &services.DuplicateResolution{Failed: []services.DuplicateFailure{}}
+	for _, g := range groups {
+		res.Resolved += len(g.Discard)
+	}
+	return res, nil
+}
+func (s *stubFileService) HasThumbnail(_ context.Context, _ uuid.UUID) bool    { return s.thumb != nil }
+func (s *stubFileService) Thumbnail(_ context.Context, _ *models.File, _, size string) ([]byte, error) {
+	s.thumbSize = size
+	return s.thumb, s.thumbErr
+}
+func (s *stubFileService) HLSRenditions(_ context.Context, _ *models.File, _ string) ([]services.HLSRendition, error) {
+	return s.hlsRenditions, s.hlsErr
+}
+func (s *stubFileService) HLSAsset(_ context.Context, _ *models.File, _, rendition, name string) ([]byte, error) {
+	s.hlsAssetName = rendition + "/" + name
+	return s.hlsAsset, s.hlsErr
+}
 func (s *stubFileService) Download(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ string) (*models.File, []byte, error) {
 	if s.fileErr != nil {
 		return nil, nil, s.fileErr
@@ -366,6 +655,10 @@ func (s *stubFileService) Rename(_ context.Context, _ uuid.UUID, _ uuid.UUID, _
 func (s *stubFileService) SetHidden(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ bool) (*models.File, error) {
 	return s.file, s.fileErr
 }
+func (s *stubFileService) SetTags(_ context.Context, _, _ uuid.UUID, tags []string) (*models.File, error) {
+	s.gotTags = tags
+	return s.file, s.fileErr
+}
 func (s *stubFileService) Delete(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ string) error {
 	s.deleted = true
 	return s.fileErr
@@ -386,6 +679,19 @@ type stubFolderService struct {
 	folder    *models.Folder
 	folderErr error
 	contents  *services.FolderContents
+	timeline  []db.TimelineBucket
+	clusters  []db.GeoCluster
+
+	// Arguments of the last GetMediaTimeline / GetMediaGeo call.
+	gotGranularity db.TimelineGranularity
+	gotTZ          string
+	gotBBox        db.BBox
+	gotGrid        int
+
+	// Arguments of the last Search call.
+	searched  bool
+	gotTerm   string
+	gotFilter db.SearchFilter
 }
 
 func (s *stubFolderService) ListRoot(_ context.Context, _ uuid.UUID, _, _ db.PageInput) (*services.FolderContents, error) {
@@ -397,6 +703,16 @@ func (s *stubFolderService) ListRoot(_ context.Context, _ uuid.UUID, _, _ db.Pag
 		Files:      &db.PageResult[models.File]{Items: []models.File{}},
 	}, s.folderErr
 }
+func (s *stubFolderService) Search(_ context.Context, _ uuid.UUID, term string, filter db.SearchFilter, _, _ db.PageInput) (*services.FolderContents, error) {
+	s.searched, s.gotTerm, s.gotFilter = true, term, filter
+	if s.contents != nil {
+		return s.contents, nil
+	}
+	return &services.FolderContents{
+		Subfolders: &db.PageResult[models.Folder]{Items: []models.Folder{}},
+		Files:      &db.PageResult[models.File]{Items: []models.File{}},
+	}, s.folderErr
+}
 func (s *stubFolderService) GetContents(_ context.Context, _, _ uuid.UUID, _, _ db.PageInput) (*services.FolderContents, error) {
 	if s.folderErr != nil {
 		return nil, s.folderErr
@@ -423,6 +739,26 @@ func (s *stubFolderService) GetMediaContents(_ context.Context, _, _ uuid.UUID,
 		Files:      &db.PageResult[models.File]{Items: []models.File{}},
 	}, nil
 }
+func (s *stubFolderService) GetMediaTimeline(_ context.Context, _, _ uuid.UUID, _ db.HiddenFilter, g db.TimelineGranularity, tz string) ([]db.TimelineBucket, error) {
+	s.gotGranularity, s.gotTZ = g, tz
+	if s.folderErr != nil {
+		return nil, s.folderErr
+	}
+	if s.timeline == nil {
+		return []db.TimelineBucket{}, nil
+	}
+	return s.timeline, nil
+}
+func (s *stubFolderService) GetMediaGeo(_ context.Context, _, _ uuid.UUID, _ db.HiddenFilter, bbox db.BBox, grid int) ([]db.GeoCluster, error) {
+	s.gotBBox, s.gotGrid = bbox, grid
+	if s.folderErr != nil {
+		return nil, s.folderErr
+	}
+	if s.clusters == nil {
+		return []db.GeoCluster{}, nil
+	}
+	return s.clusters, nil
+}
 func (s *stubFolderService) Create(_ context.Context, _ uuid.UUID, _ *uuid.UUID, _ string, _ string) (*models.Folder, error) {
 	return s.folder, s.folderErr
 }
@@ -475,6 +811,59 @@ func newFolderHandler(folderSvc routes.FolderServicer) *routes.Handler {
 	return routes.NewHandler(&stubQuerier{}, nil, folderSvc, nil, nil, nil, nil, nil, nil, "test-secret")
 }
 
+// newArchiveHandler builds a routes.Handler wired with the given archive
+// service stub and a real PresignService keyed with testPresignSecret.
+func newArchiveHandler(archives routes.ArchiveServicer) *routes.Handler {
+	h := routes.NewHandler(&stubQuerier{}, nil, nil, nil, nil, nil, nil, nil, services.NewPresignService(testPresignSecret), "test-secret")
+	routes.SetArchiveService(h, archives)
+	return h
+}
+
+// newImportHandler builds a routes.Handler wired with the given import
+// service stub.
+func newImportHandler(imports routes.ImportServicer) *routes.Handler {
+	h := routes.NewHandler(&stubQuerier{}, nil, nil, nil, nil, nil, nil, nil, nil, "test-secret")
+	routes.SetImportService(h, imports)
+	return h
+}
+
+// newBulkHandler builds a routes.Handler wired with the given bulk service stub.
+func newBulkHandler(bulk routes.BulkServicer) *routes.Handler {
+	h := routes.NewHandler(&stubQuerier{}, nil, nil, nil, nil, nil, nil, nil, nil, "test-secret")
+	routes.SetBulkService(h, bulk)
+	return h
+}
+
+// newFolderCopyHandler builds a routes.Handler wired with the given folder
+// copy service stub.
+func newFolderCopyHandler(copies routes.FolderCopyServicer) *routes.Handler {
+	h := routes.NewHandler(&stubQuerier{}, nil, nil, nil, nil, nil, nil, nil, nil, "test-secret")
+	routes.SetFolderCopyService(h, copies)
+	return h
+}
+
+// newChangeHandler builds a routes.Handler wired with the given change feed
+// service stub.
+func newChangeHandler(changes routes.ChangeServicer) *routes.Handler {
+	h := routes.NewHandler(&stubQuerier{}, nil, nil, nil, nil, nil, nil, nil, nil, "test-secret")
+	routes.SetChangeService(h, changes)
+	return h
+}
+
+// newEventHandler builds a Handler with only the event stream service set.
+func newEventHandler(events routes.EventServicer) *routes.Handler {
+	h := routes.NewHandler(&stubQuerier{}, nil, nil, nil, nil, nil, nil, nil, nil, "test-secret")
+	routes.SetEventService(h, events, "https://files.example.com")
+	return h
+}
+
+// newWebhookHandler builds a Handler with only the webhook service set.
+func newWebhookHandler(webhooks routes.WebhookServicer) *routes.Handler {
+	h := routes.NewHandler(&stubQuerier{}, nil, nil, nil, nil, nil, nil, nil, nil, "test-secret")
+	routes.SetWebhookService(h, webhooks)
+	return h
+}
+
 // newAdminHandler builds an admin.Handler with only querier and invite service set.
 func newAdminHandler(q admin.AdminQuerier, inv admin.AdminInviteService) *admin.Handler {
 	return admin.NewHandler(q, inv, nil, nil, nil, nil, nil, "", "", "", "", nil)
@@ -490,6 +879,251 @@ func newAdminHandlerWithFiles(q admin.AdminQuerier, fileSvc routes.FileServicer)
 	return admin.NewHandler(q, &stubAdminInviteService{}, nil, nil, fileSvc, nil, nil, "", "", "", "", nil)
 }
 
+// ── Stub ArchiveServicer ──────────────────────────────────────────────────────
+
+type stubArchiveService struct {
+	archive   *services.Archive
+	createErr error
+	getErr    error
+	content   string
+	gotName   string
+	gotFiles  []uuid.UUID
+}
+
+func (s *stubArchiveService) Create(_ context.Context, userID uuid.UUID, username, name string, fileIDs, folderIDs []uuid.UUID) (*services.Archive, error) {
+	s.gotName, s.gotFiles = name, fileIDs
+	if s.createErr != nil {
+		return nil, s.createErr
+	}
+	s.archive = &services.Archive{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Username:  username,
+		Name:      "selection.zip",
+		FileIDs:   fileIDs,
+		FolderIDs: folderIDs,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	return s.archive, nil
+}
+func (s *stubArchiveService) Get(id, userID uuid.UUID) (*services.Archive, error) {
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+	if s.archive == nil || s.archive.ID != id || s.archive.UserID != userID {
+		return nil, services.ErrNotFound
+	}
+	return s.archive, nil
+}
+func (s *stubArchiveService) Write(_ context.Context, _ *services.Archive, w io.Writer) error {
+	_, err := io.WriteString(w, s.content)
+	return err
+}
+
+// ── Stub ImportServicer ───────────────────────────────────────────────────────
+
+type stubImportService struct {
+	status   *services.ImportStatus
+	startErr error
+	got      services.ImportInput
+	gotBody  string
+}
+
+func (s *stubImportService) Start(_ context.Context, in services.ImportInput) (*services.ImportStatus, error) {
+	body, _ := io.ReadAll(in.Reader)
+	s.got, s.gotBody = in, string(body)
+	if s.startErr != nil {
+		return nil, s.startErr
+	}
+	s.status = &services.ImportStatus{
+		ID:        uuid.New(),
+		Name:      in.Name,
+		FolderID:  in.FolderID,
+		Status:    services.ImportQueued,
+		Failures:  []services.ImportFailure{},
+		CreatedAt: time.Now(),
+	}
+	return s.status, nil
+}
+func (s *stubImportService) Get(id, _ uuid.UUID) (*services.ImportStatus, error) {
+	if s.status == nil || s.status.ID != id {
+		return nil, services.ErrImportNotFound
+	}
+	return s.status, nil
+}
+
+// ── Stub BulkServicer ─────────────────────────────────────────────────────────
+
+type stubBulkService struct {
+	result *services.BulkResult
+	err    error
+	got    services.BulkInput
+}
+
+func (s *stubBulkService) Apply(_ context.Context, in services.BulkInput) (*services.BulkResult, error) {
+	s.got = in
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.result != nil {
+		return s.result, nil
+	}
+	res := &services.BulkResult{Op: in.Op}
+	for _, id := range in.FileIDs {
+		res.Items = append(res.Items, services.BulkItemResult{ID: id, Type: "file", OK: true})
+		res.Succeeded++
+	}
+	return res, nil
+}
+
+// ── Stub FolderCopyServicer ───────────────────────────────────────────────────
+
+type stubFolderCopyService struct {
+	status   *services.FolderCopyStatus
+	startErr error
+	got      services.FolderCopyInput
+}
+
+func (s *stubFolderCopyService) Start(_ context.Context, in services.FolderCopyInput) (*services.FolderCopyStatus, error) {
+	s.got = in
+	if s.startErr != nil {
+		return nil, s.startErr
+	}
+	s.status = &services.FolderCopyStatus{
+		ID:        uuid.New(),
+		SourceID:  in.FolderID,
+		ParentID:  in.ParentID,
+		FolderID:  uuid.New(),
+		Name:      "Photos (copy)",
+		Status:    services.FolderCopyQueued,
+		Folders:   1,
+		Failures:  []services.FolderCopyFailure{},
+		CreatedAt: time.Now(),
+	}
+	return s.status, nil
+}
+func (s *stubFolderCopyService) Get(id, _ uuid.UUID) (*services.FolderCopyStatus, error) {
+	if s.status == nil || s.status.ID != id {
+		return nil, services.ErrFolderCopyNotFound
+	}
+	return s.status, nil
+}
+
+// ── Stub ChangeServicer ───────────────────────────────────────────────────────
+
+type stubChangeService struct {
+	page      *services.ChangePage
+	err       error
+	gotCursor string
+	gotLimit  int
+}
+
+func (s *stubChangeService) List(_ context.Context, _ uuid.UUID, cursor string, limit int) (*services.ChangePage, error) {
+	s.gotCursor, s.gotLimit = cursor, limit
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.page != nil {
+		return s.page, nil
+	}
+	return &services.ChangePage{Changes: []models.Change{}, Cursor: "0"}, nil
+}
+
+// ── Stub EventServicer ────────────────────────────────────────────────────────
+
+type stubEventService struct {
+	ch           chan []byte
+	err          error
+	gotUser      uuid.UUID
+	unsubscribed chan struct{}
+}
+
+func (s *stubEventService) Subscribe(userID uuid.UUID) (chan []byte, error) {
+	s.gotUser = userID
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.ch, nil
+}
+
+func (s *stubEventService) Unsubscribe(_ uuid.UUID, _ chan []byte) {
+	close(s.unsubscribed)
+}
+
+// ── Stub WebhookServicer ──────────────────────────────────────────────────────
+
+type stubWebhookService struct {
+	webhook  *models.Webhook
+	delivery *models.WebhookDelivery
+	err      error
+
+	gotInput   services.WebhookInput
+	gotUpdate  services.WebhookUpdate
+	gotIsAdmin bool
+	gotPage    db.PageInput
+	deleted    uuid.UUID
+}
+
+func (s *stubWebhookService) Create(_ context.Context, _ uuid.UUID, _ string, isAdmin bool, in services.WebhookInput) (*models.Webhook, error) {
+	s.gotInput, s.gotIsAdmin = in, isAdmin
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.webhook, nil
+}
+
+func (s *stubWebhookService) List(_ context.Context, _ uuid.UUID) ([]models.Webhook, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.webhook == nil {
+		return []models.Webhook{}, nil
+	}
+	return []models.Webhook{*s.webhook}, nil
+}
+
+func (s *stubWebhookService) Get(_ context.Context, _, _ uuid.UUID) (*models.Webhook, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.webhook, nil
+}
+
+func (s *stubWebhookService) Update(_ context.Context, _ uuid.UUID, isAdmin bool, _ uuid.UUID, in services.WebhookUpdate) (*models.Webhook, error) {
+	s.gotUpdate, s.gotIsAdmin = in, isAdmin
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.webhook, nil
+}
+
+func (s *stubWebhookService) Delete(_ context.Context, _, id uuid.UUID) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.deleted = id
+	return nil
+}
+
+func (s *stubWebhookService) Deliveries(_ context.Context, _, _ uuid.UUID, page db.PageInput) (*db.PageResult[models.WebhookDelivery], error) {
+	s.gotPage = page
+	if s.err != nil {
+		return nil, s.err
+	}
+	items := []models.WebhookDelivery{}
+	if s.delivery != nil {
+		items = append(items, *s.delivery)
+	}
+	return &db.PageResult[models.WebhookDelivery]{Items: items}, nil
+}
+
+func (s *stubWebhookService) Test(_ context.Context, _, _ uuid.UUID) (*models.WebhookDelivery, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.delivery, nil
+}
+
 // ── Stub MetricsService ───────────────────────────────────────────────────────
 
 type stubMetricsService struct {
@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"apollo-sfs.com/api/models"
+	"apollo-sfs.com/api/routes"
+	"apollo-sfs.com/api/routes/services"
+)
+
+func newWebhookEngine(h *routes.Handler, isAdmin bool) *gin.Engine {
+	r := newEngine()
+	ginContext(r, uuid.NewString(), "alice", isAdmin)
+	r.POST("/webhooks", h.CreateWebhook)
+	r.GET("/webhooks", h.ListWebhooks)
+	r.GET("/webhooks/:webhook_id", h.GetWebhook)
+	r.PATCH("/webhooks/:webhook_id", h.UpdateWebhook)
+	r.DELETE("/webhooks/:webhook_id", h.DeleteWebhook)
+	r.GET("/webhooks/:webhook_id/deliveries", h.ListWebhookDeliveries)
+	r.POST("/webhooks/:webhook_id/test", h.TestWebhook)
+	return r
+}
+
+func testWebhook() *models.Webhook {
+	return &models.Webhook{
+		ID:        uuid.New(),
+		URL:       "https://hooks.example.com/apollo",
+		Secret:    "whsec_abc",
+		Events:    []string{models.WebhookFileUploaded},
+		Enabled:   true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+func TestCreateWebhook_NotConfigured(t *testing.T) {
+	r := newWebhookEngine(newWebhookHandler(nil), false)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", jsonBody(map[string]any{
+		"url": "https://hooks.example.com", "events": []string{"file.uploaded"},
+	}))
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestCreateWebhook_ReturnsSecret(t *testing.T) {
+	folderID := uuid.New()
+	stub := &stubWebhookService{webhook: testWebhook()}
+	r := newWebhookEngine(newWebhookHandler(stub), true)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", jsonBody(map[string]any{
+		"url":       "https://hooks.example.com/apollo",
+		"events":    []string{"file.uploaded"},
+		"folder_id": folderID.String(),
+	}))
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var body map[string]any
+	if err := decodeBody(w, &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["secret"] != "whsec_abc" {
+		t.Errorf("expected secret in response, got %v", body["secret"])
+	}
+	if stub.gotInput.FolderID == nil || *stub.gotInput.FolderID != folderID {
+		t.Errorf("expected folder_id %s, got %v", folderID, stub.gotInput.FolderID)
+	}
+	if !stub.gotIsAdmin {
+		t.Error("expected admin role to be passed through")
+	}
+}
+
+func TestCreateWebhook_MissingFields(t *testing.T) {
+	r := newWebhookEngine(newWebhookHandler(&stubWebhookService{}), false)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", jsonBody(map[string]any{"url": "https://hooks.example.com"}))
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestCreateWebhook_InvalidFolderID(t *testing.T) {
+	r := newWebhookEngine(newWebhookHandler(&stubWebhookService{}), false)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", jsonBody(map[string]any{
+		"url": "https://hooks.example.com", "events": []string{"file.uploaded"}, "folder_id": "nope",
+	}))
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestCreateWebhook_ErrorMapping(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{services.ErrWebhookInvalidURL, http.StatusBadRequest},
+		{services.ErrWebhookPrivateURL, http.StatusBadRequest},
+		{services.ErrWebhookInvalidEvents, http.StatusBadRequest},
+		{services.ErrWebhookAdminOnly, http.StatusForbidden},
+		{services.ErrWebhookLimit, http.StatusConflict},
+		{services.ErrFolderNotFound, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		r := newWebhookEngine(newWebhookHandler(&stubWebhookService{err: tc.err}), false)
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", jsonBody(map[string]any{
+			"url": "https://hooks.example.com", "events": []string{"file.uploaded"},
+		}))
+		w := doRequest(r, req)
+
+		if w.Code != tc.code {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.code, w.Code)
+		}
+	}
+}
+
+func TestListWebhooks_HidesSecret(t *testing.T) {
+	r := newWebhookEngine(newWebhookHandler(&stubWebhookService{webhook: testWebhook()}), false)
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body struct {
+		Webhooks []map[string]any `json:"webhooks"`
+	}
+	if err := decodeBody(w, &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Webhooks) != 1 {
+		t.Fatalf("expected 1 webhook, got %d", len(body.Webhooks))
+	}
+	if _, ok := body.Webhooks[0]["secret"]; ok {
+		t.Error("secret must not be listed")
+	}
+}
+
+func TestGetWebhook_NotFound(t *testing.T) {
+	r := newWebhookEngine(newWebhookHandler(&stubWebhookService{err: services.ErrWebhookNotFound}), false)
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/webhooks/"+uuid.NewString(), nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestGetWebhook_InvalidID(t *testing.T) {
+	r := newWebhookEngine(newWebhookHandler(&stubWebhookService{}), false)
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/webhooks/not-a-uuid", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestUpdateWebhook_Disable(t *testing.T) {
+	stub := &stubWebhookService{webhook: testWebhook()}
+	r := newWebhookEngine(newWebhookHandler(stub), false)
+	req := httptest.NewRequest(http.MethodPatch, "/webhooks/"+uuid.NewString(), jsonBody(map[string]any{"enabled": false}))
+	w := doRequest(r, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if stub.gotUpdate.Enabled == nil || *stub.gotUpdate.Enabled {
+		t.Errorf("expected enabled=false, got %v", stub.gotUpdate.Enabled)
+	}
+	if stub.gotUpdate.URL != nil || stub.gotUpdate.Events != nil {
+		t.Error("omitted fields must be left unset")
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	id := uuid.New()
+	stub := &stubWebhookService{}
+	r := newWebhookEngine(newWebhookHandler(stub), false)
+	w := doRequest(r, httptest.NewRequest(http.MethodDelete, "/webhooks/"+id.String(), nil))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if stub.deleted != id {
+		t.Errorf("expected %s deleted, got %s", id, stub.deleted)
+	}
+}
+
+func TestListWebhookDeliveries_Paging(t *testing.T) {
+	stub := &stubWebhookService{delivery: &models.WebhookDelivery{
+		ID: uuid.New(), EventType: models.WebhookFileUploaded, Status: models.WebhookDeliveryPending,
+	}}
+	r := newWebhookEngine(newWebhookHandler(stub), false)
+	w := doRequest(r, httptest.NewRequest(http.MethodGet, "/webhooks/"+uuid.NewString()+"/deliveries?cursor=abc&limit=5", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if stub.gotPage.Cursor != "abc" || stub.gotPage.Limit != 5 {
+		t.Errorf("expected cursor=abc limit=5, got %+v", stub.gotPage)
+	}
+}
+
+func TestTestWebhook_ReturnsDelivery(t *testing.T) {
+	code := http.StatusOK
+	stub := &stubWebhookService{delivery: &models.WebhookDelivery{
+		ID: uuid.New(), EventType: models.WebhookTest, Status: models.WebhookDeliveryDelivered, Attempts: 1, LastStatusCode: &code,
+	}}
+	r := newWebhookEngine(newWebhookHandler(stub), false)
+	w := doRequest(r, httptest.NewRequest(http.MethodPost, "/webhooks/"+uuid.NewString()+"/test", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body map[string]any
+	if err := decodeBody(w, &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["status"] != models.WebhookDeliveryDelivered {
+		t.Errorf("expected delivered, got %v", body["status"])
+	}
+}
@@ -0,0 +1,35 @@
+-- Integrity scrubber results. The background ScrubService walks every files
+-- and video_variants row, HEADs the MinIO object, compares its size with the
+-- size implied by the plaintext length and encryption mode, and re-reads the
+-- blob to verify every AES-GCM tag. One row is kept per object (upserted on
+-- minio_object_key) holding the outcome of the most recent check.
+--
+-- status:
+--   'ok'            object present, size matches, all GCM tags authenticate
+--   'missing'       object not found in the bucket
+--   'size_mismatch' stored size differs from the expected ciphertext size
+--   'corrupt'       at least one GCM tag failed to authenticate
+--   'error'         the check itself failed (MinIO unreachable, key unwrap, …)
+--
+-- Rows cascade-delete with their parent file / variant so the report never
+-- lists objects that were deleted through the normal paths.
+
+CREATE TABLE IF NOT EXISTS scrub_results (
+    id               UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    file_id          UUID        NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    variant_id       UUID        REFERENCES video_variants (id) ON DELETE CASCADE,
+    username         TEXT        NOT NULL,
+    minio_object_key TEXT        NOT NULL UNIQUE,
+    status           TEXT        NOT NULL CHECK (status IN ('ok', 'missing', 'size_mismatch', 'corrupt', 'error')),
+    expected_bytes   BIGINT      NOT NULL,
+    actual_bytes     BIGINT,
+    detail           TEXT,
+    checked_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scrub_results_status_idx ON scrub_results (status, checked_at DESC);
+
+-- Alarm subscription for scrubber findings (same shape as migration 006).
+ALTER TABLE alarm_settings
+  ADD COLUMN IF NOT EXISTS integrity_emails         TEXT[]      NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS integrity_last_fired_at  TIMESTAMPTZ;
@@ -0,0 +1,38 @@
+-- Live user migrations between drives. A row tracks one attempt to move every
+-- blob and video variant a user owns from source_drive_id to target_drive_id.
+--
+-- status:
+--   'pending'   created, copy not started yet
+--   'copying'   objects are being copied to the target and verified
+--   'cleaning'  allocation and files.drive_id already point at the target;
+--               source objects are being removed
+--   'done'      finished
+--   'failed'    stopped on an error; re-posting the same target resumes it
+--
+-- The allocation flip is atomic with the move from 'copying' to 'cleaning', so
+-- whether a failed row had switched drives is read from user_drive_allocations.
+
+CREATE TABLE IF NOT EXISTS user_migrations (
+    id              UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    username        TEXT        NOT NULL REFERENCES users (username) ON UPDATE CASCADE ON DELETE CASCADE,
+    source_drive_id UUID        NOT NULL REFERENCES drives (id),
+    target_drive_id UUID        NOT NULL REFERENCES drives (id),
+    status          TEXT        NOT NULL DEFAULT 'pending'
+                                CHECK (status IN ('pending', 'copying', 'cleaning', 'done', 'failed')),
+    total_objects   INT         NOT NULL DEFAULT 0,
+    copied_objects  INT         NOT NULL DEFAULT 0,
+    total_bytes     BIGINT      NOT NULL DEFAULT 0,
+    copied_bytes    BIGINT      NOT NULL DEFAULT 0,
+    error           TEXT,
+    started_by      TEXT        NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_migrations_username_idx ON user_migrations (username, created_at DESC);
+
+-- At most one unfinished migration per user.
+CREATE UNIQUE INDEX IF NOT EXISTS user_migrations_one_active_idx
+    ON user_migrations (username)
+    WHERE status IN ('pending', 'copying', 'cleaning');
@@ -0,0 +1,18 @@
+-- Drive lifecycle for draining and decommissioning.
+--
+-- state:
+--   'active'    normal; eligible for new allocations while is_active = true
+--   'draining'  is_active forced to false so no new users land here; the
+--               DrainService migrates every allocated user to other drives
+--   'retired'   no users left; the drive can be physically removed
+--
+-- drain_started_at marks the start of the current drain so its progress can
+-- be read back from user_migrations after a restart.
+
+ALTER TABLE drives
+  ADD COLUMN IF NOT EXISTS state            TEXT        NOT NULL DEFAULT 'active'
+                                            CHECK (state IN ('active', 'draining', 'retired')),
+  ADD COLUMN IF NOT EXISTS drain_started_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS retired_at       TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS user_migrations_source_drive_idx ON user_migrations (source_drive_id, created_at DESC);
@@ -0,0 +1,54 @@
+-- Optional second copy of a user's blobs on another drive.
+--
+-- users.replication_factor overrides the tier default (REPLICATION_FACTOR /
+-- REPLICATION_FACTOR_PREMIUM): 1 keeps a single copy, 2 adds a replica.
+-- NULL follows the tier.
+--
+-- user_replica_allocations maps a replicated user to their secondary drive,
+-- always a different drive (and preferably a different server) from the one
+-- in user_drive_allocations. The replica consumes the user's quota on that
+-- drive just like the primary allocation does.
+--
+-- file_replicas tracks the replica of every original blob and video variant.
+-- status:
+--   'pending'    the replica still has to be written (new upload, new
+--                replica drive, or the replica drive was replaced)
+--   'ok'         the replica exists and authenticated when it was written
+--   'failed'     the last write failed; the repair job retries it
+--   'restoring'  the replica is good but the primary copy was lost (its drive
+--                was replaced); the repair job copies it back
+--
+-- Reads fail over to replicas in 'ok' or 'restoring'.
+
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS replication_factor SMALLINT
+                           CHECK (replication_factor BETWEEN 1 AND 2);
+
+CREATE TABLE IF NOT EXISTS user_replica_allocations (
+    user_id      TEXT        NOT NULL PRIMARY KEY REFERENCES users (username) ON UPDATE CASCADE ON DELETE CASCADE,
+    drive_id     UUID        NOT NULL REFERENCES drives (id),
+    allocated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS user_replica_allocations_drive_id_idx ON user_replica_allocations (drive_id);
+
+CREATE TABLE IF NOT EXISTS file_replicas (
+    minio_object_key TEXT        NOT NULL PRIMARY KEY,
+    file_id          UUID        NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    username         TEXT        NOT NULL REFERENCES users (username) ON UPDATE CASCADE ON DELETE CASCADE,
+    drive_id         UUID        NOT NULL REFERENCES drives (id),
+    status           TEXT        NOT NULL DEFAULT 'pending'
+                                 CHECK (status IN ('pending', 'ok', 'failed', 'restoring')),
+    error            TEXT,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS file_replicas_username_idx ON file_replicas (username, status);
+CREATE INDEX IF NOT EXISTS file_replicas_drive_id_idx ON file_replicas (drive_id, status);
+
+-- Every (user, drive) pair that consumes quota on a drive, primary or replica.
+-- Capacity queries join this instead of user_drive_allocations.
+CREATE OR REPLACE VIEW drive_allocations AS
+    SELECT user_id, drive_id FROM user_drive_allocations
+    UNION ALL
+    SELECT user_id, drive_id FROM user_replica_allocations;
@@ -0,0 +1,7 @@
+-- Alarm subscription for MinIO servers that stay down. Server health itself
+-- is not persisted: MinIORegistry probes every active server on a timer and
+-- keeps the result in memory (see GET /admin/system/infrastructure). This
+-- alarm fires once a server has been down for several minutes.
+ALTER TABLE alarm_settings
+  ADD COLUMN IF NOT EXISTS server_down_emails         TEXT[]      NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS server_down_last_fired_at  TIMESTAMPTZ;
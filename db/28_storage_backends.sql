@@ -0,0 +1,12 @@
+-- Storage backend per server. Drives inherit the backend of their server.
+--
+--   minio  the default, and the only option before this migration
+--   s3     any other S3-compatible service; `region` is sent with every
+--          request when the provider needs it
+--   fs     blobs are files on the API host: minio_endpoint holds an absolute
+--          root directory and each drive's minio_bucket is a subdirectory of
+--          it. The credential columns hold encrypted empty strings.
+ALTER TABLE servers
+  ADD COLUMN IF NOT EXISTS backend TEXT NOT NULL DEFAULT 'minio'
+      CHECK (backend IN ('minio', 's3', 'fs')),
+  ADD COLUMN IF NOT EXISTS region  TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,48 @@
+-- Off-site backups. The BackupService periodically writes a backup to the
+-- target configured by BACKUP_TARGET (a local path, a second S3 endpoint or
+-- an SFTP mount). Target layout:
+--
+--   blobs/<minio_object_key>           ciphertext blobs, copied once and shared by every backup
+--   backups/<id>/catalogue.enc         metadata tables + blob index, gzip NDJSON sealed with a KEK-derived key
+--   backups/<id>/manifest.json         written last; its presence marks the backup as complete
+--
+-- backup_runs keeps one row per attempt.
+-- status:
+--   'running'  the backup is being written
+--   'done'     catalogue and manifest were written and every blob was copied
+--   'failed'   the run stopped early; error says why
+-- verify_status is NULL until an admin verifies the backup, then
+-- 'running', 'ok' or 'failed' (verify_error lists what is missing or damaged).
+--
+-- backup_blobs records every blob already present on the target so later runs
+-- only copy new or changed objects. Neither table is part of the catalogue
+-- export: a restored instance starts a fresh chain and re-discovers blobs
+-- already on the target with a size check.
+
+CREATE TABLE IF NOT EXISTS backup_runs (
+    id               UUID        PRIMARY KEY,
+    target           TEXT        NOT NULL,
+    status           TEXT        NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'done', 'failed')),
+    catalogue_rows   BIGINT      NOT NULL DEFAULT 0,
+    catalogue_bytes  BIGINT      NOT NULL DEFAULT 0,
+    catalogue_sha256 TEXT,
+    blob_count       BIGINT      NOT NULL DEFAULT 0,
+    blob_bytes       BIGINT      NOT NULL DEFAULT 0,
+    new_blob_count   BIGINT      NOT NULL DEFAULT 0,
+    new_blob_bytes   BIGINT      NOT NULL DEFAULT 0,
+    error            TEXT,
+    started_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at      TIMESTAMPTZ,
+    verify_status    TEXT        CHECK (verify_status IN ('running', 'ok', 'failed')),
+    verify_error     TEXT,
+    verified_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS backup_runs_started_idx ON backup_runs (started_at DESC);
+
+CREATE TABLE IF NOT EXISTS backup_blobs (
+    object_key   TEXT        PRIMARY KEY,
+    size_bytes   BIGINT      NOT NULL,
+    backup_id    UUID        NOT NULL REFERENCES backup_runs (id) ON DELETE CASCADE,
+    backed_up_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
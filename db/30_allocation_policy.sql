@@ -0,0 +1,27 @@
+-- Drive placement for new users. The DriveAllocator picks a drive at
+-- registration time with the policy named by ALLOCATION_POLICY:
+--
+--   'best-fit'      the drive with the least free quota that still fits
+--   'least-loaded'  the drive with the lowest share of its capacity allocated
+--   'round-robin'   the drive that least recently received an allocation
+--   'tier-aware'    best-fit among drives whose tier matches the user's,
+--                   falling back to the other tier when none fit
+--
+-- Only active drives on active servers that are not down are considered;
+-- drives on degraded servers are used only when nothing healthy fits.
+--
+-- drives.tier marks drives intended for premium users (e.g. faster or
+-- replicated storage); only the tier-aware policy reads it.
+--
+-- An invitation may override placement for the user it creates:
+-- allocation_drive_id pins the user to one drive (registration fails if it no
+-- longer fits), allocation_policy picks a policy other than the default.
+
+ALTER TABLE drives
+  ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT 'standard'
+                                CHECK (tier IN ('standard', 'premium'));
+
+ALTER TABLE invitations
+  ADD COLUMN IF NOT EXISTS allocation_drive_id UUID REFERENCES drives (id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS allocation_policy   TEXT
+                                               CHECK (allocation_policy IN ('best-fit', 'least-loaded', 'round-robin', 'tier-aware'));
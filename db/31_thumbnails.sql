@@ -0,0 +1,11 @@
+-- Thumbnails. video_variants now holds every derivative of a file, not only
+-- transcoded video: the ThumbnailService stores small JPEG previews of images,
+-- poster frames of videos and first-page previews of PDFs as variants with
+-- quality 'thumb-small' (256 px) and 'thumb-large' (1024 px) on the longest
+-- edge. Like the 480p variant they are encrypted with the owner's key, live on
+-- the owner's drive and are served by GET /files/:id/thumbnail?size=.
+--
+-- mime_type is the content type of the decrypted variant.
+
+ALTER TABLE video_variants
+  ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT 'video/mp4';
@@ -0,0 +1,44 @@
+-- Background job queue for per-file media work (transcoding, capture-date
+-- extraction, thumbnails). A fixed pool of JOB_WORKERS workers claims queued
+-- rows with FOR UPDATE SKIP LOCKED, so a bulk upload no longer starts one
+-- FFmpeg process per file and pending work survives a restart.
+--
+-- status:
+--   'queued'     waiting for a worker; run_after delays a retry
+--   'running'    claimed by a worker; reset to 'queued' at startup because
+--                the process that claimed it is gone
+--   'done'       finished
+--   'failed'     gave up after max_attempts, or hit an error retrying cannot fix
+--   'cancelled'  cancelled by an admin
+--
+-- Failed attempts are retried with exponential backoff. An admin can retry a
+-- failed or cancelled job, which resets its attempt counter.
+--
+-- Jobs carry both user_id (for RLS reads of files) and username (for the
+-- drive allocation and user key); the username follows renames.
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id           UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind         TEXT        NOT NULL CHECK (kind IN ('transcode', 'taken_at', 'thumbnail')),
+    file_id      UUID        NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    user_id      UUID        NOT NULL,
+    username     TEXT        NOT NULL REFERENCES users (username) ON UPDATE CASCADE ON DELETE CASCADE,
+    status       TEXT        NOT NULL DEFAULT 'queued'
+                             CHECK (status IN ('queued', 'running', 'done', 'failed', 'cancelled')),
+    attempts     INT         NOT NULL DEFAULT 0,
+    max_attempts INT         NOT NULL DEFAULT 3,
+    run_after    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error   TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMPTZ,
+    finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS jobs_queued_idx ON jobs (run_after, created_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON jobs (status, created_at DESC);
+
+-- At most one unfinished job of each kind per file.
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_one_active_idx
+    ON jobs (file_id, kind)
+    WHERE status IN ('queued', 'running');
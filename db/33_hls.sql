@@ -0,0 +1,17 @@
+-- Adaptive HLS streaming. An 'hls' job encodes each uploaded video into up to
+-- three renditions (360p, 720p, 1080p; none taller than the source) of
+-- fragmented-MP4 segments. Every file of a rendition is stored as its own
+-- encrypted video_variants row with quality 'hls/<rendition>/<name>':
+--
+--   hls/720p/index.m3u8     media playlist, stored last
+--   hls/720p/init.mp4       init segment
+--   hls/720p/seg_00000.m4s  media segments
+--
+-- A rendition is playable once its index.m3u8 row is ready.
+-- GET /files/:id/hls/master.m3u8 lists the playable renditions and signs
+-- every playlist and segment URL with a presigned token, so native players
+-- that send no cookies can follow them.
+
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_kind_check;
+ALTER TABLE jobs ADD CONSTRAINT jobs_kind_check
+  CHECK (kind IN ('transcode', 'taken_at', 'thumbnail', 'hls'));
@@ -0,0 +1,37 @@
+-- Media metadata beyond the capture date. One row per image or video, written
+-- by Upload for images and by the background 'taken_at' probe for videos
+-- (and chunked image uploads): EXIF for images, ffprobe for videos. Every
+-- column is nullable because any of them may be missing from the source.
+--
+-- user_id duplicates files.user_id so a user's rows can be found without
+-- reading files, which is behind row-level security.
+--
+-- latitude / longitude / altitude come from the EXIF GPS IFD or the
+-- QuickTime/MP4 location tag. They are never stored for users who turned
+-- user_preferences.record_location off, and turning it off clears them.
+-- POST /files/:id/strip-location clears them for one file and also removes
+-- the location from the stored file itself.
+
+CREATE TABLE IF NOT EXISTS media_metadata (
+    file_id      UUID             PRIMARY KEY REFERENCES files (id) ON DELETE CASCADE,
+    user_id      UUID             NOT NULL,
+    width        INT,
+    height       INT,
+    orientation  SMALLINT,
+    camera_make  TEXT,
+    camera_model TEXT,
+    lens_model   TEXT,
+    latitude     DOUBLE PRECISION,
+    longitude    DOUBLE PRECISION,
+    altitude     DOUBLE PRECISION,
+    duration_ms  BIGINT,
+    video_codec  TEXT,
+    audio_codec  TEXT,
+    bitrate      BIGINT,
+    extracted_at TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS media_metadata_user_id_idx ON media_metadata (user_id);
+
+ALTER TABLE user_preferences
+  ADD COLUMN IF NOT EXISTS record_location BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,15 @@
+-- Perceptual hash of every image, for finding duplicate and near-duplicate
+-- photos (burst shots, re-saved or re-compressed copies).
+--
+-- perceptual_hash is a 64-bit difference hash (dHash) of the upright image:
+-- one bit per horizontally adjacent pixel pair of a 9×8 grayscale reduction.
+-- Visually similar images differ in only a few bits, so similarity is the
+-- Hamming distance between two hashes. It is written by the background
+-- 'thumbnail' job from the small thumbnail and is NULL for non-images and
+-- for images uploaded before this migration.
+
+ALTER TABLE files
+  ADD COLUMN IF NOT EXISTS perceptual_hash BIGINT;
+
+CREATE INDEX IF NOT EXISTS files_perceptual_hash_idx
+  ON files (user_id) WHERE perceptual_hash IS NOT NULL;
@@ -0,0 +1,45 @@
+-- Full-text search over file contents. A background 'text_index' job
+-- extracts the text of plain-text, Markdown, PDF (text layer) and Office
+-- Open XML (docx, xlsx, pptx) files and indexes it for GET /search.
+--
+-- Neither table holds readable content, in keeping with files being
+-- encrypted at rest:
+--
+--   search_documents.text_ciphertext is the extracted text, AES-256-GCM
+--   encrypted with the owner's file key; it is decrypted only to cut result
+--   snippets.
+--
+--   search_terms is a blind index: each distinct word of a document is stored
+--   as the first 8 bytes of HMAC-SHA256 under a per-user index key derived
+--   from the owner's file key, with its frequency. Queries hash their words
+--   the same way, so the database can match and rank (BM25) without ever
+--   seeing a word. Matching is on whole words, case-insensitively.
+--
+-- user_id duplicates files.user_id so the index can be scoped without
+-- reading files, which is behind row-level security.
+
+CREATE TABLE IF NOT EXISTS search_documents (
+    file_id         UUID        PRIMARY KEY REFERENCES files (id) ON DELETE CASCADE,
+    user_id         UUID        NOT NULL,
+    -- doc_length is the number of indexed words, for BM25 length normalisation.
+    doc_length      INT         NOT NULL,
+    text_ciphertext BYTEA       NOT NULL,
+    text_nonce      BYTEA       NOT NULL,
+    indexed_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS search_documents_user_id_idx ON search_documents (user_id);
+
+CREATE TABLE IF NOT EXISTS search_terms (
+    file_id UUID   NOT NULL REFERENCES search_documents (file_id) ON DELETE CASCADE,
+    user_id UUID   NOT NULL,
+    term    BIGINT NOT NULL,
+    tf      INT    NOT NULL,
+    PRIMARY KEY (file_id, term)
+);
+
+CREATE INDEX IF NOT EXISTS search_terms_user_term_idx ON search_terms (user_id, term);
+
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_kind_check;
+ALTER TABLE jobs ADD CONSTRAINT jobs_kind_check
+  CHECK (kind IN ('transcode', 'taken_at', 'thumbnail', 'hls', 'text_index'));
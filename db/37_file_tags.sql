@@ -0,0 +1,7 @@
+-- Free-form tags on files, set with PUT /files/:file_id/tags and matched by
+-- the tag filter of GET /search. Tags are stored lower-cased; the GIN index
+-- serves the `tag = ANY(tags)` containment lookups.
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS files_tags_idx ON files USING GIN (tags);
@@ -0,0 +1,36 @@
+-- Per-user change journal for delta sync (GET /changes). Every create,
+-- rename, move, hide/unhide, delete and content change of a file or folder
+-- appends a row in the same transaction as the change itself.
+--
+-- seq increases strictly per user. It is handed out by change_seqs, whose
+-- row for the user stays locked until the writing transaction commits, so
+-- changes commit in seq order and a client that has read up to seq N never
+-- sees a later commit appear below N.
+--
+-- Like the search index, neither table is behind row-level security: user_id
+-- is set by the writer, every read is scoped by it, and the retention sweep
+-- runs across users. Rows older than the retention window are pruned; a
+-- cursor that predates the oldest remaining row has to start over.
+
+CREATE TABLE IF NOT EXISTS change_seqs (
+    user_id UUID   PRIMARY KEY,
+    seq     BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS changes (
+    user_id    UUID        NOT NULL,
+    seq        BIGINT      NOT NULL,
+    item_type  TEXT        NOT NULL CHECK (item_type IN ('file', 'folder')),
+    item_id    UUID        NOT NULL,
+    op         TEXT        NOT NULL
+               CHECK (op IN ('create', 'rename', 'move', 'hide', 'unhide', 'delete', 'content')),
+    -- name and parent_id are the item's state after the change (before it,
+    -- for a delete). parent_id is the folder a file is in or a folder's
+    -- parent; NULL means root.
+    name       TEXT        NOT NULL,
+    parent_id  UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS changes_created_at_idx ON changes (created_at);
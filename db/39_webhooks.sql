@@ -0,0 +1,70 @@
+-- Outbound webhooks. A user registers an endpoint URL and the event types
+-- it wants (file.uploaded, file.deleted, variant.ready, quota.warning; admins
+-- also user.banned), optionally narrowed to the files of one folder. Every
+-- matching event becomes a row in webhook_deliveries, inserted by the same
+-- statement that publishes the event (see api/db/events.go), and a
+-- background worker POSTs it to the endpoint with an HMAC-SHA256 signature
+-- made with the webhook's secret.
+--
+-- The server has to sign with the secret, so it cannot be hashed; like the
+-- MinIO credentials in servers it is stored encrypted with the KEK
+-- (AES-256-GCM, secret_enc + secret_nonce) and only shown to the user when
+-- the webhook is created.
+--
+-- Like the change journal, neither table is behind row-level security:
+-- every user-facing query is scoped by user_id and the delivery worker runs
+-- across users.
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID        NOT NULL,
+    username   TEXT        NOT NULL REFERENCES users (username) ON UPDATE CASCADE ON DELETE CASCADE,
+    url        TEXT        NOT NULL,
+    secret_enc   BYTEA     NOT NULL,
+    secret_nonce BYTEA     NOT NULL,
+    events     TEXT[]      NOT NULL,
+    -- folder_id narrows file.uploaded and file.deleted to the files directly
+    -- in that folder; other event types are not affected.
+    folder_id  UUID        REFERENCES folders (id) ON DELETE CASCADE,
+    enabled    BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_user_idx ON webhooks (user_id, created_at);
+
+-- Delivery queue and log, modelled on email_queue. The worker claims a due
+-- pending row with FOR UPDATE SKIP LOCKED and counts the attempt up front;
+-- next_attempt_at is pushed out for the length of the attempt, so a row
+-- claimed by a process that died is picked up again later.
+--
+-- status:
+--   'pending'    waiting for an attempt; next_attempt_at delays a retry
+--   'delivered'  the endpoint answered 2xx
+--   'failed'     gave up after the last attempt
+--
+-- Failed attempts are retried with exponential backoff. (webhook_id,
+-- event_id) is unique, so an event is queued at most once per webhook.
+-- Finished rows are pruned after the retention window.
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    webhook_id       UUID        NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id         UUID        NOT NULL,
+    event_type       TEXT        NOT NULL,
+    payload          JSONB       NOT NULL,
+    status           TEXT        NOT NULL DEFAULT 'pending'
+                                 CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts         INT         NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_status_code INT,
+    last_error       TEXT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at     TIMESTAMPTZ,
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx
+    ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_created_idx ON webhook_deliveries (created_at);
@@ -0,0 +1,14 @@
+-- Integrity scrub passes. ScrubService records each pass it starts and marks
+-- it finished when it completes, and schedules the next pass from the start
+-- of the last finished one, so restarts neither reset the daily schedule nor
+-- keep a pass from ever running. A pass cut short by a restart keeps a NULL
+-- finished_at and is run again after boot.
+
+CREATE TABLE IF NOT EXISTS scrub_passes (
+    id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    started_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ,
+    error       TEXT
+);
+
+CREATE INDEX IF NOT EXISTS scrub_passes_finished_idx ON scrub_passes (finished_at DESC);
@@ -0,0 +1,8 @@
+-- Hash-only 'perceptual_hash' jobs, queued by an admin backfill for images
+-- whose thumbnails were rendered before 35_perceptual_hash.sql and so have a
+-- NULL perceptual_hash. The job hashes the stored small thumbnail instead of
+-- rendering the image again.
+
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_kind_check;
+ALTER TABLE jobs ADD CONSTRAINT jobs_kind_check
+  CHECK (kind IN ('transcode', 'taken_at', 'thumbnail', 'hls', 'text_index', 'perceptual_hash'));